@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Interactive completion =====
+
+// completer returns the completions of word, the text between the last space and the cursor.
+type completer func(word string) []string
+
+// endpoints are the endpoint names offered at the endpoint prompt.
+var endpoints = []string{"query", "allocations", "cloudCosts", "assets"}
+
+// filterKeys can be written as key=value in a query; see splitInlineFilters.
+var filterKeys = []string{"namespace", "start", "end", "window", "timezone", "provider", "region", "status", "tag", "expr"}
+
+// matching returns the sorted, distinct options that start with word.
+func matching(word string, options []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, o := range options {
+		if strings.HasPrefix(o, word) && !seen[o] {
+			seen[o] = true
+			out = append(out, o)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// commonPrefix is the longest prefix shared by every candidate.
+func commonPrefix(cands []string) string {
+	prefix := cands[0]
+	for _, c := range cands[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// knownValues holds the namespaces, providers and regions the server currently returns.
+// They are fetched once, in the background, so completion never waits on a cold request.
+type knownValues struct {
+	once   sync.Once
+	values map[string][]string // filter key -> values
+}
+
+// catalogPaths are the server's catalog endpoints for each completed filter.
+var catalogPaths = map[string]string{
+	"namespace": "/namespaces?window=30d",
+	"provider":  "/providers",
+	"region":    "/regions",
+}
+
+func (k *knownValues) load() {
+	k.once.Do(func() {
+		client := &http.Client{Timeout: 3 * time.Second}
+		k.values = map[string][]string{}
+		for key, path := range catalogPaths {
+			var result struct {
+				Data []struct {
+					Name string `json:"name"`
+				} `json:"data"`
+			}
+			if getJSON(client, path, &result) != nil {
+				// Servers without the catalog: read the values off the records
+				k.loadFromRecords(client)
+				return
+			}
+			for _, e := range result.Data {
+				k.values[key] = append(k.values[key], e.Name)
+			}
+		}
+	})
+}
+
+// loadFromRecords collects values from unfiltered /allocations and /assets responses.
+func (k *knownValues) loadFromRecords(client *http.Client) {
+	k.values = map[string][]string{}
+	for path, fields := range map[string][]string{
+		"/allocations": {"namespace"},
+		"/assets":      {"provider", "region"},
+	} {
+		var result struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		if getJSON(client, path, &result) != nil {
+			continue
+		}
+		for _, rec := range result.Data {
+			for _, f := range fields {
+				if v, ok := rec[f].(string); ok && v != "" {
+					k.values[f] = append(k.values[f], v)
+				}
+			}
+		}
+	}
+}
+
+// getJSON decodes the response to GET path into v; any status but 200 is an error.
+func getJSON(client *http.Client, path string, v interface{}) error {
+	req, err := newServerRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// forKey completes values of one filter.
+func (k *knownValues) forKey(key string) completer {
+	return func(word string) []string {
+		k.load()
+		return matching(word, k.values[key])
+	}
+}
+
+// query completes filter keys in a query, and their values after the "=".
+func (k *knownValues) query(word string) []string {
+	if key, val, ok := strings.Cut(word, "="); ok {
+		k.load()
+		var out []string
+		for _, v := range matching(val, k.values[key]) {
+			out = append(out, key+"="+v)
+		}
+		return out
+	}
+	keys := make([]string, len(filterKeys))
+	for i, key := range filterKeys {
+		keys[i] = key + "="
+	}
+	return matching(word, keys)
+}
+
+// splitInlineFilters pulls key=value tokens for known filter keys out of a query, so
+// "prod costs namespace=prod" asks the server "prod costs" with namespace set.
+func splitInlineFilters(query string) (string, map[string]string) {
+	inline := map[string]string{}
+	var rest []string
+	for _, tok := range strings.Fields(query) {
+		if key, val, ok := strings.Cut(tok, "="); ok && slices.Contains(filterKeys, key) {
+			inline[key] = val
+			continue
+		}
+		rest = append(rest, tok)
+	}
+	return strings.Join(rest, " "), inline
+}
+
+// ===== Shell completion =====
+
+const bashCompletion = `# bash completion for costs; load with: source <(costs completion bash)
+_costs_sessions() {
+    costs session list 2>/dev/null | cut -c3- | awk '{print $1}'
+}
+
+_costs_profiles() {
+    costs config view 2>/dev/null | grep -v -e '^#' -e '^    ' | cut -c3-
+}
+
+_costs() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}" cmd=""
+    [ "$COMP_CWORD" -ge 2 ] && cmd="${COMP_WORDS[COMP_CWORD-2]}"
+    case "$prev" in
+    --session)
+        COMPREPLY=($(compgen -W "$(_costs_sessions)" -- "$cur")) ;;
+    --profile)
+        COMPREPLY=($(compgen -W "$(_costs_profiles)" -- "$cur")) ;;
+    use|reset|delete)
+        if [ "$cmd" = config ]; then
+            COMPREPLY=($(compgen -W "$(_costs_profiles)" -- "$cur"))
+        else
+            COMPREPLY=($(compgen -W "$(_costs_sessions)" -- "$cur"))
+        fi ;;
+    get|set)
+        COMPREPLY=($(compgen -W "url api_key session format" -- "$cur")) ;;
+    session)
+        COMPREPLY=($(compgen -W "list new use fork reset delete" -- "$cur")) ;;
+    config)
+        COMPREPLY=($(compgen -W "view get set use delete" -- "$cur")) ;;
+    version)
+        COMPREPLY=($(compgen -W "--check" -- "$cur")) ;;
+    self-update)
+        COMPREPLY=($(compgen -W "--force" -- "$cur")) ;;
+    completion)
+        COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+    -o|--output)
+        COMPREPLY=($(compgen -f -- "$cur")) ;;
+    --chart)
+        COMPREPLY=($(compgen -W "bars spark" -- "$cur")) ;;
+    --resolution)
+        COMPREPLY=($(compgen -W "day hour" -- "$cur")) ;;
+    *)
+        if [[ " ${COMP_WORDS[*]} " == *" trend "* ]]; then
+            COMPREPLY=($(compgen -W "--window --namespace --resolution --timezone --chart" -- "$cur"))
+        elif [[ " ${COMP_WORDS[*]} " == *" loadtest "* ]]; then
+            COMPREPLY=($(compgen -W "--duration --requests --concurrency --endpoints --window" -- "$cur"))
+        else
+            COMPREPLY=($(compgen -W "--profile --url --session --sort-by --watch --output version self-update session config trend loadtest completion" -- "$cur"))
+        fi ;;
+    esac
+}
+complete -F _costs costs
+`
+
+const fishCompletion = `# fish completion for costs; load with: costs completion fish | source
+function __costs_sessions
+    costs session list 2>/dev/null | cut -c3- | awk '{print $1}'
+end
+
+function __costs_profiles
+    costs config view 2>/dev/null | grep -v -e '^#' -e '^    ' | cut -c3-
+end
+
+complete -c costs -f
+complete -c costs -n __fish_use_subcommand -l session -xa '(__costs_sessions)' -d 'Run in a named session'
+complete -c costs -n __fish_use_subcommand -l profile -xa '(__costs_profiles)' -d 'Use a server profile'
+complete -c costs -n __fish_use_subcommand -l url -x -d 'Server URL, overriding the profile'
+complete -c costs -n __fish_use_subcommand -l sort-by -x -d 'Sort tables by a column, e.g. total:desc'
+complete -c costs -n __fish_use_subcommand -l watch -x -d 'Repeat a query every interval, e.g. 30s'
+complete -c costs -n __fish_use_subcommand -s o -l output -rF -d 'Write the result to a .json, .csv or .xlsx file'
+complete -c costs -n __fish_use_subcommand -a version -d 'Print the CLI version'
+complete -c costs -n __fish_use_subcommand -a self-update -d 'Install the latest release'
+complete -c costs -n __fish_use_subcommand -a session -d 'Manage named sessions'
+complete -c costs -n __fish_use_subcommand -a config -d 'View or edit server profiles'
+complete -c costs -n __fish_use_subcommand -a trend -d 'Chart daily or hourly costs'
+complete -c costs -n __fish_use_subcommand -a loadtest -d 'Drive the server with concurrent queries and report latency'
+complete -c costs -n __fish_use_subcommand -a completion -d 'Print a shell completion script'
+complete -c costs -n '__fish_seen_subcommand_from version' -l check
+complete -c costs -n '__fish_seen_subcommand_from self-update' -l force
+complete -c costs -n '__fish_seen_subcommand_from session; and not __fish_seen_subcommand_from list new use fork reset delete' -a 'list new use fork reset delete'
+complete -c costs -n '__fish_seen_subcommand_from session; and __fish_seen_subcommand_from use reset delete' -a '(__costs_sessions)'
+complete -c costs -n '__fish_seen_subcommand_from config; and not __fish_seen_subcommand_from view get set use delete' -a 'view get set use delete'
+complete -c costs -n '__fish_seen_subcommand_from config; and __fish_seen_subcommand_from get set' -a 'url api_key session format'
+complete -c costs -n '__fish_seen_subcommand_from config; and __fish_seen_subcommand_from use delete' -a '(__costs_profiles)'
+complete -c costs -n '__fish_seen_subcommand_from trend' -o window -x -d 'Time window, e.g. 7d'
+complete -c costs -n '__fish_seen_subcommand_from trend' -o namespace -x -d 'Namespace filter'
+complete -c costs -n '__fish_seen_subcommand_from trend' -o resolution -xa 'day hour'
+complete -c costs -n '__fish_seen_subcommand_from trend' -o timezone -x -d 'IANA time zone'
+complete -c costs -n '__fish_seen_subcommand_from trend' -o chart -xa 'bars spark'
+complete -c costs -n '__fish_seen_subcommand_from loadtest' -o duration -x -d 'How long to run, e.g. 30s'
+complete -c costs -n '__fish_seen_subcommand_from loadtest' -o requests -x -d 'Stop after this many requests'
+complete -c costs -n '__fish_seen_subcommand_from loadtest' -o concurrency -x -d 'Requests in flight at once'
+complete -c costs -n '__fish_seen_subcommand_from loadtest' -o endpoints -x -d 'Endpoints of the query mix, e.g. allocations,assets'
+complete -c costs -n '__fish_seen_subcommand_from loadtest' -o window -x -d 'Time window, e.g. 7d'
+complete -c costs -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+`
+
+// runCompletion implements `costs completion bash|zsh|fish`. zsh reuses the bash script
+// through bashcompinit.
+func runCompletion(args []string) int {
+	shell := ""
+	if len(args) > 0 {
+		shell = args[0]
+	}
+	switch shell {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print("# zsh completion for costs; load with: source <(costs completion zsh)\n")
+		fmt.Print("autoload -U +X bashcompinit && bashcompinit\n")
+		fmt.Print(bashCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		fmt.Println("Usage: costs completion bash|zsh|fish")
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ===== Export to file =====
+//
+// --output/-o <file> writes a response to a file for offline analysis. The extension picks the
+// format:
+//
+//	.json   the whole response, data and meta
+//	.csv    one row per record, then a blank line and a "meta" section of key,value rows
+//	.xlsx   a "data" sheet and a "meta" sheet
+//
+// Nested values (time-series points, enriched assets) are written as JSON text in CSV and XLSX.
+
+// exportFormats maps file extensions to writers.
+var exportFormats = map[string]func(io.Writer, string, map[string]interface{}) error{
+	".json": writeJSONExport,
+	".csv":  writeCSVExport,
+	".xlsx": writeXLSXExport,
+}
+
+// splitOutputFlag removes "-o <file>", "--output <file>" or "--output=<file>" from a query line.
+func splitOutputFlag(line string) (string, string) {
+	var rest []string
+	out := ""
+	toks := strings.Fields(line)
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		if v, ok := strings.CutPrefix(tok, "--output="); ok {
+			out = v
+			continue
+		}
+		if (tok == "-o" || tok == "--output") && i+1 < len(toks) {
+			out = toks[i+1]
+			i++
+			continue
+		}
+		rest = append(rest, tok)
+	}
+	return strings.Join(rest, " "), out
+}
+
+// checkExportPath reports an error for files whose extension isn't an export format.
+func checkExportPath(path string) error {
+	if _, ok := exportFormats[strings.ToLower(filepath.Ext(path))]; !ok {
+		return fmt.Errorf("can't tell the format of %q; use a .json, .csv or .xlsx file", path)
+	}
+	return nil
+}
+
+// exportResult writes result, the response of endpoint, to path in the format its extension
+// names.
+func exportResult(path, endpoint string, result map[string]interface{}) error {
+	if err := checkExportPath(path); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := exportFormats[strings.ToLower(filepath.Ext(path))](f, endpoint, result); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSONExport(w io.Writer, _ string, result map[string]interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// exportRecords returns the data records of result.
+func exportRecords(result map[string]interface{}) []map[string]interface{} {
+	var records []map[string]interface{}
+	if data, ok := result["data"].([]interface{}); ok {
+		for _, item := range data {
+			if rec, ok := item.(map[string]interface{}); ok {
+				records = append(records, rec)
+			}
+		}
+	}
+	return records
+}
+
+// exportHeader lists the fields of records: the endpoint's table columns first, in table
+// order, then any others alphabetically.
+func exportHeader(endpoint string, records []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	for _, rec := range records {
+		for k := range rec {
+			seen[k] = true
+		}
+	}
+	var header []string
+	for _, c := range endpointColumns[endpoint] {
+		if seen[c.key] {
+			header = append(header, c.key)
+			delete(seen, c.key)
+		}
+	}
+	var rest []string
+	for k := range seen {
+		rest = append(rest, k)
+	}
+	sort.Strings(rest)
+	return append(header, rest...)
+}
+
+// exportCell renders a value as cell text. Numbers keep full precision; objects and arrays
+// become JSON.
+func exportCell(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	default:
+		raw, _ := json.Marshal(x)
+		return string(raw)
+	}
+}
+
+// exportMeta returns meta as sorted key/value rows.
+func exportMeta(result map[string]interface{}) [][]string {
+	meta, _ := result["meta"].(map[string]interface{})
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rows := make([][]string, len(keys))
+	for i, k := range keys {
+		rows[i] = []string{k, exportCell(meta[k])}
+	}
+	return rows
+}
+
+func writeCSVExport(w io.Writer, endpoint string, result map[string]interface{}) error {
+	records := exportRecords(result)
+	header := exportHeader(endpoint, records)
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	for _, rec := range records {
+		row := make([]string, len(header))
+		for i, k := range header {
+			row[i] = exportCell(rec[k])
+		}
+		cw.Write(row)
+	}
+	cw.Write(nil)
+	cw.Write([]string{"meta"})
+	for _, row := range exportMeta(result) {
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ----- Minimal XLSX -----
+//
+// An XLSX file is a zip of SpreadsheetML parts. Cells use inline strings and plain numbers, so
+// no shared-string table or styles are needed.
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="data" sheetId="1" r:id="rId1"/><sheet name="meta" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+</Relationships>`
+)
+
+// xlsxColumn returns the spreadsheet column letters for a 0-based index: A, B, ... Z, AA.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxSheet renders rows as worksheet XML; float64 values become numeric cells.
+func xlsxSheet(rows [][]interface{}) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, v := range row {
+			ref := fmt.Sprintf("%s%d", xlsxColumn(c), r+1)
+			if f, ok := v.(float64); ok {
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(f, 'f', -1, 64))
+				continue
+			}
+			text := exportCell(v)
+			if text == "" {
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(&b, []byte(text))
+			b.WriteString(`</t></is></c>`)
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+func writeXLSXExport(w io.Writer, endpoint string, result map[string]interface{}) error {
+	records := exportRecords(result)
+	header := exportHeader(endpoint, records)
+	dataRows := [][]interface{}{make([]interface{}, len(header))}
+	for i, k := range header {
+		dataRows[0][i] = k
+	}
+	for _, rec := range records {
+		row := make([]interface{}, len(header))
+		for i, k := range header {
+			row[i] = rec[k]
+		}
+		dataRows = append(dataRows, row)
+	}
+	metaRows := [][]interface{}{{"key", "value"}}
+	meta, _ := result["meta"].(map[string]interface{})
+	for _, kv := range exportMeta(result) {
+		metaRows = append(metaRows, []interface{}{kv[0], meta[kv[0]]})
+	}
+
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/worksheets/sheet1.xml", xlsxSheet(dataRows)},
+		{"xl/worksheets/sheet2.xml", xlsxSheet(metaRows)},
+	}
+	for _, p := range parts {
+		pw, err := zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(pw, p.body); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// runExport implements `costs -o <file> <query>`: it runs a one-line query once and writes the
+// response to file.
+func runExport(path, line string) int {
+	if err := checkExportPath(path); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	endpoint, query, filters, ok := parseOneLine(line, &knownValues{})
+	if !ok {
+		query = ""
+	}
+	resp, err := postQuery(endpoint, AgenticQuery{Query: query, Filters: filters})
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	result := resp.asMap()
+	if err := exportResult(path, resp.endpointFor(endpoint), result); err != nil {
+		fmt.Println("Export failed:", err)
+		return 1
+	}
+	fmt.Printf("Wrote %d records to %s\n", len(exportRecords(result)), path)
+	return 0
+}
@@ -0,0 +1,13 @@
+module cli_client
+
+go 1.24.5
+
+require (
+	costtypes v0.0.0
+	golang.org/x/term v0.36.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.37.0 // indirect
+
+replace costtypes => ../costtypes
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Load test =====
+//
+// `costs loadtest` drives the server with concurrent agentic queries, a fixed mix over the
+// query endpoints, and reports throughput, status codes and latency percentiles overall and
+// per endpoint. Point it at a server backed by the mock (or a staging OpenCost) to measure
+// the effect of BACKEND_CACHE_TTL, chunked fetching and the like; don't aim it at production.
+
+// loadQuery is one entry of the query mix.
+type loadQuery struct {
+	endpoint string
+	aq       AgenticQuery
+}
+
+// loadMix is the query mix, cycled through by every worker. window fills in each query's
+// time window.
+func loadMix(window string) []loadQuery {
+	return []loadQuery{
+		{"allocations", AgenticQuery{Query: "prod costs", Filters: Filters{Namespace: "prod", Window: window}}},
+		{"allocations", AgenticQuery{Query: "costs per day", Filters: Filters{Window: window, Resolution: "day"}}},
+		{"allocations", AgenticQuery{Query: "expensive workloads", Filters: Filters{Window: window, Expr: "total_cost>5"}}},
+		{"cloudCosts", AgenticQuery{Query: "cloud spend"}},
+		{"assets", AgenticQuery{Query: "AWS assets", Filters: Filters{Provider: "AWS"}}},
+		{"query", AgenticQuery{Query: "what did dev cost", Filters: Filters{Window: window}}},
+	}
+}
+
+// loadSample is the outcome of one request.
+type loadSample struct {
+	endpoint string
+	status   int // 0 when the request failed without a response
+	latency  time.Duration
+}
+
+// runLoadTest implements `costs loadtest [--duration 30s | --requests n] [--concurrency 8]
+// [--endpoints allocations,cloudCosts,assets,query] [--window 7d]`.
+func runLoadTest(args []string) int {
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	duration := fs.Duration("duration", 30*time.Second, "how long to run, unless --requests is given")
+	requests := fs.Int("requests", 0, "stop after this many requests instead of after --duration")
+	concurrency := fs.Int("concurrency", 8, "requests in flight at once")
+	endpoints := fs.String("endpoints", "allocations,cloudCosts,assets,query", "endpoints of the query mix to use")
+	window := fs.String("window", "7d", "time window of the allocation queries")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *concurrency <= 0 || *requests < 0 || *duration <= 0 {
+		fmt.Println("--concurrency and --duration must be positive, --requests must not be negative")
+		return 2
+	}
+	var mix []loadQuery
+	selected := strings.Split(*endpoints, ",")
+	for _, q := range loadMix(*window) {
+		if slices.Contains(selected, q.endpoint) {
+			mix = append(mix, q)
+		}
+	}
+	if len(mix) == 0 {
+		fmt.Println("--endpoints must name at least one of allocations, cloudCosts, assets, query")
+		return 2
+	}
+
+	client := &http.Client{
+		Timeout:   60 * time.Second,
+		Transport: &http.Transport{MaxIdleConns: *concurrency, MaxIdleConnsPerHost: *concurrency},
+	}
+	limit := fmt.Sprintf("for %s", *duration)
+	if *requests > 0 {
+		limit = fmt.Sprintf("%d requests", *requests)
+	}
+	fmt.Printf("Load test against %s: %d workers, %s\n\n", profile.URL, *concurrency, limit)
+
+	// Workers take request numbers from next until the count or the deadline runs out
+	var (
+		mu      sync.Mutex
+		samples []loadSample
+		sent    int
+	)
+	deadline := time.Now().Add(*duration)
+	next := func() (int, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if (*requests > 0 && sent >= *requests) || (*requests == 0 && time.Now().After(deadline)) {
+			return 0, false
+		}
+		sent++
+		return sent - 1, true
+	}
+	started := time.Now()
+	var wg sync.WaitGroup
+	for range *concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n, ok := next(); ok; n, ok = next() {
+				s := sendLoadQuery(client, mix[n%len(mix)])
+				mu.Lock()
+				samples = append(samples, s)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	printLoadReport(samples, elapsed)
+	for _, s := range samples {
+		if s.status == 0 || s.status >= 500 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// sendLoadQuery posts one query and times it until the whole body has arrived.
+func sendLoadQuery(client *http.Client, q loadQuery) loadSample {
+	payload, _ := json.Marshal(q.aq)
+	s := loadSample{endpoint: q.endpoint}
+	req, err := newServerRequest(http.MethodPost, "/"+q.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return s
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", newRequestID())
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		s.latency = time.Since(started)
+		return s
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	s.latency, s.status = time.Since(started), resp.StatusCode
+	return s
+}
+
+// printLoadReport prints throughput, status counts and latency percentiles.
+func printLoadReport(samples []loadSample, elapsed time.Duration) {
+	if len(samples) == 0 {
+		fmt.Println("No requests were sent.")
+		return
+	}
+	statuses := map[int]int{}
+	byEndpoint := map[string][]time.Duration{}
+	var all []time.Duration
+	for _, s := range samples {
+		statuses[s.status]++
+		byEndpoint[s.endpoint] = append(byEndpoint[s.endpoint], s.latency)
+		all = append(all, s.latency)
+	}
+	fmt.Printf("Requests:   %d in %s (%.1f/s)\n", len(samples), elapsed.Round(time.Millisecond), float64(len(samples))/elapsed.Seconds())
+	codes := make([]int, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		label := fmt.Sprint(code)
+		if code == 0 {
+			label = "failed"
+		}
+		parts[i] = fmt.Sprintf("%s ×%d", label, statuses[code])
+	}
+	fmt.Printf("Status:     %s\n\n", strings.Join(parts, ", "))
+
+	fmt.Printf("%-12s %7s %9s %9s %9s %9s %9s\n", "endpoint", "count", "p50", "p90", "p95", "p99", "max")
+	names := make([]string, 0, len(byEndpoint))
+	for name := range byEndpoint {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		printLatencyRow(name, byEndpoint[name])
+	}
+	printLatencyRow("all", all)
+}
+
+func printLatencyRow(name string, latencies []time.Duration) {
+	slices.Sort(latencies)
+	ms := func(p float64) string {
+		return fmt.Sprintf("%.1fms", float64(percentile(latencies, p))/float64(time.Millisecond))
+	}
+	fmt.Printf("%-12s %7d %9s %9s %9s %9s %9s\n", name, len(latencies), ms(50), ms(90), ms(95), ms(99), ms(100))
+}
+
+// percentile returns the p-th percentile of sorted by the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(0, min(rank, len(sorted)-1))]
+}
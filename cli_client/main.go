@@ -1,40 +1,124 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
+
+	"costtypes"
 )
 
 // ----- Payload Structs -----
-// Filters: endpoint-specific parameters
-type Filters struct {
-	Namespace string `json:"namespace,omitempty"`
-	Start     string `json:"start,omitempty"`
-	End       string `json:"end,omitempty"`
-	Provider  string `json:"provider,omitempty"`
-	Region    string `json:"region,omitempty"`
-}
-
-// Context: session_id used for conversation tracking
-type Context struct {
-	SessionID string `json:"session_id,omitempty"`
-}
+// The request payload is shared with the server; see the costtypes module.
+type (
+	Filters      = costtypes.Filters
+	AgenticQuery = costtypes.AgenticQuery
+)
 
-// AgenticQuery: full request payload
-type AgenticQuery struct {
-	Query   string  `json:"query,omitempty"`
-	Filters Filters `json:"filters,omitempty"`
-	Context Context `json:"context,omitempty"`
+// newRequestID returns a random identifier sent as X-Request-ID; the server echoes it and
+// forwards it to the backend, so one ID traces a query through all three components.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "cli-" + hex.EncodeToString(b)
 }
 
 func main() {
+	// --- Subcommands (non-interactive) ---
+	args := os.Args[1:]
+	flags := map[string]string{"--session": "", "--profile": "", "--url": "", "--sort-by": "", "--watch": "", "--output": ""}
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		name, v, hasValue := strings.Cut(args[0], "=")
+		if name == "-o" {
+			name = "--output"
+		}
+		if _, ok := flags[name]; !ok {
+			break
+		}
+		if hasValue {
+			flags[name], args = v, args[1:]
+		} else if len(args) > 1 {
+			flags[name], args = args[1], args[2:]
+		} else {
+			fmt.Printf("Usage: costs %s <value>\n", name)
+			os.Exit(2)
+		}
+	}
+	sessionName, profileName := flags["--session"], flags["--profile"]
+	urlFlag = flags["--url"]
+	sortBy, err := parseSortSpec(flags["--sort-by"])
+	if err != nil {
+		fmt.Println("Invalid --sort-by:", err)
+		os.Exit(2)
+	}
+	if out := flags["--output"]; out != "" {
+		if len(args) == 0 || flags["--watch"] != "" {
+			fmt.Println("Usage: costs -o <file.json|file.csv|file.xlsx> <query>")
+			os.Exit(2)
+		}
+		if err := useProfile(profileName); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(runExport(out, strings.Join(args, " ")))
+	}
+	if flags["--watch"] != "" {
+		interval, err := parseWatchInterval(flags["--watch"])
+		if err != nil {
+			fmt.Println("Invalid --watch:", err)
+			os.Exit(2)
+		}
+		if err := useProfile(profileName); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(runWatch(interval, strings.Join(args, " "), sortBy))
+	}
+	if len(args) > 0 {
+		switch args[0] {
+		case "version":
+			os.Exit(runVersion(args[1:]))
+		case "self-update":
+			os.Exit(runSelfUpdate(args[1:]))
+		case "session":
+			if len(args) > 1 && args[1] == "fork" {
+				if err := useProfile(profileName); err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+			}
+			os.Exit(runSession(args[1:]))
+		case "completion":
+			os.Exit(runCompletion(args[1:]))
+		case "config":
+			os.Exit(runConfig(args[1:], profileName))
+		case "trend":
+			if err := useProfile(profileName); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			os.Exit(runTrend(args[1:]))
+		case "loadtest":
+			if err := useProfile(profileName); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			os.Exit(runLoadTest(args[1:]))
+		default:
+			fmt.Printf("Unknown command %q. Usage: costs [--profile <name>] [--url <server>] [--session <name>] [--sort-by <column>[:asc|:desc]] [--watch <interval> <query> | -o <file> <query> | version [--check] | self-update [--force] | session ... | config ... | trend ... | loadtest ... | completion bash|zsh|fish]\n", args[0])
+			os.Exit(2)
+		}
+	}
+
 	// --- Graceful exit handler for Ctrl+C ---
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
@@ -45,143 +129,209 @@ func main() {
 	}()
 
 	// --- CLI setup ---
-	reader := bufio.NewReader(os.Stdin)
-	sessionID := "cli-demo-001" // fixed session; can be changed for testing
+	if err := useProfile(profileName); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Println("Failed to load config:", err)
+		os.Exit(1)
+	}
+	if sessionName == "" {
+		sessionName = profile.Session
+	}
+	if sessionName == "" {
+		sessionName = cfg.Current
+	}
+	session := cfg.Sessions[sessionName]
+	if session == nil {
+		fmt.Printf("No session %q; create it with `costs session new %s`.\n", sessionName, sessionName)
+		os.Exit(1)
+	}
+	session.LastUsed = time.Now().UTC()
+	if err := cfg.save(); err != nil {
+		fmt.Println("Warning: failed to save config:", err)
+	}
+	sessionID := session.ID
 
 	fmt.Println("MCP CLI Conversation Client")
-	fmt.Println("Supports: allocations, cloudCosts, assets")
-	fmt.Println("Type 'quit' or 'exit' as the query to end session.\n")
+	fmt.Printf("Server:  %s\n", profile.URL)
+	fmt.Printf("Session: %s (%s)\n", session.Name, sessionID)
+	fmt.Println("Supports: query (server picks the endpoint), allocations, cloudCosts, assets")
+	fmt.Println("Type a whole request on one line, e.g. 'allocations prod last 7 days', or an endpoint for step-by-step prompts.")
+	fmt.Println("Press Tab to complete endpoints, filter values and key=value filters in queries.")
+	fmt.Print("Type 'quit' or 'exit' as the query to end session.\n\n")
+
+	// read prompts for one line with history and editing; end of input or Ctrl+C ends the session
+	lr := newLineReader()
+	known := &knownValues{}
+	go known.load()
+	read := func(prompt string, complete completer) string {
+		lr.complete = complete
+		line, err := lr.readLine(prompt)
+		if err != nil {
+			fmt.Println("\nGoodbye! MCP CLI session ended.")
+			os.Exit(0)
+		}
+		return strings.TrimSpace(line)
+	}
 
 	// --- Main interactive loop ---
 	for {
-		// 1️⃣ Choose endpoint
-		fmt.Print("Choose endpoint (allocations/cloudCosts/assets): ")
-		endpoint, _ := reader.ReadString('\n')
-		endpoint = strings.TrimSpace(endpoint)
-		if endpoint == "" {
-			endpoint = "allocations" // default if empty
-		}
-
-		// 2️⃣ Enter natural language query
-		fmt.Print("Enter query: ")
-		query, _ := reader.ReadString('\n')
-		query = strings.TrimSpace(query)
-		if q := strings.ToLower(query); q == "quit" || q == "exit" {
+		// 1️⃣ Choose endpoint, or type the whole request on one line
+		line := read("Choose endpoint (query/allocations/cloudCosts/assets) or type a one-line query: ", func(word string) []string {
+			return append(matching(word, endpoints), known.query(word)...)
+		})
+		if q := strings.ToLower(line); q == "quit" || q == "exit" {
 			fmt.Println("\nGoodbye! MCP CLI session ended.")
 			break
 		}
+		line, lineSort := splitSortFlag(line)
+		line, lineOut := splitOutputFlag(line)
+		endpoint, query, filters, oneLine := parseOneLine(line, known)
+		if oneLine {
+			lr.addHistory(line)
+		} else {
+			if endpoint == "" {
+				endpoint = "allocations" // default if empty
+			}
 
-		// 3️⃣ Endpoint-specific filter prompts
-		var namespace, start, end, provider, region string
-		switch endpoint {
-		case "allocations":
-			fmt.Print("Namespace: ")
-			namespace, _ = reader.ReadString('\n')
-			namespace = strings.TrimSpace(namespace)
-
-			fmt.Print("Start date (RFC3339): ")
-			start, _ = reader.ReadString('\n')
-			start = strings.TrimSpace(start)
-
-			fmt.Print("End date (RFC3339): ")
-			end, _ = reader.ReadString('\n')
-			end = strings.TrimSpace(end)
+			// 2️⃣ Enter natural language query
+			query = read("Enter query: ", known.query)
+			if q := strings.ToLower(query); q == "quit" || q == "exit" {
+				fmt.Println("\nGoodbye! MCP CLI session ended.")
+				break
+			}
+			lr.addHistory(query)
+			query, lineSort = splitSortFlag(query)
+			query, lineOut = splitOutputFlag(query)
 
-		case "cloudCosts":
-			fmt.Print("Namespace: ")
-			namespace, _ = reader.ReadString('\n')
-			namespace = strings.TrimSpace(namespace)
+			// 3️⃣ Endpoint-specific filter prompts, skipped for filters given inline as key=value
+			var inline map[string]string
+			query, inline = splitInlineFilters(query)
+			for key, val := range inline {
+				filters.Set(key, val)
+			}
+			ask := func(key, prompt string) {
+				if _, ok := inline[key]; !ok {
+					filters.Set(key, read(prompt, known.forKey(key)))
+				}
+			}
+			switch endpoint {
+			case "allocations":
+				ask("namespace", "Namespace: ")
+				ask("start", "Start date (RFC3339): ")
+				ask("end", "End date (RFC3339): ")
 
-		case "assets":
-			fmt.Print("Provider: ")
-			provider, _ = reader.ReadString('\n')
-			provider = strings.TrimSpace(provider)
+			case "cloudCosts":
+				ask("namespace", "Namespace: ")
 
-			fmt.Print("Region: ")
-			region, _ = reader.ReadString('\n')
-			region = strings.TrimSpace(region)
+			case "assets":
+				ask("provider", "Provider: ")
+				ask("region", "Region: ")
+			}
 		}
 
 		// 4️⃣ Build agentic JSON payload
-		aq := AgenticQuery{
-			Query: query,
-			Filters: Filters{
-				Namespace: namespace,
-				Start:     start,
-				End:       end,
-				Provider:  provider,
-				Region:    region,
-			},
-			Context: Context{
-				SessionID: sessionID,
-			},
-		}
+		aq := costtypes.NewAgenticQuery(query, filters, sessionID)
 		payload, _ := json.Marshal(aq)
 
-		// 5️⃣ Send POST to MCP server
-		url := fmt.Sprintf("http://localhost:9004/%s", endpoint)
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(payload))
+		// 5️⃣ Send POST to MCP server, tagged with a fresh request ID for tracing
+		requestID := newRequestID()
+		req, _ := newServerRequest(http.MethodPost, "/"+endpoint, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-ID", requestID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Printf("Error sending request (request_id %s): %v\n", requestID, err)
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
 		if err != nil {
-			fmt.Println("Error sending request:", err)
+			fmt.Println("Error reading response:", err)
 			continue
 		}
-		defer resp.Body.Close()
 
-		// 6️⃣ Decode JSON response
-		var result map[string]interface{}
-		err = json.NewDecoder(resp.Body).Decode(&result)
+		// 6️⃣ Decode JSON response into typed structs
+		result, err := decodeResponse(body)
 		if err != nil {
 			fmt.Println("Error decoding response:", err)
 			continue
 		}
+		endpoint = result.endpointFor(endpoint) // /query answers from the endpoint it routed to
 
-		// 7️⃣ Print metadata (conversation context info)
-		fmt.Println("\n--- MCP Response ---")
-		if meta, ok := result["meta"].(map[string]interface{}); ok {
-			fmt.Println("Session ID:          ", meta["session_id"])
-			fmt.Println("Previous Query:      ", meta["previous_query"])
-			fmt.Println("Conversation Context:", meta["conversation_context"])
-			fmt.Println("Total Records:       ", meta["total"])
+		// -o <file> in the request saves this response, routed endpoint and all
+		if lineOut != "" {
+			raw := result.asMap()
+			if err := exportResult(lineOut, endpoint, raw); err != nil {
+				fmt.Println("Export failed:", err)
+			} else {
+				fmt.Printf("Wrote %d records to %s\n", len(exportRecords(raw)), lineOut)
+			}
 		}
 
-		// 8️⃣ Pretty print data records
-		dataArray, ok := result["data"].([]interface{})
-		if !ok || len(dataArray) == 0 {
-			fmt.Println("\n(No data records returned.)\n")
+		// The json format prints the response as-is, errors included
+		if profile.Format == "json" {
+			out, _ := json.MarshalIndent(result.asMap(), "", "  ")
+			fmt.Printf("%s\n\n", out)
 			continue
 		}
 
-		fmt.Println("\n--- Data Records ---")
-		switch endpoint {
-		case "allocations":
-			fmt.Printf("%-12s %-12s %-8s %-8s %-8s %-8s\n",
-				"Namespace", "ResID", "CPU", "Memory", "GPU", "Total")
-			fmt.Println(strings.Repeat("-", 60))
-			for _, item := range dataArray {
-				rec := item.(map[string]interface{})
-				fmt.Printf("%-12v %-12v %-8.2f %-8.2f %-8.2f %-8.2f\n",
-					rec["namespace"], rec["resource_id"],
-					rec["cpu_cost"], rec["memory_cost"], rec["gpu_cost"], rec["total_cost"])
+		// Server failures come back as {"error": {code, message, details, request_id}}
+		if apiErr := result.Error; apiErr != nil {
+			fmt.Printf("\nError [%s]: %s\n", apiErr.Code, apiErr.Message)
+			for _, fe := range apiErr.Details {
+				fmt.Printf("  - %s: %s\n", fe.Field, fe.Message)
 			}
+			fmt.Printf("  (request_id: %s)\n\n", apiErr.RequestID)
+			continue
+		}
 
-		case "cloudCosts":
-			fmt.Printf("%-20s %-10s\n", "Name", "Cost")
-			fmt.Println(strings.Repeat("-", 30))
-			for _, item := range dataArray {
-				rec := item.(map[string]interface{})
-				fmt.Printf("%-20v %-10.2f\n", rec["name"], rec["cost"])
-			}
+		// 7️⃣ Print metadata (conversation context info)
+		meta := result.Meta
+		fmt.Println("\n--- MCP Response ---")
+		fmt.Println("Session ID:          ", meta.SessionID)
+		fmt.Println("Previous Query:      ", meta.PreviousQuery)
+		fmt.Println("Conversation Context:", meta.ConversationContext)
+		fmt.Println("Total Records:       ", meta.Total)
+		fmt.Println("Request ID:          ", resp.Header.Get("X-Request-ID"))
+		if route := meta.Route; route != nil {
+			fmt.Printf("Routed To:            %s (confidence %v, extracted %v)\n", route.Endpoint, route.Confidence, route.Extracted)
+		}
+		if result.Summary != "" {
+			fmt.Println("\n" + result.Summary)
+		}
 
-		case "assets":
-			fmt.Printf("%-10s %-12s %-15s %-10s\n",
-				"Provider", "Region", "Name", "Type")
-			fmt.Println(strings.Repeat("-", 50))
-			for _, item := range dataArray {
-				rec := item.(map[string]interface{})
-				fmt.Printf("%-10v %-12v %-15v %-10v\n",
-					rec["provider"], rec["region"], rec["name"], rec["type"])
+		// 8️⃣ Pretty print data records under the endpoint's columns, sorted by --sort-by
+		cols, ok := endpointColumns[endpoint]
+		if !ok {
+			fmt.Print("\n(No table layout for this endpoint; set format: json to see the response.)\n\n")
+			continue
+		}
+		records, skipped := result.records(endpoint)
+		if len(records) == 0 {
+			fmt.Print("\n(No data records returned.)\n\n")
+			continue
+		}
+		spec := sortBy
+		if _, ok := findColumn(cols, spec.column); !ok {
+			spec = sortSpec{} // --sort-by only applies to endpoints that have the column
+		}
+		if lineSort != "" {
+			if spec, err = parseSortSpec(lineSort); err != nil {
+				fmt.Printf("\nInvalid --sort-by: %v\n\n", err)
+				continue
 			}
 		}
+		fmt.Println("\n--- Data Records ---")
+		if err := printTable(os.Stdout, cols, records, spec, nil); err != nil {
+			fmt.Println(err)
+		}
+		if skipped > 0 {
+			fmt.Printf("(%d records could not be read and were skipped.)\n", skipped)
+		}
 		fmt.Println()
 	}
 }
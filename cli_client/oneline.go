@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+)
+
+// ===== One-line queries =====
+//
+// Instead of answering the prompts one by one, a whole request can be typed at the endpoint
+// prompt:
+//
+//	allocations prod last 7 days        endpoint, then the question
+//	assets aws us-east-1 region=eu-west-1
+//	which namespace spent the most?     no endpoint word: the server's /query routes it
+//
+// Words naming a namespace (allocations, cloudCosts) or a provider or region (assets) the
+// server knows about become filters, as do key=value tokens. Everything else stays in the
+// query text, where the server picks up phrases such as "last 7 days".
+
+// endpointNamed returns the endpoint a word names, ignoring case.
+func endpointNamed(word string) (string, bool) {
+	for _, e := range endpoints {
+		if strings.EqualFold(word, e) {
+			return e, true
+		}
+	}
+	return "", false
+}
+
+// parseOneLine splits a one-line request into endpoint, query text and filters. It reports
+// false for an empty line or a bare endpoint name, which start the step-by-step prompts.
+func parseOneLine(line string, known *knownValues) (endpoint, query string, filters Filters, ok bool) {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return "", "", filters, false
+	}
+	endpoint, named := endpointNamed(words[0])
+	if named {
+		if len(words) == 1 {
+			return endpoint, "", filters, false
+		}
+		words = words[1:]
+	} else {
+		endpoint = "query"
+	}
+
+	query, inline := splitInlineFilters(strings.Join(words, " "))
+	for key, val := range inline {
+		filters.Set(key, val)
+	}
+
+	// Bare filter values only count for an explicit endpoint; /query extracts its own
+	var keys []string
+	switch endpoint {
+	case "allocations", "cloudCosts":
+		keys = []string{"namespace"}
+	case "assets":
+		keys = []string{"provider", "region"}
+	}
+	if len(keys) > 0 {
+		known.load()
+	}
+	for _, w := range strings.Fields(query) {
+		for _, key := range keys {
+			if _, given := inline[key]; given {
+				continue
+			}
+			for _, v := range known.values[key] {
+				if strings.EqualFold(w, v) {
+					filters.Set(key, v)
+					inline[key] = v
+				}
+			}
+		}
+	}
+	return endpoint, query, filters, true
+}
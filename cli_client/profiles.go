@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ===== Server profiles =====
+//
+// ~/.mcpcli.yaml (or $MCP_CLI_PROFILES) names the servers the CLI can talk to:
+//
+//	current_profile: staging
+//	profiles:
+//	  default:
+//	    url: http://localhost:9004
+//	  staging:
+//	    url: https://mcp.staging.example.com
+//	    api_key: s3cret        # sent as Authorization: Bearer
+//	    session: billing       # used unless --session is given
+//	    format: json           # table (default) or json
+//
+// --profile picks a profile for one run; `costs config` views and edits the file. --url, or
+// MCP_SERVER_URL, overrides the profile's server, e.g. to reach the server by its service
+// name from a container.
+
+const defaultServerURL = "http://localhost:9004"
+
+// Profile is one server the CLI can talk to.
+type Profile struct {
+	URL     string `yaml:"url"`
+	APIKey  string `yaml:"api_key,omitempty"`
+	Session string `yaml:"session,omitempty"`
+	Format  string `yaml:"format,omitempty"`
+}
+
+// ProfileFile is the content of profilesPath().
+type ProfileFile struct {
+	Current  string              `yaml:"current_profile,omitempty"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+// profileKeys are the settings `costs config set` accepts.
+var profileKeys = []string{"url", "api_key", "session", "format"}
+
+// profile is the profile in use, resolved in main before any request is made.
+var profile = &Profile{URL: defaultServerURL, Format: "table"}
+
+// urlFlag is --url, set in main.
+var urlFlag string
+
+// serverURLOverride is --url, else MCP_SERVER_URL; empty keeps the profile's URL.
+func serverURLOverride() string {
+	if urlFlag != "" {
+		return urlFlag
+	}
+	return os.Getenv("MCP_SERVER_URL")
+}
+
+// profilesPath is $MCP_CLI_PROFILES, else ~/.mcpcli.yaml.
+func profilesPath() (string, error) {
+	if p := os.Getenv("MCP_CLI_PROFILES"); p != "" {
+		return p, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("no home directory: %w (set MCP_CLI_PROFILES)", err)
+	}
+	return filepath.Join(home, ".mcpcli.yaml"), nil
+}
+
+// loadProfiles reads the profile file. A missing file yields a lone default profile.
+func loadProfiles() (*ProfileFile, error) {
+	pf := &ProfileFile{Profiles: map[string]*Profile{}}
+	path, err := profilesPath()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(raw, pf); err != nil {
+			return nil, fmt.Errorf("invalid profiles %s: %w", path, err)
+		}
+		if pf.Profiles == nil {
+			pf.Profiles = map[string]*Profile{}
+		}
+	}
+	if len(pf.Profiles) == 0 {
+		pf.Profiles["default"] = &Profile{URL: defaultServerURL}
+	}
+	if pf.Profiles[pf.Current] == nil {
+		pf.Current = pf.names()[0]
+	}
+	return pf, nil
+}
+
+func (pf *ProfileFile) save() error {
+	path, err := profilesPath()
+	if err != nil {
+		return err
+	}
+	raw, err := yaml.Marshal(pf)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o600)
+}
+
+// resolve returns the named profile, or the current one when name is empty, with defaults
+// filled in.
+func (pf *ProfileFile) resolve(name string) (*Profile, error) {
+	if name == "" {
+		name = pf.Current
+	}
+	p := pf.Profiles[name]
+	if p == nil {
+		return nil, fmt.Errorf("no profile %q in the profiles file", name)
+	}
+	resolved := *p
+	if resolved.URL == "" {
+		resolved.URL = defaultServerURL
+	}
+	resolved.URL = strings.TrimRight(resolved.URL, "/")
+	if resolved.Format == "" {
+		resolved.Format = "table"
+	}
+	return &resolved, nil
+}
+
+func (pf *ProfileFile) names() []string {
+	names := make([]string, 0, len(pf.Profiles))
+	for name := range pf.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// useProfile makes the named profile, or the current one, the profile in use.
+func useProfile(name string) error {
+	pf, err := loadProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to load profiles: %w", err)
+	}
+	p, err := pf.resolve(name)
+	if err != nil {
+		return err
+	}
+	if u := serverURLOverride(); u != "" {
+		p.URL = strings.TrimRight(u, "/")
+	}
+	profile = p
+	return nil
+}
+
+// newServerRequest builds a request to path on the active profile's server, carrying its API
+// key.
+func newServerRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, profile.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if profile.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+profile.APIKey)
+	}
+	return req, nil
+}
+
+// maskKey hides all but the last four characters of an API key.
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return strings.Repeat("*", len(key))
+	}
+	return strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+}
+
+// runConfig implements `costs config [view | get <key> | set <key> <value> | use <profile> | delete <profile>]`.
+// get and set act on the --profile profile, else the current one; set creates it if needed.
+func runConfig(args []string, profileName string) int {
+	pf, err := loadProfiles()
+	if err != nil {
+		fmt.Println("Failed to load profiles:", err)
+		return 1
+	}
+	cmd := "view"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	name := profileName
+	if name == "" {
+		name = pf.Current
+	}
+	usage := map[string]string{"get": "get <key>", "set": "set <key> <value>", "use": "use <profile>", "delete": "delete <profile>"}
+	argc := map[string]int{"get": 2, "set": 3, "use": 2, "delete": 2}
+	if n, ok := argc[cmd]; ok && len(args) < n {
+		fmt.Printf("Usage: costs config %s\n", usage[cmd])
+		return 2
+	}
+	if (cmd == "get" || cmd == "set") && !slices.Contains(profileKeys, args[1]) {
+		fmt.Printf("Unknown setting %q; one of %s.\n", args[1], strings.Join(profileKeys, ", "))
+		return 2
+	}
+
+	switch cmd {
+	case "view":
+		path, _ := profilesPath()
+		fmt.Println("#", path)
+		for _, n := range pf.names() {
+			p := pf.Profiles[n]
+			marker := " "
+			if n == pf.Current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, n)
+			fmt.Printf("    url:     %s\n", p.URL)
+			if p.APIKey != "" {
+				fmt.Printf("    api_key: %s\n", maskKey(p.APIKey))
+			}
+			if p.Session != "" {
+				fmt.Printf("    session: %s\n", p.Session)
+			}
+			if p.Format != "" {
+				fmt.Printf("    format:  %s\n", p.Format)
+			}
+		}
+		return 0
+	case "get":
+		p, err := pf.resolve(name)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Println(map[string]string{"url": p.URL, "api_key": p.APIKey, "session": p.Session, "format": p.Format}[args[1]])
+		return 0
+	case "set":
+		key, val := args[1], args[2]
+		if key == "format" && val != "table" && val != "json" {
+			fmt.Println("format must be table or json.")
+			return 2
+		}
+		p := pf.Profiles[name]
+		if p == nil {
+			p = &Profile{}
+			pf.Profiles[name] = p
+		}
+		switch key {
+		case "url":
+			p.URL = val
+		case "api_key":
+			p.APIKey = val
+		case "session":
+			p.Session = val
+		case "format":
+			p.Format = val
+		}
+		fmt.Printf("Set %s for profile %q.\n", key, name)
+	case "use":
+		if pf.Profiles[args[1]] == nil {
+			fmt.Printf("No profile %q; create it with `costs --profile %s config set url <url>`.\n", args[1], args[1])
+			return 1
+		}
+		pf.Current = args[1]
+		fmt.Printf("Switched to profile %q.\n", args[1])
+	case "delete":
+		if pf.Profiles[args[1]] == nil {
+			fmt.Printf("No profile %q.\n", args[1])
+			return 1
+		}
+		delete(pf.Profiles, args[1])
+		if pf.Current == args[1] {
+			pf.Current = ""
+			if len(pf.Profiles) > 0 {
+				pf.Current = pf.names()[0]
+			}
+		}
+		fmt.Printf("Deleted profile %q.\n", args[1])
+	default:
+		fmt.Printf("Unknown config command %q. Usage: costs config [view | get <key> | set <key> <value> | use <profile> | delete <profile>]\n", cmd)
+		return 2
+	}
+	if err := pf.save(); err != nil {
+		fmt.Println("Failed to save profiles:", err)
+		return 1
+	}
+	return 0
+}
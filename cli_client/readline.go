@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ===== Line editing =====
+//
+// lineReader reads prompted lines. On a terminal it edits in raw mode, emacs style:
+//
+//	←/→ Ctrl+B/F  move          Home/End Ctrl+A/E  line start/end
+//	↑/↓ Ctrl+P/N  history       Ctrl+R             reverse history search (Esc/Ctrl+G cancels)
+//	Ctrl+U/K      kill to start/end of line        Ctrl+W  kill previous word
+//	Ctrl+L        clear screen  Ctrl+D  delete, or EOF on an empty line  Ctrl+C  quit
+//	Tab           complete; a second Tab lists the candidates
+//
+// Queries are kept in a history file across runs. When stdin is not a terminal (pipes,
+// scripts) lines are read plainly.
+
+// errInterrupted is returned by readLine when the user presses Ctrl+C.
+var errInterrupted = errors.New("interrupted")
+
+// maxHistory bounds the history file.
+const maxHistory = 1000
+
+type lineReader struct {
+	in       *bufio.Reader
+	fd       int
+	tty      bool
+	history  []string
+	histPath string
+	complete completer // set per prompt; nil disables Tab
+
+	// Rendering state of the line being edited
+	prompt     string
+	buf        []rune
+	pos        int
+	cursorRows int // rows between the first prompt row and the cursor
+}
+
+// historyPath is $MCP_CLI_HISTORY, else "history" next to the config file.
+func historyPath() string {
+	if p := os.Getenv("MCP_CLI_HISTORY"); p != "" {
+		return p
+	}
+	cfg, err := configPath()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(cfg), "history")
+}
+
+func newLineReader() *lineReader {
+	lr := &lineReader{in: bufio.NewReader(os.Stdin), fd: int(os.Stdin.Fd()), histPath: historyPath()}
+	lr.tty = term.IsTerminal(lr.fd) && term.IsTerminal(int(os.Stdout.Fd()))
+	if raw, err := os.ReadFile(lr.histPath); err == nil && lr.histPath != "" {
+		for _, line := range strings.Split(string(raw), "\n") {
+			if line != "" {
+				lr.history = append(lr.history, line)
+			}
+		}
+		if len(lr.history) > maxHistory {
+			lr.history = lr.history[len(lr.history)-maxHistory:]
+			lr.rewriteHistory()
+		}
+	}
+	return lr
+}
+
+// addHistory records line, skipping blanks and immediate repeats, and appends it to the
+// history file.
+func (lr *lineReader) addHistory(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || (len(lr.history) > 0 && lr.history[len(lr.history)-1] == line) {
+		return
+	}
+	lr.history = append(lr.history, line)
+	if len(lr.history) > maxHistory {
+		lr.history = lr.history[len(lr.history)-maxHistory:]
+	}
+	if lr.histPath == "" {
+		return
+	}
+	os.MkdirAll(filepath.Dir(lr.histPath), 0o700)
+	f, err := os.OpenFile(lr.histPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+func (lr *lineReader) rewriteHistory() {
+	os.WriteFile(lr.histPath, []byte(strings.Join(lr.history, "\n")+"\n"), 0o600)
+}
+
+// readLine prints prompt and returns the entered line without its newline. It returns io.EOF
+// at end of input and errInterrupted on Ctrl+C.
+func (lr *lineReader) readLine(prompt string) (string, error) {
+	if !lr.tty {
+		fmt.Print(prompt)
+		line, err := lr.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	old, err := term.MakeRaw(lr.fd)
+	if err != nil {
+		lr.tty = false
+		return lr.readLine(prompt)
+	}
+	defer term.Restore(lr.fd, old)
+
+	lr.prompt, lr.buf, lr.pos, lr.cursorRows = prompt, nil, 0, 0
+	histIdx := len(lr.history)
+	draft := "" // the unsent line while browsing history
+	lr.refresh()
+
+	lastTab := false
+	for {
+		r, _, err := lr.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		tab := r == '\t'
+		switch r {
+		case '\r', '\n':
+			lr.pos = len(lr.buf)
+			lr.refresh()
+			fmt.Print("\r\n")
+			return string(lr.buf), nil
+		case 3: // Ctrl+C
+			fmt.Print("^C\r\n")
+			return "", errInterrupted
+		case 4: // Ctrl+D
+			if len(lr.buf) == 0 {
+				fmt.Print("\r\n")
+				return "", io.EOF
+			}
+			lr.deleteAt(lr.pos)
+		case 127, 8: // Backspace
+			if lr.pos > 0 {
+				lr.pos--
+				lr.deleteAt(lr.pos)
+			}
+		case 1: // Ctrl+A
+			lr.pos = 0
+		case 5: // Ctrl+E
+			lr.pos = len(lr.buf)
+		case 2: // Ctrl+B
+			lr.move(-1)
+		case 6: // Ctrl+F
+			lr.move(1)
+		case 11: // Ctrl+K
+			lr.buf = lr.buf[:lr.pos]
+		case 21: // Ctrl+U
+			lr.buf = append([]rune{}, lr.buf[lr.pos:]...)
+			lr.pos = 0
+		case 23: // Ctrl+W
+			start := lr.pos
+			for start > 0 && unicode.IsSpace(lr.buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(lr.buf[start-1]) {
+				start--
+			}
+			lr.buf = append(lr.buf[:start], lr.buf[lr.pos:]...)
+			lr.pos = start
+		case 12: // Ctrl+L
+			fmt.Print("\x1b[H\x1b[2J")
+			lr.cursorRows = 0
+		case 16: // Ctrl+P
+			histIdx, draft = lr.browse(histIdx, -1, draft)
+		case 14: // Ctrl+N
+			histIdx, draft = lr.browse(histIdx, 1, draft)
+		case '\t':
+			if lr.complete != nil {
+				lr.completeWord(lastTab)
+			}
+		case 18: // Ctrl+R
+			if line, done := lr.search(); done {
+				fmt.Print("\r\n")
+				return line, nil
+			}
+		case 27: // escape sequences
+			switch lr.readEscape() {
+			case "A":
+				histIdx, draft = lr.browse(histIdx, -1, draft)
+			case "B":
+				histIdx, draft = lr.browse(histIdx, 1, draft)
+			case "C":
+				lr.move(1)
+			case "D":
+				lr.move(-1)
+			case "H", "1~", "7~":
+				lr.pos = 0
+			case "F", "4~", "8~":
+				lr.pos = len(lr.buf)
+			case "3~":
+				lr.deleteAt(lr.pos)
+			}
+		default:
+			if unicode.IsPrint(r) {
+				lr.buf = append(lr.buf[:lr.pos], append([]rune{r}, lr.buf[lr.pos:]...)...)
+				lr.pos++
+			}
+		}
+		lastTab = tab
+		lr.refresh()
+	}
+}
+
+// readEscape reads the rest of an ESC [ or ESC O sequence and returns its final part, e.g.
+// "A" for the up arrow or "3~" for Delete. A lone ESC returns "".
+func (lr *lineReader) readEscape() string {
+	if lr.in.Buffered() == 0 {
+		return ""
+	}
+	b, _ := lr.in.ReadByte()
+	if b != '[' && b != 'O' {
+		return ""
+	}
+	var seq []byte
+	for {
+		c, err := lr.in.ReadByte()
+		if err != nil {
+			return ""
+		}
+		seq = append(seq, c)
+		if c >= 0x40 && c <= 0x7e { // final byte
+			return string(seq)
+		}
+	}
+}
+
+func (lr *lineReader) move(d int) {
+	if p := lr.pos + d; p >= 0 && p <= len(lr.buf) {
+		lr.pos = p
+	}
+}
+
+func (lr *lineReader) deleteAt(i int) {
+	if i < len(lr.buf) {
+		lr.buf = append(lr.buf[:i], lr.buf[i+1:]...)
+	}
+}
+
+// completeWord completes the word before the cursor. A single candidate is inserted whole;
+// otherwise the common prefix is, and list prints all candidates below the line.
+func (lr *lineReader) completeWord(list bool) {
+	start := lr.pos
+	for start > 0 && !unicode.IsSpace(lr.buf[start-1]) {
+		start--
+	}
+	cands := lr.complete(string(lr.buf[start:lr.pos]))
+	if len(cands) == 0 {
+		return
+	}
+	insert := commonPrefix(cands)
+	if len(cands) == 1 && !strings.HasSuffix(insert, "=") {
+		insert += " "
+	}
+	if len(cands) > 1 && list {
+		pos := lr.pos
+		lr.pos = len(lr.buf)
+		lr.refresh()
+		fmt.Print("\r\n" + strings.Join(cands, "  ") + "\r\n")
+		lr.pos, lr.cursorRows = pos, 0
+	}
+	lr.buf = append(lr.buf[:start:start], append([]rune(insert), lr.buf[lr.pos:]...)...)
+	lr.pos = start + utf8.RuneCountInString(insert)
+}
+
+// browse moves through history by d, keeping the unsent line as the newest entry.
+func (lr *lineReader) browse(idx, d int, draft string) (int, string) {
+	next := idx + d
+	if next < 0 || next > len(lr.history) {
+		return idx, draft
+	}
+	if idx == len(lr.history) {
+		draft = string(lr.buf)
+	}
+	line := draft
+	if next < len(lr.history) {
+		line = lr.history[next]
+	}
+	lr.buf, lr.pos = []rune(line), utf8.RuneCountInString(line)
+	return next, draft
+}
+
+// search runs an incremental reverse search. Enter returns the match with done set; any
+// other editing key leaves the match in the buffer for further editing.
+func (lr *lineReader) search() (string, bool) {
+	prompt, orig, origPos := lr.prompt, lr.buf, lr.pos
+	defer func() { lr.prompt = prompt }()
+	query := []rune{}
+	matchIdx := len(lr.history)
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if i < len(lr.history) && strings.Contains(lr.history[i], string(query)) {
+				matchIdx = i
+				lr.buf = []rune(lr.history[i])
+				lr.pos = strings.Index(lr.history[i], string(query))
+				lr.pos = utf8.RuneCountInString(lr.history[i][:lr.pos])
+				return
+			}
+		}
+	}
+	for {
+		lr.prompt = fmt.Sprintf("(reverse-i-search)`%s': ", string(query))
+		lr.refresh()
+		r, _, err := lr.in.ReadRune()
+		if err != nil {
+			return "", false
+		}
+		switch {
+		case r == 18: // Ctrl+R again: next older match
+			find(matchIdx - 1)
+		case r == 127 || r == 8:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(lr.history) - 1)
+			}
+		case r == 7 || r == 27: // Ctrl+G, Esc: cancel
+			if r == 27 {
+				lr.readEscape()
+			}
+			lr.buf, lr.pos = orig, origPos
+			return "", false
+		case r == '\r' || r == '\n':
+			lr.prompt = prompt
+			lr.pos = len(lr.buf)
+			lr.refresh()
+			return string(lr.buf), true
+		case unicode.IsPrint(r):
+			query = append(query, r)
+			find(matchIdx)
+		default:
+			return "", false
+		}
+	}
+}
+
+// refresh redraws the prompt and buffer, which may wrap over several rows, and places the
+// cursor.
+func (lr *lineReader) refresh() {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	var b strings.Builder
+	if lr.cursorRows > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", lr.cursorRows)
+	}
+	b.WriteString("\r\x1b[J")
+	b.WriteString(lr.prompt)
+	b.WriteString(string(lr.buf))
+
+	plen := utf8.RuneCountInString(lr.prompt)
+	end := plen + len(lr.buf)
+	if end > 0 && end%width == 0 {
+		b.WriteString("\r\n") // the terminal doesn't wrap until the next character
+	}
+	endRow := end / width
+	cursor := plen + lr.pos
+	row, col := cursor/width, cursor%width
+	if endRow > row {
+		fmt.Fprintf(&b, "\x1b[%dA", endRow-row)
+	}
+	b.WriteString("\r")
+	if col > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", col)
+	}
+	lr.cursorRows = row
+	os.Stdout.WriteString(b.String())
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"costtypes"
+)
+
+// ===== Response decoding =====
+//
+// Responses are decoded into the costtypes records the server encodes, not walked as maps.
+// Decoding is lenient so one odd field doesn't lose the whole answer: costs may be missing,
+// null or numeric strings, each record is decoded on its own, and records that still don't
+// fit are counted and skipped.
+
+// APIResponse is the envelope every endpoint answers with: data and meta on success, error on
+// failure.
+type APIResponse struct {
+	Data    json.RawMessage `json:"data"`
+	Meta    ResponseMeta    `json:"meta"`
+	Error   *APIError       `json:"error"`
+	Summary string          `json:"summary"`
+
+	raw []byte
+}
+
+// ResponseMeta is the subset of meta the CLI prints.
+type ResponseMeta struct {
+	SessionID           string     `json:"session_id"`
+	PreviousQuery       string     `json:"previous_query"`
+	ConversationContext []string   `json:"conversation_context"`
+	Total               optFloat   `json:"total"`
+	RequestID           string     `json:"request_id"`
+	Route               *RouteInfo `json:"route"`
+}
+
+// RouteInfo is meta.route on /query responses.
+type RouteInfo struct {
+	Endpoint   string            `json:"endpoint"`
+	Confidence float64           `json:"confidence"`
+	Extracted  map[string]string `json:"extracted_filters"`
+}
+
+// APIError is the server's error envelope.
+type APIError struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details"`
+	RequestID string       `json:"request_id"`
+}
+
+// FieldError is one entry of a validation error's details.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("error [%s]: %s (request_id: %s)", e.Code, e.Message, e.RequestID)
+}
+
+// optFloat is a number that may be absent. It accepts JSON numbers, numeric strings and
+// null; anything else leaves it unset rather than failing the decode.
+type optFloat struct {
+	Value float64
+	Set   bool
+}
+
+func (f *optFloat) UnmarshalJSON(b []byte) error {
+	*f = optFloat{}
+	if string(b) == "null" {
+		return nil
+	}
+	var n float64
+	if err := json.Unmarshal(b, &n); err == nil {
+		*f = optFloat{Value: n, Set: true}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			*f = optFloat{Value: n, Set: true}
+		}
+	}
+	return nil
+}
+
+// value is the number as a table cell: nil when unset.
+func (f optFloat) value() interface{} {
+	if !f.Set {
+		return nil
+	}
+	return f.Value
+}
+
+func (f optFloat) String() string {
+	if !f.Set {
+		return "-"
+	}
+	return strconv.FormatFloat(f.Value, 'f', -1, 64)
+}
+
+// tableRecord is a typed record the table printer reads by column key. field returns nil for
+// missing values.
+type tableRecord interface {
+	field(key string) interface{}
+}
+
+// present is the set of fields a record actually carried, so a missing cost prints blank
+// instead of 0.
+type present map[string]bool
+
+// cost returns v as a table cell, or nil if key wasn't in the record.
+func (p present) cost(key string, v float64) interface{} {
+	if !p[key] {
+		return nil
+	}
+	return v
+}
+
+// decodeRecord decodes item into v, one of the costtypes records, leniently: null fields are
+// dropped, and numeric fields (listed in numeric) may be numeric strings; ones that aren't
+// numbers at all are dropped too. It returns the fields that were kept.
+func decodeRecord(item json.RawMessage, v interface{}, numeric ...string) (present, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(item, &fields); err != nil {
+		return nil, err
+	}
+	for _, key := range numeric {
+		raw, ok := fields[key]
+		if !ok {
+			continue
+		}
+		var f optFloat
+		f.UnmarshalJSON(raw)
+		if !f.Set {
+			delete(fields, key)
+			continue
+		}
+		fields[key] = json.RawMessage(strconv.FormatFloat(f.Value, 'g', -1, 64))
+	}
+	seen := present{}
+	for key, raw := range fields {
+		if string(raw) == "null" {
+			delete(fields, key)
+			continue
+		}
+		seen[key] = true
+	}
+	normalized, _ := json.Marshal(fields)
+	return seen, json.Unmarshal(normalized, v)
+}
+
+// AllocationRecord is an /allocations record. Time-series responses (resolution=day) decode
+// to the namespace and total only.
+type AllocationRecord struct {
+	costtypes.Allocation
+	present present
+}
+
+func (a AllocationRecord) field(key string) interface{} {
+	switch key {
+	case "namespace":
+		return a.Namespace
+	case "resource_id":
+		return a.ResourceID
+	case "cpu_cost":
+		return a.present.cost(key, a.CPUCost)
+	case "memory_cost":
+		return a.present.cost(key, a.MemoryCost)
+	case "gpu_cost":
+		return a.present.cost(key, a.GPUCost)
+	case "network_cost":
+		return a.present.cost(key, a.NetworkCost)
+	case "pv_cost":
+		return a.present.cost(key, a.PVCost)
+	case "total_cost":
+		return a.present.cost(key, a.TotalCost)
+	case "start_time":
+		return a.StartTime
+	case "end_time":
+		return a.EndTime
+	}
+	return nil
+}
+
+// CloudCostRecord is a /cloudCosts record.
+type CloudCostRecord struct {
+	costtypes.CloudCost
+	present present
+}
+
+func (c CloudCostRecord) field(key string) interface{} {
+	switch key {
+	case "name":
+		return c.Name
+	case "cpuCost":
+		return c.present.cost(key, c.CPUCost)
+	case "gpuCost":
+		return c.present.cost(key, c.GPUCost)
+	case "totalCost":
+		return c.present.cost(key, c.TotalCost)
+	}
+	return nil
+}
+
+// AssetRecord is an /assets record.
+type AssetRecord struct {
+	costtypes.Asset
+	present present
+}
+
+func (a AssetRecord) field(key string) interface{} {
+	switch key {
+	case "asset_id":
+		return a.AssetID
+	case "name":
+		return a.Name
+	case "type":
+		return a.Type
+	case "status":
+		return a.Status
+	case "provider":
+		return a.Provider
+	case "region":
+		return a.Region
+	case "pricing_model":
+		return a.PricingModel
+	case "cost":
+		return a.present.cost(key, a.Cost)
+	}
+	return nil
+}
+
+// decodeResponse parses a response body. Only a body that isn't a JSON object is an error.
+func decodeResponse(body []byte) (*APIResponse, error) {
+	resp := &APIResponse{raw: body}
+	if err := json.Unmarshal(body, resp); err != nil {
+		// Retry without meta so a meta field of an unexpected type doesn't hide the data
+		var bare struct {
+			Data    json.RawMessage `json:"data"`
+			Error   *APIError       `json:"error"`
+			Summary string          `json:"summary"`
+		}
+		if err := json.Unmarshal(body, &bare); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		resp = &APIResponse{Data: bare.Data, Error: bare.Error, Summary: bare.Summary, raw: body}
+	}
+	return resp, nil
+}
+
+// endpointFor is the endpoint whose records the response holds: the routed one for /query.
+func (r *APIResponse) endpointFor(endpoint string) string {
+	if r.Meta.Route != nil && r.Meta.Route.Endpoint != "" {
+		return r.Meta.Route.Endpoint
+	}
+	return endpoint
+}
+
+// records decodes data as endpoint's record type, returning how many records were skipped.
+func (r *APIResponse) records(endpoint string) ([]tableRecord, int) {
+	var items []json.RawMessage
+	if len(r.Data) == 0 || json.Unmarshal(r.Data, &items) != nil {
+		return nil, 0
+	}
+	var out []tableRecord
+	skipped := 0
+	for _, item := range items {
+		var rec tableRecord
+		var err error
+		switch endpoint {
+		case "allocations":
+			var a AllocationRecord
+			a.present, err = decodeRecord(item, &a.Allocation, "cpu_cost", "memory_cost", "gpu_cost", "network_cost", "pv_cost", "total_cost", "cpu_core_hours", "ram_gb_hours", "gpu_hours")
+			rec = a
+		case "cloudCosts":
+			var c CloudCostRecord
+			c.present, err = decodeRecord(item, &c.CloudCost, "cpuCost", "gpuCost", "totalCost")
+			rec = c
+		case "assets":
+			var a AssetRecord
+			a.present, err = decodeRecord(item, &a.Asset, "cost")
+			rec = a
+		default:
+			return nil, len(items)
+		}
+		if err != nil {
+			skipped++
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out, skipped
+}
+
+// asMap returns the response as generic JSON, for exports and the json format.
+func (r *APIResponse) asMap() map[string]interface{} {
+	var m map[string]interface{}
+	json.Unmarshal(r.raw, &m)
+	return m
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadFixture(t *testing.T, name string) *APIResponse {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := decodeResponse(body)
+	if err != nil {
+		t.Fatalf("decodeResponse(%s): %v", name, err)
+	}
+	return resp
+}
+
+func TestDecodeResponseRecords(t *testing.T) {
+	tests := []struct {
+		fixture, endpoint string
+		want              int
+		key               string
+		first             interface{}
+	}{
+		{"allocations.json", "allocations", 3, "total_cost", 5.7},
+		{"cloudcosts.json", "cloudCosts", 2, "totalCost", 15.5},
+		{"assets.json", "assets", 3, "cost", 120.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			resp := loadFixture(t, tt.fixture)
+			if resp.Error != nil {
+				t.Fatalf("unexpected error: %v", resp.Error)
+			}
+			records, skipped := resp.records(tt.endpoint)
+			if len(records) != tt.want || skipped != 0 {
+				t.Fatalf("got %d records, %d skipped; want %d, 0", len(records), skipped, tt.want)
+			}
+			if got := records[0].field(tt.key); got != tt.first {
+				t.Errorf("first %s = %v, want %v", tt.key, got, tt.first)
+			}
+			if got := resp.Meta.Total; !got.Set || int(got.Value) != tt.want {
+				t.Errorf("meta.total = %v, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeResponseMessyRecords(t *testing.T) {
+	resp := loadFixture(t, "allocations_messy.json")
+	records, skipped := resp.records("allocations")
+	if len(records) != 2 || skipped != 2 {
+		t.Fatalf("got %d records, %d skipped; want 2, 2", len(records), skipped)
+	}
+	prod := records[0]
+	if got := prod.field("memory_cost"); got != 2.5 {
+		t.Errorf("numeric string memory_cost = %v, want 2.5", got)
+	}
+	if got := prod.field("gpu_cost"); got != nil {
+		t.Errorf("null gpu_cost = %v, want nil", got)
+	}
+	if got := records[1].field("cpu_cost"); got != nil {
+		t.Errorf("missing cpu_cost = %v, want nil", got)
+	}
+
+	// A meta field of the wrong type drops meta but keeps the data
+	if resp.Meta.SessionID != "" {
+		t.Errorf("meta should be dropped, got session %q", resp.Meta.SessionID)
+	}
+
+	var out bytes.Buffer
+	if err := printTable(&out, endpointColumns["allocations"], records, sortSpec{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("want header, rule, 2 rows, rule, total; got:\n%s", out.String())
+	}
+	if got := strings.Fields(lines[3]); len(got) != 3 || got[2] != "4.00" {
+		t.Errorf("dev row should have blank cost cells, got %q", lines[3])
+	}
+	if got := strings.Fields(lines[5]); got[len(got)-1] != "16.50" {
+		t.Errorf("total row = %q, want total 16.50", lines[5])
+	}
+}
+
+func TestDecodeResponseError(t *testing.T) {
+	resp := loadFixture(t, "error_validation.json")
+	if resp.Error == nil {
+		t.Fatal("want error envelope")
+	}
+	if resp.Error.Code != "invalid_filters" || len(resp.Error.Details) != 1 || resp.Error.Details[0].Field != "provider" {
+		t.Errorf("unexpected error %+v", resp.Error)
+	}
+	if records, _ := resp.records("assets"); len(records) != 0 {
+		t.Errorf("error response has %d records", len(records))
+	}
+}
+
+func TestDecodeResponseRouted(t *testing.T) {
+	resp := loadFixture(t, "query_routed.json")
+	if got := resp.endpointFor("query"); got != "assets" {
+		t.Fatalf("endpointFor(query) = %q, want assets", got)
+	}
+	if got := resp.Meta.Route.Extracted["region"]; got != "us-west-2" {
+		t.Errorf("extracted region = %q", got)
+	}
+	records, _ := resp.records(resp.endpointFor("query"))
+	if len(records) != 1 || records[0].field("provider") != "AWS" {
+		t.Errorf("unexpected routed records %+v", records)
+	}
+}
+
+func TestDecodeResponseInvalid(t *testing.T) {
+	for _, body := range []string{"", "not json", `["an", "array"]`} {
+		if _, err := decodeResponse([]byte(body)); err == nil {
+			t.Errorf("decodeResponse(%q) succeeded", body)
+		}
+	}
+}
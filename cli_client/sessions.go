@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CLISession is a named conversation. ID is the session_id sent to the server; resetting a
+// session gives it a fresh ID, so the server starts a new conversation context.
+type CLISession struct {
+	Name      string    `json:"name"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	LastUsed  time.Time `json:"last_used"` // zero until the session is first used
+}
+
+// Config is the CLI's local state, kept in configPath().
+type Config struct {
+	Current  string                 `json:"current_session"`
+	Sessions map[string]*CLISession `json:"sessions"`
+}
+
+const defaultSessionName = "default"
+
+// configPath is $MCP_CLI_CONFIG, else costs/config.json under the user config directory.
+func configPath() (string, error) {
+	if p := os.Getenv("MCP_CLI_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("no config directory: %w (set MCP_CLI_CONFIG)", err)
+	}
+	return filepath.Join(dir, "costs", "config.json"), nil
+}
+
+// loadConfig reads the config, creating and saving the default session on first use.
+func loadConfig() (*Config, error) {
+	cfg := &Config{Sessions: map[string]*CLISession{}}
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(raw, cfg); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+		if cfg.Sessions == nil {
+			cfg.Sessions = map[string]*CLISession{}
+		}
+	}
+	if len(cfg.Sessions) == 0 {
+		// Persist right away so the default session keeps its ID across runs
+		cfg.add(defaultSessionName)
+		if err := cfg.save(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Sessions[cfg.Current] == nil {
+		cfg.Current = cfg.names()[0]
+	}
+	return cfg, nil
+}
+
+// save writes the config via a temp file and rename.
+func (c *Config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (c *Config) add(name string) *CLISession {
+	s := &CLISession{Name: name, ID: newSessionID(name), CreatedAt: time.Now().UTC()}
+	c.Sessions[name] = s
+	if c.Current == "" {
+		c.Current = name
+	}
+	return s
+}
+
+func (c *Config) names() []string {
+	names := make([]string, 0, len(c.Sessions))
+	for name := range c.Sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newSessionID returns a server session ID for a named session.
+func newSessionID(name string) string {
+	return "cli-" + name + "-" + strings.TrimPrefix(newRequestID(), "cli-")[:8]
+}
+
+// validSessionName keeps names usable in session IDs and on the command line.
+func validSessionName(name string) bool {
+	if name == "" || len(name) > 40 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// runSession implements `costs session [list | new <name> | use <name> | fork <name> [from] |
+// reset [name] | delete <name>]`.
+func runSession(args []string) int {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Println("Failed to load config:", err)
+		return 1
+	}
+	cmd := "list"
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	name := cfg.Current
+	if len(args) > 1 {
+		name = args[1]
+	}
+	needsName := map[string]bool{"new": true, "use": true, "fork": true, "delete": true}
+	if needsName[cmd] && len(args) < 2 {
+		fmt.Printf("Usage: costs session %s <name>\n", cmd)
+		return 2
+	}
+
+	switch cmd {
+	case "list":
+		for _, n := range cfg.names() {
+			s := cfg.Sessions[n]
+			marker := " "
+			if n == cfg.Current {
+				marker = "*"
+			}
+			used := "never used"
+			if !s.LastUsed.IsZero() {
+				used = "last used " + s.LastUsed.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%s %-20s %-32s %s\n", marker, n, s.ID, used)
+		}
+		return 0
+	case "new":
+		if !validSessionName(name) {
+			fmt.Println("Session names may only contain letters, digits, '-' and '_' (max 40).")
+			return 2
+		}
+		if cfg.Sessions[name] != nil {
+			fmt.Printf("Session %q already exists; use `costs session use %s`.\n", name, name)
+			return 1
+		}
+		cfg.add(name)
+		cfg.Current = name
+		fmt.Printf("Created session %q and switched to it.\n", name)
+	case "use":
+		if cfg.Sessions[name] == nil {
+			fmt.Printf("No session %q; create it with `costs session new %s`.\n", name, name)
+			return 1
+		}
+		cfg.Current = name
+		fmt.Printf("Switched to session %q.\n", name)
+	case "fork":
+		from := cfg.Current
+		if len(args) > 2 {
+			from = args[2]
+		}
+		if code := forkSession(cfg, from, name); code != 0 {
+			return code
+		}
+	case "reset":
+		s := cfg.Sessions[name]
+		if s == nil {
+			fmt.Printf("No session %q.\n", name)
+			return 1
+		}
+		s.ID = newSessionID(name)
+		fmt.Printf("Reset session %q; the server will start a fresh conversation context.\n", name)
+	case "delete":
+		if cfg.Sessions[name] == nil {
+			fmt.Printf("No session %q.\n", name)
+			return 1
+		}
+		delete(cfg.Sessions, name)
+		if cfg.Current == name {
+			cfg.Current = ""
+			if len(cfg.Sessions) > 0 {
+				cfg.Current = cfg.names()[0]
+			}
+		}
+		fmt.Printf("Deleted session %q.\n", name)
+	default:
+		fmt.Printf("Unknown session command %q. Usage: costs session [list | new <name> | use <name> | fork <name> [from] | reset [name] | delete <name>]\n", cmd)
+		return 2
+	}
+	if err := cfg.save(); err != nil {
+		fmt.Println("Failed to save config:", err)
+		return 1
+	}
+	return 0
+}
+
+// forkSession creates session name as a server-side copy of session from, and switches to it.
+func forkSession(cfg *Config, from, name string) int {
+	src := cfg.Sessions[from]
+	switch {
+	case src == nil:
+		fmt.Printf("No session %q.\n", from)
+		return 1
+	case !validSessionName(name):
+		fmt.Println("Session names may only contain letters, digits, '-' and '_' (max 40).")
+		return 2
+	case cfg.Sessions[name] != nil:
+		fmt.Printf("Session %q already exists.\n", name)
+		return 1
+	}
+	id := newSessionID(name)
+	req, err := newServerRequest(http.MethodPost, "/sessions/"+url.PathEscape(src.ID)+"/fork?to="+url.QueryEscape(id), nil)
+	if err != nil {
+		fmt.Println("Failed to fork session:", err)
+		return 1
+	}
+	resp, err := (&http.Client{Timeout: 15 * time.Second}).Do(req)
+	if err != nil {
+		fmt.Println("Failed to fork session:", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Data struct {
+			Queries   int `json:"queries"`
+			Snapshots int `json:"snapshots"`
+		} `json:"data"`
+	}
+	switch resp.StatusCode {
+	case http.StatusCreated:
+		json.NewDecoder(resp.Body).Decode(&body)
+	case http.StatusNotFound:
+		// Nothing asked in from yet: the fork starts as empty as from is
+	default:
+		fmt.Println("Failed to fork session:", resp.Status)
+		return 1
+	}
+	s := cfg.add(name)
+	s.ID = id
+	cfg.Current = name
+	fmt.Printf("Forked session %q into %q (%d queries, %d snapshots) and switched to it.\n", from, name, body.Data.Queries, body.Data.Snapshots)
+	return 0
+}
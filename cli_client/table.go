@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ===== Table output =====
+//
+// Records are printed as a table sized to their contents: numeric columns are right-aligned
+// and summed in a TOTAL row, and on a terminal the widest text columns are cut short (with
+// "…") so rows don't wrap. --sort-by <column>[:asc|:desc] orders the rows; numeric columns
+// sort descending and text columns ascending unless told otherwise.
+
+// column is one table column, read from the record field key.
+type column struct {
+	title   string
+	key     string
+	numeric bool
+}
+
+// endpointColumns are the columns printed for each endpoint's records.
+var endpointColumns = map[string][]column{
+	"allocations": {
+		{title: "Namespace", key: "namespace"},
+		{title: "ResID", key: "resource_id"},
+		{title: "CPU", key: "cpu_cost", numeric: true},
+		{title: "Memory", key: "memory_cost", numeric: true},
+		{title: "GPU", key: "gpu_cost", numeric: true},
+		{title: "Network", key: "network_cost", numeric: true},
+		{title: "PV", key: "pv_cost", numeric: true},
+		{title: "Total", key: "total_cost", numeric: true},
+	},
+	"cloudCosts": {
+		{title: "Name", key: "name"},
+		{title: "CPU", key: "cpuCost", numeric: true},
+		{title: "GPU", key: "gpuCost", numeric: true},
+		{title: "Total", key: "totalCost", numeric: true},
+	},
+	"assets": {
+		{title: "Provider", key: "provider"},
+		{title: "Region", key: "region"},
+		{title: "Name", key: "name"},
+		{title: "Type", key: "type"},
+		{title: "Status", key: "status"},
+		{title: "Pricing", key: "pricing_model"},
+		{title: "Cost", key: "cost", numeric: true},
+	},
+}
+
+// minColumnWidth is the narrowest a text column is cut to when fitting the terminal.
+const minColumnWidth = 6
+
+// sortSpec is a parsed --sort-by value.
+type sortSpec struct {
+	column string
+	order  string // "asc", "desc" or "" for the column's default
+}
+
+func parseSortSpec(v string) (sortSpec, error) {
+	col, order, _ := strings.Cut(v, ":")
+	if order != "" && order != "asc" && order != "desc" {
+		return sortSpec{}, fmt.Errorf("sort order must be asc or desc, not %q", order)
+	}
+	return sortSpec{column: col, order: order}, nil
+}
+
+// splitSortFlag removes a --sort-by=<column>[:order] token from a query line, so one request
+// can be sorted differently from the rest.
+func splitSortFlag(line string) (string, string) {
+	var rest []string
+	sortBy := ""
+	for _, tok := range strings.Fields(line) {
+		if v, ok := strings.CutPrefix(tok, "--sort-by="); ok {
+			sortBy = v
+			continue
+		}
+		rest = append(rest, tok)
+	}
+	return strings.Join(rest, " "), sortBy
+}
+
+// findColumn matches a --sort-by name against column titles and field keys, ignoring case.
+func findColumn(cols []column, name string) (int, bool) {
+	for i, c := range cols {
+		if strings.EqualFold(c.title, name) || strings.EqualFold(c.key, name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// printTable writes records under cols to w, sorted by spec when it names a column. style, if
+// set, returns an ANSI prefix for a record's row. Missing values print as blank cells.
+func printTable(w io.Writer, cols []column, records []tableRecord, spec sortSpec, style func(tableRecord) string) error {
+	if spec.column != "" {
+		i, ok := findColumn(cols, spec.column)
+		if !ok {
+			names := make([]string, len(cols))
+			for j, c := range cols {
+				names[j] = strings.ToLower(c.title)
+			}
+			return fmt.Errorf("no column %q to sort by; one of %s", spec.column, strings.Join(names, ", "))
+		}
+		sortRecords(records, cols[i], spec.order)
+	}
+
+	// Format cells and sum numeric columns
+	cells := make([][]string, len(records))
+	totals := make([]float64, len(cols))
+	for r, rec := range records {
+		cells[r] = make([]string, len(cols))
+		for c, col := range cols {
+			if col.numeric {
+				if f, ok := rec.field(col.key).(float64); ok {
+					cells[r][c] = fmt.Sprintf("%.2f", f)
+					totals[c] += f
+				}
+				continue
+			}
+			if v := rec.field(col.key); v != nil {
+				cells[r][c] = fmt.Sprint(v)
+			}
+		}
+	}
+	totalRow := make([]string, len(cols))
+	hasTotals := false
+	for c, col := range cols {
+		if col.numeric {
+			totalRow[c] = fmt.Sprintf("%.2f", totals[c])
+			hasTotals = true
+		}
+	}
+	if hasTotals && !cols[0].numeric {
+		totalRow[0] = "TOTAL"
+	}
+
+	widths := make([]int, len(cols))
+	for c, col := range cols {
+		widths[c] = utf8.RuneCountInString(col.title)
+		for _, row := range append(cells, totalRow) {
+			widths[c] = max(widths[c], utf8.RuneCountInString(row[c]))
+		}
+	}
+	fitWidths(cols, widths, terminalWidth())
+
+	lineWidth := len(cols) - 1
+	for _, w := range widths {
+		lineWidth += w
+	}
+	printRow := func(row []string, prefix string) {
+		out := make([]string, len(cols))
+		for c, col := range cols {
+			out[c] = pad(truncate(row[c], widths[c]), widths[c], col.numeric)
+		}
+		line := strings.TrimRight(strings.Join(out, " "), " ")
+		if prefix != "" {
+			line = prefix + line + styleReset
+		}
+		fmt.Fprintln(w, line)
+	}
+
+	titles := make([]string, len(cols))
+	for c, col := range cols {
+		titles[c] = col.title
+	}
+	printRow(titles, "")
+	fmt.Fprintln(w, strings.Repeat("-", lineWidth))
+	for r, row := range cells {
+		prefix := ""
+		if style != nil {
+			prefix = style(records[r])
+		}
+		printRow(row, prefix)
+	}
+	if hasTotals {
+		fmt.Fprintln(w, strings.Repeat("-", lineWidth))
+		printRow(totalRow, "")
+	}
+	return nil
+}
+
+// sortRecords orders records by col; order "" picks descending for numbers.
+func sortRecords(records []tableRecord, col column, order string) {
+	desc := order == "desc" || (order == "" && col.numeric)
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if desc {
+			a, b = b, a
+		}
+		if col.numeric {
+			x, _ := a.field(col.key).(float64)
+			y, _ := b.field(col.key).(float64)
+			return x < y
+		}
+		return strings.ToLower(fmt.Sprint(a.field(col.key))) < strings.ToLower(fmt.Sprint(b.field(col.key)))
+	})
+}
+
+// terminalWidth is stdout's width, or 0 when it isn't a terminal.
+func terminalWidth() int {
+	w, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return w
+}
+
+// fitWidths narrows the widest text columns until the row fits in limit. Numeric columns
+// keep their width; limit 0 means no limit.
+func fitWidths(cols []column, widths []int, limit int) {
+	if limit <= 0 {
+		return
+	}
+	total := len(cols) - 1
+	for _, w := range widths {
+		total += w
+	}
+	for total > limit {
+		widest := -1
+		for c, col := range cols {
+			if !col.numeric && widths[c] > minColumnWidth && (widest < 0 || widths[c] > widths[widest]) {
+				widest = c
+			}
+		}
+		if widest < 0 {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
+
+func pad(s string, width int, right bool) string {
+	gap := strings.Repeat(" ", width-utf8.RuneCountInString(s))
+	if right {
+		return gap + s
+	}
+	return s + gap
+}
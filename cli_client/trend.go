@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"costtypes"
+)
+
+// ===== Cost trends =====
+//
+// `costs trend` asks /allocations for a day (or hour) series and charts it in the terminal:
+// bars of the total per bucket, or with --chart spark one sparkline per namespace.
+
+// sparkBlocks are the eight heights of a sparkline cell; barBlocks fill a bar cell in eighths.
+var (
+	sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+	barBlocks   = []rune(" ▏▎▍▌▋▊▉█")
+)
+
+// runTrend implements `costs trend [--window 7d] [--namespace ns] [--resolution day|hour]
+// [--timezone tz] [--chart bars|spark]`.
+func runTrend(args []string) int {
+	fs := flag.NewFlagSet("trend", flag.ContinueOnError)
+	window := fs.String("window", "7d", "time window, e.g. 7d, lastweek, month")
+	namespace := fs.String("namespace", "", "namespace filter (lists, !exclusions and /regexes/ work)")
+	resolution := fs.String("resolution", "day", "bucket size: day or hour")
+	timezone := fs.String("timezone", "", "IANA zone for day buckets, e.g. Europe/Berlin")
+	chart := fs.String("chart", "bars", "bars (total per bucket) or spark (one line per namespace)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *chart != "bars" && *chart != "spark" {
+		fmt.Println("--chart must be bars or spark")
+		return 2
+	}
+
+	aq := AgenticQuery{Filters: Filters{
+		Namespace:  *namespace,
+		Window:     *window,
+		Timezone:   *timezone,
+		Resolution: *resolution,
+	}}
+	series, err := fetchSeries(aq)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if len(series) == 0 || len(series[0].Points) == 0 {
+		fmt.Println("No allocations in this window.")
+		return 0
+	}
+
+	fmt.Printf("Cost per %s, window %s", *resolution, *window)
+	if *namespace != "" {
+		fmt.Printf(", namespace %s", *namespace)
+	}
+	fmt.Print("\n\n")
+	if *chart == "spark" {
+		printSparklines(series)
+	} else {
+		printBars(series, *resolution)
+	}
+	return 0
+}
+
+// fetchSeries posts aq to /allocations and decodes the per-namespace series.
+func fetchSeries(aq AgenticQuery) ([]costtypes.NamespaceSeries, error) {
+	payload, _ := json.Marshal(aq)
+	req, err := newServerRequest(http.MethodPost, "/allocations", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", newRequestID())
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	result, err := decodeResponse(body)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	var series []costtypes.NamespaceSeries
+	if len(result.Data) > 0 {
+		if err := json.Unmarshal(result.Data, &series); err != nil {
+			return nil, fmt.Errorf("unexpected time series: %w", err)
+		}
+	}
+	return series, nil
+}
+
+// printBars draws one horizontal bar per bucket for the total over all namespaces.
+func printBars(series []costtypes.NamespaceSeries, resolution string) {
+	buckets := series[0].Points
+	totals := make([]float64, len(buckets))
+	for _, s := range series {
+		for i, p := range s.Points {
+			if i < len(totals) {
+				totals[i] += p.TotalCost
+			}
+		}
+	}
+	peak := 0.0
+	for _, t := range totals {
+		peak = math.Max(peak, t)
+	}
+
+	layout := "2006-01-02"
+	if resolution == "hour" {
+		layout = "2006-01-02 15:00"
+	}
+	labels := make([]string, len(buckets))
+	for i, p := range buckets {
+		labels[i] = p.Start
+		if t, err := time.Parse(time.RFC3339, p.Start); err == nil {
+			labels[i] = t.Format(layout)
+		}
+	}
+
+	width := terminalWidth()
+	if width <= 0 {
+		width = 80
+	}
+	barWidth := max(width-len(labels[0])-14, 10)
+	for i, t := range totals {
+		fmt.Printf("%s │%s %10.2f\n", labels[i], pad(bar(t, peak, barWidth), barWidth, false), t)
+	}
+	sum := 0.0
+	for _, t := range totals {
+		sum += t
+	}
+	fmt.Printf("\nTotal %.2f, peak %.2f, average %.2f per %s\n", sum, peak, sum/float64(len(totals)), resolution)
+}
+
+// bar renders v against peak as a run of full blocks and one partial block, width cells wide
+// at peak.
+func bar(v, peak float64, width int) string {
+	if peak <= 0 || v <= 0 {
+		return ""
+	}
+	eighths := int(math.Round(v / peak * float64(width*8)))
+	s := strings.Repeat(string(barBlocks[8]), eighths/8)
+	if eighths%8 > 0 {
+		s += string(barBlocks[eighths%8])
+	}
+	return s
+}
+
+// printSparklines draws one sparkline per namespace, costliest first, each scaled to its own
+// peak.
+func printSparklines(series []costtypes.NamespaceSeries) {
+	sort.SliceStable(series, func(i, j int) bool { return series[i].TotalCost > series[j].TotalCost })
+	nameWidth := len("Namespace")
+	for _, s := range series {
+		nameWidth = max(nameWidth, len(s.Namespace))
+	}
+	for _, s := range series {
+		peak := 0.0
+		for _, p := range s.Points {
+			peak = math.Max(peak, p.TotalCost)
+		}
+		var line strings.Builder
+		for _, p := range s.Points {
+			i := 0
+			if peak > 0 {
+				i = int(math.Round(p.TotalCost / peak * float64(len(sparkBlocks)-1)))
+			}
+			line.WriteRune(sparkBlocks[i])
+		}
+		fmt.Printf("%-*s %s  total %.2f, peak %.2f\n", nameWidth, s.Namespace, line.String(), s.TotalCost, peak)
+	}
+}
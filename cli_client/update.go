@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is stamped at build time: go build -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// defaultReleaseURL returns the latest GitHub release; override with MCP_CLI_RELEASE_URL.
+const defaultReleaseURL = "https://api.github.com/repos/ak4shravikumar/open-cost-challenge/releases/latest"
+
+// Release is the subset of the GitHub release schema used for update checks.
+type Release struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+	Assets  []struct {
+		Name        string `json:"name"`
+		DownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetName is the release artifact for this platform, matching `make cli-release`.
+func assetName() string {
+	name := fmt.Sprintf("costs-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// assetURL returns the download URL of the named asset, or "" if the release lacks it.
+func (r Release) assetURL(name string) string {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.DownloadURL
+		}
+	}
+	return ""
+}
+
+func releaseURL() string {
+	if u := os.Getenv("MCP_CLI_RELEASE_URL"); u != "" {
+		return u
+	}
+	return defaultReleaseURL
+}
+
+// fetchLatestRelease queries the release endpoint.
+func fetchLatestRelease() (Release, error) {
+	var rel Release
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(releaseURL())
+	if err != nil {
+		return rel, fmt.Errorf("failed to reach release endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rel, fmt.Errorf("release endpoint returned %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&rel); err != nil {
+		return rel, fmt.Errorf("invalid release response: %w", err)
+	}
+	return rel, nil
+}
+
+// parseVersion turns "v1.2.3" (or "1.2") into comparable numeric parts.
+// Pre-release suffixes ("-rc1") are ignored.
+func parseVersion(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := []int{}
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// isNewer reports whether latest is a higher version than current. Unparseable versions
+// (including "dev" builds) are never considered outdated.
+func isNewer(latest, current string) bool {
+	l, c := parseVersion(latest), parseVersion(current)
+	if l == nil || c == nil {
+		return false
+	}
+	for i := 0; i < len(l) || i < len(c); i++ {
+		var a, b int
+		if i < len(l) {
+			a = l[i]
+		}
+		if i < len(c) {
+			b = c[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+// runVersion implements `costs version [--check]`.
+func runVersion(args []string) int {
+	fmt.Printf("costs %s (%s/%s)\n", version, runtime.GOOS, runtime.GOARCH)
+	if len(args) == 0 || args[0] != "--check" {
+		return 0
+	}
+	rel, err := fetchLatestRelease()
+	if err != nil {
+		fmt.Println("Update check failed:", err)
+		return 1
+	}
+	switch {
+	case isNewer(rel.TagName, version):
+		fmt.Printf("A newer version is available: %s (run `costs self-update`)\n", rel.TagName)
+	case parseVersion(version) == nil:
+		fmt.Printf("Latest release is %s; this is a development build.\n", rel.TagName)
+	default:
+		fmt.Println("You are running the latest version.")
+	}
+	return 0
+}
+
+// runSelfUpdate implements `costs self-update`: it downloads the release artifact for this
+// platform next to the running binary, verifies it against the release's checksums.txt, and
+// swaps it in with renames so a failed download never leaves a broken binary. A release
+// without a checksum for the artifact is refused.
+func runSelfUpdate(args []string) int {
+	force := len(args) > 0 && args[0] == "--force"
+	rel, err := fetchLatestRelease()
+	if err != nil {
+		fmt.Println("Update check failed:", err)
+		return 1
+	}
+	if !force && !isNewer(rel.TagName, version) {
+		fmt.Printf("Already up to date (%s). Use --force to reinstall %s.\n", version, rel.TagName)
+		return 0
+	}
+	url := rel.assetURL(assetName())
+	if url == "" {
+		fmt.Printf("Release %s has no build for %s/%s.\n", rel.TagName, runtime.GOOS, runtime.GOARCH)
+		return 1
+	}
+	want, err := releaseChecksum(rel, assetName())
+	if err != nil {
+		fmt.Println("Checksum verification failed:", err)
+		return 1
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Println("Cannot locate running binary:", err)
+		return 1
+	}
+
+	fmt.Printf("Downloading %s %s...\n", assetName(), rel.TagName)
+	tmp, sum, err := downloadTo(filepath.Dir(exe), url)
+	if err != nil {
+		fmt.Println("Download failed:", err)
+		return 1
+	}
+	defer os.Remove(tmp) // no-op once renamed into place
+
+	if want != sum {
+		fmt.Printf("Checksum mismatch: expected %s, got %s\n", want, sum)
+		return 1
+	}
+
+	if err := replaceBinary(exe, tmp); err != nil {
+		fmt.Println("Failed to install update:", err)
+		return 1
+	}
+	fmt.Printf("Updated costs %s → %s\n", version, rel.TagName)
+	return 0
+}
+
+// downloadTo saves url into a temp file in dir and returns its path and SHA-256.
+func downloadTo(dir, url string) (string, string, error) {
+	client := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("download returned %d", resp.StatusCode)
+	}
+
+	f, err := os.CreateTemp(dir, ".costs-update-*")
+	if err != nil {
+		return "", "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o755)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	return f.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// releaseChecksum returns the SHA-256 the release's checksums.txt lists for the named asset.
+// `make cli-release` always publishes it, so a release without one is an error.
+func releaseChecksum(rel Release, name string) (string, error) {
+	sumsURL := rel.assetURL("checksums.txt")
+	if sumsURL == "" {
+		return "", fmt.Errorf("release %s publishes no checksums.txt", rel.TagName)
+	}
+	return expectedChecksum(sumsURL, name)
+}
+
+// expectedChecksum looks up name in a sha256sum-style checksums file.
+func expectedChecksum(url, name string) (string, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("checksums download returned %d", resp.StatusCode)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum listed for %s", name)
+}
+
+// replaceBinary moves the running binary aside, renames the new one into place and restores
+// the old one if that fails. Windows cannot delete a running executable, so the backup is
+// left behind there and cleaned up on the next update.
+func replaceBinary(exe, replacement string) error {
+	backup := exe + ".old"
+	os.Remove(backup)
+	if err := os.Rename(exe, backup); err != nil {
+		return err
+	}
+	if err := os.Rename(replacement, exe); err != nil {
+		os.Rename(backup, exe)
+		return err
+	}
+	os.Remove(backup)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// releaseServer serves a release with an asset for this platform and, when sums is not
+// empty, a checksums.txt with that content. It counts asset downloads.
+func releaseServer(t *testing.T, sums string) (*httptest.Server, *int) {
+	t.Helper()
+	downloads := 0
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		assets := []map[string]string{{"name": assetName(), "browser_download_url": srv.URL + "/asset"}}
+		if sums != "" {
+			assets = append(assets, map[string]string{"name": "checksums.txt", "browser_download_url": srv.URL + "/checksums.txt"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tag_name": "v9.9.9", "assets": assets})
+	})
+	mux.HandleFunc("/asset", func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		fmt.Fprint(w, "binary")
+	})
+	mux.HandleFunc("/checksums.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, sums)
+	})
+	return srv, &downloads
+}
+
+func TestReleaseChecksum(t *testing.T) {
+	tests := []struct {
+		name, sums string
+		want       string // the checksum, or part of the error
+	}{
+		{"listed", "abc123  " + assetName() + "\nfff  costs-plan9-386\n", "abc123"},
+		{"binary mode", "abc123 *" + assetName() + "\n", "abc123"},
+		{"not listed", "fff  costs-plan9-386\n", "no checksum listed for " + assetName()},
+		{"no checksums.txt", "", "release v9.9.9 publishes no checksums.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := releaseServer(t, tt.sums)
+			t.Setenv("MCP_CLI_RELEASE_URL", srv.URL+"/latest")
+			rel, err := fetchLatestRelease()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := releaseChecksum(rel, assetName())
+			if err != nil {
+				got = err.Error()
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Without checksums.txt the update is refused before the binary is even downloaded.
+func TestSelfUpdateRequiresChecksums(t *testing.T) {
+	srv, downloads := releaseServer(t, "")
+	t.Setenv("MCP_CLI_RELEASE_URL", srv.URL+"/latest")
+	if code := runSelfUpdate([]string{"--force"}); code != 1 {
+		t.Errorf("exit code %d, want 1", code)
+	}
+	if *downloads != 0 {
+		t.Errorf("the asset was downloaded %d times", *downloads)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== Watch mode =====
+//
+// `costs --watch 30s allocations prod` runs a one-line query every interval and redraws its
+// table in place, like top(1). Rows whose costs rose since the previous refresh are shown in
+// red, rows that fell in green, and new rows in bold. Ctrl+C stops watching. Refreshes send
+// the last ETag, so unchanged data isn't transferred again.
+
+// ANSI styles for watched rows.
+const (
+	styleUp    = "\x1b[31m"
+	styleDown  = "\x1b[32m"
+	styleNew   = "\x1b[1m"
+	styleReset = "\x1b[0m"
+)
+
+// minWatchInterval keeps a typo like "1ms" from hammering the server.
+const minWatchInterval = time.Second
+
+// parseWatchInterval accepts a Go duration ("30s", "2m") or a number of seconds.
+func parseWatchInterval(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, serr := strconv.Atoi(v)
+		if serr != nil {
+			return 0, fmt.Errorf("invalid interval %q; use e.g. 30s or 2m", v)
+		}
+		d = time.Duration(secs) * time.Second
+	}
+	if d < minWatchInterval {
+		return 0, fmt.Errorf("interval must be at least %s", minWatchInterval)
+	}
+	return d, nil
+}
+
+// postQuery sends aq to the endpoint and returns the decoded response; API errors are
+// returned as *APIError.
+func postQuery(endpoint string, aq AgenticQuery) (*APIResponse, error) {
+	result, _, err := postQueryIfChanged(endpoint, aq, "")
+	return result, err
+}
+
+// postQueryIfChanged is postQuery with If-None-Match: when the server answers 304 for etag
+// the response is nil. It also returns the response's ETag.
+func postQueryIfChanged(endpoint string, aq AgenticQuery, etag string) (*APIResponse, string, error) {
+	payload, _ := json.Marshal(aq)
+	req, err := newServerRequest(http.MethodPost, "/"+endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", newRequestID())
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading response: %w", err)
+	}
+	result, err := decodeResponse(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("error decoding response: %w", err)
+	}
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	return result, resp.Header.Get("ETag"), nil
+}
+
+// rowKey identifies a record across refreshes by its text columns.
+func rowKey(cols []column, rec tableRecord) string {
+	var parts []string
+	for _, c := range cols {
+		if !c.numeric {
+			parts = append(parts, fmt.Sprint(rec.field(c.key)))
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// rowCost is the record's last numeric column, its total.
+func rowCost(cols []column, rec tableRecord) float64 {
+	for i := len(cols) - 1; i >= 0; i-- {
+		if cols[i].numeric {
+			f, _ := rec.field(cols[i].key).(float64)
+			return f
+		}
+	}
+	return 0
+}
+
+// runWatch repeats the one-line query line every interval until interrupted.
+func runWatch(interval time.Duration, line string, spec sortSpec) int {
+	line, lineSort := splitSortFlag(line)
+	if lineSort != "" {
+		var err error
+		if spec, err = parseSortSpec(lineSort); err != nil {
+			fmt.Println("Invalid --sort-by:", err)
+			return 2
+		}
+	}
+	endpoint, query, filters, ok := parseOneLine(line, &knownValues{})
+	if endpoint == "" {
+		endpoint = "allocations"
+	}
+	if !ok {
+		query = ""
+	}
+	aq := AgenticQuery{Query: query, Filters: filters}
+	if line == "" {
+		line = endpoint
+	}
+
+	var previous map[string]float64 // row key -> cost at the last refresh; nil before the first
+	var last *APIResponse           // last full response, redrawn when the server says 304
+	etag := ""
+	for {
+		result, tag, err := postQueryIfChanged(endpoint, aq, etag)
+		unchanged := err == nil && result == nil
+		if unchanged {
+			result = last
+		} else if err == nil {
+			last, etag = result, tag
+		}
+		fmt.Print("\x1b[H\x1b[2J")
+		fmt.Printf("Every %s: %s    %s", interval, line, time.Now().Format("15:04:05"))
+		if unchanged {
+			fmt.Print("  (unchanged)")
+		}
+		fmt.Print("\n\n")
+		switch {
+		case err != nil:
+			fmt.Println(err)
+		case unchanged:
+			// Same data as last time, so nothing is highlighted
+			drawWatched(endpoint, result, spec, nil)
+		default:
+			previous = drawWatched(endpoint, result, spec, previous)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// drawWatched prints one refresh and returns the costs to compare the next one against.
+func drawWatched(endpoint string, result *APIResponse, spec sortSpec, previous map[string]float64) map[string]float64 {
+	endpoint = result.endpointFor(endpoint)
+	cols, ok := endpointColumns[endpoint]
+	if !ok {
+		fmt.Println("(No table layout for this endpoint.)")
+		return previous
+	}
+	records, _ := result.records(endpoint)
+	if len(records) == 0 {
+		fmt.Println("(No data records returned.)")
+		return map[string]float64{}
+	}
+	if _, ok := findColumn(cols, spec.column); !ok {
+		spec = sortSpec{}
+	}
+
+	current := map[string]float64{}
+	for _, rec := range records {
+		current[rowKey(cols, rec)] = rowCost(cols, rec)
+	}
+	style := func(rec tableRecord) string {
+		if previous == nil {
+			return ""
+		}
+		was, seen := previous[rowKey(cols, rec)]
+		now := rowCost(cols, rec)
+		switch {
+		case !seen:
+			return styleNew
+		case now > was:
+			return styleUp
+		case now < was:
+			return styleDown
+		}
+		return ""
+	}
+	if err := printTable(os.Stdout, cols, records, spec, style); err != nil {
+		fmt.Println(err)
+	}
+	return current
+}
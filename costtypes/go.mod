@@ -0,0 +1,3 @@
+module costtypes
+
+go 1.24.5
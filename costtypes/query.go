@@ -0,0 +1,77 @@
+// Package costtypes holds the request and record types shared by the MCP server, the CLI and
+// the mock OpenCost backend, so the three agree on field names and JSON encoding.
+//
+// Struct tags carry both the JSON name and a jsonschema description, so a schema generator
+// (or an agent reading the source) sees the same documentation as the Go code.
+package costtypes
+
+// Filters narrows a query. Empty fields don't filter.
+type Filters struct {
+	Namespace string `json:"namespace,omitempty" jsonschema:"description=Namespace; lists (a,b), exclusions (!a) and /regexes/ are accepted"`
+	Start     string `json:"start,omitempty" jsonschema:"description=Window start as RFC3339,format=date-time"`
+	End       string `json:"end,omitempty" jsonschema:"description=Window end as RFC3339,format=date-time"`
+	Window    string `json:"window,omitempty" jsonschema:"description=Relative window such as 7d or yesterday or lastmonth"`
+	Timezone  string `json:"timezone,omitempty" jsonschema:"description=IANA zone for calendar windows and day buckets; default UTC"`
+	Provider  string `json:"provider,omitempty" jsonschema:"description=Cloud provider of assets, e.g. AWS"`
+	Region    string `json:"region,omitempty" jsonschema:"description=Cloud region of assets, e.g. us-west-2"`
+	Status    string `json:"status,omitempty" jsonschema:"description=Lifecycle status of assets; lists (stopped,terminated) are accepted"`
+	Tag       string `json:"tag,omitempty" jsonschema:"description=Asset tags as key=value or a bare key that must be present; lists (owner=platform,env) must all match"`
+
+	Resolution string `json:"resolution,omitempty" jsonschema:"description=Bucket size for a per-namespace time series,enum=day,enum=hour"`
+
+	Expr string `json:"expr,omitempty" jsonschema:"description=Filter expression over the fields of the endpoint's records; e.g. namespace=prod AND totalCost>100 on /allocations or provider=AWS AND cost>50 on /assets"`
+}
+
+// QueryContext ties a query to a conversation.
+type QueryContext struct {
+	SessionID           string   `json:"session_id,omitempty" jsonschema:"description=Session identifier for conversation tracking"`
+	PreviousQuery       string   `json:"previous_query,omitempty" jsonschema:"description=Last query made in this session"`
+	ConversationContext []string `json:"conversation_context,omitempty" jsonschema:"description=Full history of queries in this session"`
+	Snapshot            bool     `json:"snapshot,omitempty" jsonschema:"description=Keep this response in the session's result history"`
+	SessionStats        bool     `json:"session_stats,omitempty" jsonschema:"description=Include meta.session_stats"`
+}
+
+// AgenticQuery is the request body every endpoint accepts: a natural language query,
+// structured filters and the conversation it belongs to. The server extends it with
+// server-side options such as enrichment and summaries.
+type AgenticQuery struct {
+	Query   string       `json:"query,omitempty" jsonschema:"description=The natural language query, e.g. Show prod costs"`
+	Filters Filters      `json:"filters,omitempty"`
+	Context QueryContext `json:"context,omitempty"`
+}
+
+// NewAgenticQuery returns a query for text with filters, in session sessionID when it is set.
+func NewAgenticQuery(text string, filters Filters, sessionID string) AgenticQuery {
+	return AgenticQuery{Query: text, Filters: filters, Context: QueryContext{SessionID: sessionID}}
+}
+
+// Set assigns the filter whose JSON name is key and reports whether key names one.
+func (f *Filters) Set(key, value string) bool {
+	switch key {
+	case "namespace":
+		f.Namespace = value
+	case "start":
+		f.Start = value
+	case "end":
+		f.End = value
+	case "window":
+		f.Window = value
+	case "timezone":
+		f.Timezone = value
+	case "provider":
+		f.Provider = value
+	case "region":
+		f.Region = value
+	case "status":
+		f.Status = value
+	case "tag":
+		f.Tag = value
+	case "resolution":
+		f.Resolution = value
+	case "expr":
+		f.Expr = value
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package costtypes
+
+import (
+	"math"
+	"time"
+)
+
+// CloudCost is one cloud cost line, as served by /cloudCosts.
+type CloudCost struct {
+	Name      string  `json:"name" jsonschema:"description=Billed resource or service"`
+	CPUCost   float64 `json:"cpuCost" jsonschema:"description=Compute cost"`
+	GPUCost   float64 `json:"gpuCost" jsonschema:"description=GPU cost"`
+	TotalCost float64 `json:"totalCost" jsonschema:"description=Total cost"`
+}
+
+// Allocation is the cost of one workload over a window, as served by /allocations.
+type Allocation struct {
+	Namespace   string  `json:"namespace" jsonschema:"description=Kubernetes namespace"`
+	ResourceID  string  `json:"resource_id" jsonschema:"description=Pod or other workload identifier"`
+	CPUCost     float64 `json:"cpu_cost"`
+	MemoryCost  float64 `json:"memory_cost"`
+	GPUCost     float64 `json:"gpu_cost"`
+	NetworkCost float64 `json:"network_cost" jsonschema:"description=Network egress cost"`
+	PVCost      float64 `json:"pv_cost" jsonschema:"description=Persistent volume (storage) cost"`
+	TotalCost   float64 `json:"total_cost"`
+	StartTime   string  `json:"start_time" jsonschema:"format=date-time"`
+	EndTime     string  `json:"end_time" jsonschema:"format=date-time"`
+
+	// Usage over the window, for unit costs; zero when the backend doesn't report it.
+	CPUCoreHours float64 `json:"cpu_core_hours,omitempty" jsonschema:"description=CPU cores used times hours"`
+	RAMGBHours   float64 `json:"ram_gb_hours,omitempty" jsonschema:"description=Memory GB used times hours"`
+	GPUHours     float64 `json:"gpu_hours,omitempty" jsonschema:"description=GPUs allocated times hours"`
+
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// AssetIDs lists the cloud assets (nodes, disks, managed services) backing the workload.
+	AssetIDs []string `json:"asset_ids,omitempty"`
+}
+
+// Asset is one cloud asset, as served by /assets.
+type Asset struct {
+	AssetID  string  `json:"asset_id"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type" jsonschema:"description=Asset kind, e.g. VM or Database"`
+	Status   string  `json:"status" jsonschema:"enum=active,enum=stopped,enum=terminated"`
+	Provider string  `json:"provider"`
+	Region   string  `json:"region"`
+	Cost     float64 `json:"cost"`
+
+	// PricingModel is "on-demand", "spot" or "reserved"; empty when the backend doesn't say.
+	PricingModel string `json:"pricing_model,omitempty" jsonschema:"enum=on-demand,enum=spot,enum=reserved"`
+
+	// Currency is the ISO 4217 code Cost is in; empty is the server's base currency. A cost the
+	// server converted keeps its billed amount and currency in OriginalCost and OriginalCurrency.
+	Currency         string  `json:"currency,omitempty" jsonschema:"description=ISO 4217 currency of cost, e.g. USD"`
+	OriginalCost     float64 `json:"original_cost,omitempty"`
+	OriginalCurrency string  `json:"original_currency,omitempty"`
+
+	// CreatedAt and TerminatedAt (RFC3339) bound the asset's life; empty when the backend
+	// doesn't know. A terminated asset can still carry the cost of its last billing period.
+	CreatedAt    string `json:"created_at,omitempty" jsonschema:"format=date-time"`
+	TerminatedAt string `json:"terminated_at,omitempty" jsonschema:"format=date-time"`
+
+	// Tags are the provider's resource tags or labels, such as owner=platform.
+	Tags map[string]string `json:"tags,omitempty" jsonschema:"description=Resource tags, e.g. owner or env"`
+}
+
+// TimeSeriesPoint is the cost attributed to one bucket.
+type TimeSeriesPoint struct {
+	Start       string  `json:"start" jsonschema:"format=date-time"`
+	End         string  `json:"end" jsonschema:"format=date-time"`
+	CPUCost     float64 `json:"cpu_cost"`
+	MemoryCost  float64 `json:"memory_cost"`
+	GPUCost     float64 `json:"gpu_cost"`
+	NetworkCost float64 `json:"network_cost"`
+	PVCost      float64 `json:"pv_cost"`
+	SharedCost  float64 `json:"shared_cost,omitempty" jsonschema:"description=Share of cluster overhead distributed to this namespace"`
+	TotalCost   float64 `json:"total_cost"`
+}
+
+// NamespaceSeries is one namespace's costs over time. Points are dense: buckets without
+// any cost are present with zeros, so charts don't need to fill gaps.
+type NamespaceSeries struct {
+	Namespace       string            `json:"namespace"`
+	TotalCost       float64           `json:"total_cost"`
+	SharePct        float64           `json:"share_pct" jsonschema:"description=Percent of the total of all series returned"`
+	ShareOfTotalPct float64           `json:"share_of_total_pct" jsonschema:"description=Percent of all cost in the window before namespace filters"`
+	Points          []TimeSeriesPoint `json:"points"`
+}
+
+// NewCloudCost returns a cloud cost whose total is cpu + gpu.
+func NewCloudCost(name string, cpu, gpu float64) CloudCost {
+	return CloudCost{Name: name, CPUCost: cpu, GPUCost: gpu, TotalCost: cents(cpu + gpu)}
+}
+
+// NewAllocation returns an allocation over [start, end) whose total is the sum of its parts.
+// Network and storage costs start at zero; see WithNetworkAndStorage.
+func NewAllocation(namespace, resourceID string, cpu, memory, gpu float64, start, end time.Time) Allocation {
+	return Allocation{
+		Namespace:  namespace,
+		ResourceID: resourceID,
+		CPUCost:    cpu,
+		MemoryCost: memory,
+		GPUCost:    gpu,
+		TotalCost:  cents(cpu + memory + gpu),
+		StartTime:  start.UTC().Format(time.RFC3339),
+		EndTime:    end.UTC().Format(time.RFC3339),
+	}
+}
+
+// WithNetworkAndStorage returns a with network egress and persistent volume costs added to
+// its total.
+func (a Allocation) WithNetworkAndStorage(network, pv float64) Allocation {
+	a.NetworkCost, a.PVCost = network, pv
+	a.TotalCost = cents(a.CPUCost + a.MemoryCost + a.GPUCost + network + pv)
+	return a
+}
+
+// NewAsset returns an active asset.
+func NewAsset(id, name, kind, provider, region string, cost float64) Asset {
+	return Asset{AssetID: id, Name: name, Type: kind, Status: "active", Provider: provider, Region: region, Cost: cost}
+}
+
+// cents rounds a sum to two decimals, so 2.2 + 0.8 totals 3 rather than 3.0000000000000004.
+func cents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
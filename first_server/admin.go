@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// ===== Admin API =====
+//
+// /admin/* endpoints operate the server rather than answer cost questions. They need the admin
+// role: "Authorization: Bearer <ADMIN_TOKEN>" or the key of an admin tenant (see rbac.go).
+
+var adminToken string
+
+// loadAdminConfig reads ADMIN_TOKEN.
+func loadAdminConfig() {
+	adminToken = os.Getenv("ADMIN_TOKEN")
+}
+
+// SessionInfo describes one session in /admin/sessions.
+type SessionInfo struct {
+	SessionID    string    `json:"session_id"`
+	ForkedFrom   string    `json:"forked_from,omitempty"`
+	Requests     int       `json:"requests"`
+	Queries      int       `json:"queries"`
+	Endpoints    []string  `json:"endpoints"`
+	Snapshots    int       `json:"snapshots"`
+	SizeBytes    int       `json:"size_bytes"` // JSON size of the session's state and snapshots
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+	IdleSeconds  int64     `json:"idle_seconds"`
+}
+
+// sessionInfos describes every session, most recently active first.
+func sessionInfos(now time.Time) []SessionInfo {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	infos := make([]SessionInfo, 0, len(sessions))
+	for id, s := range sessions {
+		raw, _ := json.Marshal(s)
+		info := SessionInfo{
+			SessionID:    id,
+			ForkedFrom:   s.ForkedFrom,
+			Requests:     s.Requests,
+			Queries:      len(s.Queries),
+			Endpoints:    make([]string, 0, len(s.EffectiveFilters)),
+			SizeBytes:    len(raw),
+			CreatedAt:    s.CreatedAt,
+			LastActivity: s.LastActivity,
+			IdleSeconds:  int64(now.Sub(s.LastActivity).Seconds()),
+		}
+		for endpoint := range s.EffectiveFilters {
+			info.Endpoints = append(info.Endpoints, endpoint)
+		}
+		sort.Strings(info.Endpoints)
+		for _, snap := range snapshots.list(id) {
+			info.Snapshots++
+			info.SizeBytes += len(snap.Response)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].LastActivity.Equal(infos[j].LastActivity) {
+			return infos[i].LastActivity.After(infos[j].LastActivity)
+		}
+		return infos[i].SessionID < infos[j].SessionID
+	})
+	return infos
+}
+
+// deleteSession drops a session and its snapshots, reporting whether it existed.
+func deleteSession(id string) (bool, error) {
+	sessionsMu.Lock()
+	_, found := sessions[id]
+	delete(sessions, id)
+	sessionsMu.Unlock()
+	found = found || len(snapshots.list(id)) > 0
+	return found, snapshots.replace(id, "", nil)
+}
+
+// adminListSessionsHandler handles GET /admin/sessions.
+func adminListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	infos := sessionInfos(time.Now().UTC())
+	var size int
+	for _, info := range infos {
+		size += info.SizeBytes
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": infos,
+		"meta": map[string]interface{}{"total": len(infos), "size_bytes": size, "request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// adminDeleteSessionHandler handles DELETE /admin/sessions/{session_id}.
+func adminDeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("session_id")
+	found, err := deleteSession(id)
+	if !found {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such session: "+id, nil)
+		return
+	}
+	if err != nil {
+		logf(r.Context(), "[MCP] Removing persisted snapshots for session %s failed: %v\n", id, err)
+	}
+	logf(r.Context(), "[MCP] Admin deleted session %s\n", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminExpireSessionsHandler handles POST /admin/sessions/expire?idle=2h, deleting every
+// session idle for at least that long. idle accepts durations like 30m, 12h or 7d.
+func adminExpireSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	v := r.URL.Query().Get("idle")
+	idle, err := parseLookback(v)
+	if err != nil || idle <= 0 {
+		writeValidationError(w, r, ValidationErrors{{Field: "idle", Value: v, Message: "must be a positive duration like 30m, 12h or 7d"}})
+		return
+	}
+	expired := []string{}
+	for _, info := range sessionInfos(time.Now().UTC()) {
+		if time.Duration(info.IdleSeconds)*time.Second < idle {
+			continue
+		}
+		if _, err := deleteSession(info.SessionID); err != nil {
+			logf(r.Context(), "[MCP] Removing persisted snapshots for session %s failed: %v\n", info.SessionID, err)
+		}
+		expired = append(expired, info.SessionID)
+	}
+	logf(r.Context(), "[MCP] Admin expired %d sessions idle for %s\n", len(expired), idle)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{"expired": expired},
+		"meta": map[string]interface{}{"idle": v, "total": len(expired), "request_id": requestIDFrom(r.Context())},
+	})
+}
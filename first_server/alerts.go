@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Alert configuration =====
+
+// Budget is a spending limit for a namespace or team over a rolling period.
+type Budget struct {
+	Name      string  `json:"name"`
+	Namespace string  `json:"namespace,omitempty"` // scope: one namespace...
+	Team      string  `json:"team,omitempty"`      // ...or one team (via TEAM_MAPPING_FILE); neither = everything
+	Limit     float64 `json:"limit"`
+	Period    string  `json:"period,omitempty"` // rolling window, e.g. "24h", "7d" (default "24h")
+}
+
+// AlertWebhook is a destination for alert notifications.
+type AlertWebhook struct {
+	URL    string `json:"url"`
+	Format string `json:"format,omitempty"` // "json" (default) or "slack"
+}
+
+// SpikeRule flags namespaces whose spend in the latest window grew by more than
+// ThresholdPct over the preceding window of the same length.
+type SpikeRule struct {
+	ThresholdPct float64 `json:"threshold_pct"`
+	Window       string  `json:"window,omitempty"`   // default "24h"
+	MinCost      float64 `json:"min_cost,omitempty"` // ignore namespaces cheaper than this
+}
+
+// AlertConfig is loaded from ALERTS_FILE.
+//
+//	{
+//	  "webhooks": [{"url": "https://hooks.slack.com/...", "format": "slack"}],
+//	  "budgets":  [{"name": "prod daily", "namespace": "prod", "limit": 100, "period": "24h"}],
+//	  "spike":    {"threshold_pct": 50, "window": "24h"},
+//	  "dedup_window": "6h",
+//	  "check_interval": "15m"
+//	}
+type AlertConfig struct {
+	Webhooks      []AlertWebhook `json:"webhooks"`
+	Budgets       []Budget       `json:"budgets"`
+	Spike         *SpikeRule     `json:"spike,omitempty"`
+	DedupWindow   string         `json:"dedup_window,omitempty"`   // default "1h"
+	CheckInterval string         `json:"check_interval,omitempty"` // default "15m"
+}
+
+// Alert is one fired (or suppressed) alert, as recorded in the history.
+type Alert struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"` // budget_exceeded or cost_spike
+	Scope     string    `json:"scope"`
+	Message   string    `json:"message"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Window    [2]string `json:"window"`
+	FiredAt   time.Time `json:"fired_at"`
+	Status    string    `json:"status"` // firing (in webhook payloads), delivered, failed, suppressed, no_webhooks
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// dedupKey identifies alerts that describe the same condition.
+func (a Alert) dedupKey() string { return a.Kind + "|" + a.Scope }
+
+const (
+	alertHistoryLimit = 500
+	alertMaxAttempts  = 3
+)
+
+// alertState holds the active configuration, the dedup table and the history ring.
+type alertState struct {
+	mu       sync.Mutex
+	config   AlertConfig
+	dedup    time.Duration
+	interval time.Duration
+	lastSent map[string]time.Time
+	history  []Alert
+}
+
+var alerts = &alertState{dedup: time.Hour, interval: 15 * time.Minute, lastSent: map[string]time.Time{}}
+
+// loadAlertConfig reads the alert configuration. An empty path disables alerting.
+func loadAlertConfig(path string) error {
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read alert config: %w", err)
+	}
+	var cfg AlertConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return fmt.Errorf("failed to parse alert config %s: %w", path, err)
+	}
+	dedup, interval := time.Hour, 15*time.Minute
+	if cfg.DedupWindow != "" {
+		if dedup, err = parseLookback(cfg.DedupWindow); err != nil {
+			return fmt.Errorf("dedup_window: %w", err)
+		}
+	}
+	if cfg.CheckInterval != "" {
+		if interval, err = parseLookback(cfg.CheckInterval); err != nil {
+			return fmt.Errorf("check_interval: %w", err)
+		}
+	}
+	for i, b := range cfg.Budgets {
+		if b.Period == "" {
+			cfg.Budgets[i].Period = "24h"
+		} else if _, err := parseLookback(b.Period); err != nil {
+			return fmt.Errorf("budget %q: %w", b.Name, err)
+		}
+		if b.Limit <= 0 {
+			return fmt.Errorf("budget %q: limit must be positive", b.Name)
+		}
+	}
+	if cfg.Spike != nil && cfg.Spike.Window == "" {
+		cfg.Spike.Window = "24h"
+	}
+
+	alerts.mu.Lock()
+	alerts.config, alerts.dedup, alerts.interval = cfg, dedup, interval
+	alerts.mu.Unlock()
+	log.Printf("[MCP] Loaded alert config from %s (%d budgets, %d webhooks)\n", path, len(cfg.Budgets), len(cfg.Webhooks))
+	return nil
+}
+
+// ===== Evaluation =====
+
+// budgetScope describes which allocations a budget covers.
+func budgetScope(b Budget) string {
+	switch {
+	case b.Namespace != "":
+		return "namespace:" + b.Namespace
+	case b.Team != "":
+		return "team:" + b.Team
+	}
+	return "all"
+}
+
+// budgetSpend sums the allocations a budget covers.
+func budgetSpend(b Budget, allocs []Allocation) float64 {
+	total := 0.0
+	for _, a := range allocs {
+		if b.Namespace != "" && a.Namespace != b.Namespace {
+			continue
+		}
+		if b.Team != "" {
+			if team, _ := teamMapping.teamFor(a); team != b.Team {
+				continue
+			}
+		}
+		total += a.TotalCost
+	}
+	return total
+}
+
+// windowEnding returns the RFC3339 bounds of the window of length d ending at t.
+func windowEnding(t time.Time, d time.Duration) (string, string) {
+	return t.Add(-d).UTC().Format(time.RFC3339), t.UTC().Format(time.RFC3339)
+}
+
+// evaluateAlerts checks every budget and the spike rule as of now and returns the
+// conditions that currently hold.
+func evaluateAlerts(ctx context.Context, cfg AlertConfig, now time.Time) ([]Alert, error) {
+	var fired []Alert
+	for _, b := range cfg.Budgets {
+		period, _ := parseLookback(b.Period)
+		start, end := windowEnding(now, period)
+		allocs, err := costSource.GetAllocations(ctx, AllocationFilter{Namespace: b.Namespace, Start: start, End: end})
+		if err != nil {
+			return nil, err
+		}
+		spend := budgetSpend(b, allocs)
+		if spend > b.Limit {
+			fired = append(fired, Alert{
+				Kind:      "budget_exceeded",
+				Scope:     budgetScope(b),
+				Message:   fmt.Sprintf("Budget %q exceeded: spent %.2f of %.2f over the last %s (%.0f%%)", b.Name, spend, b.Limit, b.Period, spend/b.Limit*100),
+				Value:     round2(spend),
+				Threshold: b.Limit,
+				Window:    [2]string{start, end},
+			})
+		}
+	}
+
+	if cfg.Spike != nil && cfg.Spike.ThresholdPct > 0 {
+		window, err := parseLookback(cfg.Spike.Window)
+		if err != nil {
+			return nil, err
+		}
+		curStart, curEnd := windowEnding(now, window)
+		prevStart, prevEnd := windowEnding(now.Add(-window), window)
+		cur, err := costSource.GetAllocations(ctx, AllocationFilter{Start: curStart, End: curEnd})
+		if err != nil {
+			return nil, err
+		}
+		prev, err := costSource.GetAllocations(ctx, AllocationFilter{Start: prevStart, End: prevEnd})
+		if err != nil {
+			return nil, err
+		}
+		curByNS, prevByNS := sumByNamespace(cur, namespaceFilter{}), sumByNamespace(prev, namespaceFilter{})
+		namespaces := make([]string, 0, len(curByNS))
+		for ns := range curByNS {
+			namespaces = append(namespaces, ns)
+		}
+		sort.Strings(namespaces)
+		for _, ns := range namespaces {
+			c, p := curByNS[ns], prevByNS[ns]
+			if p <= 0 || c < cfg.Spike.MinCost {
+				continue
+			}
+			if change := (c - p) / p * 100; change > cfg.Spike.ThresholdPct {
+				fired = append(fired, Alert{
+					Kind:      "cost_spike",
+					Scope:     "namespace:" + ns,
+					Message:   fmt.Sprintf("Cost spike in %s: %.2f over the last %s vs %.2f before (+%.0f%%)", ns, c, cfg.Spike.Window, p, change),
+					Value:     round2(change),
+					Threshold: cfg.Spike.ThresholdPct,
+					Window:    [2]string{curStart, curEnd},
+				})
+			}
+		}
+	}
+	return fired, nil
+}
+
+// sumByNamespace totals allocation cost per namespace, skipping namespaces the filter rejects.
+func sumByNamespace(allocs []Allocation, f namespaceFilter) map[string]float64 {
+	totals := map[string]float64{}
+	for _, a := range allocs {
+		if !f.matches(a.Namespace) {
+			continue
+		}
+		totals[a.Namespace] += a.TotalCost
+	}
+	return totals
+}
+
+// ===== Dispatch =====
+
+// dispatchAlerts suppresses duplicates within the dedup window, delivers the rest to every
+// webhook, and records everything in the history. Only an alert at least one webhook accepted
+// starts a dedup window, so a failed delivery is retried on the next check.
+func dispatchAlerts(ctx context.Context, fired []Alert, now time.Time) []Alert {
+	alerts.mu.Lock()
+	cfg, dedup := alerts.config, alerts.dedup
+	alerts.mu.Unlock()
+
+	out := make([]Alert, 0, len(fired))
+	for _, a := range fired {
+		a.ID = "alt-" + newRequestID()[:8]
+		a.FiredAt = now.UTC()
+
+		alerts.mu.Lock()
+		last, seen := alerts.lastSent[a.dedupKey()]
+		suppress := seen && now.Sub(last) < dedup
+		alerts.mu.Unlock()
+
+		switch {
+		case suppress:
+			a.Status = "suppressed"
+		case len(cfg.Webhooks) == 0:
+			a.Status = "no_webhooks"
+		default:
+			a.Status = "firing" // what webhooks see; replaced by the delivery outcome below
+			var errs []string
+			for _, hook := range cfg.Webhooks {
+				attempts, err := postAlert(ctx, hook, a)
+				a.Attempts += attempts
+				if err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+			a.Status = "delivered"
+			if len(errs) > 0 {
+				a.Status, a.Error = "failed", strings.Join(errs, "; ")
+			}
+			if len(errs) < len(cfg.Webhooks) {
+				alerts.mu.Lock()
+				alerts.lastSent[a.dedupKey()] = now
+				alerts.mu.Unlock()
+			}
+		}
+		logf(ctx, "[Alerts] %s %s: %s\n", a.Status, a.Kind, a.Message)
+		out = append(out, a)
+	}
+
+	alerts.mu.Lock()
+	alerts.history = append(alerts.history, out...)
+	if n := len(alerts.history); n > alertHistoryLimit {
+		alerts.history = alerts.history[n-alertHistoryLimit:]
+	}
+	alerts.mu.Unlock()
+	return out
+}
+
+// alertPayload renders an alert for a webhook. Slack incoming webhooks take {"text": ...}.
+func alertPayload(hook AlertWebhook, a Alert) interface{} {
+	if hook.Format == "slack" {
+		icon := ":money_with_wings:"
+		if a.Kind == "cost_spike" {
+			icon = ":chart_with_upwards_trend:"
+		}
+		return map[string]string{"text": fmt.Sprintf("%s *%s* — %s", icon, a.Kind, a.Message)}
+	}
+	return a
+}
+
+// postAlert delivers one alert with exponential backoff, returning the attempts made.
+func postAlert(ctx context.Context, hook AlertWebhook, a Alert) (int, error) {
+	body, _ := json.Marshal(alertPayload(hook, a))
+	backoff := time.Second
+	var lastErr error
+	for attempt := 1; attempt <= alertMaxAttempts; attempt++ {
+		reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, hook.URL, bytes.NewReader(body))
+		if err != nil {
+			cancel()
+			return attempt, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := outboundClient.Do(req)
+		cancel()
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return attempt, nil
+			}
+			err = fmt.Errorf("webhook returned %d", resp.StatusCode)
+			if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+				return attempt, err // client errors won't succeed on retry
+			}
+		}
+		lastErr = err
+		if attempt < alertMaxAttempts {
+			select {
+			case <-ctx.Done():
+				return attempt, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+	}
+	return alertMaxAttempts, fmt.Errorf("%s: %w", hook.URL, lastErr)
+}
+
+// runAlertCheck evaluates and dispatches once.
+func runAlertCheck(ctx context.Context, now time.Time) ([]Alert, error) {
+	alerts.mu.Lock()
+	cfg := alerts.config
+	alerts.mu.Unlock()
+	fired, err := evaluateAlerts(ctx, cfg, now)
+	if err != nil {
+		logf(ctx, "[Alerts] Evaluation failed: %v\n", err)
+		return nil, err
+	}
+	return dispatchAlerts(ctx, fired, now), nil
+}
+
+// startAlerting evaluates alert rules every check interval until ctx is cancelled.
+func startAlerting(ctx context.Context) {
+	alerts.mu.Lock()
+	enabled := len(alerts.config.Budgets) > 0 || alerts.config.Spike != nil
+	interval := alerts.interval
+	alerts.mu.Unlock()
+	if !enabled {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				runAlertCheck(context.WithValue(ctx, requestIDKey{}, "alerts-"+newRequestID()[:6]), now)
+			}
+		}
+	}()
+}
+
+// ===== /alerts API =====
+
+// alertsHandler handles GET /alerts, newest first. Optional filters: kind, status, limit.
+func alertsHandler(w http.ResponseWriter, r *http.Request) {
+	kind, status := r.URL.Query().Get("kind"), r.URL.Query().Get("status")
+
+	alerts.mu.Lock()
+	list := []Alert{}
+	for i := len(alerts.history) - 1; i >= 0; i-- {
+		a := alerts.history[i]
+		if (kind == "" || a.Kind == kind) && (status == "" || a.Status == status) {
+			list = append(list, a)
+		}
+	}
+	alerts.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": list,
+		"meta": map[string]interface{}{
+			"filtersUsed": map[string]string{"kind": kind, "status": status},
+			"request_id":  requestIDFrom(r.Context()),
+			"total":       len(list),
+		},
+	})
+}
+
+// evaluateAlertsHandler handles POST /alerts/evaluate, running the rules immediately.
+// An optional ?at=RFC3339 evaluates as of that time.
+func evaluateAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	if at := r.URL.Query().Get("at"); at != "" {
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			var verrs ValidationErrors
+			verrs.add("at", at, "must be an RFC3339 timestamp")
+			writeValidationError(w, r, verrs)
+			return
+		}
+		now = t
+	}
+	fired, err := runAlertCheck(r.Context(), now)
+	if err != nil {
+		writeBackendError(w, r, "Alert evaluation failed", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": fired,
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context()), "total": len(fired)},
+	})
+}
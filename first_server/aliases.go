@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ===== Filter aliases =====
+//
+// People ask about "production", "amazon" or "virginia"; the data says prod, AWS and
+// us-east-1. An alias table maps such words to filter values, per field. Handlers apply it to
+// the namespace, provider and region filters before validating them, whether they came as
+// query parameters, POST filters or out of a /query question, and list each mapping applied
+// in meta.aliases:
+//
+//	"aliases": [{"field": "namespace", "from": "production", "to": "prod"}]
+//
+// The built-in table only spells providers: amazon, google and microsoft. More come from
+// FILTER_ALIASES_FILE, whose entries add to and override the built-ins:
+//
+//	{
+//	  "namespace": {"production": "prod", "development": "dev"},
+//	  "provider":  {"amzn": "AWS"},
+//	  "region":    {"virginia": "us-east-1", "ohio": "us-east-2"}
+//	}
+//
+// Aliases match whole values (each term of a namespace list) case-insensitively. Regex
+// namespace terms are left alone.
+
+// aliasFields are the filters an alias table can map.
+var aliasFields = []string{"namespace", "provider", "region"}
+
+// filterAliases maps each field's lowercased aliases to their values.
+var filterAliases = map[string]map[string]string{
+	"namespace": {},
+	"provider":  {"amazon": "AWS", "google": "GCP", "microsoft": "Azure"},
+	"region":    {},
+}
+
+// AliasMapping is one entry of meta.aliases.
+type AliasMapping struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// loadFilterAliases reads FILTER_ALIASES_FILE into filterAliases. An empty path keeps the
+// built-in table.
+func loadFilterAliases(path string) error {
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read filter aliases: %w", err)
+	}
+	var table map[string]map[string]string
+	if err := json.Unmarshal(raw, &table); err != nil {
+		return fmt.Errorf("failed to parse filter aliases %s: %w", path, err)
+	}
+	n := 0
+	for field, aliases := range table {
+		if _, ok := filterAliases[field]; !ok {
+			return fmt.Errorf("filter aliases %s: unknown field %q; expected one of %s", path, field, strings.Join(aliasFields, ", "))
+		}
+		for from, to := range aliases {
+			key := aliasKey(from)
+			if key == "" || strings.TrimSpace(to) == "" {
+				return fmt.Errorf("filter aliases %s: %s alias %q → %q must not be empty", path, field, from, to)
+			}
+			if field == "namespace" && strings.ContainsAny(from+to, ",!") {
+				return fmt.Errorf("filter aliases %s: namespace alias %q → %q can't contain \",\" or \"!\"", path, from, to)
+			}
+			filterAliases[field][key] = strings.TrimSpace(to)
+			n++
+		}
+	}
+	for from, to := range filterAliases["provider"] {
+		var verrs ValidationErrors
+		if validateProvider(&verrs, to); len(verrs) > 0 {
+			return fmt.Errorf("filter aliases %s: provider alias %q maps to unknown provider %q", path, from, to)
+		}
+	}
+	log.Printf("[MCP] Loaded %d filter aliases from %s\n", n, path)
+	return nil
+}
+
+// aliasKey normalizes an alias for lookup: lowercased, with single spaces between words.
+func aliasKey(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// resolveAliases maps value through field's aliases, recording each mapping applied for the
+// request in ctx. Namespace values are mapped term by term, keeping "!" and skipping regexes.
+func resolveAliases(ctx context.Context, field, value string) string {
+	aliases := filterAliases[field]
+	if value == "" || len(aliases) == 0 {
+		return value
+	}
+	resolve := func(term string) string {
+		to, ok := aliases[aliasKey(term)]
+		if !ok || to == term {
+			return term
+		}
+		recordAlias(ctx, AliasMapping{Field: field, From: term, To: to})
+		return to
+	}
+	if field != "namespace" {
+		return resolve(strings.TrimSpace(value))
+	}
+	terms := splitList(value)
+	for i, term := range terms {
+		if len(term) > 2 && strings.HasPrefix(term, "/") && strings.HasSuffix(term, "/") {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(term, "!"); ok {
+			terms[i] = "!" + resolve(strings.TrimSpace(rest))
+		} else {
+			terms[i] = resolve(term)
+		}
+	}
+	return strings.Join(terms, ",")
+}
+
+// recordAlias adds m to the request's meta.aliases, ignoring repeats. Outside a request it
+// only logs.
+func recordAlias(ctx context.Context, m AliasMapping) {
+	logf(ctx, "[MCP] Alias %s %q → %q\n", m.Field, m.From, m.To)
+	list, _ := ctx.Value(warningsKey{}).(*warningList)
+	if list == nil {
+		return
+	}
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	for _, seen := range list.aliases {
+		if seen == m {
+			return
+		}
+	}
+	list.aliases = append(list.aliases, m)
+}
+
+// aliasInText returns the first of field's aliases to appear in text as whole words,
+// preferring longer aliases, so a question can say "production" without "namespace".
+func aliasInText(field, text string) string {
+	phrase := func(s string) string { return strings.Join(routeWord.FindAllString(strings.ToLower(s), -1), " ") }
+	words := " " + phrase(text) + " "
+	keys := make([]string, 0, len(filterAliases[field]))
+	for key := range filterAliases[field] {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		if p := phrase(key); p != "" && strings.Contains(words, " "+p+" ") {
+			return key
+		}
+	}
+	return ""
+}
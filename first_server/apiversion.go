@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== Response versions =====
+//
+// Responses come in versioned envelopes so the API can evolve without breaking agents built
+// against it. Callers pick one with ?api-version=2 or Accept: application/vnd.opencost.v2+json
+// (the query parameter wins); every response says which it got in the API-Version header.
+//
+//	1  the current envelope, {"data", "meta"}, and the default
+//	2  the same data under a richer, more regular meta:
+//	     api_version, endpoint, generated_at, duration_ms and request_id
+//	     count          was total
+//	     filters        was filtersUsed
+//	     session        {id, previous_query, history, stats}, was session_id,
+//	                    previous_query, conversation_context and session_stats
+//	   plus every other meta key unchanged. Errors keep their shape and gain api_version.
+//
+// Handlers only ever write version 1; withAPIVersion rewrites their output for version 2, so
+// a new version is one more shim here rather than a change to every handler. Paths that serve
+// someone else's contract (Grafana, Slack, the OpenCost proxy) are never rewritten.
+
+// apiVersions are the supported versions, oldest first.
+var apiVersions = []int{1, 2}
+
+const (
+	defaultAPIVersion = 1
+	latestAPIVersion  = 2
+)
+
+// unversionedPaths are left alone by withAPIVersion.
+var unversionedPaths = []string{"/grafana/", "/slack/", "/opencost/", "/metrics"}
+
+// requestedAPIVersion reads ?api-version or the Accept header; ok is false for a version
+// this server doesn't have.
+func requestedAPIVersion(r *http.Request) (version int, raw string, ok bool) {
+	raw = r.URL.Query().Get("api-version")
+	if raw == "" {
+		for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			if v, found := strings.CutPrefix(mediaType, "application/vnd.opencost.v"); found {
+				raw = strings.TrimSuffix(v, "+json")
+				break
+			}
+			if mediaType == "application/json" && params["version"] != "" {
+				raw = params["version"]
+				break
+			}
+		}
+	}
+	if raw == "" {
+		return defaultAPIVersion, "", true
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(raw, "v"))
+	for _, known := range apiVersions {
+		if err == nil && v == known {
+			return v, raw, true
+		}
+	}
+	return 0, raw, false
+}
+
+// withAPIVersion negotiates the response version and rewrites responses for version 2.
+func withAPIVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range unversionedPaths {
+			if strings.HasPrefix(r.URL.Path, p) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Add("Vary", "Accept")
+		version, raw, ok := requestedAPIVersion(r)
+		if !ok {
+			w.Header().Set("API-Version", strconv.Itoa(latestAPIVersion))
+			writeError(w, r, http.StatusNotAcceptable, ErrCodeNotSupported, "unsupported API version "+raw,
+				map[string]interface{}{"supported": apiVersions})
+			return
+		}
+		w.Header().Set("API-Version", strconv.Itoa(version))
+		if version == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		started := time.Now()
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, r)
+		body := rec.Body.Bytes()
+		if strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+			if shimmed, ok := envelopeV2(body, r, time.Since(started)); ok {
+				body = shimmed
+				rec.Header().Del("Content-Length")
+			}
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(body)
+	})
+}
+
+// envelopeV2 rewrites a version 1 envelope as version 2. ok is false for bodies that aren't
+// an envelope, which are passed through.
+func envelopeV2(body []byte, r *http.Request, took time.Duration) ([]byte, bool) {
+	var env map[string]json.RawMessage
+	if json.Unmarshal(body, &env) != nil {
+		return nil, false
+	}
+	_, hasData := env["data"]
+	_, hasError := env["error"]
+	if !hasData && !hasError {
+		return nil, false
+	}
+	var meta map[string]interface{}
+	if raw, ok := env["meta"]; ok && json.Unmarshal(raw, &meta) != nil {
+		return nil, false
+	}
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+
+	rename := func(from, to string) {
+		if v, ok := meta[from]; ok {
+			meta[to] = v
+			delete(meta, from)
+		}
+	}
+	rename("total", "count")
+	rename("filtersUsed", "filters")
+	session := map[string]interface{}{}
+	for from, to := range map[string]string{"session_id": "id", "previous_query": "previous_query", "conversation_context": "history", "session_stats": "stats"} {
+		if v, ok := meta[from]; ok {
+			delete(meta, from)
+			if !emptyMetaValue(v) {
+				session[to] = v
+			}
+		}
+	}
+	if len(session) > 0 {
+		meta["session"] = session
+	}
+	if _, ok := meta["count"]; !ok && hasData {
+		var list []json.RawMessage
+		if json.Unmarshal(env["data"], &list) == nil {
+			meta["count"] = len(list)
+		}
+	}
+	meta["api_version"] = 2
+	meta["endpoint"] = r.URL.Path
+	meta["generated_at"] = time.Now().UTC().Format(time.RFC3339)
+	meta["duration_ms"] = took.Milliseconds()
+	meta["request_id"] = requestIDFrom(r.Context())
+
+	out := map[string]interface{}{"api_version": 2}
+	for k, v := range env {
+		if k != "meta" {
+			out[k] = v
+		}
+	}
+	if hasData {
+		out["meta"] = meta
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if enc.Encode(out) != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// emptyMetaValue reports whether a decoded meta value is null, "" or [].
+func emptyMetaValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== AWS Cost Explorer source =====
+//
+// AWSCostExplorerSource serves /cloudCosts straight from Cost Explorer's GetCostAndUsage,
+// one CloudCost per AWS service for the month to date. Requests are signed with SigV4 by
+// hand to keep the build dependency-free. Cost Explorer has no notion of pods or assets,
+// so allocations and assets are reported as unsupported.
+
+// AWSCostExplorerSource is the CostSource for COST_SOURCE=aws.
+type AWSCostExplorerSource struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Endpoint        string // default https://ce.us-east-1.amazonaws.com
+	Region          string // signing region; Cost Explorer is served from us-east-1
+	Metric          string // UnblendedCost, AmortizedCost, NetUnblendedCost, ...
+	AccountID       string // optional LINKED_ACCOUNT filter
+	NamespaceTag    string // cost allocation tag that carries the Kubernetes namespace
+
+	now func() time.Time
+}
+
+// newAWSCostExplorerSource reads AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN,
+// AWS_ACCOUNT_ID, AWS_CE_ENDPOINT, AWS_CE_METRIC and AWS_CE_NAMESPACE_TAG.
+func newAWSCostExplorerSource() (*AWSCostExplorerSource, error) {
+	s := &AWSCostExplorerSource{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Endpoint:        os.Getenv("AWS_CE_ENDPOINT"),
+		Region:          "us-east-1",
+		Metric:          os.Getenv("AWS_CE_METRIC"),
+		AccountID:       os.Getenv("AWS_ACCOUNT_ID"),
+		NamespaceTag:    os.Getenv("AWS_CE_NAMESPACE_TAG"),
+		now:             time.Now,
+	}
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return nil, fmt.Errorf("COST_SOURCE=aws requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = "https://ce.us-east-1.amazonaws.com"
+	}
+	if s.Metric == "" {
+		s.Metric = "UnblendedCost"
+	}
+	return s, nil
+}
+
+// ceRequest is the GetCostAndUsage request body.
+type ceRequest struct {
+	TimePeriod    ceTimePeriod           `json:"TimePeriod"`
+	Granularity   string                 `json:"Granularity"`
+	Metrics       []string               `json:"Metrics"`
+	GroupBy       []map[string]string    `json:"GroupBy"`
+	Filter        map[string]interface{} `json:"Filter,omitempty"`
+	NextPageToken string                 `json:"NextPageToken,omitempty"`
+}
+
+type ceTimePeriod struct {
+	Start string `json:"Start"`
+	End   string `json:"End"`
+}
+
+type ceResponse struct {
+	ResultsByTime []struct {
+		Groups []struct {
+			Keys    []string `json:"Keys"`
+			Metrics map[string]struct {
+				Amount string `json:"Amount"`
+				Unit   string `json:"Unit"`
+			} `json:"Metrics"`
+		} `json:"Groups"`
+	} `json:"ResultsByTime"`
+	NextPageToken string `json:"NextPageToken"`
+}
+
+// monthToDate returns the Cost Explorer period covering the current month. End is
+// exclusive, so on the first of the month the previous month is used instead.
+func monthToDate(now time.Time) ceTimePeriod {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if !end.After(start) {
+		start = start.AddDate(0, -1, 0)
+	}
+	return ceTimePeriod{Start: start.Format("2006-01-02"), End: end.Format("2006-01-02")}
+}
+
+// GetCloudCosts returns month-to-date cost per AWS service. The namespace filter becomes a
+// tag filter when AWS_CE_NAMESPACE_TAG is set, and a service-name match otherwise.
+func (s *AWSCostExplorerSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	req := ceRequest{
+		TimePeriod:  monthToDate(s.now()),
+		Granularity: "MONTHLY",
+		Metrics:     []string{s.Metric},
+		GroupBy:     []map[string]string{{"Type": "DIMENSION", "Key": "SERVICE"}},
+	}
+	var filters []map[string]interface{}
+	if s.AccountID != "" {
+		filters = append(filters, map[string]interface{}{
+			"Dimensions": map[string]interface{}{"Key": "LINKED_ACCOUNT", "Values": []string{s.AccountID}},
+		})
+	}
+	if f.Namespace != "" && s.NamespaceTag != "" {
+		filters = append(filters, map[string]interface{}{
+			"Tags": map[string]interface{}{"Key": s.NamespaceTag, "Values": []string{f.Namespace}},
+		})
+	}
+	switch len(filters) {
+	case 0:
+	case 1:
+		req.Filter = filters[0]
+	default:
+		req.Filter = map[string]interface{}{"And": filters}
+	}
+
+	totals := map[string]float64{}
+	for {
+		var resp ceResponse
+		if err := s.call(ctx, "GetCostAndUsage", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, period := range resp.ResultsByTime {
+			for _, g := range period.Groups {
+				if len(g.Keys) == 0 {
+					continue
+				}
+				amount, err := strconv.ParseFloat(g.Metrics[s.Metric].Amount, 64)
+				if err != nil {
+					continue
+				}
+				totals[g.Keys[0]] += amount
+			}
+		}
+		if resp.NextPageToken == "" {
+			break
+		}
+		req.NextPageToken = resp.NextPageToken
+	}
+
+	out := []CloudCost{}
+	for service, total := range totals {
+		if f.Namespace != "" && s.NamespaceTag == "" &&
+			!strings.Contains(strings.ToLower(service), strings.ToLower(f.Namespace)) {
+			continue
+		}
+		out = append(out, CloudCost{Name: service, TotalCost: round2(total)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TotalCost > out[j].TotalCost })
+	return out, nil
+}
+
+func (s *AWSCostExplorerSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	return nil, fmt.Errorf("AWS Cost Explorer has no allocation data: %w", errUnsupported)
+}
+
+func (s *AWSCostExplorerSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	return nil, fmt.Errorf("AWS Cost Explorer has no asset data: %w", errUnsupported)
+}
+
+// call invokes a Cost Explorer JSON-1.1 action.
+func (s *AWSCostExplorerSource) call(ctx context.Context, action string, in, out interface{}) error {
+	what := "aws " + action
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	if plannedBackendCall(ctx, what, http.MethodPost, s.Endpoint) {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "POST "+what, spanKindClient)
+	span.SetAttr("url.full", s.Endpoint)
+	started := time.Now()
+	err = s.do(ctx, action, body, out)
+	observeBackend(what, time.Since(started), err)
+	span.SetError(err)
+	span.End()
+	if err == nil {
+		noteFreshness(ctx, "aws", what, time.Now())
+	}
+	return err
+}
+
+func (s *AWSCostExplorerSource) do(ctx context.Context, action string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build Cost Explorer request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AWSInsightsIndexService."+action)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	signSigV4(req, body, s.AccessKeyID, s.SecretAccessKey, s.Region, "ce", s.now())
+	injectTraceparent(ctx, req)
+
+	resp, err := backendClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Cost Explorer: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Cost Explorer response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Cost Explorer error %d: %s", resp.StatusCode, string(raw))
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// signSigV4 adds an AWS Signature Version 4 Authorization header to req. Every header
+// already set on req (plus Host and X-Amz-Date) is signed.
+func signSigV4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	canonHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signed+", Signature="+signature)
+}
+
+// canonicalQuery sorts and strictly escapes query parameters as SigV4 requires.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Azure Cost Management source =====
+//
+// AzureCostSource queries the Cost Management Query API for month-to-date actual cost per
+// resource in each configured subscription, authenticating as a service principal with the
+// client-credentials flow. Results feed /cloudCosts (per Azure service) and /assets (per
+// resource, provider "Azure"). Combine with another source ("http,azure") to see Azure
+// subscriptions next to OpenCost data. Resource tags named in AZURE_TAG_KEYS become asset tags,
+// one extra query per key grouped by that tag.
+
+// AzureCostSource is the CostSource for COST_SOURCE=azure.
+type AzureCostSource struct {
+	TenantID      string
+	ClientID      string
+	ClientSecret  string
+	Subscriptions []string
+	AuthorityHost string // default https://login.microsoftonline.com
+	Endpoint      string // default https://management.azure.com
+	TagKeys       []string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+const azureCostAPIVersion = "2023-03-01"
+
+// newAzureCostSource reads AZURE_TENANT_ID, AZURE_CLIENT_ID, AZURE_CLIENT_SECRET,
+// AZURE_SUBSCRIPTION_IDS, AZURE_AUTHORITY_HOST, AZURE_MANAGEMENT_ENDPOINT and AZURE_TAG_KEYS.
+func newAzureCostSource() (*AzureCostSource, error) {
+	s := &AzureCostSource{
+		TenantID:      os.Getenv("AZURE_TENANT_ID"),
+		ClientID:      os.Getenv("AZURE_CLIENT_ID"),
+		ClientSecret:  os.Getenv("AZURE_CLIENT_SECRET"),
+		Subscriptions: splitList(os.Getenv("AZURE_SUBSCRIPTION_IDS")),
+		AuthorityHost: os.Getenv("AZURE_AUTHORITY_HOST"),
+		Endpoint:      os.Getenv("AZURE_MANAGEMENT_ENDPOINT"),
+		TagKeys:       splitList(os.Getenv("AZURE_TAG_KEYS")),
+	}
+	if s.TenantID == "" || s.ClientID == "" || s.ClientSecret == "" {
+		return nil, fmt.Errorf("COST_SOURCE=azure requires AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET")
+	}
+	if len(s.Subscriptions) == 0 {
+		return nil, fmt.Errorf("COST_SOURCE=azure requires AZURE_SUBSCRIPTION_IDS")
+	}
+	if s.AuthorityHost == "" {
+		s.AuthorityHost = "https://login.microsoftonline.com"
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = "https://management.azure.com"
+	}
+	s.AuthorityHost = strings.TrimSuffix(s.AuthorityHost, "/")
+	s.Endpoint = strings.TrimSuffix(s.Endpoint, "/")
+	return s, nil
+}
+
+// azureCostRow is one resource's month-to-date cost.
+type azureCostRow struct {
+	ResourceID string
+	Service    string
+	Location   string
+	Cost       float64
+	Currency   string
+	TagValue   string // queries grouped by a tag key only
+}
+
+// GetCloudCosts returns one CloudCost per Azure service across all subscriptions.
+func (s *AzureCostSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	rows, err := s.query(ctx)
+	if err != nil {
+		return nil, err
+	}
+	totals := map[string]float64{}
+	for _, row := range rows {
+		totals[row.Service] += row.Cost
+	}
+	out := []CloudCost{}
+	for service, total := range totals {
+		if f.Namespace != "" && !strings.Contains(strings.ToLower(service), strings.ToLower(f.Namespace)) {
+			continue
+		}
+		out = append(out, CloudCost{Name: service, TotalCost: round2(total)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TotalCost > out[j].TotalCost })
+	return out, nil
+}
+
+// GetAllocations is unsupported: Cost Management stops at the resource level.
+func (s *AzureCostSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	return nil, fmt.Errorf("Azure Cost Management has no allocation data: %w", errUnsupported)
+}
+
+// GetAssets returns one Asset per Azure resource.
+func (s *AzureCostSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	if f.Provider != "" && !strings.EqualFold(f.Provider, "Azure") {
+		return []Asset{}, nil
+	}
+	rows, err := s.query(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := s.tags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := []Asset{}
+	for _, row := range rows {
+		if f.Region != "" && !strings.EqualFold(row.Location, f.Region) {
+			continue
+		}
+		name := row.ResourceID
+		if i := strings.LastIndexByte(name, '/'); i >= 0 {
+			name = name[i+1:]
+		}
+		out = append(out, Asset{
+			AssetID:  row.ResourceID,
+			Name:     name,
+			Type:     azureAssetType(row.ResourceID),
+			Status:   "active",
+			Provider: "Azure",
+			Region:   row.Location,
+			Cost:     round2(row.Cost),
+			Currency: strings.ToUpper(row.Currency),
+			Tags:     tags[strings.ToLower(row.ResourceID)],
+		})
+	}
+	return out, nil
+}
+
+// azureAssetType maps the resource provider namespace in a resource ID to an asset type.
+func azureAssetType(resourceID string) string {
+	id := strings.ToLower(resourceID)
+	switch {
+	case strings.Contains(id, "/microsoft.compute/virtualmachines"), strings.Contains(id, "/microsoft.containerservice/"):
+		return "VM"
+	case strings.Contains(id, "/microsoft.compute/disks"):
+		return "Disk"
+	case strings.Contains(id, "/microsoft.storage/"):
+		return "Storage"
+	case strings.Contains(id, "/microsoft.sql/"), strings.Contains(id, "/microsoft.dbfor"), strings.Contains(id, "/microsoft.documentdb/"):
+		return "Database"
+	case strings.Contains(id, "/microsoft.network/loadbalancers"), strings.Contains(id, "/microsoft.network/applicationgateways"):
+		return "LoadBalancer"
+	case strings.Contains(id, "/microsoft.network/"):
+		return "Network"
+	default:
+		return "Service"
+	}
+}
+
+// query fetches month-to-date cost per resource for every subscription, following nextLink.
+func (s *AzureCostSource) query(ctx context.Context) ([]azureCostRow, error) {
+	return s.queryGrouped(ctx, []map[string]string{
+		{"type": "Dimension", "name": "ResourceId"},
+		{"type": "Dimension", "name": "ServiceName"},
+		{"type": "Dimension", "name": "ResourceLocation"},
+	})
+}
+
+// tags fetches the AZURE_TAG_KEYS tags of every resource, keyed by lowercased resource ID.
+func (s *AzureCostSource) tags(ctx context.Context) (map[string]map[string]string, error) {
+	out := map[string]map[string]string{}
+	for _, key := range s.TagKeys {
+		rows, err := s.queryGrouped(ctx, []map[string]string{
+			{"type": "Dimension", "name": "ResourceId"},
+			{"type": "TagKey", "name": key},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tag %s: %w", key, err)
+		}
+		for _, row := range rows {
+			if row.TagValue == "" {
+				continue
+			}
+			id := strings.ToLower(row.ResourceID)
+			if out[id] == nil {
+				out[id] = map[string]string{}
+			}
+			out[id][key] = row.TagValue
+		}
+	}
+	return out, nil
+}
+
+// queryGrouped fetches month-to-date cost grouped as given for every subscription,
+// following nextLink.
+func (s *AzureCostSource) queryGrouped(ctx context.Context, grouping []map[string]string) ([]azureCostRow, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"type":      "ActualCost",
+		"timeframe": "MonthToDate",
+		"dataset": map[string]interface{}{
+			"granularity": "None",
+			"aggregation": map[string]interface{}{"totalCost": map[string]string{"name": "Cost", "function": "Sum"}},
+			"grouping":    grouping,
+		},
+	})
+
+	var rows []azureCostRow
+	for _, sub := range s.Subscriptions {
+		next := s.Endpoint + "/subscriptions/" + url.PathEscape(sub) +
+			"/providers/Microsoft.CostManagement/query?api-version=" + azureCostAPIVersion
+		for next != "" {
+			var page azureQueryResult
+			if err := s.call(ctx, next, body, &page); err != nil {
+				return nil, fmt.Errorf("subscription %s: %w", sub, err)
+			}
+			rows = append(rows, page.rows()...)
+			next = page.Properties.NextLink
+		}
+	}
+	return rows, nil
+}
+
+// azureQueryResult is a Cost Management query response: columns plus positional rows.
+type azureQueryResult struct {
+	Properties struct {
+		NextLink string `json:"nextLink"`
+		Columns  []struct {
+			Name string `json:"name"`
+		} `json:"columns"`
+		Rows [][]interface{} `json:"rows"`
+	} `json:"properties"`
+}
+
+func (q azureQueryResult) rows() []azureCostRow {
+	col := map[string]int{}
+	for i, c := range q.Properties.Columns {
+		col[c.Name] = i
+	}
+	str := func(row []interface{}, name string) string {
+		if i, ok := col[name]; ok && i < len(row) {
+			v, _ := row[i].(string)
+			return v
+		}
+		return ""
+	}
+	var out []azureCostRow
+	for _, row := range q.Properties.Rows {
+		var cost float64
+		if i, ok := col["Cost"]; ok && i < len(row) {
+			cost, _ = row[i].(float64)
+		}
+		out = append(out, azureCostRow{
+			ResourceID: str(row, "ResourceId"),
+			Service:    str(row, "ServiceName"),
+			Location:   str(row, "ResourceLocation"),
+			Cost:       cost,
+			Currency:   str(row, "Currency"),
+			TagValue:   str(row, "TagValue"),
+		})
+	}
+	return out
+}
+
+// call POSTs a query with a bearer token and decodes the response.
+func (s *AzureCostSource) call(ctx context.Context, u string, body []byte, out interface{}) error {
+	const what = "azure cost query"
+	if plannedBackendCall(ctx, what, http.MethodPost, u) {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "POST "+what, spanKindClient)
+	span.SetAttr("url.full", u)
+	started := time.Now()
+	err := s.do(ctx, u, body, out)
+	observeBackend(what, time.Since(started), err)
+	span.SetError(err)
+	span.End()
+	if err == nil {
+		noteFreshness(ctx, "azure", what, time.Now())
+	}
+	return err
+}
+
+func (s *AzureCostSource) do(ctx context.Context, u string, body []byte, out interface{}) error {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build Cost Management request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set("x-ms-client-request-id", id)
+	}
+	injectTraceparent(ctx, req)
+
+	resp, err := backendClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Cost Management: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Cost Management response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Cost Management error %d: %s", resp.StatusCode, string(raw))
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// accessToken returns a cached management-plane token, refreshing it a minute before expiry.
+func (s *AzureCostSource) accessToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expires) {
+		return s.token, nil
+	}
+
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {s.ClientID},
+		"client_secret": {s.ClientSecret},
+		"scope":         {s.Endpoint + "/.default"},
+	}
+	tokenURL := s.AuthorityHost + "/" + url.PathEscape(s.TenantID) + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := backendClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("Azure token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", fmt.Errorf("Azure token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tok.AccessToken == "" {
+		return "", fmt.Errorf("Azure token request rejected (%d): %s", resp.StatusCode, tok.Error)
+	}
+	s.token = tok.AccessToken
+	s.expires = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return s.token, nil
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ===== Backfill =====
+//
+// POST /admin/backfill loads a historical range into the local store (see store.go), for
+// history from before the store was enabled. The range is pulled in chunks (default one day)
+// from oldest to newest, so one request never asks the backend for too much at once, and
+// GET /admin/backfill/{id} reports progress as chunks done out of total.
+//
+// Backfills are resumable: their state, including the start of the next chunk, is persisted
+// in backfills.json in the store directory after every chunk. A chunk that still fails after
+// backfillAttempts tries fails the backfill; POST /admin/backfill/{id}/resume continues a
+// failed or canceled one from that chunk, and backfills interrupted by a restart resume on
+// their own. DELETE /admin/backfill/{id} cancels a running one.
+
+// Backfill limits.
+const (
+	defaultBackfillChunk = 24 * time.Hour
+	maxBackfillChunks    = 10000
+	backfillAttempts     = 3
+)
+
+// BackfillRequest is the body of POST /admin/backfill.
+type BackfillRequest struct {
+	Start string `json:"start"`           // RFC3339
+	End   string `json:"end,omitempty"`   // RFC3339, default now
+	Chunk string `json:"chunk,omitempty"` // e.g. "6h", "1d" (default), "1w"
+}
+
+// Backfill is one historical ingestion. Next is where it continues when resumed.
+type Backfill struct {
+	ID         string      `json:"id"`
+	Status     string      `json:"status"` // running, succeeded, failed or canceled
+	Start      time.Time   `json:"start"`
+	End        time.Time   `json:"end"`
+	Chunk      string      `json:"chunk"`
+	Next       time.Time   `json:"next"`
+	Progress   JobProgress `json:"progress"`
+	Records    int         `json:"records"` // new or changed records stored so far
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// chunkSize is the parsed Chunk.
+func (b *Backfill) chunkSize() time.Duration {
+	d, err := parseLookback(b.Chunk)
+	if err != nil {
+		return defaultBackfillChunk
+	}
+	return d
+}
+
+// backfillStore holds backfills and persists them next to the stored data.
+type backfillStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]*Backfill
+}
+
+var backfills = &backfillStore{items: map[string]*Backfill{}}
+
+// load reads persisted backfills from the store directory. A missing file starts empty.
+func (s *backfillStore) load(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = filepath.Join(dir, "backfills.json")
+	raw, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read backfills: %w", err)
+	}
+	var list []*Backfill
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return fmt.Errorf("failed to parse backfills %s: %w", s.path, err)
+	}
+	for _, b := range list {
+		s.items[b.ID] = b
+	}
+	return nil
+}
+
+// saveLocked writes all backfills via a temp file and rename. Callers hold s.mu.
+func (s *backfillStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path+".tmp", raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+// listLocked returns copies of the backfills, newest first.
+func (s *backfillStore) listLocked() []Backfill {
+	list := make([]Backfill, 0, len(s.items))
+	for _, b := range s.items {
+		list = append(list, *b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// update runs fn on the backfill under the lock and persists the result.
+func (s *backfillStore) update(b *Backfill, fn func(*Backfill)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(b)
+	b.UpdatedAt = time.Now().UTC()
+	if err := s.saveLocked(); err != nil {
+		log.Printf("[MCP] Failed to persist backfills: %v\n", err)
+	}
+}
+
+// running reports whether some backfill is running, so only one loads at a time.
+func (s *backfillStore) running() *Backfill {
+	for _, b := range s.items {
+		if b.Status == jobRunning {
+			return b
+		}
+	}
+	return nil
+}
+
+// start marks b running and pulls its remaining chunks in the background.
+func (s *backfillStore) start(ctx context.Context, b *Backfill) {
+	ctx, cancel := context.WithCancel(ctx)
+	b.cancel, b.Status, b.Error, b.FinishedAt = cancel, jobRunning, "", nil
+	go s.run(ctx, b)
+}
+
+// run pulls chunk after chunk from b.Next until b.End, retrying each a few times.
+func (s *backfillStore) run(ctx context.Context, b *Backfill) {
+	s.mu.Lock()
+	next, end, chunk := b.Next, b.End, b.chunkSize()
+	s.mu.Unlock()
+	logf(ctx, "[MCP] Backfill %s pulling %s to %s in %s chunks\n", b.ID, next.Format(time.RFC3339), end.Format(time.RFC3339), b.Chunk)
+
+	for next.Before(end) {
+		chunkEnd := next.Add(chunk)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		s.update(b, func(b *Backfill) {
+			b.Progress.Current = next.Format(time.RFC3339) + "/" + chunkEnd.Format(time.RFC3339)
+		})
+		var n int
+		var err error
+		for attempt := 1; attempt <= backfillAttempts; attempt++ {
+			if ctx.Err() != nil {
+				s.finish(b, jobCanceled, "canceled at "+next.Format(time.RFC3339))
+				return
+			}
+			chunkCtx, cancel := context.WithTimeout(ctx, handlerTimeout)
+			n, err = store.ingest(chunkCtx, next, chunkEnd)
+			cancel()
+			if err == nil {
+				break
+			}
+			logf(ctx, "[MCP] Backfill %s chunk %s failed (attempt %d): %v\n", b.ID, next.Format(time.RFC3339), attempt, err)
+			if attempt < backfillAttempts {
+				select {
+				case <-ctx.Done():
+				case <-time.After(time.Duration(attempt) * time.Second):
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			s.finish(b, jobCanceled, "canceled at "+next.Format(time.RFC3339))
+			return
+		}
+		if err != nil {
+			s.finish(b, jobFailed, fmt.Sprintf("chunk starting %s: %v", next.Format(time.RFC3339), err))
+			return
+		}
+		next = chunkEnd
+		s.update(b, func(b *Backfill) {
+			b.Next = next
+			b.Records += n
+			b.Progress.Completed++
+			b.Progress.Percent = round2(100 * float64(b.Progress.Completed) / float64(b.Progress.Total))
+		})
+	}
+	s.finish(b, jobSucceeded, "")
+}
+
+// finish records the backfill's final status.
+func (s *backfillStore) finish(b *Backfill, status, msg string) {
+	now := time.Now().UTC()
+	records := 0
+	s.update(b, func(b *Backfill) {
+		b.Status, b.Error, b.FinishedAt = status, msg, &now
+		b.Progress.Current = ""
+		records = b.Records
+	})
+	log.Printf("[MCP] Backfill %s %s (%d records)\n", b.ID, status, records)
+}
+
+// resumeBackfills restarts backfills that were running when the server stopped.
+func resumeBackfills(ctx context.Context) {
+	backfills.mu.Lock()
+	defer backfills.mu.Unlock()
+	for _, b := range backfills.items {
+		if b.Status == jobRunning {
+			log.Printf("[MCP] Resuming backfill %s from %s\n", b.ID, b.Next.Format(time.RFC3339))
+			backfills.start(context.WithValue(ctx, requestIDKey{}, b.ID), b)
+		}
+	}
+}
+
+// ===== /admin/backfill API =====
+
+// createBackfillHandler handles POST /admin/backfill.
+func createBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "local store is disabled; set LOCAL_STORE_DIR to enable it", nil)
+		return
+	}
+	var req BackfillRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	now := time.Now().UTC()
+	if req.End == "" {
+		req.End = now.Format(time.RFC3339)
+	}
+	if req.Chunk == "" {
+		req.Chunk = "1d"
+	}
+
+	var verrs ValidationErrors
+	if req.Start == "" {
+		verrs.add("start", "", "is required")
+	}
+	validateWindow(&verrs, req.Start, req.End)
+	chunk, err := parseLookback(req.Chunk)
+	if err != nil {
+		verrs.add("chunk", req.Chunk, "must be a duration such as 6h, 1d or 1w")
+	}
+	start, _ := parseDate(req.Start)
+	end, _ := parseDate(req.End)
+	chunks := 0
+	if len(verrs) == 0 {
+		if !end.After(start) {
+			verrs.add("end", req.End, "must be after start")
+		} else if chunks = int((end.Sub(start) + chunk - 1) / chunk); chunks > maxBackfillChunks {
+			verrs.add("chunk", req.Chunk, fmt.Sprintf("makes %d chunks; at most %d are allowed", chunks, maxBackfillChunks))
+		}
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	b := &Backfill{
+		ID:        "backfill-" + newRequestID()[:12],
+		Start:     start.UTC(),
+		End:       end.UTC(),
+		Chunk:     req.Chunk,
+		Next:      start.UTC(),
+		Progress:  JobProgress{Total: chunks},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	backfills.mu.Lock()
+	if other := backfills.running(); other != nil {
+		backfills.mu.Unlock()
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "backfill "+other.ID+" is already running", nil)
+		return
+	}
+	backfills.items[b.ID] = b
+	backfills.start(context.WithoutCancel(r.Context()), b)
+	view := *b
+	backfills.mu.Unlock()
+
+	logf(r.Context(), "[MCP] Backfill %s started: %d chunks of %s\n", b.ID, chunks, req.Chunk)
+	w.Header().Set("Location", "/admin/backfill/"+b.ID)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": view,
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// listBackfillsHandler handles GET /admin/backfill, newest first.
+func listBackfillsHandler(w http.ResponseWriter, r *http.Request) {
+	backfills.mu.Lock()
+	list := backfills.listLocked()
+	backfills.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": list,
+		"meta": map[string]interface{}{"total": len(list), "request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// getBackfillHandler handles GET /admin/backfill/{id}.
+func getBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	backfills.mu.Lock()
+	b, ok := backfills.items[r.PathValue("id")]
+	var view Backfill
+	if ok {
+		view = *b
+	}
+	backfills.mu.Unlock()
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such backfill: "+r.PathValue("id"), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": view,
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// resumeBackfillHandler handles POST /admin/backfill/{id}/resume for failed or canceled
+// backfills, continuing from the first chunk not yet stored.
+func resumeBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	backfills.mu.Lock()
+	b, ok := backfills.items[r.PathValue("id")]
+	if !ok {
+		backfills.mu.Unlock()
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such backfill: "+r.PathValue("id"), nil)
+		return
+	}
+	if b.Status != jobFailed && b.Status != jobCanceled {
+		status := b.Status
+		backfills.mu.Unlock()
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "backfill "+b.ID+" is "+status+"; only failed or canceled backfills resume", nil)
+		return
+	}
+	if other := backfills.running(); other != nil {
+		backfills.mu.Unlock()
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "backfill "+other.ID+" is already running", nil)
+		return
+	}
+	backfills.start(context.WithoutCancel(r.Context()), b)
+	view := *b
+	backfills.mu.Unlock()
+
+	logf(r.Context(), "[MCP] Backfill %s resumed from %s\n", b.ID, b.Next.Format(time.RFC3339))
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": view,
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// cancelBackfillHandler handles DELETE /admin/backfill/{id}. Only running backfills cancel;
+// what they stored so far stays.
+func cancelBackfillHandler(w http.ResponseWriter, r *http.Request) {
+	backfills.mu.Lock()
+	b, ok := backfills.items[r.PathValue("id")]
+	var status string
+	var cancel context.CancelFunc
+	if ok {
+		status, cancel = b.Status, b.cancel
+	}
+	backfills.mu.Unlock()
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such backfill: "+r.PathValue("id"), nil)
+		return
+	}
+	if status != jobRunning || cancel == nil {
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "backfill "+b.ID+" already "+status, nil)
+		return
+	}
+	cancel()
+	logf(r.Context(), "[MCP] Backfill %s cancel requested\n", b.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// ===== Batch queries =====
+//
+// POST /batch takes a JSON array of AgenticQuery objects, each with an optional "endpoint"
+// (otherwise routed from its query text like /query), and runs them concurrently on at most
+// BATCH_WORKERS goroutines (default 4). The response lists one result per query, in request
+// order, with the index, endpoint, status and that endpoint's response, so an agent composing
+// a multi-part answer needs one round trip. One failing query doesn't fail the batch.
+
+// Batch limits, overridable with BATCH_WORKERS and BATCH_MAX_QUERIES.
+var (
+	batchWorkers    = 4
+	batchMaxQueries = 50
+)
+
+// BatchQuery is one element of a /batch body.
+type BatchQuery struct {
+	AgenticQuery
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// BatchResult is the outcome of one query of a batch.
+type BatchResult struct {
+	Index    int             `json:"index"`
+	Endpoint string          `json:"endpoint"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// loadBatchConfig applies BATCH_WORKERS and BATCH_MAX_QUERIES.
+func loadBatchConfig() error {
+	for name, dst := range map[string]*int{"BATCH_WORKERS": &batchWorkers, "BATCH_MAX_QUERIES": &batchMaxQueries} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%s must be a positive integer, got %q", name, v)
+		}
+		*dst = n
+	}
+	return nil
+}
+
+// batchHandler handles POST /batch.
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	var queries []BatchQuery
+	if !decodeJSON(w, r, &queries) {
+		return
+	}
+	var verrs ValidationErrors
+	switch {
+	case len(queries) == 0:
+		verrs.add("queries", "", "must contain at least one query")
+	case len(queries) > batchMaxQueries:
+		verrs.add("queries", strconv.Itoa(len(queries)), fmt.Sprintf("at most %d queries per batch", batchMaxQueries))
+	}
+	for i := range queries {
+		q := &queries[i]
+		q.Endpoint = resolveEndpoint(&verrs, fmt.Sprintf("[%d].endpoint", i), q.Endpoint, &q.AgenticQuery)
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	results := make([]BatchResult, len(queries))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(batchWorkers, len(queries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				rec := httptest.NewRecorder()
+				executeQuery(r.Context(), rec, queries[i].Endpoint, queries[i].AgenticQuery)
+				results[i] = BatchResult{Index: i, Endpoint: queries[i].Endpoint, Status: rec.Code, Response: json.RawMessage(rec.Body.Bytes())}
+			}
+		}()
+	}
+	for i := range queries {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	failed, partial := 0, 0
+	for _, res := range results {
+		switch res.Status {
+		case http.StatusOK:
+		case http.StatusMultiStatus:
+			partial++
+		default:
+			failed++
+		}
+	}
+	logf(r.Context(), "[MCP] /batch — %d queries, %d failed, %d partial\n", len(queries), failed, partial)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": results,
+		"meta": map[string]interface{}{
+			"total":      len(results),
+			"succeeded":  len(results) - failed,
+			"failed":     failed,
+			"partial":    partial,
+			"workers":    min(batchWorkers, len(queries)),
+			"request_id": requestIDFrom(r.Context()),
+		},
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Benchmarks for the per-record filter and aggregation paths, over a synthetic data set of
+// benchAllocationCount allocations. Run with:
+//
+//	go test -run '^$' -bench . -benchmem
+
+const benchAllocationCount = 10000
+
+var benchStart = time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+
+// benchAllocations returns n allocations over 20 namespaces, 5 teams and 30 days.
+func benchAllocations(n int) []Allocation {
+	allocs := make([]Allocation, n)
+	for i := range allocs {
+		from := benchStart.Add(time.Duration(i%720) * time.Hour)
+		allocs[i] = Allocation{
+			Namespace:   fmt.Sprintf("team-%d", i%20),
+			ResourceID:  fmt.Sprintf("pod-%d", i),
+			CPUCost:     float64(i%97) / 10,
+			MemoryCost:  float64(i%53) / 10,
+			NetworkCost: float64(i%7) / 10,
+			TotalCost:   float64(i%97)/10 + float64(i%53)/10 + float64(i%7)/10,
+			StartTime:   from.Format(time.RFC3339),
+			EndTime:     from.Add(6 * time.Hour).Format(time.RFC3339),
+			Labels:      map[string]string{"team": fmt.Sprintf("t%d", i%5), "cluster": "c1"},
+		}
+	}
+	return allocs
+}
+
+func BenchmarkExprFilter(b *testing.B) {
+	allocs := benchAllocations(benchAllocationCount)
+	expr, err := parseFilterExpr(`namespace IN (team-1,team-2,team-3) AND totalCost>5 OR labels.team ~ "^t[34]$"`, Allocation{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for b.Loop() {
+		for _, a := range allocs {
+			expr.matches(a)
+		}
+	}
+}
+
+func BenchmarkNamespaceFilter(b *testing.B) {
+	allocs := benchAllocations(benchAllocationCount)
+	var verrs ValidationErrors
+	f := parseNamespaceFilter(&verrs, "namespace", "team-1,team-2,!team-3,/^team-1[0-9]$/")
+	if len(verrs) > 0 {
+		b.Fatal(verrs)
+	}
+	for b.Loop() {
+		for _, a := range allocs {
+			f.matches(a.Namespace)
+		}
+	}
+}
+
+func BenchmarkGroupAllocations(b *testing.B) {
+	allocs := benchAllocations(benchAllocationCount)
+	ctx := context.Background()
+	for b.Loop() {
+		if _, err := groupAllocations(ctx, allocs, []string{"namespace", "label:team", "cluster"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildTimeSeries(b *testing.B) {
+	allocs := benchAllocations(benchAllocationCount)
+	end := benchStart.Add(31 * 24 * time.Hour)
+	for _, resolution := range []string{"day", "hour"} {
+		b.Run(resolution, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := buildTimeSeries(allocs, resolution, benchStart, end, time.UTC); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDedupAllocations(b *testing.B) {
+	allocs := benchAllocations(benchAllocationCount)
+	allocs = append(allocs, allocs[:benchAllocationCount/2]...)
+	for b.Loop() {
+		dedupAllocations(allocs, "max")
+	}
+}
+
+// BenchmarkDecodeAllocations compares reading a backend response whole with decoding it as a
+// stream (see stream.go).
+func BenchmarkDecodeAllocations(b *testing.B) {
+	body, err := json.Marshal(benchAllocations(benchAllocationCount))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("unmarshal", func(b *testing.B) {
+		b.SetBytes(int64(len(body)))
+		for b.Loop() {
+			var out []Allocation
+			if err := json.Unmarshal(body, &out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.SetBytes(int64(len(body)))
+		for b.Loop() {
+			if _, err := decodeRecords[Allocation](bytes.NewReader(body), "allocations", nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream-filtered", func(b *testing.B) {
+		matches := AllocationFilter{Namespace: "team-1"}.matcher()
+		b.SetBytes(int64(len(body)))
+		for b.Loop() {
+			if _, err := decodeRecords(bytes.NewReader(body), "allocations", matches); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+// ===== Response budgets =====
+//
+// Agents have a limited context. max_tokens or max_bytes asks the server to keep the encoded
+// response under a size: the cheapest records are dropped until it fits, and meta.budget says
+// how many were dropped and what they cost, so totals can still be reported exactly.
+
+// bytesPerToken is the rough JSON-bytes-per-token ratio used to turn max_tokens into bytes.
+const bytesPerToken = 4
+
+// ResponseBudget is the size hint of an AgenticQuery; zero means unlimited.
+type ResponseBudget struct {
+	MaxTokens int `json:"max_tokens,omitempty"`
+	MaxBytes  int `json:"max_bytes,omitempty"`
+}
+
+// BudgetReport is meta.budget on a response that had a budget.
+type BudgetReport struct {
+	MaxBytes    int     `json:"max_bytes"`
+	Records     int     `json:"records"`
+	Kept        int     `json:"kept"`
+	Dropped     int     `json:"dropped"`
+	DroppedCost float64 `json:"dropped_cost"` // total cost of the dropped records
+	Fits        bool    `json:"fits"`         // false when even zero records exceed the budget
+}
+
+// budgetFromQuery reads max_tokens and max_bytes from GET params.
+func budgetFromQuery(errs *ValidationErrors, q url.Values) ResponseBudget {
+	var b ResponseBudget
+	for name, dst := range map[string]*int{"max_tokens": &b.MaxTokens, "max_bytes": &b.MaxBytes} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs.add(name, v, "must be an integer")
+			continue
+		}
+		*dst = n
+	}
+	return b
+}
+
+func (b ResponseBudget) validate(errs *ValidationErrors) {
+	if b.MaxTokens < 0 {
+		errs.add("max_tokens", strconv.Itoa(b.MaxTokens), "must not be negative")
+	}
+	if b.MaxBytes < 0 {
+		errs.add("max_bytes", strconv.Itoa(b.MaxBytes), "must not be negative")
+	}
+}
+
+// limit returns the budget in bytes, the tighter of the two hints, or 0 for none.
+func (b ResponseBudget) limit() int {
+	n := b.MaxBytes
+	if t := b.MaxTokens * bytesPerToken; t > 0 && (n == 0 || t < n) {
+		n = t
+	}
+	return n
+}
+
+// applyBudget trims resp["data"] to fit the budget, recording what happened in meta.budget.
+// Responses without a budget or without record data are left alone.
+func applyBudget(resp map[string]interface{}, b ResponseBudget) {
+	limit := b.limit()
+	if limit == 0 {
+		return
+	}
+	switch data := resp["data"].(type) {
+	case []Allocation:
+		fitRecords(resp, data, func(a Allocation) float64 { return a.TotalCost }, limit)
+	case []UnitCostAllocation:
+		fitRecords(resp, data, func(a UnitCostAllocation) float64 { return a.TotalCost }, limit)
+	case []CarbonAllocation:
+		fitRecords(resp, data, func(a CarbonAllocation) float64 { return a.TotalCost }, limit)
+	case []EnrichedAllocation:
+		fitRecords(resp, data, func(a EnrichedAllocation) float64 { return a.TotalCost }, limit)
+	case []NamespaceSeries:
+		fitRecords(resp, data, func(s NamespaceSeries) float64 { return s.TotalCost }, limit)
+	case []CloudCost:
+		fitRecords(resp, data, func(c CloudCost) float64 { return c.TotalCost }, limit)
+	case []Asset:
+		fitRecords(resp, data, func(a Asset) float64 { return a.Cost }, limit)
+	}
+}
+
+// fitRecords keeps the most expensive records that fit in limit bytes, in their original
+// order, searching for the largest count that fits.
+func fitRecords[T any](resp map[string]interface{}, records []T, cost func(T) float64, limit int) {
+	byCost := make([]int, len(records))
+	for i := range byCost {
+		byCost[i] = i
+	}
+	sort.SliceStable(byCost, func(i, j int) bool { return cost(records[byCost[i]]) > cost(records[byCost[j]]) })
+
+	meta, _ := resp["meta"].(map[string]interface{})
+	if meta == nil {
+		meta = map[string]interface{}{}
+		resp["meta"] = meta
+	}
+	// try sets the response to the top k records and reports whether it fits
+	try := func(k int) bool {
+		keep := make([]bool, len(records))
+		var droppedCost float64
+		for rank, i := range byCost {
+			if rank < k {
+				keep[i] = true
+			} else {
+				droppedCost += cost(records[i])
+			}
+		}
+		kept := make([]T, 0, k)
+		for i, r := range records {
+			if keep[i] {
+				kept = append(kept, r)
+			}
+		}
+		report := BudgetReport{MaxBytes: limit, Records: len(records), Kept: k, Dropped: len(records) - k, DroppedCost: round2(droppedCost), Fits: true}
+		resp["data"] = kept
+		meta["budget"] = &report
+		raw, _ := json.Marshal(resp)
+		report.Fits = len(raw) <= limit
+		return report.Fits
+	}
+
+	if try(len(records)) {
+		return
+	}
+	// Largest k in [0, len) that fits; try(k) is monotonic in k
+	k := sort.Search(len(records), func(k int) bool { return !try(k) }) - 1
+	if k < 0 {
+		k = 0
+	}
+	try(k)
+}
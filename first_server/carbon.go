@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===== Carbon estimates =====
+//
+// An estimate of the energy and emissions behind allocations, for sustainability reporting.
+// include_carbon=true on /allocations attaches a carbon estimate to every record and adds
+// meta.carbon; GET /carbon summarizes a window per namespace and per region.
+//
+// Energy comes from usage: CPU core-hours, memory GB-hours and GPU-hours times typical
+// average power draw, times the data centre's PUE. Emissions are energy times the carbon
+// intensity of the region of the allocation's node (its first VM/node asset), or of
+// defaultIntensityRegion when that isn't known. Allocations without usage data get no
+// estimate and are counted in without_usage. These are estimates in the style of Cloud
+// Carbon Footprint, not measurements.
+//
+// CARBON_INTENSITY_FILE overrides or extends the intensity table (gCO2e per kWh by region):
+//
+//	{"us-west-2": 120, "europe-north1": 40, "default": 450}
+
+// Average power draw assumed per unit of usage, and the power usage effectiveness.
+const (
+	cpuWattsPerCore  = 2.1   // midpoint of 0.74 W idle and 3.5 W at full load per vCPU
+	memoryWattsPerGB = 0.392 // per GB of memory
+	gpuWatts         = 200.0 // per GPU
+	dataCentrePUE    = 1.135
+)
+
+// defaultIntensityRegion is the key of the fallback intensity, a global grid average.
+const defaultIntensityRegion = "default"
+
+// carbonIntensity is grams of CO2e per kWh by cloud region: approximate annual grid averages.
+var carbonIntensity = map[string]float64{
+	defaultIntensityRegion: 475,
+	// AWS
+	"us-east-1": 380, "us-east-2": 410, "us-west-1": 190, "us-west-2": 140, "ca-central-1": 30,
+	"eu-west-1": 280, "eu-central-1": 340, "eu-north-1": 10, "ap-south-1": 710, "ap-northeast-1": 470,
+	"ap-southeast-2": 600,
+	// GCP
+	"us-central1": 430, "us-east1": 380, "us-west1": 140, "europe-west1": 170, "europe-north1": 80,
+	"asia-south1": 710,
+	// Azure
+	"eastus": 380, "westus": 190, "westeurope": 330, "northeurope": 280, "centralindia": 710,
+}
+
+// loadCarbonIntensity merges a JSON intensity table into the built-in one. An empty path keeps
+// the built-in table.
+func loadCarbonIntensity(path string) error {
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read carbon intensity: %w", err)
+	}
+	var table map[string]float64
+	if err := json.Unmarshal(raw, &table); err != nil {
+		return fmt.Errorf("failed to parse carbon intensity %s: %w", path, err)
+	}
+	for region, v := range table {
+		if v < 0 {
+			return fmt.Errorf("carbon intensity of %s must not be negative", region)
+		}
+		carbonIntensity[strings.ToLower(region)] = v
+	}
+	log.Printf("[MCP] Loaded carbon intensity for %d regions from %s\n", len(table), path)
+	return nil
+}
+
+// CarbonEstimate is the energy and emissions of one allocation.
+type CarbonEstimate struct {
+	Region    string  `json:"region"`    // "default" when the node's region is unknown
+	Intensity float64 `json:"intensity"` // gCO2e per kWh
+	EnergyKWh float64 `json:"energy_kwh"`
+	CO2eKg    float64 `json:"co2e_kg"`
+}
+
+// CarbonAllocation is an allocation with its carbon estimate, null without usage data.
+type CarbonAllocation struct {
+	Allocation
+	Carbon *CarbonEstimate `json:"carbon"`
+}
+
+// CarbonTotals sums the estimates of a group of allocations.
+type CarbonTotals struct {
+	Allocations  int      `json:"allocations"`
+	WithoutUsage int      `json:"without_usage"`
+	EnergyKWh    float64  `json:"energy_kwh"`
+	CO2eKg       float64  `json:"co2e_kg"`
+	Cost         float64  `json:"cost"`
+	KgPerDollar  *float64 `json:"co2e_kg_per_dollar"`
+}
+
+func (t *CarbonTotals) add(a Allocation, e *CarbonEstimate) {
+	t.Allocations++
+	t.Cost += a.TotalCost
+	if e == nil {
+		t.WithoutUsage++
+		return
+	}
+	t.EnergyKWh += e.EnergyKWh
+	t.CO2eKg += e.CO2eKg
+}
+
+func (t *CarbonTotals) finish() {
+	if t.Cost > 0 && t.Allocations > t.WithoutUsage {
+		v := math.Round(t.CO2eKg/t.Cost*10000) / 10000
+		t.KgPerDollar = &v
+	}
+	t.EnergyKWh, t.CO2eKg, t.Cost = round3(t.EnergyKWh), round3(t.CO2eKg), round2(t.Cost)
+}
+
+// carbonAssumptions documents the model in responses.
+var carbonAssumptions = map[string]float64{
+	"cpu_watts_per_core":  cpuWattsPerCore,
+	"memory_watts_per_gb": memoryWattsPerGB,
+	"gpu_watts":           gpuWatts,
+	"pue":                 dataCentrePUE,
+}
+
+// carbonEstimator estimates allocations against the regions of their node assets.
+type carbonEstimator struct {
+	regions map[string]string // asset ID to region, for VM/node assets
+}
+
+// newCarbonEstimator loads the assets allocations are placed by.
+func newCarbonEstimator(ctx context.Context) (*carbonEstimator, error) {
+	assets, err := costSource.GetAssets(ctx, AssetFilter{})
+	if err != nil {
+		return nil, err
+	}
+	e := &carbonEstimator{regions: map[string]string{}}
+	for _, a := range assets {
+		if isNodeAsset(a) && a.Region != "" {
+			e.regions[a.AssetID] = strings.ToLower(a.Region)
+		}
+	}
+	return e, nil
+}
+
+// estimate returns a's energy and emissions, or nil without usage data.
+func (e *carbonEstimator) estimate(a Allocation) *CarbonEstimate {
+	if a.CPUCoreHours == 0 && a.RAMGBHours == 0 && a.GPUHours == 0 {
+		return nil
+	}
+	region := defaultIntensityRegion
+	for _, id := range a.AssetIDs {
+		if r, ok := e.regions[id]; ok {
+			if _, known := carbonIntensity[r]; known {
+				region = r
+			}
+			break
+		}
+	}
+	intensity := carbonIntensity[region]
+	kwh := (a.CPUCoreHours*cpuWattsPerCore + a.RAMGBHours*memoryWattsPerGB + a.GPUHours*gpuWatts) / 1000 * dataCentrePUE
+	return &CarbonEstimate{
+		Region:    region,
+		Intensity: intensity,
+		EnergyKWh: round3(kwh),
+		CO2eKg:    round3(kwh * intensity / 1000),
+	}
+}
+
+// round3 rounds kWh to the watt-hour and kg to the gram.
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// withCarbon attaches each allocation's estimate and returns the totals for meta.carbon.
+func (e *carbonEstimator) withCarbon(allocs []Allocation) ([]CarbonAllocation, CarbonTotals) {
+	out := make([]CarbonAllocation, len(allocs))
+	var total CarbonTotals
+	for i, a := range allocs {
+		est := e.estimate(a)
+		out[i] = CarbonAllocation{Allocation: a, Carbon: est}
+		total.add(a, est)
+	}
+	total.finish()
+	return out, total
+}
+
+// CarbonGroup is one namespace or region of a /carbon summary.
+type CarbonGroup struct {
+	Name string `json:"name"`
+	CarbonTotals
+}
+
+// CarbonReport is the data of a /carbon response.
+type CarbonReport struct {
+	Total       CarbonTotals  `json:"total"`
+	ByNamespace []CarbonGroup `json:"by_namespace"`
+	ByRegion    []CarbonGroup `json:"by_region"` // allocations without usage are left out
+}
+
+// carbonGroups sorts groups by emissions, largest first.
+func carbonGroups(groups map[string]*CarbonTotals) []CarbonGroup {
+	out := make([]CarbonGroup, 0, len(groups))
+	for name, t := range groups {
+		t.finish()
+		out = append(out, CarbonGroup{Name: name, CarbonTotals: *t})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CO2eKg != out[j].CO2eKg {
+			return out[i].CO2eKg > out[j].CO2eKg
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// carbonHandler handles GET /carbon.
+// Query params: namespace, window (default 7d) or start/end, timezone.
+func carbonHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /carbon request received")
+
+	namespace := resolveAliases(r.Context(), "namespace", r.URL.Query().Get("namespace"))
+	start := r.URL.Query().Get("start")
+	end := r.URL.Query().Get("end")
+	window := r.URL.Query().Get("window")
+	if window == "" && start == "" && end == "" {
+		window = "7d"
+	}
+
+	var verrs ValidationErrors
+	nsFilter := parseNamespaceFilter(&verrs, "namespace", namespace).withDefaultExclusions()
+	loc := loadTimezone(&verrs, "timezone", r.URL.Query().Get("timezone"))
+	resolved := applyWindow(&verrs, window, "", &start, &end, time.Now(), loc)
+	validateWindow(&verrs, start, end)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, nsFilter, "") {
+		return
+	}
+
+	data, err := costSource.GetAllocations(r.Context(), AllocationFilter{Namespace: nsFilter.pushdown(), Start: start, End: end})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations", err)
+		return
+	}
+	warnUnknownNamespaces(r.Context(), nsFilter)
+	estimator, err := newCarbonEstimator(r.Context())
+	if err != nil {
+		writeBackendError(w, r, "Failed to get assets for carbon regions", err)
+		return
+	}
+
+	startTime, _ := parseDate(start)
+	endTime, _ := parseDate(end)
+	report := CarbonReport{}
+	byNS := map[string]*CarbonTotals{}
+	byRegion := map[string]*CarbonTotals{}
+	for _, a := range data {
+		if !nsFilter.matches(a.Namespace) || !inWindow(a, startTime, endTime) {
+			continue
+		}
+		est := estimator.estimate(a)
+		report.Total.add(a, est)
+		if byNS[a.Namespace] == nil {
+			byNS[a.Namespace] = &CarbonTotals{}
+		}
+		byNS[a.Namespace].add(a, est)
+		if est != nil {
+			if byRegion[est.Region] == nil {
+				byRegion[est.Region] = &CarbonTotals{}
+			}
+			byRegion[est.Region].add(a, est)
+		}
+	}
+	report.Total.finish()
+	report.ByNamespace, report.ByRegion = carbonGroups(byNS), carbonGroups(byRegion)
+	logf(r.Context(), "[MCP] /carbon — %d allocations, %.2f kg CO2e\n", report.Total.Allocations, report.Total.CO2eKg)
+
+	meta := map[string]interface{}{
+		"filtersUsed": map[string]string{"namespace": namespace, "start": start, "end": end},
+		"assumptions": carbonAssumptions,
+		"timezone":    loc.String(),
+		"total":       report.Total.Allocations,
+		"request_id":  requestIDFrom(r.Context()),
+	}
+	if resolved != nil {
+		meta["window"] = resolved
+	}
+	noteDefaultExclusions(meta, nsFilter)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": report, "meta": meta})
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===== Entity catalog =====
+//
+// The catalog endpoints list the filter values present in the backend data, so an agent (or
+// the CLI's completion) can offer real values instead of guessing:
+//
+//	GET /namespaces  namespaces with allocations in the window
+//	GET /labels      allocation label keys, each with its values; key=team lists one key
+//	GET /providers   providers of the cloud assets
+//	GET /regions     regions of the cloud assets, per provider; provider narrows them
+//
+// Each entry has the number of records and their total cost. /namespaces and /labels take
+// window (default 7d), start, end and timezone. Namespaces in DEFAULT_EXCLUDED_NAMESPACES are
+// listed too, flagged excluded_by_default. Tenants only see their own values.
+
+// defaultCatalogWindow is the allocation window the catalog lists when none is given.
+const defaultCatalogWindow = "7d"
+
+// CatalogEntry is one value in a catalog response.
+type CatalogEntry struct {
+	Name              string  `json:"name"`
+	Provider          string  `json:"provider,omitempty"` // regions only
+	Count             int     `json:"count"`
+	TotalCost         float64 `json:"total_cost"`
+	ExcludedByDefault bool    `json:"excluded_by_default,omitempty"`
+}
+
+// LabelEntry is one label key in a /labels response.
+type LabelEntry struct {
+	Key    string         `json:"key"`
+	Count  int            `json:"count"`
+	Values []CatalogEntry `json:"values"`
+}
+
+// catalogCounter tallies records per value.
+type catalogCounter map[[2]string]*CatalogEntry
+
+func (c catalogCounter) add(provider, name string, cost float64) {
+	if name == "" {
+		return
+	}
+	e := c[[2]string{provider, name}]
+	if e == nil {
+		e = &CatalogEntry{Name: name, Provider: provider}
+		c[[2]string{provider, name}] = e
+	}
+	e.Count++
+	e.TotalCost += cost
+}
+
+// entries returns the tallies ordered by name (and provider).
+func (c catalogCounter) entries() []CatalogEntry {
+	out := make([]CatalogEntry, 0, len(c))
+	for _, e := range c {
+		e.TotalCost = round2(e.TotalCost)
+		out = append(out, *e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Provider < out[j].Provider
+	})
+	return out
+}
+
+// catalogAllocations reads the allocations of the window in the request, writing the error
+// response itself when it fails.
+func catalogAllocations(w http.ResponseWriter, r *http.Request) ([]Allocation, *ResolvedWindow, bool) {
+	q := r.URL.Query()
+	start, end, window := q.Get("start"), q.Get("end"), q.Get("window")
+	if window == "" && start == "" && end == "" {
+		window = defaultCatalogWindow
+	}
+	var verrs ValidationErrors
+	loc := loadTimezone(&verrs, "timezone", q.Get("timezone"))
+	resolved := applyWindow(&verrs, window, "", &start, &end, time.Now(), loc)
+	validateWindow(&verrs, start, end)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return nil, nil, false
+	}
+	data, err := costSource.GetAllocations(r.Context(), AllocationFilter{Start: start, End: end})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations", err)
+		return nil, nil, false
+	}
+	startTime, _ := parseDate(start)
+	endTime, _ := parseDate(end)
+	inRange := []Allocation{}
+	for _, a := range data {
+		if inWindow(a, startTime, endTime) {
+			inRange = append(inRange, a)
+		}
+	}
+	return inRange, resolved, true
+}
+
+// writeCatalog writes a catalog response.
+func writeCatalog(w http.ResponseWriter, r *http.Request, data interface{}, total int, window *ResolvedWindow) {
+	meta := map[string]interface{}{"total": total, "request_id": requestIDFrom(r.Context())}
+	if window != nil {
+		meta["window"] = window
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": data, "meta": meta})
+}
+
+// namespacesCatalogHandler handles GET /namespaces.
+func namespacesCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	allocs, window, ok := catalogAllocations(w, r)
+	if !ok {
+		return
+	}
+	counts := catalogCounter{}
+	for _, a := range allocs {
+		counts.add("", a.Namespace, a.TotalCost)
+	}
+	entries := counts.entries()
+	defaults := namespaceFilter{defaults: defaultExclusions}
+	for i := range entries {
+		entries[i].ExcludedByDefault = !defaults.matches(entries[i].Name)
+	}
+	logf(r.Context(), "[MCP] /namespaces — %d namespaces\n", len(entries))
+	writeCatalog(w, r, entries, len(entries), window)
+}
+
+// labelsCatalogHandler handles GET /labels.
+func labelsCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	allocs, window, ok := catalogAllocations(w, r)
+	if !ok {
+		return
+	}
+	only := r.URL.Query().Get("key")
+	byKey := map[string]catalogCounter{}
+	keyCounts := map[string]int{}
+	for _, a := range allocs {
+		for k, v := range a.Labels {
+			if only != "" && k != only {
+				continue
+			}
+			if byKey[k] == nil {
+				byKey[k] = catalogCounter{}
+			}
+			byKey[k].add("", v, a.TotalCost)
+			keyCounts[k]++
+		}
+	}
+	entries := make([]LabelEntry, 0, len(byKey))
+	for k, values := range byKey {
+		entries = append(entries, LabelEntry{Key: k, Count: keyCounts[k], Values: values.entries()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	logf(r.Context(), "[MCP] /labels — %d keys\n", len(entries))
+	writeCatalog(w, r, entries, len(entries), window)
+}
+
+// providersCatalogHandler handles GET /providers.
+func providersCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	assets, err := costSource.GetAssets(r.Context(), AssetFilter{})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get assets", err)
+		return
+	}
+	counts := catalogCounter{}
+	for _, a := range assets {
+		counts.add("", a.Provider, a.Cost)
+	}
+	entries := counts.entries()
+	logf(r.Context(), "[MCP] /providers — %d providers\n", len(entries))
+	writeCatalog(w, r, entries, len(entries), nil)
+}
+
+// regionsCatalogHandler handles GET /regions.
+func regionsCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	provider := resolveAliases(r.Context(), "provider", r.URL.Query().Get("provider"))
+	var verrs ValidationErrors
+	validateProvider(&verrs, provider)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, namespaceFilter{}, provider) {
+		return
+	}
+	assets, err := costSource.GetAssets(r.Context(), AssetFilter{Provider: provider})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get assets", err)
+		return
+	}
+	counts := catalogCounter{}
+	for _, a := range assets {
+		if provider == "" || strings.EqualFold(a.Provider, provider) {
+			counts.add(a.Provider, a.Region, a.Cost)
+		}
+	}
+	entries := counts.entries()
+	logf(r.Context(), "[MCP] /regions — %d regions\n", len(entries))
+	writeCatalog(w, r, entries, len(entries), nil)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Cloud credentials =====
+//
+// Object storage writes (see objectstore.go) authenticate the way the cloud SDKs do, without
+// the SDKs:
+//
+//   - AWS: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY (plus AWS_SESSION_TOKEN), or, on EKS
+//     with IAM roles for service accounts, AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE
+//     exchanged for temporary keys with STS AssumeRoleWithWebIdentity.
+//   - GCP: the service account key in GOOGLE_APPLICATION_CREDENTIALS, exchanged for an access
+//     token with a signed JWT, or else the metadata server (GKE Workload Identity, GCE), at
+//     GCE_METADATA_HOST if set.
+//
+// Temporary credentials are cached until five minutes before they expire.
+
+// credentialRefreshMargin is how long before expiry cached credentials are renewed.
+const credentialRefreshMargin = 5 * time.Minute
+
+// awsCredentials are static keys, or temporary ones from STS when Expiration is set.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// awsCredentialSource resolves AWS credentials from the environment.
+type awsCredentialSource struct {
+	mu     sync.Mutex
+	cached awsCredentials
+}
+
+var awsCreds = &awsCredentialSource{}
+
+// awsCredentialsConfigured reports whether static keys or IRSA are set up.
+func awsCredentialsConfigured() bool {
+	return os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "" ||
+		os.Getenv("AWS_ROLE_ARN") != "" && os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") != ""
+}
+
+// get returns static keys if set, else cached or freshly assumed IRSA credentials.
+func (s *awsCredentialSource) get(ctx context.Context, region string) (awsCredentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return awsCredentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	role, tokenFile := os.Getenv("AWS_ROLE_ARN"), os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	if role == "" || tokenFile == "" {
+		return awsCredentials{}, fmt.Errorf("no AWS credentials: set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Until(s.cached.Expiration) > credentialRefreshMargin {
+		return s.cached, nil
+	}
+	creds, err := assumeRoleWithWebIdentity(ctx, region, role, tokenFile)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	s.cached = creds
+	return creds, nil
+}
+
+// assumeRoleWithWebIdentity exchanges the projected service account token for temporary
+// keys. The token file is re-read every time since the kubelet rotates it.
+func assumeRoleWithWebIdentity(ctx context.Context, region, role, tokenFile string) (awsCredentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read AWS_WEB_IDENTITY_TOKEN_FILE: %w", err)
+	}
+	endpoint := os.Getenv("AWS_STS_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "https://sts." + region + ".amazonaws.com"
+	}
+	session := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if session == "" {
+		session = "opencost-mcp-server"
+	}
+	q := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(q.Encode()))
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to build STS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	raw, err := doCredentialRequest(req, "STS")
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(raw, &out); err != nil || out.Credentials.AccessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("unexpected STS response: %s", truncateBody(raw))
+	}
+	c := out.Credentials
+	return awsCredentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken, Expiration: c.Expiration}, nil
+}
+
+// gcpTokenSource resolves and caches a GCP OAuth access token.
+type gcpTokenSource struct {
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+var gcpTokens = &gcpTokenSource{}
+
+// gcpStorageScope is the OAuth scope requested for object writes.
+const gcpStorageScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// get returns a cached token or fetches a new one.
+func (s *gcpTokenSource) get(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Until(s.expiry) > credentialRefreshMargin {
+		return s.token, nil
+	}
+	var req *http.Request
+	var err error
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		req, err = serviceAccountTokenRequest(ctx, path)
+	} else {
+		host := os.Getenv("GCE_METADATA_HOST")
+		if host == "" {
+			host = "metadata.google.internal"
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+		if req != nil {
+			req.Header.Set("Metadata-Flavor", "Google")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	raw, err := doCredentialRequest(req, "GCP token")
+	if err != nil {
+		return "", err
+	}
+	var out struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil || out.AccessToken == "" {
+		return "", fmt.Errorf("unexpected GCP token response: %s", truncateBody(raw))
+	}
+	s.token, s.expiry = out.AccessToken, time.Now().Add(time.Duration(out.ExpiresIn)*time.Second)
+	return s.token, nil
+}
+
+// serviceAccountTokenRequest builds the JWT bearer grant for a service account key file.
+func serviceAccountTokenRequest(ctx context.Context, path string) (*http.Request, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+	}
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS: want a service_account key, got %q", key.Type)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS: private_key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS: %w", err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GOOGLE_APPLICATION_CREDENTIALS: private_key is not RSA")
+	}
+
+	now := time.Now().Unix()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": key.ClientEmail, "scope": gcpStorageScope, "aud": key.TokenURI, "iat": now, "exp": now + 3600,
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(nil, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("signing GCP token request: %w", err)
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// doCredentialRequest sends a token request and returns the body of a 200 response.
+func doCredentialRequest(req *http.Request, what string) ([]byte, error) {
+	resp, err := backendClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", what, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", what, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s error %d: %s", what, resp.StatusCode, truncateBody(raw))
+	}
+	return raw, nil
+}
+
+// truncateBody shortens a response body for error messages.
+func truncateBody(raw []byte) string {
+	s := strings.TrimSpace(string(raw))
+	if len(s) > 300 {
+		s = s[:300] + "..."
+	}
+	return s
+}
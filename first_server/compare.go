@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Window is a [start, end] pair of RFC3339 timestamps.
+type Window struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// CompareQuery is the POST body for /allocations/compare. Current is set explicitly or by a
+// relative Window ("lastmonth"), else defaults to the lookback (default 7d) ending now;
+// Baseline defaults to the equally long window right before Current.
+type CompareQuery struct {
+	Namespace string `json:"namespace,omitempty"`
+	Current   Window `json:"current"`
+	Baseline  Window `json:"baseline"`
+	Window    string `json:"window,omitempty"`
+	Timezone  string `json:"timezone,omitempty"`
+	Lookback  string `json:"lookback,omitempty"`
+}
+
+// NamespaceDelta is one namespace's change between the baseline and current windows.
+// PercentChange is nil when the baseline cost is zero.
+type NamespaceDelta struct {
+	Namespace     string   `json:"namespace"`
+	BaselineCost  float64  `json:"baseline_cost"`
+	CurrentCost   float64  `json:"current_cost"`
+	Delta         float64  `json:"delta"`
+	PercentChange *float64 `json:"percent_change"`
+	Change        string   `json:"change"` // increased, decreased, unchanged, new, removed
+}
+
+// compareNamespaces diffs per-namespace totals, largest increase first.
+func compareNamespaces(baseline, current map[string]float64) []NamespaceDelta {
+	seen := map[string]bool{}
+	out := []NamespaceDelta{}
+	add := func(ns string) {
+		if seen[ns] {
+			return
+		}
+		seen[ns] = true
+		b, c := round2(baseline[ns]), round2(current[ns])
+		d := NamespaceDelta{Namespace: ns, BaselineCost: b, CurrentCost: c, Delta: round2(c - b)}
+		_, inBase := baseline[ns]
+		_, inCur := current[ns]
+		switch {
+		case !inBase:
+			d.Change = "new"
+		case !inCur:
+			d.Change = "removed"
+		case d.Delta > 0:
+			d.Change = "increased"
+		case d.Delta < 0:
+			d.Change = "decreased"
+		default:
+			d.Change = "unchanged"
+		}
+		if b != 0 {
+			pct := round2((c - b) / b * 100)
+			d.PercentChange = &pct
+		}
+		out = append(out, d)
+	}
+	for ns := range current {
+		add(ns)
+	}
+	for ns := range baseline {
+		add(ns)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Delta != out[j].Delta {
+			return out[i].Delta > out[j].Delta
+		}
+		return out[i].Namespace < out[j].Namespace
+	})
+	return out
+}
+
+// resolveCompareWindows fills in defaulted windows and validates them.
+func resolveCompareWindows(q *CompareQuery, now time.Time, loc *time.Location, errs *ValidationErrors) {
+	applyWindow(errs, q.Window, "", &q.Current.Start, &q.Current.End, now, loc)
+	validateWindow(errs, q.Current.Start, q.Current.End)
+	validateWindow(errs, q.Baseline.Start, q.Baseline.End)
+	if len(*errs) > 0 {
+		return
+	}
+	if q.Current.Start == "" || q.Current.End == "" {
+		if q.Current.Start != "" || q.Current.End != "" {
+			errs.add("current", q.Current.Start+"/"+q.Current.End, "set both start and end, or neither to use lookback")
+			return
+		}
+		if q.Lookback == "" {
+			q.Lookback = "7d"
+		}
+		d, err := parseLookback(q.Lookback)
+		if err != nil {
+			errs.add("lookback", q.Lookback, "must be a duration like 7d, 2w or 12h")
+			return
+		}
+		q.Current.Start, q.Current.End = windowEnding(now, d)
+	}
+	curStart, _ := parseDate(q.Current.Start)
+	curEnd, _ := parseDate(q.Current.End)
+	if q.Baseline.Start == "" && q.Baseline.End == "" {
+		q.Baseline.Start, q.Baseline.End = windowEnding(curStart, curEnd.Sub(curStart))
+	} else if q.Baseline.Start == "" || q.Baseline.End == "" {
+		errs.add("baseline", q.Baseline.Start+"/"+q.Baseline.End, "set both start and end, or neither to use the preceding window")
+	}
+}
+
+// compareAllocationsHandler handles GET and POST /allocations/compare: per-namespace cost in
+// a current window against a baseline window, with deltas and percent changes.
+//
+// GET params: namespace, start, end or window (current window), timezone, baseline_start,
+// baseline_end, lookback.
+func compareAllocationsHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /allocations/compare request received")
+
+	var q CompareQuery
+	switch r.Method {
+	case http.MethodGet:
+		p := r.URL.Query()
+		q = CompareQuery{
+			Namespace: p.Get("namespace"),
+			Current:   Window{Start: p.Get("start"), End: p.Get("end")},
+			Baseline:  Window{Start: p.Get("baseline_start"), End: p.Get("baseline_end")},
+			Window:    p.Get("window"),
+			Timezone:  p.Get("timezone"),
+			Lookback:  p.Get("lookback"),
+		}
+	case http.MethodPost:
+		if !decodeJSON(w, r, &q) {
+			return
+		}
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Use GET or POST", nil)
+		return
+	}
+
+	q.Namespace = resolveAliases(r.Context(), "namespace", q.Namespace)
+	var verrs ValidationErrors
+	nsFilter := parseNamespaceFilter(&verrs, "namespace", q.Namespace).withDefaultExclusions()
+	loc := loadTimezone(&verrs, "timezone", q.Timezone)
+	resolveCompareWindows(&q, time.Now(), loc, &verrs)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, nsFilter, "") {
+		return
+	}
+
+	current, err := costSource.GetAllocations(r.Context(), AllocationFilter{Namespace: nsFilter.pushdown(), Start: q.Current.Start, End: q.Current.End})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations for the current window", err)
+		return
+	}
+	baseline, err := costSource.GetAllocations(r.Context(), AllocationFilter{Namespace: nsFilter.pushdown(), Start: q.Baseline.Start, End: q.Baseline.End})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations for the baseline window", err)
+		return
+	}
+	warnUnknownNamespaces(r.Context(), nsFilter)
+
+	curByNS, baseByNS := sumByNamespace(current, nsFilter), sumByNamespace(baseline, nsFilter)
+	deltas := compareNamespaces(baseByNS, curByNS)
+	var curTotal, baseTotal float64
+	for _, d := range deltas {
+		curTotal += d.CurrentCost
+		baseTotal += d.BaselineCost
+	}
+	summary := map[string]interface{}{
+		"baseline_total": round2(baseTotal),
+		"current_total":  round2(curTotal),
+		"delta":          round2(curTotal - baseTotal),
+		"percent_change": nil,
+	}
+	if baseTotal != 0 {
+		summary["percent_change"] = round2((curTotal - baseTotal) / baseTotal * 100)
+	}
+	logf(r.Context(), "[MCP] /allocations/compare — %d namespaces, delta %.2f\n", len(deltas), curTotal-baseTotal)
+
+	meta := map[string]interface{}{
+		"current":    q.Current,
+		"baseline":   q.Baseline,
+		"namespace":  q.Namespace,
+		"summary":    summary,
+		"timezone":   loc.String(),
+		"total":      len(deltas),
+		"request_id": requestIDFrom(r.Context()),
+	}
+	noteDefaultExclusions(meta, nsFilter)
+	resp := map[string]interface{}{"data": deltas, "meta": meta}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
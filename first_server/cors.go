@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig controls cross-origin access for browser-based agent UIs.
+type CORSConfig struct {
+	AllowedOrigins []string // exact origins, or "*" for any
+	AllowedMethods []string
+	AllowedHeaders []string
+	MaxAge         int // seconds browsers may cache a preflight result
+	Credentials    bool
+}
+
+// corsConfig is the active configuration; CORS is disabled while AllowedOrigins is empty.
+var corsConfig = CORSConfig{
+	AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+	AllowedHeaders: []string{"Content-Type", "Content-Encoding", "Authorization", requestIDHeader, traceparentHeader},
+	MaxAge:         600,
+}
+
+// loadCORSConfig reads CORS_ALLOWED_ORIGINS, CORS_ALLOWED_METHODS, CORS_ALLOWED_HEADERS,
+// CORS_MAX_AGE and CORS_ALLOW_CREDENTIALS.
+func loadCORSConfig() {
+	corsConfig.AllowedOrigins = splitList(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	if v := splitList(os.Getenv("CORS_ALLOWED_METHODS")); len(v) > 0 {
+		corsConfig.AllowedMethods = v
+	}
+	if v := splitList(os.Getenv("CORS_ALLOWED_HEADERS")); len(v) > 0 {
+		corsConfig.AllowedHeaders = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CORS_MAX_AGE")); err == nil && v >= 0 {
+		corsConfig.MaxAge = v
+	}
+	corsConfig.Credentials = os.Getenv("CORS_ALLOW_CREDENTIALS") == "true"
+	if len(corsConfig.AllowedOrigins) > 0 {
+		log.Printf("[MCP] CORS enabled for origins %v\n", corsConfig.AllowedOrigins)
+	}
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for origin, or "".
+// Credentialed requests never get a wildcard, per the CORS spec.
+func (c CORSConfig) allowedOrigin(origin string) string {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			if c.Credentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// withCORS adds CORS headers for allowed origins and answers preflight requests directly.
+// Requests from other origins are served without CORS headers, so browsers block them.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || len(corsConfig.AllowedOrigins) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		allow := corsConfig.allowedOrigin(origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if allow == "" {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent) // no allow headers: the browser rejects it
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Origin", allow)
+		if corsConfig.Credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", strings.Join(corsConfig.AllowedMethods, ", "))
+			h.Set("Access-Control-Allow-Headers", strings.Join(corsConfig.AllowedHeaders, ", "))
+			h.Set("Access-Control-Max-Age", strconv.Itoa(corsConfig.MaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", requestIDHeader)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// ===== Cost sources =====
+//
+// Handlers read cost data through a CostSource, so the OpenCost HTTP client can be swapped
+// for a static data set (demos, offline development) without touching handler code.
+// COST_SOURCE selects the provider: "http" (default), "file" with COST_SOURCE_FILE, "aws"
+// for Cost Explorer, "gcp" for a billing export, or "azure" for Cost Management.
+
+// CloudCostFilter narrows GetCloudCosts. Namespace matches by VM/pod name for now.
+type CloudCostFilter struct {
+	Namespace string
+}
+
+// AllocationFilter narrows GetAllocations. Start and End are RFC3339 and select allocations
+// overlapping the window.
+type AllocationFilter struct {
+	Namespace string
+	Start     string
+	End       string
+}
+
+// AssetFilter narrows GetAssets. Both fields match case-insensitively.
+type AssetFilter struct {
+	Provider string
+	Region   string
+}
+
+// CostSource is a provider of cost data.
+type CostSource interface {
+	GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error)
+	GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error)
+	GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error)
+}
+
+// errUnsupported is wrapped by providers asked for data they don't have, such as
+// allocations from a cloud billing API.
+var errUnsupported = errors.New("not supported by the configured cost source")
+
+// costSource is the active provider. main points it at BACKEND_URL; see network.go.
+var costSource CostSource = &HTTPSource{BaseURL: defaultBackendURL}
+
+// configureCostSource selects the provider from COST_SOURCE. A comma-separated list merges
+// several providers, e.g. "http,azure" shows Azure subscriptions alongside OpenCost data.
+func configureCostSource() error {
+	kinds := splitList(os.Getenv("COST_SOURCE"))
+	if len(kinds) == 0 {
+		return nil
+	}
+	var sources []CostSource
+	for _, kind := range kinds {
+		src, err := newCostSource(kind)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, src)
+	}
+	if len(sources) == 1 {
+		costSource = sources[0]
+	} else {
+		costSource = &multiSource{names: kinds, sources: sources}
+	}
+	return nil
+}
+
+// newCostSource builds one provider by name.
+func newCostSource(kind string) (CostSource, error) {
+	switch kind {
+	case "http":
+		return costSource, nil
+	case "file":
+		path := os.Getenv("COST_SOURCE_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("COST_SOURCE=file requires COST_SOURCE_FILE")
+		}
+		src, err := loadFileSource(path)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[MCP] Serving cost data from %s (%d allocations, %d assets, %d cloud costs)\n",
+			path, len(src.Allocations), len(src.Assets), len(src.CloudCosts))
+		return src, nil
+	case "aws":
+		src, err := newAWSCostExplorerSource()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[MCP] Serving cloud costs from AWS Cost Explorer (%s, %s)\n", src.Endpoint, src.Metric)
+		return src, nil
+	case "gcp":
+		src, err := newGCPBillingSource()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[MCP] Serving cloud costs and assets from GCP billing export %v (%d rows)\n", src.Paths, len(src.rows))
+		return src, nil
+	case "azure":
+		src, err := newAzureCostSource()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[MCP] Serving cloud costs and assets from Azure Cost Management (%d subscriptions)\n", len(src.Subscriptions))
+		return src, nil
+	default:
+		return nil, fmt.Errorf("unknown COST_SOURCE %q (want http, file, aws, gcp or azure)", kind)
+	}
+}
+
+// multiSource concatenates the results of several providers. Providers that don't carry a
+// kind of data are skipped. A failing provider only fails the call when no other provider
+// answered; otherwise the rest is returned and the failure is reported in meta.sources (see
+// partial.go).
+type multiSource struct {
+	names   []string
+	sources []CostSource
+}
+
+// mergeSources calls get on every source and concatenates the results, recording each
+// source's status for kind in ctx.
+func mergeSources[T any](ctx context.Context, m *multiSource, kind string, get func(CostSource) ([]T, error)) ([]T, error) {
+	out := []T{}
+	answered := 0
+	var failed []SourceStatus
+	var firstErr error
+	for i, src := range m.sources {
+		// A client that went away cancels the remaining sources rather than each failing
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := get(src)
+		status := SourceStatus{Source: m.names[i], Data: kind, Status: sourceOK, Records: len(data)}
+		switch {
+		case errors.Is(err, errUnsupported):
+			status.Status = sourceUnsupported
+		case err != nil:
+			status.Status, status.Error, status.Records = sourceFailed, err.Error(), 0
+			failed = append(failed, status)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", m.names[i], err)
+			}
+		default:
+			answered++
+			out = append(out, data...)
+		}
+		recordSourceStatus(ctx, status)
+	}
+	switch {
+	case answered == 0 && firstErr != nil:
+		return nil, firstErr
+	case answered == 0:
+		return nil, errUnsupported
+	}
+	for _, s := range failed {
+		addWarning(ctx, "partial_failure", "", "%s from %s are missing: %s", kind, s.Source, s.Error)
+	}
+	return out, nil
+}
+
+func (m *multiSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	return mergeSources(ctx, m, "cloud_costs", func(s CostSource) ([]CloudCost, error) { return s.GetCloudCosts(ctx, f) })
+}
+
+func (m *multiSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	return mergeSources(ctx, m, "allocations", func(s CostSource) ([]Allocation, error) { return s.GetAllocations(ctx, f) })
+}
+
+func (m *multiSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	return mergeSources(ctx, m, "assets", func(s CostSource) ([]Asset, error) { return s.GetAssets(ctx, f) })
+}
+
+// StaticSource serves a fixed data set, applying filters the same way the OpenCost
+// backend does.
+type StaticSource struct {
+	CloudCosts  []CloudCost  `json:"cloudCosts"`
+	Allocations []Allocation `json:"allocations"`
+	Assets      []Asset      `json:"assets"`
+}
+
+// loadFileSource reads a StaticSource from a JSON file with cloudCosts, allocations and
+// assets arrays.
+func loadFileSource(path string) (*StaticSource, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cost source file: %w", err)
+	}
+	var src StaticSource
+	if err := json.Unmarshal(raw, &src); err != nil {
+		return nil, fmt.Errorf("parsing cost source file %s: %w", path, err)
+	}
+	return &src, nil
+}
+
+// The matchers below apply filters the way the OpenCost backend does, for StaticSource and
+// for records streamed from the backend (see stream.go).
+
+// matches reports whether c passes f.
+func (f CloudCostFilter) matches(c CloudCost) bool {
+	return f.Namespace == "" || strings.Contains(strings.ToLower(c.Name), strings.ToLower(f.Namespace))
+}
+
+// matcher returns a test for allocations passing f, with the window parsed once.
+func (f AllocationFilter) matcher() func(Allocation) bool {
+	start, errStart := time.Parse(time.RFC3339, f.Start)
+	end, errEnd := time.Parse(time.RFC3339, f.End)
+	return func(a Allocation) bool {
+		if f.Namespace != "" && a.Namespace != f.Namespace {
+			return false
+		}
+		if errStart == nil {
+			if t, err := time.Parse(time.RFC3339, a.EndTime); err == nil && t.Before(start) {
+				return false
+			}
+		}
+		if errEnd == nil {
+			if t, err := time.Parse(time.RFC3339, a.StartTime); err == nil && t.After(end) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// matches reports whether a passes f.
+func (f AssetFilter) matches(a Asset) bool {
+	return (f.Provider == "" || strings.EqualFold(a.Provider, f.Provider)) &&
+		(f.Region == "" || strings.EqualFold(a.Region, f.Region))
+}
+
+func (s *StaticSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	out := []CloudCost{}
+	for _, c := range s.CloudCosts {
+		if f.matches(c) {
+			out = append(out, c)
+		}
+	}
+	return out, ctx.Err()
+}
+
+func (s *StaticSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	matches := f.matcher()
+	out := []Allocation{}
+	for _, a := range s.Allocations {
+		if matches(a) {
+			out = append(out, a)
+		}
+	}
+	return out, ctx.Err()
+}
+
+func (s *StaticSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	out := []Asset{}
+	for _, a := range s.Assets {
+		if f.matches(a) {
+			out = append(out, a)
+		}
+	}
+	return out, ctx.Err()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// cronTime is a minute in July 2025 (the 1st is a Tuesday) or any other month.
+func cronTime(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2025, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}},
+		{"3", 0, 59, []int{3}},
+		{"1-4", 0, 59, []int{1, 2, 3, 4}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"10-30/10", 0, 59, []int{10, 20, 30}},
+		{"50/5", 0, 59, []int{50, 55}},
+		{"1,5,9", 0, 59, []int{1, 5, 9}},
+		{"1-3,10-20/5,59", 0, 59, []int{1, 2, 3, 10, 15, 20, 59}},
+		{"*/10", 1, 31, []int{1, 11, 21, 31}},
+		{"0-7", 0, 7, []int{0, 1, 2, 3, 4, 5, 6, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			bits, err := parseCronField(tt.field, tt.min, tt.max)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want uint64
+			for _, v := range tt.want {
+				want |= 1 << uint(v)
+			}
+			if bits != want {
+				t.Errorf("bits = %b, want %b", bits, want)
+			}
+		})
+	}
+}
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{"", "expected 5 fields"},
+		{"* * * *", "expected 5 fields (minute hour day-of-month month day-of-week), got 4"},
+		{"* * * * * *", "got 6"},
+		{"@every 5m", "got 2"},
+		{"60 * * * *", `minute: "60" out of range 0-59`},
+		{"* 24 * * *", `hour: "24" out of range 0-23`},
+		{"* * 0 * *", `day-of-month: "0" out of range 1-31`},
+		{"* * 32 * *", `day-of-month: "32" out of range 1-31`},
+		{"* * * 13 *", `month: "13" out of range 1-12`},
+		{"* * * * 8", `day-of-week: "8" out of range 0-7`},
+		{"5-1 * * * *", `minute: invalid range "5-1"`},
+		{"-5 * * * *", `minute: invalid range "-5"`},
+		{"*/0 * * * *", `minute: invalid step in "*/0"`},
+		{"*/x * * * *", `minute: invalid step in "*/x"`},
+		{"1,,2 * * * *", `minute: invalid value ""`},
+		{"* * * JAN *", `month: invalid value "JAN"`},
+		{"* * * * MON", `day-of-week: invalid value "MON"`},
+		{"50-70 * * * *", `minute: "50-70" out of range 0-59`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseCron(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseCron(%q) = %v, want an error containing %q", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	tests := []struct {
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{"* * * * *", cronTime(7, 1, 0, 0), true},
+		{"30 9 * * *", cronTime(7, 1, 9, 30), true},
+		{"30 9 * * *", cronTime(7, 1, 9, 31), false},
+		{"*/15 * * * *", cronTime(7, 1, 3, 45), true},
+		{"*/15 * * * *", cronTime(7, 1, 3, 46), false},
+		{"0 9-17 * * *", cronTime(7, 1, 17, 0), true},
+		{"0 9-17 * * *", cronTime(7, 1, 18, 0), false},
+		{"0 0 * 7 *", cronTime(8, 1, 0, 0), false},
+		{"0 0 1,15 * *", cronTime(7, 15, 0, 0), true},
+		{"0 0 * * 1-5", cronTime(7, 5, 0, 0), false}, // Saturday
+		{"0 0 * * 0", cronTime(7, 6, 0, 0), true},    // Sunday
+		{"0 0 * * 7", cronTime(7, 6, 0, 0), true},    // 7 is Sunday too
+		{"@hourly", cronTime(7, 1, 5, 0), true},
+		{"@daily", cronTime(7, 1, 5, 0), false},
+		{"@weekly", cronTime(7, 6, 0, 0), true},
+		{"@monthly", cronTime(7, 1, 0, 0), true},
+		{"@yearly", cronTime(1, 1, 0, 0), true},
+		{"@yearly", cronTime(7, 1, 0, 0), false},
+
+		// Both day fields restricted: either may match, as in cron(8)
+		{"0 0 13 * 5", cronTime(6, 13, 0, 0), true}, // Friday the 13th
+		{"0 0 13 * 5", cronTime(7, 13, 0, 0), true}, // the 13th, a Sunday
+		{"0 0 13 * 5", cronTime(7, 4, 0, 0), true},  // a Friday
+		{"0 0 13 * 5", cronTime(7, 5, 0, 0), false}, // neither
+		// One of them "*": only the other decides
+		{"0 0 13 * *", cronTime(7, 4, 0, 0), false},
+		{"0 0 * * 5", cronTime(7, 13, 0, 0), false},
+		// "*/n" counts as "*", so both must match
+		{"0 0 */2 * 5", cronTime(7, 11, 0, 0), true}, // odd day and Friday
+		{"0 0 */2 * 5", cronTime(7, 4, 0, 0), false}, // Friday, even day
+		{"0 0 1 * */2", cronTime(7, 1, 0, 0), true},  // the 1st, a Tuesday
+		{"0 0 1 * */2", cronTime(7, 2, 0, 0), false}, // Wednesday, not the 1st
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+" "+tt.at.Format("Mon Jan 2 15:04"), func(t *testing.T) {
+			spec, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spec.Matches(tt.at); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time // zero when there is none within a year
+	}{
+		{"*/15 * * * *", cronTime(7, 1, 3, 45), cronTime(7, 1, 4, 0)},
+		{"*/15 * * * *", cronTime(7, 1, 3, 44).Add(30 * time.Second), cronTime(7, 1, 3, 45)},
+		{"0 9 * * 1", cronTime(7, 1, 10, 0), cronTime(7, 7, 9, 0)},
+		{"0 0 1 * *", cronTime(12, 15, 0, 0), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", cronTime(3, 1, 0, 0), time.Time{}}, // no February 29th before 2028
+		{"0 0 31 4 *", cronTime(1, 1, 0, 0), time.Time{}}, // April has 30 days
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			spec, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := spec.Next(tt.from)
+			if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+				t.Errorf("Next = %v, %v; want %v", got, ok, tt.want)
+			}
+		})
+	}
+}
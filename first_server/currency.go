@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ===== Asset currencies =====
+//
+// Cloud bills aren't all in one currency: an Azure subscription may bill in EUR while AWS
+// bills in USD. Assets carry the currency of their cost, and every asset read converts costs
+// into the base currency, so totals, summaries, groupings and savings add like with like:
+//
+//	BASE_CURRENCY   ISO 4217 code costs are reported in (default USD). Assets without a
+//	                currency are taken to be in it.
+//	CURRENCY_RATES  base-currency units per unit of each other currency, e.g.
+//	                EUR=1.08,GBP=1.27,INR=0.012
+//
+// A converted asset keeps its billed amount in original_cost and original_currency. Responses
+// that converted anything describe it in meta.currency. An asset in a currency without a rate
+// keeps its cost unconverted, and the response gets a mixed_currency warning: its totals add
+// amounts in different currencies.
+
+// currencyConfig is the base currency and the conversion rates into it.
+var currencyConfig = struct {
+	base  string
+	rates map[string]float64
+}{base: "USD", rates: map[string]float64{}}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// loadCurrencyConfig reads BASE_CURRENCY and CURRENCY_RATES.
+func loadCurrencyConfig() error {
+	if v := strings.ToUpper(strings.TrimSpace(os.Getenv("BASE_CURRENCY"))); v != "" {
+		if !currencyCode.MatchString(v) {
+			return fmt.Errorf("BASE_CURRENCY must be an ISO 4217 code such as USD, got %q", v)
+		}
+		currencyConfig.base = v
+	}
+	for _, pair := range splitList(os.Getenv("CURRENCY_RATES")) {
+		code, rate, ok := strings.Cut(pair, "=")
+		code = strings.ToUpper(strings.TrimSpace(code))
+		r, err := strconv.ParseFloat(strings.TrimSpace(rate), 64)
+		if !ok || !currencyCode.MatchString(code) || err != nil || r <= 0 {
+			return fmt.Errorf("CURRENCY_RATES entries must look like EUR=1.08, got %q", pair)
+		}
+		currencyConfig.rates[code] = r
+	}
+	return nil
+}
+
+// CurrencyReport is meta.currency.
+type CurrencyReport struct {
+	Base        string             `json:"base"`
+	Converted   map[string]int     `json:"converted,omitempty"`   // assets per currency converted to base
+	Rates       map[string]float64 `json:"rates,omitempty"`       // the rates used
+	Unconverted map[string]int     `json:"unconverted,omitempty"` // assets per currency without a rate
+	Mixed       bool               `json:"mixed"`                 // totals add different currencies
+}
+
+// currencySource converts the costs of the assets it reads into the base currency.
+type currencySource struct {
+	inner CostSource
+}
+
+// enableCurrency wraps costSource so asset costs come out in the base currency.
+func enableCurrency() {
+	costSource = &currencySource{inner: costSource}
+}
+
+func (s *currencySource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	return s.inner.GetCloudCosts(ctx, f)
+}
+
+func (s *currencySource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	return s.inner.GetAllocations(ctx, f)
+}
+
+func (s *currencySource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	data, err := s.inner.GetAssets(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeCurrencies(ctx, data), nil
+}
+
+// normalizeCurrencies returns assets with their costs in the base currency where a rate is
+// known, recording what it did for the request in ctx.
+func normalizeCurrencies(ctx context.Context, assets []Asset) []Asset {
+	base := currencyConfig.base
+	var out []Asset
+	var report *CurrencyReport
+	for i, a := range assets {
+		code := strings.ToUpper(a.Currency)
+		if code == "" || code == base {
+			continue
+		}
+		if out == nil {
+			out = append([]Asset(nil), assets...)
+			report = &CurrencyReport{Base: base}
+		}
+		rate, ok := currencyConfig.rates[code]
+		if !ok {
+			if report.Unconverted == nil {
+				report.Unconverted = map[string]int{}
+			}
+			report.Unconverted[code]++
+			continue
+		}
+		out[i].OriginalCost, out[i].OriginalCurrency = a.Cost, code
+		out[i].Cost, out[i].Currency = round2(a.Cost*rate), base
+		if report.Converted == nil {
+			report.Converted, report.Rates = map[string]int{}, map[string]float64{}
+		}
+		report.Converted[code]++
+		report.Rates[code] = rate
+	}
+	if report == nil {
+		return assets
+	}
+	if len(report.Unconverted) > 0 {
+		report.Mixed = true
+		codes := make([]string, 0, len(report.Unconverted))
+		for code, n := range report.Unconverted {
+			codes = append(codes, fmt.Sprintf("%d in %s", n, code))
+		}
+		sort.Strings(codes)
+		addWarning(ctx, "mixed_currency", "currency", "assets with no rate in CURRENCY_RATES kept their billed cost (%s); totals mix them with %s", strings.Join(codes, ", "), base)
+	}
+	noteCurrency(ctx, report)
+	return out
+}
+
+// noteCurrency merges r into the request's meta.currency.
+func noteCurrency(ctx context.Context, r *CurrencyReport) {
+	list, _ := ctx.Value(warningsKey{}).(*warningList)
+	if list == nil {
+		return
+	}
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	if list.currency == nil {
+		list.currency = &CurrencyReport{Base: r.Base}
+	}
+	merge := func(dst *map[string]int, src map[string]int) {
+		for code, n := range src {
+			if *dst == nil {
+				*dst = map[string]int{}
+			}
+			(*dst)[code] += n
+		}
+	}
+	merge(&list.currency.Converted, r.Converted)
+	merge(&list.currency.Unconverted, r.Unconverted)
+	for code, rate := range r.Rates {
+		if list.currency.Rates == nil {
+			list.currency.Rates = map[string]float64{}
+		}
+		list.currency.Rates[code] = rate
+	}
+	list.currency.Mixed = list.currency.Mixed || r.Mixed
+}
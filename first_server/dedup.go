@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// ===== Allocation deduplication =====
+//
+// Merged cost sources, or a backend answering with overlapping windows, can return the same
+// allocation twice. DEDUP_POLICY collapses records with the same namespace, resource_id,
+// start_time and end_time into one:
+//
+//	none   keep duplicates (default)
+//	first  keep the first record seen
+//	last   keep the last record seen
+//	max    keep the highest of each cost field, e.g. when backends disagree
+//	sum    add the cost fields, when each source reports a share of the cost
+//
+// Labels and asset IDs of the merged records are combined; on a label conflict the first
+// record wins.
+
+// dedupPolicies lists the accepted DEDUP_POLICY values.
+var dedupPolicies = []string{"none", "first", "last", "max", "sum"}
+
+// dedupSource merges duplicate allocations from inner according to policy.
+type dedupSource struct {
+	inner  CostSource
+	policy string
+}
+
+// configureDedup wraps costSource according to DEDUP_POLICY.
+func configureDedup() error {
+	policy := strings.ToLower(os.Getenv("DEDUP_POLICY"))
+	switch policy {
+	case "", "none":
+		return nil
+	case "first", "last", "max", "sum":
+		costSource = &dedupSource{inner: costSource, policy: policy}
+		return nil
+	}
+	return fmt.Errorf("unknown DEDUP_POLICY %q (want %s)", policy, strings.Join(dedupPolicies, ", "))
+}
+
+func (s *dedupSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	return s.inner.GetCloudCosts(ctx, f)
+}
+
+func (s *dedupSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	return s.inner.GetAssets(ctx, f)
+}
+
+func (s *dedupSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	data, err := s.inner.GetAllocations(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	out := dedupAllocations(data, s.policy)
+	if merged := len(data) - len(out); merged > 0 {
+		logf(ctx, "[MCP] Merged %d duplicate allocation(s) (policy %s)\n", merged, s.policy)
+	}
+	return out, nil
+}
+
+// dedupAllocations collapses allocations with the same key, keeping the first occurrence's
+// position.
+func dedupAllocations(allocs []Allocation, policy string) []Allocation {
+	out := make([]Allocation, 0, len(allocs))
+	index := map[AllocationKey]int{}
+	for _, a := range allocs {
+		key := allocationKeyOf(a)
+		i, dup := index[key]
+		if !dup {
+			index[key] = len(out)
+			out = append(out, a)
+			continue
+		}
+		out[i] = mergeAllocation(out[i], a, policy)
+	}
+	return out
+}
+
+// mergeAllocation combines a duplicate b into a.
+func mergeAllocation(a, b Allocation, policy string) Allocation {
+	merged := a
+	switch policy {
+	case "last":
+		merged = b
+	case "max":
+		merged.CPUCost, merged.MemoryCost = math.Max(a.CPUCost, b.CPUCost), math.Max(a.MemoryCost, b.MemoryCost)
+		merged.GPUCost, merged.TotalCost = math.Max(a.GPUCost, b.GPUCost), math.Max(a.TotalCost, b.TotalCost)
+		merged.NetworkCost, merged.PVCost = math.Max(a.NetworkCost, b.NetworkCost), math.Max(a.PVCost, b.PVCost)
+	case "sum":
+		merged.CPUCost, merged.MemoryCost = round2(a.CPUCost+b.CPUCost), round2(a.MemoryCost+b.MemoryCost)
+		merged.GPUCost, merged.TotalCost = round2(a.GPUCost+b.GPUCost), round2(a.TotalCost+b.TotalCost)
+		merged.NetworkCost, merged.PVCost = round2(a.NetworkCost+b.NetworkCost), round2(a.PVCost+b.PVCost)
+	}
+
+	labels := map[string]string{}
+	for _, l := range []map[string]string{b.Labels, a.Labels} {
+		for k, v := range l {
+			labels[k] = v
+		}
+	}
+	if len(labels) > 0 {
+		merged.Labels = labels
+	}
+	seen := map[string]bool{}
+	var ids []string
+	for _, id := range append(append([]string{}, a.AssetIDs...), b.AssetIDs...) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	merged.AssetIDs = ids
+	return merged
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ===== Incremental allocations =====
+//
+// An agent keeping its own copy of allocations doesn't need the whole list on every poll.
+// delta=true on /allocations adds meta.next_token; passing it back as since_token (with the
+// same filters) returns only the records added or changed since, and meta.delta.removed lists
+// the ones that are gone. Every delta response carries a fresh next_token. Records are keyed
+// by namespace, resource_id, start_time and end_time.
+//
+// Tokens live in memory for deltaTokenTTL; an unknown or expired token is a 400, after which
+// the client starts over with delta=true.
+
+const (
+	deltaTokenTTL  = time.Hour
+	maxDeltaTokens = 500
+)
+
+// AllocationKey identifies an allocation record across delta responses.
+type AllocationKey struct {
+	Namespace  string `json:"namespace"`
+	ResourceID string `json:"resource_id"`
+	StartTime  string `json:"start_time"`
+	EndTime    string `json:"end_time"`
+}
+
+// DeltaReport is meta.delta on a since_token response.
+type DeltaReport struct {
+	SinceToken string          `json:"since_token"`
+	Changed    int             `json:"changed"` // added or changed records, returned in data
+	Unchanged  int             `json:"unchanged"`
+	Removed    []AllocationKey `json:"removed"`
+}
+
+// deltaState is what a token remembers: the filters it was issued for and a fingerprint of
+// every record it covered.
+type deltaState struct {
+	filters string
+	records map[AllocationKey]string
+	issued  time.Time
+}
+
+type deltaStore struct {
+	mu    sync.Mutex
+	items map[string]*deltaState
+}
+
+var deltas = &deltaStore{items: map[string]*deltaState{}}
+
+// allocationKeyOf returns a's key.
+func allocationKeyOf(a Allocation) AllocationKey {
+	return AllocationKey{Namespace: a.Namespace, ResourceID: a.ResourceID, StartTime: a.StartTime, EndTime: a.EndTime}
+}
+
+// fingerprint hashes a record, so any changed field counts as a change.
+func fingerprint(a Allocation) string {
+	raw, _ := json.Marshal(a)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// get returns the state of token if it exists and hasn't expired.
+func (s *deltaStore) get(token string, now time.Time) (*deltaState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.items[token]
+	if !ok || now.Sub(st.issued) > deltaTokenTTL {
+		return nil, false
+	}
+	return st, true
+}
+
+// issue remembers allocs under a new token, evicting expired and then the oldest tokens to
+// stay under maxDeltaTokens.
+func (s *deltaStore) issue(filters string, allocs []Allocation, now time.Time) string {
+	st := &deltaState{filters: filters, records: make(map[AllocationKey]string, len(allocs)), issued: now}
+	for _, a := range allocs {
+		st.records[allocationKeyOf(a)] = fingerprint(a)
+	}
+	token := "dt-" + newRequestID()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for t, old := range s.items {
+		if now.Sub(old.issued) > deltaTokenTTL {
+			delete(s.items, t)
+		}
+	}
+	if len(s.items) >= maxDeltaTokens {
+		tokens := make([]string, 0, len(s.items))
+		for t := range s.items {
+			tokens = append(tokens, t)
+		}
+		sort.Slice(tokens, func(i, j int) bool { return s.items[tokens[i]].issued.Before(s.items[tokens[j]].issued) })
+		for _, t := range tokens[:len(tokens)-maxDeltaTokens+1] {
+			delete(s.items, t)
+		}
+	}
+	s.items[token] = st
+	return token
+}
+
+// diff returns the records of allocs that are new or changed since st, and describes the rest.
+func (st *deltaState) diff(allocs []Allocation, sinceToken string) ([]Allocation, DeltaReport) {
+	report := DeltaReport{SinceToken: sinceToken, Removed: []AllocationKey{}}
+	changed := []Allocation{}
+	seen := map[AllocationKey]bool{}
+	for _, a := range allocs {
+		key := allocationKeyOf(a)
+		seen[key] = true
+		if st.records[key] == fingerprint(a) {
+			report.Unchanged++
+			continue
+		}
+		changed = append(changed, a)
+	}
+	for key := range st.records {
+		if !seen[key] {
+			report.Removed = append(report.Removed, key)
+		}
+	}
+	sort.Slice(report.Removed, func(i, j int) bool {
+		a, b := report.Removed[i], report.Removed[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.ResourceID != b.ResourceID {
+			return a.ResourceID < b.ResourceID
+		}
+		return a.StartTime < b.StartTime
+	})
+	report.Changed = len(changed)
+	return changed, report
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// ===== Email digests =====
+//
+// Schedules with "destination": {"type": "email", "to": [...]} mail their report as a digest:
+// an HTML table of the report lines (with a plain-text alternative) and the report attached
+// as CSV. Schedules that run a saved query attach its JSON result instead. Mail goes through
+// the SMTP server configured with:
+//
+//	SMTP_HOST, SMTP_PORT   server (port default 587)
+//	SMTP_USERNAME, SMTP_PASSWORD  PLAIN auth, optional
+//	SMTP_FROM              sender address, required
+//	SMTP_TLS               starttls (default, required), tls (implicit, e.g. port 465) or none
+
+// smtpConfig is the mail server configuration; nil when email is disabled.
+type smtpConfig struct {
+	host, port         string
+	username, password string
+	from               *mail.Address
+	tlsMode            string // starttls, tls or none
+}
+
+var smtpServer *smtpConfig
+
+// configureSMTP reads the SMTP_* variables. Email destinations are refused without SMTP_HOST.
+func configureSMTP() error {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+	c := &smtpConfig{host: host, port: os.Getenv("SMTP_PORT"), username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"), tlsMode: os.Getenv("SMTP_TLS")}
+	if c.port == "" {
+		c.port = "587"
+	}
+	if c.tlsMode == "" {
+		c.tlsMode = "starttls"
+	}
+	if c.tlsMode != "starttls" && c.tlsMode != "tls" && c.tlsMode != "none" {
+		return fmt.Errorf("SMTP_TLS must be starttls, tls or none, got %q", c.tlsMode)
+	}
+	from, err := mail.ParseAddress(os.Getenv("SMTP_FROM"))
+	if err != nil {
+		return fmt.Errorf("SMTP_FROM: %w", err)
+	}
+	c.from = from
+	smtpServer = c
+	log.Printf("[MCP] Email digests via %s:%s (%s)\n", c.host, c.port, c.tlsMode)
+	return nil
+}
+
+// send delivers one message to the recipients.
+func (c *smtpConfig) send(ctx context.Context, to []string, msg []byte) error {
+	addr := net.JoinHostPort(c.host, c.port)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	tlsConfig := &tls.Config{ServerName: c.host}
+	var conn net.Conn
+	var err error
+	if c.tlsMode == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+	client, err := smtp.NewClient(conn, c.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer client.Close()
+	if c.tlsMode == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server does not offer STARTTLS; set SMTP_TLS=none to send in the clear")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+	if c.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.username, c.password, c.host)); err != nil {
+			return fmt.Errorf("SMTP auth failed: %w", err)
+		}
+	}
+	if err := client.Mail(c.from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM rejected: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP recipient %s rejected: %w", rcpt, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP message rejected: %w", err)
+	}
+	return client.Quit()
+}
+
+// digestTemplate is the HTML body of a report digest.
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{"money": money}).Parse(`<!DOCTYPE html>
+<html><body style="font-family: sans-serif; color: #222">
+<h2 style="margin-bottom: 4px">{{.Name}}</h2>
+<p style="color: #666; margin-top: 0">{{.Report.Start}} to {{.Report.End}} &middot; by {{.Report.GroupBy}}{{if .Report.Policy}} ({{.Report.Policy}}){{end}} &middot; total <b>{{money .Report.TotalCost}}</b></p>
+<table cellpadding="6" cellspacing="0" style="border-collapse: collapse">
+<tr style="background: #f2f2f2; text-align: left"><th>{{.Report.GroupBy}}</th><th align="right">Direct</th><th align="right">Shared</th><th align="right">Total</th><th align="right">Share</th></tr>
+{{range .Report.Lines}}<tr style="border-top: 1px solid #ddd"><td>{{.Name}}</td><td align="right">{{money .DirectCost}}</td><td align="right">{{money .SharedCost}}</td><td align="right"><b>{{money .TotalCost}}</b></td><td align="right">{{printf "%.1f" .SharePct}}%</td></tr>
+{{end}}</table>
+<p style="color: #666; font-size: 12px">The full report is attached as CSV.</p>
+</body></html>
+`))
+
+// digestText is the plain-text alternative of a report digest.
+func digestText(name string, report ChargebackReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s to %s, by %s, total %s\n\n", name, report.Start, report.End, report.GroupBy, money(report.TotalCost))
+	for _, l := range report.Lines {
+		fmt.Fprintf(&b, "%-30s %12s  %5.1f%%\n", l.Name, money(l.TotalCost), l.SharePct)
+	}
+	b.WriteString("\nThe full report is attached as CSV.\n")
+	return b.String()
+}
+
+// buildDigest renders the MIME message for a delivery: the digest (or a short note for a
+// saved query) as text and HTML, and the report as an attachment.
+func buildDigest(from *mail.Address, to []string, del Delivery) ([]byte, error) {
+	name := del.Schedule.Name
+	subject := "Cost report: " + name
+	text := ""
+	var htmlBody bytes.Buffer
+	attachment, attachType, attachName := del.Body, del.ContentType, del.Filename
+	if del.Schedule.Query != "" {
+		subject = "Saved query results: " + name
+		text = fmt.Sprintf("Results of saved query %s are attached.\n", del.Schedule.Query)
+		htmlBody.WriteString("<p>Results of saved query <b>" + template.HTMLEscapeString(del.Schedule.Query) + "</b> are attached.</p>")
+	} else {
+		subject += fmt.Sprintf(" (%s)", money(del.Report.TotalCost))
+		text = digestText(name, del.Report)
+		if err := digestTemplate.Execute(&htmlBody, struct {
+			Name   string
+			Report ChargebackReport
+		}{name, del.Report}); err != nil {
+			return nil, err
+		}
+		var csvBody bytes.Buffer
+		renderReportCSV(&csvBody, del.Report)
+		attachment, attachType = csvBody.Bytes(), "text/csv"
+		attachName = strings.TrimSuffix(strings.TrimSuffix(del.Filename, ".json"), ".csv") + ".csv"
+	}
+
+	var msg bytes.Buffer
+	mixed := multipart.NewWriter(&msg)
+	header := func(k, v string) { fmt.Fprintf(&msg, "%s: %s\r\n", k, v) }
+	header("From", from.String())
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", del.At.UTC().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s.%d@%s>", del.Schedule.ID, del.At.Unix(), hostOf(from.Address)))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/mixed; boundary="`+mixed.Boundary()+`"`)
+	msg.WriteString("\r\n")
+
+	altBoundary := multipart.NewWriter(nil).Boundary()
+	altPart, err := mixed.CreatePart(textproto.MIMEHeader{"Content-Type": {`multipart/alternative; boundary="` + altBoundary + `"`}})
+	if err != nil {
+		return nil, err
+	}
+	alt := multipart.NewWriter(altPart)
+	alt.SetBoundary(altBoundary)
+	for _, p := range []struct{ typ, body string }{{"text/plain", text}, {"text/html", htmlBody.String()}} {
+		part, err := alt.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.typ + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64Lines(part, []byte(p.body))
+	}
+	alt.Close()
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {attachType},
+		"Content-Disposition":       {`attachment; filename="` + attachName + `"`},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64Lines(part, attachment)
+	mixed.Close()
+	return msg.Bytes(), nil
+}
+
+// writeBase64Lines writes data base64-encoded in 76-character lines, as MIME requires.
+func writeBase64Lines(w io.Writer, data []byte) {
+	enc := base64.StdEncoding.EncodeToString(data)
+	for len(enc) > 76 {
+		w.Write([]byte(enc[:76] + "\r\n"))
+		enc = enc[76:]
+	}
+	w.Write([]byte(enc + "\r\n"))
+}
+
+// hostOf is the domain of an email address, for Message-IDs.
+func hostOf(addr string) string {
+	if _, host, ok := strings.Cut(addr, "@"); ok {
+		return host
+	}
+	return "localhost"
+}
+
+func validateEmailDestination(d Destination, errs *ValidationErrors) {
+	if len(d.To) == 0 {
+		errs.add("destination.to", "", "needs at least one recipient")
+	}
+	for _, to := range d.To {
+		if addr, err := mail.ParseAddress(to); err != nil || addr.Address != to {
+			errs.add("destination.to", to, "must be a plain email address")
+		}
+	}
+	if smtpServer == nil {
+		errs.add("destination.type", d.Type, "SMTP is not configured on the server; set SMTP_HOST and SMTP_FROM")
+	}
+}
+
+// deliverEmail mails the rendered report to the destination's recipients.
+func deliverEmail(ctx context.Context, d Destination, del Delivery) error {
+	if smtpServer == nil {
+		return fmt.Errorf("SMTP is not configured")
+	}
+	msg, err := buildDigest(smtpServer.from, d.To, del)
+	if err != nil {
+		return fmt.Errorf("rendering email: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	return smtpServer.send(ctx, d.To, msg)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// enrichOptions lists the accepted values of the enrich parameter.
+var enrichOptions = []string{"assets"}
+
+// AssetRef is the part of an Asset joined onto an allocation.
+type AssetRef struct {
+	AssetID  string  `json:"asset_id"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Provider string  `json:"provider"`
+	Region   string  `json:"region"`
+	Cost     float64 `json:"cost"`
+}
+
+// EnrichedAllocation is an allocation with the assets backing it.
+type EnrichedAllocation struct {
+	Allocation
+	Assets []AssetRef `json:"assets"`
+}
+
+// validateEnrich checks every requested enrichment is known.
+func validateEnrich(errs *ValidationErrors, enrich []string) {
+	for _, e := range enrich {
+		known := false
+		for _, o := range enrichOptions {
+			known = known || e == o
+		}
+		if !known {
+			errs.add("enrich", e, "must be one of "+strings.Join(enrichOptions, ", "))
+		}
+	}
+}
+
+// enrichWithAssets joins assets onto allocations. An allocation matches an asset listed in
+// its asset_ids, or one whose ID equals its resource_id. It also returns the referenced
+// asset IDs that no asset record matched.
+func enrichWithAssets(ctx context.Context, allocs []Allocation) ([]EnrichedAllocation, []string, error) {
+	assets, err := costSource.GetAssets(ctx, AssetFilter{})
+	if err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[string]Asset, len(assets))
+	for _, a := range assets {
+		byID[a.AssetID] = a
+	}
+
+	missing := map[string]bool{}
+	out := make([]EnrichedAllocation, 0, len(allocs))
+	for _, alloc := range allocs {
+		e := EnrichedAllocation{Allocation: alloc, Assets: []AssetRef{}}
+		seen := map[string]bool{}
+		ids := append([]string{alloc.ResourceID}, alloc.AssetIDs...)
+		for i, id := range ids {
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			a, ok := byID[id]
+			if !ok {
+				if i > 0 { // resource_id is only a best-effort match
+					missing[id] = true
+				}
+				continue
+			}
+			e.Assets = append(e.Assets, AssetRef{AssetID: a.AssetID, Name: a.Name, Type: a.Type, Provider: a.Provider, Region: a.Region, Cost: a.Cost})
+		}
+		out = append(out, e)
+	}
+
+	unmatched := make([]string, 0, len(missing))
+	for id := range missing {
+		unmatched = append(unmatched, id)
+	}
+	sort.Strings(unmatched)
+	return out, unmatched, nil
+}
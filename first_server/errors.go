@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of the error envelope. Agents should switch on
+// these rather than on the human-readable message.
+const (
+	ErrCodeInvalidJSON      = "invalid_json"
+	ErrCodeInvalidFilters   = "invalid_filters"
+	ErrCodeBackend          = "backend_error"
+	ErrCodeNotFound         = "not_found"
+	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeInternal         = "internal_error"
+	ErrCodeInvalidEncoding  = "invalid_encoding"
+	ErrCodePayloadTooLarge  = "payload_too_large"
+	ErrCodeTimeout          = "timeout"
+	ErrCodeCanceled         = "canceled"
+	ErrCodeNotSupported     = "not_supported"
+	ErrCodeConflict         = "conflict"
+	ErrCodeUnauthorized     = "unauthorized"
+	ErrCodeForbidden        = "forbidden"
+)
+
+// requestIDHeader carries the request identifier in both directions.
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// APIError is the body of every error response:
+//
+//	{"error": {"code": "...", "message": "...", "details": ..., "request_id": "..."}}
+type APIError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// newRequestID returns a random 16-hex-character identifier.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDFrom returns the request ID stored on the request context, if any.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logf logs with the request ID from ctx prepended, so every line for one request can be
+// grepped out across the CLI, this server and the backend.
+func logf(ctx context.Context, format string, args ...interface{}) {
+	if id := requestIDFrom(ctx); id != "" {
+		format = "[req=" + id + "] " + format
+	}
+	log.Printf(format, args...)
+}
+
+// withRequestID assigns each request an ID (reusing the caller's X-Request-ID when sent),
+// stores it on the request context, and echoes it in the response header.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// writeJSON responds with status and v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError responds with status and the standard JSON error envelope.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]APIError{
+		"error": {
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestID: requestIDFrom(r.Context()),
+		},
+	})
+}
+
+// notFoundHandler replaces the default plain-text 404 for unknown paths.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such endpoint: "+r.URL.Path, nil)
+}
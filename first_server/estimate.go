@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Query estimates =====
+//
+// POST /estimate takes an AgenticQuery (with an optional "endpoint", otherwise routed like
+// /query) and says what running it would cost: how many records, how many backend calls, and
+// roughly how many bytes and tokens the response would be, so an agent can narrow its filters
+// first. Nothing is fetched: every unfiltered backend read is remembered as a profile, and the
+// estimate applies the query's filters to the latest one. Until a profile exists the counts are
+// null and basis is "none".
+
+// EstimateReport is the data of an /estimate response.
+type EstimateReport struct {
+	Endpoint          string   `json:"endpoint"`
+	RecordCount       *int     `json:"record_count"`
+	DownstreamCalls   int      `json:"downstream_calls"`
+	ApproxBytes       *int     `json:"approx_bytes"`
+	ApproxTokens      *int     `json:"approx_tokens"`
+	Basis             string   `json:"basis"` // "profile" or "none"
+	ProfileAgeSeconds *int64   `json:"profile_age_seconds,omitempty"`
+	Notes             []string `json:"notes,omitempty"`
+}
+
+// estimateEnvelopeBytes approximates the meta and envelope around the records.
+const estimateEnvelopeBytes = 400
+
+// largeResponseTokens is where an estimate suggests narrowing the query.
+const largeResponseTokens = 8000
+
+// profilingSource remembers the result of every unfiltered read for estimates.
+type profilingSource struct {
+	inner  CostSource
+	fanout int // backend calls per read: more than one for merged sources
+
+	mu            sync.Mutex
+	allocations   []Allocation
+	allocationsAt time.Time
+	cloudCosts    []CloudCost
+	cloudCostsAt  time.Time
+	assets        []Asset
+	assetsAt      time.Time
+}
+
+var profiles *profilingSource
+
+// enableProfiling wraps costSource so reads feed /estimate. Call it once the source is chosen.
+func enableProfiling() {
+	fanout := 1
+	if m, ok := costSource.(*multiSource); ok {
+		fanout = len(m.sources)
+	}
+	profiles = &profilingSource{inner: costSource, fanout: fanout}
+	costSource = profiles
+}
+
+func (s *profilingSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	data, err := s.inner.GetCloudCosts(ctx, f)
+	if err == nil && f == (CloudCostFilter{}) && !explainFrom(ctx).dryRun() {
+		s.mu.Lock()
+		s.cloudCosts, s.cloudCostsAt = data, time.Now()
+		s.mu.Unlock()
+	}
+	return data, err
+}
+
+func (s *profilingSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	data, err := s.inner.GetAllocations(ctx, f)
+	if err == nil && f == (AllocationFilter{}) && !explainFrom(ctx).dryRun() {
+		s.mu.Lock()
+		s.allocations, s.allocationsAt = data, time.Now()
+		s.mu.Unlock()
+	}
+	return data, err
+}
+
+func (s *profilingSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	data, err := s.inner.GetAssets(ctx, f)
+	if err == nil && f == (AssetFilter{}) && !explainFrom(ctx).dryRun() {
+		s.mu.Lock()
+		s.assets, s.assetsAt = data, time.Now()
+		s.mu.Unlock()
+	}
+	return data, err
+}
+
+// estimateHandler handles POST /estimate.
+func estimateHandler(w http.ResponseWriter, r *http.Request) {
+	var q BatchQuery
+	if !decodeJSON(w, r, &q) {
+		return
+	}
+	var verrs ValidationErrors
+	q.Endpoint = resolveEndpoint(&verrs, "endpoint", q.Endpoint, &q.AgenticQuery)
+	f := q.Filters
+	f.Namespace = resolveAliases(r.Context(), "namespace", f.Namespace)
+	f.Provider = resolveAliases(r.Context(), "provider", f.Provider)
+	f.Region = resolveAliases(r.Context(), "region", f.Region)
+	nsFilter := parseNamespaceFilter(&verrs, "namespace", f.Namespace)
+	loc := loadTimezone(&verrs, "timezone", f.Timezone)
+	start, end := f.Start, f.End
+	if q.Endpoint == "allocations" {
+		applyWindow(&verrs, f.Window, q.Query, &start, &end, time.Now(), loc)
+		validateWindow(&verrs, start, end)
+		validateResolution(&verrs, f.Resolution)
+	}
+	validateProvider(&verrs, f.Provider)
+	validateSummarize(&verrs, &q.Summarize)
+	q.ResponseBudget.validate(&verrs)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	report := EstimateReport{Endpoint: q.Endpoint, DownstreamCalls: 1, Basis: "none"}
+	fanout := 1
+	if profiles != nil {
+		fanout = profiles.fanout
+	}
+	var matched interface{}
+	var count int
+	var at time.Time
+	tenant := tenantFrom(r.Context())
+	if profiles != nil {
+		profiles.mu.Lock()
+		switch q.Endpoint {
+		case "allocations":
+			startTime, _ := parseDate(start)
+			endTime, _ := parseDate(end)
+			var allocs []Allocation
+			allocFilter := nsFilter.withDefaultExclusions()
+			for _, a := range profiles.allocations {
+				if allocFilter.matches(a.Namespace) && inWindow(a, startTime, endTime) && (tenant == nil || tenant.allowsNamespace(a.Namespace)) {
+					allocs = append(allocs, a)
+				}
+			}
+			matched, count, at = allocs, len(allocs), profiles.allocationsAt
+			if len(q.Enrich) > 0 || q.IncludeCarbon {
+				report.DownstreamCalls++ // assets
+			}
+			if q.Summarize != SummarizeOff && start != "" && end != "" {
+				report.DownstreamCalls++ // baseline window for the summary's changes
+			}
+		case "cloudCosts":
+			var costs []CloudCost
+			for _, c := range profiles.cloudCosts {
+				if nsFilter.matchesName(c.Name) && (tenant == nil || tenant.namespaces.matchesName(c.Name)) {
+					costs = append(costs, c)
+				}
+			}
+			matched, count, at = costs, len(costs), profiles.cloudCostsAt
+		case "assets":
+			var assets []Asset
+			for _, a := range profiles.assets {
+				if (f.Provider == "" || strings.EqualFold(a.Provider, f.Provider)) && (f.Region == "" || strings.EqualFold(a.Region, f.Region)) &&
+					(tenant == nil || tenant.allowsProvider(a.Provider)) {
+					assets = append(assets, a)
+				}
+			}
+			matched, count, at = assets, len(assets), profiles.assetsAt
+		}
+		profiles.mu.Unlock()
+	}
+	report.DownstreamCalls *= fanout
+
+	if !at.IsZero() {
+		raw, _ := json.Marshal(matched)
+		size := len(raw) + estimateEnvelopeBytes
+		switch {
+		case q.Summarize == SummarizeOnly:
+			size = estimateEnvelopeBytes + 600
+		case q.Endpoint == "allocations" && f.Resolution != "":
+			size = estimateEnvelopeBytes + seriesBytes(matched.([]Allocation), f.Resolution, start, end)
+			report.Notes = append(report.Notes, "time series: one entry per namespace and bucket")
+		}
+		if limit := q.ResponseBudget.limit(); limit > 0 && size > limit {
+			size = limit
+			report.Notes = append(report.Notes, "capped by the response budget; the cheapest records would be dropped")
+		}
+		tokens := size / bytesPerToken
+		age := int64(time.Since(at).Seconds())
+		report.RecordCount, report.ApproxBytes, report.ApproxTokens = &count, &size, &tokens
+		report.Basis, report.ProfileAgeSeconds = "profile", &age
+		if tokens > largeResponseTokens {
+			report.Notes = append(report.Notes, "large response; narrow the namespace or window, or set max_tokens")
+		}
+	} else {
+		report.Notes = append(report.Notes, "no profile yet; run an unfiltered /"+q.Endpoint+" once to enable estimates")
+	}
+
+	logf(r.Context(), "[MCP] /estimate — %s: basis %s, %d downstream call(s)\n", q.Endpoint, report.Basis, report.DownstreamCalls)
+	meta := map[string]interface{}{"request_id": requestIDFrom(r.Context())}
+	if q.Endpoint == "allocations" {
+		noteDefaultExclusions(meta, nsFilter.withDefaultExclusions())
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": report, "meta": meta})
+}
+
+// seriesBytes approximates a time-series response: one point per namespace and bucket.
+func seriesBytes(allocs []Allocation, resolution, start, end string) int {
+	namespaces := map[string]bool{}
+	for _, a := range allocs {
+		namespaces[a.Namespace] = true
+	}
+	bucket := 24 * time.Hour
+	if resolution == "hour" {
+		bucket = time.Hour
+	}
+	buckets := 1
+	startTime, _ := parseDate(start)
+	endTime, _ := parseDate(end)
+	if !startTime.IsZero() && endTime.After(startTime) {
+		buckets = int(endTime.Sub(startTime)/bucket) + 1
+	}
+	const pointBytes, seriesHeaderBytes = 90, 60
+	return len(namespaces) * (seriesHeaderBytes + buckets*pointBytes)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// ===== ETags =====
+//
+// Read endpoints answer with a weak ETag computed over the response minus the fields that
+// change on every call (request ID, session history), so the same filters over the same data
+// give the same tag. A request whose If-None-Match lists that tag gets 304 and no body. POST
+// queries count too: they only read, and polling agents and `costs --watch` send them.
+
+// volatileMeta are meta keys left out of the ETag.
+var volatileMeta = []string{"request_id", "session_id", "previous_query", "conversation_context", "session_stats", "snapshot_id", "next_token"}
+
+// withETag buffers h's response to tag it. Only 200 responses are tagged.
+func withETag(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		h(rec, r)
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		if rec.Code == http.StatusOK {
+			tag := responseETag(rec.Header().Get("Content-Type"), rec.Body.Bytes())
+			w.Header().Set("ETag", tag)
+			if etagMatches(r.Header.Get("If-None-Match"), tag) {
+				logf(r.Context(), "[MCP] %s — not modified (%s)\n", r.URL.Path, tag)
+				w.Header().Del("Content-Type")
+				w.Header().Del("Content-Length")
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+	}
+}
+
+// responseETag hashes a response body. JSON bodies are hashed without volatileMeta; anything
+// else (CSV reports) is hashed as is.
+func responseETag(contentType string, body []byte) string {
+	normalized := body
+	var resp map[string]interface{}
+	if strings.HasPrefix(contentType, "application/json") && json.Unmarshal(body, &resp) == nil {
+		if meta, ok := resp["meta"].(map[string]interface{}); ok {
+			for _, k := range volatileMeta {
+				delete(meta, k)
+			}
+		}
+		normalized, _ = json.Marshal(resp) // map keys are sorted, so equal responses hash equally
+	}
+	sum := sha256.Sum256(bytes.TrimSpace(normalized))
+	return `W/"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists tag, comparing weakly.
+func etagMatches(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, t := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ===== Query explanations =====
+//
+// explain=true (a query parameter, or "explain": true in a POST body) on /allocations,
+// /cloudCosts, /assets and /query adds meta.explain: how the server read the request, for
+// debugging an agent that gets answers it didn't expect.
+//
+//	intents        what was taken from the question text: the route and extracted filters on
+//	               /query, a window phrase such as "last week"
+//	session        the session's previous query, the filters it last sent to the endpoint and
+//	               the filters inherited from them through references like "that region"
+//	filters        the filters as applied: namespace terms, default exclusions, what was sent
+//	               to the backend, the resolved window, timezone and expr
+//	backend_calls  each downstream read: URL, whether the cache answered, outcome, duration
+//	               and records kept
+//	steps          the local filter steps with the records going in and coming out
+//
+// The explanation describes the request; the answer is the same as without it.
+//
+// dry_run=true (or "dry_run": true) goes further: the request is validated and explained,
+// but nothing is fetched. Each downstream request it would make is listed in backend_calls
+// with outcome "planned", data is empty and meta.dry_run is true. Reads the backend cache
+// can answer are still answered, as they cost nothing. A dry run isn't recorded in the
+// session, and can't be combined with snapshot, delta or since_token. Calls that depend on
+// fetched records (the grand total of a filtered answer, say) may be missing from the plan.
+
+// Explanation is meta.explain.
+type Explanation struct {
+	Endpoint     string                 `json:"endpoint"`
+	DryRun       bool                   `json:"dry_run,omitempty"`
+	Intents      map[string]interface{} `json:"intents"`
+	Session      *ExplainSession        `json:"session,omitempty"`
+	Filters      map[string]interface{} `json:"filters"`
+	BackendCalls []ExplainCall          `json:"backend_calls"`
+	Steps        []ExplainStep          `json:"steps"`
+
+	mu sync.Mutex
+}
+
+// ExplainSession is the session part of an explanation.
+type ExplainSession struct {
+	ID            string            `json:"id"`
+	PreviousQuery string            `json:"previous_query,omitempty"`
+	LastFilters   *QueryFilters     `json:"last_filters,omitempty"` // sent to this endpoint by the previous request
+	Inherited     map[string]string `json:"inherited"`
+}
+
+// ExplainCall is one downstream read.
+type ExplainCall struct {
+	Data       string  `json:"data"`
+	Method     string  `json:"method"`
+	URL        string  `json:"url"`
+	Cached     bool    `json:"cached"`
+	Outcome    string  `json:"outcome"` // ok, error, canceled or, in a dry run, planned
+	DurationMS float64 `json:"duration_ms"`
+	Records    *int    `json:"records,omitempty"` // kept from the response; unknown for non-record reads
+	Error      string  `json:"error,omitempty"`
+}
+
+// ExplainStep is one local filter step.
+type ExplainStep struct {
+	Step   string `json:"step"`
+	In     int    `json:"in"`
+	Out    int    `json:"out"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// startExplain turns on the explanation for the request in ctx, reading the session before
+// the request is recorded in it. It returns nil outside withWarnings.
+func startExplain(ctx context.Context, endpoint string, aq AgenticQuery) *Explanation {
+	list, _ := ctx.Value(warningsKey{}).(*warningList)
+	if list == nil {
+		return nil
+	}
+	e := &Explanation{
+		Endpoint:     endpoint,
+		DryRun:       aq.DryRun,
+		Intents:      map[string]interface{}{},
+		Filters:      map[string]interface{}{},
+		BackendCalls: []ExplainCall{},
+		Steps:        []ExplainStep{},
+	}
+	if aq.Query != "" {
+		e.Intents["query"] = aq.Query
+	}
+	if id := aq.Context.SessionID; id != "" {
+		e.Session = &ExplainSession{ID: id, Inherited: map[string]string{}}
+		sessionsMu.Lock()
+		if s, ok := sessions[id]; ok {
+			if n := len(s.Queries); n > 0 {
+				e.Session.PreviousQuery = s.Queries[n-1]
+			}
+			if f, ok := s.EffectiveFilters[endpoint]; ok {
+				e.Session.LastFilters = &f
+			}
+		}
+		sessionsMu.Unlock()
+	}
+	list.mu.Lock()
+	list.explain = e
+	list.mu.Unlock()
+	return e
+}
+
+// explainQuery starts the explanation when the query string asks for explain=true or
+// dry_run=true, for GET requests; POST bodies are checked by the handler.
+func explainQuery(r *http.Request, endpoint string) *Explanation {
+	q := r.URL.Query()
+	aq := AgenticQuery{Explain: q.Get("explain") == "true", DryRun: q.Get("dry_run") == "true"}
+	if !aq.Explain && !aq.DryRun {
+		return nil
+	}
+	return startExplain(r.Context(), endpoint, aq)
+}
+
+// dryRun reports whether the explained request is a dry run.
+func (e *Explanation) dryRun() bool { return e != nil && e.DryRun }
+
+// validateDryRun rejects a dry run that would change state.
+func (e *Explanation) validateDryRun(errs *ValidationErrors, snapshot, delta bool) {
+	if e.dryRun() && (snapshot || delta) {
+		errs.add("dry_run", "true", "cannot be combined with snapshot, delta or since_token")
+	}
+}
+
+// plannedBackendCall records a downstream request instead of making it when the request in
+// ctx is a dry run, and reports whether it did.
+func plannedBackendCall(ctx context.Context, what, method, rawURL string) bool {
+	e := explainFrom(ctx)
+	if !e.dryRun() {
+		return false
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		rawURL = u.Redacted()
+	}
+	logf(ctx, "[MCP Client] Dry run, not fetching: %s %s\n", method, rawURL)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.BackendCalls = append(e.BackendCalls, ExplainCall{Data: what, Method: method, URL: rawURL, Outcome: "planned"})
+	return true
+}
+
+// explainFrom returns the request's explanation, or nil when explain wasn't asked for.
+func explainFrom(ctx context.Context) *Explanation {
+	list, _ := ctx.Value(warningsKey{}).(*warningList)
+	if list == nil {
+		return nil
+	}
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	return list.explain
+}
+
+// filter records an applied filter; an empty string is no filter. A nil explanation ignores
+// it, like the methods below.
+func (e *Explanation) filter(name string, v interface{}) {
+	if e == nil || v == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Filters[name] = v
+}
+
+// intent records something taken from the question text.
+func (e *Explanation) intent(name string, v interface{}) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Intents[name] = v
+}
+
+// window records the resolved window, and the phrase when it came from the question.
+func (e *Explanation) window(w *ResolvedWindow, start, end string) {
+	if w != nil && w.Source == "query" {
+		e.intent("window", w.Input)
+	}
+	e.filter("window", map[string]string{"start": start, "end": end})
+}
+
+// namespaces records how a namespace filter reads.
+func (e *Explanation) namespaces(f namespaceFilter) {
+	if e == nil || f.raw == "" && f.appliedDefaults() == nil {
+		return
+	}
+	terms := func(ts []nsTerm) []string {
+		out := make([]string, len(ts))
+		for i, t := range ts {
+			out[i] = t.String()
+		}
+		return out
+	}
+	ns := map[string]interface{}{
+		"raw":             f.raw,
+		"include":         terms(f.includes),
+		"exclude":         terms(f.excludes),
+		"sent_to_backend": f.pushdown(),
+	}
+	if defaults := f.appliedDefaults(); defaults != nil {
+		ns["default_exclusions"] = defaults
+	}
+	e.filter("namespace", ns)
+}
+
+// step records a local filter step.
+func (e *Explanation) step(name string, in, out int, detail string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.Steps = append(e.Steps, ExplainStep{Step: name, In: in, Out: out, Detail: detail})
+}
+
+// explainBackendCall records a downstream read for the request in ctx, if it is explained.
+// records is -1 when the read isn't a record list.
+func explainBackendCall(ctx context.Context, what, rawURL string, cached bool, d time.Duration, records int, err error) {
+	e := explainFrom(ctx)
+	if e == nil {
+		return
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		rawURL = u.Redacted() // no credentials from BACKEND_URL
+	}
+	c := ExplainCall{Data: what, Method: http.MethodGet, URL: rawURL, Cached: cached, Outcome: "ok", DurationMS: round2(float64(d) / float64(time.Millisecond))}
+	if records >= 0 && err == nil {
+		c.Records = &records
+	}
+	if err != nil {
+		c.Outcome, c.Error = "error", err.Error()
+		if errors.Is(err, context.Canceled) {
+			c.Outcome = "canceled"
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.BackendCalls = append(e.BackendCalls, c)
+}
+
+// filterStep is one predicate of a local filter, named for the explanation.
+type filterStep[T any] struct {
+	name   string
+	detail string
+	keep   func(T) bool
+}
+
+// applySteps keeps the records that pass every step, in one pass, and records in e how many
+// each step let through.
+func applySteps[T any](e *Explanation, records []T, steps ...filterStep[T]) []T {
+	out := []T{}
+	passed := make([]int, len(steps))
+	for _, rec := range records {
+		i := 0
+		for i < len(steps) && steps[i].keep(rec) {
+			passed[i]++
+			i++
+		}
+		if i == len(steps) {
+			out = append(out, rec)
+		}
+	}
+	in := len(records)
+	for i, s := range steps {
+		e.step(s.name, in, passed[i], s.detail)
+		in = passed[i]
+	}
+	return out
+}
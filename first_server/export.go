@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ===== Parquet export =====
+//
+// POST /admin/export writes the local store's allocation history (see store.go) to
+// EXPORT_DESTINATION as Parquet, for data teams loading OpenCost data into a lakehouse. The
+// destination is a local directory, s3://bucket/prefix or gs://bucket/prefix (see
+// objectstore.go). Files are partitioned Hive-style by day and namespace:
+//
+//	<destination>/day=2025-08-01/namespace=prod/allocations.parquet
+//
+// so Spark, Athena or DuckDB pick up day and namespace as partition columns. A partition is
+// rewritten whole on every export that covers it, which makes re-exporting a window safe.
+// Exports run in the background; GET /admin/export/{id} reports progress in partitions
+// written. Export state is kept in memory only: an export cut off by a restart is simply
+// started again.
+
+// ExportRequest is the body of POST /admin/export.
+type ExportRequest struct {
+	Start     string `json:"start"`               // RFC3339
+	End       string `json:"end,omitempty"`       // RFC3339, default now
+	Namespace string `json:"namespace,omitempty"` // only this namespace
+}
+
+// Export is one export run.
+type Export struct {
+	ID          string      `json:"id"`
+	Status      string      `json:"status"` // running, succeeded, failed or canceled
+	Start       time.Time   `json:"start"`
+	End         time.Time   `json:"end"`
+	Namespace   string      `json:"namespace,omitempty"`
+	Destination string      `json:"destination"`
+	Progress    JobProgress `json:"progress"` // partitions written
+	Records     int         `json:"records"`
+	Bytes       int         `json:"bytes"`
+	Error       string      `json:"error,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	FinishedAt  *time.Time  `json:"finished_at,omitempty"`
+
+	cancel context.CancelFunc
+}
+
+// exportPartition is the records of one day and namespace.
+type exportPartition struct {
+	key    string
+	allocs []Allocation
+}
+
+// exportStore holds exports in memory.
+type exportStore struct {
+	mu     sync.Mutex
+	dest   objectWriter // nil unless EXPORT_DESTINATION is set
+	items  map[string]*Export
+	target string // EXPORT_DESTINATION
+}
+
+var exports = &exportStore{items: map[string]*Export{}}
+
+// configureExports reads EXPORT_DESTINATION.
+func configureExports() error {
+	dest := os.Getenv("EXPORT_DESTINATION")
+	if dest == "" {
+		return nil
+	}
+	w, err := newObjectWriter(dest)
+	if err != nil {
+		return fmt.Errorf("EXPORT_DESTINATION: %w", err)
+	}
+	exports.dest, exports.target = w, dest
+	log.Printf("[MCP] Parquet exports go to %s\n", dest)
+	return nil
+}
+
+// exportPartitions groups allocs by UTC day of start_time and namespace, in key order.
+// Records without a start time land in day=undated.
+func exportPartitions(allocs []Allocation) []exportPartition {
+	byKey := map[string][]Allocation{}
+	for _, a := range allocs {
+		day := "undated"
+		if t, err := time.Parse(time.RFC3339, a.StartTime); err == nil {
+			day = t.UTC().Format("2006-01-02")
+		}
+		key := "day=" + day + "/namespace=" + a.Namespace + "/allocations.parquet"
+		byKey[key] = append(byKey[key], a)
+	}
+	parts := make([]exportPartition, 0, len(byKey))
+	for key, list := range byKey {
+		parts = append(parts, exportPartition{key: key, allocs: list})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].key < parts[j].key })
+	return parts
+}
+
+// update runs fn on the export under the lock.
+func (s *exportStore) update(e *Export, fn func(*Export)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(e)
+}
+
+// run writes each partition in turn.
+func (s *exportStore) run(ctx context.Context, e *Export, parts []exportPartition) {
+	for _, p := range parts {
+		if ctx.Err() != nil {
+			s.finish(ctx, e, jobCanceled, "canceled before "+p.key)
+			return
+		}
+		var buf bytes.Buffer
+		if err := writeParquet(&buf, p.allocs); err != nil {
+			s.finish(ctx, e, jobFailed, fmt.Sprintf("encoding %s: %v", p.key, err))
+			return
+		}
+		putCtx, cancel := context.WithTimeout(ctx, handlerTimeout)
+		err := s.dest.put(putCtx, p.key, buf.Bytes(), "application/vnd.apache.parquet")
+		cancel()
+		if err != nil {
+			s.finish(ctx, e, jobFailed, fmt.Sprintf("writing %s: %v", s.dest.location(p.key), err))
+			return
+		}
+		s.update(e, func(e *Export) {
+			e.Records += len(p.allocs)
+			e.Bytes += buf.Len()
+			e.Progress.Completed++
+			e.Progress.Percent = round2(100 * float64(e.Progress.Completed) / float64(e.Progress.Total))
+			e.Progress.Current = p.key
+		})
+	}
+	s.finish(ctx, e, jobSucceeded, "")
+}
+
+// finish records the export's final status.
+func (s *exportStore) finish(ctx context.Context, e *Export, status, msg string) {
+	now := time.Now().UTC()
+	var records, files int
+	s.update(e, func(e *Export) {
+		e.Status, e.Error, e.FinishedAt = status, msg, &now
+		e.Progress.Current = ""
+		records, files = e.Records, e.Progress.Completed
+	})
+	logf(ctx, "[MCP] Export %s %s (%d records in %d files)\n", e.ID, status, records, files)
+}
+
+// ===== /admin/export API =====
+
+// createExportHandler handles POST /admin/export.
+func createExportHandler(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "local store is disabled; set LOCAL_STORE_DIR to enable it", nil)
+		return
+	}
+	if exports.dest == nil {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "exports are disabled; set EXPORT_DESTINATION to enable them", nil)
+		return
+	}
+	var req ExportRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	now := time.Now().UTC()
+	if req.End == "" {
+		req.End = now.Format(time.RFC3339)
+	}
+	var verrs ValidationErrors
+	if req.Start == "" {
+		verrs.add("start", "", "is required")
+	}
+	validateWindow(&verrs, req.Start, req.End)
+	start, _ := parseDate(req.Start)
+	end, _ := parseDate(req.End)
+	if len(verrs) == 0 && !end.After(start) {
+		verrs.add("end", req.End, "must be after start")
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	allocs := store.query(AllocationFilter{Start: req.Start, End: req.End, Namespace: req.Namespace})
+	parts := exportPartitions(allocs)
+	e := &Export{
+		ID:          "export-" + newRequestID()[:12],
+		Status:      jobRunning,
+		Start:       start.UTC(),
+		End:         end.UTC(),
+		Namespace:   req.Namespace,
+		Destination: exports.target,
+		Progress:    JobProgress{Total: len(parts)},
+		CreatedAt:   now,
+	}
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	e.cancel = cancel
+	exports.mu.Lock()
+	exports.items[e.ID] = e
+	view := *e
+	exports.mu.Unlock()
+	go exports.run(ctx, e, parts)
+
+	logf(r.Context(), "[MCP] Export %s started: %d records in %d partitions to %s\n", e.ID, len(allocs), len(parts), exports.target)
+	w.Header().Set("Location", "/admin/export/"+e.ID)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": view,
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// listExportsHandler handles GET /admin/export, newest first.
+func listExportsHandler(w http.ResponseWriter, r *http.Request) {
+	exports.mu.Lock()
+	list := make([]Export, 0, len(exports.items))
+	for _, e := range exports.items {
+		list = append(list, *e)
+	}
+	exports.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": list,
+		"meta": map[string]interface{}{"total": len(list), "request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// getExportHandler handles GET /admin/export/{id}.
+func getExportHandler(w http.ResponseWriter, r *http.Request) {
+	exports.mu.Lock()
+	e, ok := exports.items[r.PathValue("id")]
+	var view Export
+	if ok {
+		view = *e
+	}
+	exports.mu.Unlock()
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such export: "+r.PathValue("id"), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": view,
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// cancelExportHandler handles DELETE /admin/export/{id}. Partitions already written stay.
+func cancelExportHandler(w http.ResponseWriter, r *http.Request) {
+	exports.mu.Lock()
+	e, ok := exports.items[r.PathValue("id")]
+	var status string
+	if ok {
+		status = e.Status
+	}
+	exports.mu.Unlock()
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such export: "+r.PathValue("id"), nil)
+		return
+	}
+	if status != jobRunning {
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "export "+e.ID+" already "+status, nil)
+		return
+	}
+	e.cancel()
+	logf(r.Context(), "[MCP] Export %s cancel requested\n", e.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
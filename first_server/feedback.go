@@ -0,0 +1,273 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== Query feedback =====
+//
+// Clients rate answers so the question parsing can be improved from real use. POST /feedback
+// ties a rating to a query by its request ID (meta.request_id of the response) in a session:
+//
+//	{"request_id": "9f2c...", "session_id": "s1", "rating": "down",
+//	 "correction": {"endpoint": "assets", "filters": {"provider": "AWS"}}, "comment": "meant AWS"}
+//
+// rating is up or down; a correction (the endpoint and filters the question should have been
+// read as) implies down. Feedback is kept in the session next to the request it rates, with
+// the question, endpoint and filters as the server read them, so a correction can be diffed
+// against the reading. Rating a request again replaces the earlier feedback. Feedback goes
+// when the session does.
+//
+// GET /feedback/stats aggregates it: ratings overall and per endpoint, and which filters
+// corrections changed most. GET /admin/feedback lists the entries, newest first, for review.
+
+// maxQueryLog bounds the requests a session remembers for feedback.
+const maxQueryLog = 100
+
+// QueryRecord is one request in a session's query log.
+type QueryRecord struct {
+	RequestID string       `json:"request_id"`
+	Endpoint  string       `json:"endpoint"`
+	Query     string       `json:"query,omitempty"`
+	Filters   QueryFilters `json:"filters"`
+	At        time.Time    `json:"at"`
+}
+
+// FeedbackCorrection is how a query should have been read.
+type FeedbackCorrection struct {
+	Endpoint string        `json:"endpoint,omitempty"`
+	Filters  *QueryFilters `json:"filters,omitempty"`
+}
+
+// QueryFeedback is one rating of a query.
+type QueryFeedback struct {
+	RequestID  string              `json:"request_id"`
+	SessionID  string              `json:"session_id"`
+	Rating     string              `json:"rating"` // up or down
+	Correction *FeedbackCorrection `json:"correction,omitempty"`
+	Comment    string              `json:"comment,omitempty"`
+	CreatedAt  time.Time           `json:"created_at"`
+	// The rated request as the server read it
+	Endpoint string       `json:"endpoint"`
+	Query    string       `json:"query,omitempty"`
+	Filters  QueryFilters `json:"filters"`
+}
+
+// maxFeedbackComment bounds the free text kept with a rating.
+const maxFeedbackComment = 2000
+
+// postFeedbackHandler handles POST /feedback.
+func postFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	var fb QueryFeedback
+	if !decodeJSON(w, r, &fb) {
+		return
+	}
+	if fb.Correction != nil && fb.Rating == "" {
+		fb.Rating = "down"
+	}
+	var verrs ValidationErrors
+	if fb.RequestID == "" {
+		verrs.add("request_id", "", "is required")
+	}
+	if fb.SessionID == "" {
+		verrs.add("session_id", "", "is required")
+	}
+	switch {
+	case fb.Rating != "up" && fb.Rating != "down":
+		verrs.add("rating", fb.Rating, "must be up or down")
+	case fb.Rating == "up" && fb.Correction != nil:
+		verrs.add("correction", "", "only goes with rating down")
+	}
+	if c := fb.Correction; c != nil {
+		if c.Endpoint == "" && c.Filters == nil {
+			verrs.add("correction", "", "needs an endpoint or filters")
+		}
+		if _, ok := queryEndpoints[c.Endpoint]; c.Endpoint != "" && !ok {
+			verrs.add("correction.endpoint", c.Endpoint, "must be one of allocations, cloudCosts, assets")
+		}
+		if c.Filters != nil {
+			parseNamespaceFilter(&verrs, "correction.filters.namespace", c.Filters.Namespace)
+			validateProvider(&verrs, c.Filters.Provider)
+		}
+	}
+	if len(fb.Comment) > maxFeedbackComment {
+		verrs.add("comment", "", "must be at most "+strconv.Itoa(maxFeedbackComment)+" bytes")
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	sessionsMu.Lock()
+	s, ok := sessions[fb.SessionID]
+	if !ok || s.tenant != tenantName(r.Context()) {
+		sessionsMu.Unlock()
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such session: "+fb.SessionID, nil)
+		return
+	}
+	i := slices.IndexFunc(s.QueryLog, func(q QueryRecord) bool { return q.RequestID == fb.RequestID })
+	if i < 0 {
+		sessionsMu.Unlock()
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "session "+fb.SessionID+" has no recent query with request_id "+fb.RequestID, nil)
+		return
+	}
+	q := s.QueryLog[i]
+	fb.Endpoint, fb.Query, fb.Filters = q.Endpoint, q.Query, q.Filters
+	fb.CreatedAt = time.Now().UTC()
+	replaced := false
+	for j := range s.Feedback {
+		if s.Feedback[j].RequestID == fb.RequestID {
+			s.Feedback[j], replaced = fb, true
+		}
+	}
+	if !replaced {
+		s.Feedback = append(s.Feedback, fb)
+	}
+	sessionsMu.Unlock()
+
+	logf(r.Context(), "[MCP] Feedback %s on %s (session %s, /%s)\n", fb.Rating, fb.RequestID, fb.SessionID, fb.Endpoint)
+	status := http.StatusCreated
+	if replaced {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"data": fb,
+		"meta": map[string]interface{}{"replaced": replaced, "request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// allFeedback returns the feedback of every session, or of one, newest first.
+func allFeedback(sessionID string) []QueryFeedback {
+	sessionsMu.Lock()
+	out := []QueryFeedback{}
+	for id, s := range sessions {
+		if sessionID == "" || id == sessionID {
+			out = append(out, s.Feedback...)
+		}
+	}
+	sessionsMu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+// FeedbackCounts tallies ratings.
+type FeedbackCounts struct {
+	Total       int     `json:"total"`
+	Up          int     `json:"up"`
+	Down        int     `json:"down"`
+	Corrections int     `json:"corrections"`
+	Approval    float64 `json:"approval"` // share rated up
+}
+
+func (c *FeedbackCounts) add(fb QueryFeedback) {
+	c.Total++
+	if fb.Rating == "up" {
+		c.Up++
+	} else {
+		c.Down++
+	}
+	if fb.Correction != nil {
+		c.Corrections++
+	}
+	c.Approval = round2(float64(c.Up) / float64(c.Total))
+}
+
+// correctedFields names what a correction changed from the reading: the endpoint and each
+// filter it set to a different value.
+func correctedFields(fb QueryFeedback) []string {
+	c := fb.Correction
+	if c == nil {
+		return nil
+	}
+	var fields []string
+	if c.Endpoint != "" && c.Endpoint != fb.Endpoint {
+		fields = append(fields, "endpoint")
+	}
+	if f := c.Filters; f != nil {
+		read := fb.Filters
+		for _, d := range []struct {
+			name       string
+			want, read string
+		}{
+			{"namespace", f.Namespace, read.Namespace},
+			{"start", f.Start, read.Start},
+			{"end", f.End, read.End},
+			{"window", f.Window, read.Window},
+			{"timezone", f.Timezone, read.Timezone},
+			{"provider", f.Provider, read.Provider},
+			{"region", f.Region, read.Region},
+			{"resolution", f.Resolution, read.Resolution},
+			{"expr", f.Expr, read.Expr},
+		} {
+			if d.want != "" && !strings.EqualFold(d.want, d.read) {
+				fields = append(fields, d.name)
+			}
+		}
+	}
+	return fields
+}
+
+// feedbackStatsHandler handles GET /feedback/stats, optionally for one session_id.
+func feedbackStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var overall FeedbackCounts
+	byEndpoint := map[string]*FeedbackCounts{}
+	corrected := map[string]int{}
+	for _, fb := range allFeedback(r.URL.Query().Get("session_id")) {
+		overall.add(fb)
+		if byEndpoint[fb.Endpoint] == nil {
+			byEndpoint[fb.Endpoint] = &FeedbackCounts{}
+		}
+		byEndpoint[fb.Endpoint].add(fb)
+		for _, field := range correctedFields(fb) {
+			corrected[field]++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"overall":          overall,
+			"by_endpoint":      byEndpoint,
+			"corrected_fields": corrected,
+		},
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// adminFeedbackHandler handles GET /admin/feedback: entries newest first, narrowed by
+// session_id and rating, at most limit (default 100).
+func adminFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var verrs ValidationErrors
+	rating := q.Get("rating")
+	if rating != "" && rating != "up" && rating != "down" {
+		verrs.add("rating", rating, "must be up or down")
+	}
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			verrs.add("limit", v, "must be a positive integer")
+		}
+		limit = n
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	list := []QueryFeedback{}
+	for _, fb := range allFeedback(q.Get("session_id")) {
+		if rating == "" || fb.Rating == rating {
+			list = append(list, fb)
+		}
+	}
+	total := len(list)
+	list = list[:min(limit, len(list))]
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": list,
+		"meta": map[string]interface{}{"total": total, "request_id": requestIDFrom(r.Context())},
+	})
+}
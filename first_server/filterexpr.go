@@ -0,0 +1,468 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ===== Filter expressions =====
+//
+// The expr filter narrows /allocations, /cloudCosts and /assets with a boolean expression
+// over the fields of the endpoint's records, for conditions the fixed filters can't state.
+// Each endpoint has its own fields, so an expression is written for one of them:
+//
+//	/allocations  namespace=prod AND totalCost>100 AND labels.team~'^web'
+//	/cloudCosts   name~'^ec2' AND totalCost>=10
+//	/assets       provider IN (AWS,GCP) AND NOT (type=Database OR cost<=50) AND tags.env=prod
+//
+// Field names are the JSON names, matched ignoring case and underscores, so total_cost and
+// totalCost are the same field; labels.<key> reads an allocation label and tags.<key> an asset
+// tag. A field the records don't have, such as provider on /allocations, is refused with the
+// list of fields they do have. Operators are =, !=, <, <=, >, >=, IN (...), NOT IN (...) and
+// ~ (regular expression). Numeric fields compare as
+// numbers; text fields compare case-insensitively for = and IN, and in byte order otherwise,
+// which orders RFC3339 times correctly. Values may be bare words or 'quoted'/"quoted". AND
+// binds tighter than OR. Mistakes are reported with the column they were found at.
+
+// exprToken is one lexical token; pos is its 1-based column.
+type exprToken struct {
+	kind string // word, string or symbol
+	text string
+	pos  int
+}
+
+var exprTokenPattern = regexp.MustCompile(`^(?:([A-Za-z0-9_.:+\-/*]+)|'([^']*)'|"([^"]*)"|(<=|>=|!=|[=<>~(),]))`)
+
+// exprOperators are the comparison symbols; IN and NOT IN are words.
+var exprOperators = []string{"=", "!=", "<", "<=", ">", ">=", "~"}
+
+// exprError is a syntax or binding error at a column of the expression.
+type exprError struct {
+	pos int
+	msg string
+}
+
+func (e *exprError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.pos, e.msg)
+}
+
+// exprTokenize splits an expression into tokens.
+func exprTokenize(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(src); {
+		if c := src[i]; c == ' ' || c == '\t' || c == '\n' || c == '\r' {
+			i++
+			continue
+		}
+		m := exprTokenPattern.FindStringSubmatchIndex(src[i:])
+		if m == nil {
+			if src[i] == '\'' || src[i] == '"' {
+				return nil, &exprError{i + 1, "unterminated quoted value"}
+			}
+			return nil, &exprError{i + 1, fmt.Sprintf("unexpected character %q", src[i])}
+		}
+		t := exprToken{pos: i + 1}
+		switch {
+		case m[2] >= 0:
+			t.kind, t.text = "word", src[i+m[2]:i+m[3]]
+		case m[4] >= 0:
+			t.kind, t.text = "string", src[i+m[4]:i+m[5]]
+		case m[6] >= 0:
+			t.kind, t.text = "string", src[i+m[6]:i+m[7]]
+		default:
+			t.kind, t.text = "symbol", src[i+m[8]:i+m[9]]
+		}
+		tokens = append(tokens, t)
+		i += m[1]
+	}
+	return tokens, nil
+}
+
+// ----- Fields -----
+
+// exprField is a record field an expression can read.
+type exprField struct {
+	name    string // JSON name
+	index   int
+	numeric bool
+}
+
+// exprFields lists the string and number fields of a record type by normalized name.
+func exprFields(t reflect.Type) map[string]exprField {
+	fields := map[string]exprField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		switch f.Type.Kind() {
+		case reflect.String:
+			fields[normalizeExprField(name)] = exprField{name: name, index: i}
+		case reflect.Float64:
+			fields[normalizeExprField(name)] = exprField{name: name, index: i, numeric: true}
+		}
+	}
+	return fields
+}
+
+func normalizeExprField(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// exprLabels finds the key/value map of a record type (an allocation's labels, an asset's
+// tags); its name is empty when there is none.
+func exprLabels(t reflect.Type) exprField {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.Type == reflect.TypeOf(map[string]string(nil)) && name != "" && name != "-" {
+			return exprField{name: name, index: i}
+		}
+	}
+	return exprField{}
+}
+
+// suggestExprField names the known field closest to name, or lists them all.
+func suggestExprField(name string, fields map[string]exprField, labels string) string {
+	want := normalizeExprField(name)
+	best, bestDist := "", 3
+	var names []string
+	for norm, f := range fields {
+		names = append(names, f.name)
+		if d := editDistance(want, norm); d < bestDist {
+			best, bestDist = f.name, d
+		}
+	}
+	if best != "" {
+		return "; did you mean " + best + "?"
+	}
+	sort.Strings(names)
+	if labels != "" {
+		names = append(names, labels+".<key>")
+	}
+	return "; fields are " + strings.Join(names, ", ")
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// ----- Parsing -----
+
+// exprNode is a parsed expression, evaluated against a record's struct value.
+type exprNode interface {
+	eval(rec reflect.Value) bool
+}
+
+type exprAnd struct{ left, right exprNode }
+type exprOr struct{ left, right exprNode }
+type exprNot struct{ inner exprNode }
+
+func (e exprAnd) eval(rec reflect.Value) bool { return e.left.eval(rec) && e.right.eval(rec) }
+func (e exprOr) eval(rec reflect.Value) bool  { return e.left.eval(rec) || e.right.eval(rec) }
+func (e exprNot) eval(rec reflect.Value) bool { return !e.inner.eval(rec) }
+
+// exprCmp compares one field with one or more values.
+type exprCmp struct {
+	field   exprField
+	label   string // the key of labels.<key> or tags.<key>; field is then the map
+	op      string // =, !=, <, <=, >, >=, in, not in or ~
+	strs    []string
+	nums    []float64
+	pattern *regexp.Regexp
+}
+
+// filterExpr is a parsed expression bound to one record type. A nil filterExpr matches
+// everything.
+type filterExpr struct {
+	root exprNode
+}
+
+// exprParser is a recursive-descent parser over the tokens.
+type exprParser struct {
+	tokens []exprToken
+	i      int
+	end    int // column just past the expression, for errors at the end
+	fields map[string]exprField
+	labels exprField // the record's labels or tags; see exprLabels
+}
+
+func (p *exprParser) peek() (exprToken, bool) {
+	if p.i < len(p.tokens) {
+		return p.tokens[p.i], true
+	}
+	return exprToken{pos: p.end}, false
+}
+
+// keyword reports whether the next token is the bare word kw, consuming it if so.
+func (p *exprParser) keyword(kw string) bool {
+	if t, ok := p.peek(); ok && t.kind == "word" && strings.EqualFold(t.text, kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) symbol(s string) bool {
+	if t, ok := p.peek(); ok && t.kind == "symbol" && t.text == s {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// errorf reports a problem at the next token, naming what was found there.
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	t, ok := p.peek()
+	msg := fmt.Sprintf(format, args...)
+	if !ok {
+		return &exprError{t.pos, msg + ", got end of expression"}
+	}
+	return &exprError{t.pos, fmt.Sprintf("%s, got %q", msg, t.text)}
+}
+
+// parseFilterExpr parses src and binds it to the fields of record, e.g. Allocation{}.
+// An empty src yields a nil filterExpr.
+func parseFilterExpr(src string, record interface{}) (*filterExpr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	tokens, err := exprTokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	t := reflect.TypeOf(record)
+	p := &exprParser{tokens: tokens, end: len(src) + 1, fields: exprFields(t), labels: exprLabels(t)}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if _, more := p.peek(); more {
+		return nil, p.errorf("expected AND, OR or the end of the expression")
+	}
+	return &filterExpr{root: root}, nil
+}
+
+func (p *exprParser) or() (exprNode, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("or") {
+		var right exprNode
+		if right, err = p.and(); err == nil {
+			left = exprOr{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) and() (exprNode, error) {
+	left, err := p.unary()
+	for err == nil && p.keyword("and") {
+		var right exprNode
+		if right, err = p.unary(); err == nil {
+			left = exprAnd{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *exprParser) unary() (exprNode, error) {
+	if p.keyword("not") {
+		inner, err := p.unary()
+		return exprNot{inner}, err
+	}
+	if p.symbol("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.symbol(")") {
+			return nil, p.errorf("expected )")
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses field op value(s) and checks the values against the field's type.
+func (p *exprParser) comparison() (exprNode, error) {
+	t, ok := p.peek()
+	if !ok || t.kind != "word" {
+		return nil, p.errorf("expected a field name")
+	}
+	p.i++
+	c := &exprCmp{}
+	if key, isLabel := cutPrefixFold(t.text, p.labels.name+"."); isLabel && p.labels.name != "" {
+		if key == "" {
+			return nil, &exprError{t.pos, fmt.Sprintf("%s. needs a key, e.g. %s.team", p.labels.name, p.labels.name)}
+		}
+		c.field, c.label = p.labels, key
+	} else if f, known := p.fields[normalizeExprField(t.text)]; known {
+		c.field = f
+	} else {
+		return nil, &exprError{t.pos, fmt.Sprintf("unknown field %q%s", t.text, suggestExprField(t.text, p.fields, p.labels.name))}
+	}
+	name := t.text
+
+	opTok, _ := p.peek()
+	switch {
+	case p.keyword("in"):
+		c.op = "in"
+	case p.keyword("not"):
+		if !p.keyword("in") {
+			return nil, p.errorf("expected IN after %s NOT", name)
+		}
+		c.op = "not in"
+	case opTok.kind == "symbol" && slices.Contains(exprOperators, opTok.text):
+		p.i++
+		c.op = opTok.text
+	default:
+		return nil, p.errorf("expected an operator (=, !=, <, <=, >, >=, ~, IN or NOT IN) after %s", name)
+	}
+
+	var values []exprToken
+	value := func() error {
+		v, ok := p.peek()
+		if !ok || v.kind == "symbol" || v.kind == "word" && (strings.EqualFold(v.text, "and") || strings.EqualFold(v.text, "or")) {
+			return p.errorf("expected a value after %s %s", name, strings.ToUpper(c.op))
+		}
+		p.i++
+		values = append(values, v)
+		return nil
+	}
+	if c.op == "in" || c.op == "not in" {
+		if !p.symbol("(") {
+			return nil, p.errorf("expected ( after %s", strings.ToUpper(c.op))
+		}
+		for {
+			if err := value(); err != nil {
+				return nil, err
+			}
+			if !p.symbol(",") {
+				break
+			}
+		}
+		if !p.symbol(")") {
+			return nil, p.errorf("expected , or ) in the %s list", strings.ToUpper(c.op))
+		}
+	} else if err := value(); err != nil {
+		return nil, err
+	}
+
+	numeric := c.label == "" && c.field.numeric
+	for _, v := range values {
+		switch {
+		case c.op == "~":
+			if numeric {
+				return nil, &exprError{opTok.pos, name + " is a number; ~ matches text fields"}
+			}
+			re, err := regexp.Compile("(?i)" + v.text)
+			if err != nil {
+				return nil, &exprError{v.pos, "invalid regular expression: " + err.Error()}
+			}
+			c.pattern = re
+		case numeric:
+			n, err := strconv.ParseFloat(v.text, 64)
+			if err != nil {
+				return nil, &exprError{v.pos, fmt.Sprintf("%s is a number, got %q", name, v.text)}
+			}
+			c.nums = append(c.nums, n)
+		default:
+			c.strs = append(c.strs, v.text)
+		}
+	}
+	return c, nil
+}
+
+// ----- Evaluation -----
+
+func (c *exprCmp) eval(rec reflect.Value) bool {
+	if c.label == "" && c.field.numeric {
+		v := rec.Field(c.field.index).Float()
+		switch c.op {
+		case "in", "not in":
+			found := false
+			for _, n := range c.nums {
+				found = found || v == n
+			}
+			return found == (c.op == "in")
+		}
+		return compareResult(c.op, compareFloat(v, c.nums[0]))
+	}
+
+	var s string
+	if c.label != "" {
+		labels, _ := rec.Field(c.field.index).Interface().(map[string]string)
+		s = labels[c.label]
+	} else {
+		s = rec.Field(c.field.index).String()
+	}
+	switch c.op {
+	case "~":
+		return c.pattern.MatchString(s)
+	case "=", "!=", "in", "not in":
+		found := false
+		for _, v := range c.strs {
+			found = found || strings.EqualFold(s, v)
+		}
+		return found == (c.op == "=" || c.op == "in")
+	}
+	return compareResult(c.op, strings.Compare(s, c.strs[0]))
+}
+
+// compareResult applies an ordering operator to a three-way comparison.
+func compareResult(op string, cmp int) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// matches reports whether record (of the type the expression was bound to) satisfies it.
+func (e *filterExpr) matches(record interface{}) bool {
+	if e == nil {
+		return true
+	}
+	return e.root.eval(reflect.ValueOf(record))
+}
+
+// parseExprFilter validates the expr filter for records like record, adding any error to
+// errs under field.
+func parseExprFilter(errs *ValidationErrors, field, src string, record interface{}) *filterExpr {
+	e, err := parseFilterExpr(src, record)
+	if err != nil {
+		errs.add(field, src, err.Error())
+	}
+	return e
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+var exprAllocations = []Allocation{
+	{Namespace: "prod", ResourceID: "pod-1", TotalCost: 150, StartTime: "2025-08-02T00:00:00Z", Labels: map[string]string{"team": "web-frontend"}},
+	{Namespace: "prod", ResourceID: "pod-2", TotalCost: 50, StartTime: "2025-07-30T00:00:00Z", Labels: map[string]string{"team": "api"}},
+	{Namespace: "dev", ResourceID: "pod-3", TotalCost: 120, StartTime: "2025-08-01T00:00:00Z"},
+	{Namespace: "Staging", ResourceID: "pod-4", TotalCost: 0, StartTime: "2025-08-03T00:00:00Z", Labels: map[string]string{"team": "web"}},
+}
+
+// exprMatches returns the resource IDs of the allocations e matches.
+func exprMatches(e *filterExpr) string {
+	var ids []string
+	for _, a := range exprAllocations {
+		if e.matches(a) {
+			ids = append(ids, a.ResourceID)
+		}
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestFilterExprMatches(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{"", "pod-1,pod-2,pod-3,pod-4"},
+		{"namespace=prod", "pod-1,pod-2"},
+		{"namespace=PROD AND totalCost>100", "pod-1"},
+		{"total_cost>100", "pod-1,pod-3"},
+		{"totalCost>=50 AND totalCost<=120", "pod-2,pod-3"},
+		{"namespace != prod", "pod-3,pod-4"},
+		{"namespace IN (dev, staging)", "pod-3,pod-4"},
+		{"namespace NOT IN (prod)", "pod-3,pod-4"},
+		{"totalCost IN (0, 50)", "pod-2,pod-4"},
+		{"labels.team~'^web'", "pod-1,pod-4"},
+		{"labels.team=''", "pod-3"},
+		{"start_time>=2025-08-01", "pod-1,pod-3,pod-4"},
+		{"namespace=dev OR namespace=staging AND totalCost>10", "pod-3"},
+		{"(namespace=dev OR namespace=staging) AND totalCost<10", "pod-4"},
+		{"NOT namespace=prod", "pod-3,pod-4"},
+		{"NOT (namespace=prod OR labels.team=web)", "pod-3"},
+		{`resource_id="pod-2"`, "pod-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := parseFilterExpr(tt.expr, Allocation{})
+			if err != nil {
+				t.Fatalf("parseFilterExpr: %v", err)
+			}
+			if got := exprMatches(e); got != tt.want {
+				t.Errorf("matched %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// The fields differ per endpoint: each documented example binds to its own record type only.
+func TestParseFilterExprPerEndpoint(t *testing.T) {
+	records := []interface{}{Allocation{}, CloudCost{}, Asset{}}
+	examples := []string{ // one per record type, in the order of records
+		"namespace=prod AND totalCost>100 AND labels.team~'^web'",
+		"name~'^ec2' AND totalCost>=10",
+		"provider IN (AWS,GCP) AND NOT (type=Database OR cost<=50) AND tags.env=prod",
+	}
+	for i, ex := range examples {
+		for j, rec := range records {
+			if _, err := parseFilterExpr(ex, rec); (i == j) != (err == nil) {
+				t.Errorf("%q on %T: error %v", ex, rec, err)
+			}
+		}
+	}
+
+	mixed := "namespace=prod AND totalCost>100 AND provider IN (AWS,GCP)"
+	for _, tt := range []struct {
+		record interface{}
+		want   string
+	}{
+		{Allocation{}, `column 38: unknown field "provider"; fields are cpu_core_hours, cpu_cost, `},
+		{CloudCost{}, `column 1: unknown field "namespace"; fields are cpuCost, gpuCost, name, totalCost`},
+		{Asset{}, `column 1: unknown field "namespace"; fields are asset_id, cost, `},
+	} {
+		_, err := parseFilterExpr(mixed, tt.record)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%T: got %v, want %q...", tt.record, err, tt.want)
+		}
+	}
+}
+
+func TestFilterExprAssetTags(t *testing.T) {
+	assets := []Asset{
+		{AssetID: "a1", Provider: "AWS", Type: "VM", Cost: 80, Tags: map[string]string{"env": "prod"}},
+		{AssetID: "a2", Provider: "GCP", Type: "Database", Cost: 200, Tags: map[string]string{"env": "prod"}},
+		{AssetID: "a3", Provider: "Azure", Type: "VM", Cost: 90},
+	}
+	e, err := parseFilterExpr("provider IN (aws,gcp) AND NOT (type=Database OR cost<=50) AND tags.env=prod", Asset{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, a := range assets {
+		if e.matches(a) {
+			ids = append(ids, a.AssetID)
+		}
+	}
+	if got := strings.Join(ids, ","); got != "a1" {
+		t.Errorf("matched %s, want a1", got)
+	}
+}
+
+func TestParseFilterExprErrors(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{"namespace=prod AND totalCost> AND cost<5", `column 31: expected a value after totalCost >, got "AND"`},
+		{"namespce=prod", `column 1: unknown field "namespce"; did you mean namespace?`},
+		{"totalCost>lots", `column 11: totalCost is a number, got "lots"`},
+		{"totalCost~'^1'", "column 10: totalCost is a number; ~ matches text fields"},
+		{"namespace~'('", "column 11: invalid regular expression"},
+		{"namespace=prod AND", "column 19: expected a field name, got end of expression"},
+		{"namespace prod", `column 11: expected an operator (=, !=, <, <=, >, >=, ~, IN or NOT IN) after namespace, got "prod"`},
+		{"namespace NOT prod", `column 15: expected IN after namespace NOT, got "prod"`},
+		{"namespace IN prod", `column 14: expected ( after IN, got "prod"`},
+		{"namespace IN (a b)", `column 17: expected , or ) in the IN list, got "b"`},
+		{"(namespace=prod", "column 16: expected ), got end of expression"},
+		{"namespace=prod namespace=dev", `column 16: expected AND, OR or the end of the expression, got "namespace"`},
+		{"namespace='prod", "column 11: unterminated quoted value"},
+		{"namespace=prod;", "column 15: unexpected character ';'"},
+		{"labels.=web", "column 1: labels. needs a key, e.g. labels.team"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := parseFilterExpr(tt.expr, Allocation{})
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q...", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// ===== Data freshness =====
+//
+// An answer is only as current as the data behind it. Every read behind a response notes
+// when its data was current, and meta.freshness reports them, so an agent can say "as of 10
+// minutes ago":
+//
+//	"freshness": {"as_of": "2025-08-03T09:50:00Z", "age_seconds": 600, "sources": [
+//	  {"source": "cache", "data": "allocations", "as_of": "2025-08-03T09:50:00Z", "age_seconds": 600},
+//	  {"source": "local_store", "data": "allocations", "as_of": "2025-08-03T09:00:00Z", "age_seconds": 3600}]}
+//
+//	backend      fetched from OpenCost (or the mock) for this request
+//	cache        answered by BACKEND_CACHE_TTL's cache; as_of is when it was fetched
+//	local_store  stored history was part of the answer; as_of is the last ingestion
+//	aws, azure   fetched from Cost Explorer or Cost Management for this request
+//	gcp_export   read from the billing export; as_of is its oldest file's modification time
+//
+// as_of at the top is the oldest source's: the answer is at least that current. The backend's
+// own lag (OpenCost's ETL) isn't visible from here. A data source read twice keeps its older
+// time.
+
+// FreshnessSource is one read behind an answer.
+type FreshnessSource struct {
+	Source     string    `json:"source"`
+	Data       string    `json:"data"`
+	AsOf       time.Time `json:"as_of"`
+	AgeSeconds int64     `json:"age_seconds"`
+}
+
+// Freshness is meta.freshness.
+type Freshness struct {
+	AsOf       time.Time         `json:"as_of"`
+	AgeSeconds int64             `json:"age_seconds"`
+	Sources    []FreshnessSource `json:"sources"`
+}
+
+// noteFreshness records that the request in ctx used data of source that was current at asOf.
+func noteFreshness(ctx context.Context, source, what string, asOf time.Time) {
+	list, _ := ctx.Value(warningsKey{}).(*warningList)
+	if list == nil || asOf.IsZero() {
+		return
+	}
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	for i, s := range list.freshness {
+		if s.Source == source && s.Data == what {
+			if asOf.Before(s.AsOf) {
+				list.freshness[i].AsOf = asOf
+			}
+			return
+		}
+	}
+	list.freshness = append(list.freshness, FreshnessSource{Source: source, Data: what, AsOf: asOf})
+}
+
+// freshnessAt summarizes sources at now, or returns nil when there are none.
+func freshnessAt(sources []FreshnessSource, now time.Time) *Freshness {
+	if len(sources) == 0 {
+		return nil
+	}
+	f := &Freshness{Sources: make([]FreshnessSource, len(sources))}
+	for i, s := range sources {
+		s.AsOf = s.AsOf.UTC()
+		s.AgeSeconds = max(0, int64(now.Sub(s.AsOf).Seconds()))
+		f.Sources[i] = s
+		if f.AsOf.IsZero() || s.AsOf.Before(f.AsOf) {
+			f.AsOf, f.AgeSeconds = s.AsOf, s.AgeSeconds
+		}
+	}
+	return f
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== GCP billing export source =====
+//
+// GCPBillingSource serves /cloudCosts and /assets from a Cloud Billing export saved as CSV,
+// either a BigQuery export table extracted with `bq extract` (dotted column names such as
+// service.description and location.region) or the legacy file export. Files are re-read when
+// they change, so a cron job can drop in a fresh export without a restart. Resource labels
+// (a labels column, as BigQuery's JSON [{"key":..., "value":...}] or key:value;key:value)
+// become asset tags.
+
+// GCPBillingSource is the CostSource for COST_SOURCE=gcp.
+type GCPBillingSource struct {
+	Paths []string
+
+	mu     sync.Mutex
+	loaded map[string]time.Time // path -> mtime of the cached rows
+	rows   []gcpBillingRow
+}
+
+// gcpBillingRow is the subset of an export line we map into CloudCost and Asset.
+type gcpBillingRow struct {
+	Service  string
+	SKU      string
+	Project  string
+	Region   string
+	Resource string // resource.name (detailed export), empty otherwise
+	Cost     float64
+	Currency string
+	Labels   map[string]string
+}
+
+// gcpColumns lists accepted header names per field, BigQuery export names first.
+var gcpColumns = map[string][]string{
+	"service":  {"service.description", "service_description", "Line Item", "Product"},
+	"sku":      {"sku.description", "sku_description", "Description", "SKU description"},
+	"project":  {"project.id", "project_id", "Project ID"},
+	"region":   {"location.region", "location_region", "Region", "Location"},
+	"resource": {"resource.name", "resource_name", "resource.global_name"},
+	"cost":     {"cost", "Cost"},
+	"currency": {"currency", "Currency"},
+	"labels":   {"labels", "Labels", "resource.labels"},
+}
+
+// newGCPBillingSource reads GCP_BILLING_CSV, a comma-separated list of export files.
+func newGCPBillingSource() (*GCPBillingSource, error) {
+	paths := splitList(os.Getenv("GCP_BILLING_CSV"))
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("COST_SOURCE=gcp requires GCP_BILLING_CSV")
+	}
+	s := &GCPBillingSource{Paths: paths}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load returns the parsed rows, re-reading the files if any of them changed.
+func (s *GCPBillingSource) load() ([]gcpBillingRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stale := s.loaded == nil
+	mtimes := map[string]time.Time{}
+	for _, p := range s.Paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("GCP billing export: %w", err)
+		}
+		mtimes[p] = fi.ModTime()
+		if !fi.ModTime().Equal(s.loaded[p]) {
+			stale = true
+		}
+	}
+	if !stale {
+		return s.rows, nil
+	}
+
+	var rows []gcpBillingRow
+	for _, p := range s.Paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, fmt.Errorf("GCP billing export: %w", err)
+		}
+		r, err := parseGCPBillingCSV(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("GCP billing export %s: %w", p, err)
+		}
+		rows = append(rows, r...)
+	}
+	s.rows, s.loaded = rows, mtimes
+	return rows, nil
+}
+
+// parseGCPBillingCSV maps export columns by header name; service and cost are required.
+func parseGCPBillingCSV(r io.Reader) ([]gcpBillingRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	idx := map[string]int{}
+	for field, names := range gcpColumns {
+		idx[field] = -1
+	nameLoop:
+		for _, name := range names {
+			for i, h := range header {
+				if strings.EqualFold(strings.TrimSpace(h), name) {
+					idx[field] = i
+					break nameLoop
+				}
+			}
+		}
+	}
+	if idx["service"] < 0 || idx["cost"] < 0 {
+		return nil, fmt.Errorf("export needs a service and a cost column")
+	}
+	get := func(rec []string, field string) string {
+		if i := idx[field]; i >= 0 && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var rows []gcpBillingRow
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		cost, err := strconv.ParseFloat(get(rec, "cost"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid cost %q", line, get(rec, "cost"))
+		}
+		rows = append(rows, gcpBillingRow{
+			Service:  get(rec, "service"),
+			SKU:      get(rec, "sku"),
+			Project:  get(rec, "project"),
+			Region:   get(rec, "region"),
+			Resource: get(rec, "resource"),
+			Cost:     cost,
+			Currency: strings.ToUpper(get(rec, "currency")),
+			Labels:   parseGCPLabels(get(rec, "labels")),
+		})
+	}
+	return rows, nil
+}
+
+// parseGCPLabels reads a labels cell: BigQuery's JSON list of key/value pairs, a JSON
+// object, or key:value (or key=value) pairs separated by ; or ,.
+func parseGCPLabels(cell string) map[string]string {
+	if cell == "" {
+		return nil
+	}
+	labels := map[string]string{}
+	var pairs []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	switch {
+	case json.Unmarshal([]byte(cell), &pairs) == nil:
+		for _, p := range pairs {
+			labels[p.Key] = p.Value
+		}
+	case json.Unmarshal([]byte(cell), &labels) == nil:
+	default:
+		for _, part := range strings.FieldsFunc(cell, func(r rune) bool { return r == ';' || r == ',' }) {
+			key, value, ok := strings.Cut(part, ":")
+			if !ok {
+				key, value, _ = strings.Cut(part, "=")
+			}
+			if key = strings.TrimSpace(key); key != "" {
+				labels[key] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// exportedAt is the modification time of the oldest export file loaded.
+func (s *GCPBillingSource) exportedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var oldest time.Time
+	for _, mtime := range s.loaded {
+		if oldest.IsZero() || mtime.Before(oldest) {
+			oldest = mtime
+		}
+	}
+	return oldest
+}
+
+// GetCloudCosts returns one CloudCost per GCP service, with CPU and GPU spend split out by
+// SKU description.
+func (s *GCPBillingSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	rows, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	noteFreshness(ctx, "gcp_export", "billing export", s.exportedAt())
+	byService := map[string]*CloudCost{}
+	for _, row := range rows {
+		c, ok := byService[row.Service]
+		if !ok {
+			c = &CloudCost{Name: row.Service}
+			byService[row.Service] = c
+		}
+		sku := strings.ToLower(row.SKU)
+		switch {
+		case strings.Contains(sku, "gpu"):
+			c.GPUCost += row.Cost
+		case strings.Contains(sku, "core") || strings.Contains(sku, "cpu"):
+			c.CPUCost += row.Cost
+		}
+		c.TotalCost += row.Cost
+	}
+
+	out := []CloudCost{}
+	for _, c := range byService {
+		if f.Namespace != "" && !strings.Contains(strings.ToLower(c.Name), strings.ToLower(f.Namespace)) {
+			continue
+		}
+		out = append(out, CloudCost{Name: c.Name, CPUCost: round2(c.CPUCost), GPUCost: round2(c.GPUCost), TotalCost: round2(c.TotalCost)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].TotalCost > out[j].TotalCost })
+	return out, ctx.Err()
+}
+
+// GetAllocations is unsupported: billing exports stop at the resource level.
+func (s *GCPBillingSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	return nil, fmt.Errorf("GCP billing export has no allocation data: %w", errUnsupported)
+}
+
+// GetAssets returns one Asset per billed resource (per project and service when the export
+// has no resource column), always with provider "GCP".
+func (s *GCPBillingSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	if f.Provider != "" && !strings.EqualFold(f.Provider, "GCP") {
+		return []Asset{}, nil
+	}
+	rows, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	noteFreshness(ctx, "gcp_export", "billing export", s.exportedAt())
+	byID := map[string]*Asset{}
+	var order []string
+	for _, row := range rows {
+		if f.Region != "" && !strings.EqualFold(row.Region, f.Region) {
+			continue
+		}
+		name := row.Resource
+		if name == "" {
+			name = row.Project + "/" + row.Service
+		}
+		id := "gcp:" + name
+		if row.Region != "" {
+			id += "@" + row.Region
+		}
+		a, ok := byID[id]
+		if !ok {
+			a = &Asset{AssetID: id, Name: name, Type: gcpAssetType(row.Service), Status: "active", Provider: "GCP", Region: row.Region,
+				Currency: row.Currency}
+			byID[id] = a
+			order = append(order, id)
+		}
+		a.Cost += row.Cost
+		for k, v := range row.Labels {
+			if _, set := a.Tags[k]; !set {
+				if a.Tags == nil {
+					a.Tags = map[string]string{}
+				}
+				a.Tags[k] = v
+			}
+		}
+	}
+
+	out := make([]Asset, 0, len(order))
+	for _, id := range order {
+		a := *byID[id]
+		a.Cost = round2(a.Cost)
+		out = append(out, a)
+	}
+	return out, ctx.Err()
+}
+
+// gcpAssetType maps a GCP service to the asset types used by the OpenCost backend.
+func gcpAssetType(service string) string {
+	s := strings.ToLower(service)
+	switch {
+	case strings.Contains(s, "compute engine"), strings.Contains(s, "kubernetes engine"):
+		return "VM"
+	case strings.Contains(s, "storage"):
+		return "Storage"
+	case strings.Contains(s, "sql"), strings.Contains(s, "spanner"), strings.Contains(s, "bigtable"), strings.Contains(s, "firestore"):
+		return "Database"
+	case strings.Contains(s, "network"), strings.Contains(s, "load balancing"):
+		return "Network"
+	default:
+		return "Service"
+	}
+}
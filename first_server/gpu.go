@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+)
+
+// ===== GPU costs =====
+//
+// GET /gpu summarizes the GPU share of allocation cost per namespace and per node, next to
+// how busy those GPUs were. An allocation counts when it has gpu_cost or gpu_hours; its node
+// is the first VM/node asset among its asset_ids, whose name carries the instance type.
+//
+// Utilization is the DCGM exporter's GPU_UTIL averaged per node over the same window
+// (matched on instance = asset_id or name, as in /assets/utilization). Where it is known,
+// idle_gpu_cost is the cost of the unused share and cost_per_used_gpu_hour divides the cost
+// by the GPU-hours actually used. Without DCGM metrics both are null and meta.notes says so.
+
+// defaultGPUWindow is the window used when none is given, matching /assets/utilization.
+const defaultGPUWindow = "7d"
+
+// GPUCosts are the GPU figures of one group of allocations.
+type GPUCosts struct {
+	Allocations        int      `json:"allocations"`
+	GPUCost            float64  `json:"gpu_cost"`
+	TotalCost          float64  `json:"total_cost"`
+	GPUSharePct        float64  `json:"gpu_share_pct"` // gpu_cost as a percentage of total_cost
+	GPUHours           float64  `json:"gpu_hours"`
+	CostPerGPUHour     *float64 `json:"cost_per_gpu_hour"`
+	UtilizationPct     *float64 `json:"utilization_pct"` // weighted by GPU-hours
+	IdleGPUCost        *float64 `json:"idle_gpu_cost"`
+	CostPerUsedGPUHour *float64 `json:"cost_per_used_gpu_hour"`
+
+	// GPU-hours on nodes with metrics, and the share of them that was used.
+	gpuHoursWithMetrics float64
+	utilizedGPUHours    float64
+}
+
+// NamespaceGPUCosts is one namespace's GPU costs.
+type NamespaceGPUCosts struct {
+	Namespace string   `json:"namespace"`
+	Nodes     []string `json:"nodes"`
+	GPUCosts
+}
+
+// NodeGPUCosts is the GPU cost scheduled on one node. InstanceType is the node asset's
+// name; allocations without a node asset are grouped under an empty asset_id.
+type NodeGPUCosts struct {
+	AssetID      string   `json:"asset_id"`
+	InstanceType string   `json:"instance_type"`
+	Provider     string   `json:"provider,omitempty"`
+	Region       string   `json:"region,omitempty"`
+	Namespaces   []string `json:"namespaces"`
+	GPUCosts
+}
+
+// GPUReport is the data of a /gpu response.
+type GPUReport struct {
+	Total       GPUCosts            `json:"total"`
+	ByNamespace []NamespaceGPUCosts `json:"by_namespace"`
+	ByNode      []NodeGPUCosts      `json:"by_node"`
+}
+
+// add counts one allocation with the utilization (0..1) of its node, if known.
+func (g *GPUCosts) add(a Allocation, util float64, known bool) {
+	g.Allocations++
+	g.GPUCost += a.GPUCost
+	g.TotalCost += a.TotalCost
+	g.GPUHours += a.GPUHours
+	if known {
+		g.gpuHoursWithMetrics += a.GPUHours
+		g.utilizedGPUHours += a.GPUHours * util
+	}
+}
+
+// finish rounds the sums and derives the ratios.
+func (g *GPUCosts) finish() {
+	if g.TotalCost > 0 {
+		g.GPUSharePct = round2(g.GPUCost / g.TotalCost * 100)
+	}
+	g.CostPerGPUHour = unitRatio(g.GPUCost, g.GPUHours)
+	if g.gpuHoursWithMetrics > 0 {
+		util := g.utilizedGPUHours / g.gpuHoursWithMetrics
+		pct := round2(util * 100)
+		idle := round2(g.GPUCost * (1 - util))
+		g.UtilizationPct, g.IdleGPUCost = &pct, &idle
+		g.CostPerUsedGPUHour = unitRatio(g.GPUCost, g.utilizedGPUHours)
+	}
+	g.GPUCost, g.TotalCost, g.GPUHours = round2(g.GPUCost), round2(g.TotalCost), round2(g.GPUHours)
+}
+
+// gpuMetricsRange turns a resolved window into a Prometheus range covering it.
+func gpuMetricsRange(start, end string) string {
+	startTime, err1 := parseDate(start)
+	endTime, err2 := parseDate(end)
+	if err1 != nil || err2 != nil || !endTime.After(startTime) {
+		return defaultGPUWindow
+	}
+	return fmt.Sprintf("%dh", int(math.Ceil(endTime.Sub(startTime).Hours())))
+}
+
+// gpuHandler handles GET /gpu.
+func gpuHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /gpu request received")
+
+	namespace := resolveAliases(r.Context(), "namespace", r.URL.Query().Get("namespace"))
+	start := r.URL.Query().Get("start")
+	end := r.URL.Query().Get("end")
+	window := r.URL.Query().Get("window")
+	if window == "" && start == "" && end == "" {
+		window = defaultGPUWindow
+	}
+
+	var verrs ValidationErrors
+	nsFilter := parseNamespaceFilter(&verrs, "namespace", namespace).withDefaultExclusions()
+	loc := loadTimezone(&verrs, "timezone", r.URL.Query().Get("timezone"))
+	resolved := applyWindow(&verrs, window, "", &start, &end, time.Now(), loc)
+	validateWindow(&verrs, start, end)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, nsFilter, "") {
+		return
+	}
+
+	data, err := costSource.GetAllocations(r.Context(), AllocationFilter{Namespace: nsFilter.pushdown(), Start: start, End: end})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations", err)
+		return
+	}
+	warnUnknownNamespaces(r.Context(), nsFilter)
+	startTime, _ := parseDate(start)
+	endTime, _ := parseDate(end)
+	var allocs []Allocation
+	for _, a := range data {
+		if (a.GPUCost > 0 || a.GPUHours > 0) && nsFilter.matches(a.Namespace) && inWindow(a, startTime, endTime) {
+			allocs = append(allocs, a)
+		}
+	}
+
+	assets, err := costSource.GetAssets(r.Context(), AssetFilter{})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get assets", err)
+		return
+	}
+	byID := make(map[string]Asset, len(assets))
+	for _, a := range assets {
+		byID[a.AssetID] = a
+	}
+
+	notes := []string{}
+	metricsRange := gpuMetricsRange(start, end)
+	util, err := getGPUUtilization(r.Context(), metricsRange)
+	if err != nil {
+		logf(r.Context(), "[MCP] /gpu — GPU metrics unavailable: %v\n", err)
+		notes = append(notes, "GPU metrics unavailable: "+err.Error())
+	} else if len(util) == 0 && len(allocs) > 0 {
+		notes = append(notes, "no "+gpuUtilizationMetric+" samples; is the DCGM exporter scraped?")
+	}
+
+	report := GPUReport{ByNamespace: []NamespaceGPUCosts{}, ByNode: []NodeGPUCosts{}}
+	byNS := map[string]*NamespaceGPUCosts{}
+	byNode := map[string]*NodeGPUCosts{}
+	for _, a := range allocs {
+		var node Asset
+		for _, id := range a.AssetIDs {
+			if asset, ok := byID[id]; ok && isNodeAsset(asset) {
+				node = asset
+				break
+			}
+		}
+		u, known := util[node.AssetID]
+		if !known && node.Name != "" {
+			u, known = util[node.Name]
+		}
+		known = known && node.AssetID != ""
+
+		report.Total.add(a, u, known)
+		ns, ok := byNS[a.Namespace]
+		if !ok {
+			ns = &NamespaceGPUCosts{Namespace: a.Namespace, Nodes: []string{}}
+			byNS[a.Namespace] = ns
+		}
+		ns.add(a, u, known)
+		if node.AssetID != "" && !slices.Contains(ns.Nodes, node.AssetID) {
+			ns.Nodes = append(ns.Nodes, node.AssetID)
+		}
+		n, ok := byNode[node.AssetID]
+		if !ok {
+			n = &NodeGPUCosts{AssetID: node.AssetID, InstanceType: node.Name, Provider: node.Provider, Region: node.Region, Namespaces: []string{}}
+			byNode[node.AssetID] = n
+		}
+		n.add(a, u, known)
+		if !slices.Contains(n.Namespaces, a.Namespace) {
+			n.Namespaces = append(n.Namespaces, a.Namespace)
+		}
+	}
+
+	report.Total.finish()
+	for _, ns := range byNS {
+		ns.finish()
+		sort.Strings(ns.Nodes)
+		report.ByNamespace = append(report.ByNamespace, *ns)
+	}
+	for _, n := range byNode {
+		n.finish()
+		sort.Strings(n.Namespaces)
+		report.ByNode = append(report.ByNode, *n)
+	}
+	sort.Slice(report.ByNamespace, func(i, j int) bool {
+		a, b := report.ByNamespace[i], report.ByNamespace[j]
+		if a.GPUCost != b.GPUCost {
+			return a.GPUCost > b.GPUCost
+		}
+		return a.Namespace < b.Namespace
+	})
+	sort.Slice(report.ByNode, func(i, j int) bool {
+		a, b := report.ByNode[i], report.ByNode[j]
+		if a.GPUCost != b.GPUCost {
+			return a.GPUCost > b.GPUCost
+		}
+		return a.AssetID < b.AssetID
+	})
+	if _, ok := byNode[""]; ok {
+		notes = append(notes, "some GPU allocations have no VM or node asset in asset_ids")
+	}
+	logf(r.Context(), "[MCP] /gpu — %d GPU allocations across %d namespaces and %d nodes\n", len(allocs), len(report.ByNamespace), len(report.ByNode))
+
+	meta := map[string]interface{}{
+		"filtersUsed":    map[string]string{"namespace": namespace, "start": start, "end": end},
+		"metrics_window": metricsRange,
+		"timezone":       loc.String(),
+		"notes":          notes,
+		"request_id":     requestIDFrom(r.Context()),
+		"total":          len(allocs),
+	}
+	if resolved != nil {
+		meta["window"] = resolved
+	}
+	noteDefaultExclusions(meta, nsFilter)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": report, "meta": meta})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===== Grafana datasource =====
+//
+// /grafana implements the SimpleJSON datasource contract (also spoken by the Infinity and
+// JSON plugins' SimpleJSON mode), so Grafana charts cost straight from this server: point a
+// datasource at http://<server>/grafana with the tenant's API key as a Bearer header.
+//
+//	GET  /grafana/             connection test
+//	POST /grafana/search       the metrics a panel can pick
+//	POST /grafana/query        time series or tables for the panel's range
+//	POST /grafana/annotations  budget and anomaly alerts as annotations
+//	POST /grafana/tag-keys     ad hoc filter keys (namespace)
+//	POST /grafana/tag-values   ad hoc filter values
+//
+// A metric is a cost field ("total_cost", "cpu_cost", ...) summed over all namespaces, or
+// "<field> by namespace" for one series per namespace. Points are bucketed by hour, or by day
+// when the panel's interval is a day or more or the range is too long for hourly buckets.
+
+// grafanaFields are the chartable cost fields, in search order.
+var grafanaFields = []string{"total_cost", "cpu_cost", "memory_cost", "gpu_cost", "network_cost", "pv_cost"}
+
+// pointField reads one cost field of a time series point.
+func pointField(p TimeSeriesPoint, field string) float64 {
+	switch field {
+	case "cpu_cost":
+		return p.CPUCost
+	case "memory_cost":
+		return p.MemoryCost
+	case "gpu_cost":
+		return p.GPUCost
+	case "network_cost":
+		return p.NetworkCost
+	case "pv_cost":
+		return p.PVCost
+	}
+	return p.TotalCost
+}
+
+// grafanaRange is the panel's time range.
+type grafanaRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// grafanaAdhocFilter is one ad hoc filter set on the dashboard.
+type grafanaAdhocFilter struct {
+	Key      string `json:"key"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+// GrafanaQuery is the body of POST /grafana/query.
+type GrafanaQuery struct {
+	Range      grafanaRange `json:"range"`
+	IntervalMs int64        `json:"intervalMs"`
+	Targets    []struct {
+		Target string `json:"target"`
+		RefID  string `json:"refId"`
+		Type   string `json:"type"` // timeserie (default) or table
+	} `json:"targets"`
+	AdhocFilters []grafanaAdhocFilter `json:"adhocFilters"`
+}
+
+// parseGrafanaTarget splits "<field>[ by namespace]", reporting whether it is known.
+func parseGrafanaTarget(target string) (field string, byNamespace, ok bool) {
+	field, by, found := strings.Cut(strings.TrimSpace(target), " by ")
+	field = strings.TrimSpace(field)
+	if found && strings.TrimSpace(by) != "namespace" {
+		return "", false, false
+	}
+	for _, f := range grafanaFields {
+		if f == field {
+			return field, found, true
+		}
+	}
+	return "", false, false
+}
+
+// grafanaRootHandler handles GET /grafana/, which Grafana calls to test the datasource.
+func grafanaRootHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// grafanaSearchHandler handles POST /grafana/search, listing every metric.
+func grafanaSearchHandler(w http.ResponseWriter, r *http.Request) {
+	metrics := make([]string, 0, 2*len(grafanaFields))
+	for _, f := range grafanaFields {
+		metrics = append(metrics, f, f+" by namespace")
+	}
+	writeJSON(w, http.StatusOK, metrics)
+}
+
+// grafanaQueryHandler handles POST /grafana/query.
+func grafanaQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var q GrafanaQuery
+	if !decodeJSON(w, r, &q) {
+		return
+	}
+	var verrs ValidationErrors
+	validateWindow(&verrs, q.Range.From, q.Range.To)
+	for i, t := range q.Targets {
+		if _, _, ok := parseGrafanaTarget(t.Target); !ok {
+			verrs.add(fmt.Sprintf("targets[%d].target", i), t.Target, "must be a cost field such as total_cost, optionally followed by \"by namespace\"")
+		}
+	}
+	var namespaces []string
+	for _, f := range q.AdhocFilters {
+		if f.Key != "namespace" || f.Operator != "=" {
+			verrs.add("adhocFilters", f.Key+f.Operator+f.Value, "only namespace = <value> filters are supported")
+			continue
+		}
+		namespaces = append(namespaces, f.Value)
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	start, _ := parseDate(q.Range.From)
+	end, _ := parseDate(q.Range.To)
+
+	data, err := costSource.GetAllocations(r.Context(), AllocationFilter{Start: start.UTC().Format(time.RFC3339), End: end.UTC().Format(time.RFC3339)})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations", err)
+		return
+	}
+	if len(namespaces) > 0 {
+		kept := data[:0:0]
+		for _, a := range data {
+			for _, ns := range namespaces {
+				if a.Namespace == ns {
+					kept = append(kept, a)
+				}
+			}
+		}
+		data = kept
+	}
+
+	resolution := "hour"
+	if q.IntervalMs >= (24*time.Hour).Milliseconds() || end.Sub(start) > maxSeriesBuckets*time.Hour {
+		resolution = "day"
+	}
+	series, err := buildTimeSeries(data, resolution, start, end, time.UTC)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidFilters, err.Error(), nil)
+		return
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].Namespace < series[j].Namespace })
+
+	out := []interface{}{}
+	for _, t := range q.Targets {
+		field, byNamespace, _ := parseGrafanaTarget(t.Target)
+		if t.Type == "table" {
+			rows := [][]interface{}{}
+			for _, s := range series {
+				var sum float64
+				for _, p := range s.Points {
+					sum += pointField(p, field)
+				}
+				rows = append(rows, []interface{}{s.Namespace, round2(sum)})
+			}
+			out = append(out, map[string]interface{}{
+				"type":    "table",
+				"refId":   t.RefID,
+				"columns": []map[string]string{{"text": "namespace", "type": "string"}, {"text": field, "type": "number"}},
+				"rows":    rows,
+			})
+			continue
+		}
+		if byNamespace {
+			for _, s := range series {
+				out = append(out, grafanaSeries(s.Namespace+" "+field, t.RefID, [][]TimeSeriesPoint{s.Points}, field))
+			}
+			continue
+		}
+		all := make([][]TimeSeriesPoint, len(series))
+		for i, s := range series {
+			all[i] = s.Points
+		}
+		out = append(out, grafanaSeries(field, t.RefID, all, field))
+	}
+	logf(r.Context(), "[MCP] /grafana/query: %d targets, %d series at %s resolution\n", len(q.Targets), len(out), resolution)
+	writeJSON(w, http.StatusOK, out)
+}
+
+// grafanaSeries sums field across the given aligned point lists into one SimpleJSON series
+// of [value, epoch ms] pairs.
+func grafanaSeries(name, refID string, lists [][]TimeSeriesPoint, field string) map[string]interface{} {
+	datapoints := [][2]float64{}
+	if len(lists) > 0 {
+		for i, p := range lists[0] {
+			var v float64
+			for _, l := range lists {
+				v += pointField(l[i], field)
+			}
+			ts, _ := time.Parse(time.RFC3339, p.Start)
+			datapoints = append(datapoints, [2]float64{round2(v), float64(ts.UnixMilli())})
+		}
+	}
+	return map[string]interface{}{"target": name, "refId": refID, "datapoints": datapoints}
+}
+
+// grafanaAnnotationsHandler handles POST /grafana/annotations, returning the alerts fired in
+// the range. The annotation's query, when set, keeps only alerts of that kind.
+func grafanaAnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Range      grafanaRange           `json:"range"`
+		Annotation map[string]interface{} `json:"annotation"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	var verrs ValidationErrors
+	validateWindow(&verrs, req.Range.From, req.Range.To)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	start, _ := parseDate(req.Range.From)
+	end, _ := parseDate(req.Range.To)
+	kind, _ := req.Annotation["query"].(string)
+
+	alerts.mu.Lock()
+	out := []map[string]interface{}{}
+	for _, a := range alerts.history {
+		if (kind == "" || a.Kind == strings.TrimSpace(kind)) && !a.FiredAt.Before(start) && a.FiredAt.Before(end) {
+			out = append(out, map[string]interface{}{
+				"annotation": req.Annotation,
+				"time":       a.FiredAt.UnixMilli(),
+				"title":      a.Kind,
+				"text":       a.Message,
+				"tags":       []string{a.Kind, a.Scope},
+			})
+		}
+	}
+	alerts.mu.Unlock()
+	writeJSON(w, http.StatusOK, out)
+}
+
+// grafanaTagKeysHandler handles POST /grafana/tag-keys.
+func grafanaTagKeysHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, []map[string]string{{"type": "string", "text": "namespace"}})
+}
+
+// grafanaTagValuesHandler handles POST /grafana/tag-values with {"key": "namespace"}, listing
+// the namespaces with allocations in the last 30 days.
+func grafanaTagValuesHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Key != "namespace" {
+		writeJSON(w, http.StatusOK, []map[string]string{})
+		return
+	}
+	now := time.Now().UTC()
+	data, err := costSource.GetAllocations(r.Context(), AllocationFilter{Start: now.AddDate(0, 0, -30).Format(time.RFC3339), End: now.Format(time.RFC3339)})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations", err)
+		return
+	}
+	seen := map[string]bool{}
+	values := []map[string]string{}
+	for _, a := range data {
+		if !seen[a.Namespace] {
+			seen[a.Namespace] = true
+			values = append(values, map[string]string{"text": a.Namespace})
+		}
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i]["text"] < values[j]["text"] })
+	writeJSON(w, http.StatusOK, values)
+}
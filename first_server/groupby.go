@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ===== Multi-dimensional grouping =====
+//
+// group_by on /allocations (a list in POST bodies, comma-separated on GET) aggregates the
+// matching allocations along up to four dimensions, like OpenCost's aggregate parameter, and
+// answers with nested groups: one level per dimension, each with its costs and sub-groups.
+//
+//	namespace   the allocation's namespace
+//	team        the team from TEAM_MAPPING_FILE (see teams.go)
+//	cluster     the allocation's "cluster" label
+//	label:<key> any allocation label, e.g. label:team
+//	provider    the provider of the assets backing the allocation (see enrich.go)
+//	region      the region of the assets backing the allocation
+//
+// Allocations without a value land in "unallocated". An allocation backed by assets in more
+// than one provider or region is split across them in proportion to asset cost (evenly when
+// the assets report no cost).
+
+// maxGroupByDimensions bounds the nesting depth.
+const maxGroupByDimensions = 4
+
+// CostGroup is one group of allocations at one level of the grouping.
+type CostGroup struct {
+	Dimension   string      `json:"dimension"`
+	Value       string      `json:"value"`
+	CPUCost     float64     `json:"cpu_cost"`
+	MemoryCost  float64     `json:"memory_cost"`
+	GPUCost     float64     `json:"gpu_cost"`
+	NetworkCost float64     `json:"network_cost"`
+	PVCost      float64     `json:"pv_cost"`
+	TotalCost   float64     `json:"total_cost"`
+	Allocations int         `json:"allocations"` // allocations with a share in the group
+	Groups      []CostGroup `json:"groups,omitempty"`
+
+	SharePct        float64 `json:"share_pct"`          // of the filtered total; see share.go
+	ShareOfTotalPct float64 `json:"share_of_total_pct"` // of the grand total
+
+	children map[string]*CostGroup
+	last     int // 1 + index of the last allocation added, so a split one counts once
+}
+
+// validateGroupBy checks the dimensions are known, distinct and not too many.
+func validateGroupBy(errs *ValidationErrors, dims []string) {
+	if len(dims) > maxGroupByDimensions {
+		errs.add("group_by", strings.Join(dims, ","), fmt.Sprintf("at most %d dimensions", maxGroupByDimensions))
+	}
+	seen := map[string]bool{}
+	for _, d := range dims {
+		switch key, isLabel := strings.CutPrefix(d, "label:"); {
+		case isLabel && key == "":
+			errs.add("group_by", d, "label: needs a label key, e.g. label:team")
+		case !isLabel && d != "namespace" && d != "team" && d != "cluster" && d != "provider" && d != "region":
+			errs.add("group_by", d, "must be namespace, team, cluster, provider, region or label:<key>")
+		}
+		if seen[d] {
+			errs.add("group_by", d, "appears twice")
+		}
+		seen[d] = true
+	}
+}
+
+// groupByNeedsAssets reports whether any dimension comes from the backing assets.
+func groupByNeedsAssets(dims []string) bool {
+	for _, d := range dims {
+		if d == "provider" || d == "region" {
+			return true
+		}
+	}
+	return false
+}
+
+// groupKey is one combination of dimension values and the fraction of an allocation's cost
+// it carries.
+type groupKey struct {
+	values []string
+	share  float64
+}
+
+// allocationKeys splits an allocation over the dimension value combinations it belongs to.
+func allocationKeys(e EnrichedAllocation, dims []string) []groupKey {
+	// Asset dimensions split by asset cost; everything else has one value
+	assetShares := map[string]float64{"": 1}
+	if groupByNeedsAssets(dims) && len(e.Assets) > 0 {
+		assetShares = map[string]float64{}
+		var total float64
+		for _, a := range e.Assets {
+			total += a.Cost
+		}
+		for _, a := range e.Assets {
+			w := 1 / float64(len(e.Assets))
+			if total > 0 {
+				w = a.Cost / total
+			}
+			assetShares[a.Provider+"\x00"+a.Region] += w
+		}
+	}
+
+	keys := make([]groupKey, 0, len(assetShares))
+	for pair, share := range assetShares {
+		provider, region, _ := strings.Cut(pair, "\x00")
+		values := make([]string, len(dims))
+		for i, d := range dims {
+			var v string
+			switch d {
+			case "namespace":
+				v = e.Namespace
+			case "team":
+				v, _ = teamMapping.teamFor(e.Allocation)
+			case "cluster":
+				v = e.Labels["cluster"]
+			case "provider":
+				v = provider
+			case "region":
+				v = region
+			default:
+				v = e.Labels[strings.TrimPrefix(d, "label:")]
+			}
+			if v == "" {
+				v = unallocatedOwner
+			}
+			values[i] = v
+		}
+		keys = append(keys, groupKey{values: values, share: share})
+	}
+	return keys
+}
+
+// add charges share of the i-th allocation to the group.
+func (g *CostGroup) add(i int, a Allocation, share float64) {
+	g.CPUCost += a.CPUCost * share
+	g.MemoryCost += a.MemoryCost * share
+	g.GPUCost += a.GPUCost * share
+	g.NetworkCost += a.NetworkCost * share
+	g.PVCost += a.PVCost * share
+	g.TotalCost += a.TotalCost * share
+	if g.last != i+1 {
+		g.Allocations++
+		g.last = i + 1
+	}
+}
+
+// finish rounds the costs and turns children into Groups, most expensive first.
+func (g *CostGroup) finish() {
+	g.CPUCost, g.MemoryCost, g.GPUCost = round2(g.CPUCost), round2(g.MemoryCost), round2(g.GPUCost)
+	g.NetworkCost, g.PVCost, g.TotalCost = round2(g.NetworkCost), round2(g.PVCost), round2(g.TotalCost)
+	g.Groups = sortedGroups(g.children)
+	g.children = nil
+}
+
+func sortedGroups(children map[string]*CostGroup) []CostGroup {
+	if len(children) == 0 {
+		return nil
+	}
+	out := make([]CostGroup, 0, len(children))
+	for _, c := range children {
+		c.finish()
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TotalCost != out[j].TotalCost {
+			return out[i].TotalCost > out[j].TotalCost
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+// groupAllocations aggregates allocs along dims into nested groups, fetching assets when a
+// dimension needs them.
+func groupAllocations(ctx context.Context, allocs []Allocation, dims []string) ([]CostGroup, error) {
+	var enriched []EnrichedAllocation
+	if groupByNeedsAssets(dims) {
+		var err error
+		if enriched, _, err = enrichWithAssets(ctx, allocs); err != nil {
+			return nil, err
+		}
+	} else {
+		enriched = make([]EnrichedAllocation, len(allocs))
+		for i, a := range allocs {
+			enriched[i] = EnrichedAllocation{Allocation: a}
+		}
+	}
+
+	root := map[string]*CostGroup{}
+	for n, e := range enriched {
+		for _, k := range allocationKeys(e, dims) {
+			level := root
+			for i, v := range k.values {
+				g, ok := level[v]
+				if !ok {
+					g = &CostGroup{Dimension: dims[i], Value: v, children: map[string]*CostGroup{}}
+					level[v] = g
+				}
+				g.add(n, e.Allocation, k.share)
+				level = g.children
+			}
+		}
+	}
+	return sortedGroups(root), nil
+}
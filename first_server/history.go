@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ===== Result snapshots =====
+//
+// A snapshot is the full response an endpoint gave for a session, kept so an agent can answer
+// "compare with the numbers you gave me earlier" without re-fetching. Snapshots are taken
+// when the request sets context.snapshot, or for every session query with
+// RESULT_HISTORY=all. RESULT_HISTORY_DIR persists them, one JSON file per session.
+
+// Snapshot is one stored response.
+type Snapshot struct {
+	ID        string          `json:"id"`
+	SessionID string          `json:"session_id"`
+	Tenant    string          `json:"tenant,omitempty"` // the session's tenant, when tenancy is on
+	Endpoint  string          `json:"endpoint"`
+	Query     string          `json:"query,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	Response  json.RawMessage `json:"response,omitempty"`
+}
+
+// maxSnapshotsPerSession bounds memory; the oldest snapshots are dropped first.
+const maxSnapshotsPerSession = 50
+
+type snapshotStore struct {
+	mu       sync.Mutex
+	all      bool   // snapshot every session query, not only opted-in ones
+	dir      string // persistence directory, "" for memory only
+	sessions map[string][]Snapshot
+}
+
+var snapshots = &snapshotStore{sessions: map[string][]Snapshot{}}
+
+// sessionFileName is the file name of a session's snapshots. The ID is base64url-encoded, so
+// no two IDs share a file and none can escape the history directory.
+func sessionFileName(sessionID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sessionID)) + ".json"
+}
+
+// configureHistory reads RESULT_HISTORY and RESULT_HISTORY_DIR, loading persisted snapshots.
+func configureHistory() error {
+	snapshots.mu.Lock()
+	defer snapshots.mu.Unlock()
+	switch v := os.Getenv("RESULT_HISTORY"); v {
+	case "", "opt-in":
+	case "all":
+		snapshots.all = true
+	default:
+		return fmt.Errorf("RESULT_HISTORY must be opt-in or all, got %q", v)
+	}
+	snapshots.dir = os.Getenv("RESULT_HISTORY_DIR")
+	if snapshots.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(snapshots.dir, 0o700); err != nil {
+		return fmt.Errorf("creating RESULT_HISTORY_DIR: %w", err)
+	}
+	files, err := filepath.Glob(filepath.Join(snapshots.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		raw, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		var list []Snapshot
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return fmt.Errorf("parsing %s: %w", f, err)
+		}
+		if len(list) == 0 {
+			continue
+		}
+		snapshots.sessions[list[0].SessionID] = list
+		// Files written before IDs were encoded are moved to their encoded name
+		if name := sessionFileName(list[0].SessionID); filepath.Base(f) != name {
+			if err := os.Rename(f, filepath.Join(snapshots.dir, name)); err != nil {
+				return fmt.Errorf("renaming %s: %w", f, err)
+			}
+		}
+	}
+	if len(files) > 0 {
+		log.Printf("[MCP] Loaded result history for %d sessions from %s\n", len(files), snapshots.dir)
+	}
+	return nil
+}
+
+// saveSnapshot stores resp for the session when requested (or when RESULT_HISTORY=all) and
+// adds the snapshot ID to resp's meta. Queries without a session are never stored.
+func saveSnapshot(ctx context.Context, endpoint, sessionID, queryText string, requested bool, resp map[string]interface{}) {
+	if sessionID == "" {
+		return
+	}
+	snapshots.mu.Lock()
+	defer snapshots.mu.Unlock()
+	if !requested && !snapshots.all {
+		return
+	}
+
+	snap := Snapshot{
+		ID:        "snap-" + newRequestID()[:10],
+		SessionID: sessionID,
+		Tenant:    tenantName(ctx),
+		Endpoint:  endpoint,
+		Query:     queryText,
+		RequestID: requestIDFrom(ctx),
+		CreatedAt: time.Now().UTC(),
+	}
+	if meta, ok := resp["meta"].(map[string]interface{}); ok {
+		meta["snapshot_id"] = snap.ID
+	}
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		addWarning(ctx, "partial_failure", "context.snapshot", "the response wasn't kept as a snapshot: %v", err)
+		return
+	}
+	snap.Response = raw
+
+	list := append(snapshots.sessions[sessionID], snap)
+	if len(list) > maxSnapshotsPerSession {
+		list = list[len(list)-maxSnapshotsPerSession:]
+	}
+	snapshots.sessions[sessionID] = list
+	if err := snapshots.persistLocked(sessionID); err != nil {
+		addWarning(ctx, "partial_failure", "context.snapshot", "the snapshot is kept in memory only; saving it to disk failed: %v", err)
+	}
+}
+
+// persistLocked writes one session's snapshots via a temp file and rename. Callers hold mu.
+func (s *snapshotStore) persistLocked(sessionID string) error {
+	if s.dir == "" {
+		return nil
+	}
+	path := filepath.Join(s.dir, sessionFileName(sessionID))
+	raw, err := json.Marshal(s.sessions[sessionID])
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// replace sets a session's snapshots wholesale, as when importing a session. The list is
+// capped like saveSnapshot's and re-keyed to sessionID and tenant.
+func (s *snapshotStore) replace(sessionID, tenant string, list []Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(list) > maxSnapshotsPerSession {
+		list = list[len(list)-maxSnapshotsPerSession:]
+	}
+	if len(list) == 0 {
+		delete(s.sessions, sessionID)
+		if s.dir == "" {
+			return nil
+		}
+		err := os.Remove(filepath.Join(s.dir, sessionFileName(sessionID)))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	list = append([]Snapshot(nil), list...)
+	for i := range list {
+		list[i].SessionID, list[i].Tenant = sessionID, tenant
+	}
+	s.sessions[sessionID] = list
+	return s.persistLocked(sessionID)
+}
+
+// tenant returns the tenant that owns a session's snapshots and whether it has any.
+func (s *snapshotStore) tenant(sessionID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.sessions[sessionID]
+	if len(list) == 0 {
+		return "", false
+	}
+	return list[0].Tenant, true
+}
+
+// list returns a session's snapshots, oldest first.
+func (s *snapshotStore) list(sessionID string) []Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Snapshot{}, s.sessions[sessionID]...)
+}
+
+// historyHandler handles GET /history/{session_id}. Responses are omitted unless
+// include=response; limit returns only the most recent N snapshots.
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("session_id")
+	if !checkSessionTenant(w, r, sessionID) {
+		return
+	}
+	list := snapshots.list(sessionID)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeValidationError(w, r, ValidationErrors{{Field: "limit", Value: v, Message: "must be a positive integer"}})
+			return
+		}
+		if n < len(list) {
+			list = list[len(list)-n:]
+		}
+	}
+	if r.URL.Query().Get("include") != "response" {
+		for i := range list {
+			list[i].Response = nil
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": list,
+		"meta": map[string]interface{}{"session_id": sessionID, "total": len(list), "request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// snapshotHandler handles GET /history/{session_id}/{snapshot_id}, returning the stored
+// response in full.
+func snapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if !checkSessionTenant(w, r, r.PathValue("session_id")) {
+		return
+	}
+	for _, snap := range snapshots.list(r.PathValue("session_id")) {
+		if snap.ID == r.PathValue("snapshot_id") {
+			writeJSON(w, http.StatusOK, map[string]interface{}{"data": snap})
+			return
+		}
+	}
+	writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such snapshot: "+r.PathValue("snapshot_id"), nil)
+}
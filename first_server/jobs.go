@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Query jobs =====
+//
+// POST /jobs takes an AgenticQuery and answers 202 with a job ID straight away; the query runs
+// in the background and GET /jobs/{id} reports its status, progress and, once done, results.
+// A job may list several windows ("windows": ["7d", "lastweek", "month"]) to aggregate the same
+// query over each: every window is one step, run in order, so progress is steps completed out
+// of steps total. DELETE /jobs/{id} cancels a job that hasn't finished.
+//
+// JOB_WORKERS caps how many jobs run at once (default 2); the rest wait as "queued". Finished
+// jobs are kept for JOB_TTL (default 1h).
+
+// Job statuses.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+// JobRequest is the body of POST /jobs: an AgenticQuery plus where and over what to run it.
+type JobRequest struct {
+	AgenticQuery
+	Endpoint string   `json:"endpoint,omitempty"` // one of queryEndpoints; routed from query when empty
+	Windows  []string `json:"windows,omitempty"`  // run once per window instead of with filters.window
+}
+
+// JobProgress is how far a job has got.
+type JobProgress struct {
+	Completed int     `json:"completed"`
+	Total     int     `json:"total"`
+	Percent   float64 `json:"percent"`
+	Current   string  `json:"current,omitempty"` // window being run
+}
+
+// JobResult is the outcome of one step: the endpoint's status and response body.
+type JobResult struct {
+	Window   string          `json:"window,omitempty"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// Job is one background query.
+type Job struct {
+	ID         string       `json:"id"`
+	Status     string       `json:"status"`
+	Endpoint   string       `json:"endpoint"`
+	Query      AgenticQuery `json:"query"`
+	Windows    []string     `json:"windows,omitempty"`
+	Progress   JobProgress  `json:"progress"`
+	Error      string       `json:"error,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	StartedAt  *time.Time   `json:"started_at,omitempty"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Results    []JobResult  `json:"results,omitempty"`
+
+	tenant string
+	cancel context.CancelFunc
+}
+
+// done reports whether the job has finished, one way or another.
+func (j *Job) done() bool { return j.FinishedAt != nil }
+
+// jobStore holds jobs in memory; they don't survive a restart.
+type jobStore struct {
+	mu    sync.Mutex
+	items map[string]*Job
+	slots chan struct{}
+	ttl   time.Duration
+}
+
+var jobs = &jobStore{items: map[string]*Job{}, slots: make(chan struct{}, 2), ttl: time.Hour}
+
+// loadJobConfig applies JOB_WORKERS and JOB_TTL.
+func loadJobConfig() error {
+	if v := os.Getenv("JOB_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("JOB_WORKERS must be a positive integer, got %q", v)
+		}
+		jobs.slots = make(chan struct{}, n)
+	}
+	if v := os.Getenv("JOB_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("JOB_TTL must be a positive duration, got %q", v)
+		}
+		jobs.ttl = d
+	}
+	return nil
+}
+
+// snapshot returns a copy of the job that is safe to encode outside the lock.
+func (s *jobStore) snapshot(j *Job) Job {
+	c := *j
+	c.Results = append([]JobResult(nil), j.Results...)
+	return c
+}
+
+// get returns the job with id if tenant may see it.
+func (s *jobStore) get(id, tenant string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLocked(time.Now())
+	j, ok := s.items[id]
+	if !ok || j.tenant != tenant {
+		return nil, false
+	}
+	return j, true
+}
+
+// expireLocked drops jobs that finished more than ttl ago.
+func (s *jobStore) expireLocked(now time.Time) {
+	for id, j := range s.items {
+		if j.done() && now.Sub(*j.FinishedAt) > s.ttl {
+			delete(s.items, id)
+		}
+	}
+}
+
+// update runs fn on the job under the lock.
+func (s *jobStore) update(j *Job, fn func(*Job)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(j)
+}
+
+// run executes the job's steps once a worker slot is free.
+func (s *jobStore) run(ctx context.Context, j *Job) {
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		s.finish(j, jobCanceled, "canceled while queued")
+		return
+	}
+	now := time.Now().UTC()
+	s.update(j, func(j *Job) { j.Status, j.StartedAt = jobRunning, &now })
+	logf(ctx, "[MCP] Job %s running %d step(s) on /%s\n", j.ID, j.Progress.Total, j.Endpoint)
+
+	windows := j.Windows
+	if len(windows) == 0 {
+		windows = []string{""}
+	}
+	failed := 0
+	for i, window := range windows {
+		if ctx.Err() != nil {
+			s.finish(j, jobCanceled, "canceled after "+strconv.Itoa(i)+" step(s)")
+			return
+		}
+		s.update(j, func(j *Job) { j.Progress.Current = window })
+		aq := j.Query
+		if window != "" {
+			aq.Filters.Window, aq.Filters.Start, aq.Filters.End = window, "", ""
+		}
+		stepCtx, cancel := context.WithTimeout(ctx, handlerTimeout)
+		rec := httptest.NewRecorder()
+		executeQuery(stepCtx, rec, j.Endpoint, aq)
+		cancel()
+		if rec.Code != http.StatusOK && rec.Code != http.StatusMultiStatus {
+			failed++
+		}
+		s.update(j, func(j *Job) {
+			j.Results = append(j.Results, JobResult{Window: window, Status: rec.Code, Response: json.RawMessage(rec.Body.Bytes())})
+			j.Progress.Completed = i + 1
+			j.Progress.Percent = round2(100 * float64(i+1) / float64(len(windows)))
+		})
+	}
+	switch {
+	case ctx.Err() != nil:
+		s.finish(j, jobCanceled, "canceled during the last step")
+		return
+	case failed > 0:
+		s.finish(j, jobFailed, fmt.Sprintf("%d of %d step(s) failed; see results", failed, len(windows)))
+		return
+	}
+	s.finish(j, jobSucceeded, "")
+}
+
+// finish records the job's final status.
+func (s *jobStore) finish(j *Job, status, msg string) {
+	now := time.Now().UTC()
+	s.update(j, func(j *Job) {
+		j.Status, j.Error, j.FinishedAt = status, msg, &now
+		j.Progress.Current = ""
+	})
+	log.Printf("[MCP] Job %s %s\n", j.ID, status)
+}
+
+// tenantName is the name of the request's tenant, or "" when tenancy is off.
+func tenantName(ctx context.Context) string {
+	if t := tenantFrom(ctx); t != nil {
+		return t.Name
+	}
+	return ""
+}
+
+// createJobHandler handles POST /jobs.
+func createJobHandler(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	var verrs ValidationErrors
+	req.Endpoint = resolveEndpoint(&verrs, "endpoint", req.Endpoint, &req.AgenticQuery)
+	for i, window := range req.Windows {
+		if strings.TrimSpace(window) == "" {
+			verrs.add(fmt.Sprintf("windows[%d]", i), window, "must not be empty")
+		}
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	steps := max(len(req.Windows), 1)
+	j := &Job{
+		ID:        "job-" + newRequestID()[:12],
+		Status:    jobQueued,
+		Endpoint:  req.Endpoint,
+		Query:     req.AgenticQuery,
+		Windows:   req.Windows,
+		Progress:  JobProgress{Total: steps},
+		CreatedAt: time.Now().UTC(),
+		tenant:    tenantName(r.Context()),
+	}
+	// The job outlives the request but keeps its request ID and tenant
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	j.cancel = cancel
+	jobs.mu.Lock()
+	jobs.items[j.ID] = j
+	view := jobs.snapshot(j)
+	jobs.mu.Unlock()
+	go jobs.run(ctx, j)
+
+	logf(r.Context(), "[MCP] Job %s queued for /%s (%d step(s))\n", j.ID, j.Endpoint, steps)
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"data": view,
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// getJobHandler handles GET /jobs/{id}.
+func getJobHandler(w http.ResponseWriter, r *http.Request) {
+	j, ok := jobs.get(r.PathValue("id"), tenantName(r.Context()))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such job: "+r.PathValue("id"), nil)
+		return
+	}
+	jobs.mu.Lock()
+	view := jobs.snapshot(j)
+	jobs.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": view,
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// listJobsHandler handles GET /jobs, newest first and without results.
+func listJobsHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantName(r.Context())
+	jobs.mu.Lock()
+	jobs.expireLocked(time.Now())
+	list := []Job{}
+	for _, j := range jobs.items {
+		if j.tenant == tenant {
+			view := jobs.snapshot(j)
+			view.Results = nil
+			list = append(list, view)
+		}
+	}
+	jobs.mu.Unlock()
+	sort.Slice(list, func(i, k int) bool { return list[i].CreatedAt.After(list[k].CreatedAt) })
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": list,
+		"meta": map[string]interface{}{"total": len(list), "request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// cancelJobHandler handles DELETE /jobs/{id}. Finished jobs can't be canceled.
+func cancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	j, ok := jobs.get(r.PathValue("id"), tenantName(r.Context()))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such job: "+r.PathValue("id"), nil)
+		return
+	}
+	jobs.mu.Lock()
+	finished, status := j.done(), j.Status
+	jobs.mu.Unlock()
+	if finished {
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "job "+j.ID+" already "+status, nil)
+		return
+	}
+	j.cancel()
+	logf(r.Context(), "[MCP] Job %s cancel requested\n", j.ID)
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Kubernetes service discovery =====
+//
+// BACKEND_DISCOVERY=kubernetes finds OpenCost through the Kubernetes API instead of
+// BACKEND_URL, authenticating with the pod's service account. The server reads the Endpoints
+// of OPENCOST_SERVICE (default "opencost") in OPENCOST_NAMESPACE (default "opencost") and
+// spreads requests over the ready addresses. The list is re-read every
+// BACKEND_DISCOVERY_INTERVAL (default 15s), so restarted or rescheduled pods are picked up.
+// OPENCOST_PORT picks the port by name or target port number; by default the first one.
+// While no address is known, requests go to the service's cluster DNS name.
+
+// serviceAccountDir holds the in-cluster token and CA bundle.
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// opencostDefaultPort is used for the DNS fallback when OPENCOST_PORT isn't a number.
+const opencostDefaultPort = "9003"
+
+// k8sDiscovery tracks the ready endpoints of one service.
+type k8sDiscovery struct {
+	apiURL    string
+	client    *http.Client
+	namespace string
+	service   string
+	port      string // port name or number; empty for the first
+
+	mu   sync.Mutex
+	urls []string
+	next int
+}
+
+// k8sEndpoints is the subset of a v1 Endpoints object we read.
+type k8sEndpoints struct {
+	Subsets []struct {
+		Addresses []struct {
+			IP string `json:"ip"`
+		} `json:"addresses"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+// newK8sDiscovery builds a discovery client from the in-cluster environment.
+func newK8sDiscovery() (*k8sDiscovery, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are unset; not running in a cluster?")
+	}
+	caPEM, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates in %s", filepath.Join(serviceAccountDir, "ca.crt"))
+	}
+	return &k8sDiscovery{
+		apiURL: "https://" + net.JoinHostPort(host, port),
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+		},
+		namespace: envOr("OPENCOST_NAMESPACE", "opencost"),
+		service:   envOr("OPENCOST_SERVICE", "opencost"),
+		port:      os.Getenv("OPENCOST_PORT"),
+	}, nil
+}
+
+// refresh reads the service's Endpoints and replaces the address list.
+func (d *k8sDiscovery) refresh(ctx context.Context) error {
+	// The token is re-read each time because kubelet rotates it
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return fmt.Errorf("reading service account token: %w", err)
+	}
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/endpoints/%s", d.apiURL, d.namespace, d.service)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetching endpoints: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching endpoints %s/%s: status %d: %s", d.namespace, d.service, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var ep k8sEndpoints
+	if err := json.Unmarshal(body, &ep); err != nil {
+		return fmt.Errorf("decoding endpoints: %w", err)
+	}
+
+	var urls []string
+	for _, subset := range ep.Subsets {
+		port := 0
+		for i, p := range subset.Ports {
+			if (d.port == "" && i == 0) || p.Name == d.port || strconv.Itoa(p.Port) == d.port {
+				port = p.Port
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, addr := range subset.Addresses {
+			urls = append(urls, "http://"+net.JoinHostPort(addr.IP, strconv.Itoa(port)))
+		}
+	}
+	slices.Sort(urls)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !slices.Equal(urls, d.urls) {
+		log.Printf("[MCP] OpenCost endpoints for %s/%s: %v\n", d.namespace, d.service, urls)
+		d.urls = urls
+	}
+	return nil
+}
+
+// watch refreshes the endpoints every interval until ctx ends. Failures keep the last list.
+func (d *k8sDiscovery) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.refresh(ctx); err != nil {
+				log.Printf("[MCP] OpenCost discovery failed, keeping %d known endpoints: %v\n", len(d.snapshot()), err)
+			}
+		}
+	}
+}
+
+func (d *k8sDiscovery) snapshot() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.urls
+}
+
+// baseURL returns the next ready endpoint, round-robin, or the service's DNS name if none
+// is known.
+func (d *k8sDiscovery) baseURL() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.urls) == 0 {
+		port := d.port
+		if _, err := strconv.Atoi(port); err != nil {
+			port = opencostDefaultPort
+		}
+		return fmt.Sprintf("http://%s.%s.svc:%s", d.service, d.namespace, port)
+	}
+	d.next = (d.next + 1) % len(d.urls)
+	return d.urls[d.next]
+}
+
+// configureDiscovery switches the HTTP cost source to Kubernetes discovery when
+// BACKEND_DISCOVERY=kubernetes.
+func configureDiscovery(ctx context.Context) error {
+	switch mode := os.Getenv("BACKEND_DISCOVERY"); mode {
+	case "":
+		return nil
+	case "kubernetes":
+	default:
+		return fmt.Errorf("unknown BACKEND_DISCOVERY %q (want kubernetes)", mode)
+	}
+	interval := 15 * time.Second
+	if v := os.Getenv("BACKEND_DISCOVERY_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			return fmt.Errorf("BACKEND_DISCOVERY_INTERVAL %q must be a duration of at least 1s", v)
+		}
+		interval = d
+	}
+	d, err := newK8sDiscovery()
+	if err != nil {
+		return err
+	}
+	if err := d.refresh(ctx); err != nil {
+		log.Printf("[MCP] OpenCost discovery failed, using %s until it succeeds: %v\n", d.baseURL(), err)
+	}
+	go d.watch(ctx, interval)
+	costSource = &HTTPSource{Resolve: d.baseURL}
+	log.Printf("[MCP] Discovering OpenCost via Kubernetes service %s/%s every %s\n", d.namespace, d.service, interval)
+	return nil
+}
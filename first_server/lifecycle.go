@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===== Asset lifecycle =====
+//
+// Assets carry a status (active, stopped or terminated) and, where the backend knows them,
+// created_at and terminated_at. An asset with a terminated_at is terminated whatever its
+// status says, and one without a status is active. /assets takes status (or filters.status)
+// as one status or a list such as stopped,terminated.
+//
+// GET /assets/orphaned lists assets that still cost money but show no sign of use:
+//
+//	stopped      the asset is stopped, yet billed (its disks, reserved IPs, ...)
+//	terminated   the asset is gone, yet billed for part of the period
+//	no_activity  no allocation in the idle window (default 7d) references it through
+//	             asset_ids or resource_id; assets created within the window are spared
+//
+// provider and region narrow the assets as on /assets.
+
+// assetStatuses are the lifecycle statuses, in order.
+var assetStatuses = []string{"active", "stopped", "terminated"}
+
+// defaultOrphanIdle is the idle window of /assets/orphaned when none is given.
+const defaultOrphanIdle = "7d"
+
+// assetStatus is a's lifecycle status.
+func assetStatus(a Asset) string {
+	if a.TerminatedAt != "" {
+		return "terminated"
+	}
+	if s := strings.ToLower(a.Status); s != "" {
+		return s
+	}
+	return "active"
+}
+
+// parseStatusFilter splits a status filter into the statuses it accepts, recording unknown
+// ones under field. An empty filter accepts every status.
+func parseStatusFilter(errs *ValidationErrors, field, v string) []string {
+	var out []string
+	for _, s := range splitList(strings.ToLower(v)) {
+		if !slices.Contains(assetStatuses, s) {
+			errs.add(field, s, "must be one of "+strings.Join(assetStatuses, ", "))
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// assetActivity returns the IDs of the assets that allocations since then reference through
+// asset_ids or resource_id.
+func assetActivity(ctx context.Context, since time.Time) (map[string]bool, error) {
+	allocs, err := costSource.GetAllocations(ctx, AllocationFilter{Start: since.Format(time.RFC3339), End: time.Now().UTC().Format(time.RFC3339)})
+	if err != nil {
+		return nil, err
+	}
+	active := map[string]bool{}
+	for _, a := range allocs {
+		active[a.ResourceID] = true
+		for _, id := range a.AssetIDs {
+			active[id] = true
+		}
+	}
+	return active, nil
+}
+
+// createdSince reports whether a was created after since, too recently to call it unused.
+func createdSince(a Asset, since time.Time) bool {
+	created, err := time.Parse(time.RFC3339, a.CreatedAt)
+	return err == nil && created.After(since)
+}
+
+// OrphanedAsset is an asset of /assets/orphaned with why it was listed.
+type OrphanedAsset struct {
+	Asset
+	Reasons []string `json:"reasons"` // stopped, terminated, no_activity
+}
+
+// assetsOrphanedHandler handles GET /assets/orphaned.
+func assetsOrphanedHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /assets/orphaned request received")
+
+	provider := resolveAliases(r.Context(), "provider", r.URL.Query().Get("provider"))
+	region := resolveAliases(r.Context(), "region", r.URL.Query().Get("region"))
+	idleText := r.URL.Query().Get("idle")
+	if idleText == "" {
+		idleText = defaultOrphanIdle
+	}
+
+	var verrs ValidationErrors
+	validateProvider(&verrs, provider)
+	idle, err := parseLookback(idleText)
+	if err != nil {
+		verrs.add("idle", idleText, "must be a positive duration like 12h, 7d or 2w")
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, namespaceFilter{}, provider) {
+		return
+	}
+
+	assets, err := costSource.GetAssets(r.Context(), AssetFilter{Provider: provider, Region: region})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get assets", err)
+		return
+	}
+	since := time.Now().UTC().Add(-idle)
+	active, err := assetActivity(r.Context(), since)
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations", err)
+		return
+	}
+
+	results := []OrphanedAsset{}
+	var total float64
+	for _, a := range assets {
+		if a.Cost <= 0 || provider != "" && !strings.EqualFold(a.Provider, provider) || region != "" && !strings.EqualFold(a.Region, region) {
+			continue
+		}
+		var reasons []string
+		switch status := assetStatus(a); status {
+		case "stopped", "terminated":
+			reasons = append(reasons, status)
+		}
+		if !active[a.AssetID] && !createdSince(a, since) {
+			reasons = append(reasons, "no_activity")
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		results = append(results, OrphanedAsset{Asset: a, Reasons: reasons})
+		total += a.Cost
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Cost > results[j].Cost })
+	logf(r.Context(), "[MCP] /assets/orphaned — %d of %d assets orphaned over %s\n", len(results), len(assets), idleText)
+
+	resp := map[string]interface{}{
+		"data": results,
+		"meta": map[string]interface{}{
+			"filtersUsed": map[string]string{"provider": provider, "region": region, "idle": idleText},
+			"since":       since.Format(time.RFC3339),
+			"total_cost":  round2(total),
+			"total":       len(results),
+			"request_id":  requestIDFrom(r.Context()),
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
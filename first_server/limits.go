@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Server limits, overridable with MAX_BODY_BYTES and HANDLER_TIMEOUT.
+var (
+	maxBodyBytes   int64 = 1 << 20 // 1 MiB of (decompressed) request body
+	handlerTimeout       = 30 * time.Second
+)
+
+// loadLimits applies MAX_BODY_BYTES and HANDLER_TIMEOUT from the environment.
+func loadLimits() error {
+	if v := os.Getenv("MAX_BODY_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("MAX_BODY_BYTES must be a positive integer, got %q", v)
+		}
+		maxBodyBytes = n
+	}
+	if v := os.Getenv("HANDLER_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("HANDLER_TIMEOUT must be a positive duration, got %q", v)
+		}
+		handlerTimeout = d
+	}
+	return nil
+}
+
+// newHTTPServer wraps h in an http.Server whose timeouts stop slow clients from holding
+// connections open: headers must arrive quickly, and the write timeout leaves room for
+// the handler deadline plus time to send the response.
+func newHTTPServer(addr string, h http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      handlerTimeout + 10*time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    64 << 10,
+		ErrorLog:          log.Default(),
+	}
+}
+
+// withLimits caps request bodies at maxBodyBytes and gives every handler a deadline, which
+// propagates to backend calls through the request context. It sits inside withGzip so the
+// cap applies to the decompressed body.
+func withLimits(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), handlerTimeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// decodeJSON decodes the request body into v, writing the appropriate error response and
+// returning false on failure: 413 for bodies over the limit, 400 for malformed JSON.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge,
+			fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit), nil)
+		return false
+	}
+	writeError(w, r, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON: "+err.Error(), nil)
+	return false
+}
+
+// statusClientClosedRequest is the (nginx) status logged for requests whose client went away.
+const statusClientClosedRequest = 499
+
+// writeBackendError reports a failed downstream call: 504 when the handler deadline ran
+// out, 499 when the client disconnected and so canceled it, 501 when the configured cost
+// source can't serve this kind of data, 502 otherwise.
+func writeBackendError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	if errors.Is(err, errUnsupported) {
+		writeError(w, r, http.StatusNotImplemented, ErrCodeNotSupported, message, err.Error())
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, r, http.StatusGatewayTimeout, ErrCodeTimeout, message+": timed out after "+handlerTimeout.String(), err.Error())
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		// Nobody reads this response; the status is for the access log and metrics
+		logf(r.Context(), "[MCP] %s — client disconnected, downstream fetch canceled\n", r.URL.Path)
+		writeError(w, r, statusClientClosedRequest, ErrCodeCanceled, message+": the client disconnected", err.Error())
+		return
+	}
+	writeError(w, r, http.StatusBadGateway, ErrCodeBackend, message, err.Error())
+}
@@ -1,34 +1,50 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"os"
+	"slices"
 	"strings"
 	"time"
+
+	"costtypes"
 )
 
+// QueryFilters are the structured filters of an AgenticQuery. Each endpoint reads the ones
+// that apply to it. The type lives in costtypes so the CLI sends exactly what the server reads.
+type QueryFilters = costtypes.Filters
+
 // AgenticQuery represents a flexible query structure that supports both natural language queries
 // and structured filters. It also holds context information to support multi-turn conversations,
 // making the API more AI/agent-friendly.
 type AgenticQuery struct {
-	Query   string `json:"query,omitempty"` // The natural language query, e.g. "Show prod costs"
-	Filters struct {
-		Namespace string `json:"namespace,omitempty"`
-		Start     string `json:"start,omitempty"`
-		End       string `json:"end,omitempty"`
-		Provider  string `json:"provider,omitempty"`
-		Region    string `json:"region,omitempty"`
-	} `json:"filters,omitempty"`
-	Context struct {
-		SessionID           string   `json:"session_id,omitempty"`           // Session identifier for conversation tracking
-		PreviousQuery       string   `json:"previous_query,omitempty"`       // Last query made in this session
-		ConversationContext []string `json:"conversation_context,omitempty"` // Full history of queries in this session
-	} `json:"context,omitempty"`
-}
+	Query  string   `json:"query,omitempty"`  // The natural language query, e.g. "Show prod costs"
+	Enrich []string `json:"enrich,omitempty"` // Related data joined onto results, e.g. ["assets"]
+
+	Summarize      SummarizeMode `json:"summarize,omitempty"` // true or "only" for a plain-text summary; see summarize.go
+	ResponseBudget               // max_tokens / max_bytes size hints; see budget.go
+
+	Delta      bool   `json:"delta,omitempty"`       // /allocations: issue meta.next_token; see delta.go
+	SinceToken string `json:"since_token,omitempty"` // /allocations: only records changed since this token
 
-// sessions stores query histories per session to enable multi-turn conversational context.
-var sessions = make(map[string][]string)
+	UnitCosts    UnitCostMode `json:"unit_costs,omitempty"`   // /allocations: true or "namespace"; see unitcosts.go
+	Distribution string       `json:"distribution,omitempty"` // /allocations time series: shared cost distribution; see sharedcosts.go
+
+	IncludeCarbon bool `json:"include_carbon,omitempty"` // /allocations: energy and CO2e per record; see carbon.go
+
+	Policy string `json:"policy,omitempty"` // /allocations: split costs by an allocation policy; see policies.go
+
+	GroupBy []string `json:"group_by,omitempty"` // /allocations and /assets: nested groups, e.g. ["namespace", "label:team"]; see groupby.go and tags.go
+
+	Explain bool `json:"explain,omitempty"` // meta.explain: how the request was read; see explain.go
+	DryRun  bool `json:"dry_run,omitempty"` // explain without fetching anything; see explain.go
+
+	Filters QueryFilters           `json:"filters,omitempty"`
+	Context costtypes.QueryContext `json:"context,omitempty"` // Session, history and snapshot options
+}
 
 // parseDate safely parses an RFC3339 timestamp string. Returns zero time if empty.
 func parseDate(dateStr string) (time.Time, error) {
@@ -38,75 +54,116 @@ func parseDate(dateStr string) (time.Time, error) {
 	return time.Parse(time.RFC3339, dateStr)
 }
 
+// inWindow reports whether an allocation overlaps [start, end]; zero bounds are open.
+func inWindow(alloc Allocation, start, end time.Time) bool {
+	allocStart, _ := time.Parse(time.RFC3339, alloc.StartTime)
+	allocEnd, _ := time.Parse(time.RFC3339, alloc.EndTime)
+	if !start.IsZero() && allocEnd.Before(start) {
+		return false
+	}
+	return end.IsZero() || !allocStart.After(end)
+}
+
 // cloudCostsHandler handles GET and POST requests to /cloudCosts.
 // Supports filter parameters and conversation context for AI readiness.
 func cloudCostsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("[MCP] /cloudCosts request received")
+	logf(r.Context(), "[MCP] /cloudCosts request received")
 
 	// Initialize filters with GET query params
 	namespace := r.URL.Query().Get("namespace")
+	exprText := r.URL.Query().Get("expr")
+	summarize := SummarizeMode(r.URL.Query().Get("summarize"))
+	var budget ResponseBudget
 	sessionID := ""
 	queryText := ""
 	previous := ""
 	history := []string{}
+	snapshot := false
+	stats := false
+	ex := explainQuery(r, "cloudCosts")
 
 	if r.Method == http.MethodPost {
 		// Decode AgenticQuery JSON body if POST
 		var aq AgenticQuery
-		if err := json.NewDecoder(r.Body).Decode(&aq); err != nil {
-			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		if !decodeJSON(w, r, &aq) {
 			return
 		}
+		if !checkSessionTenant(w, r, aq.Context.SessionID) {
+			return
+		}
+		if aq.Explain || aq.DryRun {
+			ex = startExplain(r.Context(), "cloudCosts", aq)
+		}
+		resolveReferences(r.Context(), "cloudCosts", &aq)
 		// Override filters and context from POST body
 		namespace = aq.Filters.Namespace
+		exprText = aq.Filters.Expr
 		sessionID = aq.Context.SessionID
 		queryText = aq.Query
+		snapshot = aq.Context.Snapshot
+		stats = aq.Context.SessionStats
+		summarize = aq.Summarize
+		budget = aq.ResponseBudget
 
 		// Update conversation history in memory
-		if sessionID != "" && queryText != "" {
-			if existing, ok := sessions[sessionID]; ok && len(existing) > 0 {
-				previous = existing[len(existing)-1]
-				history = append(existing, queryText)
-			} else {
-				history = []string{queryText}
-			}
-			sessions[sessionID] = history
+		if !ex.dryRun() {
+			previous, history = recordQuery(r.Context(), sessionID, "cloudCosts", queryText, aq.Filters)
 		}
-		log.Printf("[MCP] Parsed agentic POST query: %+v\n", aq)
+		warnIgnoredFilters(r.Context(), "/cloudCosts", aq.Filters, "namespace", "expr")
+		logf(r.Context(), "[MCP] Parsed agentic POST query: %+v\n", aq)
+	}
+
+	namespace = resolveAliases(r.Context(), "namespace", namespace)
+	var verrs ValidationErrors
+	nsFilter := parseNamespaceFilter(&verrs, "namespace", namespace)
+	expr := parseExprFilter(&verrs, "expr", exprText, CloudCost{})
+	validateSummarize(&verrs, &summarize)
+	if r.Method != http.MethodPost {
+		budget = budgetFromQuery(&verrs, r.URL.Query())
+	}
+	budget.validate(&verrs)
+	ex.validateDryRun(&verrs, snapshot, false)
+	if len(verrs) > 0 {
+		logf(r.Context(), "[MCP] /cloudCosts — %v\n", verrs)
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, nsFilter, "") {
+		return
 	}
 
 	// Fetch data from downstream (mock server or real backend)
-	data, url, err := getCloudCostsWithFilters(namespace)
+	data, err := costSource.GetCloudCosts(r.Context(), CloudCostFilter{Namespace: nsFilter.pushdown()})
 	if err != nil {
-		http.Error(w, "Failed to get cloud costs: "+err.Error(), http.StatusInternalServerError)
+		writeBackendError(w, r, "Failed to get cloud costs", err)
 		return
 	}
-	log.Printf("[MCP Client] Fetching URL: %s\n", url)
-	log.Printf("[MCP] /cloudCosts — received %d records\n", len(data))
+	logf(r.Context(), "[MCP] /cloudCosts — received %d records\n", len(data))
 
-	// Apply additional local filtering to be safe
-	filtered := []CloudCost{}
-	if namespace != "" {
-		for _, cost := range data {
-			if strings.Contains(strings.ToLower(cost.Name), strings.ToLower(namespace)) {
-				filtered = append(filtered, cost)
-			}
-		}
-	} else {
-		filtered = data
-	}
+	// Apply the full namespace filter locally; the backend only sees single names
+	ex.namespaces(nsFilter)
+	ex.filter("expr", exprText)
+	filtered := applySteps(ex, data,
+		filterStep[CloudCost]{"namespace", "matched as a substring of the name", func(c CloudCost) bool { return nsFilter.matchesName(c.Name) }},
+		filterStep[CloudCost]{"expr", exprText, func(c CloudCost) bool { return expr.matches(c) }},
+	)
 
 	// Compose response including data, filters used, and conversation context
 	resp := map[string]interface{}{
 		"data": filtered,
 		"meta": map[string]interface{}{
-			"filtersUsed":          map[string]string{"namespace": namespace},
+			"filtersUsed":          map[string]string{"namespace": namespace, "expr": exprText},
 			"session_id":           sessionID,
 			"previous_query":       previous,
 			"conversation_context": history,
 			"total":                len(filtered),
+			"request_id":           requestIDFrom(r.Context()),
 		},
 	}
+	applySummary(resp, summarize, summarizeCloudCosts(filtered))
+	applyBudget(resp, budget)
+	addSessionStats(resp, sessionID, stats)
+	saveSnapshot(r.Context(), "cloudCosts", sessionID, queryText, snapshot, resp)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
@@ -114,167 +171,698 @@ func cloudCostsHandler(w http.ResponseWriter, r *http.Request) {
 // allocationsHandler handles GET and POST requests to /allocations.
 // Supports filtering by namespace and time range, and tracks session context.
 func allocationsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("[MCP] /allocations request received")
+	logf(r.Context(), "[MCP] /allocations request received")
 
 	namespace := r.URL.Query().Get("namespace")
 	start := r.URL.Query().Get("start")
 	end := r.URL.Query().Get("end")
+	window := r.URL.Query().Get("window")
+	timezone := r.URL.Query().Get("timezone")
+	resolution := r.URL.Query().Get("resolution")
+	enrich := splitList(r.URL.Query().Get("enrich"))
+	summarize := SummarizeMode(r.URL.Query().Get("summarize"))
+	delta := r.URL.Query().Get("delta") == "true"
+	sinceToken := r.URL.Query().Get("since_token")
+	unitCosts := UnitCostMode(r.URL.Query().Get("unit_costs"))
+	distribution := r.URL.Query().Get("distribution")
+	includeCarbon := r.URL.Query().Get("include_carbon") == "true"
+	policyName := r.URL.Query().Get("policy")
+	exprText := r.URL.Query().Get("expr")
+	groupBy := splitList(r.URL.Query().Get("group_by"))
+	var budget ResponseBudget
 	sessionID := ""
 	queryText := ""
 	previous := ""
 	history := []string{}
+	snapshot := false
+	stats := false
+	ex := explainQuery(r, "allocations")
 
 	if r.Method == http.MethodPost {
 		var aq AgenticQuery
-		if err := json.NewDecoder(r.Body).Decode(&aq); err != nil {
-			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		if !decodeJSON(w, r, &aq) {
 			return
 		}
+		if !checkSessionTenant(w, r, aq.Context.SessionID) {
+			return
+		}
+		if aq.Explain || aq.DryRun {
+			ex = startExplain(r.Context(), "allocations", aq)
+		}
+		resolveReferences(r.Context(), "allocations", &aq)
 		namespace = aq.Filters.Namespace
 		start = aq.Filters.Start
 		end = aq.Filters.End
+		window = aq.Filters.Window
+		timezone = aq.Filters.Timezone
+		resolution = aq.Filters.Resolution
+		exprText = aq.Filters.Expr
+		enrich = aq.Enrich
 		sessionID = aq.Context.SessionID
 		queryText = aq.Query
+		snapshot = aq.Context.Snapshot
+		stats = aq.Context.SessionStats
+		summarize = aq.Summarize
+		budget = aq.ResponseBudget
+		delta = aq.Delta
+		sinceToken = aq.SinceToken
+		unitCosts = aq.UnitCosts
+		distribution = aq.Distribution
+		includeCarbon = aq.IncludeCarbon
+		policyName = aq.Policy
+		groupBy = aq.GroupBy
 
-		if sessionID != "" && queryText != "" {
-			if existing, ok := sessions[sessionID]; ok && len(existing) > 0 {
-				previous = existing[len(existing)-1]
-				history = append(existing, queryText)
-			} else {
-				history = []string{queryText}
-			}
-			sessions[sessionID] = history
+		// Update conversation history in memory
+		if !ex.dryRun() {
+			previous, history = recordQuery(r.Context(), sessionID, "allocations", queryText, aq.Filters)
+		}
+		warnIgnoredFilters(r.Context(), "/allocations", aq.Filters, "namespace", "start", "end", "window", "timezone", "resolution", "expr")
+		logf(r.Context(), "[MCP] Parsed agentic POST query: %+v\n", aq)
+	}
+
+	namespace = resolveAliases(r.Context(), "namespace", namespace)
+	// Reject malformed or inconsistent windows instead of silently ignoring them
+	var verrs ValidationErrors
+	// Delta tokens are tied to the filters as sent, so relative windows keep matching
+	deltaFilters := strings.Join([]string{tenantName(r.Context()), namespace, window, start, end, timezone, exprText}, "|")
+	nsFilter := parseNamespaceFilter(&verrs, "namespace", namespace).withDefaultExclusions()
+	loc := loadTimezone(&verrs, "timezone", timezone)
+	resolved := applyWindow(&verrs, window, queryText, &start, &end, time.Now(), loc)
+	validateWindow(&verrs, start, end)
+	validateResolution(&verrs, resolution)
+	expr := parseExprFilter(&verrs, "expr", exprText, Allocation{})
+	validateEnrich(&verrs, enrich)
+	validateSummarize(&verrs, &summarize)
+	validateUnitCosts(&verrs, &unitCosts)
+	if r.Method != http.MethodPost {
+		budget = budgetFromQuery(&verrs, r.URL.Query())
+	}
+	budget.validate(&verrs)
+	if len(enrich) > 0 && resolution != "" {
+		verrs.add("enrich", strings.Join(enrich, ","), "cannot be combined with resolution")
+	}
+	if distribution == "" {
+		distribution = sharedCosts.Distribution
+	} else if !validDistribution(distribution) {
+		verrs.add("distribution", distribution, "must be proportional, even or none")
+	}
+	if unitCosts != UnitCostsOff && (resolution != "" || len(enrich) > 0) {
+		verrs.add("unit_costs", string(unitCosts), "cannot be combined with resolution or enrich")
+	}
+	if includeCarbon && (resolution != "" || len(enrich) > 0 || unitCosts == UnitCostsRecord) {
+		verrs.add("include_carbon", "true", "cannot be combined with resolution, enrich or per-record unit_costs")
+	}
+	policy := lookupPolicy(&verrs, "policy", policyName)
+	validateGroupBy(&verrs, groupBy)
+	if len(groupBy) > 0 && (resolution != "" || len(enrich) > 0 || delta || sinceToken != "" || unitCosts == UnitCostsRecord || includeCarbon) {
+		verrs.add("group_by", strings.Join(groupBy, ","), "cannot be combined with resolution, enrich, delta, per-record unit_costs or include_carbon")
+	}
+	var since *deltaState
+	if sinceToken != "" {
+		st, ok := deltas.get(sinceToken, time.Now())
+		switch {
+		case !ok:
+			verrs.add("since_token", sinceToken, "unknown or expired; repeat the query with delta=true")
+		case st.filters != deltaFilters:
+			verrs.add("since_token", sinceToken, "was issued for different filters")
+		default:
+			since = st
 		}
-		log.Printf("[MCP] Parsed agentic POST query: %+v\n", aq)
+	}
+	if (delta || sinceToken != "") && (resolution != "" || len(enrich) > 0) {
+		verrs.add("since_token", sinceToken, "delta responses cannot be combined with resolution or enrich")
+	}
+	ex.validateDryRun(&verrs, snapshot, delta || sinceToken != "")
+	if len(verrs) > 0 {
+		logf(r.Context(), "[MCP] /allocations — %v\n", verrs)
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if resolved != nil && !ex.dryRun() {
+		rememberWindow(sessionID, "allocations", start, end)
+	}
+	if !checkTenant(w, r, nsFilter, "") {
+		return
 	}
 
 	// Fetch data from downstream source
-	data, url, err := getAllocationsWithFilters(namespace, start, end)
+	data, err := costSource.GetAllocations(r.Context(), AllocationFilter{Namespace: nsFilter.pushdown(), Start: start, End: end})
 	if err != nil {
-		http.Error(w, "Failed to get allocations: "+err.Error(), http.StatusInternalServerError)
+		writeBackendError(w, r, "Failed to get allocations", err)
 		return
 	}
-	log.Printf("[MCP Client] Fetching URL: %s\n", url)
-	log.Printf("[MCP] /allocations — received %d records\n", len(data))
+	logf(r.Context(), "[MCP] /allocations — received %d records\n", len(data))
+	warnUnparsableTimes(r.Context(), data)
+	warnUnknownNamespaces(r.Context(), nsFilter)
 
-	// Filter results locally by namespace and time range
+	// Filter results locally by namespace and time range (already validated above)
 	startTime, _ := parseDate(start)
 	endTime, _ := parseDate(end)
-	filtered := []Allocation{}
-	for _, alloc := range data {
-		if namespace != "" && alloc.Namespace != namespace {
-			continue
+	ex.namespaces(nsFilter)
+	ex.window(resolved, start, end)
+	ex.filter("timezone", loc.String())
+	ex.filter("expr", exprText)
+	filtered := applySteps(ex, data,
+		filterStep[Allocation]{"namespace", nsFilter.raw, func(a Allocation) bool { return nsFilter.matches(a.Namespace) }},
+		filterStep[Allocation]{"window", start + " to " + end, func(a Allocation) bool { return inWindow(a, startTime, endTime) }},
+		filterStep[Allocation]{"expr", exprText, func(a Allocation) bool { return expr.matches(a) }},
+	)
+
+	meta := map[string]interface{}{
+		"filtersUsed":          map[string]string{"namespace": namespace, "start": start, "end": end, "resolution": resolution, "expr": exprText},
+		"session_id":           sessionID,
+		"previous_query":       previous,
+		"conversation_context": history,
+		"total":                len(filtered),
+		"timezone":             loc.String(),
+		"request_id":           requestIDFrom(r.Context()),
+	}
+	if resolved != nil {
+		meta["window"] = resolved
+	}
+	noteDefaultExclusions(meta, nsFilter)
+	resp := map[string]interface{}{"data": filtered, "meta": meta}
+
+	// Delta requests get a token for next time, and with since_token only what changed
+	if delta || since != nil {
+		meta["next_token"] = deltas.issue(deltaFilters, filtered, time.Now())
+		if since != nil {
+			changed, report := since.diff(filtered, sinceToken)
+			resp["data"] = changed
+			meta["delta"] = report
+		}
+	}
+	if unitCosts != UnitCostsOff {
+		meta["unit_costs"] = unitCostReport(filtered)
+		if records, ok := resp["data"].([]Allocation); ok && unitCosts == UnitCostsRecord {
+			resp["data"] = withUnitCosts(records)
 		}
-		allocStart, _ := time.Parse(time.RFC3339, alloc.StartTime)
-		allocEnd, _ := time.Parse(time.RFC3339, alloc.EndTime)
-		if !startTime.IsZero() && allocEnd.Before(startTime) {
-			continue
+	}
+	if includeCarbon {
+		estimator, err := newCarbonEstimator(r.Context())
+		if err != nil {
+			writeBackendError(w, r, "Failed to get assets for carbon regions", err)
+			return
 		}
-		if !endTime.IsZero() && allocStart.After(endTime) {
-			continue
+		// meta.carbon covers the whole result, also when a delta response returns less
+		_, total := estimator.withCarbon(filtered)
+		meta["carbon"] = map[string]interface{}{"total": total, "assumptions": carbonAssumptions}
+		if records, ok := resp["data"].([]Allocation); ok {
+			resp["data"], _ = estimator.withCarbon(records)
 		}
-		filtered = append(filtered, alloc)
+	}
+	var policyResult PolicyResult
+	if policy != nil {
+		policyResult = policy.apply(filtered)
+		meta["policy"] = policyResult
 	}
 
-	resp := map[string]interface{}{
-		"data": filtered,
-		"meta": map[string]interface{}{
-			"filtersUsed":          map[string]string{"namespace": namespace, "start": start, "end": end},
-			"session_id":           sessionID,
-			"previous_query":       previous,
-			"conversation_context": history,
-			"total":                len(filtered),
-		},
+	// With a resolution, answer with one cost series per namespace instead of raw allocations
+	if resolution != "" {
+		series, err := buildTimeSeries(filtered, resolution, startTime, endTime, loc)
+		if err != nil {
+			verrs.add("resolution", resolution, err.Error())
+			writeValidationError(w, r, verrs)
+			return
+		}
+		// Shared namespaces are spread over all the others, not just the ones asked for. A
+		// query for the shared namespaces alone shows them as they are
+		if distribution != DistributeNone && sharedCosts.anyDirect(filtered) {
+			all := filtered
+			if !nsFilter.empty() {
+				if all, err = costSource.GetAllocations(r.Context(), AllocationFilter{Start: start, End: end}); err != nil {
+					writeBackendError(w, r, "Failed to get allocations for shared costs", err)
+					return
+				}
+			}
+			var inRange []Allocation
+			for _, alloc := range all {
+				if inWindow(alloc, startTime, endTime) {
+					inRange = append(inRange, alloc)
+				}
+			}
+			allSeries, err := buildTimeSeries(inRange, resolution, startTime, endTime, loc)
+			if err != nil {
+				verrs.add("resolution", resolution, err.Error())
+				writeValidationError(w, r, verrs)
+				return
+			}
+			distributed, report := distributeSharedSeries(allSeries, sharedCosts.Namespaces, distribution)
+			series = []NamespaceSeries{}
+			for _, s := range distributed {
+				if nsFilter.matches(s.Namespace) {
+					series = append(series, s)
+				}
+			}
+			meta["shared_costs"] = report
+		}
+		grand, err := grandTotal(r.Context(), filtered, !nsFilter.empty() || expr != nil, start, end)
+		if err != nil {
+			writeBackendError(w, r, "Failed to get allocations for the grand total", err)
+			return
+		}
+		setSeriesShares(series, grand)
+		var seriesTotal float64
+		for _, s := range series {
+			seriesTotal += s.TotalCost
+		}
+		shareMeta(meta, seriesTotal, grand)
+		resp["data"] = series
+		meta["total"] = len(series)
+		meta["allocations"] = len(filtered)
+		meta["resolution"] = resolution
+	}
+
+	// With group_by, answer with nested cost groups instead of raw allocations
+	if len(groupBy) > 0 {
+		groups, err := groupAllocations(r.Context(), filtered, groupBy)
+		if err != nil {
+			writeBackendError(w, r, "Failed to get assets for grouping", err)
+			return
+		}
+		grand, err := grandTotal(r.Context(), filtered, !nsFilter.empty() || expr != nil, start, end)
+		if err != nil {
+			writeBackendError(w, r, "Failed to get allocations for the grand total", err)
+			return
+		}
+		filteredTotal := sumTotalCost(filtered)
+		setGroupShares(groups, filteredTotal, grand)
+		shareMeta(meta, filteredTotal, grand)
+		resp["data"] = groups
+		meta["total"] = len(groups)
+		meta["allocations"] = len(filtered)
+		meta["group_by"] = groupBy
+	}
+
+	// Join the assets backing each allocation, with their cost
+	if len(enrich) > 0 {
+		enriched, unmatched, err := enrichWithAssets(r.Context(), filtered)
+		if err != nil {
+			writeBackendError(w, r, "Failed to get assets for enrichment", err)
+			return
+		}
+		assetCost := map[string]float64{}
+		for _, e := range enriched {
+			for _, a := range e.Assets {
+				assetCost[a.AssetID] = a.Cost
+			}
+		}
+		var total float64
+		for _, c := range assetCost {
+			total += c
+		}
+		resp["data"] = enriched
+		meta["enrich"] = enrich
+		meta["assets"] = len(assetCost)
+		meta["asset_cost_total"] = round2(total)
+		meta["unmatched_asset_ids"] = unmatched
+	}
+	// Summaries of a bounded window also mention notable changes against the one before it
+	if summarize != SummarizeOff {
+		var changes []NamespaceDelta
+		if !startTime.IsZero() && !endTime.IsZero() {
+			bStart, bEnd := windowEnding(startTime, endTime.Sub(startTime))
+			baseline, err := costSource.GetAllocations(r.Context(), AllocationFilter{Namespace: nsFilter.pushdown(), Start: bStart, End: bEnd})
+			if err != nil {
+				addWarning(r.Context(), "partial_failure", "summarize", "the summary leaves out changes: the previous window couldn't be fetched (%v)", err)
+			} else {
+				bStartTime, _ := parseDate(bStart)
+				inBaseline := []Allocation{}
+				for _, alloc := range baseline {
+					// Half-open, so allocations starting exactly at the current window aren't counted twice
+					if allocStart, _ := time.Parse(time.RFC3339, alloc.StartTime); allocStart.Before(startTime) && inWindow(alloc, bStartTime, startTime) {
+						inBaseline = append(inBaseline, alloc)
+					}
+				}
+				changes = compareNamespaces(sumByNamespace(inBaseline, nsFilter), sumByNamespace(filtered, namespaceFilter{}))
+			}
+		}
+		text := summarizeAllocations(filtered, start, end, changes)
+		if policy != nil {
+			text += summarizePolicy(policyResult)
+		}
+		applySummary(resp, summarize, text)
 	}
+	applyBudget(resp, budget)
+	addSessionStats(resp, sessionID, stats)
+	saveSnapshot(r.Context(), "allocations", sessionID, queryText, snapshot, resp)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 // assetsHandler handles GET and POST requests to /assets.
-// Supports filtering by provider and region, with session context tracking.
+// Supports filtering by provider, region, status and tags, and grouping by tag, with session
+// context tracking.
 func assetsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("[MCP] /assets request received")
+	logf(r.Context(), "[MCP] /assets request received")
 
 	provider := r.URL.Query().Get("provider")
 	region := r.URL.Query().Get("region")
+	statusText := r.URL.Query().Get("status")
+	tagText := r.URL.Query().Get("tag")
+	groupBy := splitList(r.URL.Query().Get("group_by"))
+	exprText := r.URL.Query().Get("expr")
+	summarize := SummarizeMode(r.URL.Query().Get("summarize"))
+	var budget ResponseBudget
 	sessionID := ""
 	queryText := ""
 	previous := ""
 	history := []string{}
+	snapshot := false
+	stats := false
+	ex := explainQuery(r, "assets")
 
 	if r.Method == http.MethodPost {
 		var aq AgenticQuery
-		if err := json.NewDecoder(r.Body).Decode(&aq); err != nil {
-			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		if !decodeJSON(w, r, &aq) {
 			return
 		}
+		if !checkSessionTenant(w, r, aq.Context.SessionID) {
+			return
+		}
+		if aq.Explain || aq.DryRun {
+			ex = startExplain(r.Context(), "assets", aq)
+		}
+		resolveReferences(r.Context(), "assets", &aq)
 		// Fallbacks for filters to handle different client usages
+		used := []string{"provider", "region", "status", "tag", "expr"}
 		if aq.Filters.Provider != "" {
 			provider = aq.Filters.Provider
 		} else if aq.Filters.Namespace != "" {
 			provider = aq.Filters.Namespace
+			used = append(used, "namespace")
+			addWarning(r.Context(), "deprecated_parameter", "filters.namespace", "filters.namespace is read as the provider on /assets for old clients; use filters.provider")
 		}
 		if aq.Filters.Region != "" {
 			region = aq.Filters.Region
 		} else if aq.Filters.Start != "" {
 			region = aq.Filters.Start
+			used = append(used, "start")
+			addWarning(r.Context(), "deprecated_parameter", "filters.start", "filters.start is read as the region on /assets for old clients; use filters.region")
 		}
+		warnIgnoredFilters(r.Context(), "/assets", aq.Filters, used...)
+		statusText = aq.Filters.Status
+		tagText = aq.Filters.Tag
+		groupBy = aq.GroupBy
+		exprText = aq.Filters.Expr
 		sessionID = aq.Context.SessionID
 		queryText = aq.Query
+		snapshot = aq.Context.Snapshot
+		stats = aq.Context.SessionStats
+		summarize = aq.Summarize
+		budget = aq.ResponseBudget
 
-		if sessionID != "" && queryText != "" {
-			if existing, ok := sessions[sessionID]; ok && len(existing) > 0 {
-				previous = existing[len(existing)-1]
-				history = append(existing, queryText)
-			} else {
-				history = []string{queryText}
-			}
-			sessions[sessionID] = history
+		// Update conversation history in memory
+		if !ex.dryRun() {
+			previous, history = recordQuery(r.Context(), sessionID, "assets", queryText, aq.Filters)
 		}
-		log.Printf("[MCP] Parsed agentic POST query: %+v\n", aq)
+		logf(r.Context(), "[MCP] Parsed agentic POST query: %+v\n", aq)
 	}
 
-	data, url, err := getAssetsWithFilters(provider, region)
-	if err != nil {
-		http.Error(w, "Failed to get assets: "+err.Error(), http.StatusInternalServerError)
+	provider = resolveAliases(r.Context(), "provider", provider)
+	region = resolveAliases(r.Context(), "region", region)
+	var verrs ValidationErrors
+	validateProvider(&verrs, provider)
+	statuses := parseStatusFilter(&verrs, "status", statusText)
+	tags := parseTagFilter(&verrs, "tag", tagText)
+	validateAssetGroupBy(&verrs, groupBy)
+	expr := parseExprFilter(&verrs, "expr", exprText, Asset{})
+	validateSummarize(&verrs, &summarize)
+	if r.Method != http.MethodPost {
+		budget = budgetFromQuery(&verrs, r.URL.Query())
+	}
+	budget.validate(&verrs)
+	ex.validateDryRun(&verrs, snapshot, false)
+	if len(verrs) > 0 {
+		logf(r.Context(), "[MCP] /assets — %v\n", verrs)
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, namespaceFilter{}, provider) {
 		return
 	}
-	log.Printf("[MCP Client] Fetching URL: %s\n", url)
-	log.Printf("[MCP] /assets — received %d records\n", len(data))
 
-	filtered := []Asset{}
-	for _, asset := range data {
-		if provider != "" && !strings.EqualFold(asset.Provider, provider) {
-			continue
-		}
-		if region != "" && !strings.EqualFold(asset.Region, region) {
-			continue
-		}
-		filtered = append(filtered, asset)
+	data, err := costSource.GetAssets(r.Context(), AssetFilter{Provider: provider, Region: region})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get assets", err)
+		return
 	}
+	logf(r.Context(), "[MCP] /assets — received %d records\n", len(data))
+	warnUnknownProvider(r.Context(), provider)
+
+	ex.filter("provider", provider)
+	ex.filter("region", region)
+	ex.filter("status", statusText)
+	ex.filter("tag", tagText)
+	ex.filter("expr", exprText)
+	filtered := applySteps(ex, data,
+		filterStep[Asset]{"provider", provider, func(a Asset) bool { return provider == "" || strings.EqualFold(a.Provider, provider) }},
+		filterStep[Asset]{"region", region, func(a Asset) bool { return region == "" || strings.EqualFold(a.Region, region) }},
+		filterStep[Asset]{"status", statusText, func(a Asset) bool { return len(statuses) == 0 || slices.Contains(statuses, assetStatus(a)) }},
+		filterStep[Asset]{"tag", tagText, func(a Asset) bool { return matchesTags(a.Tags, tags) }},
+		filterStep[Asset]{"expr", exprText, func(a Asset) bool { return expr.matches(a) }},
+	)
 
 	resp := map[string]interface{}{
 		"data": filtered,
 		"meta": map[string]interface{}{
-			"filtersUsed":          map[string]string{"provider": provider, "region": region},
+			"filtersUsed":          map[string]string{"provider": provider, "region": region, "status": statusText, "tag": tagText, "expr": exprText},
 			"session_id":           sessionID,
 			"previous_query":       previous,
 			"conversation_context": history,
 			"total":                len(filtered),
+			"request_id":           requestIDFrom(r.Context()),
 		},
 	}
+	// With group_by, answer with nested cost groups instead of raw assets
+	if len(groupBy) > 0 {
+		groups := groupAssets(filtered, groupBy)
+		meta := resp["meta"].(map[string]interface{})
+		resp["data"] = groups
+		meta["total"] = len(groups)
+		meta["assets"] = len(filtered)
+		meta["group_by"] = groupBy
+	}
+	applySummary(resp, summarize, summarizeAssets(filtered))
+	applyBudget(resp, budget)
+	addSessionStats(resp, sessionID, stats)
+	saveSnapshot(r.Context(), "assets", sessionID, queryText, snapshot, resp)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
 func main() {
-	// Register HTTP handlers for MCP endpoints
-	http.HandleFunc("/cloudCosts", cloudCostsHandler)
-	http.HandleFunc("/allocations", allocationsHandler)
-	http.HandleFunc("/assets", assetsHandler)
+	netCfg, err := loadNetworkConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid network config: %v", err)
+	}
+	costSource = &HTTPSource{BaseURL: netCfg.BackendURL}
+	prometheusURL = netCfg.PrometheusURL
+	if err := configureDiscovery(context.Background()); err != nil {
+		log.Fatalf("Invalid backend discovery: %v", err)
+	}
+	if err := configureProxy(); err != nil {
+		log.Fatalf("Invalid OpenCost proxy: %v", err)
+	}
+
+	if err := loadLimits(); err != nil {
+		log.Fatalf("Invalid limits: %v", err)
+	}
+	loadCORSConfig()
+	loadAdminConfig()
+	serverTLS, err := loadServerTLS()
+	if err != nil {
+		log.Fatalf("Invalid TLS config: %v", err)
+	}
+	if err := configureBackendPool(); err != nil {
+		log.Fatalf("Invalid backend pool config: %v", err)
+	}
+	if err := configureBackendTLS(); err != nil {
+		log.Fatalf("Invalid backend TLS config: %v", err)
+	}
+	if err := configureCostSource(); err != nil {
+		log.Fatalf("Invalid cost source: %v", err)
+	}
+	if err := configureLocalStore(); err != nil {
+		log.Fatalf("Invalid local store: %v", err)
+	}
+	if err := configureExports(); err != nil {
+		log.Fatalf("Invalid export destination: %v", err)
+	}
+	if err := configureDedup(); err != nil {
+		log.Fatalf("Invalid dedup policy: %v", err)
+	}
+	enableCurrency()
+	enableProfiling()
+	enableObservation()
+	configureTracing(context.Background())
+	if ttl := os.Getenv("BACKEND_CACHE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatalf("Invalid BACKEND_CACHE_TTL: %v", err)
+		}
+		setBackendCacheTTL(d)
+	}
+	if err := loadStreamConfig(); err != nil {
+		log.Fatalf("Invalid streaming config: %v", err)
+	}
+	if err := loadDefaultExclusions(); err != nil {
+		log.Fatalf("Invalid default namespace exclusions: %v", err)
+	}
+	if err := loadBatchConfig(); err != nil {
+		log.Fatalf("Invalid batch config: %v", err)
+	}
+	if err := loadJobConfig(); err != nil {
+		log.Fatalf("Invalid job config: %v", err)
+	}
+	if err := loadTenants(os.Getenv("TENANTS_FILE")); err != nil {
+		log.Fatalf("Invalid tenants: %v", err)
+	}
+	if err := configureSlack(); err != nil {
+		log.Fatalf("Invalid Slack config: %v", err)
+	}
+	if err := loadTeamMapping(os.Getenv("TEAM_MAPPING_FILE")); err != nil {
+		log.Fatalf("Invalid team mapping: %v", err)
+	}
+	if err := loadFilterAliases(os.Getenv("FILTER_ALIASES_FILE")); err != nil {
+		log.Fatalf("Invalid filter aliases: %v", err)
+	}
+	if err := loadCurrencyConfig(); err != nil {
+		log.Fatalf("Invalid currency config: %v", err)
+	}
+	if err := loadSharedCostConfig(); err != nil {
+		log.Fatalf("Invalid shared cost config: %v", err)
+	}
+	if err := loadDiscounts(os.Getenv("SAVINGS_DISCOUNTS_FILE")); err != nil {
+		log.Fatalf("Invalid discounts: %v", err)
+	}
+	if err := loadCarbonIntensity(os.Getenv("CARBON_INTENSITY_FILE")); err != nil {
+		log.Fatalf("Invalid carbon intensity: %v", err)
+	}
+	if err := configureSMTP(); err != nil {
+		log.Fatalf("Invalid SMTP config: %v", err)
+	}
+	if err := configureHistory(); err != nil {
+		log.Fatalf("Invalid result history config: %v", err)
+	}
+	queriesFile := os.Getenv("SAVED_QUERIES_FILE")
+	if queriesFile == "" {
+		queriesFile = "queries.json"
+	}
+	if err := savedQueries.load(queriesFile); err != nil {
+		log.Fatalf("Invalid saved queries: %v", err)
+	}
+	policiesFile := os.Getenv("POLICIES_FILE")
+	if policiesFile == "" {
+		policiesFile = "policies.json"
+	}
+	if err := policies.load(policiesFile); err != nil {
+		log.Fatalf("Invalid policies: %v", err)
+	}
+	// Schedules refer to saved queries and policies, so they load last
+	schedulesFile := os.Getenv("SCHEDULES_FILE")
+	if schedulesFile == "" {
+		schedulesFile = "schedules.json"
+	}
+	if err := schedules.load(schedulesFile); err != nil {
+		log.Fatalf("Invalid schedules: %v", err)
+	}
+	startScheduler(context.Background())
+	startIngestion(context.Background())
+	if err := loadAlertConfig(os.Getenv("ALERTS_FILE")); err != nil {
+		log.Fatalf("Invalid alert config: %v", err)
+	}
+	startAlerting(context.Background())
 
-	log.Println("Starting MCP server on :9004...")
-	if err := http.ListenAndServe(":9004", nil); err != nil {
+	// Register HTTP handlers for MCP endpoints, with the role each needs (see rbac.go). Cost
+	// reads are tagged with ETags (see etag.go)
+	handle("/cloudCosts", roleViewer, "cloud_costs", "Cloud costs per VM or pod, filtered by namespace", withETag(cloudCostsHandler))
+	handle("/allocations", roleViewer, "allocations", "Kubernetes allocations by namespace and window, optionally as a time series or enriched with assets", withETag(allocationsHandler))
+	handle("/allocations/compare", roleViewer, "compare_allocations", "Per-namespace cost change between two windows", withETag(compareAllocationsHandler))
+	handle("/assets", roleViewer, "assets", "Cloud assets filtered by provider, region and lifecycle status", withETag(assetsHandler))
+	handle("GET /assets/orphaned", roleViewer, "orphaned_assets", "Assets still costing money while stopped, terminated or unused by any allocation", withETag(assetsOrphanedHandler))
+	handle("GET /assets/waste", roleViewer, "wasted_assets", "Unattached disks, idle load balancers and stopped-but-billed VMs with their monthly burn", withETag(assetsWasteHandler))
+	handle("GET /assets/utilization", roleViewer, "asset_utilization", "Node assets joined with Prometheus utilization, flagging underutilized ones", withETag(assetUtilizationHandler))
+	handle("/query", roleViewer, "query", "Natural-language query routed to the best endpoint", withETag(queryHandler))
+	handle("GET /carbon", roleViewer, "carbon", "Estimated energy and CO2e of allocations by namespace and region", withETag(carbonHandler))
+	handle("GET /savings", roleViewer, "savings", "Potential savings from moving assets between on-demand, reserved and spot pricing", withETag(savingsHandler))
+	handle("GET /gpu", roleViewer, "gpu_costs", "GPU allocation cost by namespace and node, with GPU utilization and idle cost", withETag(gpuHandler))
+	handle("GET /overview", roleViewer, "overview", "Allocations, cloud costs and assets in one call, each summarized; a failing part is reported rather than failing the call", withETag(overviewHandler))
+	handle("GET /namespaces", roleViewer, "list_namespaces", "Namespaces present in the allocations of a window, with record counts and cost", withETag(namespacesCatalogHandler))
+	handle("GET /labels", roleViewer, "list_labels", "Allocation label keys and their values in a window, with record counts and cost", withETag(labelsCatalogHandler))
+	handle("GET /providers", roleViewer, "list_providers", "Cloud providers of the assets, with record counts and cost", withETag(providersCatalogHandler))
+	handle("GET /regions", roleViewer, "list_regions", "Regions of the assets per provider, with record counts and cost", withETag(regionsCatalogHandler))
+	handle("/costs/by-team", roleViewer, "costs_by_team", "Allocation costs attributed to teams", withETag(costsByTeamHandler))
+	handle("GET /reports", roleViewer, "reports", "Cost report over a window by namespace or team, as JSON or CSV", withETag(reportsHandler))
+	handle("GET /schedules", roleViewer, "list_schedules", "List scheduled reports", listSchedulesHandler)
+	handle("POST /schedules", roleAnalyst, "create_schedule", "Create a scheduled report", createScheduleHandler)
+	handle("GET /schedules/{id}", roleViewer, "get_schedule", "Get a scheduled report", getScheduleHandler)
+	handle("PUT /schedules/{id}", roleAnalyst, "update_schedule", "Update a scheduled report", updateScheduleHandler)
+	handle("DELETE /schedules/{id}", roleAnalyst, "delete_schedule", "Delete a scheduled report", deleteScheduleHandler)
+	handle("POST /schedules/{id}/run", roleAnalyst, "run_schedule", "Run a scheduled report now", runScheduleHandler)
+	handle("GET /queries", roleViewer, "list_saved_queries", "List saved queries", listSavedQueriesHandler)
+	handle("GET /queries/{name}", roleViewer, "get_saved_query", "Get a saved query", getSavedQueryHandler)
+	handle("PUT /queries/{name}", roleAnalyst, "put_saved_query", "Create or replace a saved query", putSavedQueryHandler)
+	handle("DELETE /queries/{name}", roleAnalyst, "delete_saved_query", "Delete a saved query", deleteSavedQueryHandler)
+	handle("POST /queries/{name}/run", roleViewer, "run_saved_query", "Run a saved query", runSavedQueryHandler)
+	handle("GET /policies", roleViewer, "list_policies", "List allocation policies", listPoliciesHandler)
+	handle("GET /policies/{name}", roleViewer, "get_policy", "Get an allocation policy", getPolicyHandler)
+	handle("PUT /policies/{name}", roleAdmin, "put_policy", "Create or replace an allocation policy splitting costs by label or namespace", putPolicyHandler)
+	handle("DELETE /policies/{name}", roleAdmin, "delete_policy", "Delete an allocation policy", deletePolicyHandler)
+	handle("GET /sessions/{session_id}/export", roleViewer, "export_session", "Export a session's history and snapshots", exportSessionHandler)
+	handle("POST /sessions/import", roleAnalyst, "import_session", "Import an exported session", importSessionHandler)
+	handle("POST /feedback", roleViewer, "post_feedback", "Rate a query's answer, optionally with a correction", postFeedbackHandler)
+	handle("GET /feedback/stats", roleViewer, "feedback_stats", "Aggregate query feedback", feedbackStatsHandler)
+	handle("POST /sessions/{session_id}/fork", roleAnalyst, "fork_session", "Copy a session into a new session to explore a tangent", forkSessionHandler)
+	handle("GET /history/{session_id}", roleViewer, "history", "List a session's saved snapshots", historyHandler)
+	handle("GET /history/{session_id}/{snapshot_id}", roleViewer, "snapshot", "Get one saved snapshot", snapshotHandler)
+	handle("POST /estimate", roleViewer, "estimate", "Estimate a query's record count, backend calls and response size without running it", estimateHandler)
+	handle("POST /batch", roleViewer, "batch", "Run an array of queries concurrently; results come back in request order", batchHandler)
+	handle("POST /jobs", roleViewer, "create_job", "Run a query in the background, optionally over several windows; answers with a job ID", createJobHandler)
+	handle("GET /jobs", roleViewer, "list_jobs", "List the caller's jobs", listJobsHandler)
+	handle("GET /jobs/{id}", roleViewer, "get_job", "Get a job's status, progress and results", getJobHandler)
+	handle("DELETE /jobs/{id}", roleViewer, "cancel_job", "Cancel a queued or running job", cancelJobHandler)
+	handle("GET /alerts", roleViewer, "alerts", "Recent budget and anomaly alerts", alertsHandler)
+	handle("POST /alerts/evaluate", roleAnalyst, "evaluate_alerts", "Evaluate budgets and anomaly rules now", evaluateAlertsHandler)
+	handle("GET /admin/feedback", roleAdmin, "admin_list_feedback", "List query feedback for review", adminFeedbackHandler)
+	handle("GET /admin/sessions", roleAdmin, "admin_list_sessions", "List sessions with their size and activity", adminListSessionsHandler)
+	handle("DELETE /admin/sessions/{session_id}", roleAdmin, "admin_delete_session", "Delete a session and its snapshots", adminDeleteSessionHandler)
+	handle("GET /opencost/{path...}", roleViewer, "opencost_proxy", "Forward to an allowlisted OpenCost endpoint (OPENCOST_PROXY_PATHS)", opencostProxyHandler)
+	handle("GET /grafana/{$}", roleViewer, "grafana_test", "Grafana SimpleJSON datasource connection test", grafanaRootHandler)
+	handle("POST /grafana/search", roleViewer, "grafana_search", "Grafana SimpleJSON: list chartable cost metrics", grafanaSearchHandler)
+	handle("POST /grafana/query", roleViewer, "grafana_query", "Grafana SimpleJSON: cost time series or tables for a panel's range", grafanaQueryHandler)
+	handle("POST /grafana/annotations", roleViewer, "grafana_annotations", "Grafana SimpleJSON: alerts as annotations", grafanaAnnotationsHandler)
+	handle("POST /grafana/tag-keys", roleViewer, "grafana_tag_keys", "Grafana SimpleJSON: ad hoc filter keys", grafanaTagKeysHandler)
+	handle("POST /grafana/tag-values", roleViewer, "grafana_tag_values", "Grafana SimpleJSON: ad hoc filter values", grafanaTagValuesHandler)
+	handle("/sql", roleAnalyst, "sql", "Read-only SQL subset over the local history store", sqlHandler)
+	handle("GET /admin/store", roleAdmin, "admin_store", "Local history store contents and ingestion status", adminStoreHandler)
+	handle("POST /admin/backfill", roleAdmin, "admin_backfill", "Load a historical range into the local store in chunks", createBackfillHandler)
+	handle("GET /admin/backfill", roleAdmin, "admin_list_backfills", "List backfills with their progress", listBackfillsHandler)
+	handle("GET /admin/backfill/{id}", roleAdmin, "admin_get_backfill", "Get a backfill's progress", getBackfillHandler)
+	handle("POST /admin/backfill/{id}/resume", roleAdmin, "admin_resume_backfill", "Resume a failed or canceled backfill", resumeBackfillHandler)
+	handle("DELETE /admin/backfill/{id}", roleAdmin, "admin_cancel_backfill", "Cancel a running backfill", cancelBackfillHandler)
+	handle("POST /admin/export", roleAdmin, "admin_export", "Export stored allocation history as Parquet partitioned by day and namespace", createExportHandler)
+	handle("GET /admin/export", roleAdmin, "admin_list_exports", "List Parquet exports with their progress", listExportsHandler)
+	handle("GET /admin/export/{id}", roleAdmin, "admin_get_export", "Get a Parquet export's progress", getExportHandler)
+	handle("DELETE /admin/export/{id}", roleAdmin, "admin_cancel_export", "Cancel a running Parquet export", cancelExportHandler)
+	handle("POST /admin/sessions/expire", roleAdmin, "admin_expire_sessions", "Delete sessions idle longer than idle", adminExpireSessionsHandler)
+	http.HandleFunc("POST /slack/commands", slackCommandHandler)
+	http.HandleFunc("POST /slack/events", slackEventsHandler)
+	http.HandleFunc("GET /tools", toolsHandler)
+	http.HandleFunc("GET /metrics", metricsHandler)
+	http.HandleFunc("/", notFoundHandler)
+
+	handler := withRequestID(withCORS(withGzip(withAPIVersion(withTenants(withLimits(withWarnings(withTracing(withMetrics(http.DefaultServeMux)))))))))
+	srv := newHTTPServer(netCfg.addr(), handler)
+	if serverTLS != nil {
+		srv.TLSConfig = serverTLS
+		log.Printf("Starting MCP server on %s (HTTPS), backend %s...", srv.Addr, netCfg.BackendURL)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		log.Printf("Starting MCP server on %s, backend %s...", srv.Addr, netCfg.BackendURL)
+		err = srv.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatalf("Server failed to start: %v", err)
 	}
 }
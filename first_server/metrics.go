@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Prometheus metrics =====
+//
+// A small hand-rolled registry rendering the Prometheus text exposition format, so the
+// server keeps its zero-dependency build.
+
+// defaultBuckets are the Prometheus client default histogram buckets, in seconds.
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogram struct {
+	counts []uint64 // per bucket, cumulative at render time
+	sum    float64
+	count  uint64
+}
+
+// metricFamily is a counter or histogram keyed by its rendered label set.
+type metricFamily struct {
+	name, help, kind string
+	counters         map[string]float64
+	histograms       map[string]*histogram
+}
+
+type registry struct {
+	mu       sync.Mutex
+	families map[string]*metricFamily
+	order    []string
+}
+
+var metrics = &registry{families: map[string]*metricFamily{}}
+
+func (reg *registry) family(name, help, kind string) *metricFamily {
+	f, ok := reg.families[name]
+	if !ok {
+		f = &metricFamily{name: name, help: help, kind: kind, counters: map[string]float64{}, histograms: map[string]*histogram{}}
+		reg.families[name] = f
+		reg.order = append(reg.order, name)
+	}
+	return f
+}
+
+// labelString renders alternating key, value pairs as {k="v",...}.
+func labelString(kv ...string) string {
+	if len(kv) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(kv[i+1])
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, kv[i], v))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// inc adds 1 to a counter.
+func (reg *registry) inc(name, help string, kv ...string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.family(name, help, "counter").counters[labelString(kv...)]++
+}
+
+// observe records a value in a histogram.
+func (reg *registry) observe(name, help string, v float64, kv ...string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	f := reg.family(name, help, "histogram")
+	key := labelString(kv...)
+	h, ok := f.histograms[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(defaultBuckets))}
+		f.histograms[key] = h
+	}
+	for i, b := range defaultBuckets {
+		if v <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// withBucketLabel adds le="..." to an existing label string.
+func withBucketLabel(labels, le string) string {
+	if labels == "" {
+		return `{le="` + le + `"}`
+	}
+	return labels[:len(labels)-1] + `,le="` + le + `"}`
+}
+
+// render writes every family in text exposition format.
+func (reg *registry) render(b *strings.Builder) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, name := range reg.order {
+		f := reg.families[name]
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		keys := make([]string, 0, len(f.counters)+len(f.histograms))
+		for k := range f.counters {
+			keys = append(keys, k)
+		}
+		for k := range f.histograms {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if f.kind == "counter" {
+				fmt.Fprintf(b, "%s%s %g\n", f.name, k, f.counters[k])
+				continue
+			}
+			h := f.histograms[k]
+			var cum uint64
+			for i, le := range defaultBuckets {
+				cum += h.counts[i]
+				fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, withBucketLabel(k, fmt.Sprint(le)), cum)
+			}
+			fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, withBucketLabel(k, "+Inf"), h.count)
+			fmt.Fprintf(b, "%s_sum%s %g\n", f.name, k, h.sum)
+			fmt.Fprintf(b, "%s_count%s %d\n", f.name, k, h.count)
+		}
+	}
+}
+
+// ===== Instrumentation points =====
+
+// observeBackend records one downstream call.
+func observeBackend(what string, d time.Duration, err error) {
+	outcome := "ok"
+	switch {
+	case errors.Is(err, context.Canceled):
+		outcome = "canceled"
+	case err != nil:
+		outcome = "error"
+	}
+	metrics.inc("mcp_backend_requests_total", "Downstream backend requests by endpoint and outcome.", "endpoint", what, "outcome", outcome)
+	metrics.observe("mcp_backend_request_duration_seconds", "Downstream backend request latency.", d.Seconds(), "endpoint", what)
+}
+
+// observeCache records a backend cache lookup.
+func observeCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	metrics.inc("mcp_cache_requests_total", "Backend response cache lookups by result.", "result", result)
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// withMetrics counts and times every request. It must wrap the ServeMux directly so the
+// matched route pattern (r.Pattern) is available as a low-cardinality path label.
+func withMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if i := strings.IndexByte(route, ' '); i >= 0 {
+			route = route[i+1:] // drop the method from "GET /schedules/{id}"
+		}
+		if route == "" || route == "/" {
+			route = "unmatched"
+		}
+		metrics.inc("mcp_http_requests_total", "HTTP requests by route, method and status.", "path", route, "method", r.Method, "status", fmt.Sprint(rec.status))
+		metrics.observe("mcp_http_request_duration_seconds", "HTTP request latency by route.", time.Since(start).Seconds(), "path", route)
+	})
+}
+
+// metricsHandler handles GET /metrics.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	metrics.render(&b)
+
+	sessionsMu.Lock()
+	active := len(sessions)
+	sessionsMu.Unlock()
+	fmt.Fprintf(&b, "# HELP mcp_active_sessions Conversation sessions currently held in memory.\n# TYPE mcp_active_sessions gauge\nmcp_active_sessions %d\n", active)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// namespaceFilter is the parsed form of a namespace filter value: a comma-separated list of
+// terms, each a plain name, a /regex/, or either prefixed with "!" to exclude. For example
+// "prod,staging", "!kube-system" or "/^team-.*/,!team-sandbox".
+//
+// A value matches when it matches any include term (or there are none) and no exclude term.
+// Without include terms, the default exclusions added by withDefaultExclusions apply too.
+type namespaceFilter struct {
+	raw      string
+	includes []nsTerm
+	excludes []nsTerm
+	defaults []nsTerm
+}
+
+type nsTerm struct {
+	name string
+	re   *regexp.Regexp
+}
+
+func (t nsTerm) String() string {
+	if t.re != nil {
+		return "/" + t.re.String() + "/"
+	}
+	return t.name
+}
+
+// defaultExclusions are namespaces left out of allocation responses unless a request names
+// the namespaces it wants, set by DEFAULT_EXCLUDED_NAMESPACES, e.g. "kube-system,monitoring"
+// (regexes work too). Any include term counts as asking: namespace=kube-system shows
+// kube-system, and namespace=/.*/ shows everything. Exclusions alone (namespace=!dev) keep
+// the defaults.
+var defaultExclusions []nsTerm
+
+// loadDefaultExclusions reads DEFAULT_EXCLUDED_NAMESPACES.
+func loadDefaultExclusions() error {
+	var verrs ValidationErrors
+	f := parseNamespaceFilter(&verrs, "DEFAULT_EXCLUDED_NAMESPACES", os.Getenv("DEFAULT_EXCLUDED_NAMESPACES"))
+	if len(verrs) > 0 {
+		return verrs
+	}
+	if len(f.excludes) > 0 {
+		return fmt.Errorf("DEFAULT_EXCLUDED_NAMESPACES lists namespaces to exclude; drop the \"!\"")
+	}
+	defaultExclusions = f.includes
+	return nil
+}
+
+// parseNamespaceFilter parses s, recording invalid regexes in errs under field.
+func parseNamespaceFilter(errs *ValidationErrors, field, s string) namespaceFilter {
+	f := namespaceFilter{raw: s}
+	for _, part := range splitList(s) {
+		exclude := strings.HasPrefix(part, "!")
+		part = strings.TrimSpace(strings.TrimPrefix(part, "!"))
+		if part == "" {
+			errs.add(field, s, "empty term")
+			continue
+		}
+		term := nsTerm{name: part}
+		if len(part) > 2 && strings.HasPrefix(part, "/") && strings.HasSuffix(part, "/") {
+			re, err := regexp.Compile(part[1 : len(part)-1])
+			if err != nil {
+				errs.add(field, part, "invalid regex: "+err.Error())
+				continue
+			}
+			term = nsTerm{re: re}
+		}
+		if exclude {
+			f.excludes = append(f.excludes, term)
+		} else {
+			f.includes = append(f.includes, term)
+		}
+	}
+	return f
+}
+
+// withDefaultExclusions returns f with DEFAULT_EXCLUDED_NAMESPACES applied.
+func (f namespaceFilter) withDefaultExclusions() namespaceFilter {
+	f.defaults = defaultExclusions
+	return f
+}
+
+// appliedDefaults lists the default exclusions in effect, i.e. when f has no include terms.
+func (f namespaceFilter) appliedDefaults() []string {
+	if len(f.includes) > 0 || len(f.defaults) == 0 {
+		return nil
+	}
+	out := make([]string, len(f.defaults))
+	for i, t := range f.defaults {
+		out[i] = t.String()
+	}
+	return out
+}
+
+// noteDefaultExclusions records the default exclusions applied by f in meta.excluded_namespaces.
+func noteDefaultExclusions(meta map[string]interface{}, f namespaceFilter) {
+	if applied := f.appliedDefaults(); applied != nil {
+		meta["excluded_namespaces"] = applied
+	}
+}
+
+// empty reports whether the filter accepts everything.
+func (f namespaceFilter) empty() bool {
+	return len(f.includes) == 0 && len(f.excludes) == 0 && f.appliedDefaults() == nil
+}
+
+// pushdown returns the namespace to send to the backend, which only understands a single
+// plain name; anything richer is fetched unfiltered and matched locally.
+func (f namespaceFilter) pushdown() string {
+	if len(f.includes) == 1 && len(f.excludes) == 0 && f.includes[0].re == nil {
+		return f.includes[0].name
+	}
+	return ""
+}
+
+// matches tests a namespace: plain terms must equal it exactly.
+func (f namespaceFilter) matches(ns string) bool { return f.match(ns, false) }
+
+// matchesName tests a resource name that embeds a namespace (cloud costs are matched by VM
+// or pod name): plain terms match as case-insensitive substrings.
+func (f namespaceFilter) matchesName(name string) bool { return f.match(name, true) }
+
+func (f namespaceFilter) match(v string, substring bool) bool {
+	hit := func(t nsTerm) bool {
+		switch {
+		case t.re != nil:
+			return t.re.MatchString(v)
+		case substring:
+			return strings.Contains(strings.ToLower(v), strings.ToLower(t.name))
+		default:
+			return v == t.name
+		}
+	}
+	for _, t := range f.excludes {
+		if hit(t) {
+			return false
+		}
+	}
+	if len(f.includes) == 0 {
+		for _, t := range f.defaults {
+			if hit(t) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, t := range f.includes {
+		if hit(t) {
+			return true
+		}
+	}
+	return false
+}
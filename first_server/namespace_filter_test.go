@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNamespaceFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		pushdown string
+		match    string // namespaces that match, of prod, staging, team-a, team-sandbox, kube-system
+	}{
+		{"", "", "prod,staging,team-a,team-sandbox,kube-system"},
+		{"prod", "prod", "prod"},
+		{" prod , staging ", "", "prod,staging"},
+		{"!kube-system", "", "prod,staging,team-a,team-sandbox"},
+		{"/^team-/", "", "team-a,team-sandbox"},
+		{"/^team-/,!team-sandbox", "", "team-a"},
+		{"!/^team-/,!kube-system", "", "prod,staging"},
+		{"Prod", "Prod", ""}, // plain names match exactly
+		{"/(?i)^PROD$/", "", "prod"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			var verrs ValidationErrors
+			f := parseNamespaceFilter(&verrs, "namespace", tt.filter)
+			if len(verrs) > 0 {
+				t.Fatal(verrs)
+			}
+			if got := f.pushdown(); got != tt.pushdown {
+				t.Errorf("pushdown = %q, want %q", got, tt.pushdown)
+			}
+			var matched []string
+			for _, ns := range []string{"prod", "staging", "team-a", "team-sandbox", "kube-system"} {
+				if f.matches(ns) {
+					matched = append(matched, ns)
+				}
+			}
+			if got := strings.Join(matched, ","); got != tt.match {
+				t.Errorf("matches %s, want %s", got, tt.match)
+			}
+		})
+	}
+}
+
+func TestParseNamespaceFilterErrors(t *testing.T) {
+	tests := []struct {
+		filter, value, want string
+	}{
+		{"prod,!", "prod,!", "empty term"},
+		{"/[a-/", "/[a-/", "invalid regex: "},
+	}
+	for _, tt := range tests {
+		var verrs ValidationErrors
+		parseNamespaceFilter(&verrs, "namespace", tt.filter)
+		if len(verrs) != 1 || verrs[0].Field != "namespace" || verrs[0].Value != tt.value || !strings.HasPrefix(verrs[0].Message, tt.want) {
+			t.Errorf("%q: got %+v, want one error %q for %q", tt.filter, verrs, tt.want, tt.value)
+		}
+	}
+}
+
+func TestNamespaceFilterMatchesName(t *testing.T) {
+	var verrs ValidationErrors
+	f := parseNamespaceFilter(&verrs, "namespace", "prod,!sandbox")
+	for name, want := range map[string]bool{"vm-PROD-web": true, "prod-sandbox-1": false, "staging-db": false} {
+		if got := f.matchesName(name); got != want {
+			t.Errorf("matchesName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestNamespaceFilterDefaultExclusions(t *testing.T) {
+	saved := defaultExclusions
+	t.Cleanup(func() { defaultExclusions = saved })
+	t.Setenv("DEFAULT_EXCLUDED_NAMESPACES", "kube-system,/^monitoring/")
+	if err := loadDefaultExclusions(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		filter  string
+		match   string // of prod, kube-system, monitoring-1
+		applied string
+	}{
+		{"", "prod", "kube-system,/^monitoring/"},
+		{"!prod", "", "kube-system,/^monitoring/"},
+		{"kube-system", "kube-system", ""},
+		{"/.*/", "prod,kube-system,monitoring-1", ""},
+	}
+	for _, tt := range tests {
+		var verrs ValidationErrors
+		f := parseNamespaceFilter(&verrs, "namespace", tt.filter).withDefaultExclusions()
+		var matched []string
+		for _, ns := range []string{"prod", "kube-system", "monitoring-1"} {
+			if f.matches(ns) {
+				matched = append(matched, ns)
+			}
+		}
+		if got := strings.Join(matched, ","); got != tt.match {
+			t.Errorf("%q matches %s, want %s", tt.filter, got, tt.match)
+		}
+		if got := strings.Join(f.appliedDefaults(), ","); got != tt.applied {
+			t.Errorf("%q applies %s, want %s", tt.filter, got, tt.applied)
+		}
+	}
+
+	t.Setenv("DEFAULT_EXCLUDED_NAMESPACES", "!kube-system")
+	if err := loadDefaultExclusions(); err == nil || !strings.Contains(err.Error(), `drop the "!"`) {
+		t.Errorf("got %v, want the exclusion error", err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ===== Listen address and backend =====
+//
+// The server listens on HOST:PORT and reads cost data from BACKEND_URL, so it can run in a
+// container next to the mock or a real OpenCost instead of assuming localhost. Each setting
+// is also a flag (-host, -port, -backend-url, -prometheus-url); flags win over the
+// environment, which wins over the defaults below.
+
+const (
+	defaultPort       = "9004"
+	defaultBackendURL = "http://localhost:9005"
+)
+
+// networkConfig is where the server listens and where its backends are.
+type networkConfig struct {
+	Host          string
+	Port          string
+	BackendURL    string
+	PrometheusURL string // defaults to BackendURL, which the mock serves /api/v1/query on
+}
+
+// addr is the listen address for http.Server.
+func (c networkConfig) addr() string {
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// loadNetworkConfig reads the environment and command-line args.
+func loadNetworkConfig(args []string) (networkConfig, error) {
+	var c networkConfig
+	fs := flag.NewFlagSet("first_server", flag.ContinueOnError)
+	fs.StringVar(&c.Host, "host", os.Getenv("HOST"), "interface to listen on; empty for all (env HOST)")
+	fs.StringVar(&c.Port, "port", envOr("PORT", defaultPort), "port to listen on (env PORT)")
+	fs.StringVar(&c.BackendURL, "backend-url", envOr("BACKEND_URL", defaultBackendURL), "OpenCost-style backend (env BACKEND_URL)")
+	fs.StringVar(&c.PrometheusURL, "prometheus-url", os.Getenv("PROMETHEUS_URL"), "Prometheus for utilization; default the backend (env PROMETHEUS_URL)")
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if p, err := strconv.Atoi(c.Port); err != nil || p < 1 || p > 65535 {
+		return c, fmt.Errorf("port %q must be a number from 1 to 65535", c.Port)
+	}
+	if c.PrometheusURL == "" {
+		c.PrometheusURL = c.BackendURL
+	}
+	for name, v := range map[string]*string{"backend URL": &c.BackendURL, "Prometheus URL": &c.PrometheusURL} {
+		u, err := url.Parse(*v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return c, fmt.Errorf("%s %q must be an http(s) URL such as http://opencost:9003", name, *v)
+		}
+		*v = strings.TrimRight(*v, "/")
+	}
+	return c, nil
+}
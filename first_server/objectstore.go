@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ===== Object storage =====
+//
+// objectWriter puts whole files under a local directory, into an S3 bucket or into a Google
+// Cloud Storage bucket, for exports and scheduled reports that land in object storage.
+// Credentials come from the environment, see cloud_credentials.go. S3 requests are signed
+// with signSigV4 (see aws_cost_explorer.go) in AWS_REGION (default us-east-1);
+// AWS_S3_ENDPOINT points at an S3-compatible store such as MinIO, addressed path-style.
+// GCS uploads use the JSON API; STORAGE_EMULATOR_HOST points at an emulator, without
+// authentication.
+
+// objectWriter writes objects under one destination.
+type objectWriter interface {
+	// put writes body as key, relative to the destination's prefix.
+	put(ctx context.Context, key string, body []byte, contentType string) error
+	// location is where key ends up, for logs and API responses.
+	location(key string) string
+}
+
+// newObjectWriter parses a destination: "s3://bucket/prefix", "gs://bucket/prefix" or a
+// local directory, optionally as a file:// URL.
+func newObjectWriter(dest string) (objectWriter, error) {
+	for _, scheme := range []string{"s3://", "gs://"} {
+		rest, ok := strings.CutPrefix(dest, scheme)
+		if !ok {
+			continue
+		}
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		if bucket == "" {
+			return nil, fmt.Errorf("%q has no bucket", dest)
+		}
+		if scheme == "gs://" {
+			return newGCSWriter(bucket, prefix), nil
+		}
+		return newS3Writer(bucket, prefix)
+	}
+	if strings.Contains(dest, "://") && !strings.HasPrefix(dest, "file://") {
+		return nil, fmt.Errorf("%q: want s3://bucket/prefix, gs://bucket/prefix or a local directory", dest)
+	}
+	dir := strings.TrimPrefix(dest, "file://")
+	if dir == "" {
+		return nil, fmt.Errorf("destination is empty")
+	}
+	return dirWriter(dir), nil
+}
+
+// joinKey joins a prefix and a key with a slash.
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
+
+// dirWriter writes objects as files under a local directory.
+type dirWriter string
+
+func (d dirWriter) put(ctx context.Context, key string, body []byte, contentType string) error {
+	path := filepath.Join(string(d), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", body, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (d dirWriter) location(key string) string {
+	return filepath.Join(string(d), filepath.FromSlash(key))
+}
+
+// s3Writer writes objects into an S3 bucket with PutObject.
+type s3Writer struct {
+	bucket, prefix string
+	region         string
+	endpoint       string // path-style endpoint, empty for AWS virtual-hosted style
+	now            func() time.Time
+}
+
+func newS3Writer(bucket, prefix string) (*s3Writer, error) {
+	if !awsCredentialsConfigured() {
+		return nil, fmt.Errorf("s3 destinations require AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	w := &s3Writer{
+		bucket:   bucket,
+		prefix:   strings.Trim(prefix, "/"),
+		region:   os.Getenv("AWS_REGION"),
+		endpoint: strings.TrimRight(os.Getenv("AWS_S3_ENDPOINT"), "/"),
+		now:      time.Now,
+	}
+	if w.region == "" {
+		w.region = "us-east-1"
+	}
+	return w, nil
+}
+
+func (w *s3Writer) location(key string) string {
+	return "s3://" + w.bucket + "/" + joinKey(w.prefix, key)
+}
+
+// objectURL addresses key virtual-hosted style on AWS, or path-style on AWS_S3_ENDPOINT.
+// Every path segment is escaped as SigV4 expects, so keys like "day=2025-08-01" sign right.
+func (w *s3Writer) objectURL(key string) (*url.URL, error) {
+	base := "https://" + w.bucket + ".s3." + w.region + ".amazonaws.com"
+	segments := strings.Split(joinKey(w.prefix, key), "/")
+	if w.endpoint != "" {
+		base = w.endpoint
+		segments = append([]string{w.bucket}, segments...)
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		escaped[i] = awsEscape(s)
+	}
+	u.Path = "/" + strings.Join(segments, "/")
+	u.RawPath = "/" + strings.Join(escaped, "/")
+	return u, nil
+}
+
+func (w *s3Writer) put(ctx context.Context, key string, body []byte, contentType string) error {
+	u, err := w.objectURL(key)
+	if err != nil {
+		return fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	creds, err := awsCreds.get(ctx, w.region)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build S3 request: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	signSigV4(req, body, creds.AccessKeyID, creds.SecretAccessKey, w.region, "s3", w.now())
+	return sendObject(ctx, "s3 PutObject", req)
+}
+
+// gcsWriter writes objects into a Cloud Storage bucket with a simple media upload.
+type gcsWriter struct {
+	bucket, prefix string
+	endpoint       string // STORAGE_EMULATOR_HOST, empty for Google
+}
+
+func newGCSWriter(bucket, prefix string) *gcsWriter {
+	return &gcsWriter{bucket: bucket, prefix: strings.Trim(prefix, "/"), endpoint: strings.TrimRight(os.Getenv("STORAGE_EMULATOR_HOST"), "/")}
+}
+
+func (w *gcsWriter) location(key string) string {
+	return "gs://" + w.bucket + "/" + joinKey(w.prefix, key)
+}
+
+func (w *gcsWriter) put(ctx context.Context, key string, body []byte, contentType string) error {
+	base := "https://storage.googleapis.com"
+	if w.endpoint != "" {
+		base = w.endpoint
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+	}
+	u := base + "/upload/storage/v1/b/" + url.PathEscape(w.bucket) + "/o?uploadType=media&name=" + url.QueryEscape(joinKey(w.prefix, key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build GCS request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if w.endpoint == "" {
+		token, err := gcpTokens.get(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return sendObject(ctx, "gcs upload", req)
+}
+
+// sendObject sends an upload request with tracing and backend metrics, failing on any
+// non-2xx status.
+func sendObject(ctx context.Context, what string, req *http.Request) error {
+	ctx, span := startSpan(ctx, req.Method+" "+what, spanKindClient)
+	span.SetAttr("url.full", req.URL.String())
+	defer span.End()
+	req = req.WithContext(ctx)
+	injectTraceparent(ctx, req)
+
+	started := time.Now()
+	resp, err := backendClient.Do(req)
+	if err == nil {
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			err = fmt.Errorf("%s error %d: %s", what, resp.StatusCode, truncateBody(raw))
+		}
+	} else {
+		err = fmt.Errorf("failed to call %s: %w", what, err)
+	}
+	observeBackend(what, time.Since(started), err)
+	span.SetError(err)
+	return err
+}
@@ -1,139 +1,245 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
+
+	"costtypes"
 )
 
 // ===== Structs =====
 
-type CloudCost struct {
-	Name      string  `json:"name"`
-	CPUCost   float64 `json:"cpuCost"`
-	GPUCost   float64 `json:"gpuCost"`
-	TotalCost float64 `json:"totalCost"`
-}
+// The record types are shared with the CLI and the mock backend.
+type (
+	CloudCost  = costtypes.CloudCost
+	Allocation = costtypes.Allocation
+	Asset      = costtypes.Asset
+)
 
-type Allocation struct {
-	Namespace  string  `json:"namespace"`
-	ResourceID string  `json:"resource_id"`
-	CPUCost    float64 `json:"cpu_cost"`
-	MemoryCost float64 `json:"memory_cost"`
-	GPUCost    float64 `json:"gpu_cost"`
-	TotalCost  float64 `json:"total_cost"`
-	StartTime  string  `json:"start_time"`
-	EndTime    string  `json:"end_time"`
+// ===== Downstream HTTP =====
+
+// backendCache holds raw backend response bodies for a short TTL. It is disabled unless
+// BACKEND_CACHE_TTL is set, since stale cost data is worse than a slow answer by default.
+// Entries are keyed by tenant as well as URL, so one tenant's reads never answer another's,
+// and together hold at most BACKEND_CACHE_MAX_BYTES of bodies: storing into a full cache
+// drops expired entries first, then the oldest.
+var backendCache = struct {
+	sync.Mutex
+	ttl     time.Duration
+	size    int // bytes of body held
+	entries map[string]cachedBody
+}{entries: map[string]cachedBody{}}
+
+type cachedBody struct {
+	body    []byte
+	stored  time.Time
+	expires time.Time
 }
 
-type Asset struct {
-	AssetID  string  `json:"asset_id"`
-	Name     string  `json:"name"`
-	Type     string  `json:"type"`
-	Status   string  `json:"status"`
-	Provider string  `json:"provider"`
-	Region   string  `json:"region"`
-	Cost     float64 `json:"cost"`
+// setBackendCacheTTL enables the backend response cache; zero disables it.
+func setBackendCacheTTL(ttl time.Duration) {
+	backendCache.Lock()
+	defer backendCache.Unlock()
+	backendCache.ttl = ttl
+	backendCache.entries, backendCache.size = map[string]cachedBody{}, 0
 }
 
-// ===== Filter-enabled fetch functions =====
+// backendCacheKey is the cache key of url for the tenant of ctx.
+func backendCacheKey(ctx context.Context, url string) string {
+	return tenantName(ctx) + " " + url
+}
 
-// CloudCosts: optional "namespace" filter (we treat matching by VM/pod name for now)
-func getCloudCostsWithFilters(namespace string) ([]CloudCost, string, error) {
-	baseURL := "http://localhost:9005/cloudCosts"
-	params := []string{}
-	if namespace != "" {
-		params = append(params, "namespace="+url.QueryEscape(namespace))
+// cachedResponse returns a fresh cached body for url and when it was fetched, if caching is
+// enabled and the tenant of ctx stored one.
+func cachedResponse(ctx context.Context, url string) ([]byte, time.Time, bool) {
+	backendCache.Lock()
+	defer backendCache.Unlock()
+	if backendCache.ttl <= 0 {
+		return nil, time.Time{}, false
 	}
-	if len(params) > 0 {
-		baseURL += "?" + strings.Join(params, "&")
+	key := backendCacheKey(ctx, url)
+	e, ok := backendCache.entries[key]
+	if ok && time.Now().Before(e.expires) {
+		observeCache(true)
+		return e.body, e.stored, true
 	}
+	if ok {
+		dropCachedLocked(key)
+	}
+	observeCache(false)
+	return nil, time.Time{}, false
+}
 
-	log.Printf("[MCP Client] Fetching URL: %s\n", baseURL)
+// backendCacheEnabled reports whether BACKEND_CACHE_TTL is set.
+func backendCacheEnabled() bool {
+	backendCache.Lock()
+	defer backendCache.Unlock()
+	return backendCache.ttl > 0
+}
 
-	resp, err := http.Get(baseURL)
-	if err != nil {
-		return nil, baseURL, fmt.Errorf("failed to fetch cloud costs: %w", err)
+// storeResponse caches body as the response to url for the tenant of ctx, making room if
+// the cache is full. Bodies larger than the whole cache aren't kept.
+func storeResponse(ctx context.Context, url string, body []byte) {
+	backendCache.Lock()
+	defer backendCache.Unlock()
+	if backendCache.ttl <= 0 || len(body) > backendCacheMaxBytes {
+		return
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, baseURL, fmt.Errorf("error %d: %s", resp.StatusCode, string(body))
+	key := backendCacheKey(ctx, url)
+	dropCachedLocked(key)
+	now := time.Now()
+	if backendCache.size+len(body) > backendCacheMaxBytes {
+		for k, e := range backendCache.entries {
+			if !now.Before(e.expires) {
+				dropCachedLocked(k)
+			}
+		}
+	}
+	for backendCache.size+len(body) > backendCacheMaxBytes {
+		oldest := ""
+		for k, e := range backendCache.entries {
+			if oldest == "" || e.stored.Before(backendCache.entries[oldest].stored) {
+				oldest = k
+			}
+		}
+		dropCachedLocked(oldest)
 	}
+	backendCache.entries[key] = cachedBody{body: body, stored: now, expires: now.Add(backendCache.ttl)}
+	backendCache.size += len(body)
+}
 
-	var data []CloudCost
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	return data, baseURL, err
+// dropCachedLocked removes the entry for key, if any. Callers hold backendCache.
+func dropCachedLocked(key string) {
+	if e, ok := backendCache.entries[key]; ok {
+		backendCache.size -= len(e.body)
+		delete(backendCache.entries, key)
+	}
 }
 
-// Allocations: filters for namespace, start, end
-func getAllocationsWithFilters(namespace, start, end string) ([]Allocation, string, error) {
-	baseURL := "http://localhost:9005/allocations"
-	params := []string{}
-	if namespace != "" {
-		params = append(params, "namespace="+url.QueryEscape(namespace))
+// fetchJSON GETs url and decodes the JSON body into out. The caller's request ID is
+// forwarded as X-Request-ID so backend logs can be correlated with ours.
+func fetchJSON(ctx context.Context, url, what string, out interface{}) error {
+	if body, stored, ok := cachedResponse(ctx, url); ok {
+		logf(ctx, "[MCP Client] Cache hit: %s\n", url)
+		err := json.Unmarshal(body, out)
+		explainBackendCall(ctx, what, url, true, 0, -1, err)
+		noteFreshness(ctx, "cache", what, stored)
+		return err
 	}
-	if start != "" {
-		params = append(params, "start="+url.QueryEscape(start))
+	if plannedBackendCall(ctx, what, http.MethodGet, url) {
+		return nil
 	}
-	if end != "" {
-		params = append(params, "end="+url.QueryEscape(end))
+	logf(ctx, "[MCP Client] Fetching URL: %s\n", url)
+
+	ctx, span := startSpan(ctx, "GET "+what, spanKindClient)
+	span.SetAttr("url.full", url)
+	started := time.Now()
+	body, err := doFetch(ctx, url, what)
+	observeBackend(what, time.Since(started), err)
+	explainBackendCall(ctx, what, url, false, time.Since(started), -1, err)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return err
 	}
-	if len(params) > 0 {
-		baseURL += "?" + strings.Join(params, "&")
+	if err := json.Unmarshal(body, out); err != nil {
+		return err
 	}
+	noteFreshness(ctx, "backend", what, time.Now())
+	storeResponse(ctx, url, body)
+	return nil
+}
 
-	log.Printf("[MCP Client] Fetching URL: %s\n", baseURL)
-
-	resp, err := http.Get(baseURL)
+// doFetch performs the GET and returns the body of a 200 response.
+func doFetch(ctx context.Context, url, what string) ([]byte, error) {
+	resp, err := openFetch(ctx, url, what)
 	if err != nil {
-		return nil, baseURL, fmt.Errorf("failed to fetch allocations: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", what, err)
+	}
+	return body, nil
+}
+
+// openFetch performs the GET and returns a 200 response, whose body the caller reads and
+// closes. Any other status is returned as an error carrying the body.
+func openFetch(ctx context.Context, url, what string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build %s request: %w", what, err)
+	}
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
+	}
+	injectTraceparent(ctx, req)
 
+	resp, err := backendClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", what, err)
+	}
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, baseURL, fmt.Errorf("error %d: %s", resp.StatusCode, string(body))
+		defer resp.Body.Close()
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s response: %w", what, err)
+		}
+		return nil, fmt.Errorf("error %d: %s", resp.StatusCode, string(body))
 	}
+	return resp, nil
+}
+
+// ===== OpenCost HTTP source =====
+
+// HTTPSource is the CostSource backed by the OpenCost-style HTTP API at BaseURL.
+type HTTPSource struct {
+	BaseURL string
 
-	var data []Allocation
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	return data, baseURL, err
+	// Resolve, if set, picks the base URL for each request instead of BaseURL; see
+	// k8s_discovery.go.
+	Resolve func() string
 }
 
-// Assets: filters for provider and region
-func getAssetsWithFilters(provider, region string) ([]Asset, string, error) {
-	baseURL := "http://localhost:9005/assets"
-	params := []string{}
-	if provider != "" {
-		params = append(params, "provider="+url.QueryEscape(provider))
+// endpoint builds the base URL+path with the non-empty params as a query string.
+func (s *HTTPSource) endpoint(path string, kv ...string) string {
+	base := s.BaseURL
+	if s.Resolve != nil {
+		base = s.Resolve()
 	}
-	if region != "" {
-		params = append(params, "region="+url.QueryEscape(region))
+	u := strings.TrimSuffix(base, "/") + path
+	params := []string{}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			params = append(params, kv[i]+"="+url.QueryEscape(kv[i+1]))
+		}
 	}
 	if len(params) > 0 {
-		baseURL += "?" + strings.Join(params, "&")
+		u += "?" + strings.Join(params, "&")
 	}
+	return u
+}
 
-	log.Printf("[MCP Client] Fetching URL: %s\n", baseURL)
-
-	resp, err := http.Get(baseURL)
-	if err != nil {
-		return nil, baseURL, fmt.Errorf("failed to fetch assets: %w", err)
-	}
-	defer resp.Body.Close()
+func (s *HTTPSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	return fetchRecords(ctx, s.endpoint("/cloudCosts", "namespace", f.Namespace), "cloud costs", f.matches)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, baseURL, fmt.Errorf("error %d: %s", resp.StatusCode, string(body))
+func (s *HTTPSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	if chunks := fetchChunks(f.Start, f.End); chunks != nil {
+		return s.getAllocationsChunked(ctx, f, chunks)
 	}
+	u := s.endpoint("/allocations", "namespace", f.Namespace, "start", f.Start, "end", f.End)
+	return fetchRecords(ctx, u, "allocations", f.matcher())
+}
 
-	var data []Asset
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	return data, baseURL, err
+func (s *HTTPSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	return fetchRecords(ctx, s.endpoint("/assets", "provider", f.Provider, "region", f.Region), "assets", f.matches)
 }
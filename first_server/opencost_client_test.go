@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Cached bodies are only served to the tenant that stored them, and a full cache makes room
+// by dropping its oldest entry.
+func TestBackendCache(t *testing.T) {
+	savedMax := backendCacheMaxBytes
+	t.Cleanup(func() {
+		backendCacheMaxBytes = savedMax
+		setBackendCacheTTL(0)
+	})
+	backendCacheMaxBytes = 10
+	setBackendCacheTTL(time.Minute)
+
+	alpha := context.WithValue(context.Background(), tenantKey{}, &Tenant{Name: "alpha"})
+	beta := context.WithValue(context.Background(), tenantKey{}, &Tenant{Name: "beta"})
+	storeResponse(alpha, "http://backend/a", []byte("alpha"))
+	if body, _, ok := cachedResponse(alpha, "http://backend/a"); !ok || string(body) != "alpha" {
+		t.Errorf("alpha got %q, %v; want its own body", body, ok)
+	}
+	if body, _, ok := cachedResponse(beta, "http://backend/a"); ok {
+		t.Errorf("beta got alpha's body %q", body)
+	}
+
+	time.Sleep(time.Millisecond) // stored times must differ for "oldest" to mean anything
+	storeResponse(beta, "http://backend/b", []byte("beta"))
+	storeResponse(beta, "http://backend/c", []byte("gamma")) // 14 bytes held without evicting
+	if _, _, ok := cachedResponse(alpha, "http://backend/a"); ok {
+		t.Error("oldest entry survived a full cache")
+	}
+	for _, url := range []string{"http://backend/b", "http://backend/c"} {
+		if _, _, ok := cachedResponse(beta, url); !ok {
+			t.Errorf("%s was evicted", url)
+		}
+	}
+	if backendCache.size > backendCacheMaxBytes {
+		t.Errorf("cache holds %d bytes, bound is %d", backendCache.size, backendCacheMaxBytes)
+	}
+
+	storeResponse(beta, "http://backend/big", []byte("larger than the cache"))
+	if _, _, ok := cachedResponse(beta, "http://backend/big"); ok {
+		t.Error("body larger than the whole cache was kept")
+	}
+
+	setBackendCacheTTL(0)
+	storeResponse(alpha, "http://backend/a", []byte("alpha"))
+	if _, _, ok := cachedResponse(alpha, "http://backend/a"); ok {
+		t.Error("cache answered with BACKEND_CACHE_TTL unset")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// ===== Overview =====
+//
+// GET /overview answers "what are we spending?" in one call: it runs /allocations,
+// /cloudCosts and /assets concurrently and returns one section per endpoint with its record
+// count, total cost and summary. namespace, start, end, window and timezone narrow the
+// allocations (namespace also the cloud costs); provider and region narrow the assets.
+//
+// The sections overlap: cluster nodes are both assets and cloud cost, and allocations
+// spread that same spend over namespaces. So there is no grand total; meta.total_cost
+// gives each section's total by endpoint.
+//
+// A failing endpoint doesn't fail the overview: its section is marked failed and the others
+// are returned with 207 (see partial.go). Only when all three fail is the answer an error.
+
+// overviewEndpoints are the endpoints an overview combines, in response order.
+var overviewEndpoints = []string{"allocations", "cloudCosts", "assets"}
+
+// OverviewSection is one endpoint's part of an overview.
+type OverviewSection struct {
+	Endpoint   string          `json:"endpoint"`
+	Status     string          `json:"status"` // ok, partial (the endpoint answered 207) or failed
+	HTTPStatus int             `json:"http_status"`
+	Count      int             `json:"count"`
+	TotalCost  float64         `json:"total_cost"`
+	Summary    string          `json:"summary,omitempty"`
+	Error      json.RawMessage `json:"error,omitempty"` // the endpoint's error object
+}
+
+// overviewHandler handles GET /overview.
+func overviewHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, end := q.Get("start"), q.Get("end")
+	var verrs ValidationErrors
+	loc := loadTimezone(&verrs, "timezone", q.Get("timezone"))
+	window := applyWindow(&verrs, q.Get("window"), "", &start, &end, time.Now(), loc)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	queries := map[string]AgenticQuery{
+		"allocations": {Filters: QueryFilters{Namespace: q.Get("namespace"), Start: start, End: end}},
+		"cloudCosts":  {Filters: QueryFilters{Namespace: q.Get("namespace")}},
+		"assets":      {Filters: QueryFilters{Provider: q.Get("provider"), Region: q.Get("region")}},
+	}
+	sections := make([]OverviewSection, len(overviewEndpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range overviewEndpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			aq := queries[endpoint]
+			aq.Summarize = SummarizeOn
+			rec := httptest.NewRecorder()
+			executeQuery(r.Context(), rec, endpoint, aq)
+			sections[i] = overviewSection(endpoint, rec)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, s := range sections {
+		status := SourceStatus{Source: "/" + s.Endpoint, Data: s.Endpoint, Status: s.Status, Records: s.Count}
+		switch s.Status {
+		case sourceFailed:
+			failed++
+			apiErr := APIError{Message: http.StatusText(s.HTTPStatus)}
+			json.Unmarshal(s.Error, &apiErr)
+			status.Error = apiErr.Message
+			addWarning(r.Context(), "partial_failure", "", "the overview is missing %s: %s", s.Endpoint, apiErr.Message)
+		case sourcePartial:
+			addWarning(r.Context(), "partial_failure", "", "%s answered without some of its sources; query it directly for details", s.Endpoint)
+		}
+		recordSourceStatus(r.Context(), status)
+	}
+	logf(r.Context(), "[MCP] /overview — %d of %d sections failed\n", failed, len(sections))
+	if failed == len(sections) {
+		writeError(w, r, http.StatusBadGateway, ErrCodeBackend, "every section of the overview failed",
+			map[string]interface{}{"sections": sections})
+		return
+	}
+
+	totals := map[string]float64{}
+	for _, s := range sections {
+		if s.Status != sourceFailed {
+			totals[s.Endpoint] = s.TotalCost
+		}
+	}
+	meta := map[string]interface{}{
+		"total":      len(sections),
+		"failed":     failed,
+		"total_cost": totals,
+		"request_id": requestIDFrom(r.Context()),
+	}
+	if window != nil {
+		meta["window"] = window
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": sections, "meta": meta})
+}
+
+// overviewSection reads one endpoint's recorded response into a section.
+func overviewSection(endpoint string, rec *httptest.ResponseRecorder) OverviewSection {
+	s := OverviewSection{Endpoint: endpoint, Status: sourceOK, HTTPStatus: rec.Code}
+	var resp struct {
+		Data    json.RawMessage `json:"data"`
+		Summary string          `json:"summary"`
+		Error   json.RawMessage `json:"error"`
+		Meta    struct {
+			Total *int `json:"total"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code >= 300 {
+		s.Status, s.Error = sourceFailed, resp.Error
+		return s
+	}
+	s.Summary = resp.Summary
+	if rec.Code == http.StatusMultiStatus {
+		s.Status = sourcePartial
+	}
+	var records []struct {
+		TotalCost *float64 `json:"totalCost"`
+		Total     *float64 `json:"total_cost"`
+		Cost      *float64 `json:"cost"`
+	}
+	json.Unmarshal(resp.Data, &records)
+	for _, rec := range records {
+		for _, c := range []*float64{rec.TotalCost, rec.Total, rec.Cost} {
+			if c != nil {
+				s.TotalCost += *c
+				break
+			}
+		}
+	}
+	s.Count = len(records)
+	if resp.Meta.Total != nil {
+		s.Count = *resp.Meta.Total
+	}
+	s.TotalCost = round2(s.TotalCost)
+	return s
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+)
+
+// ===== Parquet writer =====
+//
+// writeParquet encodes allocations as a Parquet file readable by Spark, DuckDB, Athena,
+// pandas and the like. It is the smallest subset of the format that covers a flat table: one
+// row group, one uncompressed PLAIN data page per column, every column required. Strings are
+// UTF8 byte arrays, costs and usage are doubles, and labels are a JSON string column. The
+// footer metadata is Thrift compact protocol, written by hand like the rest of the server's
+// wire formats so the build stays dependency-free.
+
+// Parquet and Thrift constants used by the writer.
+const (
+	parquetDouble    = 5 // Type.DOUBLE
+	parquetByteArray = 6 // Type.BYTE_ARRAY
+	parquetRequired  = 0 // FieldRepetitionType.REQUIRED
+	parquetUTF8      = 0 // ConvertedType.UTF8
+	parquetJSON      = 19
+	parquetPlain     = 0 // Encoding.PLAIN
+	parquetRLE       = 3 // Encoding.RLE
+
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// parquetColumn is one column of the allocation table.
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 for none
+	str       func(a Allocation) string
+	num       func(a Allocation) float64
+}
+
+// parquetColumns is the exported allocation schema, in column order.
+var parquetColumns = []parquetColumn{
+	{name: "namespace", typ: parquetByteArray, converted: parquetUTF8, str: func(a Allocation) string { return a.Namespace }},
+	{name: "resource_id", typ: parquetByteArray, converted: parquetUTF8, str: func(a Allocation) string { return a.ResourceID }},
+	{name: "start_time", typ: parquetByteArray, converted: parquetUTF8, str: func(a Allocation) string { return a.StartTime }},
+	{name: "end_time", typ: parquetByteArray, converted: parquetUTF8, str: func(a Allocation) string { return a.EndTime }},
+	{name: "cpu_cost", typ: parquetDouble, converted: -1, num: func(a Allocation) float64 { return a.CPUCost }},
+	{name: "memory_cost", typ: parquetDouble, converted: -1, num: func(a Allocation) float64 { return a.MemoryCost }},
+	{name: "gpu_cost", typ: parquetDouble, converted: -1, num: func(a Allocation) float64 { return a.GPUCost }},
+	{name: "network_cost", typ: parquetDouble, converted: -1, num: func(a Allocation) float64 { return a.NetworkCost }},
+	{name: "pv_cost", typ: parquetDouble, converted: -1, num: func(a Allocation) float64 { return a.PVCost }},
+	{name: "total_cost", typ: parquetDouble, converted: -1, num: func(a Allocation) float64 { return a.TotalCost }},
+	{name: "cpu_core_hours", typ: parquetDouble, converted: -1, num: func(a Allocation) float64 { return a.CPUCoreHours }},
+	{name: "ram_gb_hours", typ: parquetDouble, converted: -1, num: func(a Allocation) float64 { return a.RAMGBHours }},
+	{name: "gpu_hours", typ: parquetDouble, converted: -1, num: func(a Allocation) float64 { return a.GPUHours }},
+	{name: "labels", typ: parquetByteArray, converted: parquetJSON, str: func(a Allocation) string {
+		if len(a.Labels) == 0 {
+			return "{}"
+		}
+		raw, _ := json.Marshal(a.Labels)
+		return string(raw)
+	}},
+}
+
+// writeParquet writes allocs to w as a single-row-group Parquet file.
+func writeParquet(w io.Writer, allocs []Allocation) error {
+	var file bytes.Buffer
+	file.WriteString("PAR1")
+	chunks := make([]thriftWriter, 0, len(parquetColumns))
+	var groupBytes int64
+	for _, col := range parquetColumns {
+		var page bytes.Buffer
+		for _, a := range allocs {
+			if col.typ == parquetDouble {
+				binary.Write(&page, binary.LittleEndian, math.Float64bits(col.num(a)))
+				continue
+			}
+			s := col.str(a)
+			binary.Write(&page, binary.LittleEndian, uint32(len(s)))
+			page.WriteString(s)
+		}
+
+		var header thriftWriter
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(page.Len()))
+		header.beginStruct(5) // DataPageHeader
+		header.i32(1, int32(len(allocs)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.endStruct()
+		header.stop()
+
+		offset := int64(file.Len())
+		size := int64(header.buf.Len() + page.Len())
+		file.Write(header.buf.Bytes())
+		file.Write(page.Bytes())
+		groupBytes += size
+
+		var chunk thriftWriter // ColumnChunk
+		chunk.i64(2, offset)
+		chunk.beginStruct(3) // ColumnMetaData
+		chunk.i32(1, col.typ)
+		chunk.listI32(2, []int32{parquetPlain, parquetRLE})
+		chunk.listString(3, []string{col.name})
+		chunk.i32(4, 0) // UNCOMPRESSED
+		chunk.i64(5, int64(len(allocs)))
+		chunk.i64(6, size)
+		chunk.i64(7, size)
+		chunk.i64(9, offset)
+		chunk.endStruct()
+		chunk.stop()
+		chunks = append(chunks, chunk)
+	}
+
+	var meta thriftWriter // FileMetaData
+	meta.i32(1, 1)
+	meta.beginList(2, thriftStruct, len(parquetColumns)+1)
+	root := thriftWriter{}
+	root.binary(4, "schema")
+	root.i32(5, int32(len(parquetColumns)))
+	root.stop()
+	meta.buf.Write(root.buf.Bytes())
+	for _, col := range parquetColumns {
+		var el thriftWriter
+		el.i32(1, col.typ)
+		el.i32(3, parquetRequired)
+		el.binary(4, col.name)
+		if col.converted >= 0 {
+			el.i32(6, col.converted)
+		}
+		el.stop()
+		meta.buf.Write(el.buf.Bytes())
+	}
+	meta.i64(3, int64(len(allocs)))
+	meta.beginList(4, thriftStruct, 1)
+	var group thriftWriter // RowGroup
+	group.beginList(1, thriftStruct, len(chunks))
+	for _, c := range chunks {
+		group.buf.Write(c.buf.Bytes())
+	}
+	group.i64(2, groupBytes)
+	group.i64(3, int64(len(allocs)))
+	group.stop()
+	meta.buf.Write(group.buf.Bytes())
+	meta.binary(6, "opencost-mcp-server")
+	meta.stop()
+
+	file.Write(meta.buf.Bytes())
+	binary.Write(&file, binary.LittleEndian, uint32(meta.buf.Len()))
+	file.WriteString("PAR1")
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// thriftWriter encodes one struct in the Thrift compact protocol. Field IDs must be written
+// in increasing order; nested structs are written inline between beginStruct and endStruct.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16 // last field ID written, per open struct
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if len(t.last) == 0 {
+		t.last = []int16{0}
+	}
+	prev := t.last[len(t.last)-1]
+	if delta := id - prev; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(uint64(zigzag(int64(id))))
+	}
+	t.last[len(t.last)-1] = id
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	t.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func zigzag(v int64) uint64 { return uint64(v<<1) ^ uint64(v>>63) }
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// beginList writes a list field header; the caller then writes n elements.
+func (t *thriftWriter) beginList(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.varint(uint64(n))
+}
+
+func (t *thriftWriter) listI32(id int16, vs []int32) {
+	t.beginList(id, thriftI32, len(vs))
+	for _, v := range vs {
+		t.varint(zigzag(int64(v)))
+	}
+}
+
+func (t *thriftWriter) listString(id int16, vs []string) {
+	t.beginList(id, thriftBinary, len(vs))
+	for _, v := range vs {
+		t.varint(uint64(len(v)))
+		t.buf.WriteString(v)
+	}
+}
+
+func (t *thriftWriter) beginStruct(id int16) {
+	t.field(id, thriftStruct)
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftWriter) endStruct() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+// stop ends the outermost struct.
+func (t *thriftWriter) stop() { t.buf.WriteByte(0) }
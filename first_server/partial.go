@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+)
+
+// ===== Partial results =====
+//
+// A federated answer (COST_SOURCE listing several providers, or /overview combining three
+// endpoints) is only as available as its least available part. Rather than failing the whole
+// request when one part fails, the rest is returned with 207 Multi-Status and a per-source
+// status array in meta.sources:
+//
+//	{"source": "azure", "data": "cloud_costs", "status": "failed", "records": 0, "error": "..."}
+//
+// status is ok, failed, unsupported for a provider that doesn't carry that kind of data, or
+// partial for an /overview section that was itself answered in part.
+// Each failure is also a partial_failure warning (see warnings.go). Only when every part
+// fails does the request fail, with the usual backend error.
+
+// Source statuses.
+const (
+	sourceOK          = "ok"
+	sourceFailed      = "failed"
+	sourceUnsupported = "unsupported"
+	sourcePartial     = "partial"
+)
+
+// SourceStatus is one entry of meta.sources.
+type SourceStatus struct {
+	Source  string `json:"source"`
+	Data    string `json:"data"`
+	Status  string `json:"status"`
+	Records int    `json:"records"`
+	Error   string `json:"error,omitempty"`
+}
+
+// recordSourceStatus adds s to the request's meta.sources. A source asked twice for the same
+// data (e.g. once for the answer and once for its grand total) is listed once; a failure
+// wins over an earlier success.
+func recordSourceStatus(ctx context.Context, s SourceStatus) {
+	list, _ := ctx.Value(warningsKey{}).(*warningList)
+	if list == nil {
+		return
+	}
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	for i, seen := range list.sources {
+		if seen.Source == s.Source && seen.Data == s.Data {
+			if s.Status == sourceFailed {
+				list.sources[i] = s
+			}
+			return
+		}
+	}
+	list.sources = append(list.sources, s)
+}
+
+// anySourceFailed reports whether any of sources failed, even in part.
+func anySourceFailed(sources []SourceStatus) bool {
+	for _, s := range sources {
+		if s.Status == sourceFailed || s.Status == sourcePartial {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Allocation policies =====
+//
+// An allocation policy says who pays for what: rules match allocations by label or namespace
+// and split their cost between owners by percentage, and allocations no rule matches are
+// split by the untagged split (or charged to "unallocated"). Rules are tried in order and the
+// first match wins. For example:
+//
+//	{
+//	  "rules":    [{"label": "team=payments", "split": {"payments": 100}},
+//	               {"namespace": "data", "split": {"analytics": 60, "ml": 40}}],
+//	  "untagged": {"platform": 50, "finance": 50}
+//	}
+//
+// Admins manage policies through /policies; they are persisted in POLICIES_FILE. /reports
+// groups lines by policy owner with policy=<name>, and /allocations adds meta.policy (and a
+// sentence to summaries) with policy=<name>. Allocation records themselves are unchanged.
+
+// unallocatedOwner is charged for allocations no rule matches when a policy has no untagged
+// split.
+const unallocatedOwner = "unallocated"
+
+// PolicyRule matches allocations by label, namespace or both, and splits their cost.
+type PolicyRule struct {
+	Label     string             `json:"label,omitempty"`     // "key=value", or "key" for any value
+	Namespace string             `json:"namespace,omitempty"` // exact namespace
+	Split     map[string]float64 `json:"split"`               // owner to percent, summing to 100
+}
+
+// AllocationPolicy is a stored policy definition.
+type AllocationPolicy struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Rules       []PolicyRule       `json:"rules"`
+	Untagged    map[string]float64 `json:"untagged,omitempty"` // split for allocations no rule matches
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// matches reports whether alloc satisfies every selector of the rule.
+func (rule PolicyRule) matches(alloc Allocation) bool {
+	if rule.Namespace != "" && rule.Namespace != alloc.Namespace {
+		return false
+	}
+	if rule.Label != "" {
+		key, value, exact := strings.Cut(rule.Label, "=")
+		v, ok := alloc.Labels[key]
+		if !ok || (exact && v != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// shares returns the owners of alloc's cost as fractions summing to 1, and whether a rule
+// matched.
+func (p AllocationPolicy) shares(alloc Allocation) (map[string]float64, bool) {
+	split, matched := p.Untagged, false
+	for _, rule := range p.Rules {
+		if rule.matches(alloc) {
+			split, matched = rule.Split, true
+			break
+		}
+	}
+	if len(split) == 0 {
+		return map[string]float64{unallocatedOwner: 1}, matched
+	}
+	out := make(map[string]float64, len(split))
+	for owner, pct := range split {
+		out[owner] = pct / 100
+	}
+	return out, matched
+}
+
+// validate checks the policy's name, rules and splits.
+func (p AllocationPolicy) validate(verrs *ValidationErrors) {
+	if !queryNamePattern.MatchString(p.Name) {
+		verrs.add("name", p.Name, "must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if len(p.Rules) == 0 && len(p.Untagged) == 0 {
+		verrs.add("rules", "", "at least one rule or an untagged split is required")
+	}
+	for i, rule := range p.Rules {
+		field := fmt.Sprintf("rules[%d]", i)
+		if rule.Label == "" && rule.Namespace == "" {
+			verrs.add(field, "", "needs a label or namespace selector")
+		}
+		if key, _, _ := strings.Cut(rule.Label, "="); rule.Label != "" && strings.TrimSpace(key) == "" {
+			verrs.add(field+".label", rule.Label, "must be key=value or key")
+		}
+		validateSplit(verrs, field+".split", rule.Split, true)
+	}
+	validateSplit(verrs, "untagged", p.Untagged, false)
+}
+
+// validateSplit checks that split's percentages are positive and sum to 100.
+func validateSplit(verrs *ValidationErrors, field string, split map[string]float64, required bool) {
+	if len(split) == 0 {
+		if required {
+			verrs.add(field, "", "is required")
+		}
+		return
+	}
+	sum := 0.0
+	for owner, pct := range split {
+		if strings.TrimSpace(owner) == "" {
+			verrs.add(field, owner, "owner names must not be empty")
+		}
+		if pct <= 0 {
+			verrs.add(field+"."+owner, fmt.Sprint(pct), "must be a positive percentage")
+		}
+		sum += pct
+	}
+	if math.Abs(sum-100) > 0.01 {
+		verrs.add(field, fmt.Sprint(round2(sum)), "percentages must sum to 100")
+	}
+}
+
+// PolicyOwner is the cost one owner carries under a policy.
+type PolicyOwner struct {
+	Owner       string  `json:"owner"`
+	Cost        float64 `json:"cost"`
+	SharePct    float64 `json:"share_pct"`
+	Allocations int     `json:"allocations"` // allocations with any share charged to the owner
+}
+
+// PolicyResult is a policy applied to a set of allocations: meta.policy on /allocations.
+type PolicyResult struct {
+	Policy    string        `json:"policy"`
+	TotalCost float64       `json:"total_cost"`
+	Matched   int           `json:"matched"`  // allocations a rule matched
+	Untagged  int           `json:"untagged"` // allocations split by the untagged split
+	Owners    []PolicyOwner `json:"owners"`   // largest cost first
+}
+
+// apply splits the cost of allocs between the policy's owners.
+func (p AllocationPolicy) apply(allocs []Allocation) PolicyResult {
+	result := PolicyResult{Policy: p.Name, Owners: []PolicyOwner{}}
+	owners := map[string]*PolicyOwner{}
+	for _, a := range allocs {
+		shares, matched := p.shares(a)
+		if matched {
+			result.Matched++
+		} else {
+			result.Untagged++
+		}
+		result.TotalCost += a.TotalCost
+		for owner, frac := range shares {
+			o, ok := owners[owner]
+			if !ok {
+				o = &PolicyOwner{Owner: owner}
+				owners[owner] = o
+			}
+			o.Cost += a.TotalCost * frac
+			o.Allocations++
+		}
+	}
+	for _, o := range owners {
+		if result.TotalCost > 0 {
+			o.SharePct = round2(o.Cost / result.TotalCost * 100)
+		}
+		o.Cost = round2(o.Cost)
+		result.Owners = append(result.Owners, *o)
+	}
+	sort.Slice(result.Owners, func(i, j int) bool {
+		if result.Owners[i].Cost != result.Owners[j].Cost {
+			return result.Owners[i].Cost > result.Owners[j].Cost
+		}
+		return result.Owners[i].Owner < result.Owners[j].Owner
+	})
+	result.TotalCost = round2(result.TotalCost)
+	return result
+}
+
+// summarizePolicy is the summary sentence for a policy result.
+func summarizePolicy(result PolicyResult) string {
+	totals := make(map[string]float64, len(result.Owners))
+	for _, o := range result.Owners {
+		totals[o.Owner] = o.Cost
+	}
+	return fmt.Sprintf(" Under policy %s: %s.", result.Policy, topShares(totals, result.TotalCost))
+}
+
+// lookupPolicy resolves a policy parameter, reporting an unknown name as a validation error.
+func lookupPolicy(verrs *ValidationErrors, field, name string) *AllocationPolicy {
+	if name == "" {
+		return nil
+	}
+	p, ok := policies.get(name)
+	if !ok {
+		verrs.add(field, name, "no such policy")
+		return nil
+	}
+	return &p
+}
+
+// policyStore keeps policies in memory and persists them as JSON after every change.
+type policyStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]*AllocationPolicy
+}
+
+var policies = &policyStore{items: map[string]*AllocationPolicy{}}
+
+// load reads persisted policies from path. A missing file starts an empty store.
+func (s *policyStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read policies: %w", err)
+	}
+	var list []*AllocationPolicy
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return fmt.Errorf("failed to parse policies %s: %w", path, err)
+	}
+	for _, p := range list {
+		s.items[p.Name] = p
+	}
+	return nil
+}
+
+// saveLocked writes all policies to disk via a temp file and rename. Callers hold s.mu.
+func (s *policyStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *policyStore) listLocked() []AllocationPolicy {
+	list := make([]AllocationPolicy, 0, len(s.items))
+	for _, p := range s.items {
+		list = append(list, *p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (s *policyStore) list() []AllocationPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listLocked()
+}
+
+func (s *policyStore) get(name string) (AllocationPolicy, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.items[name]
+	if !ok {
+		return AllocationPolicy{}, false
+	}
+	return *p, true
+}
+
+// put stores p, keeping the creation time of an existing policy with the same name. It
+// reports whether the policy was newly created.
+func (s *policyStore) put(p AllocationPolicy) (AllocationPolicy, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	p.CreatedAt, p.UpdatedAt = now, now
+	existing, found := s.items[p.Name]
+	if found {
+		p.CreatedAt = existing.CreatedAt
+	}
+	s.items[p.Name] = &p
+	return p, !found, s.saveLocked()
+}
+
+func (s *policyStore) delete(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[name]; !ok {
+		return false, nil
+	}
+	delete(s.items, name)
+	return true, s.saveLocked()
+}
+
+// ===== /policies API =====
+
+// listPoliciesHandler handles GET /policies.
+func listPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	list := policies.list()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": list,
+		"meta": map[string]interface{}{"total": len(list), "request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// getPolicyHandler handles GET /policies/{name}.
+func getPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := policies.get(r.PathValue("name"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such policy: "+r.PathValue("name"), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": p})
+}
+
+// putPolicyHandler handles PUT /policies/{name}, creating or replacing the policy.
+func putPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	var p AllocationPolicy
+	if !decodeJSON(w, r, &p) {
+		return
+	}
+	p.Name = r.PathValue("name")
+
+	var verrs ValidationErrors
+	p.validate(&verrs)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	saved, created, err := policies.put(p)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to persist policy", err.Error())
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		logf(r.Context(), "[MCP] Saved policy %s (%d rules)\n", saved.Name, len(saved.Rules))
+	}
+	writeJSON(w, status, map[string]interface{}{"data": saved})
+}
+
+// deletePolicyHandler handles DELETE /policies/{name}.
+func deletePolicyHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := policies.delete(r.PathValue("name"))
+	if !found {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such policy: "+r.PathValue("name"), nil)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to persist policies", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ===== Downstream connection pool =====
+//
+// Backend calls (OpenCost, Prometheus, the cloud billing APIs) share backendClient, and
+// webhooks, Slack and trace exports share outboundClient, so connections are pooled and kept
+// alive rather than dialed per request. The pool is tuned with:
+//
+//	BACKEND_MAX_IDLE_CONNS           idle connections kept across all hosts (default 100)
+//	BACKEND_MAX_IDLE_CONNS_PER_HOST  idle connections kept per host (default 16)
+//	BACKEND_MAX_CONNS_PER_HOST       connections per host, idle or busy; 0 for no cap (default)
+//	BACKEND_IDLE_CONN_TIMEOUT        how long an idle connection is kept (default 90s)
+//	BACKEND_KEEPALIVE                TCP keep-alive period (default 30s); 0 closes every
+//	                                 connection after one request
+//	BACKEND_HTTP2                    false to stay on HTTP/1.1 with TLS backends (default true)
+//
+// Long allocation windows can be fetched from the OpenCost API as parallel chunks:
+//
+//	BACKEND_FETCH_CHUNK        split windows longer than this, e.g. 24h or 7d (default off)
+//	BACKEND_FETCH_CONCURRENCY  chunks in flight at once per request (default 4)
+//
+// Each chunk is its own backend request, and is cached on its own with BACKEND_CACHE_TTL.
+
+// poolConfig is the downstream connection and fetch tuning.
+type poolConfig struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	KeepAlive           time.Duration
+	HTTP2               bool
+
+	FetchChunk       time.Duration
+	FetchConcurrency int
+}
+
+var backendPool = poolConfig{
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 16,
+	IdleConnTimeout:     90 * time.Second,
+	KeepAlive:           30 * time.Second,
+	HTTP2:               true,
+	FetchConcurrency:    4,
+}
+
+// outboundClient is the HTTP client for notifications and trace exports. Callers bound each
+// request with a context deadline.
+var outboundClient = &http.Client{Transport: http.DefaultTransport}
+
+// configureBackendPool applies the BACKEND_* pool variables and rebuilds backendClient and
+// outboundClient. It runs before configureBackendTLS, which adds TLS to a transport built the
+// same way.
+func configureBackendPool() error {
+	ints := []struct {
+		name string
+		dst  *int
+		min  int
+	}{
+		{"BACKEND_MAX_IDLE_CONNS", &backendPool.MaxIdleConns, 0},
+		{"BACKEND_MAX_IDLE_CONNS_PER_HOST", &backendPool.MaxIdleConnsPerHost, 0},
+		{"BACKEND_MAX_CONNS_PER_HOST", &backendPool.MaxConnsPerHost, 0},
+		{"BACKEND_FETCH_CONCURRENCY", &backendPool.FetchConcurrency, 1},
+	}
+	for _, v := range ints {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < v.min {
+			return fmt.Errorf("%s must be an integer of at least %d, got %q", v.name, v.min, raw)
+		}
+		*v.dst = n
+	}
+	durations := []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"BACKEND_IDLE_CONN_TIMEOUT", &backendPool.IdleConnTimeout},
+		{"BACKEND_KEEPALIVE", &backendPool.KeepAlive},
+	}
+	for _, v := range durations {
+		raw := os.Getenv(v.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return fmt.Errorf("%s must be a duration such as 30s, got %q", v.name, raw)
+		}
+		*v.dst = d
+	}
+	switch v := os.Getenv("BACKEND_HTTP2"); v {
+	case "", "true":
+	case "false":
+		backendPool.HTTP2 = false
+	default:
+		return fmt.Errorf("BACKEND_HTTP2 must be true or false, got %q", v)
+	}
+	if v := os.Getenv("BACKEND_FETCH_CHUNK"); v != "" {
+		d, err := parseLookback(v)
+		if err != nil {
+			return fmt.Errorf("BACKEND_FETCH_CHUNK must be a duration such as 24h or 7d, got %q", v)
+		}
+		backendPool.FetchChunk = d
+	}
+
+	backendClient = &http.Client{Transport: newBackendTransport(), Timeout: handlerTimeout + 5*time.Second}
+	outboundClient = &http.Client{Transport: newBackendTransport()}
+	return nil
+}
+
+// newBackendTransport builds a transport with the pool settings of backendPool.
+func newBackendTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: backendPool.KeepAlive}
+	if backendPool.KeepAlive == 0 {
+		dialer.KeepAlive = -1
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = dialer.DialContext
+	t.MaxIdleConns = backendPool.MaxIdleConns
+	t.MaxIdleConnsPerHost = backendPool.MaxIdleConnsPerHost
+	t.MaxConnsPerHost = backendPool.MaxConnsPerHost
+	t.IdleConnTimeout = backendPool.IdleConnTimeout
+	t.DisableKeepAlives = backendPool.KeepAlive == 0
+	t.ForceAttemptHTTP2 = backendPool.HTTP2
+	if !backendPool.HTTP2 {
+		// A non-nil, empty TLSNextProto is how net/http is told not to negotiate h2
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// fetchChunks splits [start, end] into BACKEND_FETCH_CHUNK-sized windows, or returns nil
+// when chunking is off, the window is open-ended or it already fits in one chunk.
+func fetchChunks(start, end string) [][2]string {
+	if backendPool.FetchChunk <= 0 || start == "" || end == "" {
+		return nil
+	}
+	s, errStart := time.Parse(time.RFC3339, start)
+	e, errEnd := time.Parse(time.RFC3339, end)
+	if errStart != nil || errEnd != nil || e.Sub(s) <= backendPool.FetchChunk {
+		return nil
+	}
+	var chunks [][2]string
+	for t := s; t.Before(e); t = t.Add(backendPool.FetchChunk) {
+		next := t.Add(backendPool.FetchChunk)
+		if next.After(e) {
+			next = e
+		}
+		chunks = append(chunks, [2]string{t.Format(time.RFC3339), next.Format(time.RFC3339)})
+	}
+	return chunks
+}
+
+// getAllocationsChunked fetches f's window as chunks, at most BACKEND_FETCH_CONCURRENCY at a
+// time. An allocation spanning a chunk boundary comes back from both chunks; it is kept
+// once, while duplicates within one chunk are left to DEDUP_POLICY.
+func (s *HTTPSource) getAllocationsChunked(ctx context.Context, f AllocationFilter, chunks [][2]string) ([]Allocation, error) {
+	logf(ctx, "[MCP Client] Fetching allocations %s to %s in %d chunks of %s\n", f.Start, f.End, len(chunks), backendPool.FetchChunk)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([][]Allocation, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, backendPool.FetchConcurrency)
+	var wg sync.WaitGroup
+	for i, c := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			if ctx.Err() != nil {
+				errs[i] = ctx.Err()
+				return
+			}
+			chunk := AllocationFilter{Namespace: f.Namespace, Start: c[0], End: c[1]}
+			u := s.endpoint("/allocations", "namespace", chunk.Namespace, "start", chunk.Start, "end", chunk.End)
+			if results[i], errs[i] = fetchRecords(ctx, u, "allocations", chunk.matcher()); errs[i] != nil {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	// Report the chunk that failed rather than one canceled because of it
+	failed := -1
+	for i, err := range errs {
+		if err != nil && (failed < 0 || errors.Is(errs[failed], context.Canceled)) {
+			failed = i
+		}
+	}
+	if failed >= 0 {
+		return nil, fmt.Errorf("chunk %s to %s: %w", chunks[failed][0], chunks[failed][1], errs[failed])
+	}
+
+	out := []Allocation{}
+	seenIn := map[AllocationKey]int{}
+	for i, chunk := range results {
+		for _, a := range chunk {
+			key := allocationKeyOf(a)
+			if j, seen := seenIn[key]; seen && j != i {
+				continue
+			}
+			seenIn[key] = i
+			out = append(out, a)
+		}
+	}
+	if backendMaxRecords > 0 && len(out) > backendMaxRecords {
+		return nil, errTooManyRecords("allocations")
+	}
+	return out, nil
+}
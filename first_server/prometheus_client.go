@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ===== Prometheus node metrics =====
+
+// Node-exporter recording rules used for utilization. Both report a 0..1 ratio per instance.
+const (
+	nodeCPUUtilizationMetric    = "instance:node_cpu_utilisation:rate5m"
+	nodeMemoryUtilizationMetric = "instance:node_memory_utilisation:ratio"
+)
+
+// gpuUtilizationMetric is the NVIDIA DCGM exporter's per-GPU utilization, in percent.
+const gpuUtilizationMetric = "DCGM_FI_DEV_GPU_UTIL"
+
+// NodeUtilization holds average CPU and memory utilization (0..1) for one node over a window.
+// HasCPU and HasMemory say whether Prometheus had a series for each; a missing one is unknown,
+// not zero.
+type NodeUtilization struct {
+	Instance  string
+	CPU       float64
+	Memory    float64
+	HasCPU    bool
+	HasMemory bool
+}
+
+// prometheusURL is the Prometheus API base, PROMETHEUS_URL or BACKEND_URL; see network.go.
+var prometheusURL = defaultBackendURL
+
+// promQueryResponse is the subset of the Prometheus /api/v1/query response we use.
+type promQueryResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"` // [unix_ts, "value"]
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// queryPrometheusVector runs an instant query and returns value per "instance" label.
+func queryPrometheusVector(ctx context.Context, query string) (map[string]float64, string, error) {
+	baseURL := prometheusURL + "/api/v1/query?query=" + url.QueryEscape(query)
+
+	var pr promQueryResponse
+	if err := fetchJSON(ctx, baseURL, "prometheus query", &pr); err != nil {
+		return nil, baseURL, err
+	}
+	if pr.Status != "success" {
+		return nil, baseURL, fmt.Errorf("prometheus query failed: %s", pr.Error)
+	}
+
+	values := make(map[string]float64, len(pr.Data.Result))
+	for _, sample := range pr.Data.Result {
+		instance := sample.Metric["instance"]
+		raw, ok := sample.Value[1].(string)
+		if instance == "" || !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			continue
+		}
+		values[instance] = v
+	}
+	return values, baseURL, nil
+}
+
+// getNodeUtilization returns average CPU and memory utilization per node over window
+// (a Prometheus range such as "7d"), keyed by instance.
+func getNodeUtilization(ctx context.Context, window string) (map[string]NodeUtilization, error) {
+	cpu, _, err := queryPrometheusVector(ctx, fmt.Sprintf("avg_over_time(%s[%s])", nodeCPUUtilizationMetric, window))
+	if err != nil {
+		return nil, err
+	}
+	mem, _, err := queryPrometheusVector(ctx, fmt.Sprintf("avg_over_time(%s[%s])", nodeMemoryUtilizationMetric, window))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]NodeUtilization, len(cpu))
+	for instance, v := range cpu {
+		nodes[instance] = NodeUtilization{Instance: instance, CPU: v, HasCPU: true}
+	}
+	for instance, v := range mem {
+		n := nodes[instance]
+		n.Instance, n.Memory, n.HasMemory = instance, v, true
+		nodes[instance] = n
+	}
+	return nodes, nil
+}
+
+// getGPUUtilization returns average GPU utilization (0..1) per node over window, keyed by
+// instance. Nodes with several GPUs report their mean.
+func getGPUUtilization(ctx context.Context, window string) (map[string]float64, error) {
+	values, _, err := queryPrometheusVector(ctx, fmt.Sprintf("avg by (instance) (avg_over_time(%s[%s])) / 100", gpuUtilizationMetric, window))
+	return values, err
+}
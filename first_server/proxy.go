@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ===== OpenCost proxy =====
+//
+// GET /opencost/<path> forwards to <path> on the OpenCost backend, for the OpenCost endpoints
+// this server doesn't model itself (/model/assets/topology, /cloudCost/view, ...), so the CLI,
+// dashboards and the OpenCost UI need only this server's base URL. Only the path prefixes in
+// OPENCOST_PROXY_PATHS are forwarded, e.g. "/model/assets,/cloudCost/view". Requests pass
+// through the same auth, logging, tracing and metrics as every other route, and 200 responses
+// are kept in the backend cache (BACKEND_CACHE_TTL). X-Cache says whether one was served from
+// it. Bodies are passed through untouched, so tenant-scoped callers are refused: a raw
+// OpenCost response can't be narrowed to their namespaces.
+
+// proxyConfig is the forwarding setup; nil when the proxy is disabled.
+type proxyConfig struct {
+	backend  *HTTPSource
+	prefixes []string
+}
+
+var opencostProxy *proxyConfig
+
+// configureProxy reads OPENCOST_PROXY_PATHS. It must run before configureCostSource wraps
+// the HTTP source, so it can reuse the backend URL (or Kubernetes discovery).
+func configureProxy() error {
+	paths := splitList(os.Getenv("OPENCOST_PROXY_PATHS"))
+	if len(paths) == 0 {
+		return nil
+	}
+	backend, ok := costSource.(*HTTPSource)
+	if !ok {
+		return fmt.Errorf("OPENCOST_PROXY_PATHS needs the OpenCost HTTP backend")
+	}
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") || strings.Contains(p, "..") {
+			return fmt.Errorf("OPENCOST_PROXY_PATHS: %q must be an absolute path", p)
+		}
+	}
+	opencostProxy = &proxyConfig{backend: backend, prefixes: paths}
+	log.Printf("[MCP] Proxying OpenCost paths %s under /opencost\n", strings.Join(paths, ", "))
+	return nil
+}
+
+// allows reports whether path is one of the prefixes or below one.
+func (p *proxyConfig) allows(path string) bool {
+	for _, prefix := range p.prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// opencostProxyHandler handles GET /opencost/{path...}.
+func opencostProxyHandler(w http.ResponseWriter, r *http.Request) {
+	if opencostProxy == nil {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "the OpenCost proxy is disabled; set OPENCOST_PROXY_PATHS to enable it", nil)
+		return
+	}
+	path := "/" + r.PathValue("path")
+	if strings.Contains(path, "..") || !opencostProxy.allows(path) {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "path is not proxied: "+path,
+			map[string]interface{}{"proxied_paths": opencostProxy.prefixes})
+		return
+	}
+	if t := tenantFrom(r.Context()); t != nil {
+		writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "tenant "+t.Name+" can't use the OpenCost proxy; its responses aren't scoped to tenants", nil)
+		return
+	}
+	target := opencostProxy.backend.endpoint(path)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+
+	if body, _, ok := cachedResponse(r.Context(), target); ok {
+		logf(r.Context(), "[MCP] /opencost%s: cache hit\n", path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache", "hit")
+		w.Write(body)
+		return
+	}
+	logf(r.Context(), "[MCP] /opencost%s: forwarding to %s\n", path, target)
+
+	ctx, span := startSpan(r.Context(), "GET opencost proxy", spanKindClient)
+	span.SetAttr("url.full", target)
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidFilters, "invalid proxy path: "+err.Error(), nil)
+		return
+	}
+	req.Header.Set(requestIDHeader, requestIDFrom(ctx))
+	if accept := r.Header.Get("Accept"); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	injectTraceparent(ctx, req)
+
+	started := time.Now()
+	resp, err := backendClient.Do(req)
+	var body []byte
+	if err == nil {
+		defer resp.Body.Close()
+		body, err = io.ReadAll(resp.Body)
+	}
+	observeBackend("opencost proxy", time.Since(started), err)
+	span.SetError(err)
+	if err != nil {
+		writeBackendError(w, r, "OpenCost proxy request failed", err)
+		return
+	}
+	if resp.StatusCode == http.StatusOK {
+		storeResponse(r.Context(), target, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("X-Cache", "miss")
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+}
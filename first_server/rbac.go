@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ===== Roles =====
+//
+// Every route needs a role. Viewers read cost data, saved queries, schedules and history;
+// analysts also create and change saved queries, schedules and alert evaluations; admins also
+// manage sessions through /admin/*. A tenant's "role" in TENANTS_FILE sets its keys' role
+// (viewer by default), and ADMIN_TOKEN is always an admin. Without TENANTS_FILE every caller
+// is an analyst, as before roles existed.
+//
+// Routes are registered through handle, which also lists them in the GET /tools manifest so
+// agents see only the tools their role can call.
+
+// role is an access level; each includes the ones below it.
+type role int
+
+const (
+	roleNone role = iota
+	roleViewer
+	roleAnalyst
+	roleAdmin
+)
+
+var roleNames = map[role]string{roleNone: "none", roleViewer: "viewer", roleAnalyst: "analyst", roleAdmin: "admin"}
+
+func (ro role) String() string { return roleNames[ro] }
+
+// parseRole reads a role name; empty means viewer.
+func parseRole(s string) (role, error) {
+	if s == "" {
+		return roleViewer, nil
+	}
+	for ro, name := range roleNames {
+		if ro != roleNone && strings.EqualFold(name, s) {
+			return ro, nil
+		}
+	}
+	return roleNone, fmt.Errorf("unknown role %q; expected viewer, analyst or admin", s)
+}
+
+// callerRole returns the role of the request's bearer token.
+func callerRole(r *http.Request) role {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if adminToken != "" && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+		return roleAdmin
+	}
+	t := tenantFrom(r.Context())
+	if t == nil && token != "" {
+		t = tenantForKey(token) // /admin/* skips withTenants
+	}
+	switch {
+	case t != nil:
+		return t.role
+	case tenants == nil:
+		return roleAnalyst
+	}
+	return roleNone
+}
+
+// requireRole wraps h so it only runs for callers with at least need.
+func requireRole(need role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		have := callerRole(r)
+		if have >= need {
+			h(w, r)
+			return
+		}
+		if need == roleAdmin && adminToken == "" && tenants == nil {
+			writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "admin API is disabled; set ADMIN_TOKEN to enable it", nil)
+			return
+		}
+		// Without tenants only ADMIN_TOKEN grants admin, so a wrong token is an auth failure
+		if have == roleNone || (need == roleAdmin && tenants == nil) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="costs"`)
+			writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "missing or invalid token", nil)
+			return
+		}
+		writeError(w, r, http.StatusForbidden, ErrCodeForbidden, fmt.Sprintf("requires the %s role; caller is %s", need, have), nil)
+	}
+}
+
+// Tool is one entry of the /tools manifest.
+type Tool struct {
+	Name        string `json:"name"`
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	Description string `json:"description"`
+	Role        string `json:"role"`
+
+	need role
+}
+
+// tools lists every route registered through handle, in registration order.
+var tools []Tool
+
+// handle registers h for pattern behind requireRole and adds it to the manifest. A pattern
+// without a method is registered for GET and POST; other methods get 405 rather than falling
+// through to the catch-all 404.
+func handle(pattern string, need role, name, description string, h http.HandlerFunc) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if ok {
+		http.HandleFunc(pattern, requireRole(need, h))
+	} else {
+		method, path = "GET, POST", pattern
+		http.HandleFunc("GET "+path, requireRole(need, h))
+		http.HandleFunc("POST "+path, requireRole(need, h))
+		http.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Use GET or POST", nil)
+		})
+	}
+	tools = append(tools, Tool{Name: name, Method: method, Path: path, Description: description, Role: need.String(), need: need})
+}
+
+// toolsHandler handles GET /tools, listing the tools the caller's role can call.
+func toolsHandler(w http.ResponseWriter, r *http.Request) {
+	have := callerRole(r)
+	allowed := []Tool{}
+	for _, t := range tools {
+		if t.need <= have {
+			allowed = append(allowed, t)
+		}
+	}
+	sort.SliceStable(allowed, func(i, j int) bool { return allowed[i].Path < allowed[j].Path })
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": allowed,
+		"meta": map[string]interface{}{"role": have.String(), "total": len(allowed), "request_id": requestIDFrom(r.Context())},
+	})
+}
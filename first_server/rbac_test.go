@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useAdminToken sets ADMIN_TOKEN for the rest of the test.
+func useAdminToken(t *testing.T, token string) {
+	t.Helper()
+	saved := adminToken
+	t.Cleanup(func() { adminToken = saved })
+	adminToken = token
+}
+
+func TestParseRole(t *testing.T) {
+	tests := []struct {
+		in   string
+		want role
+		err  bool
+	}{
+		{"", roleViewer, false},
+		{"viewer", roleViewer, false},
+		{"Analyst", roleAnalyst, false},
+		{"ADMIN", roleAdmin, false},
+		{"none", roleNone, true},
+		{"owner", roleNone, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRole(tt.in)
+		if got != tt.want || (err != nil) != tt.err {
+			t.Errorf("parseRole(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+// serveWithRole runs a request through withTenants and requireRole(need), returning the
+// status and whether the handler ran.
+func serveWithRole(need role, path, auth string) (int, bool) {
+	ran := false
+	h := withTenants(requireRole(need, func(w http.ResponseWriter, r *http.Request) { ran = true }))
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if auth != "" {
+		r.Header.Set("Authorization", "Bearer "+auth)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, ran
+}
+
+func TestRequireRoleWithTenants(t *testing.T) {
+	useAdminToken(t, "root-token")
+	useTenants(t, []*Tenant{
+		testTenant(t, "viewer", "k-view", roleViewer),
+		testTenant(t, "analyst", "k-analyst", roleAnalyst),
+		testTenant(t, "admin", "k-admin", roleAdmin),
+	})
+	tests := []struct {
+		name   string
+		need   role
+		path   string
+		key    string
+		status int
+	}{
+		{"viewer reads", roleViewer, "/allocations", "k-view", http.StatusOK},
+		{"viewer can't write", roleAnalyst, "/saved-queries", "k-view", http.StatusForbidden},
+		{"analyst writes", roleAnalyst, "/saved-queries", "k-analyst", http.StatusOK},
+		{"analyst can't administer", roleAdmin, "/admin/sessions", "k-analyst", http.StatusForbidden},
+		{"admin tenant administers", roleAdmin, "/admin/sessions", "k-admin", http.StatusOK},
+		{"admin tenant reads", roleViewer, "/allocations", "k-admin", http.StatusOK},
+		{"admin token administers", roleAdmin, "/admin/sessions", "root-token", http.StatusOK},
+		{"no key on admin API", roleAdmin, "/admin/sessions", "", http.StatusUnauthorized},
+		{"unknown key on admin API", roleAdmin, "/admin/sessions", "k-nope", http.StatusUnauthorized},
+		{"no key", roleViewer, "/allocations", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, ran := serveWithRole(tt.need, tt.path, tt.key)
+			if status != tt.status || ran != (tt.status == http.StatusOK) {
+				t.Errorf("status %d, handler ran %v; want %d", status, ran, tt.status)
+			}
+		})
+	}
+}
+
+func TestRequireRoleWithoutTenants(t *testing.T) {
+	useTenants(t, nil)
+	tests := []struct {
+		name   string
+		token  string // ADMIN_TOKEN
+		need   role
+		auth   string
+		status int
+	}{
+		{"anyone reads", "", roleViewer, "", http.StatusOK},
+		{"anyone is an analyst", "", roleAnalyst, "", http.StatusOK},
+		{"admin API disabled", "", roleAdmin, "", http.StatusForbidden},
+		{"admin token", "root-token", roleAdmin, "root-token", http.StatusOK},
+		{"wrong admin token", "root-token", roleAdmin, "guess", http.StatusUnauthorized},
+		{"no admin token", "root-token", roleAdmin, "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAdminToken(t, tt.token)
+			status, ran := serveWithRole(tt.need, "/admin/sessions", tt.auth)
+			if status != tt.status || ran != (tt.status == http.StatusOK) {
+				t.Errorf("status %d, handler ran %v; want %d", status, ran, tt.status)
+			}
+		})
+	}
+}
+
+// handle registers on the default mux, so its routes are registered once here.
+func TestHandleAndTools(t *testing.T) {
+	useAdminToken(t, "")
+	useTenants(t, []*Tenant{testTenant(t, "viewer", "k-view", roleViewer), testTenant(t, "admin", "k-admin", roleAdmin)})
+	savedTools := tools
+	t.Cleanup(func() { tools = savedTools })
+	tools = nil
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	handle("GET /test-rbac/read", roleViewer, "test_read", "Read", ok)
+	handle("/test-rbac/write", roleAnalyst, "test_write", "Write", ok)
+	handle("DELETE /test-rbac/admin", roleAdmin, "test_admin", "Administer", ok)
+
+	want := []Tool{
+		{Name: "test_read", Method: "GET", Path: "/test-rbac/read", Description: "Read", Role: "viewer", need: roleViewer},
+		{Name: "test_write", Method: "GET, POST", Path: "/test-rbac/write", Description: "Write", Role: "analyst", need: roleAnalyst},
+		{Name: "test_admin", Method: "DELETE", Path: "/test-rbac/admin", Description: "Administer", Role: "admin", need: roleAdmin},
+	}
+	if len(tools) != len(want) {
+		t.Fatalf("got %d tools, want %d", len(tools), len(want))
+	}
+	for i := range want {
+		if tools[i] != want[i] {
+			t.Errorf("tool %d = %+v, want %+v", i, tools[i], want[i])
+		}
+	}
+
+	mux := withTenants(http.DefaultServeMux)
+	for _, tt := range []struct {
+		method, path, key string
+		status            int
+	}{
+		{http.MethodGet, "/test-rbac/read", "k-view", http.StatusNoContent},
+		{http.MethodPost, "/test-rbac/write", "k-view", http.StatusForbidden},
+		{http.MethodPost, "/test-rbac/write", "k-admin", http.StatusNoContent},
+		{http.MethodDelete, "/test-rbac/admin", "k-view", http.StatusForbidden},
+		{http.MethodDelete, "/test-rbac/admin", "k-admin", http.StatusNoContent},
+		{http.MethodPost, "/test-rbac/read", "k-admin", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/test-rbac/write", "k-admin", http.StatusNoContent},
+		{http.MethodPut, "/test-rbac/write", "k-admin", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/test-rbac/write", "k-admin", http.StatusMethodNotAllowed},
+		{http.MethodPatch, "/test-rbac/write", "k-admin", http.StatusMethodNotAllowed},
+	} {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		r.Header.Set("Authorization", "Bearer "+tt.key)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s %s as %s: status %d, want %d", tt.method, tt.path, tt.key, w.Code, tt.status)
+		}
+		// The server's catch-all "/" would answer 404, so routes without a method answer
+		// 405 themselves, in the JSON error envelope
+		if tt.path == "/test-rbac/write" && w.Code == http.StatusMethodNotAllowed &&
+			(w.Header().Get("Allow") != "GET, POST" || !strings.Contains(w.Body.String(), ErrCodeMethodNotAllowed)) {
+			t.Errorf("%s %s: Allow %q, body %s", tt.method, tt.path, w.Header().Get("Allow"), w.Body)
+		}
+	}
+
+	for key, names := range map[string]string{"k-view": "test_read", "k-admin": "test_admin,test_read,test_write"} {
+		r := httptest.NewRequest(http.MethodGet, "/tools", nil)
+		r.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		withTenants(http.HandlerFunc(toolsHandler)).ServeHTTP(w, r)
+		var resp struct {
+			Data []Tool `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, tool := range resp.Data {
+			got = append(got, tool.Name)
+		}
+		if strings.Join(got, ",") != names {
+			t.Errorf("/tools as %s lists %v, want %s", key, got, names)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ===== Conversational references =====
+//
+// A follow-up question often points back instead of repeating itself: "and the same namespace
+// last month", "what about that region", "compare with the previous period". On POST
+// /allocations, /cloudCosts, /assets and /query with a session_id, such references in the
+// question are resolved against the filters the session used before, filling only filters
+// the request leaves empty. Each resolution is listed in meta.references:
+//
+//	"references": [{"phrase": "that region", "field": "region", "value": "us-west-2", "from": "assets"}]
+//
+//	same/that namespace, those namespaces          namespace
+//	same/that provider, that cloud                 provider
+//	same/that region                               region
+//	same/that period, same window, same timeframe  the window (allocations only)
+//	previous/prior period, the period before       the window of the same length just before it
+//	same as before, same filters                   every filter the endpoint takes
+//
+// "Before" is the filters the session last sent to the same endpoint or, for a field those
+// don't have, to the endpoint it used last. Allocation windows are remembered as resolved, so
+// "the previous period" after "last week" is the week before. A reference that can't be
+// resolved (no session, nothing to refer to, a filter the endpoint doesn't take, or a
+// cluster, which isn't a filter here) raises an unresolved_reference warning.
+
+// referencePhrases map reference phrases to the filter they refer to, most specific first.
+// "all" is every filter of the endpoint, "previous_period" the window before the last one.
+var referencePhrases = []struct {
+	re    *regexp.Regexp
+	field string
+}{
+	{regexp.MustCompile(`\bsame\s+(?:as\s+before|as\s+last\s+time|filters|again)\b`), "all"},
+	{regexp.MustCompile(`\b(?:same|that|those|these)\s+namespaces?\b`), "namespace"},
+	{regexp.MustCompile(`\b(?:same|that)\s+(?:provider|cloud)\b`), "provider"},
+	{regexp.MustCompile(`\b(?:same|that)\s+region\b`), "region"},
+	{regexp.MustCompile(`\b(?:previous|prior|preceding)\s+period\b|\bperiod\s+before\b`), "previous_period"},
+	{regexp.MustCompile(`\b(?:same|that)\s+(?:period|window|timeframe|time\s+range)\b`), "window"},
+	{regexp.MustCompile(`\b(?:same|that)\s+cluster\b`), "cluster"},
+}
+
+// referenceFields are the filters each endpoint can inherit.
+var referenceFields = map[string][]string{
+	"allocations": {"namespace", "window"},
+	"cloudCosts":  {"namespace"},
+	"assets":      {"provider", "region"},
+}
+
+// ReferenceResolution is one entry of meta.references.
+type ReferenceResolution struct {
+	Phrase string `json:"phrase"`
+	Field  string `json:"field"`
+	Value  string `json:"value"`
+	From   string `json:"from"` // endpoint whose earlier filters were used
+}
+
+// stripReferences blanks the reference phrases in text, so filter extraction doesn't read
+// "same" in "same namespace" as a namespace.
+func stripReferences(text string) string {
+	for _, p := range referencePhrases {
+		text = p.re.ReplaceAllString(text, " ")
+	}
+	return text
+}
+
+// resolveReferences fills the empty filters of aq that its question refers back to from the
+// session's earlier filters. It must run before the request is recorded in the session.
+func resolveReferences(ctx context.Context, endpoint string, aq *AgenticQuery) {
+	text := strings.ToLower(aq.Query)
+	type reference struct{ phrase, field string }
+	var refs []reference
+	for _, p := range referencePhrases {
+		if m := p.re.FindString(text); m != "" {
+			refs = append(refs, reference{m, p.field})
+		}
+	}
+	if len(refs) == 0 {
+		return
+	}
+	if aq.Context.SessionID == "" {
+		addWarning(ctx, "unresolved_reference", "query", "%q refers to an earlier query, but the request has no session_id", refs[0].phrase)
+		return
+	}
+	earlier := earlierFilters(aq.Context.SessionID, endpoint)
+	lookup := func(field string) (QueryFilters, string, bool) {
+		for _, e := range earlier {
+			if filterValue(e.filters, field) != "" {
+				return e.filters, e.endpoint, true
+			}
+		}
+		return QueryFilters{}, "", false
+	}
+	// A window phrase in the question ("last month") is an explicit window
+	windowSet := aq.Filters.Window != "" || aq.Filters.Start != "" || aq.Filters.End != "" || windowFromQuery(text) != ""
+
+	inherit := func(phrase, field string) bool {
+		if field == "window" && windowSet || field != "window" && filterValue(aq.Filters, field) != "" {
+			return true // the request says it itself
+		}
+		prev, from, ok := lookup(field)
+		if !ok {
+			return false
+		}
+		switch field {
+		case "namespace":
+			aq.Filters.Namespace = prev.Namespace
+		case "provider":
+			aq.Filters.Provider = prev.Provider
+		case "region":
+			aq.Filters.Region = prev.Region
+		case "window":
+			aq.Filters.Window, aq.Filters.Start, aq.Filters.End = prev.Window, prev.Start, prev.End
+			if aq.Filters.Timezone == "" {
+				aq.Filters.Timezone = prev.Timezone
+			}
+			windowSet = true
+		}
+		recordReference(ctx, ReferenceResolution{Phrase: phrase, Field: field, Value: filterValue(aq.Filters, field), From: from})
+		return true
+	}
+
+	fields := referenceFields[endpoint]
+	for _, ref := range refs {
+		switch {
+		case ref.field == "cluster":
+			addWarning(ctx, "unresolved_reference", "query", "%q can't be resolved: clusters aren't a filter; ask by namespace instead", ref.phrase)
+		case ref.field == "all":
+			inherited := false
+			for _, field := range fields {
+				inherited = inherit(ref.phrase, field) || inherited
+			}
+			if !inherited {
+				addWarning(ctx, "unresolved_reference", "query", "%q can't be resolved: session %s has no earlier filters for /%s", ref.phrase, aq.Context.SessionID, endpoint)
+			}
+		case ref.field == "previous_period":
+			if !slices.Contains(fields, "window") {
+				addWarning(ctx, "unresolved_reference", "query", "%q can't be resolved: /%s takes no time window", ref.phrase, endpoint)
+			} else if !windowSet && !inheritPreviousPeriod(ctx, ref.phrase, aq, lookup) {
+				addWarning(ctx, "unresolved_reference", "query", "%q can't be resolved: session %s has no earlier window", ref.phrase, aq.Context.SessionID)
+			}
+			windowSet = true
+		case !slices.Contains(fields, ref.field):
+			addWarning(ctx, "unresolved_reference", "query", "%q can't be resolved: /%s takes no %s filter", ref.phrase, endpoint, ref.field)
+		case !inherit(ref.phrase, ref.field):
+			addWarning(ctx, "unresolved_reference", "query", "%q can't be resolved: session %s has no earlier %s", ref.phrase, aq.Context.SessionID, ref.field)
+		}
+	}
+}
+
+// inheritPreviousPeriod sets aq's window to the span of the same length that ends where the
+// earlier window started.
+func inheritPreviousPeriod(ctx context.Context, phrase string, aq *AgenticQuery, lookup func(string) (QueryFilters, string, bool)) bool {
+	prev, from, ok := lookup("window")
+	if !ok {
+		return false
+	}
+	var verrs ValidationErrors
+	loc := loadTimezone(&verrs, "timezone", prev.Timezone)
+	start, end := prev.Start, prev.End
+	applyWindow(&verrs, prev.Window, "", &start, &end, time.Now(), loc)
+	startTime, errStart := parseDate(start)
+	endTime, errEnd := parseDate(end)
+	if len(verrs) > 0 || errStart != nil || errEnd != nil {
+		return false
+	}
+	span := endTime.Sub(startTime)
+	aq.Filters.Window = ""
+	aq.Filters.Start = startTime.Add(-span).In(loc).Format(time.RFC3339)
+	aq.Filters.End = startTime.In(loc).Format(time.RFC3339)
+	if aq.Filters.Timezone == "" {
+		aq.Filters.Timezone = prev.Timezone
+	}
+	recordReference(ctx, ReferenceResolution{Phrase: phrase, Field: "window", Value: filterValue(aq.Filters, "window"), From: from})
+	return true
+}
+
+// earlierFilter is filters a session sent to an endpoint.
+type earlierFilter struct {
+	endpoint string
+	filters  QueryFilters
+}
+
+// earlierFilters returns the session's filters for endpoint, then for the endpoint it used
+// last, in the order references look in them.
+func earlierFilters(sessionID, endpoint string) []earlierFilter {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[sessionID]
+	if !ok {
+		return nil
+	}
+	var out []earlierFilter
+	if f, ok := s.EffectiveFilters[endpoint]; ok {
+		out = append(out, earlierFilter{endpoint, f})
+	}
+	if f, ok := s.EffectiveFilters[s.LastEndpoint]; ok && s.LastEndpoint != endpoint {
+		out = append(out, earlierFilter{s.LastEndpoint, f})
+	}
+	return out
+}
+
+// filterValue is f's value for a reference field; the window reads as window or start,end.
+func filterValue(f QueryFilters, field string) string {
+	switch field {
+	case "namespace":
+		return f.Namespace
+	case "provider":
+		return f.Provider
+	case "region":
+		return f.Region
+	case "window":
+		if f.Window != "" {
+			return f.Window
+		}
+		if f.Start != "" || f.End != "" {
+			return f.Start + "," + f.End
+		}
+	}
+	return ""
+}
+
+// recordReference adds r to the request's meta.references and, when the request is
+// explained, to meta.explain.session.inherited.
+func recordReference(ctx context.Context, r ReferenceResolution) {
+	logf(ctx, "[MCP] Reference %q → %s %q from /%s\n", r.Phrase, r.Field, r.Value, r.From)
+	list, _ := ctx.Value(warningsKey{}).(*warningList)
+	if list == nil {
+		return
+	}
+	list.mu.Lock()
+	list.references = append(list.references, r)
+	e := list.explain
+	list.mu.Unlock()
+	if e != nil && e.Session != nil {
+		e.mu.Lock()
+		e.Session.Inherited[r.Field] = r.Value
+		e.mu.Unlock()
+	}
+}
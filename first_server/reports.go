@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Shared-cost distribution strategies for chargeback reports.
+const (
+	DistributeProportional = "proportional" // by each group's share of direct cost
+	DistributeEven         = "even"         // split equally across groups
+	DistributeNone         = "none"         // report shared cost as its own line
+)
+
+// ChargebackLine is one row of a chargeback report.
+type ChargebackLine struct {
+	Name        string  `json:"name"`
+	DirectCost  float64 `json:"direct_cost"`
+	SharedCost  float64 `json:"shared_cost"`
+	TotalCost   float64 `json:"total_cost"`
+	SharePct    float64 `json:"share_pct"`
+	Allocations int     `json:"allocations"`
+}
+
+// ChargebackReport is a period-based showback/chargeback report.
+type ChargebackReport struct {
+	Start            string           `json:"start"`
+	End              string           `json:"end"`
+	GroupBy          string           `json:"group_by"`
+	Distribution     string           `json:"distribution"`
+	Policy           string           `json:"policy,omitempty"` // group_by policy: the policy applied
+	SharedNamespaces []string         `json:"shared_namespaces"`
+	SharedCostTotal  float64          `json:"shared_cost_total"`
+	TotalCost        float64          `json:"total_cost"`
+	Lines            []ChargebackLine `json:"lines"`
+}
+
+// groupShares returns the report lines an allocation belongs to, as fractions of its cost.
+// Only a policy splits an allocation across several lines.
+func groupShares(alloc Allocation, groupBy string, policy *AllocationPolicy) map[string]float64 {
+	switch {
+	case groupBy == "policy" && policy != nil:
+		shares, _ := policy.shares(alloc)
+		return shares
+	case groupBy == "team":
+		team, _ := teamMapping.teamFor(alloc)
+		return map[string]float64{team: 1}
+	}
+	return map[string]float64{alloc.Namespace: 1}
+}
+
+// buildChargebackReport groups allocations by namespace, team or policy owner and spreads the
+// cost of shared namespaces across the remaining groups according to distribution.
+func buildChargebackReport(allocs []Allocation, groupBy, distribution string, shared []string, policy *AllocationPolicy) ChargebackReport {
+	isShared := map[string]bool{}
+	for _, ns := range shared {
+		isShared[ns] = true
+	}
+
+	lines := map[string]*ChargebackLine{}
+	sharedTotal, directTotal := 0.0, 0.0
+	for _, alloc := range allocs {
+		if isShared[alloc.Namespace] {
+			sharedTotal += alloc.TotalCost
+			continue
+		}
+		for key, frac := range groupShares(alloc, groupBy, policy) {
+			line, ok := lines[key]
+			if !ok {
+				line = &ChargebackLine{Name: key}
+				lines[key] = line
+			}
+			line.DirectCost += alloc.TotalCost * frac
+			line.Allocations++
+		}
+		directTotal += alloc.TotalCost
+	}
+
+	switch {
+	case distribution == DistributeNone || len(lines) == 0:
+		if sharedTotal > 0 {
+			lines["(shared)"] = &ChargebackLine{Name: "(shared)", SharedCost: sharedTotal}
+		}
+	case distribution == DistributeEven:
+		each := sharedTotal / float64(len(lines))
+		for _, line := range lines {
+			line.SharedCost = each
+		}
+	default: // proportional; falls back to even when no group has direct cost
+		for _, line := range lines {
+			if directTotal > 0 {
+				line.SharedCost = sharedTotal * line.DirectCost / directTotal
+			} else {
+				line.SharedCost = sharedTotal / float64(len(lines))
+			}
+		}
+	}
+
+	report := ChargebackReport{
+		GroupBy:          groupBy,
+		Distribution:     distribution,
+		SharedNamespaces: shared,
+		SharedCostTotal:  round2(sharedTotal),
+		TotalCost:        round2(sharedTotal + directTotal),
+		Lines:            []ChargebackLine{},
+	}
+	for _, line := range lines {
+		line.TotalCost = line.DirectCost + line.SharedCost
+		if report.TotalCost > 0 {
+			line.SharePct = round2(line.TotalCost / (sharedTotal + directTotal) * 100)
+		}
+		line.DirectCost, line.SharedCost, line.TotalCost = round2(line.DirectCost), round2(line.SharedCost), round2(line.TotalCost)
+		report.Lines = append(report.Lines, *line)
+	}
+	sort.Slice(report.Lines, func(i, j int) bool {
+		if report.Lines[i].TotalCost != report.Lines[j].TotalCost {
+			return report.Lines[i].TotalCost > report.Lines[j].TotalCost
+		}
+		return report.Lines[i].Name < report.Lines[j].Name
+	})
+	return report
+}
+
+// writeReportCSV writes the report as a CSV download.
+func writeReportCSV(w http.ResponseWriter, report ChargebackReport) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="chargeback.csv"`)
+	renderReportCSV(w, report)
+}
+
+// renderReportCSV writes the report lines as CSV with a trailing total row.
+func renderReportCSV(w io.Writer, report ChargebackReport) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{report.GroupBy, "direct_cost", "shared_cost", "total_cost", "share_pct", "allocations"})
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, l := range report.Lines {
+		cw.Write([]string{l.Name, f(l.DirectCost), f(l.SharedCost), f(l.TotalCost), f(l.SharePct), strconv.Itoa(l.Allocations)})
+	}
+	cw.Write([]string{"TOTAL", f(report.TotalCost - report.SharedCostTotal), f(report.SharedCostTotal), f(report.TotalCost), "100.00", ""})
+	cw.Flush()
+}
+
+// splitList splits a comma-separated parameter, dropping blanks.
+func splitList(s string) []string {
+	out := []string{}
+	for _, part := range strings.Split(s, ",") {
+		if p := strings.TrimSpace(part); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// reportsHandler handles GET /reports.
+// Query params: start, end or window (the period), timezone, by=namespace|team|policy,
+// policy (implies by=policy), shared=ns1,ns2, distribution=proportional|even|none,
+// format=json|csv (or Accept: text/csv).
+func reportsHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /reports request received")
+
+	q := r.URL.Query()
+	start, end := q.Get("start"), q.Get("end")
+	groupBy := q.Get("by")
+	policyName := q.Get("policy")
+	if groupBy == "" && policyName != "" {
+		groupBy = "policy"
+	} else if groupBy == "" {
+		groupBy = "namespace"
+	}
+	distribution := q.Get("distribution")
+	if distribution == "" {
+		distribution = sharedCosts.Distribution
+	}
+	shared := splitList(q.Get("shared"))
+	if !q.Has("shared") {
+		shared = sharedCosts.Namespaces
+	}
+	format := q.Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		format = "csv"
+	}
+
+	var verrs ValidationErrors
+	loc := loadTimezone(&verrs, "timezone", q.Get("timezone"))
+	resolved := applyWindow(&verrs, q.Get("window"), "", &start, &end, time.Now(), loc)
+	validateWindow(&verrs, start, end)
+	if groupBy != "namespace" && groupBy != "team" && groupBy != "policy" {
+		verrs.add("by", groupBy, "must be namespace, team or policy")
+	}
+	policy := lookupPolicy(&verrs, "policy", policyName)
+	if groupBy == "policy" && policyName == "" {
+		verrs.add("policy", "", "is required with by=policy")
+	} else if groupBy != "policy" && policyName != "" {
+		verrs.add("policy", policyName, "requires by=policy")
+	}
+	if !validDistribution(distribution) {
+		verrs.add("distribution", distribution, "must be proportional, even or none")
+	}
+	if format != "" && format != "json" && format != "csv" {
+		verrs.add("format", format, "must be json or csv")
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	data, err := costSource.GetAllocations(r.Context(), AllocationFilter{Start: start, End: end})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations", err)
+		return
+	}
+
+	report := buildChargebackReport(data, groupBy, distribution, shared, policy)
+	report.Start, report.End, report.Policy = start, end, policyName
+	logf(r.Context(), "[MCP] /reports — %d lines by %s, shared cost %.2f\n", len(report.Lines), groupBy, report.SharedCostTotal)
+
+	if format == "csv" {
+		writeReportCSV(w, report)
+		return
+	}
+	meta := map[string]interface{}{
+		"filtersUsed": map[string]string{"start": start, "end": end, "by": groupBy, "policy": policyName, "distribution": distribution},
+		"request_id":  requestIDFrom(r.Context()),
+		"total":       len(report.Lines),
+		"timezone":    loc.String(),
+	}
+	if resolved != nil {
+		meta["window"] = resolved
+	}
+	resp := map[string]interface{}{"data": report, "meta": meta}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
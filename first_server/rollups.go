@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===== Store rollups =====
+//
+// The local store keeps three resolutions: raw records as ingested (typically hourly), daily
+// rollups and monthly rollups. Once a whole day of raw records is older than the raw retention
+// it is summed per namespace into one daily record, and once a whole month of daily records is
+// older than the daily retention it is summed into one monthly record. Monthly records past
+// their retention are deleted. Long windows then read a few records per namespace instead of
+// thousands, and the store stays bounded.
+//
+// LOCAL_STORE_RETENTION sets the retention per resolution, "0" keeping records forever:
+//
+//	LOCAL_STORE_RETENTION=raw=30d,daily=52w,monthly=0   (the default)
+//
+// Rollup records carry the namespace, costs and usage; resource_id is "(daily)" or
+// "(monthly)" and labels are dropped. A rollup counts whole in any window it overlaps, so
+// windows past the raw retention should cover whole days or months. Raw records for a day that has already been rolled up
+// are ignored, so a repeated backfill doesn't count them twice. Rollups run after every
+// ingestion.
+
+// storeTier is one resolution of the store.
+type storeTier struct {
+	name      string        // raw, daily or monthly
+	prefix    string        // file name prefix
+	resource  string        // resource_id of rollup records; "" for raw
+	retention time.Duration // 0 keeps records forever
+	// period is the span a record of this tier covers, nil for raw.
+	period func(t time.Time) (time.Time, time.Time)
+	// file is the file a record starting at t is kept in.
+	file  func(t time.Time) string
+	files map[string]map[string]Allocation // file to record key to allocation
+}
+
+// newStoreTiers returns the raw, daily and monthly tiers with the default retention.
+func newStoreTiers() []*storeTier {
+	return []*storeTier{
+		{name: "raw", prefix: "allocations", retention: 30 * 24 * time.Hour,
+			file: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{name: "daily", prefix: "daily", resource: "(daily)", retention: 52 * 7 * 24 * time.Hour,
+			period: func(t time.Time) (time.Time, time.Time) {
+				start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+				return start, start.AddDate(0, 0, 1)
+			},
+			file: func(t time.Time) string { return t.Format("2006-01") }},
+		{name: "monthly", prefix: "monthly", resource: "(monthly)",
+			period: func(t time.Time) (time.Time, time.Time) {
+				start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+				return start, start.AddDate(0, 1, 0)
+			},
+			file: func(t time.Time) string { return t.Format("2006") }},
+	}
+}
+
+// parseRetention applies LOCAL_STORE_RETENTION, e.g. "raw=14d,daily=26w,monthly=0".
+func parseRetention(tiers []*storeTier, v string) error {
+	for _, part := range splitList(v) {
+		name, value, ok := strings.Cut(part, "=")
+		i := slices.IndexFunc(tiers, func(t *storeTier) bool { return t.name == strings.TrimSpace(name) })
+		if !ok || i < 0 {
+			return fmt.Errorf("%q: want raw=, daily= or monthly= followed by a duration", part)
+		}
+		value = strings.TrimSpace(value)
+		if value == "0" {
+			tiers[i].retention = 0
+			continue
+		}
+		d, err := parseLookback(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		tiers[i].retention = d
+	}
+	return nil
+}
+
+// recordFile is the file of tier a record belongs in; raw records without a start time are
+// kept in "undated" and never rolled up.
+func (t *storeTier) recordFile(a Allocation) string {
+	start, err := time.Parse(time.RFC3339, a.StartTime)
+	if err != nil {
+		return "undated"
+	}
+	return t.file(start.UTC())
+}
+
+// put adds a to the tier, returning its file.
+func (t *storeTier) put(a Allocation) string {
+	file := t.recordFile(a)
+	recs, ok := t.files[file]
+	if !ok {
+		recs = map[string]Allocation{}
+		t.files[file] = recs
+	}
+	recs[storeKey(a)] = a
+	return file
+}
+
+// rollupKey is the key of the record of this tier that a record starting at start rolls into.
+func (t *storeTier) rollupKey(namespace string, start time.Time) (key, file string) {
+	pStart, _ := t.period(start)
+	return namespace + "|" + t.resource + "|" + pStart.Format(time.RFC3339), t.file(pStart)
+}
+
+// rolledUp reports whether a's period is already in a rollup tier, so a raw copy would
+// count twice.
+func (s *localStore) rolledUp(a Allocation) bool {
+	start, err := time.Parse(time.RFC3339, a.StartTime)
+	if err != nil {
+		return false
+	}
+	for _, t := range s.tiers[1:] {
+		key, file := t.rollupKey(a.Namespace, start.UTC())
+		if _, ok := t.files[file][key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isRollup reports whether a is a daily or monthly rollup record.
+func isRollup(a Allocation) bool {
+	return a.ResourceID == "(daily)" || a.ResourceID == "(monthly)"
+}
+
+// coversAny reports whether one of starts falls in the rollup's period.
+func coversAny(rollup Allocation, starts []time.Time) bool {
+	pStart, err1 := time.Parse(time.RFC3339, rollup.StartTime)
+	pEnd, err2 := time.Parse(time.RFC3339, rollup.EndTime)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return slices.ContainsFunc(starts, func(t time.Time) bool { return !t.Before(pStart) && t.Before(pEnd) })
+}
+
+// addUsage sums a's costs and usage into dst.
+func addUsage(dst *Allocation, a Allocation) {
+	dst.CPUCost = round2(dst.CPUCost + a.CPUCost)
+	dst.MemoryCost = round2(dst.MemoryCost + a.MemoryCost)
+	dst.GPUCost = round2(dst.GPUCost + a.GPUCost)
+	dst.NetworkCost = round2(dst.NetworkCost + a.NetworkCost)
+	dst.PVCost = round2(dst.PVCost + a.PVCost)
+	dst.TotalCost = round2(dst.TotalCost + a.TotalCost)
+	dst.CPUCoreHours += a.CPUCoreHours
+	dst.RAMGBHours += a.RAMGBHours
+	dst.GPUHours += a.GPUHours
+	for _, id := range a.AssetIDs {
+		if !slices.Contains(dst.AssetIDs, id) {
+			dst.AssetIDs = append(dst.AssetIDs, id)
+		}
+	}
+}
+
+// CompactionResult counts what one rollup pass did.
+type CompactionResult struct {
+	RolledUp int `json:"rolled_up"` // records summed into the next resolution
+	Expired  int `json:"expired"`   // monthly records deleted
+}
+
+// compactLocked rolls every record whose next-resolution period is entirely past its tier's
+// retention into that period's record, and deletes expired monthly records. Callers hold s.mu.
+func (s *localStore) compactLocked(now time.Time) (CompactionResult, error) {
+	var res CompactionResult
+	dirty := map[*storeTier]map[string]bool{}
+	mark := func(t *storeTier, file string) {
+		if dirty[t] == nil {
+			dirty[t] = map[string]bool{}
+		}
+		dirty[t][file] = true
+	}
+	for i, t := range s.tiers {
+		if t.retention == 0 {
+			continue
+		}
+		cutoff := now.Add(-t.retention)
+		var next *storeTier
+		if i+1 < len(s.tiers) {
+			next = s.tiers[i+1]
+		}
+		for file, recs := range t.files {
+			for key, a := range recs {
+				start, err := time.Parse(time.RFC3339, a.StartTime)
+				if err != nil {
+					continue
+				}
+				start = start.UTC()
+				if next == nil {
+					_, end := t.period(start)
+					if end.After(cutoff) {
+						continue
+					}
+					res.Expired++
+				} else {
+					pStart, pEnd := next.period(start)
+					if pEnd.After(cutoff) {
+						continue
+					}
+					nkey, nfile := next.rollupKey(a.Namespace, start)
+					r, ok := next.files[nfile][nkey]
+					if !ok {
+						r = Allocation{Namespace: a.Namespace, ResourceID: next.resource,
+							StartTime: pStart.Format(time.RFC3339), EndTime: pEnd.Format(time.RFC3339)}
+					}
+					addUsage(&r, a)
+					next.put(r)
+					mark(next, nfile)
+					res.RolledUp++
+				}
+				delete(recs, key)
+				mark(t, file)
+			}
+		}
+	}
+	for t, files := range dirty {
+		for file := range files {
+			if err := s.saveFileLocked(t, file); err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// saveFileLocked writes one file of a tier via a temp file and rename, or removes it once it
+// is empty. Callers hold s.mu.
+func (s *localStore) saveFileLocked(t *storeTier, file string) error {
+	path := filepath.Join(s.dir, t.prefix+"-"+file+".json")
+	if len(t.files[file]) == 0 {
+		delete(t.files, file)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	list := make([]Allocation, 0, len(t.files[file]))
+	for _, a := range t.files[file] {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return storeKey(list[i]) < storeKey(list[j]) })
+	raw, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ===== Query routing =====
+//
+// POST /query (or GET /query?q=...) takes a free-text question, decides which endpoint answers
+// it, pulls filters out of the text, and returns that endpoint's response with meta.route
+// explaining the choice. Routing embeds the question as a bag-of-words vector and compares it
+// by cosine similarity with a prototype vector per endpoint: no model, so it is fast and gives
+// the same answer every time.
+
+// routePrototypes describe each routable endpoint in the vocabulary users ask in.
+var routePrototypes = map[string]string{
+	"allocations": `allocation allocations namespace namespaces workload workloads pod pods container
+		containers deployment kubernetes k8s cluster cpu memory ram gpu team teams usage spend spent
+		cost costs over time trend daily hourly yesterday week month`,
+	"cloudCosts": `cloud bill billing invoice invoiced charge charges vm vms virtual machine machines
+		instance instances compute service services account subscription spend cloud cost costs`,
+	"assets": `asset assets inventory node nodes disk disks volume volumes storage database databases
+		load balancer ip resource resources provider providers region regions aws gcp azure idle
+		running stopped terminated tag tags owner owned type sku`,
+}
+
+// routeFallback answers questions that match no prototype at all.
+const routeFallback = "allocations"
+
+var (
+	routeWord     = regexp.MustCompile(`[a-z0-9]+`)
+	routeVectors  map[string]map[string]float64
+	routeProvider = regexp.MustCompile(`\b(aws|gcp|azure)\b`)
+	routeRegion   = regexp.MustCompile(`\b([a-z]{2}-[a-z]+-\d|[a-z]+-[a-z]+\d)\b|\bregion\s+([a-z][a-z0-9-]*)\b`)
+	// routeNS matches "namespace prod", "namespaces prod,dev" and then "prod namespace", in that order
+	routeNS = []*regexp.Regexp{
+		regexp.MustCompile(`\bnamespace\s+([a-z0-9!/][a-z0-9,!/*^$.-]*)`),
+		regexp.MustCompile(`\bnamespaces\s+([a-z0-9!/][a-z0-9!/*^$.-]*(?:,[a-z0-9!/*^$.-]+)+)`),
+		regexp.MustCompile(`\b([a-z0-9][a-z0-9-]*)\s+namespace\b`),
+	}
+	// routeStatus matches asset lifecycle words; "running" is read as active
+	routeStatus = regexp.MustCompile(`\b(active|running|stopped|terminated)\b`)
+	// routeOwner matches "owned by platform" and "owner platform" as the owner tag
+	routeOwner   = regexp.MustCompile(`\b(?:owned\s+by|owner)\s+([a-z0-9][a-z0-9_-]*)\b`)
+	routeSummary = regexp.MustCompile(`\b(summary|summari[sz]e|overview|tl;?dr)\b`)
+	// routeNSStop keeps "the namespace" or "namespace costs" from becoming a filter
+	routeNSStop = map[string]bool{
+		"the": true, "a": true, "each": true, "every": true, "per": true, "by": true, "which": true, "what": true,
+		"that": true, "this": true, "cost": true, "costs": true, "spend": true, "usage": true, "breakdown": true,
+		"in": true, "for": true, "of": true, "on": true,
+	}
+)
+
+func init() {
+	routeVectors = map[string]map[string]float64{}
+	for endpoint, text := range routePrototypes {
+		routeVectors[endpoint] = embedText(text)
+	}
+}
+
+// embedText is the bag-of-words embedding: term counts over lowercased words with a trailing
+// plural "s" removed, normalized to unit length.
+func embedText(text string) map[string]float64 {
+	v := map[string]float64{}
+	for _, w := range routeWord.FindAllString(strings.ToLower(text), -1) {
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			w = strings.TrimSuffix(w, "s")
+		}
+		v[w]++
+	}
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	norm = math.Sqrt(norm)
+	for w := range v {
+		v[w] /= norm
+	}
+	return v
+}
+
+func cosine(a, b map[string]float64) float64 {
+	var dot float64
+	for w, x := range a {
+		dot += x * b[w]
+	}
+	return dot
+}
+
+// RouteDecision is meta.route on a /query response.
+type RouteDecision struct {
+	Endpoint   string             `json:"endpoint"`
+	Confidence float64            `json:"confidence"` // the winning score's share of all scores
+	Scores     map[string]float64 `json:"scores"`
+	Fallback   bool               `json:"fallback,omitempty"` // no prototype matched at all
+	Extracted  map[string]string  `json:"extracted_filters"`  // filters taken from the text
+}
+
+// routeQuery picks the endpoint whose prototype is most similar to the question.
+func routeQuery(text string) RouteDecision {
+	q := embedText(text)
+	d := RouteDecision{Scores: map[string]float64{}, Extracted: map[string]string{}}
+	endpoints := make([]string, 0, len(routeVectors))
+	for endpoint := range routeVectors {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	var best, sum float64
+	for _, endpoint := range endpoints {
+		s := cosine(q, routeVectors[endpoint])
+		d.Scores[endpoint] = round2(s)
+		sum += s
+		if s > best {
+			best, d.Endpoint = s, endpoint
+		}
+	}
+	if d.Endpoint == "" {
+		d.Endpoint, d.Fallback = routeFallback, true
+		return d
+	}
+	d.Confidence = round2(best / sum)
+	return d
+}
+
+// extractFilters fills filters the caller left empty from the question text, recording each
+// one it sets in d.Extracted. Namespace filters don't apply to assets. Words found through
+// the alias table ("production", "amazon") are extracted as they are; the endpoint resolves
+// them like any other filter value (see aliases.go).
+func extractFilters(aq *AgenticQuery, d *RouteDecision) {
+	text := stripReferences(strings.ToLower(aq.Query)) // references are resolved by the endpoint
+	set := func(dst *string, field, v string) {
+		if *dst == "" && v != "" {
+			*dst = v
+			d.Extracted[field] = v
+		}
+	}
+	if d.Endpoint == "assets" {
+		if m := routeProvider.FindStringSubmatch(text); m != nil {
+			for _, p := range knownProviders {
+				if strings.EqualFold(p, m[1]) {
+					set(&aq.Filters.Provider, "provider", p)
+				}
+			}
+		}
+		set(&aq.Filters.Provider, "provider", aliasInText("provider", text))
+		if m := routeRegion.FindStringSubmatch(text); m != nil {
+			set(&aq.Filters.Region, "region", m[1]+m[2])
+		}
+		set(&aq.Filters.Region, "region", aliasInText("region", text))
+		if m := routeStatus.FindStringSubmatch(text); m != nil {
+			status := m[1]
+			if status == "running" {
+				status = "active"
+			}
+			set(&aq.Filters.Status, "status", status)
+		}
+		if m := routeOwner.FindStringSubmatch(text); m != nil && !routeNSStop[m[1]] {
+			set(&aq.Filters.Tag, "tag", "owner="+m[1])
+		}
+	} else {
+	patterns:
+		for _, re := range routeNS {
+			for _, m := range re.FindAllStringSubmatch(text, -1) {
+				if ns := strings.TrimRight(m[1], ",."); !routeNSStop[ns] {
+					set(&aq.Filters.Namespace, "namespace", ns)
+					break patterns
+				}
+			}
+		}
+		set(&aq.Filters.Namespace, "namespace", aliasInText("namespace", text))
+	}
+	if d.Endpoint == "allocations" {
+		// Recorded for meta only; /allocations resolves the phrase itself
+		if w := windowFromQuery(text); w != "" && aq.Filters.Window == "" && aq.Filters.Start == "" && aq.Filters.End == "" {
+			d.Extracted["window"] = w
+		}
+	}
+	if aq.Summarize == SummarizeOff && routeSummary.MatchString(text) {
+		aq.Summarize = SummarizeOn
+		d.Extracted["summarize"] = string(SummarizeOn)
+	}
+}
+
+// queryHandler handles GET /query?q=... and POST /query with an AgenticQuery body. Filters
+// and options in the body take precedence over anything extracted from the text.
+func queryHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /query request received")
+
+	var aq AgenticQuery
+	switch r.Method {
+	case http.MethodGet:
+		aq.Query = r.URL.Query().Get("q")
+		aq.Context.SessionID = r.URL.Query().Get("session_id")
+		aq.Explain = r.URL.Query().Get("explain") == "true"
+		aq.DryRun = r.URL.Query().Get("dry_run") == "true"
+	case http.MethodPost:
+		if !decodeJSON(w, r, &aq) {
+			return
+		}
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Use GET or POST", nil)
+		return
+	}
+	if strings.TrimSpace(aq.Query) == "" {
+		writeValidationError(w, r, ValidationErrors{{Field: "query", Value: "", Message: "is required"}})
+		return
+	}
+
+	route := routeQuery(aq.Query)
+	extractFilters(&aq, &route)
+	logf(r.Context(), "[MCP] /query — routed to /%s (confidence %.2f, extracted %v)\n", route.Endpoint, route.Confidence, route.Extracted)
+
+	rec := httptest.NewRecorder()
+	executeQuery(r.Context(), rec, route.Endpoint, aq)
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Routed endpoint returned invalid JSON", err.Error())
+		return
+	}
+	if meta, ok := resp["meta"].(map[string]interface{}); ok {
+		meta["route"] = route
+		// The endpoint explained itself; add how the question was routed
+		if explain, ok := meta["explain"].(map[string]interface{}); ok {
+			if intents, ok := explain["intents"].(map[string]interface{}); ok {
+				intents["route"] = route
+			}
+		}
+	} else if apiErr, ok := resp["error"].(map[string]interface{}); ok {
+		apiErr["route"] = route
+	}
+	writeJSON(w, rec.Code, resp)
+}
+
+// resolveEndpoint checks an explicit endpoint name, or routes aq's query text when there is
+// none, pulling filters out of the text as /query does. Problems are recorded under field.
+func resolveEndpoint(errs *ValidationErrors, field, endpoint string, aq *AgenticQuery) string {
+	if endpoint != "" {
+		if _, ok := queryEndpoints[endpoint]; !ok {
+			errs.add(field, endpoint, "must be one of allocations, cloudCosts, assets")
+		}
+		return endpoint
+	}
+	if strings.TrimSpace(aq.Query) == "" {
+		errs.add(field, "", "is required when query is empty")
+		return ""
+	}
+	route := routeQuery(aq.Query)
+	extractFilters(aq, &route)
+	return route.Endpoint
+}
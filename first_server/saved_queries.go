@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ===== Saved queries =====
+//
+// A saved query is a named AgenticQuery for one endpoint, so common questions ("prod weekly
+// spend") can be replayed by name from agents, the CLI or schedules. With tenancy on, each
+// tenant has its own set of names and only sees and runs its own queries.
+
+// SavedQuery is a stored query definition.
+type SavedQuery struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Tenant      string       `json:"tenant,omitempty"` // the owner's tenant, when tenancy is on
+	Endpoint    string       `json:"endpoint"`         // see queryEndpoints
+	Query       AgenticQuery `json:"query"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// queryEndpoints maps SavedQuery.Endpoint to the handler that executes it.
+var queryEndpoints = map[string]http.HandlerFunc{
+	"allocations": allocationsHandler,
+	"cloudCosts":  cloudCostsHandler,
+	"assets":      assetsHandler,
+}
+
+// queryRecords gives the record type each endpoint's expr filter binds to.
+var queryRecords = map[string]interface{}{
+	"allocations": Allocation{},
+	"cloudCosts":  CloudCost{},
+	"assets":      Asset{},
+}
+
+var queryNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// savedQueryKey identifies a saved query: names are unique within a tenant.
+type savedQueryKey struct{ tenant, name string }
+
+// savedQueryStore keeps saved queries in memory and persists them as JSON after every change.
+type savedQueryStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[savedQueryKey]*SavedQuery
+}
+
+var savedQueries = &savedQueryStore{items: map[savedQueryKey]*SavedQuery{}}
+
+// load reads persisted queries from path. A missing file starts an empty store.
+func (s *savedQueryStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read saved queries: %w", err)
+	}
+	var list []*SavedQuery
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return fmt.Errorf("failed to parse saved queries %s: %w", path, err)
+	}
+	for _, q := range list {
+		s.items[savedQueryKey{q.Tenant, q.Name}] = q
+	}
+	return nil
+}
+
+// saveLocked writes all queries to disk via a temp file and rename. Callers hold s.mu.
+func (s *savedQueryStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *savedQueryStore) listLocked() []SavedQuery {
+	list := make([]SavedQuery, 0, len(s.items))
+	for _, q := range s.items {
+		list = append(list, *q)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Tenant != list[j].Tenant {
+			return list[i].Tenant < list[j].Tenant
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// list returns tenant's queries by name.
+func (s *savedQueryStore) list(tenant string) []SavedQuery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []SavedQuery{}
+	for _, q := range s.listLocked() {
+		if q.Tenant == tenant {
+			list = append(list, q)
+		}
+	}
+	return list
+}
+
+func (s *savedQueryStore) get(tenant, name string) (SavedQuery, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.items[savedQueryKey{tenant, name}]
+	if !ok {
+		return SavedQuery{}, false
+	}
+	return *q, true
+}
+
+// put stores q, keeping the creation time of an existing query with the same name. It
+// reports whether the query was newly created.
+func (s *savedQueryStore) put(q SavedQuery) (SavedQuery, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	q.CreatedAt, q.UpdatedAt = now, now
+	key := savedQueryKey{q.Tenant, q.Name}
+	existing, found := s.items[key]
+	if found {
+		q.CreatedAt = existing.CreatedAt
+	}
+	s.items[key] = &q
+	return q, !found, s.saveLocked()
+}
+
+func (s *savedQueryStore) delete(tenant, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := savedQueryKey{tenant, name}
+	if _, ok := s.items[key]; !ok {
+		return false, nil
+	}
+	delete(s.items, key)
+	return true, s.saveLocked()
+}
+
+// executeQuery runs aq against an endpoint handler as a POST with the query as body, writing
+// the handler's response to w. ctx carries the caller's request ID and deadline.
+func executeQuery(ctx context.Context, w http.ResponseWriter, endpoint string, aq AgenticQuery) {
+	body, _ := json.Marshal(aq)
+	req := httptest.NewRequest(http.MethodPost, "/"+endpoint, bytes.NewReader(body)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	withWarnings(queryEndpoints[endpoint]).ServeHTTP(w, req)
+}
+
+// executeSavedQuery runs q against its endpoint, writing the response to w.
+func executeSavedQuery(ctx context.Context, w http.ResponseWriter, q SavedQuery) {
+	executeQuery(ctx, w, q.Endpoint, q.Query)
+}
+
+// runSavedQuery executes the named query of ctx's tenant and returns the response body, for
+// callers without an HTTP response of their own (schedules).
+func runSavedQuery(ctx context.Context, name string) ([]byte, error) {
+	q, ok := savedQueries.get(tenantName(ctx), name)
+	if !ok {
+		return nil, fmt.Errorf("no such saved query: %s", name)
+	}
+	rec := httptest.NewRecorder()
+	executeSavedQuery(ctx, rec, q)
+	body, _ := io.ReadAll(rec.Result().Body)
+	if rec.Code != http.StatusOK && rec.Code != http.StatusMultiStatus {
+		return nil, fmt.Errorf("saved query %s failed with %d: %s", name, rec.Code, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
+
+// ===== /queries API =====
+
+// listSavedQueriesHandler handles GET /queries.
+func listSavedQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	list := savedQueries.list(tenantName(r.Context()))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": list,
+		"meta": map[string]interface{}{"total": len(list), "request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// getSavedQueryHandler handles GET /queries/{name}.
+func getSavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := savedQueries.get(tenantName(r.Context()), r.PathValue("name"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such saved query: "+r.PathValue("name"), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": q})
+}
+
+// putSavedQueryHandler handles PUT /queries/{name}, creating or replacing the query.
+func putSavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var q SavedQuery
+	if !decodeJSON(w, r, &q) {
+		return
+	}
+	q.Name, q.Tenant = r.PathValue("name"), tenantName(r.Context())
+
+	var verrs ValidationErrors
+	if !queryNamePattern.MatchString(q.Name) {
+		verrs.add("name", q.Name, "must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if _, ok := queryEndpoints[q.Endpoint]; !ok {
+		verrs.add("endpoint", q.Endpoint, "must be one of allocations, cloudCosts, assets")
+	} else {
+		parseExprFilter(&verrs, "query.filters.expr", q.Query.Filters.Expr, queryRecords[q.Endpoint])
+	}
+	parseNamespaceFilter(&verrs, "query.filters.namespace", q.Query.Filters.Namespace)
+	loc := loadTimezone(&verrs, "query.filters.timezone", q.Query.Filters.Timezone)
+	if w := q.Query.Filters.Window; w != "" {
+		if _, _, err := resolveWindow(w, time.Now(), loc); err != nil {
+			verrs.add("query.filters.window", w, err.Error())
+		}
+	}
+	validateWindow(&verrs, q.Query.Filters.Start, q.Query.Filters.End)
+	validateProvider(&verrs, q.Query.Filters.Provider)
+	validateResolution(&verrs, q.Query.Filters.Resolution)
+	validateSummarize(&verrs, &q.Query.Summarize)
+	q.Query.ResponseBudget.validate(&verrs)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	saved, created, err := savedQueries.put(q)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to persist saved query", err.Error())
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		logf(r.Context(), "[MCP] Saved query %s (%s)\n", saved.Name, saved.Endpoint)
+	}
+	writeJSON(w, status, map[string]interface{}{"data": saved})
+}
+
+// deleteSavedQueryHandler handles DELETE /queries/{name}.
+func deleteSavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := savedQueries.delete(tenantName(r.Context()), r.PathValue("name"))
+	if !found {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such saved query: "+r.PathValue("name"), nil)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to persist saved queries", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runSavedQueryHandler handles POST /queries/{name}/run. An optional AgenticQuery body is
+// decoded onto the saved one, so every field it sets replaces the saved value and filters
+// merge one by one, e.g. {"filters": {"namespace": "dev"}} keeps the saved expr. The
+// response is exactly what the target endpoint returns.
+func runSavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	q, ok := savedQueries.get(tenantName(r.Context()), r.PathValue("name"))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such saved query: "+r.PathValue("name"), nil)
+		return
+	}
+	if r.ContentLength != 0 && !decodeJSON(w, r, &q.Query) {
+		return
+	}
+	logf(r.Context(), "[MCP] Running saved query %s against /%s\n", q.Name, q.Endpoint)
+	executeSavedQuery(r.Context(), w, q)
+}
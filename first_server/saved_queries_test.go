@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useSavedQueries gives the test an empty, unpersisted saved query store.
+func useSavedQueries(t *testing.T) {
+	t.Helper()
+	saved := savedQueries
+	t.Cleanup(func() { savedQueries = saved })
+	savedQueries = &savedQueryStore{items: map[savedQueryKey]*SavedQuery{}}
+}
+
+// serveSavedQuery calls h for /queries/{name} as tenant tn.
+func serveSavedQuery(h http.HandlerFunc, tn *Tenant, method, name, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/queries/"+name, strings.NewReader(body))
+	if tn != nil {
+		r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, tn))
+	}
+	r.SetPathValue("name", name)
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+func TestSavedQueryTenant(t *testing.T) {
+	useSavedQueries(t)
+	alpha := testTenant(t, "alpha", "k-alpha", roleAnalyst, "alpha")
+	beta := testTenant(t, "beta", "k-beta", roleAnalyst, "beta")
+	useTenants(t, []*Tenant{alpha, beta})
+
+	body := `{"endpoint": "allocations", "tenant": "beta", "query": {"filters": {"namespace": "alpha"}}}`
+	if w := serveSavedQuery(putSavedQueryHandler, alpha, http.MethodPut, "weekly", body); w.Code != http.StatusCreated {
+		t.Fatalf("put as alpha: status %d: %s", w.Code, w.Body)
+	}
+	if q, ok := savedQueries.get("alpha", "weekly"); !ok || q.Tenant != "alpha" {
+		t.Fatalf("alpha's query not stored under alpha: %+v", q)
+	}
+	for _, tt := range []struct {
+		h      http.HandlerFunc
+		method string
+	}{
+		{getSavedQueryHandler, http.MethodGet},
+		{deleteSavedQueryHandler, http.MethodDelete},
+		{runSavedQueryHandler, http.MethodPost},
+	} {
+		if w := serveSavedQuery(tt.h, beta, tt.method, "weekly", ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s as beta: status %d, want 404", tt.method, w.Code)
+		}
+	}
+	if got := savedQueries.list("beta"); len(got) != 0 {
+		t.Errorf("beta lists %d queries, want 0", len(got))
+	}
+
+	// Names are per tenant, so beta can save its own "weekly" without touching alpha's.
+	body = `{"endpoint": "allocations", "query": {"filters": {"namespace": "beta"}}}`
+	if w := serveSavedQuery(putSavedQueryHandler, beta, http.MethodPut, "weekly", body); w.Code != http.StatusCreated {
+		t.Fatalf("put as beta: status %d: %s", w.Code, w.Body)
+	}
+	if q, _ := savedQueries.get("alpha", "weekly"); q.Query.Filters.Namespace != "alpha" {
+		t.Errorf("beta's put changed alpha's query to %q", q.Query.Filters.Namespace)
+	}
+}
+
+func TestPutSavedQueryValidatesExpr(t *testing.T) {
+	useSavedQueries(t)
+	tests := []struct {
+		endpoint, expr string
+		want           string // part of the error, "" for accepted
+	}{
+		{"allocations", "namespace=prod AND totalCost>100", ""},
+		{"assets", "provider=AWS AND cost>50", ""},
+		{"allocations", "namespace=prod AND", "expected a field name"},
+		{"assets", "namespace=prod", "unknown field"},
+		{"cloudCosts", "totalCost>lots", "totalCost is a number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.endpoint+" "+tt.expr, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]interface{}{"endpoint": tt.endpoint, "query": map[string]interface{}{"filters": map[string]string{"expr": tt.expr}}})
+			w := serveSavedQuery(putSavedQueryHandler, nil, http.MethodPut, "q", string(body))
+			if tt.want == "" {
+				if w.Code != http.StatusCreated && w.Code != http.StatusOK {
+					t.Errorf("status %d: %s", w.Code, w.Body)
+				}
+				return
+			}
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"field":"query.filters.expr"`) || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("status %d: %s; want 400 on query.filters.expr with %q", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+}
+
+// Every field of a run's body replaces the saved one, and filters merge field by field.
+func TestRunSavedQueryOverrides(t *testing.T) {
+	useSavedQueries(t)
+	var got AgenticQuery
+	saved := queryEndpoints["allocations"]
+	t.Cleanup(func() { queryEndpoints["allocations"] = saved })
+	queryEndpoints["allocations"] = func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}
+
+	body := `{"endpoint": "allocations", "query": {"group_by": ["namespace"], "unit_costs": "namespace", "summarize": "only",
+		"filters": {"namespace": "prod", "window": "7d", "expr": "totalCost>100"}}}`
+	if w := serveSavedQuery(putSavedQueryHandler, nil, http.MethodPut, "weekly", body); w.Code != http.StatusCreated {
+		t.Fatalf("put: status %d: %s", w.Code, w.Body)
+	}
+	override := `{"group_by": ["label:team"], "delta": true, "summarize": false, "filters": {"namespace": "dev", "expr": "cpuCost>1"}}`
+	if w := serveSavedQuery(runSavedQueryHandler, nil, http.MethodPost, "weekly", override); w.Code != http.StatusOK {
+		t.Fatalf("run: status %d: %s", w.Code, w.Body)
+	}
+
+	f := got.Filters
+	if f.Namespace != "dev" || f.Expr != "cpuCost>1" || f.Window != "7d" {
+		t.Errorf("filters = %+v; want namespace dev, expr cpuCost>1 and the saved window", f)
+	}
+	if strings.Join(got.GroupBy, ",") != "label:team" || !got.Delta || got.Summarize != SummarizeOff {
+		t.Errorf("group_by %v, delta %v, summarize %v; want the override's", got.GroupBy, got.Delta, got.Summarize)
+	}
+	if got.UnitCosts == "" {
+		t.Error("unit_costs, which the override doesn't set, was dropped")
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ===== Pricing model savings =====
+//
+// GET /savings estimates what assets would cost under another pricing model. Each asset's
+// cost is converted back to its on-demand equivalent with the discount of its current model,
+// then priced at the discount of every other model. Spot is only offered for VMs and nodes;
+// reserved pricing applies to any asset. Assets without a pricing_model are taken to be
+// on-demand, and meta.assumed_on_demand counts them.
+//
+// Discounts are fractions off the on-demand price. SAVINGS_DISCOUNTS_FILE replaces the
+// built-in table, per provider if needed:
+//
+//	{
+//	  "default":   {"spot": 0.7, "reserved": 0.4},
+//	  "providers": {"GCP": {"spot": 0.6, "reserved": 0.37}}
+//	}
+
+// Pricing models.
+const (
+	PricingOnDemand = "on-demand"
+	PricingSpot     = "spot"
+	PricingReserved = "reserved"
+)
+
+// pricingModels lists the models in the order options are reported.
+var pricingModels = []string{PricingOnDemand, PricingReserved, PricingSpot}
+
+// DiscountTable maps a pricing model to its discount off on-demand; on-demand is always 0.
+type DiscountTable map[string]float64
+
+// DiscountConfig is the discount table, with per-provider overrides.
+type DiscountConfig struct {
+	Default   DiscountTable            `json:"default"`
+	Providers map[string]DiscountTable `json:"providers,omitempty"`
+}
+
+// discounts is the active configuration. The defaults are typical public list discounts.
+var discounts = DiscountConfig{Default: DiscountTable{PricingSpot: 0.7, PricingReserved: 0.4}}
+
+// loadDiscounts reads a DiscountConfig from a JSON file. An empty path keeps the defaults.
+func loadDiscounts(path string) error {
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read discounts: %w", err)
+	}
+	var cfg DiscountConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return fmt.Errorf("failed to parse discounts %s: %w", path, err)
+	}
+	if cfg.Default == nil {
+		cfg.Default = discounts.Default
+	}
+	tables := map[string]DiscountTable{"default": cfg.Default}
+	for p, t := range cfg.Providers {
+		tables["providers."+p] = t
+	}
+	for name, t := range tables {
+		for model, d := range t {
+			if model != PricingSpot && model != PricingReserved {
+				return fmt.Errorf("%s: unknown pricing model %q (want spot or reserved)", name, model)
+			}
+			if d < 0 || d >= 1 {
+				return fmt.Errorf("%s.%s: discount must be at least 0 and below 1", name, model)
+			}
+		}
+	}
+	discounts = cfg
+	log.Printf("[MCP] Loaded discounts from %s (%d provider overrides)\n", path, len(cfg.Providers))
+	return nil
+}
+
+// discount returns the discount of model for provider, falling back to the default table.
+func (c DiscountConfig) discount(provider, model string) float64 {
+	for p, t := range c.Providers {
+		if d, ok := t[model]; ok && strings.EqualFold(p, provider) {
+			return d
+		}
+	}
+	return c.Default[model]
+}
+
+// PricingOption is an asset's cost under one pricing model.
+type PricingOption struct {
+	Model      string  `json:"model"`
+	Cost       float64 `json:"cost"`
+	Savings    float64 `json:"savings"` // negative when the model is dearer
+	SavingsPct float64 `json:"savings_pct"`
+}
+
+// AssetSavings is one asset with its alternatives.
+type AssetSavings struct {
+	AssetID      string          `json:"asset_id"`
+	Name         string          `json:"name"`
+	Type         string          `json:"type"`
+	Provider     string          `json:"provider"`
+	Region       string          `json:"region"`
+	PricingModel string          `json:"pricing_model"`
+	Cost         float64         `json:"cost"`
+	OnDemandCost float64         `json:"on_demand_cost"`
+	Options      []PricingOption `json:"options"`
+	Best         *PricingOption  `json:"best"` // the largest saving, or null when none saves
+}
+
+// ModelSavings totals what moving every eligible asset to one model would save.
+type ModelSavings struct {
+	Assets  int     `json:"assets"`
+	Savings float64 `json:"savings"`
+}
+
+// SavingsReport is the data of a /savings response.
+type SavingsReport struct {
+	CurrentCost      float64                 `json:"current_cost"`
+	OnDemandCost     float64                 `json:"on_demand_cost"`
+	PotentialSavings float64                 `json:"potential_savings"` // every asset on its best option
+	ByModel          map[string]ModelSavings `json:"by_model"`
+	Assets           []AssetSavings          `json:"assets"`
+}
+
+// normalizePricingModel maps spellings such as "OnDemand" or "on_demand" to a model.
+func normalizePricingModel(m string) string {
+	switch strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(m)) {
+	case "", "ondemand":
+		return PricingOnDemand
+	case "spot", "preemptible":
+		return PricingSpot
+	case "reserved", "committed":
+		return PricingReserved
+	}
+	return ""
+}
+
+// assetSavings prices a under every model it is eligible for.
+func assetSavings(a Asset, model string) AssetSavings {
+	onDemand := a.Cost / (1 - discounts.discount(a.Provider, model))
+	s := AssetSavings{
+		AssetID: a.AssetID, Name: a.Name, Type: a.Type, Provider: a.Provider, Region: a.Region,
+		PricingModel: model, Cost: a.Cost, OnDemandCost: round2(onDemand), Options: []PricingOption{},
+	}
+	for _, m := range pricingModels {
+		if m == model || (m == PricingSpot && !isNodeAsset(a)) {
+			continue
+		}
+		cost := onDemand * (1 - discounts.discount(a.Provider, m))
+		o := PricingOption{Model: m, Cost: round2(cost), Savings: round2(a.Cost - cost)}
+		if a.Cost > 0 {
+			o.SavingsPct = round2((a.Cost - cost) / a.Cost * 100)
+		}
+		s.Options = append(s.Options, o)
+		if o.Savings > 0 && (s.Best == nil || o.Savings > s.Best.Savings) {
+			best := o
+			s.Best = &best
+		}
+	}
+	return s
+}
+
+// savingsHandler handles GET /savings.
+// Query params: provider, region, target (spot, reserved or on-demand: only that option).
+func savingsHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /savings request received")
+
+	provider := resolveAliases(r.Context(), "provider", r.URL.Query().Get("provider"))
+	region := resolveAliases(r.Context(), "region", r.URL.Query().Get("region"))
+	target := r.URL.Query().Get("target")
+
+	var verrs ValidationErrors
+	validateProvider(&verrs, provider)
+	if target != "" {
+		if target = normalizePricingModel(target); target == "" {
+			verrs.add("target", r.URL.Query().Get("target"), "must be on-demand, spot or reserved")
+		}
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, namespaceFilter{}, provider) {
+		return
+	}
+
+	assets, err := costSource.GetAssets(r.Context(), AssetFilter{Provider: provider, Region: region})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get assets", err)
+		return
+	}
+
+	report := SavingsReport{ByModel: map[string]ModelSavings{}, Assets: []AssetSavings{}}
+	assumed, unknown := 0, []string{}
+	for _, a := range assets {
+		model := normalizePricingModel(a.PricingModel)
+		if model == "" {
+			unknown = append(unknown, a.AssetID)
+			continue
+		}
+		if a.PricingModel == "" {
+			assumed++
+		}
+		s := assetSavings(a, model)
+		if target != "" {
+			kept := []PricingOption{}
+			s.Best = nil
+			for _, o := range s.Options {
+				if o.Model == target {
+					kept = append(kept, o)
+					if o.Savings > 0 {
+						best := o
+						s.Best = &best
+					}
+				}
+			}
+			s.Options = kept
+		}
+		report.CurrentCost += a.Cost
+		report.OnDemandCost += s.OnDemandCost
+		for _, o := range s.Options {
+			m := report.ByModel[o.Model]
+			m.Assets++
+			m.Savings += o.Savings
+			report.ByModel[o.Model] = m
+		}
+		if s.Best != nil {
+			report.PotentialSavings += s.Best.Savings
+		}
+		report.Assets = append(report.Assets, s)
+	}
+	for model, m := range report.ByModel {
+		m.Savings = round2(m.Savings)
+		report.ByModel[model] = m
+	}
+	report.CurrentCost, report.OnDemandCost, report.PotentialSavings = round2(report.CurrentCost), round2(report.OnDemandCost), round2(report.PotentialSavings)
+	sort.SliceStable(report.Assets, func(i, j int) bool {
+		var a, b float64
+		if report.Assets[i].Best != nil {
+			a = report.Assets[i].Best.Savings
+		}
+		if report.Assets[j].Best != nil {
+			b = report.Assets[j].Best.Savings
+		}
+		return a > b
+	})
+	logf(r.Context(), "[MCP] /savings — %d assets, potential savings %.2f\n", len(report.Assets), report.PotentialSavings)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": report,
+		"meta": map[string]interface{}{
+			"filtersUsed":       map[string]string{"provider": provider, "region": region, "target": target},
+			"discounts":         discounts,
+			"assumed_on_demand": assumed,
+			"unknown_pricing":   unknown,
+			"total":             len(report.Assets),
+			"request_id":        requestIDFrom(r.Context()),
+		},
+	})
+}
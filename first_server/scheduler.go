@@ -0,0 +1,623 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Schedules =====
+
+// ReportSpec describes the chargeback report a schedule produces. The period covered is the
+// Lookback window ending at run time.
+type ReportSpec struct {
+	By           string   `json:"by,omitempty"`           // namespace (default), team or policy
+	Policy       string   `json:"policy,omitempty"`       // allocation policy, with by=policy
+	Distribution string   `json:"distribution,omitempty"` // proportional (default), even, none
+	Shared       []string `json:"shared,omitempty"`       // shared namespaces
+	Lookback     string   `json:"lookback,omitempty"`     // e.g. "24h", "7d" (default "24h")
+	Format       string   `json:"format,omitempty"`       // json (default) or csv
+}
+
+// Destination says where a scheduled report is delivered.
+type Destination struct {
+	Type   string   `json:"type"`             // see destinationTypes
+	URL    string   `json:"url,omitempty"`    // webhook
+	To     []string `json:"to,omitempty"`     // email recipients
+	Bucket string   `json:"bucket,omitempty"` // object storage
+	Prefix string   `json:"prefix,omitempty"` // object storage key prefix, see expandKeyPrefix
+}
+
+// Schedule is a recurring report registration.
+type Schedule struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Tenant      string      `json:"tenant,omitempty"` // the creator's tenant, when tenancy is on
+	Cron        string      `json:"cron"`             // five-field cron expression, evaluated in UTC
+	Report      ReportSpec  `json:"report"`
+	Query       string      `json:"query,omitempty"` // saved query to deliver instead of a report
+	Destination Destination `json:"destination"`
+	Enabled     bool        `json:"enabled"`
+	CreatedAt   time.Time   `json:"created_at"`
+	LastRun     *time.Time  `json:"last_run,omitempty"`
+	LastStatus  string      `json:"last_status,omitempty"` // ok or error
+	LastError   string      `json:"last_error,omitempty"`
+	NextRun     *time.Time  `json:"next_run,omitempty"`
+}
+
+// Delivery is a rendered report ready to hand to a destination.
+type Delivery struct {
+	Schedule    Schedule
+	Report      ChargebackReport
+	Body        []byte
+	ContentType string
+	Filename    string
+	At          time.Time // the run time
+}
+
+// destinationType validates and delivers to one kind of destination.
+type destinationType struct {
+	validate func(d Destination, errs *ValidationErrors)
+	deliver  func(ctx context.Context, d Destination, del Delivery) error
+}
+
+// destinationTypes registers the supported destinations by Destination.Type.
+var destinationTypes = map[string]destinationType{
+	"webhook": {validate: validateWebhookDestination, deliver: deliverWebhook},
+	"s3":      {validate: validateBucketDestination, deliver: deliverToBucket},
+	"gcs":     {validate: validateBucketDestination, deliver: deliverToBucket},
+	"email":   {validate: validateEmailDestination, deliver: deliverEmail},
+}
+
+// scheduleStore keeps schedules in memory and persists them as JSON after every change.
+type scheduleStore struct {
+	mu    sync.Mutex
+	path  string
+	items map[string]*Schedule
+}
+
+var schedules = &scheduleStore{items: map[string]*Schedule{}}
+
+// load reads persisted schedules from path. A missing file starts an empty store. Schedules
+// are validated like API submissions; an invalid one (say, edited by hand) is kept but
+// disabled, with the problem as its last error. Load saved queries and policies first.
+func (s *scheduleStore) load(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.path = path
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schedules: %w", err)
+	}
+	var list []*Schedule
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return fmt.Errorf("failed to parse schedules %s: %w", path, err)
+	}
+	for _, sch := range list {
+		if verrs := normalizeSchedule(sch); len(verrs) > 0 {
+			problems := make([]string, 0, len(verrs))
+			for _, fe := range verrs {
+				problems = append(problems, fe.Field+" "+fe.Message)
+			}
+			sch.Enabled, sch.LastStatus = false, "error"
+			sch.LastError = "invalid schedule: " + strings.Join(problems, "; ")
+			log.Printf("[Scheduler] Disabled schedule %s from %s: %s\n", sch.ID, path, sch.LastError)
+		}
+		sch.NextRun = nextRun(sch, time.Now())
+		s.items[sch.ID] = sch
+	}
+	return nil
+}
+
+// saveLocked writes all schedules to disk via a temp file and rename. Callers hold s.mu.
+func (s *scheduleStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.MarshalIndent(s.listLocked(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *scheduleStore) listLocked() []Schedule {
+	list := make([]Schedule, 0, len(s.items))
+	for _, sch := range s.items {
+		list = append(list, *sch)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+func (s *scheduleStore) list() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listLocked()
+}
+
+// get returns the schedule with id if tenant owns it.
+func (s *scheduleStore) get(id, tenant string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch, ok := s.items[id]
+	if !ok || sch.Tenant != tenant {
+		return Schedule{}, false
+	}
+	return *sch, true
+}
+
+func (s *scheduleStore) put(sch Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[sch.ID] = &sch
+	return s.saveLocked()
+}
+
+func (s *scheduleStore) delete(id, tenant string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sch, ok := s.items[id]; !ok || sch.Tenant != tenant {
+		return false, nil
+	}
+	delete(s.items, id)
+	return true, s.saveLocked()
+}
+
+// recordRun stores the outcome of a run, unless the schedule was deleted meanwhile.
+func (s *scheduleStore) recordRun(id string, at time.Time, runErr error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch, ok := s.items[id]
+	if !ok {
+		return
+	}
+	sch.LastRun = &at
+	sch.LastStatus, sch.LastError = "ok", ""
+	if runErr != nil {
+		sch.LastStatus, sch.LastError = "error", runErr.Error()
+	}
+	sch.NextRun = nextRun(sch, at)
+	s.saveLocked()
+}
+
+// nextRun returns the next firing time of an enabled schedule, or nil.
+func nextRun(sch *Schedule, after time.Time) *time.Time {
+	if !sch.Enabled {
+		return nil
+	}
+	spec, err := parseCron(sch.Cron)
+	if err != nil {
+		return nil
+	}
+	next, ok := spec.Next(after.UTC())
+	if !ok {
+		return nil
+	}
+	return &next
+}
+
+// parseLookback parses a Go duration, additionally accepting whole days ("7d") and weeks ("2w").
+func parseLookback(s string) (time.Duration, error) {
+	if n := len(s); n > 1 && (s[n-1] == 'd' || s[n-1] == 'w') {
+		v, err := strconv.Atoi(s[:n-1])
+		if err != nil || v <= 0 {
+			return 0, fmt.Errorf("invalid lookback %q", s)
+		}
+		unit := 24 * time.Hour
+		if s[n-1] == 'w' {
+			unit *= 7
+		}
+		return time.Duration(v) * unit, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid lookback %q", s)
+	}
+	return d, nil
+}
+
+// normalizeSchedule fills defaults and validates a schedule submitted through the API.
+func normalizeSchedule(sch *Schedule) ValidationErrors {
+	var verrs ValidationErrors
+	if strings.TrimSpace(sch.Name) == "" {
+		verrs.add("name", "", "is required")
+	}
+	if _, err := parseCron(sch.Cron); err != nil {
+		verrs.add("cron", sch.Cron, err.Error())
+	}
+
+	rs := &sch.Report
+	if rs.By == "" && rs.Policy != "" {
+		rs.By = "policy"
+	} else if rs.By == "" {
+		rs.By = "namespace"
+	}
+	if rs.Distribution == "" {
+		rs.Distribution = DistributeProportional
+	}
+	if rs.Lookback == "" {
+		rs.Lookback = "24h"
+	}
+	if rs.Format == "" {
+		rs.Format = "json"
+	}
+	if rs.By != "namespace" && rs.By != "team" && rs.By != "policy" {
+		verrs.add("report.by", rs.By, "must be namespace, team or policy")
+	}
+	lookupPolicy(&verrs, "report.policy", rs.Policy)
+	if rs.By == "policy" && rs.Policy == "" {
+		verrs.add("report.policy", "", "is required with by=policy")
+	}
+	switch rs.Distribution {
+	case DistributeProportional, DistributeEven, DistributeNone:
+	default:
+		verrs.add("report.distribution", rs.Distribution, "must be proportional, even or none")
+	}
+	if _, err := parseLookback(rs.Lookback); err != nil {
+		verrs.add("report.lookback", rs.Lookback, "must be a duration such as 24h, 7d or 2w")
+	}
+	if rs.Format != "json" && rs.Format != "csv" {
+		verrs.add("report.format", rs.Format, "must be json or csv")
+	}
+	if sch.Query != "" {
+		if _, ok := savedQueries.get(sch.Tenant, sch.Query); !ok {
+			verrs.add("query", sch.Query, "no such saved query")
+		}
+	}
+
+	dt, ok := destinationTypes[sch.Destination.Type]
+	if !ok {
+		supported := make([]string, 0, len(destinationTypes))
+		for name := range destinationTypes {
+			supported = append(supported, name)
+		}
+		sort.Strings(supported)
+		verrs.add("destination.type", sch.Destination.Type, "must be one of "+strings.Join(supported, ", "))
+	} else {
+		dt.validate(sch.Destination, &verrs)
+	}
+	return verrs
+}
+
+// renderScheduledReport builds the report for the lookback window ending at now, or runs
+// the schedule's saved query.
+func renderScheduledReport(ctx context.Context, sch Schedule, now time.Time) (Delivery, error) {
+	stamp := now.UTC().Format("20060102-1504")
+	if sch.Query != "" {
+		body, err := runSavedQuery(ctx, sch.Query)
+		if err != nil {
+			return Delivery{}, err
+		}
+		return Delivery{Schedule: sch, Body: body, ContentType: "application/json",
+			Filename: fmt.Sprintf("%s-%s-%s.json", sch.ID, sch.Query, stamp), At: now}, nil
+	}
+
+	lookback, _ := parseLookback(sch.Report.Lookback)
+	start := now.Add(-lookback).UTC().Format(time.RFC3339)
+	end := now.UTC().Format(time.RFC3339)
+
+	var policy *AllocationPolicy
+	if sch.Report.By == "policy" {
+		p, ok := policies.get(sch.Report.Policy)
+		if !ok {
+			return Delivery{}, fmt.Errorf("no such policy: %s", sch.Report.Policy)
+		}
+		policy = &p
+	}
+	data, err := costSource.GetAllocations(ctx, AllocationFilter{Start: start, End: end})
+	if err != nil {
+		return Delivery{}, err
+	}
+	report := buildChargebackReport(data, sch.Report.By, sch.Report.Distribution, sch.Report.Shared, policy)
+	report.Start, report.End, report.Policy = start, end, sch.Report.Policy
+
+	del := Delivery{Schedule: sch, Report: report, At: now}
+	var buf bytes.Buffer
+	if sch.Report.Format == "csv" {
+		renderReportCSV(&buf, report)
+		del.ContentType, del.Filename = "text/csv", fmt.Sprintf("%s-%s.csv", sch.ID, stamp)
+	} else {
+		json.NewEncoder(&buf).Encode(report)
+		del.ContentType, del.Filename = "application/json", fmt.Sprintf("%s-%s.json", sch.ID, stamp)
+	}
+	del.Body = buf.Bytes()
+	return del, nil
+}
+
+// scheduleContext scopes ctx to the schedule's tenant, so the report covers only what that
+// tenant may see. With tenancy on, a schedule without a known tenant doesn't run.
+func scheduleContext(ctx context.Context, sch Schedule) (context.Context, error) {
+	if tenants == nil {
+		return ctx, nil
+	}
+	t := tenantByName(sch.Tenant)
+	if t == nil {
+		return ctx, fmt.Errorf("schedule %s belongs to no configured tenant (%q)", sch.ID, sch.Tenant)
+	}
+	return context.WithValue(ctx, tenantKey{}, t), nil
+}
+
+// runSchedule renders and delivers one schedule, recording the outcome.
+func runSchedule(sch Schedule, now time.Time) error {
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "sched-"+sch.ID+"-"+newRequestID()[:6])
+	logf(ctx, "[Scheduler] Running schedule %s (%s)\n", sch.ID, sch.Name)
+
+	var del Delivery
+	ctx, err := scheduleContext(ctx, sch)
+	if err == nil {
+		del, err = renderScheduledReport(ctx, sch, now)
+	}
+	if err == nil {
+		if dt, ok := destinationTypes[sch.Destination.Type]; ok {
+			err = dt.deliver(ctx, sch.Destination, del)
+		} else {
+			err = fmt.Errorf("unknown destination type %q", sch.Destination.Type)
+		}
+	}
+	if err != nil {
+		logf(ctx, "[Scheduler] Schedule %s failed: %v\n", sch.ID, err)
+	} else {
+		logf(ctx, "[Scheduler] Schedule %s delivered %d bytes via %s\n", sch.ID, len(del.Body), sch.Destination.Type)
+	}
+	schedules.recordRun(sch.ID, now, err)
+	return err
+}
+
+// startScheduler fires due schedules at the top of every minute until ctx is cancelled.
+func startScheduler(ctx context.Context) {
+	go func() {
+		for {
+			now := time.Now().UTC()
+			wait := now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+			select {
+			case <-ctx.Done():
+				return
+			case tick := <-time.After(wait):
+				tick = tick.UTC().Truncate(time.Minute)
+				for _, sch := range schedules.list() {
+					spec, err := parseCron(sch.Cron)
+					if err != nil || !sch.Enabled || !spec.Matches(tick) {
+						continue
+					}
+					go runSchedule(sch, tick)
+				}
+			}
+		}
+	}()
+}
+
+// ===== Destinations =====
+
+func validateWebhookDestination(d Destination, errs *ValidationErrors) {
+	if !strings.HasPrefix(d.URL, "http://") && !strings.HasPrefix(d.URL, "https://") {
+		errs.add("destination.url", d.URL, "must be an http(s) URL")
+	}
+}
+
+// deliverWebhook POSTs the rendered report to the destination URL.
+func deliverWebhook(ctx context.Context, d Destination, del Delivery) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(del.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", del.ContentType)
+	req.Header.Set("Content-Disposition", `attachment; filename="`+del.Filename+`"`)
+	req.Header.Set("X-Schedule-ID", del.Schedule.ID)
+	req.Header.Set(requestIDHeader, requestIDFrom(ctx))
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// keyPlaceholders expand in object storage prefixes, from the run time (UTC) and schedule.
+var keyPlaceholders = map[string]func(sch Schedule, at time.Time) string{
+	"{date}":  func(_ Schedule, at time.Time) string { return at.Format("2006-01-02") },
+	"{year}":  func(_ Schedule, at time.Time) string { return at.Format("2006") },
+	"{month}": func(_ Schedule, at time.Time) string { return at.Format("01") },
+	"{day}":   func(_ Schedule, at time.Time) string { return at.Format("02") },
+	"{hour}":  func(_ Schedule, at time.Time) string { return at.Format("15") },
+	"{id}":    func(sch Schedule, _ time.Time) string { return sch.ID },
+	"{name}":  func(sch Schedule, _ time.Time) string { return slugify(sch.Name) },
+}
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// expandKeyPrefix fills the placeholders of an object storage prefix, e.g.
+// "reports/{name}/{year}/{month}" becomes "reports/weekly-chargeback/2025/08". Unknown
+// placeholders, which validation rejects, are left as they are.
+func expandKeyPrefix(prefix string, sch Schedule, at time.Time) string {
+	return placeholderPattern.ReplaceAllStringFunc(prefix, func(p string) string {
+		expand, ok := keyPlaceholders[p]
+		if !ok {
+			return p
+		}
+		return expand(sch, at.UTC())
+	})
+}
+
+// slugify lowercases s and turns runs of anything but letters and digits into a dash, so a
+// schedule name is safe in an object key.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func validateBucketDestination(d Destination, errs *ValidationErrors) {
+	if d.Bucket == "" || strings.ContainsAny(d.Bucket, "/ ") {
+		errs.add("destination.bucket", d.Bucket, "must be a bucket name")
+	}
+	for _, p := range placeholderPattern.FindAllString(d.Prefix, -1) {
+		if _, ok := keyPlaceholders[p]; !ok {
+			errs.add("destination.prefix", d.Prefix, "unknown placeholder "+p+"; use {date}, {year}, {month}, {day}, {hour}, {id} or {name}")
+		}
+	}
+	if d.Type == "s3" && !awsCredentialsConfigured() {
+		errs.add("destination.type", d.Type, "AWS credentials are not configured on the server")
+	}
+}
+
+// deliverToBucket writes the rendered report to S3 or GCS as <prefix>/<filename>.
+func deliverToBucket(ctx context.Context, d Destination, del Delivery) error {
+	scheme := "s3://"
+	if d.Type == "gcs" {
+		scheme = "gs://"
+	}
+	w, err := newObjectWriter(scheme + d.Bucket + "/" + strings.Trim(expandKeyPrefix(d.Prefix, del.Schedule, del.At), "/"))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	if err := w.put(ctx, del.Filename, del.Body, del.ContentType); err != nil {
+		return err
+	}
+	logf(ctx, "[Scheduler] Wrote %s\n", w.location(del.Filename))
+	return nil
+}
+
+// ===== /schedules API =====
+
+// decodeSchedule reads and validates a schedule body, writing the error response on failure.
+// The schedule belongs to the caller's tenant.
+func decodeSchedule(w http.ResponseWriter, r *http.Request) (Schedule, bool) {
+	sch := Schedule{Enabled: true}
+	if !decodeJSON(w, r, &sch) {
+		return sch, false
+	}
+	sch.Tenant = tenantName(r.Context())
+	if verrs := normalizeSchedule(&sch); len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return sch, false
+	}
+	return sch, true
+}
+
+// listSchedulesHandler handles GET /schedules, listing the caller's tenant's schedules.
+func listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := tenantName(r.Context())
+	list := []Schedule{}
+	for _, sch := range schedules.list() {
+		if sch.Tenant == tenant {
+			list = append(list, sch)
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": list,
+		"meta": map[string]interface{}{"total": len(list), "request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// createScheduleHandler handles POST /schedules.
+func createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	sch, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	sch.ID = "sch-" + newRequestID()[:8]
+	sch.CreatedAt = time.Now().UTC()
+	sch.LastRun, sch.LastStatus, sch.LastError = nil, "", ""
+	sch.NextRun = nextRun(&sch, time.Now())
+	if err := schedules.put(sch); err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to persist schedule", err.Error())
+		return
+	}
+	logf(r.Context(), "[MCP] Created schedule %s (%s, %q)\n", sch.ID, sch.Name, sch.Cron)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"data": sch})
+}
+
+// getScheduleHandler handles GET /schedules/{id}.
+func getScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	sch, ok := schedules.get(r.PathValue("id"), tenantName(r.Context()))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such schedule: "+r.PathValue("id"), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": sch})
+}
+
+// updateScheduleHandler handles PUT /schedules/{id}, replacing the definition but keeping
+// its ID, creation time and run history.
+func updateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	existing, ok := schedules.get(r.PathValue("id"), tenantName(r.Context()))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such schedule: "+r.PathValue("id"), nil)
+		return
+	}
+	sch, ok := decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	sch.ID, sch.CreatedAt = existing.ID, existing.CreatedAt
+	sch.LastRun, sch.LastStatus, sch.LastError = existing.LastRun, existing.LastStatus, existing.LastError
+	sch.NextRun = nextRun(&sch, time.Now())
+	if err := schedules.put(sch); err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to persist schedule", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": sch})
+}
+
+// deleteScheduleHandler handles DELETE /schedules/{id}.
+func deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	found, err := schedules.delete(r.PathValue("id"), tenantName(r.Context()))
+	if !found {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such schedule: "+r.PathValue("id"), nil)
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, ErrCodeInternal, "Failed to persist schedules", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runScheduleHandler handles POST /schedules/{id}/run, delivering the report immediately.
+func runScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	sch, ok := schedules.get(r.PathValue("id"), tenantName(r.Context()))
+	if !ok {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such schedule: "+r.PathValue("id"), nil)
+		return
+	}
+	if err := runSchedule(sch, time.Now().UTC()); err != nil {
+		writeBackendError(w, r, "Schedule run failed", err)
+		return
+	}
+	sch, _ = schedules.get(sch.ID, sch.Tenant)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": sch})
+}
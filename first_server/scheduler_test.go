@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLookback(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration // 0 for rejected
+	}{
+		{"12h", 12 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"7d", 7 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"", 0},
+		{"d", 0},
+		{"0d", 0},
+		{"-1d", 0},
+		{"1.5d", 0},
+		{"0h", 0},
+		{"-2h", 0},
+		{"7", 0},
+		{"week", 0},
+	}
+	for _, tt := range tests {
+		got, err := parseLookback(tt.in)
+		if got != tt.want || (err != nil) != (tt.want == 0) {
+			t.Errorf("parseLookback(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+// staticSource serves fixed allocations and assets.
+type staticSource struct {
+	allocations []Allocation
+	assets      []Asset
+}
+
+func (s staticSource) GetCloudCosts(context.Context, CloudCostFilter) ([]CloudCost, error) {
+	return nil, nil
+}
+func (s staticSource) GetAllocations(context.Context, AllocationFilter) ([]Allocation, error) {
+	return s.allocations, nil
+}
+func (s staticSource) GetAssets(context.Context, AssetFilter) ([]Asset, error) {
+	return s.assets, nil
+}
+
+// A schedule runs with its creator's tenant and is invisible to other tenants.
+func TestScheduleTenant(t *testing.T) {
+	alpha := testTenant(t, "alpha", "k-alpha", roleAnalyst, "alpha")
+	beta := testTenant(t, "beta", "k-beta", roleAnalyst, "beta")
+	useTenants(t, []*Tenant{alpha, beta})
+	savedSource, savedSchedules := costSource, schedules
+	t.Cleanup(func() { costSource, schedules = savedSource, savedSchedules })
+	costSource = &tenantSource{inner: staticSource{allocations: []Allocation{
+		{Namespace: "alpha", TotalCost: 10},
+		{Namespace: "beta", TotalCost: 20},
+	}}}
+	schedules = &scheduleStore{items: map[string]*Schedule{}}
+
+	var delivered []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report ChargebackReport
+		json.NewDecoder(r.Body).Decode(&report)
+		for _, line := range report.Lines {
+			delivered = append(delivered, line.Name)
+		}
+	}))
+	defer hook.Close()
+
+	serve := func(h http.HandlerFunc, tn *Tenant, method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, tn))
+		if i := strings.LastIndex(path, "/sch-"); i >= 0 {
+			r.SetPathValue("id", strings.TrimSuffix(path[i+1:], "/run"))
+		}
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	// The body claims tenant beta; the owner still comes from the caller.
+	w := serve(createScheduleHandler, alpha, http.MethodPost, "/schedules",
+		`{"name": "daily", "cron": "0 6 * * *", "tenant": "beta", "destination": {"type": "webhook", "url": "`+hook.URL+`"}}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	var created struct{ Data Schedule }
+	json.Unmarshal(w.Body.Bytes(), &created)
+	id := created.Data.ID
+	if created.Data.Tenant != "alpha" {
+		t.Errorf("schedule tenant = %q, want alpha", created.Data.Tenant)
+	}
+
+	if w := serve(runScheduleHandler, alpha, http.MethodPost, "/schedules/"+id+"/run", ""); w.Code != http.StatusOK {
+		t.Fatalf("run: status %d: %s", w.Code, w.Body)
+	}
+	if got := strings.Join(delivered, ","); got != "alpha" {
+		t.Errorf("delivered groups %q, want alpha only", got)
+	}
+
+	for _, tt := range []struct {
+		h            http.HandlerFunc
+		method, path string
+	}{
+		{getScheduleHandler, http.MethodGet, "/schedules/" + id},
+		{updateScheduleHandler, http.MethodPut, "/schedules/" + id},
+		{deleteScheduleHandler, http.MethodDelete, "/schedules/" + id},
+		{runScheduleHandler, http.MethodPost, "/schedules/" + id + "/run"},
+	} {
+		if w := serve(tt.h, beta, tt.method, tt.path, `{"name": "mine", "cron": "0 6 * * *", "destination": {"type": "webhook", "url": "`+hook.URL+`"}}`); w.Code != http.StatusNotFound {
+			t.Errorf("%s %s as beta: status %d, want 404", tt.method, tt.path, w.Code)
+		}
+	}
+	var list struct{ Data []Schedule }
+	json.Unmarshal(serve(listSchedulesHandler, beta, http.MethodGet, "/schedules", "").Body.Bytes(), &list)
+	if len(list.Data) != 0 {
+		t.Errorf("beta lists %d schedules, want 0", len(list.Data))
+	}
+
+	// A schedule whose tenant was removed from TENANTS_FILE doesn't run unscoped.
+	orphan := created.Data
+	orphan.Tenant = "gone"
+	delivered = nil
+	if err := runSchedule(orphan, time.Now()); err == nil || delivered != nil {
+		t.Errorf("orphaned schedule ran: error %v, delivered %v", err, delivered)
+	}
+}
+
+// Schedules edited by hand into something the API would refuse are loaded disabled, and
+// running one anyway fails instead of panicking.
+func TestScheduleLoadValidates(t *testing.T) {
+	savedSource, savedSchedules := costSource, schedules
+	t.Cleanup(func() { costSource, schedules = savedSource, savedSchedules })
+	costSource = staticSource{}
+	schedules = &scheduleStore{items: map[string]*Schedule{}}
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	file := `[
+  {"id": "sch-ok", "name": "ok", "cron": "0 6 * * *", "enabled": true, "destination": {"type": "webhook", "url": "http://example.com"}},
+  {"id": "sch-prefix", "name": "prefix", "cron": "0 6 * * *", "enabled": true, "destination": {"type": "gcs", "bucket": "b", "prefix": "{week}"}},
+  {"id": "sch-type", "name": "type", "cron": "0 6 * * *", "enabled": true, "destination": {"type": "ftp"}}
+]`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := schedules.load(path); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id, lastError string // part of the last error, "" for a valid schedule
+	}{
+		{"sch-ok", ""},
+		{"sch-prefix", "unknown placeholder {week}"},
+		{"sch-type", "must be one of"},
+	}
+	for _, tt := range tests {
+		sch, ok := schedules.get(tt.id, "")
+		if !ok {
+			t.Fatalf("%s was not loaded", tt.id)
+		}
+		if tt.lastError == "" {
+			if !sch.Enabled || sch.NextRun == nil || sch.LastError != "" {
+				t.Errorf("%s: enabled %v, next run %v, last error %q", tt.id, sch.Enabled, sch.NextRun, sch.LastError)
+			}
+			continue
+		}
+		if sch.Enabled || sch.NextRun != nil || !strings.Contains(sch.LastError, tt.lastError) {
+			t.Errorf("%s: enabled %v, next run %v, last error %q; want disabled with %q", tt.id, sch.Enabled, sch.NextRun, sch.LastError, tt.lastError)
+		}
+	}
+
+	sch, _ := schedules.get("sch-type", "")
+	if err := runSchedule(sch, time.Now()); err == nil || !strings.Contains(err.Error(), `unknown destination type "ftp"`) {
+		t.Errorf("running an unknown destination: %v", err)
+	}
+	at := time.Date(2025, 8, 4, 6, 0, 0, 0, time.UTC)
+	if got := expandKeyPrefix("r/{week}/{date}", sch, at); got != "r/{week}/2025-08-04" {
+		t.Errorf("expandKeyPrefix = %q", got)
+	}
+}
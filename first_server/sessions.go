@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Session is the server-side state of one conversation.
+type Session struct {
+	ID               string                  `json:"session_id"`
+	Queries          []string                `json:"conversation_context"`
+	EffectiveFilters map[string]QueryFilters `json:"effective_filters"` // last filters sent to each endpoint
+	LastEndpoint     string                  `json:"last_endpoint,omitempty"`
+	ForkedFrom       string                  `json:"forked_from,omitempty"` // the session this one was forked from
+	QueryLog         []QueryRecord           `json:"query_log,omitempty"`   // the latest requests, for feedback
+	Feedback         []QueryFeedback         `json:"feedback,omitempty"`    // see feedback.go
+	CreatedAt        time.Time               `json:"created_at"`
+	LastActivity     time.Time               `json:"last_activity"`
+	Requests         int                     `json:"requests"`        // every request, with or without query text
+	EndpointCounts   map[string]int          `json:"endpoint_counts"` // requests per endpoint
+
+	tenant string // the tenant that owns it, "" when tenancy is off
+}
+
+// newSession returns an empty session of tenant created now.
+func newSession(id, tenant string) *Session {
+	now := time.Now().UTC()
+	return &Session{ID: id, Queries: []string{}, EffectiveFilters: map[string]QueryFilters{}, CreatedAt: now, LastActivity: now,
+		EndpointCounts: map[string]int{}, tenant: tenant}
+}
+
+// sessions stores query histories per session to enable multi-turn conversational context.
+var (
+	sessions   = make(map[string]*Session)
+	sessionsMu sync.Mutex
+)
+
+// sessionTenantLocked returns the tenant that owns session id, from the session or its
+// snapshots, and whether the session exists. Callers hold sessionsMu.
+func sessionTenantLocked(id string) (string, bool) {
+	if s, ok := sessions[id]; ok {
+		return s.tenant, true
+	}
+	return snapshots.tenant(id)
+}
+
+// checkSessionTenant answers 404 and returns false when session id belongs to another tenant,
+// so tenants can neither read nor extend each other's sessions. An unused ID is free to take.
+func checkSessionTenant(w http.ResponseWriter, r *http.Request, id string) bool {
+	if id == "" {
+		return true
+	}
+	sessionsMu.Lock()
+	owner, ok := sessionTenantLocked(id)
+	sessionsMu.Unlock()
+	if ok && owner != tenantName(r.Context()) {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such session: "+id, nil)
+		return false
+	}
+	return true
+}
+
+// recordQuery appends queryText to the session's history, remembers the filters sent to
+// endpoint and logs the request under its ID, and returns the previous query and the updated
+// history. Empty session IDs leave the store untouched; empty queries only update the filters.
+func recordQuery(ctx context.Context, sessionID, endpoint, queryText string, filters QueryFilters) (previous string, history []string) {
+	history = []string{}
+	if sessionID == "" {
+		return "", history
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[sessionID]
+	if !ok {
+		s = newSession(sessionID, tenantName(ctx))
+		sessions[sessionID] = s
+	}
+	s.LastActivity = time.Now().UTC()
+	s.Requests++
+	s.EndpointCounts[endpoint]++
+	s.EffectiveFilters[endpoint] = filters
+	s.LastEndpoint = endpoint
+	if id := requestIDFrom(ctx); id != "" {
+		s.QueryLog = append(s.QueryLog, QueryRecord{RequestID: id, Endpoint: endpoint, Query: queryText, Filters: filters, At: s.LastActivity})
+		if len(s.QueryLog) > maxQueryLog {
+			s.QueryLog = s.QueryLog[len(s.QueryLog)-maxQueryLog:]
+		}
+	}
+	if queryText == "" {
+		return "", history
+	}
+	if len(s.Queries) > 0 {
+		previous = s.Queries[len(s.Queries)-1]
+	}
+	s.Queries = append(s.Queries, queryText)
+	return previous, append(history, s.Queries...)
+}
+
+// rememberWindow replaces the window of the filters the session last sent to endpoint with
+// the start and end it resolved to, so later references to it ("the previous period") mean
+// the same span.
+func rememberWindow(sessionID, endpoint, start, end string) {
+	if sessionID == "" || start == "" || end == "" {
+		return
+	}
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	s, ok := sessions[sessionID]
+	if !ok {
+		return
+	}
+	if f, ok := s.EffectiveFilters[endpoint]; ok {
+		f.Window, f.Start, f.End = "", start, end
+		s.EffectiveFilters[endpoint] = f
+	}
+}
+
+// SessionStats is the optional meta.session_stats block, letting agents reason about how old
+// and how busy their session is.
+type SessionStats struct {
+	Requests      int            `json:"requests"`
+	Queries       int            `json:"queries"`
+	Endpoints     map[string]int `json:"endpoints"` // requests per endpoint
+	FirstActivity time.Time      `json:"first_activity"`
+	LastActivity  time.Time      `json:"last_activity"`
+	AgeSeconds    int64          `json:"age_seconds"`
+	RatePerMinute float64        `json:"rate_per_minute"` // requests per minute over the session's age
+	Snapshots     int            `json:"snapshots"`
+}
+
+// sessionStats returns the stats of a session, or nil for an unknown one.
+func sessionStats(sessionID string, now time.Time) *SessionStats {
+	sessionsMu.Lock()
+	s, ok := sessions[sessionID]
+	if !ok {
+		sessionsMu.Unlock()
+		return nil
+	}
+	st := &SessionStats{
+		Requests:      s.Requests,
+		Queries:       len(s.Queries),
+		Endpoints:     make(map[string]int, len(s.EndpointCounts)),
+		FirstActivity: s.CreatedAt,
+		LastActivity:  s.LastActivity,
+		AgeSeconds:    int64(now.Sub(s.CreatedAt).Seconds()),
+	}
+	for endpoint, n := range s.EndpointCounts {
+		st.Endpoints[endpoint] = n
+	}
+	sessionsMu.Unlock()
+	// A session younger than a minute is rated as if it were a minute old
+	st.RatePerMinute = round2(float64(st.Requests) / math.Max(now.Sub(st.FirstActivity).Minutes(), 1))
+	st.Snapshots = len(snapshots.list(sessionID))
+	return st
+}
+
+// addSessionStats sets meta.session_stats on resp when requested for a known session.
+func addSessionStats(resp map[string]interface{}, sessionID string, requested bool) {
+	if !requested || sessionID == "" {
+		return
+	}
+	if meta, ok := resp["meta"].(map[string]interface{}); ok {
+		if st := sessionStats(sessionID, time.Now().UTC()); st != nil {
+			meta["session_stats"] = st
+		}
+	}
+}
+
+// ===== Export and import =====
+
+// sessionExportVersion is bumped when SessionExport changes incompatibly.
+const sessionExportVersion = 1
+
+// SessionExport is everything needed to continue a session on another server: its queries,
+// effective filters and result snapshots.
+type SessionExport struct {
+	Version             int                     `json:"version"`
+	SessionID           string                  `json:"session_id"`
+	ExportedAt          time.Time               `json:"exported_at"`
+	ConversationContext []string                `json:"conversation_context"`
+	EffectiveFilters    map[string]QueryFilters `json:"effective_filters"`
+	LastEndpoint        string                  `json:"last_endpoint,omitempty"`
+	Snapshots           []Snapshot              `json:"snapshots,omitempty"`
+}
+
+// exportSessionHandler handles GET /sessions/{session_id}/export.
+func exportSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("session_id")
+	if !checkSessionTenant(w, r, id) {
+		return
+	}
+	exp := SessionExport{
+		Version:             sessionExportVersion,
+		SessionID:           id,
+		ExportedAt:          time.Now().UTC(),
+		ConversationContext: []string{},
+		EffectiveFilters:    map[string]QueryFilters{},
+		Snapshots:           snapshots.list(id),
+	}
+	sessionsMu.Lock()
+	s, ok := sessions[id]
+	if ok {
+		exp.ConversationContext = append(exp.ConversationContext, s.Queries...)
+		for endpoint, f := range s.EffectiveFilters {
+			exp.EffectiveFilters[endpoint] = f
+		}
+		exp.LastEndpoint = s.LastEndpoint
+	}
+	sessionsMu.Unlock()
+	if !ok && len(exp.Snapshots) == 0 {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such session: "+id, nil)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "session-"+sessionFileName(id)))
+	writeJSON(w, http.StatusOK, exp)
+}
+
+// importSessionHandler handles POST /sessions/import with a SessionExport body. The session
+// keeps its exported ID unless session_id is given; an existing session is only overwritten
+// with replace=true, and only by its own tenant. The import belongs to the caller's tenant.
+func importSessionHandler(w http.ResponseWriter, r *http.Request) {
+	var exp SessionExport
+	if !decodeJSON(w, r, &exp) {
+		return
+	}
+	id := exp.SessionID
+	if v := r.URL.Query().Get("session_id"); v != "" {
+		id = v
+	}
+
+	var verrs ValidationErrors
+	if exp.Version != sessionExportVersion {
+		verrs.add("version", fmt.Sprint(exp.Version), fmt.Sprintf("must be %d", sessionExportVersion))
+	}
+	if id == "" {
+		verrs.add("session_id", "", "is required in the body or query")
+	}
+	for endpoint, f := range exp.EffectiveFilters {
+		parseNamespaceFilter(&verrs, "effective_filters."+endpoint+".namespace", f.Namespace)
+		validateWindow(&verrs, f.Start, f.End)
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	replace := r.URL.Query().Get("replace") == "true"
+	tenant := tenantName(r.Context())
+	sessionsMu.Lock()
+	owner, exists := sessionTenantLocked(id)
+	if exists && owner != tenant {
+		sessionsMu.Unlock()
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such session: "+id, nil)
+		return
+	}
+	if exists && !replace {
+		sessionsMu.Unlock()
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "session already exists: "+id+"; pass replace=true to overwrite", nil)
+		return
+	}
+	s := newSession(id, tenant)
+	if exp.ConversationContext != nil {
+		s.Queries = exp.ConversationContext
+	}
+	if exp.EffectiveFilters != nil {
+		s.EffectiveFilters = exp.EffectiveFilters
+	}
+	s.LastEndpoint = exp.LastEndpoint
+	sessions[id] = s
+	sessionsMu.Unlock()
+
+	if err := snapshots.replace(id, tenant, exp.Snapshots); err != nil {
+		logf(r.Context(), "[MCP] Persisting imported snapshots for session %s failed: %v\n", id, err)
+	}
+	logf(r.Context(), "[MCP] Imported session %s (%d queries, %d snapshots)\n", id, len(s.Queries), len(exp.Snapshots))
+
+	status := http.StatusCreated
+	if exists {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"data": map[string]interface{}{
+			"session_id": id,
+			"queries":    len(s.Queries),
+			"endpoints":  len(s.EffectiveFilters),
+			"snapshots":  len(exp.Snapshots),
+			"replaced":   exists,
+		},
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
+
+// ===== Forking =====
+
+// forkSessionHandler handles POST /sessions/{session_id}/fork: a new session starts with a
+// copy of the session's queries, effective filters and snapshots (not its feedback), so an agent can follow a
+// tangent ("what if we look at dev instead?") without adding to the main conversation. The
+// fork is named by to=, or gets a generated ID; an existing session is never overwritten.
+// Only the session's own tenant can fork it, and the fork belongs to that tenant too.
+func forkSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("session_id")
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		to = id + "-fork-" + newRequestID()[:8]
+	}
+	tenant := tenantName(r.Context())
+	if to == id {
+		writeValidationError(w, r, ValidationErrors{{Field: "to", Value: to, Message: "must differ from the session being forked"}})
+		return
+	}
+	forked := snapshots.list(id)
+
+	sessionsMu.Lock()
+	s, ok := sessions[id]
+	if owner, exists := sessionTenantLocked(id); !exists || owner != tenant {
+		sessionsMu.Unlock()
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "no such session: "+id, nil)
+		return
+	}
+	if _, exists := sessionTenantLocked(to); exists {
+		sessionsMu.Unlock()
+		writeError(w, r, http.StatusConflict, ErrCodeConflict, "session already exists: "+to, nil)
+		return
+	}
+	fork := newSession(to, tenant)
+	fork.ForkedFrom = id
+	if ok {
+		fork.Queries = append(fork.Queries, s.Queries...)
+		for endpoint, f := range s.EffectiveFilters {
+			fork.EffectiveFilters[endpoint] = f
+		}
+		fork.LastEndpoint = s.LastEndpoint
+		fork.QueryLog = append(fork.QueryLog, s.QueryLog...)
+	}
+	sessions[to] = fork
+	sessionsMu.Unlock()
+
+	for i := range forked {
+		forked[i].SessionID = to
+	}
+	if err := snapshots.replace(to, tenant, forked); err != nil {
+		logf(r.Context(), "[MCP] Persisting forked snapshots for session %s failed: %v\n", to, err)
+	}
+	logf(r.Context(), "[MCP] Forked session %s into %s (%d queries, %d snapshots)\n", id, to, len(fork.Queries), len(forked))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"data": map[string]interface{}{
+			"session_id":  to,
+			"forked_from": id,
+			"queries":     len(fork.Queries),
+			"endpoints":   len(fork.EffectiveFilters),
+			"snapshots":   len(forked),
+		},
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import "context"
+
+// ===== Share of total =====
+//
+// Aggregated answers (group_by groups, per-namespace time series and /costs/by-team) give
+// every group two shares, so "prod is 62% of spend" comes straight from the API:
+//
+//	share_pct           of the filtered total, i.e. of everything in the response
+//	share_of_total_pct  of the grand total: all cost in the window before the namespace, expr
+//	                    or team filters (still only the caller's tenant)
+//
+// meta.filtered_total and meta.grand_total carry the two totals.
+
+// sharePct is part as a percentage of total, or zero when there is no total.
+func sharePct(part, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return round2(100 * part / total)
+}
+
+// sumTotalCost adds up the total cost of allocs.
+func sumTotalCost(allocs []Allocation) float64 {
+	var sum float64
+	for _, a := range allocs {
+		sum += a.TotalCost
+	}
+	return sum
+}
+
+// grandTotal is the cost of every allocation in [start, end]. When the response wasn't
+// narrowed that is just the filtered records; otherwise the window is fetched again
+// unfiltered.
+func grandTotal(ctx context.Context, filtered []Allocation, narrowed bool, start, end string) (float64, error) {
+	if !narrowed {
+		return sumTotalCost(filtered), nil
+	}
+	all, err := costSource.GetAllocations(ctx, AllocationFilter{Start: start, End: end})
+	if err != nil {
+		return 0, err
+	}
+	startTime, _ := parseDate(start)
+	endTime, _ := parseDate(end)
+	var sum float64
+	for _, a := range all {
+		if inWindow(a, startTime, endTime) {
+			sum += a.TotalCost
+		}
+	}
+	return sum, nil
+}
+
+// setGroupShares fills in the shares of groups and all their sub-groups.
+func setGroupShares(groups []CostGroup, filtered, grand float64) {
+	for i := range groups {
+		groups[i].SharePct = sharePct(groups[i].TotalCost, filtered)
+		groups[i].ShareOfTotalPct = sharePct(groups[i].TotalCost, grand)
+		setGroupShares(groups[i].Groups, filtered, grand)
+	}
+}
+
+// setSeriesShares fills in the shares of per-namespace series.
+func setSeriesShares(series []NamespaceSeries, grand float64) {
+	var filtered float64
+	for _, s := range series {
+		filtered += s.TotalCost
+	}
+	for i := range series {
+		series[i].SharePct = sharePct(series[i].TotalCost, filtered)
+		series[i].ShareOfTotalPct = sharePct(series[i].TotalCost, grand)
+	}
+}
+
+// shareMeta records the totals the shares were taken of.
+func shareMeta(meta map[string]interface{}, filtered, grand float64) {
+	meta["filtered_total"] = round2(filtered)
+	meta["grand_total"] = round2(grand)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// ===== Shared cost distribution =====
+//
+// Cluster overhead such as kube-system or monitoring is paid for by the namespaces running on
+// the cluster. SHARED_NAMESPACES lists those namespaces, and SHARED_COST_DISTRIBUTION says
+// how their cost is spread across the others: proportional (to each namespace's own cost in
+// the bucket, the default), even, or none.
+//
+// The time series of /allocations (resolution=day or hour) applies it on the fly: shared
+// namespaces drop out of the series and every other point carries its share in shared_cost,
+// included in total_cost. The distribution parameter overrides the configured one per request,
+// and a query matching only shared namespaces shows them undistributed. /reports uses the same
+// namespaces and distribution unless shared= or distribution= is given. Raw allocation records
+// are never changed.
+
+// SharedCostConfig is the configured shared-cost distribution.
+type SharedCostConfig struct {
+	Namespaces   []string
+	Distribution string
+}
+
+// sharedCosts is the active configuration, loaded once at startup.
+var sharedCosts = SharedCostConfig{Namespaces: []string{}, Distribution: DistributeProportional}
+
+// SharedCostReport is meta.shared_costs on a distributed time series.
+type SharedCostReport struct {
+	Namespaces   []string `json:"namespaces"`
+	Distribution string   `json:"distribution"`
+	Total        float64  `json:"total"`
+}
+
+// loadSharedCostConfig reads SHARED_NAMESPACES and SHARED_COST_DISTRIBUTION.
+func loadSharedCostConfig() error {
+	sharedCosts.Namespaces = splitList(os.Getenv("SHARED_NAMESPACES"))
+	if d := strings.ToLower(os.Getenv("SHARED_COST_DISTRIBUTION")); d != "" {
+		if !validDistribution(d) {
+			return fmt.Errorf("unknown SHARED_COST_DISTRIBUTION %q (want proportional, even or none)", d)
+		}
+		sharedCosts.Distribution = d
+	}
+	return nil
+}
+
+// anyDirect reports whether some of allocs are outside the shared namespaces, so there is
+// something to distribute onto.
+func (c SharedCostConfig) anyDirect(allocs []Allocation) bool {
+	if len(c.Namespaces) == 0 {
+		return false
+	}
+	for _, a := range allocs {
+		if !slices.Contains(c.Namespaces, a.Namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// validDistribution reports whether d is a known distribution strategy.
+func validDistribution(d string) bool {
+	switch d {
+	case DistributeProportional, DistributeEven, DistributeNone:
+		return true
+	}
+	return false
+}
+
+// distributeSharedSeries folds the series of shared namespaces into the others, bucket by
+// bucket. Series must come from one buildTimeSeries call, so their points line up.
+func distributeSharedSeries(series []NamespaceSeries, shared []string, distribution string) ([]NamespaceSeries, SharedCostReport) {
+	report := SharedCostReport{Namespaces: shared, Distribution: distribution}
+	isShared := map[string]bool{}
+	for _, ns := range shared {
+		isShared[ns] = true
+	}
+
+	var sharedSeries, out []NamespaceSeries
+	for _, s := range series {
+		if isShared[s.Namespace] {
+			sharedSeries = append(sharedSeries, s)
+		} else {
+			out = append(out, s)
+		}
+	}
+	if len(sharedSeries) == 0 {
+		return series, report
+	}
+	if len(out) == 0 {
+		return series, report
+	}
+	for i := range sharedSeries[0].Points {
+		var pool, direct float64
+		for _, s := range sharedSeries {
+			pool += s.Points[i].TotalCost
+		}
+		report.Total += pool
+		if pool == 0 {
+			continue
+		}
+		for _, s := range out {
+			direct += s.Points[i].TotalCost
+		}
+		for _, s := range out {
+			p := &s.Points[i]
+			share := pool / float64(len(out))
+			if distribution == DistributeProportional && direct > 0 {
+				share = pool * p.TotalCost / direct
+			}
+			p.SharedCost = round2(share)
+			p.TotalCost = round2(p.TotalCost + share)
+		}
+	}
+	for i := range out {
+		out[i].TotalCost = 0
+		for _, p := range out[i].Points {
+			out[i].TotalCost += p.TotalCost
+		}
+		out[i].TotalCost = round2(out[i].TotalCost)
+	}
+	report.Total = round2(report.Total)
+	return out, report
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== Slack app =====
+//
+// With SLACK_SIGNING_SECRET set the server is the backend of a Slack app:
+//
+//   - POST /slack/commands takes the /opencost slash command. The text goes through the same
+//     routing as /query, and the answer is posted to the channel through the command's
+//     response_url.
+//   - POST /slack/events takes Events API callbacks. When someone mentions the bot, it answers
+//     in the message's thread with chat.postMessage, which needs SLACK_BOT_TOKEN.
+//
+// Answers are the query's summary plus a bar chart of the largest items drawn in text, which
+// renders everywhere without uploading images. Every channel (and every thread, for mentions)
+// is its own session, so follow-ups like "and for dev?" keep the conversation context the
+// same way session_id does for API callers.
+//
+// Slack requests are authenticated by their signature, not API keys, so /slack/ skips tenant
+// auth. With TENANTS_FILE set, SLACK_TENANT names the tenant whose allowlist Slack queries
+// run under.
+
+// slackMaxSkew is how old a signed request may be before it is rejected as a replay.
+const slackMaxSkew = 5 * time.Minute
+
+// slackChartRows is how many bars an answer's chart shows.
+const slackChartRows = 8
+
+// slackConfig is the Slack app configuration; nil when the app is disabled.
+type slackConfig struct {
+	signingSecret string
+	botToken      string
+	apiURL        string // SLACK_API_URL, default https://slack.com/api
+	tenant        *Tenant
+}
+
+var slack *slackConfig
+
+// configureSlack reads SLACK_SIGNING_SECRET, SLACK_BOT_TOKEN, SLACK_API_URL and SLACK_TENANT.
+// Call it after loadTenants.
+func configureSlack() error {
+	secret := os.Getenv("SLACK_SIGNING_SECRET")
+	if secret == "" {
+		return nil
+	}
+	c := &slackConfig{signingSecret: secret, botToken: os.Getenv("SLACK_BOT_TOKEN"), apiURL: os.Getenv("SLACK_API_URL")}
+	if c.apiURL == "" {
+		c.apiURL = "https://slack.com/api"
+	}
+	if name := os.Getenv("SLACK_TENANT"); name != "" {
+		if c.tenant = tenantByName(name); c.tenant == nil {
+			return fmt.Errorf("SLACK_TENANT: no tenant named %q", name)
+		}
+	} else if tenants != nil {
+		return fmt.Errorf("SLACK_TENANT is required with TENANTS_FILE, so Slack queries are scoped to a tenant")
+	}
+	slack = c
+	log.Printf("[MCP] Slack app enabled (events replies %s)\n", map[bool]string{true: "on", false: "off, no SLACK_BOT_TOKEN"}[c.botToken != ""])
+	return nil
+}
+
+// verifySlackRequest reads the body and checks Slack's v0 signature over it, writing the
+// error response when it doesn't hold.
+func verifySlackRequest(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if slack == nil {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "the Slack app is disabled; set SLACK_SIGNING_SECRET to enable it", nil)
+		return nil, false
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidJSON, "failed to read request body", err.Error())
+		return nil, false
+	}
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	secs, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(secs, 0)).Abs() > slackMaxSkew {
+		writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "missing or stale Slack request timestamp", nil)
+		return nil, false
+	}
+	mac := hmac.New(sha256.New, []byte(slack.signingSecret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(want), []byte(r.Header.Get("X-Slack-Signature"))) {
+		writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "invalid Slack signature", nil)
+		return nil, false
+	}
+	return body, true
+}
+
+// slackSessionID keys the conversation context by workspace, channel and thread.
+func slackSessionID(team, channel, thread string) string {
+	id := "slack-" + team + "-" + channel
+	if thread != "" {
+		id += "-" + strings.ReplaceAll(thread, ".", "")
+	}
+	return id
+}
+
+// slackHelp is the answer to "/opencost help" or an empty command.
+const slackHelp = "Ask about costs in plain English, for example:\n" +
+	"• `/opencost prod namespace costs last 7 days`\n" +
+	"• `/opencost cloud bill by service`\n" +
+	"• `/opencost idle aws assets in us-east-1`\n" +
+	"Follow-up questions in the same channel (or thread, when you mention me) keep the context."
+
+// answerSlackQuestion runs text as a /query question in the given session and formats the
+// answer as Slack mrkdwn.
+func answerSlackQuestion(ctx context.Context, text, sessionID string) string {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.EqualFold(text, "help") {
+		return slackHelp
+	}
+	if slack.tenant != nil {
+		ctx = context.WithValue(ctx, tenantKey{}, slack.tenant)
+	}
+	aq := AgenticQuery{Query: text, Summarize: SummarizeOn}
+	aq.Context.SessionID = sessionID
+	route := routeQuery(aq.Query)
+	extractFilters(&aq, &route)
+	logf(ctx, "[Slack] %q routed to /%s in session %s\n", text, route.Endpoint, sessionID)
+
+	rec := httptest.NewRecorder()
+	executeQuery(ctx, rec, route.Endpoint, aq)
+	var resp struct {
+		Data    json.RawMessage `json:"data"`
+		Summary string          `json:"summary"`
+		Error   *APIError       `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		return ":warning: Something went wrong answering that."
+	}
+	if resp.Error != nil {
+		return ":warning: " + resp.Error.Message
+	}
+	out := "*" + text + "*\n" + resp.Summary
+	if chart := slackChart(route.Endpoint, resp.Data); chart != "" {
+		out += "\n```\n" + chart + "```"
+	}
+	return out
+}
+
+// slackChartFields are the label and value fields charted per endpoint.
+var slackChartFields = map[string][2]string{
+	"allocations": {"namespace", "total_cost"},
+	"cloudCosts":  {"name", "totalCost"},
+	"assets":      {"type", "cost"},
+}
+
+// slackChart sums the endpoint's cost field per label and draws the largest as text bars.
+// Data that isn't a list of records, such as a time series, draws nothing.
+func slackChart(endpoint string, data json.RawMessage) string {
+	fields, ok := slackChartFields[endpoint]
+	var records []map[string]interface{}
+	if !ok || json.Unmarshal(data, &records) != nil || len(records) == 0 {
+		return ""
+	}
+	totals := map[string]float64{}
+	for _, rec := range records {
+		label, _ := rec[fields[0]].(string)
+		value, _ := rec[fields[1]].(float64)
+		if label == "" {
+			label = "(none)"
+		}
+		totals[label] += value
+	}
+	labels := make([]string, 0, len(totals))
+	for l := range totals {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		if totals[labels[i]] != totals[labels[j]] {
+			return totals[labels[i]] > totals[labels[j]]
+		}
+		return labels[i] < labels[j]
+	})
+	if len(labels) > slackChartRows {
+		labels = labels[:slackChartRows]
+	}
+	width, top := 0, totals[labels[0]]
+	for _, l := range labels {
+		width = max(width, len([]rune(l)))
+	}
+	var b strings.Builder
+	for _, l := range labels {
+		bar := 0
+		if top > 0 {
+			bar = int(totals[l]/top*20 + 0.5)
+		}
+		fmt.Fprintf(&b, "%-*s %s %s\n", width, l, strings.Repeat("█", bar), money(totals[l]))
+	}
+	return b.String()
+}
+
+// postSlack POSTs a JSON message to a response_url or Web API method.
+func postSlack(ctx context.Context, target string, msg map[string]interface{}, token string) error {
+	body, _ := json.Marshal(msg)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("Slack delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Slack returned %d: %s", resp.StatusCode, truncateBody(raw))
+	}
+	// The Web API answers 200 with {"ok": false, "error": ...} on failure
+	var result struct {
+		OK    *bool  `json:"ok"`
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(raw, &result) == nil && result.OK != nil && !*result.OK {
+		return fmt.Errorf("Slack returned error %s", result.Error)
+	}
+	return nil
+}
+
+// slackCommandHandler handles POST /slack/commands. Slack wants an answer within three
+// seconds, so the command is acknowledged at once and answered through response_url.
+func slackCommandHandler(w http.ResponseWriter, r *http.Request) {
+	body, ok := verifySlackRequest(w, r)
+	if !ok {
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidFilters, "invalid slash command payload", err.Error())
+		return
+	}
+	text, responseURL := form.Get("text"), form.Get("response_url")
+	session := slackSessionID(form.Get("team_id"), form.Get("channel_id"), "")
+	if strings.TrimSpace(text) == "" || strings.EqualFold(strings.TrimSpace(text), "help") || responseURL == "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"response_type": "ephemeral", "text": slackHelp})
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		qctx, cancel := context.WithTimeout(ctx, handlerTimeout)
+		defer cancel()
+		answer := answerSlackQuestion(qctx, text, session)
+		if err := postSlack(ctx, responseURL, map[string]interface{}{"response_type": "in_channel", "text": answer}, ""); err != nil {
+			logf(ctx, "[Slack] Replying to /opencost failed: %v\n", err)
+		}
+	}()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"response_type": "in_channel"})
+}
+
+// slackMention matches the <@U123ABC> mention tokens in message text.
+var slackMention = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+// slackEventsHandler handles POST /slack/events: the URL verification handshake and
+// app_mention events, answered in thread.
+func slackEventsHandler(w http.ResponseWriter, r *http.Request) {
+	body, ok := verifySlackRequest(w, r)
+	if !ok {
+		return
+	}
+	var payload struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		TeamID    string `json:"team_id"`
+		Event     struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			Channel  string `json:"channel"`
+			TS       string `json:"ts"`
+			ThreadTS string `json:"thread_ts"`
+			BotID    string `json:"bot_id"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		writeError(w, r, http.StatusBadRequest, ErrCodeInvalidJSON, "invalid Slack event payload", err.Error())
+		return
+	}
+	if payload.Type == "url_verification" {
+		writeJSON(w, http.StatusOK, map[string]string{"challenge": payload.Challenge})
+		return
+	}
+	ev := payload.Event
+	// Slack retries events it thinks were missed; the first delivery is already being answered
+	if payload.Type != "event_callback" || ev.Type != "app_mention" || ev.BotID != "" || r.Header.Get("X-Slack-Retry-Num") != "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if slack.botToken == "" {
+		logf(r.Context(), "[Slack] Ignoring mention: SLACK_BOT_TOKEN is not set\n")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	thread := ev.ThreadTS
+	if thread == "" {
+		thread = ev.TS
+	}
+	text := strings.TrimSpace(slackMention.ReplaceAllString(ev.Text, ""))
+	session := slackSessionID(payload.TeamID, ev.Channel, thread)
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		qctx, cancel := context.WithTimeout(ctx, handlerTimeout)
+		defer cancel()
+		answer := answerSlackQuestion(qctx, text, session)
+		msg := map[string]interface{}{"channel": ev.Channel, "thread_ts": thread, "text": answer}
+		if err := postSlack(ctx, slack.apiURL+"/chat.postMessage", msg, slack.botToken); err != nil {
+			logf(ctx, "[Slack] Replying to mention failed: %v\n", err)
+		}
+	}()
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,758 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ===== SQL over stored history =====
+//
+// POST /sql {"query": "..."} (or GET /sql?q=...) runs a read-only query over the local store
+// (see store.go) for BI tools and power users. It is not a SQL database: queries are parsed
+// against a small grammar and anything outside it is refused before any data is read, so
+// there is nothing to inject into and no way to write.
+//
+//	SELECT item, ... FROM allocations
+//	  [WHERE cond AND cond ...] [GROUP BY column, ...]
+//	  [ORDER BY output [ASC|DESC], ...] [LIMIT n]
+//
+// An item is a column or SUM, AVG, MIN, MAX or COUNT of one (COUNT(*) too), optionally AS an
+// alias. A condition compares a column with a literal (=, !=, <>, <, <=, >, >=), or uses
+// IN ('a', 'b') or LIKE 'prefix%'. Literals are numbers, negative ones included, or 'quoted'
+// strings with '' for a quote. Conditions only combine with AND; OR is refused, IN covers
+// alternatives of one column. Columns are the allocation fields, day and month of start_time
+// (UTC), and labels.<key>. Rows are capped at sqlMaxLimit; tenants only see their namespaces.
+
+// SQL limits.
+const (
+	sqlMaxQueryLength = 4096
+	sqlDefaultLimit   = 1000
+	sqlMaxLimit       = 10000
+)
+
+// sqlNumericColumns and sqlStringColumns are the queryable columns besides labels.<key>.
+var (
+	sqlNumericColumns = map[string]func(a Allocation) float64{
+		"cpu_cost":       func(a Allocation) float64 { return a.CPUCost },
+		"memory_cost":    func(a Allocation) float64 { return a.MemoryCost },
+		"gpu_cost":       func(a Allocation) float64 { return a.GPUCost },
+		"network_cost":   func(a Allocation) float64 { return a.NetworkCost },
+		"pv_cost":        func(a Allocation) float64 { return a.PVCost },
+		"total_cost":     func(a Allocation) float64 { return a.TotalCost },
+		"cpu_core_hours": func(a Allocation) float64 { return a.CPUCoreHours },
+		"ram_gb_hours":   func(a Allocation) float64 { return a.RAMGBHours },
+		"gpu_hours":      func(a Allocation) float64 { return a.GPUHours },
+	}
+	sqlStringColumns = map[string]func(a Allocation) string{
+		"namespace":   func(a Allocation) string { return a.Namespace },
+		"resource_id": func(a Allocation) string { return a.ResourceID },
+		"start_time":  func(a Allocation) string { return a.StartTime },
+		"end_time":    func(a Allocation) string { return a.EndTime },
+		"day":         func(a Allocation) string { return sqlStartFormat(a, "2006-01-02") },
+		"month":       func(a Allocation) string { return sqlStartFormat(a, "2006-01") },
+	}
+)
+
+var sqlLabelColumn = regexp.MustCompile(`^labels\.[A-Za-z0-9_./-]+$`)
+
+// sqlStartFormat formats an allocation's start in UTC, or "" without one.
+func sqlStartFormat(a Allocation, layout string) string {
+	t, err := time.Parse(time.RFC3339, a.StartTime)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(layout)
+}
+
+// sqlValue reads a column of a: a float64 for numeric columns, otherwise a string.
+func sqlValue(a Allocation, column string) interface{} {
+	if f, ok := sqlNumericColumns[column]; ok {
+		return f(a)
+	}
+	if f, ok := sqlStringColumns[column]; ok {
+		return f(a)
+	}
+	return a.Labels[strings.TrimPrefix(column, "labels.")]
+}
+
+// sqlColumnKnown reports whether column may be queried.
+func sqlColumnKnown(column string) bool {
+	_, num := sqlNumericColumns[column]
+	_, str := sqlStringColumns[column]
+	return num || str || sqlLabelColumn.MatchString(column)
+}
+
+// ----- Parsing -----
+
+// sqlToken is one lexical token. Keywords and column names are lowercased.
+type sqlToken struct {
+	kind string // ident, number, string or symbol
+	text string
+}
+
+var sqlTokenPattern = regexp.MustCompile(`\s*(?:([A-Za-z_][A-Za-z0-9_.]*)|(-?\d+(?:\.\d+)?)|'((?:[^']|'')*)'|(<=|>=|!=|<>|[(),*=<>;]))`)
+
+// sqlTokenize splits a query into tokens, refusing any character outside the grammar.
+func sqlTokenize(query string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	rest := query
+	for strings.TrimSpace(rest) != "" {
+		m := sqlTokenPattern.FindStringSubmatchIndex(rest)
+		if m == nil || m[0] != 0 {
+			pos := len(query) - len(strings.TrimLeft(rest, " \t\r\n"))
+			return nil, fmt.Errorf("unexpected character at position %d", pos+1)
+		}
+		switch {
+		case m[2] >= 0:
+			// Label keys keep their case; everything else is case-insensitive
+			word := rest[m[2]:m[3]]
+			if key, ok := cutPrefixFold(word, "labels."); ok {
+				word = "labels." + key
+			} else {
+				word = strings.ToLower(word)
+			}
+			tokens = append(tokens, sqlToken{"ident", word})
+		case m[4] >= 0:
+			tokens = append(tokens, sqlToken{"number", rest[m[4]:m[5]]})
+		case m[6] >= 0:
+			tokens = append(tokens, sqlToken{"string", strings.ReplaceAll(rest[m[6]:m[7]], "''", "'")})
+		default:
+			tokens = append(tokens, sqlToken{"symbol", rest[m[8]:m[9]]})
+		}
+		rest = rest[m[1]:]
+	}
+	return tokens, nil
+}
+
+// cutPrefixFold is strings.CutPrefix ignoring the case of prefix.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
+
+// sqlItem is one output column: a column, or an aggregate of one.
+type sqlItem struct {
+	agg    string // sum, avg, min, max, count, or "" for a plain column
+	column string // "*" for COUNT(*)
+	name   string // output name: the alias, or the expression
+}
+
+// sqlCond is one WHERE condition.
+type sqlCond struct {
+	column string
+	op     string // =, !=, <, <=, >, >=, in, like
+	values []sqlToken
+}
+
+// sqlOrder is one ORDER BY key.
+type sqlOrder struct {
+	name string
+	desc bool
+}
+
+// sqlQuery is a parsed, validated query.
+type sqlQuery struct {
+	items   []sqlItem
+	where   []sqlCond
+	groupBy []string
+	orderBy []sqlOrder
+	limit   int
+}
+
+// sqlParser walks the tokens of one query.
+type sqlParser struct {
+	tokens []sqlToken
+	pos    int
+}
+
+func (p *sqlParser) peek() sqlToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return sqlToken{}
+}
+
+func (p *sqlParser) next() sqlToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// accept consumes the next token if its text is text.
+func (p *sqlParser) accept(text string) bool {
+	if t := p.peek(); t.kind != "string" && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *sqlParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected %s, got %s", strings.ToUpper(text), p.describe())
+	}
+	return nil
+}
+
+// describe names the next token for error messages.
+func (p *sqlParser) describe() string {
+	t := p.peek()
+	switch t.kind {
+	case "":
+		return "end of query"
+	case "string":
+		return "'" + t.text + "'"
+	}
+	return strings.ToUpper(t.text)
+}
+
+// column consumes a known column name.
+func (p *sqlParser) column() (string, error) {
+	t := p.peek()
+	if t.kind != "ident" {
+		return "", fmt.Errorf("expected a column, got %s", p.describe())
+	}
+	if !sqlColumnKnown(t.text) {
+		return "", fmt.Errorf("unknown column %s", t.text)
+	}
+	p.pos++
+	return t.text, nil
+}
+
+// parseSQL parses and validates query.
+func parseSQL(query string) (*sqlQuery, error) {
+	if len(query) > sqlMaxQueryLength {
+		return nil, fmt.Errorf("query is longer than %d characters", sqlMaxQueryLength)
+	}
+	tokens, err := sqlTokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &sqlParser{tokens: tokens}
+	q := &sqlQuery{limit: sqlDefaultLimit}
+	if !p.accept("select") {
+		return nil, fmt.Errorf("only SELECT queries are allowed")
+	}
+	for {
+		item, err := p.item()
+		if err != nil {
+			return nil, err
+		}
+		q.items = append(q.items, item)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	if !p.accept("allocations") {
+		return nil, fmt.Errorf("only the allocations table can be queried, got %s", p.describe())
+	}
+	if p.accept("where") {
+		for {
+			cond, err := p.cond()
+			if err != nil {
+				return nil, err
+			}
+			q.where = append(q.where, cond)
+			if p.accept("or") {
+				return nil, fmt.Errorf("OR is not supported; combine conditions with AND, or use IN for alternatives")
+			}
+			if !p.accept("and") {
+				break
+			}
+		}
+	}
+	if p.accept("group") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		for {
+			col, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			q.groupBy = append(q.groupBy, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("order") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		for {
+			t := p.next()
+			if t.kind != "ident" {
+				return nil, fmt.Errorf("expected an output column after ORDER BY")
+			}
+			o := sqlOrder{name: t.text}
+			if p.accept("desc") {
+				o.desc = true
+			} else {
+				p.accept("asc")
+			}
+			q.orderBy = append(q.orderBy, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("limit") {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != "number" || err != nil || n <= 0 || n > sqlMaxLimit {
+			return nil, fmt.Errorf("LIMIT must be a whole number from 1 to %d", sqlMaxLimit)
+		}
+		q.limit = n
+	}
+	p.accept(";")
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s; only one SELECT is allowed", p.describe())
+	}
+	return q, q.validate()
+}
+
+// item parses one select item.
+func (p *sqlParser) item() (sqlItem, error) {
+	var item sqlItem
+	switch t := p.peek(); {
+	case t.kind == "symbol" && t.text == "*":
+		return item, fmt.Errorf("SELECT * is not supported; name the columns")
+	case t.kind == "ident" && (t.text == "sum" || t.text == "avg" || t.text == "min" || t.text == "max" || t.text == "count"):
+		p.pos++
+		item.agg = t.text
+		if err := p.expect("("); err != nil {
+			return item, err
+		}
+		if item.agg == "count" && p.accept("*") {
+			item.column = "*"
+		} else {
+			col, err := p.column()
+			if err != nil {
+				return item, err
+			}
+			if _, numeric := sqlNumericColumns[col]; !numeric && item.agg != "count" {
+				return item, fmt.Errorf("%s needs a numeric column, got %s", strings.ToUpper(item.agg), col)
+			}
+			item.column = col
+		}
+		if err := p.expect(")"); err != nil {
+			return item, err
+		}
+		item.name = item.agg + "(" + item.column + ")"
+	default:
+		col, err := p.column()
+		if err != nil {
+			return item, err
+		}
+		item.column, item.name = col, col
+	}
+	if p.accept("as") {
+		t := p.next()
+		if t.kind != "ident" || strings.Contains(t.text, ".") {
+			return item, fmt.Errorf("expected an alias after AS")
+		}
+		item.name = t.text
+	}
+	return item, nil
+}
+
+// cond parses one WHERE condition.
+func (p *sqlParser) cond() (sqlCond, error) {
+	col, err := p.column()
+	if err != nil {
+		return sqlCond{}, err
+	}
+	c := sqlCond{column: col}
+	_, numeric := sqlNumericColumns[col]
+	literal := func() (sqlToken, error) {
+		t := p.next()
+		if numeric && t.kind != "number" {
+			return t, fmt.Errorf("%s compares with numbers", col)
+		}
+		if !numeric && t.kind != "string" {
+			return t, fmt.Errorf("%s compares with 'quoted' strings", col)
+		}
+		return t, nil
+	}
+	switch t := p.next(); {
+	case t.kind == "symbol" && (t.text == "=" || t.text == "!=" || t.text == "<>" || t.text == "<" || t.text == "<=" || t.text == ">" || t.text == ">="):
+		c.op = strings.Replace(t.text, "<>", "!=", 1)
+		v, err := literal()
+		if err != nil {
+			return c, err
+		}
+		c.values = []sqlToken{v}
+	case t.kind == "ident" && t.text == "in":
+		c.op = "in"
+		if err := p.expect("("); err != nil {
+			return c, err
+		}
+		for {
+			v, err := literal()
+			if err != nil {
+				return c, err
+			}
+			c.values = append(c.values, v)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return c, err
+		}
+	case t.kind == "ident" && t.text == "like":
+		c.op = "like"
+		if numeric {
+			return c, fmt.Errorf("LIKE needs a text column, got %s", col)
+		}
+		v, err := literal()
+		if err != nil {
+			return c, err
+		}
+		c.values = []sqlToken{v}
+	default:
+		return c, fmt.Errorf("expected a comparison after %s", col)
+	}
+	return c, nil
+}
+
+// validate checks the query as a whole: grouping and ORDER BY names.
+func (q *sqlQuery) validate() error {
+	grouped := len(q.groupBy) > 0
+	names := map[string]bool{}
+	for _, it := range q.items {
+		if it.agg != "" {
+			grouped = true
+		}
+		if names[it.name] {
+			return fmt.Errorf("output column %s appears twice; use AS", it.name)
+		}
+		names[it.name] = true
+	}
+	if grouped {
+		for _, it := range q.items {
+			if it.agg == "" && !slices.Contains(q.groupBy, it.column) {
+				return fmt.Errorf("%s must be in GROUP BY or inside an aggregate", it.column)
+			}
+		}
+	}
+	for _, o := range q.orderBy {
+		if !names[o.name] {
+			return fmt.Errorf("ORDER BY %s: not an output column", o.name)
+		}
+	}
+	return nil
+}
+
+// ----- Evaluation -----
+
+// matches evaluates a condition against an allocation.
+func (c sqlCond) matches(a Allocation) bool {
+	v := sqlValue(a, c.column)
+	for _, lit := range c.values {
+		var cmp int
+		if f, ok := v.(float64); ok {
+			n, _ := strconv.ParseFloat(lit.text, 64)
+			cmp = compareFloat(f, n)
+		} else {
+			s := v.(string)
+			if c.op == "like" {
+				return sqlLike(s, lit.text)
+			}
+			cmp = strings.Compare(s, lit.text)
+		}
+		switch c.op {
+		case "=", "in":
+			if cmp == 0 {
+				return true
+			}
+		case "!=":
+			return cmp != 0
+		case "<":
+			return cmp < 0
+		case "<=":
+			return cmp <= 0
+		case ">":
+			return cmp > 0
+		case ">=":
+			return cmp >= 0
+		}
+	}
+	return false
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// sqlLike matches s against a pattern where % is any run and _ any one character.
+func sqlLike(s, pattern string) bool {
+	var re strings.Builder
+	re.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			re.WriteString(".*")
+		case '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	ok, _ := regexp.MatchString(re.String(), s)
+	return ok
+}
+
+// sqlAggregate accumulates one aggregate item over a group.
+type sqlAggregate struct {
+	n        int
+	sum      float64
+	min, max float64
+}
+
+func (g *sqlAggregate) add(v float64) {
+	if g.n == 0 || v < g.min {
+		g.min = v
+	}
+	if g.n == 0 || v > g.max {
+		g.max = v
+	}
+	g.n++
+	g.sum += v
+}
+
+func (g *sqlAggregate) result(agg string) interface{} {
+	switch agg {
+	case "count":
+		return g.n
+	case "sum":
+		return round2(g.sum)
+	}
+	if g.n == 0 {
+		return nil
+	}
+	switch agg {
+	case "avg":
+		return math.Round(g.sum/float64(g.n)*10000) / 10000
+	case "min":
+		return g.min
+	}
+	return g.max
+}
+
+// SQLResult is the data of a /sql response: column names and rows of values.
+type SQLResult struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// run evaluates the query over allocs, returning the result and whether LIMIT cut rows.
+func (q *sqlQuery) run(allocs []Allocation) (SQLResult, bool) {
+	res := SQLResult{Rows: [][]interface{}{}}
+	for _, it := range q.items {
+		res.Columns = append(res.Columns, it.name)
+	}
+	grouped := len(q.groupBy) > 0
+	for _, it := range q.items {
+		grouped = grouped || it.agg != ""
+	}
+
+	var matched []Allocation
+	for _, a := range allocs {
+		ok := true
+		for _, c := range q.where {
+			if !c.matches(a) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, a)
+		}
+	}
+
+	if !grouped {
+		for _, a := range matched {
+			row := make([]interface{}, len(q.items))
+			for i, it := range q.items {
+				row[i] = sqlValue(a, it.column)
+			}
+			res.Rows = append(res.Rows, row)
+		}
+	} else {
+		type group struct {
+			first Allocation
+			aggs  []sqlAggregate
+		}
+		groups := map[string]*group{}
+		var order []string
+		for _, a := range matched {
+			keyParts := make([]string, len(q.groupBy))
+			for i, col := range q.groupBy {
+				keyParts[i] = fmt.Sprint(sqlValue(a, col))
+			}
+			key := strings.Join(keyParts, "\x00")
+			g, ok := groups[key]
+			if !ok {
+				g = &group{first: a, aggs: make([]sqlAggregate, len(q.items))}
+				groups[key] = g
+				order = append(order, key)
+			}
+			for i, it := range q.items {
+				switch {
+				case it.agg == "":
+				case it.column == "*":
+					g.aggs[i].add(0)
+				default:
+					if f, ok := sqlValue(a, it.column).(float64); ok {
+						g.aggs[i].add(f)
+					} else if it.agg == "count" && sqlValue(a, it.column) != "" {
+						g.aggs[i].add(0)
+					}
+				}
+			}
+		}
+		// An aggregate without GROUP BY answers one row, also over no records
+		if len(q.groupBy) == 0 && len(order) == 0 {
+			groups[""] = &group{aggs: make([]sqlAggregate, len(q.items))}
+			order = append(order, "")
+		}
+		sort.Strings(order)
+		for _, key := range order {
+			g := groups[key]
+			row := make([]interface{}, len(q.items))
+			for i, it := range q.items {
+				if it.agg == "" {
+					row[i] = sqlValue(g.first, it.column)
+				} else {
+					row[i] = g.aggs[i].result(it.agg)
+				}
+			}
+			res.Rows = append(res.Rows, row)
+		}
+	}
+
+	if len(q.orderBy) > 0 {
+		index := map[string]int{}
+		for i, name := range res.Columns {
+			index[name] = i
+		}
+		sort.SliceStable(res.Rows, func(i, j int) bool {
+			for _, o := range q.orderBy {
+				c := compareSQLValues(res.Rows[i][index[o.name]], res.Rows[j][index[o.name]])
+				if c != 0 {
+					return (c < 0) != o.desc
+				}
+			}
+			return false
+		})
+	}
+	truncated := len(res.Rows) > q.limit
+	if truncated {
+		res.Rows = res.Rows[:q.limit]
+	}
+	return res, truncated
+}
+
+// compareSQLValues orders result values; nulls sort first.
+func compareSQLValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	toFloat := func(v interface{}) (float64, bool) {
+		switch n := v.(type) {
+		case float64:
+			return n, true
+		case int:
+			return float64(n), true
+		}
+		return 0, false
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return compareFloat(x, y)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// sqlHandler handles GET /sql?q=... and POST /sql {"query": "..."}.
+func sqlHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /sql request received")
+	if store == nil {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "local store is disabled; set LOCAL_STORE_DIR to enable it", nil)
+		return
+	}
+	query := r.URL.Query().Get("q")
+	if r.Method == http.MethodPost {
+		var body struct {
+			Query string `json:"query"`
+		}
+		if !decodeJSON(w, r, &body) {
+			return
+		}
+		query = body.Query
+	}
+
+	var verrs ValidationErrors
+	q, err := parseSQL(query)
+	switch {
+	case strings.TrimSpace(query) == "":
+		verrs.add("query", "", "is required")
+	case err != nil:
+		verrs.add("query", query, err.Error())
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	allocs := store.query(AllocationFilter{})
+	if t := tenantFrom(r.Context()); t != nil {
+		allowed := allocs[:0]
+		for _, a := range allocs {
+			if t.allowsNamespace(a.Namespace) {
+				allowed = append(allowed, a)
+			}
+		}
+		allocs = allowed
+	}
+	result, truncated := q.run(allocs)
+	logf(r.Context(), "[MCP] /sql — %d rows from %d stored records\n", len(result.Rows), len(allocs))
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": result,
+		"meta": map[string]interface{}{
+			"scanned":    len(allocs),
+			"total":      len(result.Rows),
+			"truncated":  truncated,
+			"limit":      q.limit,
+			"request_id": requestIDFrom(r.Context()),
+		},
+	})
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sqlAllocations is a small data set for the SQL tests.
+func sqlAllocations(start time.Time) []Allocation {
+	at := start.UTC().Format(time.RFC3339)
+	end := start.Add(time.Hour).UTC().Format(time.RFC3339)
+	return []Allocation{
+		{Namespace: "prod", ResourceID: "pod-1", TotalCost: 10, CPUCost: 6, StartTime: at, EndTime: end, Labels: map[string]string{"team": "core"}},
+		{Namespace: "prod", ResourceID: "pod-2", TotalCost: 5, CPUCost: 3, StartTime: at, EndTime: end},
+		{Namespace: "o'brien", ResourceID: "pod-3", TotalCost: 0, StartTime: at, EndTime: end},
+		{Namespace: "dev", ResourceID: "pod-4", TotalCost: -2.5, StartTime: at, EndTime: end, Labels: map[string]string{"team": "web"}},
+	}
+}
+
+func TestParseSQLAccepts(t *testing.T) {
+	tests := []struct {
+		query string
+		items int
+		where int
+		limit int
+	}{
+		{"SELECT namespace FROM allocations", 1, 0, sqlDefaultLimit},
+		{"select namespace, total_cost from allocations;", 2, 0, sqlDefaultLimit},
+		{"SELECT namespace, SUM(total_cost) AS cost FROM allocations GROUP BY namespace ORDER BY cost DESC LIMIT 5", 2, 0, 5},
+		{"SELECT COUNT(*) FROM allocations WHERE namespace IN ('prod', 'dev') AND total_cost >= 1.5", 1, 2, sqlDefaultLimit},
+		{"SELECT resource_id FROM allocations WHERE namespace LIKE 'pr%' AND cpu_cost <> 0", 1, 2, sqlDefaultLimit},
+		{"SELECT labels.team, MAX(cpu_cost) FROM allocations WHERE labels.team = 'core' GROUP BY labels.team", 2, 1, sqlDefaultLimit},
+		{"SELECT day, AVG(total_cost) FROM allocations WHERE total_cost > -1 GROUP BY day ORDER BY day", 2, 1, sqlDefaultLimit},
+		{"SELECT month, MIN(total_cost) FROM allocations GROUP BY month LIMIT 10000", 2, 0, sqlMaxLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parseSQL(tt.query)
+			if err != nil {
+				t.Fatalf("parseSQL: %v", err)
+			}
+			if len(q.items) != tt.items || len(q.where) != tt.where || q.limit != tt.limit {
+				t.Errorf("got %d items, %d conditions, limit %d; want %d, %d, %d", len(q.items), len(q.where), q.limit, tt.items, tt.where, tt.limit)
+			}
+		})
+	}
+}
+
+func TestParseSQLRejects(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string // part of the error
+	}{
+		{"DELETE FROM allocations", "only SELECT queries are allowed"},
+		{"SELECT * FROM allocations", "SELECT * is not supported"},
+		{"SELECT namespace FROM assets", "only the allocations table"},
+		{"SELECT password FROM allocations", "unknown column password"},
+		{"SELECT namespace FROM allocations WHERE namespace = 'a' OR namespace = 'b'", "OR is not supported"},
+		{"SELECT namespace FROM allocations WHERE total_cost = 'ten'", "total_cost compares with numbers"},
+		{"SELECT namespace FROM allocations WHERE namespace = 5", "namespace compares with 'quoted' strings"},
+		{"SELECT namespace FROM allocations WHERE total_cost LIKE '1%'", "LIKE needs a text column"},
+		{"SELECT namespace FROM allocations WHERE namespace", "expected a comparison after namespace"},
+		{"SELECT SUM(namespace) FROM allocations", "SUM needs a numeric column"},
+		{"SELECT namespace, SUM(total_cost) FROM allocations", "namespace must be in GROUP BY"},
+		{"SELECT namespace, namespace FROM allocations", "appears twice"},
+		{"SELECT namespace FROM allocations ORDER BY total_cost", "ORDER BY total_cost: not an output column"},
+		{"SELECT namespace FROM allocations; SELECT namespace FROM allocations", "only one SELECT is allowed"},
+		{"SELECT namespace FROM allocations WHERE namespace = \"prod\"", "unexpected character at position 53"},
+		{"SELECT namespace FROM allocations -- comment", "unexpected character"},
+		{"SELECT " + strings.Repeat("namespace, ", 400) + "namespace FROM allocations", "longer than 4096 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			_, err := parseSQL(tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseSQL(%q) = %v, want an error containing %q", tt.query, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSQLLimit(t *testing.T) {
+	tests := []struct {
+		limit string
+		want  int // 0 for rejected
+	}{
+		{"1", 1},
+		{"250", 250},
+		{"10000", sqlMaxLimit},
+		{"0", 0},
+		{"-5", 0},
+		{"10001", 0},
+		{"2.5", 0},
+		{"'10'", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			q, err := parseSQL("SELECT namespace FROM allocations LIMIT " + tt.limit)
+			switch {
+			case tt.want == 0 && (err == nil || !strings.Contains(err.Error(), "LIMIT must be a whole number from 1 to 10000")):
+				t.Errorf("got %v, want the LIMIT error", err)
+			case tt.want != 0 && err != nil:
+				t.Errorf("parseSQL: %v", err)
+			case tt.want != 0 && q.limit != tt.want:
+				t.Errorf("limit = %d, want %d", q.limit, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLTokenizeStrings(t *testing.T) {
+	tests := []struct {
+		literal, want string
+	}{
+		{"'prod'", "prod"},
+		{"''", ""},
+		{"'o''brien'", "o'brien"},
+		{"''''", "'"},
+		{"'a; DROP TABLE allocations'", "a; DROP TABLE allocations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.literal, func(t *testing.T) {
+			tokens, err := sqlTokenize(tt.literal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tokens) != 1 || tokens[0].kind != "string" || tokens[0].text != tt.want {
+				t.Errorf("got %+v, want one string %q", tokens, tt.want)
+			}
+		})
+	}
+	if _, err := sqlTokenize("'unterminated"); err == nil {
+		t.Error("an unterminated string was accepted")
+	}
+}
+
+func TestSQLRun(t *testing.T) {
+	allocs := sqlAllocations(time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC))
+	tests := []struct {
+		query string
+		want  string // the rows as JSON
+	}{
+		{"SELECT resource_id FROM allocations WHERE total_cost > -1", `[["pod-1"],["pod-2"],["pod-3"]]`},
+		{"SELECT resource_id FROM allocations WHERE total_cost < -1", `[["pod-4"]]`},
+		{"SELECT resource_id FROM allocations WHERE namespace = 'o''brien'", `[["pod-3"]]`},
+		{"SELECT resource_id FROM allocations WHERE namespace LIKE 'p_o%'", `[["pod-1"],["pod-2"]]`},
+		{"SELECT resource_id FROM allocations WHERE namespace != 'prod' AND total_cost >= 0", `[["pod-3"]]`},
+		{"SELECT resource_id FROM allocations WHERE labels.team IN ('core', 'web')", `[["pod-1"],["pod-4"]]`},
+		{"SELECT namespace, SUM(total_cost) AS cost, COUNT(*) FROM allocations GROUP BY namespace ORDER BY cost DESC",
+			`[["prod",15,2],["o'brien",0,1],["dev",-2.5,1]]`},
+		{"SELECT day, COUNT(labels.team) FROM allocations GROUP BY day", `[["2025-07-01",2]]`},
+		{"SELECT SUM(total_cost), AVG(cpu_cost) FROM allocations WHERE namespace = 'none'", `[[0,null]]`},
+		{"SELECT resource_id FROM allocations ORDER BY resource_id DESC LIMIT 2", `[["pod-4"],["pod-3"]]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parseSQL(tt.query)
+			if err != nil {
+				t.Fatalf("parseSQL: %v", err)
+			}
+			res, _ := q.run(allocs)
+			got, _ := json.Marshal(res.Rows)
+			if string(got) != tt.want {
+				t.Errorf("rows = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLRunTruncates(t *testing.T) {
+	q, err := parseSQL("SELECT resource_id FROM allocations LIMIT 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, truncated := q.run(sqlAllocations(time.Now()))
+	if len(res.Rows) != 3 || !truncated {
+		t.Errorf("got %d rows, truncated %v; want 3, true", len(res.Rows), truncated)
+	}
+}
+
+func TestSQLHandlerTenant(t *testing.T) {
+	saved := store
+	t.Cleanup(func() { store = saved })
+	store = &localStore{dir: t.TempDir(), tiers: newStoreTiers()}
+	if err := store.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.upsert(sqlAllocations(time.Now().Add(-2 * time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	var verrs ValidationErrors
+	payments := &Tenant{Name: "payments", namespaces: parseNamespaceFilter(&verrs, "namespaces", "prod,/^o'/")}
+	if len(verrs) > 0 {
+		t.Fatal(verrs)
+	}
+	tests := []struct {
+		name   string
+		tenant *Tenant
+		want   string
+	}{
+		{"no tenancy", nil, `[["dev",1],["o'brien",1],["prod",2]]`},
+		{"tenant", payments, `[["o'brien",1],["prod",2]]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"query": "SELECT namespace, COUNT(*) FROM allocations GROUP BY namespace"}`
+			r := httptest.NewRequest(http.MethodPost, "/sql", strings.NewReader(body))
+			if tt.tenant != nil {
+				r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, tt.tenant))
+			}
+			w := httptest.NewRecorder()
+			sqlHandler(w, r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				Data SQLResult `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			got, _ := json.Marshal(resp.Data.Rows)
+			if string(got) != tt.want {
+				t.Errorf("rows = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Local history store =====
+//
+// With LOCAL_STORE_DIR set the server keeps its own copy of allocation data, so it can answer
+// for windows the backend no longer retains and keep answering while the backend is down.
+// Every LOCAL_STORE_INTERVAL (default 1h) an ingestion loop pulls the last LOCAL_STORE_LOOKBACK
+// (default 24h) from the backend and upserts it, keyed by namespace, resource and start time.
+//
+// Every allocation read then sees the backend's records plus the stored ones the backend
+// didn't return, and only the stored ones when the backend fails. GET /admin/store reports
+// what is stored and how ingestion is doing.
+//
+// The store is a directory of JSON files, one per UTC day of start_time for raw records (and
+// per month or year for rollups, see rollups.go), held in memory and rewritten whole when
+// they change. It is deliberately not SQLite or Bolt: the server has
+// no third-party dependencies and no cgo, and a day of allocations is small.
+
+// Defaults for the ingestion loop.
+const (
+	defaultStoreInterval = time.Hour
+	defaultStoreLookback = 24 * time.Hour
+)
+
+// localStore is the persisted allocation history.
+type localStore struct {
+	mu       sync.Mutex
+	dir      string
+	source   CostSource // the backend ingested from, below the store in the source chain
+	interval time.Duration
+	lookback time.Duration
+	tiers    []*storeTier // raw, daily and monthly; see rollups.go
+
+	lastIngest   *time.Time
+	lastIngested int
+	lastError    string
+	fallbacks    int // reads answered from the store alone because the backend failed
+	compaction   CompactionResult
+}
+
+// store is the active store, nil unless LOCAL_STORE_DIR is set.
+var store *localStore
+
+// configureLocalStore reads LOCAL_STORE_DIR, LOCAL_STORE_INTERVAL, LOCAL_STORE_LOOKBACK and
+// LOCAL_STORE_RETENTION, loads the stored records and puts the store in front of the cost
+// source.
+func configureLocalStore() error {
+	dir := os.Getenv("LOCAL_STORE_DIR")
+	if dir == "" {
+		return nil
+	}
+	s := &localStore{dir: dir, source: costSource, interval: defaultStoreInterval, lookback: defaultStoreLookback, tiers: newStoreTiers()}
+	if v := os.Getenv("LOCAL_STORE_INTERVAL"); v != "" {
+		d, err := parseLookback(v)
+		if err != nil {
+			return fmt.Errorf("LOCAL_STORE_INTERVAL: %w", err)
+		}
+		s.interval = d
+	}
+	if v := os.Getenv("LOCAL_STORE_LOOKBACK"); v != "" {
+		d, err := parseLookback(v)
+		if err != nil {
+			return fmt.Errorf("LOCAL_STORE_LOOKBACK: %w", err)
+		}
+		s.lookback = d
+	}
+	if err := parseRetention(s.tiers, os.Getenv("LOCAL_STORE_RETENTION")); err != nil {
+		return fmt.Errorf("LOCAL_STORE_RETENTION: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("creating LOCAL_STORE_DIR: %w", err)
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	var err error
+	if s.compaction, err = s.compactLocked(time.Now()); err != nil {
+		return fmt.Errorf("rolling up the local store: %w", err)
+	}
+	if err := backfills.load(dir); err != nil {
+		return err
+	}
+	store = s
+	costSource = &storeSource{inner: costSource, store: s}
+	log.Printf("[MCP] Local store in %s: %d records\n", dir, s.records())
+	return nil
+}
+
+// load reads every file of every tier in the store directory.
+func (s *localStore) load() error {
+	for _, t := range s.tiers {
+		t.files = map[string]map[string]Allocation{}
+		files, err := filepath.Glob(filepath.Join(s.dir, t.prefix+"-*.json"))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			raw, err := os.ReadFile(f)
+			if err != nil {
+				return fmt.Errorf("failed to read local store: %w", err)
+			}
+			var list []Allocation
+			if err := json.Unmarshal(raw, &list); err != nil {
+				return fmt.Errorf("failed to parse local store %s: %w", f, err)
+			}
+			file := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), t.prefix+"-"), ".json")
+			t.files[file] = make(map[string]Allocation, len(list))
+			for _, a := range list {
+				t.files[file][storeKey(a)] = a
+			}
+		}
+	}
+	return nil
+}
+
+// storeKey identifies a record across pulls.
+func storeKey(a Allocation) string {
+	return a.Namespace + "|" + a.ResourceID + "|" + a.StartTime
+}
+
+// records counts the stored allocations.
+func (s *localStore) records() int {
+	n := 0
+	for _, t := range s.tiers {
+		for _, recs := range t.files {
+			n += len(recs)
+		}
+	}
+	return n
+}
+
+// upsert stores allocs as raw records, rewriting the files that changed, and rolls up what
+// has aged past the raw retention. It returns how many records were new or different.
+func (s *localStore) upsert(allocs []Allocation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw := s.tiers[0]
+	changed := 0
+	dirty := map[string]bool{}
+	for _, a := range allocs {
+		if s.rolledUp(a) {
+			continue
+		}
+		if old, ok := raw.files[raw.recordFile(a)][storeKey(a)]; ok && reflect.DeepEqual(old, a) {
+			continue
+		}
+		dirty[raw.put(a)] = true
+		changed++
+	}
+	for file := range dirty {
+		if err := s.saveFileLocked(raw, file); err != nil {
+			return changed, err
+		}
+	}
+	res, err := s.compactLocked(time.Now())
+	s.compaction.RolledUp += res.RolledUp
+	s.compaction.Expired += res.Expired
+	return changed, err
+}
+
+// ingest pulls [start, end) from the backend into the store.
+func (s *localStore) ingest(ctx context.Context, start, end time.Time) (int, error) {
+	data, err := s.source.GetAllocations(ctx, AllocationFilter{Start: start.UTC().Format(time.RFC3339), End: end.UTC().Format(time.RFC3339)})
+	if err != nil {
+		return 0, err
+	}
+	return s.upsert(data)
+}
+
+// query returns the stored allocations matching f.
+func (s *localStore) query(f AllocationFilter) []Allocation {
+	startTime, _ := parseDate(f.Start)
+	endTime, _ := parseDate(f.End)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Allocation{}
+	for _, t := range s.tiers {
+		for _, recs := range t.files {
+			for _, a := range recs {
+				if (f.Namespace == "" || a.Namespace == f.Namespace) && inWindow(a, startTime, endTime) {
+					out = append(out, a)
+				}
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return storeKey(out[i]) < storeKey(out[j]) })
+	return out
+}
+
+// runIngestion pulls the lookback window ending at now and records the outcome.
+func (s *localStore) runIngestion(ctx context.Context, now time.Time) {
+	n, err := s.ingest(ctx, now.Add(-s.lookback), now)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastIngest, s.lastIngested, s.lastError = &now, n, ""
+	if err != nil {
+		s.lastError = err.Error()
+		logf(ctx, "[MCP] Local store ingestion failed: %v\n", err)
+		return
+	}
+	logf(ctx, "[MCP] Local store ingested %d new or changed allocations\n", n)
+}
+
+// startIngestion runs ingestion now and then every interval until ctx is cancelled, and
+// resumes interrupted backfills.
+func startIngestion(ctx context.Context) {
+	if store == nil {
+		return
+	}
+	resumeBackfills(ctx)
+	go func() {
+		store.runIngestion(context.WithValue(ctx, requestIDKey{}, "ingest-"+newRequestID()[:6]), time.Now())
+		ticker := time.NewTicker(store.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				store.runIngestion(context.WithValue(ctx, requestIDKey{}, "ingest-"+newRequestID()[:6]), now)
+			}
+		}
+	}()
+}
+
+// storeSource answers allocation reads from the backend and the store together.
+type storeSource struct {
+	inner CostSource
+	store *localStore
+}
+
+func (s *storeSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	return s.inner.GetCloudCosts(ctx, f)
+}
+
+func (s *storeSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	return s.inner.GetAssets(ctx, f)
+}
+
+// GetAllocations adds stored records the backend didn't return, such as ones past its
+// retention. A rollup is left out when the backend returned records of its namespace in its
+// period, so nothing counts twice. When the backend fails, stored records alone answer if
+// there are any, unless the request was canceled.
+func (s *storeSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	stored := s.store.query(f)
+	data, err := s.inner.GetAllocations(ctx, f)
+	if err != nil {
+		if len(stored) == 0 || errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		addWarning(ctx, "partial_failure", "", "the backend failed (%v); answered from the local store's %d records, which may be incomplete", err, len(stored))
+		s.store.mu.Lock()
+		s.store.fallbacks++
+		s.store.mu.Unlock()
+		s.noteFreshness(ctx)
+		return stored, nil
+	}
+	seen := make(map[string]bool, len(data))
+	starts := map[string][]time.Time{} // namespace to the start times the backend returned
+	for _, a := range data {
+		seen[storeKey(a)] = true
+		if t, err := time.Parse(time.RFC3339, a.StartTime); err == nil {
+			starts[a.Namespace] = append(starts[a.Namespace], t)
+		}
+	}
+	added := 0
+	for _, a := range stored {
+		if seen[storeKey(a)] || isRollup(a) && coversAny(a, starts[a.Namespace]) {
+			continue
+		}
+		data = append(data, a)
+		added++
+	}
+	if added > 0 {
+		s.noteFreshness(ctx)
+	}
+	return data, nil
+}
+
+// noteFreshness records the store's last ingestion as the freshness of stored records.
+func (s *storeSource) noteFreshness(ctx context.Context) {
+	s.store.mu.Lock()
+	last := s.store.lastIngest
+	s.store.mu.Unlock()
+	if last != nil {
+		noteFreshness(ctx, "local_store", "allocations", *last)
+	}
+}
+
+// TierStatus describes one resolution of the store.
+type TierStatus struct {
+	Name      string `json:"name"`
+	Retention string `json:"retention"` // "0" when kept forever
+	Records   int    `json:"records"`
+	Oldest    string `json:"oldest,omitempty"` // earliest start_time
+	Newest    string `json:"newest,omitempty"` // latest start_time
+}
+
+// StoreStatus is the data of GET /admin/store.
+type StoreStatus struct {
+	Dir          string           `json:"dir"`
+	Interval     string           `json:"interval"`
+	Lookback     string           `json:"lookback"`
+	Records      int              `json:"records"`
+	Tiers        []TierStatus     `json:"tiers"`
+	Rollups      CompactionResult `json:"rollups"` // since the server started
+	LastIngest   *time.Time       `json:"last_ingest"`
+	LastIngested int              `json:"last_ingested"` // new or changed records in the last pull
+	LastError    string           `json:"last_error,omitempty"`
+	Fallbacks    int              `json:"fallbacks"` // reads answered from the store alone
+}
+
+// status describes the store.
+func (s *localStore) status() StoreStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := StoreStatus{
+		Dir: s.dir, Interval: s.interval.String(), Lookback: s.lookback.String(), Records: s.records(), Rollups: s.compaction,
+		LastIngest: s.lastIngest, LastIngested: s.lastIngested, LastError: s.lastError, Fallbacks: s.fallbacks,
+	}
+	for _, t := range s.tiers {
+		ts := TierStatus{Name: t.name, Retention: "0"}
+		if t.retention > 0 {
+			ts.Retention = t.retention.String()
+		}
+		for _, recs := range t.files {
+			for _, a := range recs {
+				ts.Records++
+				if a.StartTime == "" {
+					continue
+				}
+				if ts.Oldest == "" || a.StartTime < ts.Oldest {
+					ts.Oldest = a.StartTime
+				}
+				if a.StartTime > ts.Newest {
+					ts.Newest = a.StartTime
+				}
+			}
+		}
+		st.Tiers = append(st.Tiers, ts)
+	}
+	return st
+}
+
+// adminStoreHandler handles GET /admin/store.
+func adminStoreHandler(w http.ResponseWriter, r *http.Request) {
+	if store == nil {
+		writeError(w, r, http.StatusNotFound, ErrCodeNotFound, "local store is disabled; set LOCAL_STORE_DIR to enable it", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": store.status(),
+		"meta": map[string]interface{}{"request_id": requestIDFrom(r.Context())},
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ===== Streaming decode =====
+//
+// Record lists from the OpenCost API are decoded one record at a time straight off the
+// response body instead of being read whole and then unmarshalled, so a multi-hundred-MB
+// allocation response never sits in memory as raw JSON next to its records. The source's
+// filters are applied as each record is decoded (see the matchers in cost_source.go), so
+// records the backend should have left out are dropped before they accumulate.
+//
+//	BACKEND_MAX_RECORDS     records kept from one backend query; more fails the query with a
+//	                        request to narrow it instead of exhausting memory (default 0, no cap)
+//	BACKEND_CACHE_MAX_BODY   largest response kept by BACKEND_CACHE_TTL, in bytes (default 8 MiB)
+//	BACKEND_CACHE_MAX_BYTES  bytes of responses the cache holds in all (default 64 MiB)
+
+var (
+	backendMaxRecords    = 0
+	backendCacheMaxBody  = 8 << 20
+	backendCacheMaxBytes = 64 << 20
+)
+
+// loadStreamConfig applies BACKEND_MAX_RECORDS, BACKEND_CACHE_MAX_BODY and
+// BACKEND_CACHE_MAX_BYTES.
+func loadStreamConfig() error {
+	for name, dst := range map[string]*int{"BACKEND_MAX_RECORDS": &backendMaxRecords, "BACKEND_CACHE_MAX_BODY": &backendCacheMaxBody, "BACKEND_CACHE_MAX_BYTES": &backendCacheMaxBytes} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("%s must be a non-negative integer, got %q", name, v)
+		}
+		*dst = n
+	}
+	return nil
+}
+
+// errTooManyRecords is the error for a query over BACKEND_MAX_RECORDS.
+func errTooManyRecords(what string) error {
+	return fmt.Errorf("the backend returned more than %d %s (BACKEND_MAX_RECORDS); narrow the window or filters", backendMaxRecords, what)
+}
+
+// fetchRecords GETs url, whose body is a JSON array, and returns the records keep accepts.
+// Like fetchJSON it forwards the request ID, traces the call and uses the backend cache.
+func fetchRecords[T any](ctx context.Context, url, what string, keep func(T) bool) ([]T, error) {
+	if body, stored, ok := cachedResponse(ctx, url); ok {
+		logf(ctx, "[MCP Client] Cache hit: %s\n", url)
+		records, err := decodeRecords(bytes.NewReader(body), what, keep)
+		explainBackendCall(ctx, what, url, true, 0, len(records), err)
+		noteFreshness(ctx, "cache", what, stored)
+		return records, err
+	}
+	if plannedBackendCall(ctx, what, http.MethodGet, url) {
+		return []T{}, nil
+	}
+	logf(ctx, "[MCP Client] Fetching URL: %s\n", url)
+
+	ctx, span := startSpan(ctx, "GET "+what, spanKindClient)
+	span.SetAttr("url.full", url)
+	started := time.Now()
+	records, raw, err := streamRecords(ctx, url, what, keep)
+	observeBackend(what, time.Since(started), err)
+	explainBackendCall(ctx, what, url, false, time.Since(started), len(records), err)
+	span.SetError(err)
+	span.End()
+	if err != nil {
+		return nil, err
+	}
+	noteFreshness(ctx, "backend", what, time.Now())
+	if raw != nil {
+		storeResponse(ctx, url, raw)
+	}
+	return records, nil
+}
+
+// streamRecords decodes the response to url as it arrives. raw is the body for the cache,
+// or nil when caching is off or the body was too large to keep.
+func streamRecords[T any](ctx context.Context, url, what string, keep func(T) bool) (records []T, raw []byte, err error) {
+	resp, err := openFetch(ctx, url, what)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var body io.Reader = resp.Body
+	var copied *cappedBuffer
+	if backendCacheEnabled() {
+		copied = &cappedBuffer{max: backendCacheMaxBody}
+		body = io.TeeReader(body, copied)
+	}
+	if records, err = decodeRecords(body, what, keep); err != nil {
+		return nil, nil, err
+	}
+	if copied != nil && !copied.over {
+		raw = copied.buf.Bytes()
+	}
+	return records, raw, nil
+}
+
+// decodeRecords reads a JSON array from r one element at a time, keeping those keep accepts
+// (all of them when keep is nil). A null body is no records.
+func decodeRecords[T any](r io.Reader, what string, keep func(T) bool) ([]T, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", what, err)
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("%s response is not a JSON array", what)
+	}
+	out := []T{}
+	for n := 0; dec.More(); n++ {
+		var rec T
+		if err := dec.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("failed to decode %s record %d: %w", what, n, err)
+		}
+		if keep != nil && !keep(rec) {
+			continue
+		}
+		if backendMaxRecords > 0 && len(out) == backendMaxRecords {
+			return nil, errTooManyRecords(what)
+		}
+		out = append(out, rec)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", what, err)
+	}
+	return out, nil
+}
+
+// cappedBuffer keeps what is written to it until the total would pass max, then drops it.
+// Writes never fail, so it can sit behind an io.TeeReader.
+type cappedBuffer struct {
+	buf  bytes.Buffer
+	max  int
+	over bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if !b.over && b.buf.Len()+len(p) > b.max {
+		b.over = true
+		b.buf = bytes.Buffer{}
+	}
+	if !b.over {
+		b.buf.Write(p)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ===== "Did you mean" suggestions =====
+//
+// A namespace or provider filter that names nothing the backend has ever returned yields an
+// empty answer, which looks the same as "nothing cost anything". Every read through costSource
+// records the namespaces and providers it saw; after filtering, handlers check the filter
+// values against them and raise an unknown_value warning for each one never seen, with the
+// closest observed values by Levenshtein distance in suggestions:
+//
+//	{"code": "unknown_value", "field": "namespace", "message": "...", "suggestions": ["prod"]}
+//
+// An unknown provider is already a validation error; its message gets the same suggestion.
+// When no namespace has been seen yet (a first query for one namespace only fetches that
+// one), the check reads allocations once, unfiltered, to learn them; a dry run doesn't.
+// Tenants are only offered what they may see.
+
+// observedValues is what the backend has returned so far.
+type observedValues struct {
+	mu         sync.Mutex
+	namespaces map[string]bool
+	providers  map[string]bool
+	seeded     bool // the unfiltered read for namespaces was tried
+}
+
+var observed = &observedValues{namespaces: map[string]bool{}, providers: map[string]bool{}}
+
+// observingSource records the values in every read.
+type observingSource struct {
+	inner CostSource
+}
+
+// enableObservation wraps costSource so reads feed suggestions.
+func enableObservation() {
+	costSource = &observingSource{inner: costSource}
+}
+
+func (s *observingSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	return s.inner.GetCloudCosts(ctx, f)
+}
+
+func (s *observingSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	data, err := s.inner.GetAllocations(ctx, f)
+	observed.mu.Lock()
+	for _, a := range data {
+		if a.Namespace != "" {
+			observed.namespaces[a.Namespace] = true
+		}
+	}
+	observed.mu.Unlock()
+	return data, err
+}
+
+func (s *observingSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	data, err := s.inner.GetAssets(ctx, f)
+	observed.mu.Lock()
+	for _, a := range data {
+		if a.Provider != "" {
+			observed.providers[a.Provider] = true
+		}
+	}
+	observed.mu.Unlock()
+	return data, err
+}
+
+// warnUnknownNamespaces warns about each plain term of f that names no observed namespace.
+func warnUnknownNamespaces(ctx context.Context, f namespaceFilter) {
+	if len(f.includes) == 0 && len(f.excludes) == 0 {
+		return
+	}
+	observed.mu.Lock()
+	seed := len(observed.namespaces) == 0 && !observed.seeded && !explainFrom(ctx).dryRun()
+	observed.seeded = observed.seeded || seed
+	observed.mu.Unlock()
+	if seed {
+		costSource.GetAllocations(ctx, AllocationFilter{})
+	}
+	observed.mu.Lock()
+	known := make([]string, 0, len(observed.namespaces))
+	for ns := range observed.namespaces {
+		known = append(known, ns)
+	}
+	observed.mu.Unlock()
+	if t := tenantFrom(ctx); t != nil {
+		known = slices.DeleteFunc(known, func(ns string) bool { return !t.allowsNamespace(ns) })
+	}
+	if len(known) == 0 {
+		return
+	}
+	for _, term := range append(append([]nsTerm{}, f.includes...), f.excludes...) {
+		if term.re != nil || slices.Contains(known, term.name) {
+			continue
+		}
+		warnUnknownValue(ctx, "namespace", term.name, "backend data has no namespace %q", known)
+	}
+}
+
+// warnUnknownProvider warns when provider is a known provider that no asset has come from.
+func warnUnknownProvider(ctx context.Context, provider string) {
+	if provider == "" {
+		return
+	}
+	observed.mu.Lock()
+	known := make([]string, 0, len(observed.providers))
+	for p := range observed.providers {
+		known = append(known, p)
+	}
+	observed.mu.Unlock()
+	if t := tenantFrom(ctx); t != nil {
+		known = slices.DeleteFunc(known, func(p string) bool { return !t.allowsProvider(p) })
+	}
+	if len(known) == 0 || slices.ContainsFunc(known, func(p string) bool { return strings.EqualFold(p, provider) }) {
+		return
+	}
+	sort.Strings(known)
+	addWarning(ctx, "unknown_value", "provider", "backend data has no assets from %s; it has %s", provider, strings.Join(known, ", "))
+}
+
+// warnUnknownValue raises unknown_value for value with the closest of known as suggestions.
+func warnUnknownValue(ctx context.Context, field, value, format string, known []string) {
+	msg := fmt.Sprintf(format, value)
+	suggestions := closestMatches(value, known, 3)
+	if len(suggestions) > 0 {
+		msg += "; did you mean " + strings.Join(suggestions, " or ") + "?"
+	}
+	addWarningWith(ctx, Warning{Code: "unknown_value", Field: field, Message: msg, Suggestions: suggestions})
+}
+
+// closestMatches returns up to n of candidates within editing distance of value, nearest
+// first. Close means a third of the value's length, at least 2, and case is ignored; a
+// candidate that contains value or is contained in it also counts ("pro" → "prod").
+func closestMatches(value string, candidates []string, n int) []string {
+	v := strings.ToLower(value)
+	limit := max(2, len([]rune(v))/3)
+	type scored struct {
+		name string
+		d    int
+	}
+	var near []scored
+	for _, c := range candidates {
+		lc := strings.ToLower(c)
+		d := levenshtein(v, lc)
+		if d > limit && !(len(v) >= 3 && (strings.Contains(lc, v) || strings.Contains(v, lc))) {
+			continue
+		}
+		near = append(near, scored{c, d})
+	}
+	sort.Slice(near, func(i, j int) bool {
+		if near[i].d != near[j].d {
+			return near[i].d < near[j].d
+		}
+		return near[i].name < near[j].name
+	})
+	out := []string{}
+	for _, s := range near[:min(n, len(near))] {
+		out = append(out, s.name)
+	}
+	return out
+}
+
+// levenshtein is the edit distance between a and b in runes.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
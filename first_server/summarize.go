@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ===== Summaries =====
+//
+// summarize=true adds a short plain-English "summary" string next to data; summarize=only
+// returns the summary instead of data. Summaries are built from the response itself (plus,
+// for allocations with a window, the preceding window), so the same data always yields the
+// same text, and an agent can quote it without reading every record.
+
+// SummarizeMode is "" (no summary), "true" (summary alongside data) or "only". JSON accepts
+// a boolean as well as the strings.
+type SummarizeMode string
+
+const (
+	SummarizeOff  SummarizeMode = ""
+	SummarizeOn   SummarizeMode = "true"
+	SummarizeOnly SummarizeMode = "only"
+)
+
+func (m *SummarizeMode) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+		*m = SummarizeOff
+	case bool:
+		*m = SummarizeOff
+		if v {
+			*m = SummarizeOn
+		}
+	case string:
+		*m = SummarizeMode(v)
+	default:
+		return fmt.Errorf("summarize must be true, false or \"only\"")
+	}
+	return nil
+}
+
+// summaryTopN is how many top spenders a summary names.
+const summaryTopN = 3
+
+// notableChangePercent is the change against the preceding window worth mentioning.
+const notableChangePercent = 20
+
+// validateSummarize normalizes m ("false" means off) and checks it is a known mode.
+func validateSummarize(errs *ValidationErrors, m *SummarizeMode) {
+	switch *m {
+	case SummarizeOff, SummarizeOn, SummarizeOnly:
+	case "false":
+		*m = SummarizeOff
+	default:
+		errs.add("summarize", string(*m), "must be true, false or only")
+	}
+}
+
+// applySummary attaches text to resp, dropping data for SummarizeOnly.
+func applySummary(resp map[string]interface{}, mode SummarizeMode, text string) {
+	if mode == SummarizeOff {
+		return
+	}
+	resp["summary"] = text
+	if mode == SummarizeOnly {
+		delete(resp, "data")
+	}
+}
+
+func money(v float64) string { return fmt.Sprintf("$%.2f", v) }
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return fmt.Sprintf("%d %s", n, many)
+}
+
+// topShares lists the largest entries of totals as "name $x (y%)", largest first.
+func topShares(totals map[string]float64, total float64) string {
+	names := make([]string, 0, len(totals))
+	for name := range totals {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if totals[names[i]] != totals[names[j]] {
+			return totals[names[i]] > totals[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > summaryTopN {
+		names = names[:summaryTopN]
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + " " + money(totals[name])
+		if total > 0 {
+			parts[i] += fmt.Sprintf(" (%.0f%%)", totals[name]/total*100)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// summarizeAllocations describes allocations in [start, end]. changes, when non-nil, are the
+// per-namespace deltas against the preceding window; only notable ones are mentioned.
+func summarizeAllocations(allocs []Allocation, start, end string, changes []NamespaceDelta) string {
+	period := ""
+	if start != "" && end != "" {
+		period = fmt.Sprintf(" between %s and %s", start, end)
+	}
+	if len(allocs) == 0 {
+		return "No allocations matched the filters" + period + "."
+	}
+
+	var cpu, mem, gpu, network, pv, total float64
+	byNS := map[string]float64{}
+	for _, a := range allocs {
+		cpu += a.CPUCost
+		mem += a.MemoryCost
+		gpu += a.GPUCost
+		network += a.NetworkCost
+		pv += a.PVCost
+		total += a.TotalCost
+		byNS[a.Namespace] += a.TotalCost
+	}
+	// Network and storage are only mentioned when present, since many backends don't report them.
+	extra := ""
+	if network > 0 {
+		extra += ", network " + money(network)
+	}
+	if pv > 0 {
+		extra += ", storage " + money(pv)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s across %s cost %s%s (CPU %s, memory %s, GPU %s%s). ",
+		plural(len(allocs), "allocation", "allocations"), plural(len(byNS), "namespace", "namespaces"),
+		money(total), period, money(cpu), money(mem), money(gpu), extra)
+	fmt.Fprintf(&b, "Top spenders: %s.", topShares(byNS, total))
+
+	if changes != nil {
+		var notable []string
+		for _, d := range changes {
+			switch {
+			case d.Change == "new":
+				notable = append(notable, fmt.Sprintf("%s is new (%s)", d.Namespace, money(d.CurrentCost)))
+			case d.Change == "removed":
+				notable = append(notable, fmt.Sprintf("%s had no cost (was %s)", d.Namespace, money(d.BaselineCost)))
+			case d.PercentChange != nil && math.Abs(*d.PercentChange) >= notableChangePercent:
+				dir := "up"
+				if d.Delta < 0 {
+					dir = "down"
+				}
+				notable = append(notable, fmt.Sprintf("%s %s %.0f%% (%s to %s)",
+					d.Namespace, dir, math.Abs(*d.PercentChange), money(d.BaselineCost), money(d.CurrentCost)))
+			}
+		}
+		if len(notable) == 0 {
+			b.WriteString(" No namespace changed notably against the preceding window.")
+		} else {
+			fmt.Fprintf(&b, " Against the preceding window: %s.", strings.Join(notable, "; "))
+		}
+	}
+	return b.String()
+}
+
+// summarizeCloudCosts describes cloud cost line items.
+func summarizeCloudCosts(costs []CloudCost) string {
+	if len(costs) == 0 {
+		return "No cloud costs matched the filters."
+	}
+	var cpu, gpu, total float64
+	byName := map[string]float64{}
+	for _, c := range costs {
+		cpu += c.CPUCost
+		gpu += c.GPUCost
+		total += c.TotalCost
+		byName[c.Name] += c.TotalCost
+	}
+	return fmt.Sprintf("%s cost %s (CPU %s, GPU %s). Largest: %s.",
+		plural(len(costs), "cloud cost item", "cloud cost items"), money(total), money(cpu), money(gpu), topShares(byName, total))
+}
+
+// summarizeAssets describes assets by provider and names the most expensive ones.
+func summarizeAssets(assets []Asset) string {
+	if len(assets) == 0 {
+		return "No assets matched the filters."
+	}
+	var total float64
+	byProvider := map[string]float64{}
+	byAsset := map[string]float64{}
+	for _, a := range assets {
+		total += a.Cost
+		byProvider[a.Provider] += a.Cost
+		byAsset[fmt.Sprintf("%s (%s, %s)", a.Name, a.Type, a.Region)] += a.Cost
+	}
+	return fmt.Sprintf("%s cost %s. By provider: %s. Most expensive: %s.",
+		plural(len(assets), "asset", "assets"), money(total), topShares(byProvider, total), topShares(byAsset, total))
+}
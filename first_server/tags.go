@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ===== Asset tags =====
+//
+// Assets carry their provider's resource tags (GCP labels, Azure tags, whatever the OpenCost
+// backend reports) in tags. /assets narrows them with the tag filter (tag, or filters.tag):
+// key=value pairs and bare keys, comma-separated, all of which must match; keys compare
+// exactly and values ignoring case. The expr filter reads tags as tags.<key>.
+//
+// group_by on /assets (a list in POST bodies, comma-separated on GET) answers with nested
+// asset cost groups instead of assets, e.g. group_by=tag:owner for cost by owner:
+//
+//	provider, region, type, status   the asset's own fields (status as in lifecycle.go)
+//	tag:<key>                        any tag, e.g. tag:owner or tag:env
+//
+// Assets without a value land in "untagged".
+
+// untaggedValue is the group of assets without a value for a dimension.
+const untaggedValue = "untagged"
+
+// tagCondition is one entry of the tag filter; an empty value only requires the key.
+type tagCondition struct {
+	key, value string
+	hasValue   bool
+}
+
+// parseTagFilter splits the tag filter into its conditions, recording malformed ones under
+// field.
+func parseTagFilter(errs *ValidationErrors, field, v string) []tagCondition {
+	var out []tagCondition
+	for _, part := range splitList(v) {
+		key, value, hasValue := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			errs.add(field, part, "must be key=value or a bare key, e.g. owner=platform")
+			continue
+		}
+		out = append(out, tagCondition{key: key, value: strings.TrimSpace(value), hasValue: hasValue})
+	}
+	return out
+}
+
+// matchesTags reports whether tags satisfy every condition.
+func matchesTags(tags map[string]string, conds []tagCondition) bool {
+	for _, c := range conds {
+		v, ok := tags[c.key]
+		if !ok || c.hasValue && !strings.EqualFold(v, c.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// AssetGroup is one group of assets at one level of an /assets grouping.
+type AssetGroup struct {
+	Dimension string       `json:"dimension"`
+	Value     string       `json:"value"`
+	Cost      float64      `json:"cost"`
+	Assets    int          `json:"assets"`
+	Groups    []AssetGroup `json:"groups,omitempty"`
+
+	children map[string]*AssetGroup
+}
+
+// validateAssetGroupBy checks the /assets dimensions are known, distinct and not too many.
+func validateAssetGroupBy(errs *ValidationErrors, dims []string) {
+	if len(dims) > maxGroupByDimensions {
+		errs.add("group_by", strings.Join(dims, ","), fmt.Sprintf("at most %d dimensions", maxGroupByDimensions))
+	}
+	seen := map[string]bool{}
+	for _, d := range dims {
+		switch key, isTag := strings.CutPrefix(d, "tag:"); {
+		case isTag && key == "":
+			errs.add("group_by", d, "tag: needs a tag key, e.g. tag:owner")
+		case !isTag && d != "provider" && d != "region" && d != "type" && d != "status":
+			errs.add("group_by", d, "must be provider, region, type, status or tag:<key>")
+		}
+		if seen[d] {
+			errs.add("group_by", d, "appears twice")
+		}
+		seen[d] = true
+	}
+}
+
+// assetDimension is a's value for a grouping dimension.
+func assetDimension(a Asset, dim string) string {
+	var v string
+	switch dim {
+	case "provider":
+		v = a.Provider
+	case "region":
+		v = a.Region
+	case "type":
+		v = a.Type
+	case "status":
+		v = assetStatus(a)
+	default:
+		v = a.Tags[strings.TrimPrefix(dim, "tag:")]
+	}
+	if v == "" {
+		return untaggedValue
+	}
+	return v
+}
+
+// groupAssets aggregates assets along dims into nested groups, most expensive first.
+func groupAssets(assets []Asset, dims []string) []AssetGroup {
+	root := map[string]*AssetGroup{}
+	for _, a := range assets {
+		level := root
+		for _, d := range dims {
+			v := assetDimension(a, d)
+			g, ok := level[v]
+			if !ok {
+				g = &AssetGroup{Dimension: d, Value: v, children: map[string]*AssetGroup{}}
+				level[v] = g
+			}
+			g.Cost += a.Cost
+			g.Assets++
+			level = g.children
+		}
+	}
+	return sortedAssetGroups(root)
+}
+
+func sortedAssetGroups(children map[string]*AssetGroup) []AssetGroup {
+	if len(children) == 0 {
+		return nil
+	}
+	out := make([]AssetGroup, 0, len(children))
+	for _, c := range children {
+		c.Cost = round2(c.Cost)
+		c.Groups = sortedAssetGroups(c.children)
+		c.children = nil
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Cost != out[j].Cost {
+			return out[i].Cost > out[j].Cost
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TeamMapping attributes allocations to teams. Label rules ("key=value") are checked first,
+// then the namespace table; anything unmatched is attributed to Default.
+//
+// Example file (path given by TEAM_MAPPING_FILE):
+//
+//	{
+//	  "labels":     {"team=payments": "payments", "app=checkout": "payments"},
+//	  "namespaces": {"prod": "platform", "dev": "developer-experience"},
+//	  "default":    "unassigned"
+//	}
+type TeamMapping struct {
+	Labels     map[string]string `json:"labels,omitempty"`
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+	Default    string            `json:"default,omitempty"`
+}
+
+// teamMapping is the active mapping, loaded once at startup.
+var teamMapping = TeamMapping{Default: "unassigned"}
+
+// loadTeamMapping reads a TeamMapping from a JSON file. An empty path keeps the built-in
+// mapping, which attributes everything to "unassigned".
+func loadTeamMapping(path string) error {
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read team mapping: %w", err)
+	}
+	var m TeamMapping
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return fmt.Errorf("failed to parse team mapping %s: %w", path, err)
+	}
+	if m.Default == "" {
+		m.Default = "unassigned"
+	}
+	teamMapping = m
+	log.Printf("[MCP] Loaded team mapping from %s (%d label rules, %d namespaces)\n", path, len(m.Labels), len(m.Namespaces))
+	return nil
+}
+
+// teamFor returns the team an allocation is attributed to and the rule that matched
+// ("label:key=value", "namespace:name", or "default").
+func (m TeamMapping) teamFor(alloc Allocation) (team, rule string) {
+	// Sort label keys so attribution is deterministic when several rules match.
+	keys := make([]string, 0, len(alloc.Labels))
+	for k := range alloc.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		selector := k + "=" + alloc.Labels[k]
+		if t, ok := m.Labels[selector]; ok {
+			return t, "label:" + selector
+		}
+	}
+	if t, ok := m.Namespaces[alloc.Namespace]; ok {
+		return t, "namespace:" + alloc.Namespace
+	}
+	return m.Default, "default"
+}
+
+// TeamCost is the aggregated cost for one team.
+type TeamCost struct {
+	Team        string   `json:"team"`
+	Namespaces  []string `json:"namespaces"`
+	Allocations int      `json:"allocations"`
+	CPUCost     float64  `json:"cpu_cost"`
+	MemoryCost  float64  `json:"memory_cost"`
+	GPUCost     float64  `json:"gpu_cost"`
+	NetworkCost float64  `json:"network_cost"`
+	PVCost      float64  `json:"pv_cost"`
+	TotalCost   float64  `json:"total_cost"`
+
+	SharePct        float64 `json:"share_pct"`          // of the teams returned; see share.go
+	ShareOfTotalPct float64 `json:"share_of_total_pct"` // of all teams
+}
+
+// aggregateByTeam groups allocations by team, ordered by descending total cost.
+func aggregateByTeam(allocs []Allocation, m TeamMapping) []TeamCost {
+	byTeam := map[string]*TeamCost{}
+	seenNS := map[string]map[string]bool{}
+	for _, alloc := range allocs {
+		team, _ := m.teamFor(alloc)
+		tc, ok := byTeam[team]
+		if !ok {
+			tc = &TeamCost{Team: team, Namespaces: []string{}}
+			byTeam[team] = tc
+			seenNS[team] = map[string]bool{}
+		}
+		if !seenNS[team][alloc.Namespace] {
+			seenNS[team][alloc.Namespace] = true
+			tc.Namespaces = append(tc.Namespaces, alloc.Namespace)
+		}
+		tc.Allocations++
+		tc.CPUCost += alloc.CPUCost
+		tc.MemoryCost += alloc.MemoryCost
+		tc.GPUCost += alloc.GPUCost
+		tc.NetworkCost += alloc.NetworkCost
+		tc.PVCost += alloc.PVCost
+		tc.TotalCost += alloc.TotalCost
+	}
+
+	teams := make([]TeamCost, 0, len(byTeam))
+	for _, tc := range byTeam {
+		sort.Strings(tc.Namespaces)
+		tc.CPUCost, tc.MemoryCost, tc.GPUCost, tc.TotalCost = round2(tc.CPUCost), round2(tc.MemoryCost), round2(tc.GPUCost), round2(tc.TotalCost)
+		tc.NetworkCost, tc.PVCost = round2(tc.NetworkCost), round2(tc.PVCost)
+		teams = append(teams, *tc)
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		if teams[i].TotalCost != teams[j].TotalCost {
+			return teams[i].TotalCost > teams[j].TotalCost
+		}
+		return teams[i].Team < teams[j].Team
+	})
+	return teams
+}
+
+// costsByTeamHandler handles GET and POST requests to /costs/by-team.
+// Fetches allocations for the window and aggregates them per team using teamMapping.
+func costsByTeamHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /costs/by-team request received")
+
+	start := r.URL.Query().Get("start")
+	end := r.URL.Query().Get("end")
+	team := r.URL.Query().Get("team")
+	window := r.URL.Query().Get("window")
+	timezone := r.URL.Query().Get("timezone")
+	queryText := ""
+	stats := false
+	sessionID := ""
+	previous := ""
+	history := []string{}
+
+	if r.Method == http.MethodPost {
+		var aq AgenticQuery
+		if !decodeJSON(w, r, &aq) {
+			return
+		}
+		if !checkSessionTenant(w, r, aq.Context.SessionID) {
+			return
+		}
+		start = aq.Filters.Start
+		end = aq.Filters.End
+		window = aq.Filters.Window
+		timezone = aq.Filters.Timezone
+		queryText = aq.Query
+		sessionID = aq.Context.SessionID
+		stats = aq.Context.SessionStats
+		previous, history = recordQuery(r.Context(), sessionID, "costs/by-team", aq.Query, aq.Filters)
+		warnIgnoredFilters(r.Context(), "/costs/by-team", aq.Filters, "start", "end", "window", "timezone")
+		logf(r.Context(), "[MCP] Parsed agentic POST query: %+v\n", aq)
+	}
+
+	var verrs ValidationErrors
+	loc := loadTimezone(&verrs, "timezone", timezone)
+	resolved := applyWindow(&verrs, window, queryText, &start, &end, time.Now(), loc)
+	validateWindow(&verrs, start, end)
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+
+	data, err := costSource.GetAllocations(r.Context(), AllocationFilter{Start: start, End: end})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations", err)
+		return
+	}
+
+	teams := aggregateByTeam(data, teamMapping)
+	if team != "" {
+		filtered := []TeamCost{}
+		for _, tc := range teams {
+			if strings.EqualFold(tc.Team, team) {
+				filtered = append(filtered, tc)
+			}
+		}
+		teams = filtered
+	}
+	grand := sumTotalCost(data)
+	var filteredTotal float64
+	for _, tc := range teams {
+		filteredTotal += tc.TotalCost
+	}
+	for i := range teams {
+		teams[i].SharePct = sharePct(teams[i].TotalCost, filteredTotal)
+		teams[i].ShareOfTotalPct = sharePct(teams[i].TotalCost, grand)
+	}
+	logf(r.Context(), "[MCP] /costs/by-team — %d allocations across %d teams\n", len(data), len(teams))
+
+	meta := map[string]interface{}{
+		"filtersUsed":          map[string]string{"start": start, "end": end, "team": team},
+		"session_id":           sessionID,
+		"previous_query":       previous,
+		"conversation_context": history,
+		"total":                len(teams),
+		"timezone":             loc.String(),
+		"request_id":           requestIDFrom(r.Context()),
+	}
+	shareMeta(meta, filteredTotal, grand)
+	if resolved != nil {
+		meta["window"] = resolved
+	}
+	resp := map[string]interface{}{"data": teams, "meta": meta}
+	addSessionStats(resp, sessionID, stats)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ===== Tenants =====
+//
+// With TENANTS_FILE set, every request must carry "Authorization: Bearer <api key>" and the key
+// picks a tenant. A tenant only sees its own slice of cost data: allocations in its namespaces,
+// cloud costs whose name embeds one of them, and assets of its providers. Filters that name
+// something outside the allowlist are refused with 403; unfiltered requests are narrowed to it.
+//
+// Example file:
+//
+//	{
+//	  "tenants": [
+//	    {"name": "payments", "api_keys": ["k-pay-1"], "namespaces": ["payments", "/^checkout-/"], "providers": ["AWS"]},
+//	    {"name": "platform", "api_keys": ["k-plat-1"], "role": "admin"}
+//	  ]
+//	}
+//
+// Namespaces take the same terms as namespace filters (names and /regexes/). An empty list
+// allows everything, so platform above sees all cost data.
+
+// Tenant is one caller's allowlist.
+type Tenant struct {
+	Name       string   `json:"name"`
+	APIKeys    []string `json:"api_keys"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	Providers  []string `json:"providers,omitempty"`
+	Role       string   `json:"role,omitempty"` // viewer (default), analyst or admin
+
+	namespaces namespaceFilter
+	role       role
+}
+
+// tenants is the loaded configuration; nil disables tenancy.
+var tenants []*Tenant
+
+type tenantKey struct{}
+
+// loadTenants reads TENANTS_FILE. An empty path leaves tenancy off.
+func loadTenants(path string) error {
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read tenants: %w", err)
+	}
+	var cfg struct {
+		Tenants []*Tenant `json:"tenants"`
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return fmt.Errorf("failed to parse tenants %s: %w", path, err)
+	}
+	if len(cfg.Tenants) == 0 {
+		return fmt.Errorf("%s defines no tenants", path)
+	}
+	keys := map[string]string{}
+	for i, t := range cfg.Tenants {
+		if t.Name == "" {
+			return fmt.Errorf("tenant %d has no name", i)
+		}
+		if len(t.APIKeys) == 0 {
+			return fmt.Errorf("tenant %s has no api_keys", t.Name)
+		}
+		for _, k := range t.APIKeys {
+			if k == "" {
+				return fmt.Errorf("tenant %s has an empty api key", t.Name)
+			}
+			if other, ok := keys[k]; ok {
+				return fmt.Errorf("tenants %s and %s share an api key", other, t.Name)
+			}
+			keys[k] = t.Name
+		}
+		if t.role, err = parseRole(t.Role); err != nil {
+			return fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+		var verrs ValidationErrors
+		t.namespaces = parseNamespaceFilter(&verrs, "namespaces", strings.Join(t.Namespaces, ","))
+		for _, p := range t.Providers {
+			validateProvider(&verrs, p)
+		}
+		if len(verrs) > 0 {
+			return fmt.Errorf("tenant %s: %w", t.Name, verrs)
+		}
+	}
+	tenants = cfg.Tenants
+	costSource = &tenantSource{inner: costSource}
+	log.Printf("[MCP] Loaded %d tenants from %s\n", len(tenants), path)
+	return nil
+}
+
+// tenantForKey returns the tenant owning key, comparing every key in constant time.
+func tenantForKey(key string) *Tenant {
+	var found *Tenant
+	for _, t := range tenants {
+		for _, k := range t.APIKeys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+				found = t
+			}
+		}
+	}
+	return found
+}
+
+// tenantByName returns the configured tenant called name, or nil.
+func tenantByName(name string) *Tenant {
+	for _, t := range tenants {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// tenantFrom returns the request's tenant, or nil when tenancy is off (or for background
+// jobs, which see everything).
+func tenantFrom(ctx context.Context) *Tenant {
+	t, _ := ctx.Value(tenantKey{}).(*Tenant)
+	return t
+}
+
+// withTenants resolves the caller's API key to a tenant. The admin API has its own token,
+// Slack requests are signed (see slack.go) and /metrics is left open for scrapers.
+func withTenants(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenants == nil || strings.HasPrefix(r.URL.Path, "/admin/") || strings.HasPrefix(r.URL.Path, "/slack/") || r.URL.Path == "/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		t := tenantForKey(key)
+		if key == "" || t == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="costs"`)
+			writeError(w, r, http.StatusUnauthorized, ErrCodeUnauthorized, "missing or invalid API key", nil)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, t)))
+	})
+}
+
+// allowsNamespace reports whether the tenant may see namespace ns.
+func (t *Tenant) allowsNamespace(ns string) bool { return t.namespaces.matches(ns) }
+
+// allowsProvider reports whether the tenant may see provider p.
+func (t *Tenant) allowsProvider(p string) bool {
+	if len(t.Providers) == 0 {
+		return true
+	}
+	for _, allowed := range t.Providers {
+		if strings.EqualFold(allowed, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTenant responds with 403 when the request's namespace filter names a namespace, or
+// provider names a provider, outside the tenant's allowlist. Regex terms aren't checked
+// here; their results are narrowed like unfiltered ones.
+func checkTenant(w http.ResponseWriter, r *http.Request, nsFilter namespaceFilter, provider string) bool {
+	t := tenantFrom(r.Context())
+	if t == nil {
+		return true
+	}
+	var denied ValidationErrors
+	for _, term := range nsFilter.includes {
+		if term.re == nil && !t.allowsNamespace(term.name) {
+			denied.add("namespace", term.name, "not allowed for tenant "+t.Name+"; allowed: "+strings.Join(t.Namespaces, ", "))
+		}
+	}
+	if provider != "" && !t.allowsProvider(provider) {
+		denied.add("provider", provider, "not allowed for tenant "+t.Name+"; allowed: "+strings.Join(t.Providers, ", "))
+	}
+	if len(denied) == 0 {
+		return true
+	}
+	logf(r.Context(), "[MCP] %s — tenant %s denied: %v\n", r.URL.Path, t.Name, denied)
+	writeError(w, r, http.StatusForbidden, ErrCodeForbidden, "request is outside the allowlist of tenant "+t.Name, denied)
+	return false
+}
+
+// tenantSource narrows every read to the calling tenant, so handlers that aggregate
+// (reports, teams, alerts) can't leak other tenants' data either.
+type tenantSource struct {
+	inner CostSource
+}
+
+func (s *tenantSource) GetCloudCosts(ctx context.Context, f CloudCostFilter) ([]CloudCost, error) {
+	data, err := s.inner.GetCloudCosts(ctx, f)
+	t := tenantFrom(ctx)
+	if err != nil || t == nil {
+		return data, err
+	}
+	out := []CloudCost{}
+	for _, c := range data {
+		if t.namespaces.matchesName(c.Name) {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+func (s *tenantSource) GetAllocations(ctx context.Context, f AllocationFilter) ([]Allocation, error) {
+	data, err := s.inner.GetAllocations(ctx, f)
+	t := tenantFrom(ctx)
+	if err != nil || t == nil {
+		return data, err
+	}
+	out := []Allocation{}
+	for _, a := range data {
+		if t.allowsNamespace(a.Namespace) {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func (s *tenantSource) GetAssets(ctx context.Context, f AssetFilter) ([]Asset, error) {
+	data, err := s.inner.GetAssets(ctx, f)
+	t := tenantFrom(ctx)
+	if err != nil || t == nil {
+		return data, err
+	}
+	out := []Asset{}
+	for _, a := range data {
+		if t.allowsProvider(a.Provider) {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useTenants replaces the loaded tenants for the rest of the test.
+func useTenants(t *testing.T, list []*Tenant) {
+	t.Helper()
+	saved := tenants
+	t.Cleanup(func() { tenants = saved })
+	tenants = list
+}
+
+// testTenant returns a tenant with one API key, its role and namespaces parsed as
+// loadTenants would.
+func testTenant(t *testing.T, name, key string, ro role, namespaces ...string) *Tenant {
+	t.Helper()
+	var verrs ValidationErrors
+	tn := &Tenant{Name: name, APIKeys: []string{key}, Namespaces: namespaces, role: ro,
+		namespaces: parseNamespaceFilter(&verrs, "namespaces", strings.Join(namespaces, ","))}
+	if len(verrs) > 0 {
+		t.Fatal(verrs)
+	}
+	return tn
+}
+
+func TestWithTenants(t *testing.T) {
+	payments := testTenant(t, "payments", "k-pay", roleViewer, "payments", "/^checkout-/")
+	useTenants(t, []*Tenant{payments, testTenant(t, "platform", "k-plat", roleAdmin)})
+
+	tests := []struct {
+		name, path, auth string
+		status           int
+		tenant           string // seen by the handler; "" for none
+	}{
+		{"valid key", "/allocations", "Bearer k-pay", http.StatusOK, "payments"},
+		{"other tenant", "/allocations", "Bearer k-plat", http.StatusOK, "platform"},
+		{"missing key", "/allocations", "", http.StatusUnauthorized, ""},
+		{"unknown key", "/allocations", "Bearer k-nope", http.StatusUnauthorized, ""},
+		{"not bearer", "/allocations", "Basic k-pay", http.StatusUnauthorized, ""},
+		{"empty bearer", "/allocations", "Bearer ", http.StatusUnauthorized, ""},
+		{"admin API", "/admin/sessions", "", http.StatusOK, ""},
+		{"slack", "/slack/events", "", http.StatusOK, ""},
+		{"metrics", "/metrics", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := "unset"
+			h := withTenants(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = tenantName(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusUnauthorized {
+				if seen != "unset" {
+					t.Error("the handler ran for an unauthorized request")
+				}
+				if got := w.Header().Get("WWW-Authenticate"); got != `Bearer realm="costs"` {
+					t.Errorf("WWW-Authenticate = %q", got)
+				}
+				return
+			}
+			if seen != tt.tenant {
+				t.Errorf("handler saw tenant %q, want %q", seen, tt.tenant)
+			}
+		})
+	}
+}
+
+func TestWithTenantsOff(t *testing.T) {
+	useTenants(t, nil)
+	var called bool
+	h := withTenants(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = tenantFrom(r.Context()) == nil
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/allocations", nil))
+	if w.Code != http.StatusOK || !called {
+		t.Errorf("status %d, handler called without a tenant: %v", w.Code, called)
+	}
+}
+
+func TestTenantAllows(t *testing.T) {
+	tn := testTenant(t, "payments", "k", roleViewer, "payments", "/^checkout-/")
+	tn.Providers = []string{"AWS"}
+	for ns, want := range map[string]bool{"payments": true, "checkout-eu": true, "payments-dev": false, "dev": false} {
+		if got := tn.allowsNamespace(ns); got != want {
+			t.Errorf("allowsNamespace(%q) = %v, want %v", ns, got, want)
+		}
+	}
+	for p, want := range map[string]bool{"AWS": true, "aws": true, "GCP": false} {
+		if got := tn.allowsProvider(p); got != want {
+			t.Errorf("allowsProvider(%q) = %v, want %v", p, got, want)
+		}
+	}
+	all := testTenant(t, "platform", "k2", roleAdmin)
+	if !all.allowsNamespace("anything") || !all.allowsProvider("Azure") {
+		t.Error("a tenant without allowlists should see everything")
+	}
+}
+
+func TestLoadTenants(t *testing.T) {
+	tests := []struct {
+		name, file, want string // want is part of the error, "" for none
+	}{
+		{"valid", `{"tenants": [{"name": "a", "api_keys": ["k1"], "namespaces": ["a", "/^a-/"], "role": "Analyst"}, {"name": "b", "api_keys": ["k2"]}]}`, ""},
+		{"not json", `tenants: []`, "failed to parse tenants"},
+		{"no tenants", `{"tenants": []}`, "defines no tenants"},
+		{"no name", `{"tenants": [{"api_keys": ["k1"]}]}`, "tenant 0 has no name"},
+		{"no keys", `{"tenants": [{"name": "a"}]}`, "tenant a has no api_keys"},
+		{"empty key", `{"tenants": [{"name": "a", "api_keys": [""]}]}`, "tenant a has an empty api key"},
+		{"shared key", `{"tenants": [{"name": "a", "api_keys": ["k"]}, {"name": "b", "api_keys": ["k"]}]}`, "tenants a and b share an api key"},
+		{"bad role", `{"tenants": [{"name": "a", "api_keys": ["k"], "role": "owner"}]}`, `tenant a: unknown role "owner"`},
+		{"bad regex", `{"tenants": [{"name": "a", "api_keys": ["k"], "namespaces": ["/(/"]}]}`, "tenant a:"},
+		{"bad provider", `{"tenants": [{"name": "a", "api_keys": ["k"], "providers": ["IBM"]}]}`, "tenant a:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTenants(t, nil)
+			savedSource := costSource
+			t.Cleanup(func() { costSource = savedSource })
+			path := filepath.Join(t.TempDir(), "tenants.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			err := loadTenants(path)
+			if tt.want != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.want)
+				}
+				if tenants != nil {
+					t.Error("tenants were set despite the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tenants) != 2 || tenants[0].role != roleAnalyst || tenants[1].role != roleViewer {
+				t.Fatalf("got %d tenants with roles %v, %v", len(tenants), tenants[0].role, tenants[1].role)
+			}
+			if got := tenantForKey("k2"); got != tenants[1] {
+				t.Errorf("tenantForKey(k2) = %v, want tenant b", got)
+			}
+			if tenantForKey("k3") != nil || tenantForKey("") != nil {
+				t.Error("an unknown key found a tenant")
+			}
+		})
+	}
+	if err := loadTenants(""); err != nil {
+		t.Errorf("an empty path should leave tenancy off, got %v", err)
+	}
+}
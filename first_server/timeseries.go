@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"costtypes"
+)
+
+// resolutions maps the allowed resolution values to bucket widths.
+var resolutions = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+// maxSeriesBuckets caps the points per series so an hourly query over a year can't build
+// a multi-megabyte response.
+const maxSeriesBuckets = 2000
+
+// Time series records are shared with the CLI; see costtypes.NamespaceSeries.
+type (
+	TimeSeriesPoint = costtypes.TimeSeriesPoint
+	NamespaceSeries = costtypes.NamespaceSeries
+)
+
+// validateResolution checks that resolution, when set, is one of resolutions.
+func validateResolution(errs *ValidationErrors, resolution string) {
+	if resolution == "" {
+		return
+	}
+	if _, ok := resolutions[resolution]; !ok {
+		errs.add("resolution", resolution, "must be one of day, hour")
+	}
+}
+
+// bucketStart returns the start of the bucket containing t: the local hour or local midnight
+// in loc. Working in wall-clock time keeps day buckets on midnight across DST changes and
+// hour buckets on the hour in zones with half-hour offsets.
+func bucketStart(t time.Time, resolution string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	hour := 0
+	if resolution == "hour" {
+		hour = t.Hour()
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, loc)
+}
+
+// nextBucket returns the start of the bucket after the one starting at bs. Days can be 23 or
+// 25 hours long when DST changes.
+func nextBucket(bs time.Time, resolution string) time.Time {
+	if resolution == "day" {
+		return bs.AddDate(0, 0, 1)
+	}
+	return bs.Add(resolutions[resolution])
+}
+
+// buildTimeSeries splits allocations into per-namespace buckets of the given resolution,
+// aligned to loc. An allocation spanning several buckets is pro-rated by overlap; the part
+// outside [start, end) is dropped. Zero start/end default to the span of the allocations.
+func buildTimeSeries(allocs []Allocation, resolution string, start, end time.Time, loc *time.Location) ([]NamespaceSeries, error) {
+
+	type span struct {
+		alloc    Allocation
+		from, to time.Time
+		instant  bool
+	}
+	var spans []span
+	var first, last time.Time
+	for _, a := range allocs {
+		from, err := time.Parse(time.RFC3339, a.StartTime)
+		if err != nil {
+			continue
+		}
+		to, err := time.Parse(time.RFC3339, a.EndTime)
+		if err != nil || !to.After(from) {
+			to = from
+		}
+		spans = append(spans, span{alloc: a, from: from, to: to, instant: to.Equal(from)})
+		if first.IsZero() || from.Before(first) {
+			first = from
+		}
+		if to.After(last) {
+			last = to
+		}
+	}
+	if start.IsZero() {
+		start = first
+	}
+	if end.IsZero() {
+		end = last
+	}
+	// bounds[i] and bounds[i+1] delimit bucket i
+	bounds := []time.Time{bucketStart(start, resolution, loc)}
+	for len(bounds) == 1 || bounds[len(bounds)-1].Before(end) {
+		if len(bounds) > maxSeriesBuckets {
+			n := int(end.Sub(bounds[0]) / resolutions[resolution])
+			return nil, fmt.Errorf("window needs about %d %s buckets; the limit is %d, so narrow the window or use a coarser resolution",
+				n, resolution, maxSeriesBuckets)
+		}
+		bounds = append(bounds, nextBucket(bounds[len(bounds)-1], resolution))
+	}
+	n := len(bounds) - 1
+
+	byNS := map[string]*NamespaceSeries{}
+	for _, s := range spans {
+		series, ok := byNS[s.alloc.Namespace]
+		if !ok {
+			series = &NamespaceSeries{Namespace: s.alloc.Namespace, Points: make([]TimeSeriesPoint, n)}
+			for i := range series.Points {
+				series.Points[i].Start = bounds[i].Format(time.RFC3339)
+				series.Points[i].End = bounds[i+1].Format(time.RFC3339)
+			}
+			byNS[s.alloc.Namespace] = series
+		}
+		for i := range series.Points {
+			bs, be := bounds[i], bounds[i+1]
+			var share float64
+			if s.instant {
+				if !s.from.Before(bs) && s.from.Before(be) {
+					share = 1
+				}
+			} else {
+				from, to := s.from, s.to
+				if from.Before(bs) {
+					from = bs
+				}
+				if to.After(be) {
+					to = be
+				}
+				if to.After(from) {
+					share = float64(to.Sub(from)) / float64(s.to.Sub(s.from))
+				}
+			}
+			if share == 0 {
+				continue
+			}
+			p := &series.Points[i]
+			p.CPUCost += s.alloc.CPUCost * share
+			p.MemoryCost += s.alloc.MemoryCost * share
+			p.GPUCost += s.alloc.GPUCost * share
+			p.NetworkCost += s.alloc.NetworkCost * share
+			p.PVCost += s.alloc.PVCost * share
+			p.TotalCost += s.alloc.TotalCost * share
+		}
+	}
+
+	out := make([]NamespaceSeries, 0, len(byNS))
+	for _, series := range byNS {
+		for i := range series.Points {
+			p := &series.Points[i]
+			series.TotalCost += p.TotalCost
+			p.CPUCost, p.MemoryCost, p.GPUCost, p.TotalCost = round2(p.CPUCost), round2(p.MemoryCost), round2(p.GPUCost), round2(p.TotalCost)
+			p.NetworkCost, p.PVCost = round2(p.NetworkCost), round2(p.PVCost)
+		}
+		series.TotalCost = round2(series.TotalCost)
+		out = append(out, *series)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Namespace < out[j].Namespace })
+	return out, nil
+}
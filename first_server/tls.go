@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ===== TLS =====
+//
+// The listener serves HTTPS when TLS_CERT_FILE and TLS_KEY_FILE are set; TLS_CLIENT_CA_FILE
+// additionally turns on client-certificate verification (mTLS). TLS_CLIENT_AUTH picks how
+// strict that is: "require" (default when a CA is given) or "optional".
+//
+// Downstream calls use backendClient, configured by BACKEND_TLS_CA_FILE, BACKEND_TLS_CERT_FILE,
+// BACKEND_TLS_KEY_FILE (client certificate for an mTLS-protected OpenCost), BACKEND_TLS_SERVER_NAME
+// and BACKEND_TLS_INSECURE_SKIP_VERIFY.
+
+// backendClient is the HTTP client for OpenCost and Prometheus requests; see pool.go for its
+// connection pool.
+var backendClient = &http.Client{Transport: http.DefaultTransport}
+
+// loadServerTLS returns the listener TLS config, or nil to serve plain HTTP.
+func loadServerTLS() (*tls.Config, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	caFile := os.Getenv("TLS_CLIENT_CA_FILE")
+	if certFile == "" && keyFile == "" {
+		if caFile != "" {
+			return nil, fmt.Errorf("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading server certificate: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("TLS_CLIENT_CA_FILE: %w", err)
+		}
+		cfg.ClientCAs = pool
+		switch mode := strings.ToLower(os.Getenv("TLS_CLIENT_AUTH")); mode {
+		case "", "require":
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		case "optional":
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("TLS_CLIENT_AUTH must be require or optional, got %q", mode)
+		}
+	} else if os.Getenv("TLS_CLIENT_AUTH") != "" {
+		return nil, fmt.Errorf("TLS_CLIENT_AUTH requires TLS_CLIENT_CA_FILE")
+	}
+	return cfg, nil
+}
+
+// configureBackendTLS replaces backendClient's transport when any BACKEND_TLS_* variable is set.
+func configureBackendTLS() error {
+	caFile := os.Getenv("BACKEND_TLS_CA_FILE")
+	certFile, keyFile := os.Getenv("BACKEND_TLS_CERT_FILE"), os.Getenv("BACKEND_TLS_KEY_FILE")
+	serverName := os.Getenv("BACKEND_TLS_SERVER_NAME")
+	insecure := os.Getenv("BACKEND_TLS_INSECURE_SKIP_VERIFY") == "true"
+	if caFile == "" && certFile == "" && keyFile == "" && serverName == "" && !insecure {
+		return nil
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: serverName, InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return fmt.Errorf("BACKEND_TLS_CA_FILE: %w", err)
+		}
+		cfg.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return fmt.Errorf("BACKEND_TLS_CERT_FILE and BACKEND_TLS_KEY_FILE must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("loading backend client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := newBackendTransport()
+	transport.TLSClientConfig = cfg
+	backendClient = &http.Client{Transport: transport, Timeout: handlerTimeout + 5*time.Second}
+	return nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Tracing =====
+//
+// A minimal OpenTelemetry-compatible tracer: W3C traceparent propagation in and out, and
+// batched export over OTLP/HTTP with JSON encoding. Configured with the standard variables:
+//
+//	OTEL_TRACES_EXPORTER          otlp | console | none (default: otlp if an endpoint is set)
+//	OTEL_EXPORTER_OTLP_ENDPOINT   e.g. http://otel-collector:4318 (/v1/traces is appended)
+//	OTEL_EXPORTER_OTLP_TRACES_ENDPOINT  full traces URL, overrides the above
+//	OTEL_EXPORTER_OTLP_HEADERS    k1=v1,k2=v2 (e.g. auth for a hosted collector)
+//	OTEL_SERVICE_NAME             default "mcp-server"
+
+const traceparentHeader = "traceparent"
+
+// Span kinds as defined by OTLP.
+const (
+	spanKindServer = 2
+	spanKindClient = 3
+)
+
+// Span is one timed operation in a trace.
+type Span struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte
+	Name     string
+	Kind     int
+	Start    time.Time
+	EndTime  time.Time
+	Attrs    map[string]string
+	Err      string
+}
+
+type spanKey struct{}
+
+// spanFrom returns the active span on ctx, or nil.
+func spanFrom(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// startSpan starts a child of the span on ctx (or a new trace) and returns a context
+// carrying it. Spans are only recorded when an exporter is configured.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	s := &Span{Name: name, Kind: kind, Start: time.Now(), Attrs: map[string]string{}}
+	rand.Read(s.SpanID[:])
+	if parent := spanFrom(ctx); parent != nil {
+		s.TraceID, s.ParentID = parent.TraceID, parent.SpanID
+	} else {
+		rand.Read(s.TraceID[:])
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttr records a string attribute.
+func (s *Span) SetAttr(k, v string) { s.Attrs[k] = v }
+
+// SetError marks the span as failed.
+func (s *Span) SetError(err error) {
+	if err != nil {
+		s.Err = err.Error()
+	}
+}
+
+// End finishes the span and hands it to the exporter.
+func (s *Span) End() {
+	s.EndTime = time.Now()
+	tracer.enqueue(s)
+}
+
+// traceparent formats the W3C header value for s (always sampled).
+func (s *Span) traceparent() string {
+	return "00-" + hex.EncodeToString(s.TraceID[:]) + "-" + hex.EncodeToString(s.SpanID[:]) + "-01"
+}
+
+// remoteParent parses an incoming traceparent into a placeholder parent span so the
+// server span joins the caller's trace.
+func remoteParent(header string) *Span {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return nil
+	}
+	var p Span
+	if _, err := hex.Decode(p.TraceID[:], []byte(parts[1])); err != nil {
+		return nil
+	}
+	if _, err := hex.Decode(p.SpanID[:], []byte(parts[2])); err != nil {
+		return nil
+	}
+	if p.TraceID == [16]byte{} || p.SpanID == [8]byte{} {
+		return nil
+	}
+	return &p
+}
+
+// injectTraceparent propagates the span on ctx to an outgoing request.
+func injectTraceparent(ctx context.Context, req *http.Request) {
+	if s := spanFrom(ctx); s != nil {
+		req.Header.Set(traceparentHeader, s.traceparent())
+	}
+}
+
+// withTracing starts a server span per request, continuing the caller's trace when a
+// traceparent header is present. It wraps withMetrics so the route pattern can name the span.
+func withTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tracer.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if parent := remoteParent(r.Header.Get(traceparentHeader)); parent != nil {
+			ctx = context.WithValue(ctx, spanKey{}, parent)
+		}
+		ctx, span := startSpan(ctx, r.Method+" "+r.URL.Path, spanKindServer)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		r2 := r.WithContext(ctx)
+		next.ServeHTTP(rec, r2)
+
+		if route := r2.Pattern; route != "" && route != "/" {
+			if i := strings.IndexByte(route, ' '); i >= 0 {
+				route = route[i+1:]
+			}
+			span.Name = r.Method + " " + route
+			span.SetAttr("http.route", route)
+		}
+		span.SetAttr("http.request.method", r.Method)
+		span.SetAttr("url.path", r.URL.Path)
+		span.SetAttr("http.response.status_code", strconv.Itoa(rec.status))
+		span.SetAttr("request_id", requestIDFrom(ctx))
+		if rec.status >= 500 {
+			span.Err = http.StatusText(rec.status)
+		}
+		span.End()
+	})
+}
+
+// ===== Export =====
+
+type spanExporter struct {
+	mu       sync.Mutex
+	mode     string // otlp, console or "" (disabled)
+	endpoint string
+	headers  map[string]string
+	service  string
+	pending  []*Span
+}
+
+var tracer = &spanExporter{}
+
+const traceBatchSize = 512
+
+func (e *spanExporter) enabled() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.mode != ""
+}
+
+func (e *spanExporter) enqueue(s *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.mode == "" {
+		return
+	}
+	if len(e.pending) >= traceBatchSize*4 {
+		return // exporter is behind; drop rather than grow without bound
+	}
+	e.pending = append(e.pending, s)
+}
+
+// configureTracing reads the OTEL_* environment and starts the background flusher.
+func configureTracing(ctx context.Context) {
+	mode := os.Getenv("OTEL_TRACES_EXPORTER")
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	if mode == "" && endpoint != "" {
+		mode = "otlp"
+	}
+	if mode == "none" || mode == "" {
+		return
+	}
+	if mode == "otlp" && endpoint == "" {
+		endpoint = "http://localhost:4318/v1/traces"
+	}
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "mcp-server"
+	}
+	headers := map[string]string{}
+	for _, kv := range splitList(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")) {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+
+	tracer.mu.Lock()
+	tracer.mode, tracer.endpoint, tracer.headers, tracer.service = mode, endpoint, headers, service
+	tracer.mu.Unlock()
+	log.Printf("[MCP] Tracing enabled (%s exporter %s, service %s)\n", mode, endpoint, service)
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				tracer.flush()
+				return
+			case <-ticker.C:
+				tracer.flush()
+			}
+		}
+	}()
+}
+
+// flush exports pending spans. Export failures are logged and the batch dropped.
+func (e *spanExporter) flush() {
+	e.mu.Lock()
+	batch := e.pending
+	e.pending = nil
+	mode, endpoint, headers, service := e.mode, e.endpoint, e.headers, e.service
+	e.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	if mode == "console" {
+		for _, s := range batch {
+			log.Printf("[Trace] trace=%x span=%x parent=%x %q %s err=%q attrs=%v\n",
+				s.TraceID, s.SpanID, s.ParentID, s.Name, s.EndTime.Sub(s.Start), s.Err, s.Attrs)
+		}
+		return
+	}
+
+	body, _ := json.Marshal(otlpPayload(batch, service))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("[Trace] Export failed: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		log.Printf("[Trace] Export of %d spans failed: %v\n", len(batch), err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("[Trace] Export of %d spans rejected: %d\n", len(batch), resp.StatusCode)
+	}
+}
+
+// otlpPayload renders spans as an OTLP ExportTraceServiceRequest in JSON encoding.
+func otlpPayload(batch []*Span, service string) map[string]interface{} {
+	str := func(k, v string) map[string]interface{} {
+		return map[string]interface{}{"key": k, "value": map[string]string{"stringValue": v}}
+	}
+	spans := make([]map[string]interface{}, 0, len(batch))
+	for _, s := range batch {
+		attrs := make([]map[string]interface{}, 0, len(s.Attrs))
+		for k, v := range s.Attrs {
+			attrs = append(attrs, str(k, v))
+		}
+		status := map[string]interface{}{"code": 1} // OK
+		if s.Err != "" {
+			status = map[string]interface{}{"code": 2, "message": s.Err}
+		}
+		span := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.TraceID[:]),
+			"spanId":            hex.EncodeToString(s.SpanID[:]),
+			"name":              s.Name,
+			"kind":              s.Kind,
+			"startTimeUnixNano": fmt.Sprint(s.Start.UnixNano()),
+			"endTimeUnixNano":   fmt.Sprint(s.EndTime.UnixNano()),
+			"attributes":        attrs,
+			"status":            status,
+		}
+		if s.ParentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.ParentID[:])
+		}
+		spans = append(spans, span)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": []interface{}{str("service.name", service)}},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "first_server"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
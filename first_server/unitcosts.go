@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// ===== Unit costs =====
+//
+// unit_costs on /allocations adds unit economics, so capacity planners compare normalized
+// numbers instead of raw totals: cost per pod-hour, per CPU core-hour and per GB-hour of
+// memory. unit_costs=true attaches them to every record and adds meta.unit_costs with the
+// figures for the whole result and per namespace; unit_costs=namespace adds only the meta.
+//
+// Each allocation counts as one pod for its window. Core- and GB-hours come from the
+// backend's cpu_core_hours and ram_gb_hours; a ratio whose usage is zero is null.
+
+// UnitCostMode is "" (off), "true" (per record and aggregated) or "namespace" (aggregated
+// only). JSON accepts a boolean as well as the strings.
+type UnitCostMode string
+
+const (
+	UnitCostsOff       UnitCostMode = ""
+	UnitCostsRecord    UnitCostMode = "true"
+	UnitCostsNamespace UnitCostMode = "namespace"
+)
+
+func (m *UnitCostMode) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+		*m = UnitCostsOff
+	case bool:
+		*m = UnitCostsOff
+		if v {
+			*m = UnitCostsRecord
+		}
+	case string:
+		*m = UnitCostMode(v)
+	default:
+		return fmt.Errorf("unit_costs must be true, false or \"namespace\"")
+	}
+	return nil
+}
+
+// validateUnitCosts normalizes m ("false" means off) and checks it is a known mode.
+func validateUnitCosts(errs *ValidationErrors, m *UnitCostMode) {
+	switch *m {
+	case UnitCostsOff, UnitCostsRecord, UnitCostsNamespace:
+	case "false":
+		*m = UnitCostsOff
+	default:
+		errs.add("unit_costs", string(*m), "must be true, false or namespace")
+	}
+}
+
+// UnitCosts are the unit economics of one or more allocations.
+type UnitCosts struct {
+	Pods               int      `json:"pods"`
+	PodHours           float64  `json:"pod_hours"`
+	CPUCoreHours       float64  `json:"cpu_core_hours"`
+	RAMGBHours         float64  `json:"ram_gb_hours"`
+	CostPerPodHour     *float64 `json:"cost_per_pod_hour"`
+	CostPerCPUCoreHour *float64 `json:"cost_per_cpu_core_hour"`
+	CostPerGBHour      *float64 `json:"cost_per_gb_hour"`
+}
+
+// UnitCostAllocation is an allocation with its own unit costs.
+type UnitCostAllocation struct {
+	Allocation
+	UnitCosts UnitCosts `json:"unit_costs"`
+}
+
+// UnitCostReport is meta.unit_costs.
+type UnitCostReport struct {
+	Total       UnitCosts            `json:"total"`
+	ByNamespace map[string]UnitCosts `json:"by_namespace"`
+}
+
+// unitCostsOf computes the unit costs of allocs taken together.
+func unitCostsOf(allocs []Allocation) UnitCosts {
+	var u UnitCosts
+	var total, cpu, mem float64
+	for _, a := range allocs {
+		start, err1 := time.Parse(time.RFC3339, a.StartTime)
+		end, err2 := time.Parse(time.RFC3339, a.EndTime)
+		if err1 == nil && err2 == nil && end.After(start) {
+			u.PodHours += end.Sub(start).Hours()
+		}
+		u.Pods++
+		u.CPUCoreHours += a.CPUCoreHours
+		u.RAMGBHours += a.RAMGBHours
+		total += a.TotalCost
+		cpu += a.CPUCost
+		mem += a.MemoryCost
+	}
+	u.CostPerPodHour = unitRatio(total, u.PodHours)
+	u.CostPerCPUCoreHour = unitRatio(cpu, u.CPUCoreHours)
+	u.CostPerGBHour = unitRatio(mem, u.RAMGBHours)
+	u.PodHours, u.CPUCoreHours, u.RAMGBHours = round2(u.PodHours), round2(u.CPUCoreHours), round2(u.RAMGBHours)
+	return u
+}
+
+// unitRatio is cost per unit to four decimals, or nil without usage.
+func unitRatio(cost, units float64) *float64 {
+	if units <= 0 {
+		return nil
+	}
+	v := math.Round(cost/units*10000) / 10000
+	return &v
+}
+
+// unitCostReport aggregates allocs overall and per namespace.
+func unitCostReport(allocs []Allocation) UnitCostReport {
+	byNS := map[string][]Allocation{}
+	var names []string
+	for _, a := range allocs {
+		if _, ok := byNS[a.Namespace]; !ok {
+			names = append(names, a.Namespace)
+		}
+		byNS[a.Namespace] = append(byNS[a.Namespace], a)
+	}
+	sort.Strings(names)
+	report := UnitCostReport{Total: unitCostsOf(allocs), ByNamespace: map[string]UnitCosts{}}
+	for _, ns := range names {
+		report.ByNamespace[ns] = unitCostsOf(byNS[ns])
+	}
+	return report
+}
+
+// withUnitCosts attaches each allocation's own unit costs.
+func withUnitCosts(allocs []Allocation) []UnitCostAllocation {
+	out := make([]UnitCostAllocation, len(allocs))
+	for i, a := range allocs {
+		out[i] = UnitCostAllocation{Allocation: a, UnitCosts: unitCostsOf([]Allocation{a})}
+	}
+	return out
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultUnderutilizedThreshold is the utilization (percent) below which both CPU and memory
+// must sit over the whole window for a node to be reported as chronically underutilized.
+const defaultUnderutilizedThreshold = 20.0
+
+// promRangePattern matches Prometheus range durations such as "7d" or "12h".
+var promRangePattern = regexp.MustCompile(`^[0-9]+[smhdwy]$`)
+
+// AssetUtilization is a VM/node asset joined with its node-level usage.
+type AssetUtilization struct {
+	AssetID              string  `json:"asset_id"`
+	Name                 string  `json:"name"`
+	Provider             string  `json:"provider"`
+	Region               string  `json:"region"`
+	Cost                 float64 `json:"cost"`
+	CPUUtilizationPct    float64 `json:"cpu_utilization_pct"`
+	MemoryUtilizationPct float64 `json:"memory_utilization_pct"`
+	Underutilized        bool    `json:"underutilized"`
+	IdleCostEstimate     float64 `json:"idle_cost_estimate"` // cost share not backed by CPU usage
+}
+
+// round2 rounds to two decimal places for presentation.
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// isNodeAsset reports whether an asset is a VM or Kubernetes node that node metrics apply to.
+func isNodeAsset(a Asset) bool {
+	switch strings.ToLower(a.Type) {
+	case "vm", "node":
+		return true
+	}
+	return false
+}
+
+// assetUtilizationHandler handles GET /assets/utilization.
+// Joins VM/node assets with Prometheus node metrics (matched on instance = asset_id or name)
+// and flags nodes whose CPU and memory both stay below the threshold for the window. Nodes
+// missing either metric can't be judged and are listed in meta.incomplete_assets instead.
+func assetUtilizationHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /assets/utilization request received")
+
+	provider := resolveAliases(r.Context(), "provider", r.URL.Query().Get("provider"))
+	region := resolveAliases(r.Context(), "region", r.URL.Query().Get("region"))
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = "7d"
+	}
+	threshold := defaultUnderutilizedThreshold
+
+	var verrs ValidationErrors
+	validateProvider(&verrs, provider)
+	if !promRangePattern.MatchString(window) {
+		verrs.add("window", window, "must be a duration such as 24h or 7d")
+	}
+	if t := r.URL.Query().Get("threshold"); t != "" {
+		v, err := strconv.ParseFloat(t, 64)
+		if err != nil || v <= 0 || v > 100 {
+			verrs.add("threshold", t, "must be a percentage greater than 0 and at most 100")
+		} else {
+			threshold = v
+		}
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, namespaceFilter{}, provider) {
+		return
+	}
+
+	assets, err := costSource.GetAssets(r.Context(), AssetFilter{Provider: provider, Region: region})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get assets", err)
+		return
+	}
+	nodes, err := getNodeUtilization(r.Context(), window)
+	if err != nil {
+		writeBackendError(w, r, "Failed to get node metrics", err)
+		return
+	}
+
+	results := []AssetUtilization{}
+	unmatched := []string{}
+	incomplete := []string{}
+	underutilized := 0
+	for _, asset := range assets {
+		// Like /assets, filter locally too: not every cost source honours the filter
+		if !isNodeAsset(asset) ||
+			provider != "" && !strings.EqualFold(asset.Provider, provider) ||
+			region != "" && !strings.EqualFold(asset.Region, region) {
+			continue
+		}
+		node, ok := nodes[asset.AssetID]
+		if !ok {
+			node, ok = nodes[asset.Name]
+		}
+		if !ok {
+			unmatched = append(unmatched, asset.AssetID)
+			continue
+		}
+		if !node.HasCPU || !node.HasMemory {
+			incomplete = append(incomplete, asset.AssetID)
+			continue
+		}
+		u := AssetUtilization{
+			AssetID:              asset.AssetID,
+			Name:                 asset.Name,
+			Provider:             asset.Provider,
+			Region:               asset.Region,
+			Cost:                 asset.Cost,
+			CPUUtilizationPct:    round2(node.CPU * 100),
+			MemoryUtilizationPct: round2(node.Memory * 100),
+			IdleCostEstimate:     round2(asset.Cost * (1 - node.CPU)),
+		}
+		u.Underutilized = u.CPUUtilizationPct < threshold && u.MemoryUtilizationPct < threshold
+		if u.Underutilized {
+			underutilized++
+		}
+		results = append(results, u)
+	}
+	logf(r.Context(), "[MCP] /assets/utilization — %d nodes joined, %d underutilized\n", len(results), underutilized)
+
+	resp := map[string]interface{}{
+		"data": results,
+		"meta": map[string]interface{}{
+			"filtersUsed":         map[string]string{"provider": provider, "region": region, "window": window},
+			"threshold_pct":       threshold,
+			"underutilized_count": underutilized,
+			"unmatched_assets":    unmatched,
+			"incomplete_assets":   incomplete,
+			"total":               len(results),
+			"request_id":          requestIDFrom(r.Context()),
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// A node missing a metric is not reported as idle, and the region filter applies even when
+// the cost source ignores it.
+func TestAssetUtilizationHandler(t *testing.T) {
+	prom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		series := map[string]string{"cpu-only": "0.05", "both": "0.05", "busy": "0.9", "east": "0.05"} // CPU
+		if strings.Contains(r.URL.Query().Get("query"), nodeMemoryUtilizationMetric) {
+			series = map[string]string{"mem-only": "0.05", "both": "0.1", "busy": "0.8", "east": "0.05"}
+		}
+		var result []string
+		for instance, v := range series {
+			result = append(result, fmt.Sprintf(`{"metric": {"instance": %q}, "value": [0, %q]}`, instance, v))
+		}
+		fmt.Fprintf(w, `{"status": "success", "data": {"resultType": "vector", "result": [%s]}}`, strings.Join(result, ","))
+	}))
+	defer prom.Close()
+	savedURL, savedSource := prometheusURL, costSource
+	t.Cleanup(func() { prometheusURL, costSource = savedURL, savedSource })
+	prometheusURL = prom.URL
+	var assets []Asset
+	for _, id := range []string{"cpu-only", "mem-only", "both", "busy", "missing"} {
+		assets = append(assets, Asset{AssetID: id, Type: "VM", Provider: "AWS", Region: "us-west-2", Cost: 100})
+	}
+	assets = append(assets, Asset{AssetID: "east", Type: "VM", Provider: "AWS", Region: "us-east-1", Cost: 100})
+	costSource = staticSource{assets: assets}
+
+	w := httptest.NewRecorder()
+	assetUtilizationHandler(w, httptest.NewRequest(http.MethodGet, "/assets/utilization?region=us-west-2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data []AssetUtilization `json:"data"`
+		Meta struct {
+			Underutilized int      `json:"underutilized_count"`
+			Unmatched     []string `json:"unmatched_assets"`
+			Incomplete    []string `json:"incomplete_assets"`
+		} `json:"meta"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	var joined []string
+	for _, u := range resp.Data {
+		joined = append(joined, fmt.Sprintf("%s:%v", u.AssetID, u.Underutilized))
+	}
+	if got := strings.Join(joined, ","); got != "both:true,busy:false" {
+		t.Errorf("joined %s, want both:true,busy:false", got)
+	}
+	if resp.Meta.Underutilized != 1 {
+		t.Errorf("underutilized_count = %d, want 1", resp.Meta.Underutilized)
+	}
+	if got := strings.Join(resp.Meta.Incomplete, ","); got != "cpu-only,mem-only" {
+		t.Errorf("incomplete_assets = %s, want cpu-only,mem-only", got)
+	}
+	if got := strings.Join(resp.Meta.Unmatched, ","); got != "missing" {
+		t.Errorf("unmatched_assets = %s, want missing", got)
+	}
+}
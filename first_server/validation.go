@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// knownProviders lists the cloud providers the server understands. Provider filters are
+// matched case-insensitively against these values.
+var knownProviders = []string{"AWS", "Azure", "GCP"}
+
+// FieldError describes a single invalid filter value.
+type FieldError struct {
+	Field   string `json:"field"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects every field-level problem found in a request so the caller
+// can fix them all at once instead of one round trip per mistake.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, fe := range v {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return "invalid filters: " + strings.Join(msgs, "; ")
+}
+
+// add records a field error.
+func (v *ValidationErrors) add(field, value, message string) {
+	*v = append(*v, FieldError{Field: field, Value: value, Message: message})
+}
+
+// validateWindow checks that start and end are RFC3339 timestamps (when set) and that
+// end does not precede start.
+func validateWindow(errs *ValidationErrors, start, end string) {
+	startTime, errStart := parseDate(start)
+	if errStart != nil {
+		errs.add("start", start, "must be an RFC3339 timestamp, e.g. 2025-08-01T00:00:00Z")
+	}
+	endTime, errEnd := parseDate(end)
+	if errEnd != nil {
+		errs.add("end", end, "must be an RFC3339 timestamp, e.g. 2025-08-02T00:00:00Z")
+	}
+	if errStart == nil && errEnd == nil && !startTime.IsZero() && !endTime.IsZero() && endTime.Before(startTime) {
+		errs.add("end", end, "must not be before start ("+startTime.Format(time.RFC3339)+")")
+	}
+}
+
+// validateProvider checks that provider, when set, is one of knownProviders.
+func validateProvider(errs *ValidationErrors, provider string) {
+	if provider == "" {
+		return
+	}
+	for _, p := range knownProviders {
+		if strings.EqualFold(p, provider) {
+			return
+		}
+	}
+	msg := "unknown provider; expected one of " + strings.Join(knownProviders, ", ")
+	if near := closestMatches(provider, knownProviders, 1); len(near) > 0 {
+		msg += "; did you mean " + near[0] + "?"
+	}
+	errs.add("provider", provider, msg)
+}
+
+// writeValidationError responds with 400 and the error envelope, listing each invalid
+// field in details.
+func writeValidationError(w http.ResponseWriter, r *http.Request, errs ValidationErrors) {
+	writeError(w, r, http.StatusBadRequest, ErrCodeInvalidFilters, errs.Error(), errs)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Warnings =====
+//
+// Conditions that don't fail a request but change its answer are reported in meta.warnings
+// instead of only being logged:
+//
+//	ignored_filter        a filter the endpoint doesn't apply, e.g. start on /cloudCosts
+//	deprecated_parameter  a parameter kept for old clients, e.g. filters.namespace as the
+//	                      provider of /assets
+//	unparsable_date       backend records whose timestamps aren't RFC3339
+//	partial_failure       part of the answer is missing or stale, e.g. the backend failed and
+//	                      the local store answered, or a summary went without its baseline
+//	unknown_value         a filter value the backend has never returned, with "did you
+//	                      mean" suggestions (see suggest.go)
+//	unresolved_reference  a question refers to an earlier query ("that region") that the
+//	                      session can't answer (see references.go)
+//	mixed_currency        asset costs in a currency without a conversion rate, so totals add
+//	                      different currencies (see currency.go)
+//
+// Code anywhere below a handler calls addWarning with the request context; withWarnings
+// adds what was collected to the response's meta. Responses without warnings are untouched.
+
+// Warning is one entry of meta.warnings.
+type Warning struct {
+	Code        string   `json:"code"`
+	Field       string   `json:"field,omitempty"`
+	Message     string   `json:"message"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// warningList collects a request's warnings, the per-source statuses of a federated answer
+// (see partial.go), the filter aliases applied (see aliases.go), the references resolved
+// (see references.go), the freshness of its data (see freshness.go), the currencies it
+// converted (see currency.go) and, when asked for, its explanation (see explain.go).
+type warningList struct {
+	mu sync.Mutex
+	metaExtras
+}
+
+// metaExtras is what a request collected for its meta.
+type metaExtras struct {
+	items      []Warning
+	sources    []SourceStatus
+	aliases    []AliasMapping
+	references []ReferenceResolution
+	freshness  []FreshnessSource
+	currency   *CurrencyReport
+	explain    *Explanation
+}
+
+// extras copies out what was collected so far.
+func (l *warningList) extras() metaExtras {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.metaExtras
+}
+
+// pending reports whether there is anything to add to meta.
+func (x metaExtras) pending() bool {
+	return len(x.items) > 0 || len(x.sources) > 0 || len(x.aliases) > 0 || len(x.references) > 0 ||
+		len(x.freshness) > 0 || x.currency != nil || x.explain != nil
+}
+
+type warningsKey struct{}
+
+// addWarning records a warning for the request in ctx, ignoring exact repeats. Outside a
+// request (background jobs) it only logs.
+func addWarning(ctx context.Context, code, field, format string, args ...interface{}) {
+	addWarningWith(ctx, Warning{Code: code, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// addWarningWith records w as addWarning does, for warnings with more than a message.
+func addWarningWith(ctx context.Context, w Warning) {
+	logf(ctx, "[MCP] Warning %s: %s\n", w.Code, w.Message)
+	list, _ := ctx.Value(warningsKey{}).(*warningList)
+	if list == nil {
+		return
+	}
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	for _, seen := range list.items {
+		if seen.Code == w.Code && seen.Field == w.Field && seen.Message == w.Message {
+			return
+		}
+	}
+	list.items = append(list.items, w)
+}
+
+// withWarnings collects warnings while next runs and adds them to its JSON response. A
+// response that lost one of its sources goes out as 207 Multi-Status. Nested inside another
+// request (a query run by /overview, say), the freshness of its data and the currencies it
+// converted also count for the outer one.
+func withWarnings(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		outer := r.Context()
+		list := &warningList{}
+		r = r.WithContext(context.WithValue(outer, warningsKey{}, list))
+		ww := &warningWriter{ResponseWriter: w, list: list}
+		next.ServeHTTP(ww, r)
+		ww.flush()
+		x := list.extras()
+		for _, s := range x.freshness {
+			noteFreshness(outer, s.Source, s.Data, s.AsOf)
+		}
+		if x.currency != nil {
+			noteCurrency(outer, x.currency)
+		}
+	})
+}
+
+// warningWriter passes the response through unless warnings were raised by the time the
+// handler writes its header, in which case it holds the body back to add them.
+type warningWriter struct {
+	http.ResponseWriter
+	list        *warningList
+	wroteHeader bool
+	held        *httptest.ResponseRecorder
+}
+
+func (ww *warningWriter) WriteHeader(status int) {
+	if ww.wroteHeader {
+		return
+	}
+	ww.wroteHeader = true
+	if ww.list.extras().pending() && strings.HasPrefix(ww.Header().Get("Content-Type"), "application/json") {
+		ww.held = httptest.NewRecorder()
+		ww.held.Code = status
+		return
+	}
+	ww.ResponseWriter.WriteHeader(status)
+}
+
+func (ww *warningWriter) Write(b []byte) (int, error) {
+	if !ww.wroteHeader {
+		ww.WriteHeader(http.StatusOK)
+	}
+	if ww.held != nil {
+		return ww.held.Body.Write(b)
+	}
+	return ww.ResponseWriter.Write(b)
+}
+
+// flush writes a held response with the warnings added to meta.
+func (ww *warningWriter) flush() {
+	if ww.held == nil {
+		return
+	}
+	body := ww.held.Body.Bytes()
+	x := ww.list.extras()
+	status := ww.held.Code
+	if withMeta, ok := addWarningsToMeta(body, x); ok {
+		body = withMeta
+		ww.Header().Del("Content-Length")
+		if status == http.StatusOK && anySourceFailed(x.sources) {
+			status = http.StatusMultiStatus
+		}
+	}
+	ww.ResponseWriter.WriteHeader(status)
+	ww.ResponseWriter.Write(body)
+}
+
+// addWarningsToMeta sets meta.warnings, meta.sources, meta.aliases, meta.references,
+// meta.freshness, meta.currency and meta.explain in a {"data", "meta"} envelope.
+func addWarningsToMeta(body []byte, x metaExtras) ([]byte, bool) {
+	var env map[string]json.RawMessage
+	if json.Unmarshal(body, &env) != nil {
+		return nil, false
+	}
+	if _, ok := env["data"]; !ok {
+		return nil, false
+	}
+	meta := map[string]interface{}{}
+	if raw, ok := env["meta"]; ok && json.Unmarshal(raw, &meta) != nil {
+		return nil, false
+	}
+	if len(x.items) > 0 {
+		meta["warnings"] = x.items
+	}
+	if len(x.sources) > 0 {
+		meta["sources"] = x.sources
+	}
+	if len(x.aliases) > 0 {
+		meta["aliases"] = x.aliases
+	}
+	if len(x.references) > 0 {
+		meta["references"] = x.references
+	}
+	if f := freshnessAt(x.freshness, time.Now()); f != nil {
+		meta["freshness"] = f
+	}
+	if x.currency != nil {
+		meta["currency"] = x.currency
+	}
+	if explain := x.explain; explain != nil {
+		explain.mu.Lock()
+		defer explain.mu.Unlock()
+		meta["explain"] = explain
+	}
+	out := make(map[string]interface{}, len(env))
+	for k, v := range env {
+		out[k] = v
+	}
+	if x.explain.dryRun() {
+		// A dry run answers with its plan, not with whatever the cache held
+		meta["dry_run"] = true
+		out["data"] = []interface{}{}
+		delete(out, "summary")
+	}
+	out["meta"] = meta
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if enc.Encode(out) != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// warnIgnoredFilters warns about each non-empty filter of f not in used.
+func warnIgnoredFilters(ctx context.Context, endpoint string, f QueryFilters, used ...string) {
+	for _, kv := range [][2]string{
+		{"namespace", f.Namespace}, {"start", f.Start}, {"end", f.End}, {"window", f.Window},
+		{"timezone", f.Timezone}, {"provider", f.Provider}, {"region", f.Region}, {"status", f.Status},
+		{"tag", f.Tag}, {"resolution", f.Resolution}, {"expr", f.Expr},
+	} {
+		if kv[1] != "" && !slices.Contains(used, kv[0]) {
+			addWarning(ctx, "ignored_filter", "filters."+kv[0], "%s doesn't apply filters.%s; it was ignored", endpoint, kv[0])
+		}
+	}
+}
+
+// warnUnparsableTimes warns when backend allocations carry timestamps that aren't RFC3339;
+// window filtering treats those as open-ended.
+func warnUnparsableTimes(ctx context.Context, allocs []Allocation) {
+	bad := 0
+	for _, a := range allocs {
+		for _, ts := range []string{a.StartTime, a.EndTime} {
+			if _, err := time.Parse(time.RFC3339, ts); ts != "" && err != nil {
+				bad++
+				break
+			}
+		}
+	}
+	if bad > 0 {
+		addWarning(ctx, "unparsable_date", "", "%d allocation(s) have a start_time or end_time that isn't RFC3339; they were treated as overlapping the window", bad)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ===== Waste detection =====
+//
+// GET /assets/waste lists assets that are billed for nothing, the quickest savings there are.
+// Nothing here knows what is attached to what, so the categories are heuristics over asset
+// type, status and the allocations that reference assets (through asset_ids or resource_id)
+// in the idle window (default 7d):
+//
+//	unattached_disk     a disk or volume no allocation references
+//	idle_load_balancer  a load balancer no allocation references
+//	stopped_vm          a VM or node that is stopped, yet still billed (disks, IPs, licenses)
+//
+// Assets created within the idle window are left out of the reference checks. Each asset's
+// monthly_burn is its cost scaled from the period asset costs cover (period, default 30d) to
+// a 30-day month; meta.by_category and meta.monthly_burn add them up. provider and region
+// narrow the assets as on /assets.
+
+// Waste categories.
+const (
+	WasteUnattachedDisk   = "unattached_disk"
+	WasteIdleLoadBalancer = "idle_load_balancer"
+	WasteStoppedVM        = "stopped_vm"
+)
+
+// defaultWastePeriod is what asset costs are taken to cover when period isn't given.
+const defaultWastePeriod = "30d"
+
+// wasteMonth is the month monthly_burn is quoted for.
+const wasteMonth = 30 * 24 * time.Hour
+
+// WastedAsset is an asset of /assets/waste.
+type WastedAsset struct {
+	Asset
+	Category    string  `json:"category"`
+	Reason      string  `json:"reason"`
+	MonthlyBurn float64 `json:"monthly_burn"`
+}
+
+// WasteTotal is one entry of meta.by_category.
+type WasteTotal struct {
+	Assets      int     `json:"assets"`
+	MonthlyBurn float64 `json:"monthly_burn"`
+}
+
+// isDiskAsset reports whether a is a disk or volume.
+func isDiskAsset(a Asset) bool {
+	switch strings.ToLower(a.Type) {
+	case "disk", "volume", "pv", "persistentvolume":
+		return true
+	}
+	return false
+}
+
+// isLoadBalancerAsset reports whether a is a load balancer.
+func isLoadBalancerAsset(a Asset) bool {
+	t := strings.ToLower(strings.ReplaceAll(a.Type, " ", ""))
+	return t == "loadbalancer" || t == "lb"
+}
+
+// wasteCategory is the category a billed asset falls in and why, or "" if it looks used.
+func wasteCategory(a Asset, active map[string]bool, since time.Time) (string, string) {
+	unreferenced := !active[a.AssetID] && !createdSince(a, since)
+	switch {
+	case isDiskAsset(a):
+		if unreferenced {
+			return WasteUnattachedDisk, "no allocation references it"
+		}
+	case isLoadBalancerAsset(a):
+		if unreferenced {
+			return WasteIdleLoadBalancer, "no allocation references it"
+		}
+	case isNodeAsset(a):
+		if assetStatus(a) == "stopped" {
+			return WasteStoppedVM, "stopped but billed"
+		}
+	}
+	return "", ""
+}
+
+// assetsWasteHandler handles GET /assets/waste.
+func assetsWasteHandler(w http.ResponseWriter, r *http.Request) {
+	logf(r.Context(), "[MCP] /assets/waste request received")
+
+	provider := resolveAliases(r.Context(), "provider", r.URL.Query().Get("provider"))
+	region := resolveAliases(r.Context(), "region", r.URL.Query().Get("region"))
+	idleText := r.URL.Query().Get("idle")
+	if idleText == "" {
+		idleText = defaultOrphanIdle
+	}
+	periodText := r.URL.Query().Get("period")
+	if periodText == "" {
+		periodText = defaultWastePeriod
+	}
+
+	var verrs ValidationErrors
+	validateProvider(&verrs, provider)
+	idle, err := parseLookback(idleText)
+	if err != nil {
+		verrs.add("idle", idleText, "must be a positive duration like 12h, 7d or 2w")
+	}
+	period, err := parseLookback(periodText)
+	if err != nil {
+		verrs.add("period", periodText, "must be a positive duration like 24h, 7d or 30d")
+	}
+	if len(verrs) > 0 {
+		writeValidationError(w, r, verrs)
+		return
+	}
+	if !checkTenant(w, r, namespaceFilter{}, provider) {
+		return
+	}
+
+	assets, err := costSource.GetAssets(r.Context(), AssetFilter{Provider: provider, Region: region})
+	if err != nil {
+		writeBackendError(w, r, "Failed to get assets", err)
+		return
+	}
+	since := time.Now().UTC().Add(-idle)
+	active, err := assetActivity(r.Context(), since)
+	if err != nil {
+		writeBackendError(w, r, "Failed to get allocations", err)
+		return
+	}
+
+	scale := float64(wasteMonth) / float64(period)
+	results := []WastedAsset{}
+	byCategory := map[string]*WasteTotal{}
+	var burn float64
+	for _, a := range assets {
+		if a.Cost <= 0 || provider != "" && !strings.EqualFold(a.Provider, provider) || region != "" && !strings.EqualFold(a.Region, region) {
+			continue
+		}
+		category, reason := wasteCategory(a, active, since)
+		if category == "" {
+			continue
+		}
+		wa := WastedAsset{Asset: a, Category: category, Reason: reason, MonthlyBurn: round2(a.Cost * scale)}
+		results = append(results, wa)
+		if byCategory[category] == nil {
+			byCategory[category] = &WasteTotal{}
+		}
+		byCategory[category].Assets++
+		byCategory[category].MonthlyBurn = round2(byCategory[category].MonthlyBurn + wa.MonthlyBurn)
+		burn += wa.MonthlyBurn
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].MonthlyBurn > results[j].MonthlyBurn })
+	logf(r.Context(), "[MCP] /assets/waste — %d of %d assets wasted, %.2f a month\n", len(results), len(assets), burn)
+
+	resp := map[string]interface{}{
+		"data": results,
+		"meta": map[string]interface{}{
+			"filtersUsed":  map[string]string{"provider": provider, "region": region, "idle": idleText, "period": periodText},
+			"since":        since.Format(time.RFC3339),
+			"by_category":  byCategory,
+			"monthly_burn": round2(burn),
+			"total":        len(results),
+			"request_id":   requestIDFrom(r.Context()),
+		},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
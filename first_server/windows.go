@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // zone names resolve even on hosts without a zoneinfo database
+)
+
+// ===== Relative windows =====
+//
+// A window is an OpenCost-style shorthand resolved server-side to an RFC3339 start/end:
+//
+//	today, yesterday          calendar day (today ends now)
+//	week, lastweek            week starting Sunday, as OpenCost does (week ends now)
+//	month, lastmonth          calendar month (month ends now)
+//	7d, 24h, 2w, 30m          duration ending now
+//	<start>,<end>             explicit RFC3339 pair
+//
+// Calendar windows and day buckets follow the caller's timezone (filters.timezone, an IANA
+// name such as "Europe/Berlin"); UTC is the default.
+//
+// When no window or start/end is given, common phrases in the natural-language query
+// ("yesterday", "last 7 days", "this month") are recognized too.
+
+// ResolvedWindow reports how a window was interpreted, echoed in meta.
+type ResolvedWindow struct {
+	Input  string `json:"input"`
+	Source string `json:"source"` // "filter" or "query"
+	Start  string `json:"start"`
+	End    string `json:"end"`
+}
+
+// resolveWindow turns a window expression into [start, end) at now in loc.
+func resolveWindow(window string, now time.Time, loc *time.Location) (time.Time, time.Time, error) {
+	now = now.In(loc)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	w := strings.ToLower(strings.TrimSpace(window))
+	switch w {
+	case "today":
+		return midnight, now, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), midnight, nil
+	case "week":
+		return midnight.AddDate(0, 0, -int(now.Weekday())), now, nil
+	case "lastweek":
+		thisWeek := midnight.AddDate(0, 0, -int(now.Weekday()))
+		return thisWeek.AddDate(0, 0, -7), thisWeek, nil
+	case "month":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc), now, nil
+	case "lastmonth":
+		thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		return thisMonth.AddDate(0, -1, 0), thisMonth, nil
+	}
+	if a, b, ok := strings.Cut(window, ","); ok {
+		start, err1 := time.Parse(time.RFC3339, strings.TrimSpace(a))
+		end, err2 := time.Parse(time.RFC3339, strings.TrimSpace(b))
+		if err1 != nil || err2 != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("start,end pairs must both be RFC3339 timestamps")
+		}
+		if end.Before(start) {
+			return time.Time{}, time.Time{}, fmt.Errorf("end must not be before start")
+		}
+		return start, end, nil
+	}
+	if d, err := parseLookback(w); err == nil {
+		return now.Add(-d), now, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("use today, yesterday, week, lastweek, month, lastmonth, a duration like 7d or 24h, or start,end")
+}
+
+// loadTimezone resolves an IANA zone name, recording unknown zones in errs under field.
+// An empty name is UTC.
+func loadTimezone(errs *ValidationErrors, field, tz string) *time.Location {
+	if tz == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		errs.add(field, tz, "must be an IANA time zone such as America/New_York")
+		return time.UTC
+	}
+	return loc
+}
+
+// windowPhrases maps natural-language phrases to window expressions, most specific first.
+var windowPhrases = []struct {
+	re     *regexp.Regexp
+	window func(m []string) string
+}{
+	{regexp.MustCompile(`\b(?:last|past|previous)\s+(\d+)\s*(hours?|hrs?|h|days?|d|weeks?|w)\b`), func(m []string) string {
+		return m[1] + map[byte]string{'h': "h", 'd': "d", 'w': "w"}[m[2][0]]
+	}},
+	{regexp.MustCompile(`\b(?:last|past|previous)\s+(24 hours|day)\b`), func([]string) string { return "24h" }},
+	{regexp.MustCompile(`\blast\s+week\b`), func([]string) string { return "lastweek" }},
+	{regexp.MustCompile(`\blast\s+month\b`), func([]string) string { return "lastmonth" }},
+	{regexp.MustCompile(`\bthis\s+week\b`), func([]string) string { return "week" }},
+	{regexp.MustCompile(`\bthis\s+month\b|\bmonth[- ]to[- ]date\b`), func([]string) string { return "month" }},
+	{regexp.MustCompile(`\byesterday\b`), func([]string) string { return "yesterday" }},
+	{regexp.MustCompile(`\btoday\b`), func([]string) string { return "today" }},
+}
+
+// windowFromQuery finds a relative window phrase in a natural-language query.
+func windowFromQuery(query string) string {
+	q := strings.ToLower(query)
+	for _, p := range windowPhrases {
+		if m := p.re.FindStringSubmatch(q); m != nil {
+			return p.window(m)
+		}
+	}
+	return ""
+}
+
+// applyWindow resolves window into *start and *end. Without a window and without explicit
+// start/end, a phrase in queryText is used instead. It returns what was applied, or nil.
+func applyWindow(errs *ValidationErrors, window, queryText string, start, end *string, now time.Time, loc *time.Location) *ResolvedWindow {
+	source := "filter"
+	if window == "" {
+		if *start != "" || *end != "" {
+			return nil
+		}
+		if window = windowFromQuery(queryText); window == "" {
+			return nil
+		}
+		source = "query"
+	} else if *start != "" || *end != "" {
+		errs.add("window", window, "cannot be combined with start/end")
+		return nil
+	}
+
+	s, e, err := resolveWindow(window, now, loc)
+	if err != nil {
+		errs.add("window", window, err.Error())
+		return nil
+	}
+	*start, *end = s.Format(time.RFC3339), e.Format(time.RFC3339)
+	return &ResolvedWindow{Input: window, Source: source, Start: *start, End: *end}
+}
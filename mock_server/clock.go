@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"costtypes"
+)
+
+// ===== Clock control =====
+//
+// Relative windows ("last 7 days", window=7d) depend on the current time, and the built-in
+// data is dated August 2025. The mock's clock can be frozen or offset, and the data can be
+// shifted to follow it, so tests of relative windows get the same answer every day:
+//
+//	PUT /admin/clock {"now": "2025-08-03T12:00:00Z"}   freeze the clock
+//	PUT /admin/clock {"offset": "-48h"}                 real time plus an offset
+//	PUT /admin/clock {"shift_data": true}               move allocations along with the clock
+//	DELETE /admin/clock                                 back to real time, data unshifted
+//
+// An X-Mock-Now header (RFC3339) sets "now" for one request. With shift_data, allocation
+// times move by the distance from dataEpoch to the clock's midnight, so the built-in day is
+// always yesterday; seed data written relative to dataEpoch moves the same way.
+
+// dataEpoch is "now" for the built-in data: it covers the day before.
+var dataEpoch = time.Date(2025, 8, 2, 0, 0, 0, 0, time.UTC)
+
+// Clock is the clock setting managed through /admin/clock.
+type Clock struct {
+	Now       *time.Time `json:"now,omitempty"`        // frozen time; nil follows real time
+	Offset    string     `json:"offset,omitempty"`     // Go duration added to real time
+	ShiftData bool       `json:"shift_data,omitempty"` // date allocations relative to the clock
+
+	offset time.Duration
+}
+
+var (
+	clockMu sync.Mutex
+	clock   Clock
+)
+
+// clockNow is the mock's current time for r.
+func clockNow(r *http.Request) time.Time {
+	if v := r.Header.Get("X-Mock-Now"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t.UTC()
+		}
+	}
+	clockMu.Lock()
+	defer clockMu.Unlock()
+	if clock.Now != nil {
+		return *clock.Now
+	}
+	return time.Now().UTC().Add(clock.offset)
+}
+
+// dataShift is how far allocation times move for r: zero unless shift_data is set.
+func dataShift(r *http.Request) time.Duration {
+	clockMu.Lock()
+	shift := clock.ShiftData
+	clockMu.Unlock()
+	if !shift {
+		return 0
+	}
+	return clockNow(r).Truncate(24 * time.Hour).Sub(dataEpoch)
+}
+
+// shiftAllocation moves a's times by d. Unparsable times are left alone.
+func shiftAllocation(a costtypes.Allocation, d time.Duration) costtypes.Allocation {
+	if d == 0 {
+		return a
+	}
+	for _, field := range []*string{&a.StartTime, &a.EndTime} {
+		if t, err := time.Parse(time.RFC3339, *field); err == nil {
+			*field = t.Add(d).UTC().Format(time.RFC3339)
+		}
+	}
+	return a
+}
+
+// clockHandler serves GET, PUT and DELETE /admin/clock. Responses include the current time.
+func clockHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		var c Clock
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			writeMockError(w, http.StatusBadRequest, "invalid clock: "+err.Error())
+			return
+		}
+		if c.Offset != "" {
+			d, err := time.ParseDuration(c.Offset)
+			if err != nil {
+				writeMockError(w, http.StatusBadRequest, fmt.Sprintf("offset %q is not a duration such as -48h", c.Offset))
+				return
+			}
+			c.offset = d
+		}
+		if c.Now != nil && c.Offset != "" {
+			writeMockError(w, http.StatusBadRequest, "set now or offset, not both")
+			return
+		}
+		if c.Now != nil {
+			t := c.Now.UTC()
+			c.Now = &t
+		}
+		clockMu.Lock()
+		clock = c
+		clockMu.Unlock()
+		log.Printf("[Mock] Clock set: now %s, shift_data %t", clockNow(r).Format(time.RFC3339), c.ShiftData)
+	case http.MethodDelete:
+		clockMu.Lock()
+		clock = Clock{}
+		clockMu.Unlock()
+		log.Println("[Mock] Clock reset to real time")
+	}
+	clockMu.Lock()
+	c := clock
+	clockMu.Unlock()
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{
+		"clock":   c,
+		"current": clockNow(r).Format(time.RFC3339),
+		"shift":   dataShift(r).String(),
+	})
+}
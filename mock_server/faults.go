@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ===== Fault injection =====
+//
+// The data endpoints can be made to misbehave, so the MCP server's error and retry paths can
+// be tested against a real HTTP backend. A fault is set for every later request with
+// PUT /admin/faults (GET shows it, DELETE clears it), or for one request with query params:
+//
+//	fault_latency=2s       wait this long before answering
+//	fault_status=503       answer with this status and an error body instead of data
+//	fault=malformed        answer 200 with a body that isn't valid JSON
+//	fault=truncate         declare the full Content-Length but send only half the body
+//
+// Query params apply on top of the configured fault.
+
+// Fault describes how to break responses. The zero Fault changes nothing.
+type Fault struct {
+	Latency   string   `json:"latency,omitempty"`   // Go duration added before answering
+	Status    int      `json:"status,omitempty"`    // 4xx/5xx status answered instead of data
+	Malformed bool     `json:"malformed,omitempty"` // invalid JSON with status 200
+	Truncate  bool     `json:"truncate,omitempty"`  // body cut off mid-stream
+	Rate      float64  `json:"rate,omitempty"`      // fraction of matching requests affected; 0 means all
+	Paths     []string `json:"paths,omitempty"`     // only these paths, e.g. ["/allocations"]; empty means all
+	Count     int      `json:"count,omitempty"`     // clear the fault after this many injections; 0 means never
+
+	latency time.Duration
+}
+
+// validate checks f and parses its latency.
+func (f *Fault) validate() error {
+	if f.Latency != "" {
+		d, err := time.ParseDuration(f.Latency)
+		if err != nil || d < 0 {
+			return fmt.Errorf("latency %q is not a duration such as 500ms or 2s", f.Latency)
+		}
+		f.latency = d
+	}
+	if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+		return fmt.Errorf("status %d must be between 400 and 599", f.Status)
+	}
+	if f.Rate < 0 || f.Rate > 1 {
+		return fmt.Errorf("rate %v must be between 0 and 1", f.Rate)
+	}
+	if f.Count < 0 {
+		return fmt.Errorf("count %d must not be negative", f.Count)
+	}
+	return nil
+}
+
+func (f *Fault) matches(path string) bool {
+	if len(f.Paths) == 0 {
+		return true
+	}
+	for _, p := range f.Paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	faultMu sync.Mutex
+	fault   *Fault // the configured fault; nil when none
+)
+
+// takeFault returns the configured fault if it applies to this request, counting it against
+// the fault's Count.
+func takeFault(path string) Fault {
+	faultMu.Lock()
+	defer faultMu.Unlock()
+	if fault == nil || !fault.matches(path) || (fault.Rate > 0 && rand.Float64() >= fault.Rate) {
+		return Fault{}
+	}
+	f := *fault
+	if fault.Count > 0 {
+		fault.Count--
+		if fault.Count == 0 {
+			fault = nil
+		}
+	}
+	return f
+}
+
+// requestFault adds the fault_* query params of r to f.
+func requestFault(r *http.Request, f Fault) (Fault, error) {
+	q := r.URL.Query()
+	if v := q.Get("fault_latency"); v != "" {
+		f.Latency = v
+	}
+	if v := q.Get("fault_status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return f, fmt.Errorf("fault_status %q is not a number", v)
+		}
+		f.Status = status
+	}
+	switch v := q.Get("fault"); v {
+	case "":
+	case "malformed":
+		f.Malformed = true
+	case "truncate":
+		f.Truncate = true
+	default:
+		return f, fmt.Errorf("fault %q must be malformed or truncate", v)
+	}
+	return f, f.validate()
+}
+
+// withFaults wraps a data handler with the configured and requested faults.
+func withFaults(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := requestFault(r, takeFault(r.URL.Path))
+		if err != nil {
+			writeMockError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f.latency > 0 {
+			select {
+			case <-time.After(f.latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if f.Status != 0 {
+			log.Printf("[Mock] Injected status %d on %s", f.Status, r.URL.Path)
+			writeMockError(w, f.Status, "injected fault")
+			return
+		}
+		if !f.Malformed && !f.Truncate {
+			next(w, r)
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		next(rec, r)
+		body := rec.Body.Bytes()
+		w.Header().Set("Content-Type", "application/json")
+		if f.Malformed {
+			log.Printf("[Mock] Injected malformed JSON on %s", r.URL.Path)
+			body = append(body[:len(body)/2:len(body)/2], "}}not json"...)
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body)
+			return
+		}
+		// Promise the whole body, send half: the client sees the connection close early
+		log.Printf("[Mock] Injected truncated body on %s", r.URL.Path)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body[:len(body)/2])
+	}
+}
+
+// faultsHandler serves GET, PUT and DELETE /admin/faults.
+func faultsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		var f Fault
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&f); err != nil {
+			writeMockError(w, http.StatusBadRequest, "invalid fault: "+err.Error())
+			return
+		}
+		if err := f.validate(); err != nil {
+			writeMockError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		faultMu.Lock()
+		fault = &f
+		faultMu.Unlock()
+		log.Printf("[Mock] Fault set: %+v", f)
+		writeMockJSON(w, http.StatusOK, f)
+	case http.MethodDelete:
+		faultMu.Lock()
+		fault = nil
+		faultMu.Unlock()
+		log.Println("[Mock] Fault cleared")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		faultMu.Lock()
+		f := fault
+		faultMu.Unlock()
+		if f == nil {
+			f = &Fault{}
+		}
+		writeMockJSON(w, http.StatusOK, f)
+	}
+}
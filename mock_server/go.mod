@@ -0,0 +1,7 @@
+module mock_server
+
+go 1.24.5
+
+require costtypes v0.0.0
+
+replace costtypes => ../costtypes
@@ -2,60 +2,92 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
+
+	"costtypes"
 )
 
 // ===== Hardcoded Data =====
 
-var cloudCostsData = []map[string]interface{}{
-	{"name": "prod-vm-1", "cpuCost": 10.5, "gpuCost": 5.0, "totalCost": 15.5},
-	{"name": "dev-vm-2", "cpuCost": 8.0, "gpuCost": 3.5, "totalCost": 11.5},
-}
+// The records use the costtypes structs the MCP server decodes, so the mock can't drift from
+// the fields the server expects.
 
-var allocationsData = []map[string]interface{}{
-	{
-		"namespace":   "dev",
-		"resource_id": "pod-123",
-		"cpu_cost":    4.5,
-		"memory_cost": 1.2,
-		"gpu_cost":    0,
-		"total_cost":  5.7,
-		"start_time":  "2025-08-01T00:00:00Z",
-		"end_time":    "2025-08-02T00:00:00Z",
-	},
-	{
-		"namespace":   "prod",
-		"resource_id": "pod-456",
-		"cpu_cost":    10,
-		"memory_cost": 3.5,
-		"gpu_cost":    0,
-		"total_cost":  13.5,
-		"start_time":  "2025-08-01T00:00:00Z",
-		"end_time":    "2025-08-02T00:00:00Z",
-	},
+// defaultData is what the mock serves at startup (without MOCK_DATA_FILE) and after
+// POST /reset. Test scenarios change it at runtime through the handlers in store.go.
+func defaultData() dataSet {
+	start, end := dataEpoch.AddDate(0, 0, -1), dataEpoch
+
+	node := costtypes.NewAsset("asset-001", "AWS EC2 m5.large", "VM", "AWS", "us-west-2", 120.5)
+	node.PricingModel = "on-demand"
+	db := costtypes.NewAsset("asset-002", "Azure SQL Database", "Database", "Azure", "centralindia", 300.75)
+	db.PricingModel = "reserved"
+	spot := costtypes.NewAsset("asset-003", "GCP n2-standard-4", "VM", "GCP", "us-central1", 95.2)
+	spot.PricingModel = "spot"
+	node.CreatedAt = dataEpoch.AddDate(0, -6, 0).Format(time.RFC3339)
+	db.CreatedAt = dataEpoch.AddDate(-1, 0, 0).Format(time.RFC3339)
+	spot.CreatedAt = dataEpoch.AddDate(0, 0, -3).Format(time.RFC3339)
+	// A stopped VM no workload runs on that still bills for its disk
+	stopped := costtypes.NewAsset("asset-004", "AWS EC2 t3.medium", "VM", "AWS", "us-west-2", 14.4)
+	stopped.Status, stopped.PricingModel = "stopped", "on-demand"
+	stopped.CreatedAt = dataEpoch.AddDate(0, -3, 0).Format(time.RFC3339)
+	node.Tags = map[string]string{"owner": "platform", "env": "prod"}
+	db.Tags = map[string]string{"owner": "payments", "env": "prod"}
+	spot.Tags = map[string]string{"owner": "data", "env": "dev"}
+	stopped.Tags = map[string]string{"owner": "platform"}
+	// Left behind when the checkout service moved: a detached volume and its old load balancer
+	volume := costtypes.NewAsset("asset-005", "AWS EBS gp3 200GiB", "Disk", "AWS", "us-west-2", 16)
+	volume.CreatedAt = dataEpoch.AddDate(0, -4, 0).Format(time.RFC3339)
+	volume.Tags = map[string]string{"owner": "payments"}
+	lb := costtypes.NewAsset("asset-006", "AWS ALB checkout-old", "LoadBalancer", "AWS", "us-west-2", 18.25)
+	lb.CreatedAt = dataEpoch.AddDate(0, -8, 0).Format(time.RFC3339)
+	lb.Tags = map[string]string{"owner": "payments"}
+
+	dev := costtypes.NewAllocation("dev", "pod-123", 4.5, 1.2, 0, start, end)
+	dev.CPUCoreHours, dev.RAMGBHours = 24, 48
+	dev.Labels = map[string]string{"app": "web", "team": "frontend"}
+	dev.AssetIDs = []string{"asset-003"}
+
+	prod := costtypes.NewAllocation("prod", "pod-456", 10, 3.5, 0, start, end).WithNetworkAndStorage(0.4, 1.1)
+	prod.CPUCoreHours, prod.RAMGBHours = 48, 96
+	prod.Labels = map[string]string{"app": "checkout"}
+	prod.AssetIDs = []string{"asset-001", "asset-002"}
+
+	system := costtypes.NewAllocation("kube-system", "pod-789", 2.2, 0.8, 0, start, end)
+	system.CPUCoreHours, system.RAMGBHours = 12, 24
+	system.AssetIDs = []string{"asset-001"}
+
+	return dataSet{
+		CloudCosts: []costtypes.CloudCost{
+			costtypes.NewCloudCost("prod-vm-1", 10.5, 5.0),
+			costtypes.NewCloudCost("dev-vm-2", 8.0, 3.5),
+		},
+		Allocations: []costtypes.Allocation{dev, prod, system},
+		Assets:      []costtypes.Asset{node, db, spot, stopped, volume, lb},
+	}
 }
 
-var assetsData = []map[string]interface{}{
-	{
-		"asset_id": "asset-001",
-		"name":     "AWS EC2 m5.large",
-		"type":     "VM",
-		"status":   "active",
-		"provider": "AWS",
-		"region":   "us-west-2",
-		"cost":     120.5,
+// nodeMetricsData holds average node utilization ratios (0..1) per instance, served
+// through a minimal Prometheus-compatible /api/v1/query endpoint.
+var nodeMetricsData = map[string]map[string]float64{
+	"instance:node_cpu_utilisation:rate5m": {
+		"asset-001": 0.62,
+		"asset-003": 0.08,
+	},
+	"instance:node_memory_utilisation:ratio": {
+		"asset-001": 0.71,
+		"asset-003": 0.14,
 	},
-	{
-		"asset_id": "asset-002",
-		"name":     "Azure SQL Database",
-		"type":     "Database",
-		"status":   "active",
-		"provider": "Azure",
-		"region":   "centralindia",
-		"cost":     300.75,
+	// DCGM reports percent, but the mock doesn't evaluate PromQL: this is the ratio the
+	// server's query (which divides by 100) would return.
+	"DCGM_FI_DEV_GPU_UTIL": {
+		"asset-009": 0.35,
 	},
 }
 
@@ -64,10 +96,12 @@ var assetsData = []map[string]interface{}{
 // /cloudCosts
 func cloudCostsHandler(w http.ResponseWriter, r *http.Request) {
 	namespace := r.URL.Query().Get("namespace")
-	filtered := []map[string]interface{}{}
-	for _, cost := range cloudCostsData {
+	filtered := []costtypes.CloudCost{}
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	for _, cost := range data.CloudCosts {
 		if namespace == "" ||
-			strings.Contains(strings.ToLower(cost["name"].(string)), strings.ToLower(namespace)) {
+			strings.Contains(strings.ToLower(cost.Name), strings.ToLower(namespace)) {
 			filtered = append(filtered, cost)
 		}
 	}
@@ -83,21 +117,25 @@ func allocationsHandler(w http.ResponseWriter, r *http.Request) {
 	startTime, errStart := time.Parse(time.RFC3339, start)
 	endTime, errEnd := time.Parse(time.RFC3339, end)
 
-	filtered := []map[string]interface{}{}
-	for _, alloc := range allocationsData {
+	filtered := []costtypes.Allocation{}
+	shift := dataShift(r)
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	for _, alloc := range data.Allocations {
+		alloc = shiftAllocation(alloc, shift)
 		// Namespace filter
-		if namespace != "" && alloc["namespace"] != namespace {
+		if namespace != "" && alloc.Namespace != namespace {
 			continue
 		}
 		// Date range filter
 		if start != "" && errStart == nil {
-			allocEnd, err := time.Parse(time.RFC3339, alloc["end_time"].(string))
+			allocEnd, err := time.Parse(time.RFC3339, alloc.EndTime)
 			if err == nil && allocEnd.Before(startTime) {
 				continue
 			}
 		}
 		if end != "" && errEnd == nil {
-			allocStart, err := time.Parse(time.RFC3339, alloc["start_time"].(string))
+			allocStart, err := time.Parse(time.RFC3339, alloc.StartTime)
 			if err == nil && allocStart.After(endTime) {
 				continue
 			}
@@ -112,12 +150,14 @@ func allocationsHandler(w http.ResponseWriter, r *http.Request) {
 func assetsHandler(w http.ResponseWriter, r *http.Request) {
 	provider := r.URL.Query().Get("provider")
 	region := r.URL.Query().Get("region")
-	filtered := []map[string]interface{}{}
-	for _, asset := range assetsData {
-		if provider != "" && !strings.EqualFold(asset["provider"].(string), provider) {
+	filtered := []costtypes.Asset{}
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	for _, asset := range data.Assets {
+		if provider != "" && !strings.EqualFold(asset.Provider, provider) {
 			continue
 		}
-		if region != "" && !strings.EqualFold(asset["region"].(string), region) {
+		if region != "" && !strings.EqualFold(asset.Region, region) {
 			continue
 		}
 		filtered = append(filtered, asset)
@@ -126,13 +166,84 @@ func assetsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(filtered)
 }
 
+// /api/v1/query — returns an instant vector for whichever known metric the query mentions
+func promQueryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("query")
+	result := []map[string]interface{}{}
+	for metric, byInstance := range nodeMetricsData {
+		if !strings.Contains(query, metric) {
+			continue
+		}
+		for instance, v := range byInstance {
+			result = append(result, map[string]interface{}{
+				"metric": map[string]string{"__name__": metric, "instance": instance},
+				"value":  []interface{}{float64(time.Now().Unix()), strconv.FormatFloat(v, 'f', -1, 64)},
+			})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"data":   map[string]interface{}{"resultType": "vector", "result": result},
+	})
+}
+
+// logRequests logs each request with the X-Request-ID the MCP server forwarded, so a
+// backend call can be matched to the agent request that caused it.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" {
+			id = "-"
+		}
+		if tp := r.Header.Get("traceparent"); tp != "" {
+			log.Printf("[Mock] [req=%s] [traceparent=%s] %s %s", id, tp, r.Method, r.URL.RequestURI())
+		} else {
+			log.Printf("[Mock] [req=%s] %s %s", id, r.Method, r.URL.RequestURI())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func main() {
-	http.HandleFunc("/cloudCosts", cloudCostsHandler)
-	http.HandleFunc("/allocations", allocationsHandler)
-	http.HandleFunc("/assets", assetsHandler)
+	defaultPort := os.Getenv("PORT")
+	if defaultPort == "" {
+		defaultPort = "9005"
+	}
+	host := flag.String("host", os.Getenv("HOST"), "interface to listen on; empty for all (env HOST)")
+	port := flag.String("port", defaultPort, "port to listen on (env PORT)")
+	flag.Parse()
+
+	if err := loadData(os.Getenv("MOCK_DATA_FILE")); err != nil {
+		log.Fatalf("Mock server failed to load data: %v", err)
+	}
+
+	http.HandleFunc("GET /cloudCosts", withFaults(cloudCostsHandler))
+	http.HandleFunc("GET /allocations", withFaults(allocationsHandler))
+	if opencostMode {
+		http.HandleFunc("GET /assets", withFaults(opencostAssetsHandler))
+	} else {
+		http.HandleFunc("GET /assets", withFaults(assetsHandler))
+	}
+	http.HandleFunc("GET /allocation/compute", withFaults(allocationComputeHandler))
+	http.HandleFunc("GET /allocation", withFaults(allocationComputeHandler))
+	http.HandleFunc("/api/v1/query", withFaults(promQueryHandler))
+	cloudCosts.register()
+	allocations.register()
+	assets.register()
+	http.HandleFunc("POST /reset", resetHandler)
+	http.HandleFunc("GET /admin/faults", faultsHandler)
+	http.HandleFunc("PUT /admin/faults", faultsHandler)
+	http.HandleFunc("DELETE /admin/faults", faultsHandler)
+	http.HandleFunc("GET /admin/requests", requestsHandler)
+	http.HandleFunc("DELETE /admin/requests", requestsHandler)
+	http.HandleFunc("GET /admin/clock", clockHandler)
+	http.HandleFunc("PUT /admin/clock", clockHandler)
+	http.HandleFunc("DELETE /admin/clock", clockHandler)
 
-	log.Println("Mock OpenCost server running on :9005")
-	if err := http.ListenAndServe(":9005", nil); err != nil {
+	addr := net.JoinHostPort(*host, *port)
+	log.Printf("Mock OpenCost server running on %s", addr)
+	if err := http.ListenAndServe(addr, logRequests(recordRequests(http.DefaultServeMux))); err != nil {
 		log.Fatalf("Mock server failed to start: %v", err)
 	}
 }
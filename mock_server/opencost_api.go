@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"costtypes"
+)
+
+// ===== OpenCost-compatible API =====
+//
+// The data endpoints above use this project's simplified shapes. An adapter for a real
+// OpenCost needs its shapes instead, so the mock also serves them:
+//
+//	GET /allocation/compute (and /allocation)   window, aggregate, accumulate, step, filterNamespaces
+//	GET /assets with MOCK_API=opencost          window
+//
+// Answers use OpenCost's envelope, {"code": 200, "status": "success", "data": ...}.
+// Allocation data is a list of sets, one per step, each mapping a name to an allocation with
+// properties, window and per-resource costs. Asset data maps keys to assets. Windows are
+// durations ending now ("7d", "24h"), "today", "yesterday", or a "start,end" pair of RFC3339
+// times or Unix seconds; "now" is the mock's clock (see clock.go).
+
+// opencostCluster is the cluster name reported on every record.
+const opencostCluster = "cluster-one"
+
+// opencostMode reports whether /assets answers in OpenCost's shape.
+var opencostMode = os.Getenv("MOCK_API") == "opencost"
+
+type ocWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type ocAllocationProperties struct {
+	Cluster   string            `json:"cluster,omitempty"`
+	Namespace string            `json:"namespace,omitempty"`
+	Pod       string            `json:"pod,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type ocAllocation struct {
+	Name        string                 `json:"name"`
+	Properties  ocAllocationProperties `json:"properties"`
+	Window      ocWindow               `json:"window"`
+	Start       time.Time              `json:"start"`
+	End         time.Time              `json:"end"`
+	Minutes     float64                `json:"minutes"`
+	CPUCost     float64                `json:"cpuCost"`
+	GPUCost     float64                `json:"gpuCost"`
+	RAMCost     float64                `json:"ramCost"`
+	PVCost      float64                `json:"pvCost"`
+	NetworkCost float64                `json:"networkCost"`
+	TotalCost   float64                `json:"totalCost"`
+
+	CPUCoreHours float64 `json:"cpuCoreHours"`
+	RAMByteHours float64 `json:"ramByteHours"`
+	GPUHours     float64 `json:"gpuHours"`
+}
+
+type ocAssetProperties struct {
+	Category   string `json:"category"`
+	Provider   string `json:"provider"`
+	ProviderID string `json:"providerID"`
+	Name       string `json:"name"`
+	Service    string `json:"service"`
+	Cluster    string `json:"cluster"`
+	Region     string `json:"region,omitempty"`
+}
+
+type ocAsset struct {
+	Type       string            `json:"type"`
+	Properties ocAssetProperties `json:"properties"`
+	Window     ocWindow          `json:"window"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Minutes    float64           `json:"minutes"`
+	TotalCost  float64           `json:"totalCost"`
+	Labels     map[string]string `json:"labels,omitempty"`
+
+	Preemptible float64 `json:"preemptible,omitempty"` // 1 for spot nodes
+}
+
+func writeOpenCost(w http.ResponseWriter, data interface{}) {
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{"code": http.StatusOK, "status": "success", "data": data})
+}
+
+func writeOpenCostError(w http.ResponseWriter, status int, msg string) {
+	writeMockJSON(w, status, map[string]interface{}{"code": status, "message": msg})
+}
+
+// parseOpenCostWindow resolves an OpenCost window parameter against now.
+func parseOpenCostWindow(v string, now time.Time) (time.Time, time.Time, error) {
+	now = now.UTC().Truncate(time.Second)
+	midnight := now.Truncate(24 * time.Hour)
+	switch v {
+	case "":
+		return time.Time{}, time.Time{}, fmt.Errorf("window parameter required")
+	case "today":
+		return midnight, now, nil
+	case "yesterday":
+		return midnight.AddDate(0, 0, -1), midnight, nil
+	}
+	if a, b, ok := strings.Cut(v, ","); ok {
+		start, err1 := parseOpenCostTime(a)
+		end, err2 := parseOpenCostTime(b)
+		if err1 != nil || err2 != nil || !end.After(start) {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid window %q", v)
+		}
+		return start, end, nil
+	}
+	d, err := parseOpenCostDuration(v)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid window %q", v)
+	}
+	return now.Add(-d), now, nil
+}
+
+func parseOpenCostTime(v string) (time.Time, error) {
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// parseOpenCostDuration accepts Go durations plus a "d" suffix for days.
+func parseOpenCostDuration(v string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", v)
+	}
+	return d, nil
+}
+
+// allocationKey names an allocation in a set by the aggregate parameter. Unaggregated
+// allocations are keyed by cluster/namespace/pod, as OpenCost keys them by their properties.
+func allocationKey(a costtypes.Allocation, aggregate string) (string, error) {
+	switch {
+	case aggregate == "":
+		return opencostCluster + "/" + a.Namespace + "/" + a.ResourceID, nil
+	case aggregate == "cluster":
+		return opencostCluster, nil
+	case aggregate == "namespace":
+		return a.Namespace, nil
+	case aggregate == "pod":
+		return a.ResourceID, nil
+	case strings.HasPrefix(aggregate, "label:"):
+		if v, ok := a.Labels[strings.TrimPrefix(aggregate, "label:")]; ok {
+			return v, nil
+		}
+		return "__unallocated__", nil
+	}
+	return "", fmt.Errorf("unsupported aggregate %q; use cluster, namespace, pod or label:<name>", aggregate)
+}
+
+// allocationComputeHandler serves /allocation/compute. Allocations are pro-rated by their
+// overlap with each step, and costs of the same key are summed.
+func allocationComputeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, end, err := parseOpenCostWindow(q.Get("window"), clockNow(r))
+	if err != nil {
+		writeOpenCostError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	step := end.Sub(start)
+	if v := q.Get("step"); v != "" && q.Get("accumulate") != "true" {
+		if step, err = parseOpenCostDuration(v); err != nil {
+			writeOpenCostError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if end.Sub(start)/step > 1000 {
+			writeOpenCostError(w, http.StatusBadRequest, "too many steps in window")
+			return
+		}
+	}
+	aggregate := q.Get("aggregate")
+	namespaces := map[string]bool{}
+	for _, ns := range strings.Split(q.Get("filterNamespaces"), ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces[ns] = true
+		}
+	}
+
+	shift := dataShift(r)
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	sets := []map[string]*ocAllocation{}
+	for s := start; s.Before(end); s = s.Add(step) {
+		e := s.Add(step)
+		if e.After(end) {
+			e = end
+		}
+		set := map[string]*ocAllocation{}
+		for _, a := range data.Allocations {
+			a = shiftAllocation(a, shift)
+			if len(namespaces) > 0 && !namespaces[a.Namespace] {
+				continue
+			}
+			as, err1 := time.Parse(time.RFC3339, a.StartTime)
+			ae, err2 := time.Parse(time.RFC3339, a.EndTime)
+			if err1 != nil || err2 != nil || !ae.After(as) {
+				continue
+			}
+			from, to := maxTime(as, s), minTime(ae, e)
+			if !to.After(from) {
+				continue
+			}
+			key, err := allocationKey(a, aggregate)
+			if err != nil {
+				writeOpenCostError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			share := to.Sub(from).Seconds() / ae.Sub(as).Seconds()
+			oc, ok := set[key]
+			if !ok {
+				oc = &ocAllocation{Name: key, Window: ocWindow{s, e}, Start: from, End: to}
+				oc.Properties.Cluster = opencostCluster
+				if aggregate == "" || aggregate == "namespace" || aggregate == "pod" {
+					oc.Properties.Namespace = a.Namespace
+				}
+				if aggregate == "" || aggregate == "pod" {
+					oc.Properties.Pod = a.ResourceID
+					oc.Properties.Labels = a.Labels
+				}
+				set[key] = oc
+			}
+			oc.Start, oc.End = minTime(oc.Start, from), maxTime(oc.End, to)
+			oc.Minutes = oc.End.Sub(oc.Start).Minutes()
+			oc.CPUCost += a.CPUCost * share
+			oc.RAMCost += a.MemoryCost * share
+			oc.GPUCost += a.GPUCost * share
+			oc.PVCost += a.PVCost * share
+			oc.NetworkCost += a.NetworkCost * share
+			oc.TotalCost += a.TotalCost * share
+			oc.CPUCoreHours += a.CPUCoreHours * share
+			oc.RAMByteHours += a.RAMGBHours * share * 1e9
+			oc.GPUHours += a.GPUHours * share
+		}
+		sets = append(sets, set)
+	}
+	writeOpenCost(w, sets)
+}
+
+// ocAssetType maps the mock's asset types to OpenCost's.
+func ocAssetType(t string) (string, string) {
+	switch strings.ToLower(t) {
+	case "vm", "node":
+		return "Node", "Compute"
+	case "disk", "volume":
+		return "Disk", "Storage"
+	case "loadbalancer":
+		return "LoadBalancer", "Network"
+	}
+	return "Cloud", "Other"
+}
+
+// opencostAssetsHandler serves /assets in OpenCost's shape. Each asset covers the window,
+// clipped to its created_at and terminated_at; one outside the window is left out.
+func opencostAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := parseOpenCostWindow(r.URL.Query().Get("window"), clockNow(r))
+	if err != nil {
+		writeOpenCostError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dataMu.RLock()
+	defer dataMu.RUnlock()
+	set := map[string]ocAsset{}
+	for _, a := range data.Assets {
+		from, to := start, end
+		if t, err := time.Parse(time.RFC3339, a.CreatedAt); err == nil && t.After(from) {
+			from = t
+		}
+		if t, err := time.Parse(time.RFC3339, a.TerminatedAt); err == nil && t.Before(to) {
+			to = t
+		}
+		if !from.Before(to) {
+			continue
+		}
+		typ, category := ocAssetType(a.Type)
+		asset := ocAsset{
+			Type: typ,
+			Properties: ocAssetProperties{
+				Category:   category,
+				Provider:   a.Provider,
+				ProviderID: a.AssetID,
+				Name:       a.Name,
+				Service:    a.Type,
+				Cluster:    opencostCluster,
+				Region:     a.Region,
+			},
+			Window:    ocWindow{start, end},
+			Start:     from,
+			End:       to,
+			Minutes:   to.Sub(from).Minutes(),
+			TotalCost: a.Cost,
+			Labels:    a.Tags,
+		}
+		if typ == "Node" && a.PricingModel == "spot" {
+			asset.Preemptible = 1
+		}
+		set[a.Provider+"/"+typ+"/"+a.AssetID] = asset
+	}
+	writeOpenCost(w, set)
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.IsZero() || b.Before(a) {
+		return b
+	}
+	return a
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ===== Request recording =====
+//
+// Every request except /admin/* is recorded, so an integration test can drive the MCP server
+// and then assert exactly what it asked the backend for. GET /admin/requests lists the
+// recorded requests, oldest first; ?path=, ?request_id= and ?since= (RFC3339) narrow the
+// list.
+// DELETE /admin/requests clears it between tests.
+
+// maxRecordedRequests bounds the log; the oldest requests are dropped first.
+const maxRecordedRequests = 1000
+
+// RecordedRequest is one request as the mock received it.
+type RecordedRequest struct {
+	Time      time.Time           `json:"time"`
+	Method    string              `json:"method"`
+	Path      string              `json:"path"`
+	Params    map[string][]string `json:"params"`
+	RequestID string              `json:"request_id,omitempty"` // X-Request-ID from the MCP server
+	Status    int                 `json:"status"`
+}
+
+var (
+	recordedMu sync.Mutex
+	recorded   []RecordedRequest
+)
+
+// statusRecorder captures the status a handler answers with.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// recordRequests appends each non-admin request to the log once it has been answered.
+func recordRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/admin/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := RecordedRequest{
+			Time:      time.Now().UTC(),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Params:    r.URL.Query(),
+			RequestID: r.Header.Get("X-Request-ID"),
+		}
+		sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+		rec.Status = sw.status
+
+		recordedMu.Lock()
+		defer recordedMu.Unlock()
+		recorded = append(recorded, rec)
+		if len(recorded) > maxRecordedRequests {
+			recorded = recorded[len(recorded)-maxRecordedRequests:]
+		}
+	})
+}
+
+// requestsHandler serves GET and DELETE /admin/requests.
+func requestsHandler(w http.ResponseWriter, r *http.Request) {
+	recordedMu.Lock()
+	defer recordedMu.Unlock()
+	if r.Method == http.MethodDelete {
+		recorded = nil
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	path := r.URL.Query().Get("path")
+	requestID := r.URL.Query().Get("request_id")
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeMockError(w, http.StatusBadRequest, "since must be RFC3339")
+			return
+		}
+		since = t
+	}
+	list := []RecordedRequest{}
+	for _, rec := range recorded {
+		if (path == "" || rec.Path == path) && (requestID == "" || rec.RequestID == requestID) && !rec.Time.Before(since) {
+			list = append(list, rec)
+		}
+	}
+	writeMockJSON(w, http.StatusOK, list)
+}
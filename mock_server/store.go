@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"costtypes"
+)
+
+// ===== Runtime data =====
+//
+// Test scenarios seed, change and clear the mock's records over HTTP instead of editing the
+// hardcoded data. Each of /cloudCosts, /allocations and /assets accepts:
+//
+//	POST   /{collection}         add one record or an array, replacing records with the same key
+//	PUT    /{collection}         replace the whole collection with an array
+//	DELETE /{collection}         remove every record
+//	PUT    /{collection}/{key}   add or replace one record; the path sets its key
+//	DELETE /{collection}/{key}   remove one record
+//
+// Records are keyed by name (cloudCosts), resource_id (allocations) or asset_id (assets).
+// POST /reset restores the hardcoded data. With MOCK_DATA_FILE set, the data is loaded from
+// that file at startup and written back after every change, so it survives restarts.
+
+// dataSet is everything the mock serves, and the layout of MOCK_DATA_FILE.
+type dataSet struct {
+	CloudCosts  []costtypes.CloudCost  `json:"cloudCosts"`
+	Allocations []costtypes.Allocation `json:"allocations"`
+	Assets      []costtypes.Asset      `json:"assets"`
+}
+
+var (
+	dataMu   sync.RWMutex
+	data     = defaultData()
+	dataPath string
+)
+
+// collection is one record type's CRUD handlers.
+type collection[T any] struct {
+	name     string
+	keyField string
+	key      func(*T) *string
+	items    func(*dataSet) *[]T
+	validate func(*T) error
+}
+
+var (
+	cloudCosts = &collection[costtypes.CloudCost]{
+		name:     "cloudCosts",
+		keyField: "name",
+		key:      func(c *costtypes.CloudCost) *string { return &c.Name },
+		items:    func(d *dataSet) *[]costtypes.CloudCost { return &d.CloudCosts },
+	}
+	allocations = &collection[costtypes.Allocation]{
+		name:     "allocations",
+		keyField: "resource_id",
+		key:      func(a *costtypes.Allocation) *string { return &a.ResourceID },
+		items:    func(d *dataSet) *[]costtypes.Allocation { return &d.Allocations },
+		validate: validateAllocation,
+	}
+	assets = &collection[costtypes.Asset]{
+		name:     "assets",
+		keyField: "asset_id",
+		key:      func(a *costtypes.Asset) *string { return &a.AssetID },
+		items:    func(d *dataSet) *[]costtypes.Asset { return &d.Assets },
+	}
+)
+
+// validateAllocation checks that set times are RFC3339, since the GET handler filters on them.
+func validateAllocation(a *costtypes.Allocation) error {
+	for field, v := range map[string]string{"start_time": a.StartTime, "end_time": a.EndTime} {
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339, v); err != nil {
+			return fmt.Errorf("%s %q is not RFC3339", field, v)
+		}
+	}
+	return nil
+}
+
+func (c *collection[T]) register() {
+	http.HandleFunc("POST /"+c.name, c.addHandler)
+	http.HandleFunc("PUT /"+c.name, c.replaceHandler)
+	http.HandleFunc("DELETE /"+c.name, c.clearHandler)
+	http.HandleFunc("PUT /"+c.name+"/{key}", c.putHandler)
+	http.HandleFunc("DELETE /"+c.name+"/{key}", c.deleteHandler)
+}
+
+// check validates records before they are stored.
+func (c *collection[T]) check(records []T) error {
+	for i := range records {
+		if *c.key(&records[i]) == "" {
+			return fmt.Errorf("record %d has no %s", i, c.keyField)
+		}
+		if c.validate != nil {
+			if err := c.validate(&records[i]); err != nil {
+				return fmt.Errorf("record %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// upsertLocked replaces the record with rec's key or appends rec. It reports whether rec was
+// new. Callers hold dataMu.
+func (c *collection[T]) upsertLocked(rec T) bool {
+	items := c.items(&data)
+	k := *c.key(&rec)
+	for i := range *items {
+		if *c.key(&(*items)[i]) == k {
+			(*items)[i] = rec
+			return false
+		}
+	}
+	*items = append(*items, rec)
+	return true
+}
+
+func (c *collection[T]) addHandler(w http.ResponseWriter, r *http.Request) {
+	records, err := decodeRecords[T](r)
+	if err == nil {
+		err = c.check(records)
+	}
+	if err != nil {
+		writeMockError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	for _, rec := range records {
+		c.upsertLocked(rec)
+	}
+	if !saveLocked(w) {
+		return
+	}
+	log.Printf("[Mock] Added %d %s records", len(records), c.name)
+	writeMockJSON(w, http.StatusCreated, records)
+}
+
+func (c *collection[T]) replaceHandler(w http.ResponseWriter, r *http.Request) {
+	records, err := decodeRecords[T](r)
+	if err == nil {
+		err = c.check(records)
+	}
+	if err != nil {
+		writeMockError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	*c.items(&data) = []T{}
+	for _, rec := range records {
+		c.upsertLocked(rec)
+	}
+	if !saveLocked(w) {
+		return
+	}
+	log.Printf("[Mock] Replaced %s with %d records", c.name, len(records))
+	writeMockJSON(w, http.StatusOK, *c.items(&data))
+}
+
+func (c *collection[T]) clearHandler(w http.ResponseWriter, r *http.Request) {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	*c.items(&data) = []T{}
+	if !saveLocked(w) {
+		return
+	}
+	log.Printf("[Mock] Cleared %s", c.name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *collection[T]) putHandler(w http.ResponseWriter, r *http.Request) {
+	var rec T
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rec); err != nil {
+		writeMockError(w, http.StatusBadRequest, "invalid record: "+err.Error())
+		return
+	}
+	*c.key(&rec) = r.PathValue("key")
+	if err := c.check([]T{rec}); err != nil {
+		writeMockError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	created := c.upsertLocked(rec)
+	if !saveLocked(w) {
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeMockJSON(w, status, rec)
+}
+
+func (c *collection[T]) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	k := r.PathValue("key")
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	items := c.items(&data)
+	for i := range *items {
+		if *c.key(&(*items)[i]) == k {
+			*items = append((*items)[:i], (*items)[i+1:]...)
+			if saveLocked(w) {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+	}
+	writeMockError(w, http.StatusNotFound, fmt.Sprintf("no %s record %q", c.name, k))
+}
+
+// resetHandler restores the hardcoded data.
+func resetHandler(w http.ResponseWriter, r *http.Request) {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	data = defaultData()
+	if !saveLocked(w) {
+		return
+	}
+	log.Println("[Mock] Data reset to defaults")
+	writeMockJSON(w, http.StatusOK, data)
+}
+
+// decodeRecords reads a request body holding one record or an array of them. Unknown fields
+// are rejected so a misspelt field doesn't silently seed a zero cost.
+func decodeRecords[T any](r *http.Request) ([]T, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %w", err)
+	}
+	raw = bytes.TrimSpace(raw)
+	single := len(raw) > 0 && raw[0] != '['
+	if single {
+		raw = append(append([]byte{'['}, raw...), ']')
+	}
+	var records []T
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&records); err != nil {
+		return nil, fmt.Errorf("invalid record: %w", err)
+	}
+	return records, nil
+}
+
+// loadData replaces the hardcoded data with path's contents, if path is set and exists.
+// Later changes are written back to path.
+func loadData(path string) error {
+	dataMu.Lock()
+	defer dataMu.Unlock()
+	dataPath = path
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("[Mock] %s doesn't exist yet; starting from the hardcoded data", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var loaded dataSet
+	if err := json.Unmarshal(raw, &loaded); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	data = loaded
+	log.Printf("[Mock] Loaded %d cloud costs, %d allocations and %d assets from %s",
+		len(data.CloudCosts), len(data.Allocations), len(data.Assets), path)
+	return nil
+}
+
+// saveLocked writes the data to MOCK_DATA_FILE via a temp file and rename, answering 500 if
+// that fails. Callers hold dataMu.
+func saveLocked(w http.ResponseWriter) bool {
+	if dataPath == "" {
+		return true
+	}
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err == nil {
+		tmp := dataPath + ".tmp"
+		if err = os.WriteFile(tmp, raw, 0o644); err == nil {
+			err = os.Rename(tmp, dataPath)
+		}
+	}
+	if err != nil {
+		writeMockError(w, http.StatusInternalServerError, "failed to persist data: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeMockError(w http.ResponseWriter, status int, msg string) {
+	writeMockJSON(w, status, map[string]string{"error": msg})
+}